@@ -92,6 +92,17 @@ type BlobStatter interface {
 	Stat(ctx context.Context, dgst digest.Digest) (Descriptor, error)
 }
 
+// BlobBatchStatter is an optional interface of a BlobStatter which can
+// describe many blobs at once, in fewer requests to the storage backend than
+// a Stat call per blob.
+type BlobBatchStatter interface {
+	// StatMany provides metadata about each of the blobs identified by
+	// dgsts. Both returned slices are the length of dgsts; errs[i] is
+	// non-nil, as Stat would have returned it, if the blob could not be
+	// described.
+	StatMany(ctx context.Context, dgsts []digest.Digest) (descs []Descriptor, errs []error)
+}
+
 // BlobDeleter enables deleting blobs from storage.
 type BlobDeleter interface {
 	Delete(ctx context.Context, dgst digest.Digest) error
@@ -7,13 +7,21 @@ import (
 	_ "github.com/docker/distribution/registry/auth/htpasswd"
 	_ "github.com/docker/distribution/registry/auth/silly"
 	_ "github.com/docker/distribution/registry/auth/token"
+	_ "github.com/docker/distribution/registry/middleware/repository/p2p"
 	_ "github.com/docker/distribution/registry/proxy"
 	_ "github.com/docker/distribution/registry/storage/driver/azure"
+	_ "github.com/docker/distribution/registry/storage/driver/external"
 	_ "github.com/docker/distribution/registry/storage/driver/filesystem"
 	_ "github.com/docker/distribution/registry/storage/driver/gcs"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	_ "github.com/docker/distribution/registry/storage/driver/kodo"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/chaos"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/circuitbreaker"
 	_ "github.com/docker/distribution/registry/storage/driver/middleware/cloudfront"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/compress"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/pack"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/pathfirewall"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/writeback"
 	_ "github.com/docker/distribution/registry/storage/driver/oss"
 	_ "github.com/docker/distribution/registry/storage/driver/s3"
 	_ "github.com/docker/distribution/registry/storage/driver/swift"
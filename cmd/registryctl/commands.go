@@ -0,0 +1,973 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/client"
+	"github.com/spf13/cobra"
+)
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "manage repositories",
+}
+
+var repoListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "list the repositories of the registry",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		entries := make([]string, 100)
+		last := ""
+		for {
+			n, err := admin.Repositories(ctx, entries, last)
+			if err != nil && err != io.EOF {
+				fatalf("error listing repositories: %v", err)
+			}
+
+			for _, name := range entries[:n] {
+				fmt.Println(name)
+			}
+
+			if err == io.EOF || n == 0 {
+				return
+			}
+			last = entries[n-1]
+		}
+	},
+}
+
+var (
+	repoAt     string
+	repoFrom   string
+	repoOutput string
+	repoDryRun bool
+)
+
+var repoSnapshotCmd = &cobra.Command{
+	Use:   "snapshot <repository>",
+	Short: "print the tags of a repository at a point in time",
+	Long: `Print the tags of a repository as they were at the time given by --at, in
+RFC 3339 format or as a duration before now, such as "1h", as JSON. The tags
+are reconstructed from the metadata journal, which must be enabled. Tags
+changed since without an earlier journal entry, either created since or last
+changed before the journal was enabled, are listed as unknown.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			fatalf("a repository is required")
+		}
+
+		named, err := reference.ParseNamed(args[0])
+		if err != nil {
+			fatalf("invalid repository name %q: %v", args[0], err)
+		}
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		snapshot, err := admin.Snapshot(ctx, named, parseTime("at", repoAt))
+		if err != nil {
+			fatalf("error taking snapshot of %s: %v", named.Name(), err)
+		}
+
+		out := os.Stdout
+		if repoOutput != "" {
+			out, err = os.Create(repoOutput)
+			if err != nil {
+				fatalf("error creating %s: %v", repoOutput, err)
+			}
+			defer out.Close()
+		}
+
+		encoder := json.NewEncoder(out)
+		if err := encoder.Encode(snapshot); err != nil {
+			fatalf("error writing snapshot: %v", err)
+		}
+	},
+}
+
+var repoRestoreCmd = &cobra.Command{
+	Use:   "restore <repository>",
+	Short: "restore the tags of a repository to a snapshot",
+	Long: `Point the tags of a repository back at the manifests they referenced at the
+time given by --at, or in the snapshot written to the file given by --from,
+and remove the tags which did not exist then. Tags whose earlier state is
+unknown are left unchanged. With --dry-run, only report the tags which would change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			fatalf("a repository is required")
+		}
+		if (repoAt == "") == (repoFrom == "") {
+			cmd.Usage()
+			fatalf("exactly one of --at and --from is required")
+		}
+
+		named, err := reference.ParseNamed(args[0])
+		if err != nil {
+			fatalf("invalid repository name %q: %v", args[0], err)
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		var snapshot admin.RepositorySnapshot
+		if repoFrom != "" {
+			f, err := os.Open(repoFrom)
+			if err != nil {
+				fatalf("error opening snapshot: %v", err)
+			}
+			err = json.NewDecoder(f).Decode(&snapshot)
+			f.Close()
+			if err != nil {
+				fatalf("error reading snapshot %s: %v", repoFrom, err)
+			}
+		} else {
+			snapshot, err = ac.Snapshot(ctx, named, parseTime("at", repoAt))
+			if err != nil {
+				fatalf("error taking snapshot of %s: %v", named.Name(), err)
+			}
+		}
+
+		result, err := ac.Restore(ctx, named, snapshot, repoDryRun)
+		if err != nil {
+			fatalf("error restoring %s: %v", named.Name(), err)
+		}
+
+		for _, tag := range result.Tagged {
+			fmt.Printf("tagged %s:%s\n", named.Name(), tag)
+		}
+		for _, tag := range result.Untagged {
+			fmt.Printf("removed %s:%s\n", named.Name(), tag)
+		}
+		for _, tag := range result.Missing {
+			fmt.Printf("skipped %s:%s, manifest %s is missing\n", named.Name(), tag, snapshot.Tags[tag])
+		}
+		for _, tag := range snapshot.Unknown {
+			fmt.Printf("skipped %s:%s, earlier state unknown\n", named.Name(), tag)
+		}
+		if result.DryRun {
+			fmt.Println("dry run, no tags changed")
+		}
+	},
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "manage tags",
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:     "rm <repository> <tag>...",
+	Aliases: []string{"remove"},
+	Short:   "remove tags from a repository",
+	Long: `Remove tags from a repository. The tagged manifests remain available by
+digest until they are deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			cmd.Usage()
+			fatalf("a repository and at least one tag are required")
+		}
+
+		named, err := reference.ParseNamed(args[0])
+		if err != nil {
+			fatalf("invalid repository name %q: %v", args[0], err)
+		}
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		for _, tag := range args[1:] {
+			if err := admin.Untag(ctx, named, tag); err != nil {
+				fatalf("error removing tag %s:%s: %v", named.Name(), tag, err)
+			}
+			fmt.Printf("removed %s:%s\n", named.Name(), tag)
+		}
+	},
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "garbage collect unreferenced blobs",
+}
+
+var (
+	gcDryRun          bool
+	gcInventory       string
+	gcInventoryFormat string
+	gcWorkers         int
+	gcRateLimit       float64
+	gcResume          bool
+	gcDetach          bool
+)
+
+var gcRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "run the garbage collector",
+	Long: `Run the garbage collector, deleting blobs which are not referenced by any
+manifest. Unless --dry-run is set, the registry must be in read-only mode, see
+"registryctl readonly on".
+
+With --inventory, the blobs to delete are taken from a bucket inventory
+generated by the storage provider instead of listing the blob store, which is
+much faster for large registries. The inventory is uploaded to the registry.
+Its format is derived from the file name unless --inventory-format is set: csv
+for S3 inventory reports, json for KODO bucket listings with one JSON object
+per line. Both may be gzip compressed.
+
+The collector marks repositories and deletes blobs with the number of workers
+set by --workers, at most --rate-limit per second if set. Its progress is
+logged by the registry. If a run is interrupted, --resume continues from the
+last checkpoint of its mark phase, unless the marked repositories changed since.
+
+With --detach, the run is started as a job in the registry and its id is
+printed, see "registryctl job".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if gcWorkers < 1 {
+			fatalf("invalid number of workers %d", gcWorkers)
+		}
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		opts := client.GCOptions{
+			DryRun:    gcDryRun,
+			Workers:   gcWorkers,
+			RateLimit: gcRateLimit,
+			Resume:    gcResume,
+		}
+		if gcInventory != "" {
+			f, err := os.Open(gcInventory)
+			if err != nil {
+				fatalf("error opening inventory: %v", err)
+			}
+			defer f.Close()
+
+			opts.Inventory = f
+			opts.InventoryType = inventoryType(gcInventory, gcInventoryFormat)
+		}
+
+		if gcDetach {
+			job, err := admin.StartGarbageCollect(ctx, opts)
+			if err != nil {
+				fatalf("error starting garbage collection: %v", err)
+			}
+			fmt.Printf("started gc job %s\n", job.ID)
+			return
+		}
+
+		result, err := admin.GarbageCollect(ctx, opts)
+		if err != nil {
+			fatalf("error running garbage collection: %v", err)
+		}
+
+		for _, dgst := range result.Deleted {
+			fmt.Println(dgst)
+		}
+
+		verb := "deleted"
+		if result.DryRun {
+			verb = "would delete"
+		}
+		fmt.Printf("%d blobs marked, %s %d blobs\n", result.Marked, verb, len(result.Deleted))
+	},
+}
+
+// inventoryType returns the media type of the inventory file, in the given
+// format or derived from its name.
+func inventoryType(name, format string) string {
+	if format == "" {
+		name = strings.TrimSuffix(name, ".gz")
+		switch {
+		case strings.HasSuffix(name, ".csv"):
+			format = "csv"
+		case strings.HasSuffix(name, ".json"), strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".ndjson"):
+			format = "json"
+		default:
+			fatalf("cannot derive the format of inventory %s, set --inventory-format", name)
+		}
+	}
+
+	switch format {
+	case "csv":
+		return admin.MediaTypeInventoryCSV
+	case "json":
+		return admin.MediaTypeInventoryJSON
+	}
+
+	fatalf("unknown inventory format %q", format)
+	return ""
+}
+
+var gcPinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "manage the pins protecting content from garbage collection",
+	Long: `Manage the pins which the garbage collector honors. A digest pin keeps a
+blob and, if it is a manifest, the blobs and manifests it references, even once
+no repository links it. A repository pin keeps every blob linked by the
+repositories matching its pattern, in which * matches any sequence of
+characters. Pins of the registry configuration are listed but cannot be
+removed.`,
+}
+
+var gcPinListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "list the pins",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		pins, err := ac.Pins(ctx)
+		if err != nil {
+			fatalf("error listing pins: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "PIN\tCREATED\tCOMMENT")
+		for _, pin := range pins {
+			created := "configured"
+			if !pin.Configured {
+				created = pin.Created.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s%s\t%s\t%s\n", pin.Digest, pin.Repository, created, pin.Comment)
+		}
+		w.Flush()
+	},
+}
+
+var gcPinComment string
+
+var gcPinAddCmd = &cobra.Command{
+	Use:   "add <digest|repository>...",
+	Short: "pin digests or repository patterns",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			fatalf("at least one digest or repository is required")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		for _, arg := range args {
+			pin := parsePin(arg)
+			pin.Comment = gcPinComment
+			if _, err := ac.AddPin(ctx, pin); err != nil {
+				fatalf("error pinning %s: %v", arg, err)
+			}
+		}
+	},
+}
+
+var gcPinRemoveCmd = &cobra.Command{
+	Use:     "rm <digest|repository>...",
+	Aliases: []string{"remove"},
+	Short:   "remove pins",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			fatalf("at least one digest or repository is required")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		for _, arg := range args {
+			if err := ac.RemovePin(ctx, parsePin(arg)); err != nil {
+				fatalf("error removing pin of %s: %v", arg, err)
+			}
+		}
+	},
+}
+
+// parsePin returns the pin of a digest or, if the argument does not parse as
+// one, of a repository pattern.
+func parsePin(arg string) admin.Pin {
+	if dgst, err := digest.ParseDigest(arg); err == nil {
+		return admin.Pin{Digest: dgst}
+	}
+	return admin.Pin{Repository: arg}
+}
+
+var readOnlyCmd = &cobra.Command{
+	Use:   "readonly [on|off]",
+	Short: "show or set read-only mode",
+	Long: `Show or set read-only mode, in which the registry rejects pushes and
+deletes. The setting is not persisted and reverts to the configured value when
+the registry restarts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		if len(args) > 0 {
+			var enabled bool
+			switch args[0] {
+			case "on":
+				enabled = true
+			case "off":
+				enabled = false
+			default:
+				cmd.Usage()
+				fatalf("unknown argument %q, expected on or off", args[0])
+			}
+
+			if err := admin.SetReadOnly(ctx, enabled); err != nil {
+				fatalf("error setting read-only mode: %v", err)
+			}
+		}
+
+		enabled, err := admin.ReadOnly(ctx)
+		if err != nil {
+			fatalf("error getting read-only mode: %v", err)
+		}
+
+		if enabled {
+			fmt.Println("read-only mode: on")
+		} else {
+			fmt.Println("read-only mode: off")
+		}
+	},
+}
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "manage notification events",
+}
+
+var eventsSince string
+
+var eventsReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "replay retained events to the notification endpoints",
+	Long: `Replay the events retained by the registry to the notification endpoints.
+--since limits the events to those newer than a time, given in RFC 3339 format
+or as a duration before now, such as "1h".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since := parseSince(eventsSince)
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		replayed, err := admin.ReplayEvents(ctx, since)
+		if err != nil {
+			fatalf("error replaying events: %v", err)
+		}
+		fmt.Printf("replayed %d events\n", replayed)
+	},
+}
+
+var eventsWatchCmd = &cobra.Command{
+	Use:   "watch [repository...]",
+	Short: "print notification events as they happen",
+	Long: `Print the notification events of the given repositories, or of all
+repositories, as JSON, one per line, as they are sent to the notification
+endpoints, until interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+		encoder := json.NewEncoder(os.Stdout)
+
+		err := admin.WatchEvents(ctx, args, func(event notifications.Event) error {
+			return encoder.Encode(event)
+		})
+		if err != nil {
+			fatalf("error watching events: %v", err)
+		}
+	},
+}
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout",
+	Short: "manage the blob store layout",
+}
+
+var (
+	layoutVersion int
+	layoutDryRun  bool
+	layoutDetach  bool
+)
+
+var layoutMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "move blobs to a blob store layout",
+	Long: `Move the blobs of the blob store to the layout version set by --version,
+or the version configured in the registry. Registries serving during the
+migration must be configured to read the layouts being migrated from, see
+storage.layout.compatible. With --detach, the migration is started as a job
+in the registry and its id is printed, see "registryctl job".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		if layoutDetach {
+			job, err := admin.StartMigrateLayout(ctx, layoutVersion, layoutDryRun)
+			if err != nil {
+				fatalf("error starting layout migration: %v", err)
+			}
+			fmt.Printf("started layout migration job %s\n", job.ID)
+			return
+		}
+
+		result, err := admin.MigrateLayout(ctx, layoutVersion, layoutDryRun)
+		if err != nil {
+			fatalf("error migrating layout: %v", err)
+		}
+
+		verb := "moved"
+		if result.DryRun {
+			verb = "would move"
+		}
+		fmt.Printf("layout version %d: %s %d blobs, %d already migrated\n", result.Version, verb, result.Migrated, result.Skipped)
+	},
+}
+
+// parseSince parses the value of a --since flag, a time in RFC 3339 format or
+// a duration before now. The zero time is returned for an empty value.
+func parseSince(value string) time.Time {
+	return parseTime("since", value)
+}
+
+// parseTime parses the value of the named time flag, like parseSince.
+func parseTime(flag, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d)
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		fatalf("invalid --%s value %q: %v", flag, value, err)
+	}
+	return t
+}
+
+var journalCmd = &cobra.Command{
+	Use:   "journal",
+	Short: "read and recover from the metadata journal",
+}
+
+var (
+	journalSince  string
+	journalFollow bool
+)
+
+var journalTailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "print the entries of the metadata journal",
+	Long: `Print the entries of the metadata journal as JSON, one per line. --since
+limits the entries to those newer than a time, given in RFC 3339 format or as
+a duration before now, such as "1h". With --follow, new entries are printed as
+they are written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since := parseSince(journalSince)
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+		encoder := json.NewEncoder(os.Stdout)
+
+		var last string
+		for {
+			entries, err := admin.Journal(ctx, since, last, 100)
+			if err != nil {
+				fatalf("error reading journal: %v", err)
+			}
+
+			for _, entry := range entries {
+				encoder.Encode(entry)
+				since, last = entry.Time, entry.ID
+			}
+
+			if len(entries) == 0 {
+				if !journalFollow {
+					return
+				}
+				time.Sleep(time.Second)
+			}
+		}
+	},
+}
+
+var journalRecoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "apply the journaled mutations missing from the storage backend",
+	Long: `Apply the mutations recorded in the metadata journal since the time given by
+--since which are missing from the storage backend, such as those lost when the
+backend was restored from a backup. Only the last entry for each path is
+applied.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since := parseSince(journalSince)
+
+		ctx := context.Background()
+		admin := newAdmin(ctx)
+
+		applied, err := admin.RecoverJournal(ctx, since)
+		if err != nil {
+			fatalf("error recovering from journal: %v", err)
+		}
+		fmt.Printf("applied %d journal entries\n", applied)
+	},
+}
+
+var prewarmWait bool
+
+var prewarmCmd = &cobra.Command{
+	Use:   "prewarm <repository> <reference>...",
+	Short: "fetch manifests and their blobs into a pull through cache",
+	Long: `Fetch the manifests with the given tags or digests, the manifests they list and
+their blobs from the remote of a pull through cache, ahead of clients pulling
+them. The job runs in the registry, printing its id. With --wait, the progress
+is printed until the job ends, and the command fails if the job did.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			cmd.Usage()
+			fatalf("a repository and at least one reference are required")
+		}
+
+		named, err := reference.ParseNamed(args[0])
+		if err != nil {
+			fatalf("invalid repository name %q: %v", args[0], err)
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		status, err := ac.Prewarm(ctx, named, args[1:])
+		if err != nil {
+			fatalf("error prewarming %s: %v", named.Name(), err)
+		}
+		fmt.Printf("started prewarm job %s\n", status.ID)
+		if !prewarmWait {
+			return
+		}
+
+		for status.Finished == nil {
+			time.Sleep(time.Second)
+			status, err = ac.PrewarmStatus(ctx, status.ID)
+			if err != nil {
+				fatalf("error polling prewarm job: %v", err)
+			}
+			fmt.Printf("%d of %d blobs cached, %d fetched (%d bytes)\n", status.Completed, status.Blobs, status.Fetched, status.Bytes)
+		}
+
+		for _, e := range status.Errors {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		if status.State != admin.PrewarmStateCompleted {
+			fatalf("prewarm job %s %s", status.ID, status.State)
+		}
+	},
+}
+
+var (
+	usageCompute   bool
+	usageWorkers   int
+	usageRateLimit float64
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "print the storage consumed by each repository",
+	Long: `Print the storage consumed by the blobs each repository references, from the
+last report computed by the usagereport maintenance job. The unique bytes of a
+repository are those of the blobs no other repository references, which
+deleting it would reclaim. With --compute, a new report is computed first,
+reading every manifest of the registry with the number of workers set by
+--workers, at most --rate-limit per second if set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		var (
+			report admin.UsageReport
+			err    error
+		)
+		if usageCompute {
+			report, err = ac.ComputeUsage(ctx, client.UsageOptions{
+				Workers:   usageWorkers,
+				RateLimit: usageRateLimit,
+			})
+		} else {
+			report, err = ac.Usage(ctx)
+		}
+		if err != nil {
+			fatalf("error getting storage usage: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tBLOBS\tBYTES\tUNIQUE\tSHARED")
+		for _, usage := range report.Repositories {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", usage.Name, usage.Blobs, usage.Bytes, usage.UniqueBytes, usage.SharedBytes)
+		}
+		w.Flush()
+
+		fmt.Printf("%d blobs, %d bytes, %d bytes shared between repositories, computed %s\n", report.Blobs, report.Bytes, report.SharedBytes, report.Computed.Format(time.RFC3339))
+	},
+}
+
+var leaderCmd = &cobra.Command{
+	Use:   "leader",
+	Short: "print which registry instance runs the maintenance jobs",
+	Long: `Print the identity of the registry instance serving the request, the
+maintenance jobs it enables and, if leader election is enabled, the instance
+elected to run them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		leadership, err := ac.Leader(ctx)
+		if err != nil {
+			fatalf("error getting leader: %v", err)
+		}
+
+		fmt.Printf("instance: %s\n", leadership.Instance)
+		switch {
+		case leadership.Election == "":
+			fmt.Println("leader: election disabled, every instance runs its maintenance jobs")
+		case leadership.Leader == "":
+			fmt.Printf("leader: none, %s lease not held\n", leadership.Election)
+		default:
+			fmt.Printf("leader: %s, %s lease expires %s\n", leadership.Leader, leadership.Election, leadership.Expires.Format(time.RFC3339))
+		}
+
+		jobs := strings.Join(leadership.Jobs, ", ")
+		if jobs == "" {
+			jobs = "none"
+		}
+		if leadership.Leading {
+			fmt.Printf("running: %s\n", jobs)
+		} else {
+			fmt.Printf("waiting: %s\n", jobs)
+		}
+	},
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "manage the users of the registry",
+	Long: `Manage the users authenticated by the registry, which requires an access
+controller supporting it, such as htpasswd with a writable file.`,
+}
+
+var userListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "list the users of the registry",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		users, err := ac.Users(ctx)
+		if err != nil {
+			fatalf("error listing users: %v", err)
+		}
+		for _, user := range users {
+			fmt.Println(user)
+		}
+	},
+}
+
+var userSetCmd = &cobra.Command{
+	Use:   "set <username>",
+	Short: "create a user or change its password",
+	Long: `Create a user, or change the password of an existing one, to the password
+read from the first line of stdin, so that it does not appear in the command
+line.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			fatalf("a username is required")
+		}
+
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fatalf("error reading password: %v", err)
+		}
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			fatalf("a password is required on stdin")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		if err := ac.SetPassword(ctx, args[0], password); err != nil {
+			fatalf("error setting password of %s: %v", args[0], err)
+		}
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:     "rm <username>...",
+	Aliases: []string{"remove"},
+	Short:   "remove users",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			fatalf("at least one username is required")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		for _, username := range args {
+			if err := ac.RemoveUser(ctx, username); err != nil {
+				fatalf("error removing user %s: %v", username, err)
+			}
+		}
+	},
+}
+
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "manage the jobs running in the registry",
+	Long: `Manage the long-running operations which the registry runs in the
+background, such as garbage collection runs started with --detach and
+repository deletions. Each registry instance only knows the jobs it runs, and
+retains the last 100.`,
+}
+
+var jobListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "list the jobs of the registry",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		jobs, err := ac.Jobs(ctx)
+		if err != nil {
+			fatalf("error listing jobs: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tTARGET\tSTATE\tSTARTED")
+		for _, job := range jobs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.Type, job.Target, job.State, job.Started.Format(time.RFC3339))
+		}
+		w.Flush()
+	},
+}
+
+var jobWait bool
+
+var jobStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "print the status of a job",
+	Long: `Print the status of a job as JSON, including its progress and, once it
+completed, its result. With --wait, the status is printed once the job ends,
+and the command fails if the job did not complete.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			fatalf("a job id is required")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		job, err := ac.Job(ctx, args[0])
+		for err == nil && jobWait && job.Finished == nil {
+			time.Sleep(time.Second)
+			job, err = ac.Job(ctx, args[0])
+		}
+		if err != nil {
+			fatalf("error getting job %s: %v", args[0], err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(job); err != nil {
+			fatalf("error writing job status: %v", err)
+		}
+		if jobWait && job.State != admin.JobStateCompleted {
+			fatalf("job %s %s", job.ID, job.State)
+		}
+	},
+}
+
+var jobCancelCmd = &cobra.Command{
+	Use:   "cancel <id>...",
+	Short: "cancel running jobs",
+	Long: `Ask running jobs to stop. Jobs stop at their next step, leaving the work
+done so far, so a canceled repository deletion leaves the repository
+partially deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			fatalf("at least one job id is required")
+		}
+
+		ctx := context.Background()
+		ac := newAdmin(ctx)
+
+		for _, id := range args {
+			if _, err := ac.CancelJob(ctx, id); err != nil {
+				fatalf("error canceling job %s: %v", id, err)
+			}
+			fmt.Printf("canceled job %s\n", id)
+		}
+	},
+}
+
+func init() {
+	repoSnapshotCmd.Flags().StringVar(&repoAt, "at", "", "time or duration before now to take the snapshot at")
+	repoSnapshotCmd.Flags().StringVarP(&repoOutput, "output", "o", "", "file to write the snapshot to, instead of stdout")
+	repoRestoreCmd.Flags().StringVar(&repoAt, "at", "", "time or duration before now to restore to")
+	repoRestoreCmd.Flags().StringVar(&repoFrom, "from", "", "file containing a snapshot to restore to")
+	repoRestoreCmd.Flags().BoolVar(&repoDryRun, "dry-run", false, "only report the tags which would change")
+	repoCmd.AddCommand(repoListCmd, repoSnapshotCmd, repoRestoreCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+
+	gcRunCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "only report the blobs which would be deleted")
+	gcRunCmd.Flags().StringVar(&gcInventory, "inventory", "", "bucket inventory listing the blobs to sweep")
+	gcRunCmd.Flags().StringVar(&gcInventoryFormat, "inventory-format", "", "format of the inventory, csv or json")
+	gcRunCmd.Flags().IntVar(&gcWorkers, "workers", 1, "number of repositories marked or blobs deleted concurrently")
+	gcRunCmd.Flags().Float64Var(&gcRateLimit, "rate-limit", 0, "maximum number of repositories marked or blobs deleted per second")
+	gcRunCmd.Flags().BoolVar(&gcResume, "resume", false, "resume an interrupted run from its checkpoint")
+	gcRunCmd.Flags().BoolVar(&gcDetach, "detach", false, "start the run as a job and print its id")
+	gcPinAddCmd.Flags().StringVar(&gcPinComment, "comment", "", "reason for the pins, such as a compliance requirement")
+	gcPinCmd.AddCommand(gcPinListCmd, gcPinAddCmd, gcPinRemoveCmd)
+	gcCmd.AddCommand(gcRunCmd, gcPinCmd)
+
+	eventsReplayCmd.Flags().StringVar(&eventsSince, "since", "", "replay events newer than this time or duration")
+	eventsCmd.AddCommand(eventsReplayCmd, eventsWatchCmd)
+
+	layoutMigrateCmd.Flags().IntVar(&layoutVersion, "version", 0, "layout version to migrate to, the configured one if unset")
+	layoutMigrateCmd.Flags().BoolVar(&layoutDryRun, "dry-run", false, "only count the blobs which would be moved")
+	layoutMigrateCmd.Flags().BoolVar(&layoutDetach, "detach", false, "start the migration as a job and print its id")
+	layoutCmd.AddCommand(layoutMigrateCmd)
+
+	journalTailCmd.Flags().StringVar(&journalSince, "since", "", "print entries newer than this time or duration")
+	journalTailCmd.Flags().BoolVarP(&journalFollow, "follow", "f", false, "keep printing entries as they are written")
+	journalRecoverCmd.Flags().StringVar(&journalSince, "since", "", "apply entries newer than this time or duration")
+	journalCmd.AddCommand(journalTailCmd, journalRecoverCmd)
+
+	prewarmCmd.Flags().BoolVar(&prewarmWait, "wait", false, "print the progress of the job until it ends")
+
+	usageCmd.Flags().BoolVar(&usageCompute, "compute", false, "compute a new report instead of printing the last one")
+	usageCmd.Flags().IntVar(&usageWorkers, "workers", 1, "number of repositories read or blobs sized concurrently")
+	usageCmd.Flags().Float64Var(&usageRateLimit, "rate-limit", 0, "maximum number of repositories read or blobs sized per second")
+
+	userCmd.AddCommand(userListCmd, userSetCmd, userRemoveCmd)
+
+	jobStatusCmd.Flags().BoolVar(&jobWait, "wait", false, "wait until the job ends")
+	jobCmd.AddCommand(jobListCmd, jobStatusCmd, jobCancelCmd)
+}
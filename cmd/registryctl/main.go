@@ -0,0 +1,105 @@
+// registryctl is a command line tool for operating a registry through its
+// admin API.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/distribution/version"
+	"github.com/spf13/cobra"
+)
+
+var (
+	registryURL string
+	username    string
+	password    string
+	showVersion bool
+)
+
+// rootCmd is the root command of registryctl.
+var rootCmd = &cobra.Command{
+	Use:   "registryctl",
+	Short: "registryctl operates a registry through its admin API",
+	Long: `registryctl operates a registry through its admin API, which must be
+enabled with the http.admin.enabled configuration option. Requests are
+authorized with the "registry:admin:*" scope.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if showVersion {
+			version.PrintVersion()
+			return
+		}
+		cmd.Usage()
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&registryURL, "url", "u", envOrDefault("REGISTRYCTL_URL", "http://localhost:5000"), "base url of the registry")
+	rootCmd.PersistentFlags().StringVar(&username, "username", os.Getenv("REGISTRYCTL_USERNAME"), "username for authenticating with the registry")
+	rootCmd.PersistentFlags().StringVar(&password, "password", os.Getenv("REGISTRYCTL_PASSWORD"), "password for authenticating with the registry")
+	rootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
+
+	rootCmd.AddCommand(repoCmd, tagCmd, gcCmd, readOnlyCmd, eventsCmd, layoutCmd, journalCmd, prewarmCmd, usageCmd, leaderCmd, userCmd, jobCmd)
+}
+
+func main() {
+	rootCmd.Execute()
+}
+
+// newAdmin returns an admin client for the configured registry. The
+// registry's base endpoint is pinged first to learn which authentication
+// schemes it requires.
+func newAdmin(ctx context.Context) client.Admin {
+	baseURL := strings.TrimSuffix(registryURL, "/")
+
+	resp, err := http.Get(baseURL + "/v2/")
+	if err != nil {
+		fatalf("error contacting registry: %v", err)
+	}
+	resp.Body.Close()
+
+	challengeManager := auth.NewSimpleChallengeManager()
+	if err := challengeManager.AddResponse(resp); err != nil {
+		fatalf("error reading authentication challenges: %v", err)
+	}
+
+	creds := credentials{username: username, password: password}
+	tr := transport.NewTransport(http.DefaultTransport, auth.NewAuthorizer(challengeManager,
+		auth.NewRegistryTokenHandler(http.DefaultTransport, creds, "admin", "*"),
+		auth.NewBasicHandler(creds)))
+
+	admin, err := client.NewAdmin(ctx, baseURL+"/", tr)
+	if err != nil {
+		fatalf("error creating admin client: %v", err)
+	}
+
+	return admin
+}
+
+// credentials is a static auth.CredentialStore.
+type credentials struct {
+	username, password string
+}
+
+func (c credentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+func envOrDefault(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "registryctl: "+format+"\n", args...)
+	os.Exit(1)
+}
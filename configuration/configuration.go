@@ -45,6 +45,21 @@ type Configuration struct {
 	// Storage is the configuration for the registry's storage driver
 	Storage Storage `yaml:"storage"`
 
+	// Namespaces maps top-level namespaces to storage drivers distinct from
+	// the registry's storage, such as other buckets or root directories.
+	// Repositories of other namespaces are stored with the registry's
+	// storage.
+	Namespaces []NamespaceStorage `yaml:"namespaces,omitempty"`
+
+	// Residency pins repositories to the regions of the storage they may
+	// be stored with.
+	Residency Residency `yaml:"residency,omitempty"`
+
+	// Federation configures sibling registries, sharing a logical namespace
+	// with this registry, which are queried for the manifests and blobs not
+	// found locally.
+	Federation Federation `yaml:"federation,omitempty"`
+
 	// Auth allows configuration of various authorization methods that may be
 	// used to gate requests.
 	Auth Auth `yaml:"auth,omitempty"`
@@ -68,6 +83,26 @@ type Configuration struct {
 		// qualified URL.
 		Host string `yaml:"host,omitempty"`
 
+		// Hosts lists the hostnames the registry is also reachable by, such
+		// as on an internal network, each with the address URLs are built
+		// with for requests to them in place of Host.
+		Hosts []HTTPHost `yaml:"hosts,omitempty"`
+
+		// RelativeURLs makes the Location headers of responses relative,
+		// without scheme and host, so that clients behind proxies which do
+		// not report the address requested resolve them against the
+		// address they sent the request to.
+		RelativeURLs bool `yaml:"relativeurls,omitempty"`
+
+		// TrustedProxies lists the addresses, or CIDR ranges, of the
+		// proxies whose Forwarded, X-Forwarded-* and X-Real-Ip headers are
+		// trusted. The headers of requests from other peers are ignored.
+		// If empty, the headers of every request are trusted.
+		TrustedProxies []string `yaml:"trustedproxies,omitempty"`
+
+		// Errors customizes the error responses of the API.
+		Errors ErrorResponses `yaml:"errors,omitempty"`
+
 		Prefix string `yaml:"prefix,omitempty"`
 
 		// Secret specifies the secret key which HMAC tokens are created with.
@@ -106,6 +141,218 @@ type Configuration struct {
 			// Addr specifies the bind address for the debug server.
 			Addr string `yaml:"addr,omitempty"`
 		} `yaml:"debug,omitempty"`
+
+		// Admin configures the administrative API used by registryctl. It
+		// is served under /admin/v1/ and requires the "registry:admin:*"
+		// access scope. Left disabled by default.
+		Admin struct {
+			// Enabled exposes the admin API.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// Insecure allows the admin API to be served without an
+			// access controller, to anyone reaching the registry.
+			// Otherwise the registry refuses to start with the admin
+			// API enabled but no auth configured.
+			Insecure bool `yaml:"insecure,omitempty"`
+
+			// GRPC configures the gRPC admin service, serving garbage
+			// collection, the read-only mode, repository deletion and
+			// usage statistics on a separate address. Clients must
+			// present a certificate signed by one of the client CAs.
+			// Left disabled by default.
+			GRPC struct {
+				// Addr specifies the bind address for the gRPC admin
+				// service.
+				Addr string `yaml:"addr,omitempty"`
+
+				// TLS configures the certificate of the service and
+				// the CA certs clients are authenticated with, which
+				// are all required.
+				TLS struct {
+					Certificate string   `yaml:"certificate,omitempty"`
+					Key         string   `yaml:"key,omitempty"`
+					ClientCAs   []string `yaml:"clientcas,omitempty"`
+				} `yaml:"tls,omitempty"`
+			} `yaml:"grpc,omitempty"`
+		} `yaml:"admin,omitempty"`
+
+		// UI configures the built-in web interface for browsing
+		// repositories, served under /ui/. Left disabled by default.
+		UI struct {
+			// Enabled exposes the web interface.
+			Enabled bool `yaml:"enabled,omitempty"`
+		} `yaml:"ui,omitempty"`
+
+		// TagSnapshots configures the endpoint serving signed snapshots of
+		// the tags of a repository and the digests they point to. Left
+		// disabled by default.
+		TagSnapshots struct {
+			// Enabled exposes the tag snapshot endpoint.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// SigningKeyFile is the path of the libtrust private key used
+			// to sign snapshots. An ephemeral key is generated if unset.
+			SigningKeyFile string `yaml:"signingkeyfile,omitempty"`
+		} `yaml:"tagsnapshots,omitempty"`
+
+		// Trust configures the endpoints storing the TUF trust metadata of
+		// repositories alongside their content. Left disabled by default.
+		Trust struct {
+			// Enabled exposes the trust metadata endpoints.
+			Enabled bool `yaml:"enabled,omitempty"`
+		} `yaml:"trust,omitempty"`
+
+		// BuildGroups configures the assembly of manifest lists from the
+		// image manifests of each platform pushed with a build group
+		// annotation. Left disabled by default.
+		BuildGroups struct {
+			// Enabled assembles manifest lists from annotated manifests.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// Annotation is the manifest annotation naming the build
+			// group, "build-group" if unset.
+			Annotation string `yaml:"annotation,omitempty"`
+		} `yaml:"buildgroups,omitempty"`
+
+		// SBOM configures the generation of software bills of materials of
+		// the images pushed to the registry by an external service. Left
+		// disabled unless a url is set.
+		SBOM struct {
+			// URL is the endpoint of the generator service, to which
+			// the images pushed are posted.
+			URL string `yaml:"url,omitempty"`
+
+			// Headers are added to the requests to the generator.
+			Headers http.Header `yaml:"headers,omitempty"`
+
+			// Timeout bounds the generation of an SBOM, 5 minutes if
+			// unset.
+			Timeout time.Duration `yaml:"timeout,omitempty"`
+		} `yaml:"sbom,omitempty"`
+
+		// Shadow configures the mirroring of a sample of the read requests
+		// to a second registry deployment, such as one running another
+		// version or storing its content in another backend, whose
+		// responses are compared with those of this registry. Left
+		// disabled unless a url is set.
+		Shadow struct {
+			// URL is the address of the shadow deployment, which the
+			// requests are sent to with their path and query.
+			URL string `yaml:"url,omitempty"`
+
+			// Percentage is the percentage of the read requests which
+			// are mirrored, from 0 to 100.
+			Percentage float64 `yaml:"percentage,omitempty"`
+
+			// Headers are added to the mirrored requests.
+			Headers http.Header `yaml:"headers,omitempty"`
+
+			// Timeout bounds a mirrored request, 10 seconds if unset.
+			Timeout time.Duration `yaml:"timeout,omitempty"`
+		} `yaml:"shadow,omitempty"`
+
+		// Timeouts bounds the time requests may take, by group of routes.
+		// The deadline applies to reading the request body and is
+		// propagated to storage driver calls through the request context.
+		// Requests are not bounded if unset.
+		Timeouts struct {
+			// ReadHeader bounds the time the server waits for the headers
+			// of a request.
+			ReadHeader time.Duration `yaml:"readheader,omitempty"`
+
+			// Default applies to routes without a timeout of their own.
+			Default time.Duration `yaml:"default,omitempty"`
+
+			// Uploads applies to blob upload routes.
+			Uploads time.Duration `yaml:"uploads,omitempty"`
+
+			// Blobs applies to fetching and deleting blobs, and to
+			// blob deltas.
+			Blobs time.Duration `yaml:"blobs,omitempty"`
+
+			// Manifests applies to manifest routes.
+			Manifests time.Duration `yaml:"manifests,omitempty"`
+
+			// Tags applies to listing tags and tag snapshots.
+			Tags time.Duration `yaml:"tags,omitempty"`
+		} `yaml:"timeouts,omitempty"`
+
+		// UploadSessionTTL is the time after which an upload session, from
+		// its start, expires. Further requests to an expired session fail
+		// and its staged data is removed. Sessions never expire if unset.
+		UploadSessionTTL time.Duration `yaml:"uploadsessionttl,omitempty"`
+
+		// ManifestLimits caps the size of the manifests which may be
+		// pushed, by media type.
+		ManifestLimits struct {
+			// Default is the limit of the manifests of media types
+			// without a limit of their own, 4MB if unset.
+			Default int64 `yaml:"default,omitempty"`
+
+			// MediaTypes maps media types to the limit of their
+			// manifests, such as a larger one for manifest lists of many
+			// platforms.
+			MediaTypes map[string]int64 `yaml:"mediatypes,omitempty"`
+		} `yaml:"manifestlimits,omitempty"`
+
+		// UploadDeduplication configures the mounting of a blob already
+		// stored in another repository when a monolithic upload of its
+		// digest starts. Left disabled by default.
+		UploadDeduplication struct {
+			// Enabled mounts blobs from a repository the client may pull
+			// from instead of receiving their content.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// MaxRepositories is the number of repositories searched for
+			// the blob. Defaults to 1000.
+			MaxRepositories int `yaml:"maxrepositories,omitempty"`
+		} `yaml:"uploaddeduplication,omitempty"`
+
+		// Deltas configures the endpoint serving binary deltas between the
+		// blobs of a repository, computed on the first request and kept
+		// alongside the repository. Left disabled by default.
+		Deltas struct {
+			// Enabled exposes the blob delta endpoint.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// MaxSize is the size of the largest blob deltas are
+			// computed from or to, 1GB if unset.
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"deltas,omitempty"`
+
+		// LayerIndex configures the endpoint listing the files of the
+		// layers of a repository, indexed once and kept alongside the
+		// repository. Left disabled by default.
+		LayerIndex struct {
+			// Enabled exposes the blob files endpoint, indexing layers on
+			// their first request.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// OnPush indexes layers in the background once pushed, so
+			// that their files are listed without delay.
+			OnPush bool `yaml:"onpush,omitempty"`
+
+			// MaxSize is the size of the largest layer indexed, 1GB if
+			// unset.
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"layerindex,omitempty"`
+
+		// Imports configures the endpoint importing the images of docker
+		// save archives and OCI image layouts uploaded to a repository.
+		// Left disabled by default.
+		Imports struct {
+			// Enabled exposes the repository import endpoint.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// MaxSize is the size of the largest archive imported, 10GB
+			// if unset.
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"imports,omitempty"`
+
+		// RouteGroups configures the responses of groups of routes, keyed
+		// by group: "v2" for the registry API, "admin" for the admin API
+		// and "ui" for the web interface.
+		RouteGroups map[string]RouteGroup `yaml:"routegroups,omitempty"`
 	} `yaml:"http,omitempty"`
 
 	// Notifications specifies configuration about various endpoint to which
@@ -145,6 +392,62 @@ type Configuration struct {
 	Health Health `yaml:"health,omitempty"`
 
 	Proxy Proxy `yaml:"proxy,omitempty"`
+
+	// AccessLog configures the records emitted for each blob read, used
+	// to bill registry egress.
+	AccessLog AccessLog `yaml:"accesslog,omitempty"`
+
+	// Compatibility is used for configurations of working with older or
+	// deprecated features.
+	Compatibility struct {
+		// Schema1 configures how schema1 manifests are served to clients
+		// which do not support schema2.
+		Schema1 struct {
+			// Enabled rewrites schema2 manifests and manifest lists fetched
+			// by tag as signed schema1 manifests for clients which only
+			// accept schema1.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// TrustKey is the path of the libtrust private key used to sign
+			// converted manifests. An ephemeral key is generated if unset.
+			TrustKey string `yaml:"signingkeyfile,omitempty"`
+
+			// Deprecation controls whether schema1 manifests may still be
+			// pushed and pulled. Defaults to allow.
+			Deprecation Schema1Deprecation `yaml:"deprecation,omitempty"`
+		} `yaml:"schema1,omitempty"`
+	} `yaml:"compatibility,omitempty"`
+}
+
+// AccessLog configures the blob access records and the sinks they are
+// written to.
+type AccessLog struct {
+	// Enabled turns on blob access records.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Sinks lists the destinations of the records.
+	Sinks []AccessLogSink `yaml:"sinks,omitempty"`
+}
+
+// AccessLogSink is a destination of blob access records.
+type AccessLogSink struct {
+	// Type is "file" or "kafka".
+	Type string `yaml:"type"`
+
+	// Path is the file records are appended to, for the file type.
+	Path string `yaml:"path,omitempty"`
+
+	// URL is the base url of the Kafka REST proxy, and Topic the topic
+	// records are produced to, for the kafka type.
+	URL     string        `yaml:"url,omitempty"`
+	Topic   string        `yaml:"topic,omitempty"`
+	Headers http.Header   `yaml:"headers,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// BatchSize is the maximum number of records produced per request, and
+	// QueueSize the number of records queued before records are dropped.
+	BatchSize int `yaml:"batchsize,omitempty"`
+	QueueSize int `yaml:"queuesize,omitempty"`
 }
 
 // LogHook is composed of hook Level and Type.
@@ -248,6 +551,43 @@ type Health struct {
 		// unhealthy state
 		Threshold int `yaml:"threshold,omitempty"`
 	} `yaml:"storagedriver,omitempty"`
+	// Auth configures a health check on the backend of the access
+	// controller, such as the token server or the htpasswd file
+	Auth struct {
+		// Enabled turns on the health check for the auth backend
+		Enabled bool `yaml:"enabled,omitempty"`
+		// Interval is the duration in between checks
+		Interval time.Duration `yaml:"interval,omitempty"`
+		// Threshold is the number of times a check must fail to trigger an
+		// unhealthy state
+		Threshold int `yaml:"threshold,omitempty"`
+	} `yaml:"auth,omitempty"`
+	// Notifications configures a health check on the queues of the
+	// notification endpoints, failing while too many events are pending
+	Notifications struct {
+		// Enabled turns on the health check for the notification queues
+		Enabled bool `yaml:"enabled,omitempty"`
+		// Interval is the duration in between checks
+		Interval time.Duration `yaml:"interval,omitempty"`
+		// Threshold is the number of times a check must fail to trigger an
+		// unhealthy state
+		Threshold int `yaml:"threshold,omitempty"`
+		// MaxPending is the number of events pending for an endpoint above
+		// which the check fails
+		MaxPending int `yaml:"maxpending,omitempty"`
+	} `yaml:"notifications,omitempty"`
+	// Proxy configures a health check on the remote registry of a pull
+	// through cache, checking that it is reachable and accepts the
+	// configured credentials
+	Proxy struct {
+		// Enabled turns on the health check for the remote registry
+		Enabled bool `yaml:"enabled,omitempty"`
+		// Interval is the duration in between checks
+		Interval time.Duration `yaml:"interval,omitempty"`
+		// Threshold is the number of times a check must fail to trigger an
+		// unhealthy state
+		Threshold int `yaml:"threshold,omitempty"`
+	} `yaml:"proxy,omitempty"`
 }
 
 // v0_1Configuration is a Version 0.1 Configuration struct
@@ -304,6 +644,43 @@ func (loglevel *Loglevel) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return nil
 }
 
+// Schema1Deprecation is the mode in which the registry handles Docker
+// schema1 manifests while their use is phased out.
+type Schema1Deprecation string
+
+const (
+	// Schema1Allow serves and accepts schema1 manifests as before.
+	Schema1Allow Schema1Deprecation = "allow"
+
+	// Schema1Warn serves and accepts schema1 manifests, marking responses
+	// with deprecation headers.
+	Schema1Warn Schema1Deprecation = "warn"
+
+	// Schema1Reject refuses to serve or accept schema1 manifests.
+	Schema1Reject Schema1Deprecation = "reject"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+// Unmarshals a string into a Schema1Deprecation, lowercasing the string and
+// validating that it represents a valid mode
+func (mode *Schema1Deprecation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var modeString string
+	err := unmarshal(&modeString)
+	if err != nil {
+		return err
+	}
+
+	modeString = strings.ToLower(modeString)
+	switch Schema1Deprecation(modeString) {
+	case Schema1Allow, Schema1Warn, Schema1Reject:
+	default:
+		return fmt.Errorf("Invalid schema1 deprecation mode %s Must be one of [allow, warn, reject]", modeString)
+	}
+
+	*mode = Schema1Deprecation(modeString)
+	return nil
+}
+
 // Parameters defines a key-value parameters mapping
 type Parameters map[string]interface{}
 
@@ -325,6 +702,26 @@ func (storage Storage) Type() string {
 			// allow configuration of delete
 		case "redirect":
 			// allow configuration of redirect
+		case "digest":
+			// allow configuration of digest algorithms
+		case "plugins":
+			// allow configuration of storage driver plugins
+		case "layout":
+			// allow configuration of the blob store layout
+		case "journal":
+			// allow configuration of the metadata journal
+		case "locks":
+			// allow configuration of locks
+		case "storageclass":
+			// allow configuration of storage classes
+		case "manifestindex":
+			// allow configuration of the manifest index
+		case "catalogindex":
+			// allow configuration of the catalog index
+		case "scope":
+			// allow configuration of the storage scope of requests
+		case "gc":
+			// allow configuration of garbage collection
 		default:
 			storageType = append(storageType, k)
 		}
@@ -366,6 +763,26 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 					// allow configuration of delete
 				case "redirect":
 					// allow configuration of redirect
+				case "digest":
+					// allow configuration of digest algorithms
+				case "plugins":
+					// allow configuration of storage driver plugins
+				case "layout":
+					// allow configuration of the blob store layout
+				case "journal":
+					// allow configuration of the metadata journal
+				case "locks":
+					// allow configuration of locks
+				case "storageclass":
+					// allow configuration of storage classes
+				case "manifestindex":
+					// allow configuration of the manifest index
+				case "catalogindex":
+					// allow configuration of the catalog index
+				case "scope":
+					// allow configuration of the storage scope of requests
+				case "gc":
+					// allow configuration of garbage collection
 				default:
 					types = append(types, k)
 				}
@@ -397,6 +814,72 @@ func (storage Storage) MarshalYAML() (interface{}, error) {
 	return map[string]Parameters(storage), nil
 }
 
+// HTTPHost configures the address of the registry for requests to some of
+// the hostnames it is reachable by.
+type HTTPHost struct {
+	// Names lists the hostnames, matched against the Host or
+	// X-Forwarded-Host of requests. A name without a port matches any port.
+	Names []string `yaml:"names"`
+
+	// Host is the address of the registry for requests to these hostnames,
+	// as a fully qualified URL.
+	Host string `yaml:"host"`
+}
+
+// ErrorResponses customizes the error responses of the API. Templates are
+// executed with the code, message, detail, documentation URL, request id and
+// repository of each error.
+type ErrorResponses struct {
+	// DocumentationURL is a template of the link to the documentation of
+	// errors whose code does not link to documentation of its own.
+	DocumentationURL string `yaml:"documentationurl,omitempty"`
+
+	// Message is a template of the message of errors, such as one adding
+	// the documentation URL for clients which only show the message.
+	Message string `yaml:"message,omitempty"`
+
+	// RequestID includes the id of the failed request in errors.
+	RequestID bool `yaml:"requestid,omitempty"`
+}
+
+// NamespaceStorage configures the storage of the repositories of top-level
+// namespaces.
+type NamespaceStorage struct {
+	// Names lists the top-level namespaces, the first component of
+	// repository names, stored with this storage.
+	Names []string `yaml:"names"`
+
+	// Storage configures the storage driver. Storage options, such as
+	// delete, redirect and cache, are those of the registry's storage.
+	Storage Storage `yaml:"storage"`
+
+	// Region is the region the storage keeps its data in, which residency
+	// policies refer to.
+	Region string `yaml:"region,omitempty"`
+}
+
+// Residency configures the data residency policies of the registry.
+type Residency struct {
+	// Region is the region the registry's storage keeps its data in.
+	Region string `yaml:"region,omitempty"`
+
+	// Policies pin repositories to regions. The first policy matching a
+	// repository applies to it. Repositories matched by no policy may be
+	// stored in any region.
+	Policies []ResidencyPolicy `yaml:"policies,omitempty"`
+}
+
+// ResidencyPolicy restricts the regions the data of repositories may be
+// stored in.
+type ResidencyPolicy struct {
+	// Repositories lists patterns of repository names, as matched by
+	// path.Match, such as "eu/*".
+	Repositories []string `yaml:"repositories"`
+
+	// Regions lists the regions the repositories may be stored in.
+	Regions []string `yaml:"regions"`
+}
+
 // Auth defines the configuration for registry authorization.
 type Auth map[string]Parameters
 
@@ -404,7 +887,12 @@ type Auth map[string]Parameters
 func (auth Auth) Type() string {
 	// Return only key in this map
 	for k := range auth {
-		return k
+		switch k {
+		case "cache":
+			// allow configuration of the authorization cache
+		default:
+			return k
+		}
 	}
 	return ""
 }
@@ -428,13 +916,19 @@ func (auth *Auth) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if len(m) > 1 {
 			types := make([]string, 0, len(m))
 			for k := range m {
-				types = append(types, k)
+				switch k {
+				case "cache":
+					// allow configuration of the authorization cache
+				default:
+					types = append(types, k)
+				}
 			}
 
 			// TODO(stevvooe): May want to change this slightly for
 			// authorization to allow multiple challenges.
-			return fmt.Errorf("must provide exactly one type. Provided: %v", types)
-
+			if len(types) > 1 {
+				return fmt.Errorf("must provide exactly one type. Provided: %v", types)
+			}
 		}
 		*auth = m
 		return nil
@@ -464,6 +958,15 @@ type Notifications struct {
 	// respond to webhook notifications. In the future, we may allow other
 	// kinds of endpoints, such as external queues.
 	Endpoints []Endpoint `yaml:"endpoints,omitempty"`
+
+	// History is the number of recent events retained in memory so that
+	// they can be replayed to the endpoints through the admin API. If zero,
+	// a default of 1000 events is used.
+	History int `yaml:"history,omitempty"`
+
+	// ActorClaims lists the claims of the tokens users authenticate with
+	// which are included in the actor of events.
+	ActorClaims []string `yaml:"actorclaims,omitempty"`
 }
 
 // Endpoint describes the configuration of an http webhook notification
@@ -476,6 +979,10 @@ type Endpoint struct {
 	Timeout   time.Duration `yaml:"timeout"`   // HTTP timeout
 	Threshold int           `yaml:"threshold"` // circuit breaker threshold before backing off on failure
 	Backoff   time.Duration `yaml:"backoff"`   // backoff duration
+
+	// Envelope is the version of the event envelope sent to the endpoint:
+	// v1, the default, or v3.
+	Envelope string `yaml:"envelope,omitempty"`
 }
 
 // Reporting defines error reporting methods.
@@ -517,6 +1024,44 @@ type Middleware struct {
 	Options Parameters `yaml:"options"`
 }
 
+// RouteGroup configures the responses of a group of routes.
+type RouteGroup struct {
+	// Headers is a set of headers to include in the responses of the
+	// group, in addition to those of http.headers.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// CORS is the cross-origin resource sharing policy of the group.
+	CORS CORS `yaml:"cors,omitempty"`
+}
+
+// CORS configures the cross-origin resource sharing headers of responses,
+// which allow web pages served from other origins to call the registry.
+// Cross-origin requests are not allowed if AllowedOrigins is empty.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to make requests, such as
+	// "https://ui.example.com", or "*" for any origin.
+	AllowedOrigins []string `yaml:"allowedorigins,omitempty"`
+
+	// AllowedMethods lists the methods allowed in requests. Defaults to
+	// GET and HEAD.
+	AllowedMethods []string `yaml:"allowedmethods,omitempty"`
+
+	// AllowedHeaders lists the request headers allowed. Defaults to
+	// Accept, Authorization, Content-Type and Range.
+	AllowedHeaders []string `yaml:"allowedheaders,omitempty"`
+
+	// ExposedHeaders lists the response headers exposed to the page.
+	// Defaults to the headers of the registry API.
+	ExposedHeaders []string `yaml:"exposedheaders,omitempty"`
+
+	// AllowCredentials allows requests with cookies and authorization
+	// headers.
+	AllowCredentials bool `yaml:"allowcredentials,omitempty"`
+
+	// MaxAge is the time preflight responses may be cached for.
+	MaxAge time.Duration `yaml:"maxage,omitempty"`
+}
+
 // Proxy configures the registry as a pull through cache
 type Proxy struct {
 	// RemoteURL is the URL of the remote registry
@@ -527,6 +1072,81 @@ type Proxy struct {
 
 	// Password of the hub user
 	Password string `yaml:"password"`
+
+	// CredentialHelper is the name of a docker credential helper, run as
+	// docker-credential-<name>, which provides the credentials of the
+	// remote registry in place of username and password.
+	CredentialHelper string `yaml:"credentialhelper,omitempty"`
+
+	// Exec is a command printing the credentials of the remote registry,
+	// in place of username and password.
+	Exec ProxyExec `yaml:"exec,omitempty"`
+
+	// RevalidateAfter enables serving the tags cached by the pull through
+	// cache without querying the remote. Tags cached for longer are served
+	// too, but revalidated against the remote in the background. Tags are
+	// looked up on the remote for every request if unset.
+	RevalidateAfter time.Duration `yaml:"revalidateafter,omitempty"`
+
+	// TokenProvider exchanges cloud credentials for the credentials of the
+	// remote registry, in place of username and password.
+	TokenProvider ProxyTokenProvider `yaml:"tokenprovider,omitempty"`
+
+	// RefreshInterval is how long the credentials provided by a credential
+	// helper, or by a command which does not report their expiry, are used
+	// before being requested again.
+	RefreshInterval time.Duration `yaml:"refreshinterval,omitempty"`
+
+	// NegativeTTL is how long the tags, manifests and blobs found missing
+	// from the remote are reported unknown without querying it again. The
+	// remote is queried for every request if unset.
+	NegativeTTL time.Duration `yaml:"negativettl,omitempty"`
+
+	// MaxRetries is how many times the GET and HEAD requests to the remote
+	// failing with a network error or a transient status are retried, with
+	// an exponential backoff. Requests are not retried if unset.
+	MaxRetries int `yaml:"maxretries,omitempty"`
+}
+
+// ProxyTokenProvider configures the built-in token provider of the cloud
+// registry a pull through cache mirrors.
+type ProxyTokenProvider struct {
+	// Name of the token provider: ecr, gcr or acr.
+	Name string `yaml:"name,omitempty"`
+
+	// Options are the parameters of the token provider, such as the cloud
+	// credentials it authenticates with.
+	Options Parameters `yaml:"options,omitempty"`
+}
+
+// ProxyExec configures a command providing the credentials of the remote
+// registry of a pull through cache.
+type ProxyExec struct {
+	// Command is the path of the command.
+	Command string `yaml:"command,omitempty"`
+
+	// Args are the arguments passed to the command.
+	Args []string `yaml:"args,omitempty"`
+}
+
+// Federation configures the sibling registries of a registry.
+type Federation struct {
+	// Registries lists the sibling registries, queried in order.
+	Registries []FederatedRegistry `yaml:"registries,omitempty"`
+}
+
+// FederatedRegistry configures a sibling registry.
+type FederatedRegistry struct {
+	// URL is the base url of the registry.
+	URL string `yaml:"url"`
+
+	// Username and Password authenticate with the registry, if set.
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// Redirect redirects clients to the registry to fetch blobs found
+	// there, rather than proxying them. Manifests are always proxied.
+	Redirect bool `yaml:"redirect,omitempty"`
 }
 
 // Parse parses an input configuration yaml document into a Configuration struct
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v2"
@@ -63,12 +64,16 @@ var configStruct = Configuration{
 		},
 	},
 	HTTP: struct {
-		Addr   string `yaml:"addr,omitempty"`
-		Net    string `yaml:"net,omitempty"`
-		Host   string `yaml:"host,omitempty"`
-		Prefix string `yaml:"prefix,omitempty"`
-		Secret string `yaml:"secret,omitempty"`
-		TLS    struct {
+		Addr           string         `yaml:"addr,omitempty"`
+		Net            string         `yaml:"net,omitempty"`
+		Host           string         `yaml:"host,omitempty"`
+		Hosts          []HTTPHost     `yaml:"hosts,omitempty"`
+		RelativeURLs   bool           `yaml:"relativeurls,omitempty"`
+		TrustedProxies []string       `yaml:"trustedproxies,omitempty"`
+		Errors         ErrorResponses `yaml:"errors,omitempty"`
+		Prefix         string         `yaml:"prefix,omitempty"`
+		Secret         string         `yaml:"secret,omitempty"`
+		TLS            struct {
 			Certificate string   `yaml:"certificate,omitempty"`
 			Key         string   `yaml:"key,omitempty"`
 			ClientCAs   []string `yaml:"clientcas,omitempty"`
@@ -77,6 +82,74 @@ var configStruct = Configuration{
 		Debug   struct {
 			Addr string `yaml:"addr,omitempty"`
 		} `yaml:"debug,omitempty"`
+		Admin struct {
+			Enabled  bool `yaml:"enabled,omitempty"`
+			Insecure bool `yaml:"insecure,omitempty"`
+			GRPC     struct {
+				Addr string `yaml:"addr,omitempty"`
+				TLS  struct {
+					Certificate string   `yaml:"certificate,omitempty"`
+					Key         string   `yaml:"key,omitempty"`
+					ClientCAs   []string `yaml:"clientcas,omitempty"`
+				} `yaml:"tls,omitempty"`
+			} `yaml:"grpc,omitempty"`
+		} `yaml:"admin,omitempty"`
+		UI struct {
+			Enabled bool `yaml:"enabled,omitempty"`
+		} `yaml:"ui,omitempty"`
+		TagSnapshots struct {
+			Enabled        bool   `yaml:"enabled,omitempty"`
+			SigningKeyFile string `yaml:"signingkeyfile,omitempty"`
+		} `yaml:"tagsnapshots,omitempty"`
+		Trust struct {
+			Enabled bool `yaml:"enabled,omitempty"`
+		} `yaml:"trust,omitempty"`
+		BuildGroups struct {
+			Enabled    bool   `yaml:"enabled,omitempty"`
+			Annotation string `yaml:"annotation,omitempty"`
+		} `yaml:"buildgroups,omitempty"`
+		SBOM struct {
+			URL     string        `yaml:"url,omitempty"`
+			Headers http.Header   `yaml:"headers,omitempty"`
+			Timeout time.Duration `yaml:"timeout,omitempty"`
+		} `yaml:"sbom,omitempty"`
+		Shadow struct {
+			URL        string        `yaml:"url,omitempty"`
+			Percentage float64       `yaml:"percentage,omitempty"`
+			Headers    http.Header   `yaml:"headers,omitempty"`
+			Timeout    time.Duration `yaml:"timeout,omitempty"`
+		} `yaml:"shadow,omitempty"`
+		Timeouts struct {
+			ReadHeader time.Duration `yaml:"readheader,omitempty"`
+			Default    time.Duration `yaml:"default,omitempty"`
+			Uploads    time.Duration `yaml:"uploads,omitempty"`
+			Blobs      time.Duration `yaml:"blobs,omitempty"`
+			Manifests  time.Duration `yaml:"manifests,omitempty"`
+			Tags       time.Duration `yaml:"tags,omitempty"`
+		} `yaml:"timeouts,omitempty"`
+		UploadSessionTTL time.Duration `yaml:"uploadsessionttl,omitempty"`
+		ManifestLimits   struct {
+			Default    int64            `yaml:"default,omitempty"`
+			MediaTypes map[string]int64 `yaml:"mediatypes,omitempty"`
+		} `yaml:"manifestlimits,omitempty"`
+		UploadDeduplication struct {
+			Enabled         bool `yaml:"enabled,omitempty"`
+			MaxRepositories int  `yaml:"maxrepositories,omitempty"`
+		} `yaml:"uploaddeduplication,omitempty"`
+		Deltas struct {
+			Enabled bool  `yaml:"enabled,omitempty"`
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"deltas,omitempty"`
+		LayerIndex struct {
+			Enabled bool  `yaml:"enabled,omitempty"`
+			OnPush  bool  `yaml:"onpush,omitempty"`
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"layerindex,omitempty"`
+		Imports struct {
+			Enabled bool  `yaml:"enabled,omitempty"`
+			MaxSize int64 `yaml:"maxsize,omitempty"`
+		} `yaml:"imports,omitempty"`
+		RouteGroups map[string]RouteGroup `yaml:"routegroups,omitempty"`
 	}{
 		TLS: struct {
 			Certificate string   `yaml:"certificate,omitempty"`
@@ -191,6 +264,25 @@ func (suite *ConfigSuite) TestParseInmemory(c *C) {
 	c.Assert(config, DeepEquals, suite.expectedConfig)
 }
 
+// TestParseAuthCache validates that the auth cache may be configured along
+// with an auth provider.
+func (suite *ConfigSuite) TestParseAuthCache(c *C) {
+	configYaml := `version: 0.1
+storage: inmemory
+auth:
+  cache:
+    ttl: 10s
+  htpasswd:
+    realm: basic-realm
+    path: /path/to/htpasswd
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Auth.Type(), Equals, "htpasswd")
+	c.Assert(config.Auth.Parameters(), DeepEquals, Parameters{"realm": "basic-realm", "path": "/path/to/htpasswd"})
+	c.Assert(config.Auth["cache"], DeepEquals, Parameters{"ttl": "10s"})
+}
+
 // TestParseIncomplete validates that an incomplete yaml configuration cannot
 // be parsed without providing environment variables to fill in the missing
 // components.
@@ -312,6 +404,19 @@ func (suite *ConfigSuite) TestParseInvalidLoglevel(c *C) {
 
 }
 
+// TestParseInvalidSchema1Deprecation validates that the parser will fail to
+// parse a configuration if the schema1 deprecation mode is unknown
+func (suite *ConfigSuite) TestParseInvalidSchema1Deprecation(c *C) {
+	invalidConfigYaml := "version: 0.1\nstorage: inmemory\ncompatibility:\n  schema1:\n    deprecation: derp"
+	_, err := Parse(bytes.NewReader([]byte(invalidConfigYaml)))
+	c.Assert(err, NotNil)
+
+	validConfigYaml := "version: 0.1\nstorage: inmemory\ncompatibility:\n  schema1:\n    deprecation: Reject"
+	config, err := Parse(bytes.NewReader([]byte(validConfigYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Compatibility.Schema1.Deprecation, Equals, Schema1Reject)
+}
+
 // TestParseWithDifferentEnvReporting validates that environment variables
 // properly override reporting parameters
 func (suite *ConfigSuite) TestParseWithDifferentEnvReporting(c *C) {
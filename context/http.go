@@ -50,6 +50,100 @@ func RemoteAddr(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+// RequestScheme extracts the scheme the client requested, taking into
+// account proxy headers. The Forwarded header takes precedence over
+// X-Forwarded-Proto.
+func RequestScheme(r *http.Request) string {
+	if proto := parseForwarded(r.Header.Get("Forwarded"))["proto"]; proto != "" {
+		return proto
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.TrimSpace(strings.SplitN(proto, ",", 2)[0])
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	if r.URL != nil && r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	return "http"
+}
+
+// RequestHost extracts the host the client requested, taking into account
+// proxy headers. The Forwarded header takes precedence over X-Forwarded-Host.
+// The port of X-Forwarded-Port is added to a host without one, unless it is
+// the default port of the scheme. It may include a port.
+func RequestHost(r *http.Request) string {
+	host := parseForwarded(r.Header.Get("Forwarded"))["host"]
+	if host == "" {
+		if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+			// Each proxy appends the requested host to the comma-separated
+			// list, the first one is the host requested by the client.
+			hosts := strings.SplitN(forwardedHost, ",", 2)
+			host = strings.TrimSpace(hosts[0])
+		}
+	}
+	if host == "" {
+		return r.Host
+	}
+
+	port := strings.TrimSpace(strings.SplitN(r.Header.Get("X-Forwarded-Port"), ",", 2)[0])
+	if port == "" {
+		return host
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if scheme := RequestScheme(r); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// parseForwarded returns the parameters of the first element of a Forwarded
+// header, as defined by RFC 7239, describing the request of the client. Keys
+// are lower case and quoted values are unquoted.
+func parseForwarded(value string) map[string]string {
+	params := make(map[string]string)
+
+	var (
+		pair   []byte
+		quoted bool
+	)
+	add := func() {
+		kv := strings.SplitN(string(pair), "=", 2)
+		pair = pair[:0]
+		if len(kv) != 2 {
+			return
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if _, ok := params[key]; !ok {
+			params[key] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			pair = append(pair, c)
+		case c == '\\' && quoted && i+1 < len(value):
+			i++
+			pair = append(pair, value[i])
+		case c == ';' && !quoted:
+			add()
+		case c == ',' && !quoted:
+			add()
+			return params
+		default:
+			pair = append(pair, c)
+		}
+	}
+	add()
+	return params
+}
+
 // RemoteIP extracts the remote IP of the request, taking into
 // account proxy headers.
 func RemoteIP(r *http.Request) string {
@@ -311,6 +405,11 @@ func (irw *instrumentedResponseWriter) WriteHeader(status int) {
 	irw.mu.Unlock()
 }
 
+// Unwrap returns the wrapped response writer, for http.ResponseController.
+func (irw *instrumentedResponseWriter) Unwrap() http.ResponseWriter {
+	return irw.ResponseWriter
+}
+
 func (irw *instrumentedResponseWriter) Flush() {
 	if flusher, ok := irw.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
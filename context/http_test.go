@@ -283,3 +283,28 @@ func TestRemoteAddr(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRequestHost(t *testing.T) {
+	for _, tc := range []struct {
+		host, forwardedHost, forwarded, expected string
+	}{
+		{"registry.example.com", "", "", "registry.example.com"},
+		{"registry.example.com:5000", "", "", "registry.example.com:5000"},
+		{"10.0.0.1:5000", "registry.example.com", "", "registry.example.com"},
+		{"10.0.0.1:5000", "registry.example.com, proxy.internal", "", "registry.example.com"},
+		{"10.0.0.1:5000", "proxy.internal", `For="[2001:db8::1]";Host="registry.example.com:8443"`, "registry.example.com:8443"},
+		{"10.0.0.1:5000", "", `for=192.0.2.60;proto="a;b", host=proxy.internal`, "10.0.0.1:5000"},
+	} {
+		r := &http.Request{Host: tc.host, Header: http.Header{}}
+		if tc.forwardedHost != "" {
+			r.Header.Set("X-Forwarded-Host", tc.forwardedHost)
+		}
+		if tc.forwarded != "" {
+			r.Header.Set("Forwarded", tc.forwarded)
+		}
+
+		if host := RequestHost(r); host != tc.expected {
+			t.Errorf("unexpected host for %q, %q: %q != %q", tc.host, tc.forwardedHost, host, tc.expected)
+		}
+	}
+}
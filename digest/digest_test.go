@@ -1,6 +1,7 @@
 package digest
 
 import (
+	"crypto/md5"
 	"testing"
 )
 
@@ -80,3 +81,52 @@ func TestParseDigest(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterAlgorithm(t *testing.T) {
+	const alg Algorithm = "md5test"
+	if alg.Available() {
+		t.Fatalf("%v should not be available before registration", alg)
+	}
+
+	if _, err := ParseDigest("md5test:d41d8cd98f00b204e9800998ecf8427e"); err != ErrDigestUnsupported {
+		t.Fatalf("expected unsupported digest before registration, got %v", err)
+	}
+
+	RegisterAlgorithm(alg, md5.Size, md5.New)
+	defer delete(algorithms, alg)
+
+	if !alg.Available() {
+		t.Fatalf("%v should be available after registration", alg)
+	}
+
+	dgst := alg.FromBytes(nil)
+	if dgst != "md5test:d41d8cd98f00b204e9800998ecf8427e" {
+		t.Fatalf("unexpected digest for empty input: %v", dgst)
+	}
+
+	if _, err := ParseDigest(dgst.String()); err != nil {
+		t.Fatalf("unexpected error parsing registered digest: %v", err)
+	}
+
+	if _, err := ParseDigest("md5test:d41d8cd98f00b204"); err != ErrDigestInvalidLength {
+		t.Fatalf("expected invalid length, got %v", err)
+	}
+
+	var found bool
+	for _, a := range Algorithms() {
+		if a == alg {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("%v not listed in available algorithms: %v", alg, Algorithms())
+	}
+
+	verifier, err := NewDigestVerifier(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error creating verifier: %v", err)
+	}
+	if !verifier.Verified() {
+		t.Fatalf("verifier should verify empty content")
+	}
+}
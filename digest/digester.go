@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"sort"
 )
 
 // Algorithm identifies and implementation of a digester by an identifier.
@@ -24,20 +25,66 @@ const (
 	Canonical = SHA256
 )
 
-var (
-	// TODO(stevvooe): Follow the pattern of the standard crypto package for
-	// registration of digests. Effectively, we are a registerable set and
-	// common symbol access.
+// hashFactory provides the hash.Hash implementation for an algorithm.
+// crypto.Hash satisfies this interface.
+type hashFactory interface {
+	Available() bool
+	Size() int
+	New() hash.Hash
+}
 
+var (
 	// algorithms maps values to hash.Hash implementations. Other algorithms
 	// may be available but they cannot be calculated by the digest package.
-	algorithms = map[Algorithm]crypto.Hash{
+	algorithms = map[Algorithm]hashFactory{
 		SHA256: crypto.SHA256,
 		SHA384: crypto.SHA384,
 		SHA512: crypto.SHA512,
 	}
 )
 
+// funcHash adapts a constructor function to the hashFactory interface.
+type funcHash struct {
+	size int
+	fn   func() hash.Hash
+}
+
+func (f funcHash) Available() bool { return f.fn != nil }
+func (f funcHash) Size() int       { return f.size }
+func (f funcHash) New() hash.Hash  { return f.fn() }
+
+// RegisterAlgorithm makes the algorithm available for use with the digest
+// package, using fn to construct hashes producing size bytes. Following the
+// pattern of the standard crypto package, this should be called from an init
+// function and is not safe to call concurrently with digest operations.
+// Registering an algorithm that is already present replaces it.
+func RegisterAlgorithm(a Algorithm, size int, fn func() hash.Hash) {
+	if a == "" || size <= 0 || fn == nil {
+		panic(fmt.Sprintf("digest: invalid registration for algorithm %q", a))
+	}
+
+	algorithms[a] = funcHash{size: size, fn: fn}
+}
+
+// Algorithms returns the set of algorithms that are currently available.
+func Algorithms() []Algorithm {
+	var available []Algorithm
+	for a := range algorithms {
+		if a.Available() {
+			available = append(available, a)
+		}
+	}
+
+	sort.Sort(algorithmSlice(available))
+	return available
+}
+
+type algorithmSlice []Algorithm
+
+func (s algorithmSlice) Len() int           { return len(s) }
+func (s algorithmSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s algorithmSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 // Available returns true if the digest type is available for use. If this
 // returns false, New and Hash will return nil.
 func (a Algorithm) Available() bool {
@@ -99,6 +99,18 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestBlobInvalid returned when a blob referenced by a manifest is
+// described incorrectly, such as with a media type that does not match its
+// annotations.
+type ErrManifestBlobInvalid struct {
+	Digest digest.Digest
+	Reason error
+}
+
+func (err ErrManifestBlobInvalid) Error() string {
+	return fmt.Sprintf("invalid blob %v on manifest: %v", err.Digest, err.Reason)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
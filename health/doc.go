@@ -28,6 +28,16 @@
 //
 //  # curl localhost:5001/debug/health
 //  {}
+//
+// Liveness and readiness
+//
+// The checks of DefaultRegistry tell whether the application is ready to
+// serve requests, and are also served on "/debug/health/ready". Checks
+// telling whether the application is alive at all, whose failure means it
+// should be restarted rather than only taken out of rotation, are registered
+// in LivenessRegistry and served on "/debug/health/live":
+//
+//  health.LivenessRegistry.Register("deadlock", deadlockChecker)
 //  # curl -X POST localhost:5001/debug/health/down
 //  # curl localhost:5001/debug/health
 //  {"manual_http_status":"Manual Check"}
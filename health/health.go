@@ -29,9 +29,17 @@ func NewRegistry() *Registry {
 }
 
 // DefaultRegistry is the default registry where checks are registered. It is
-// the registry used by the HTTP handler.
+// the registry used by the HTTP handler. Its checks tell whether the
+// application is ready to serve requests.
 var DefaultRegistry *Registry
 
+// LivenessRegistry is the registry of the checks telling whether the
+// application is alive, as opposed to ready. A failed liveness check means
+// the application should be restarted, while a failed readiness check, such
+// as an unavailable storage backend, only means it should not receive
+// requests until the check passes again.
+var LivenessRegistry *Registry
+
 // Checker is the interface for a Health Checker
 type Checker interface {
 	// Check returns nil if the service is okay.
@@ -240,8 +248,14 @@ func RegisterPeriodicThresholdFunc(name string, period time.Duration, threshold
 // and their corresponding status.
 // Returns 503 if any Error status exists, 200 otherwise
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	DefaultRegistry.StatusHandler(w, r)
+}
+
+// StatusHandler returns a JSON blob with the checks of the registry which
+// failed. Returns 503 if any check failed, 200 otherwise.
+func (registry *Registry) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		checks := CheckStatus()
+		checks := registry.CheckStatus()
 		status := http.StatusOK
 
 		// If there is an error, return 503
@@ -255,6 +269,17 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// LivenessHandler serves the status of the liveness checks.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	LivenessRegistry.StatusHandler(w, r)
+}
+
+// ReadinessHandler serves the status of the readiness checks, those of the
+// default registry.
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	DefaultRegistry.StatusHandler(w, r)
+}
+
 // Handler returns a handler that will return 503 response code if the health
 // checks have failed. If everything is okay with the health checks, the
 // handler will pass through to the provided handler. Use this handler to
@@ -299,8 +324,12 @@ func statusResponse(w http.ResponseWriter, r *http.Request, status int, checks m
 	}
 }
 
-// Registers global /debug/health api endpoint, creates default registry
+// Registers global /debug/health api endpoints, creates default and liveness
+// registries
 func init() {
 	DefaultRegistry = NewRegistry()
+	LivenessRegistry = NewRegistry()
 	http.HandleFunc("/debug/health", StatusHandler)
+	http.HandleFunc("/debug/health/live", LivenessHandler)
+	http.HandleFunc("/debug/health/ready", ReadinessHandler)
 }
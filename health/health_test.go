@@ -105,3 +105,45 @@ func TestHealthHandler(t *testing.T) {
 	updater.Update(nil)
 	checkUp(t, "when server is back up") // now we should be back up.
 }
+
+// TestLivenessAndReadiness ensures that failed readiness checks do not fail
+// the liveness endpoint.
+func TestLivenessAndReadiness(t *testing.T) {
+	DefaultRegistry = NewRegistry()
+	LivenessRegistry = NewRegistry()
+
+	DefaultRegistry.Register("storage", CheckFunc(func() error {
+		return errors.New("storage unavailable")
+	}))
+
+	for _, tc := range []struct {
+		handler  http.HandlerFunc
+		expected int
+	}{
+		{LivenessHandler, http.StatusOK},
+		{ReadinessHandler, http.StatusServiceUnavailable},
+		{StatusHandler, http.StatusServiceUnavailable},
+	} {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "https://fakeurl.com/debug/health", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request.")
+		}
+
+		tc.handler(recorder, req)
+		if recorder.Code != tc.expected {
+			t.Errorf("expected %d, got %d", tc.expected, recorder.Code)
+		}
+	}
+
+	LivenessRegistry.Register("deadlock", CheckFunc(func() error {
+		return errors.New("deadlocked")
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "https://fakeurl.com/debug/health/live", nil)
+	LivenessHandler(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a failed liveness check, got %d", recorder.Code)
+	}
+}
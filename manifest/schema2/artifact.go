@@ -0,0 +1,50 @@
+package schema2
+
+import (
+	"encoding/json"
+
+	"github.com/docker/distribution"
+)
+
+const (
+	// MediaTypeEmptyConfig is the media type of the empty configuration of
+	// artifacts, which are not images.
+	MediaTypeEmptyConfig = "application/vnd.oci.empty.v1+json"
+)
+
+// EmptyConfig is the content of the configuration of artifacts.
+var EmptyConfig = []byte("{}")
+
+// Subject returns the descriptor of the manifest an artifact manifest refers
+// to, such as the image an SBOM or a signature describes, or nil if the
+// manifest has no subject. It is read from the canonical content, like
+// annotations.
+func (m DeserializedManifest) Subject() (*distribution.Descriptor, error) {
+	var manifest struct {
+		Subject *distribution.Descriptor `json:"subject,omitempty"`
+	}
+
+	if err := json.Unmarshal(m.canonical, &manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest.Subject, nil
+}
+
+// ArtifactType returns the type of the artifact described by the manifest:
+// its artifactType field if set, or else the media type of its
+// configuration.
+func (m DeserializedManifest) ArtifactType() (string, error) {
+	var manifest struct {
+		ArtifactType string `json:"artifactType,omitempty"`
+	}
+
+	if err := json.Unmarshal(m.canonical, &manifest); err != nil {
+		return "", err
+	}
+
+	if manifest.ArtifactType == "" {
+		return m.Config.MediaType, nil
+	}
+	return manifest.ArtifactType, nil
+}
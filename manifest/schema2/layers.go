@@ -0,0 +1,125 @@
+package schema2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+)
+
+const (
+	// MediaTypeUncompressedLayer is the mediaType used for layers which
+	// are not compressed.
+	MediaTypeUncompressedLayer = "application/vnd.docker.image.rootfs.diff.tar"
+
+	// MediaTypeLayerZstd is the mediaType used for zstd compressed layers.
+	MediaTypeLayerZstd = "application/vnd.docker.image.rootfs.diff.tar.zstd"
+
+	// MediaTypeOCILayer is the OCI mediaType for uncompressed layers.
+	MediaTypeOCILayer = "application/vnd.oci.image.layer.v1.tar"
+
+	// MediaTypeOCILayerGzip is the OCI mediaType for gzip compressed layers.
+	MediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// MediaTypeOCILayerZstd is the OCI mediaType for zstd compressed layers.
+	MediaTypeOCILayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+const (
+	// AnnotationEStargzTOCDigest is the layer annotation carrying the digest
+	// of the table of contents of an eStargz layer. Its presence marks the
+	// layer as eStargz, which lazy-pulling clients fetch by range.
+	AnnotationEStargzTOCDigest = "containerd.io/snapshot/stargz/toc.digest"
+
+	// AnnotationEStargzUncompressedSize is the layer annotation carrying
+	// the uncompressed size of an eStargz layer.
+	AnnotationEStargzUncompressedSize = "io.containers.estargz.uncompressed-size"
+)
+
+// Layer compression types, as returned by LayerCompression.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var layerCompression = map[string]string{
+	MediaTypeLayer:             CompressionGzip,
+	MediaTypeUncompressedLayer: CompressionNone,
+	MediaTypeLayerZstd:         CompressionZstd,
+	MediaTypeOCILayer:          CompressionNone,
+	MediaTypeOCILayerGzip:      CompressionGzip,
+	MediaTypeOCILayerZstd:      CompressionZstd,
+}
+
+// LayerCompression returns the compression of layers with the given
+// mediaType. If the mediaType is not a known layer type, ok is false.
+func LayerCompression(mediaType string) (compression string, ok bool) {
+	compression, ok = layerCompression[mediaType]
+	return compression, ok
+}
+
+// LayerAnnotations returns the annotations of each layer in the manifest,
+// in the order of Layers. Annotations are not retained by
+// distribution.Descriptor, so they are read from the canonical content.
+func (m DeserializedManifest) LayerAnnotations() ([]map[string]string, error) {
+	var layers struct {
+		Layers []struct {
+			Annotations map[string]string `json:"annotations,omitempty"`
+		} `json:"layers"`
+	}
+
+	if err := json.Unmarshal(m.canonical, &layers); err != nil {
+		return nil, err
+	}
+
+	annotations := make([]map[string]string, len(layers.Layers))
+	for i, layer := range layers.Layers {
+		annotations[i] = layer.Annotations
+	}
+
+	return annotations, nil
+}
+
+// Annotations returns the annotations of the manifest itself, such as those
+// marking the storage class of an image. They are read from the canonical
+// content, like the annotations of layers.
+func (m DeserializedManifest) Annotations() (map[string]string, error) {
+	var manifest struct {
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+
+	if err := json.Unmarshal(m.canonical, &manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest.Annotations, nil
+}
+
+// ValidateLayer checks that the layer descriptor is consistent with its
+// annotations. eStargz layers must be gzip compressed and carry a valid
+// table of contents digest.
+func ValidateLayer(desc distribution.Descriptor, annotations map[string]string) error {
+	tocDigest, ok := annotations[AnnotationEStargzTOCDigest]
+	if !ok {
+		return nil
+	}
+
+	if compression, _ := LayerCompression(desc.MediaType); compression != CompressionGzip {
+		return fmt.Errorf("eStargz layer must be gzip compressed, got media type %q", desc.MediaType)
+	}
+
+	if _, err := digest.ParseDigest(tocDigest); err != nil {
+		return fmt.Errorf("invalid eStargz table of contents digest %q: %v", tocDigest, err)
+	}
+
+	if size, ok := annotations[AnnotationEStargzUncompressedSize]; ok {
+		if n, err := strconv.ParseInt(size, 10, 64); err != nil || n < 0 {
+			return fmt.Errorf("invalid eStargz uncompressed size %q", size)
+		}
+	}
+
+	return nil
+}
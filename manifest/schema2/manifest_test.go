@@ -103,3 +103,170 @@ func TestManifest(t *testing.T) {
 		t.Fatalf("unexpected size in reference: %d", references[0].Size)
 	}
 }
+
+var estargzManifest = []byte(`{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+   "config": {
+      "mediaType": "application/vnd.docker.container.image.v1+json",
+      "size": 985,
+      "digest": "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b"
+   },
+   "layers": [
+      {
+         "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+         "size": 153263,
+         "digest": "sha256:62d8908bee94c202b2d35224a221aaa2058318bfa9879fa541efaecba272331b",
+         "annotations": {
+            "containerd.io/snapshot/stargz/toc.digest": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+            "io.containers.estargz.uncompressed-size": "307200"
+         }
+      },
+      {
+         "mediaType": "application/vnd.oci.image.layer.v1.tar+zstd",
+         "size": 1024,
+         "digest": "sha256:9d3dd9504c685a304985025df4ed0283e47ac9ffa9bd0326fddf4d59513f0827"
+      }
+   ]
+}`)
+
+func TestLayerAnnotations(t *testing.T) {
+	var deserialized DeserializedManifest
+	if err := deserialized.UnmarshalJSON(estargzManifest); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	annotations, err := deserialized.LayerAnnotations()
+	if err != nil {
+		t.Fatalf("error getting layer annotations: %v", err)
+	}
+
+	if len(annotations) != len(deserialized.Layers) {
+		t.Fatalf("unexpected number of layer annotations: %d != %d", len(annotations), len(deserialized.Layers))
+	}
+
+	for i, layer := range deserialized.Layers {
+		if err := ValidateLayer(layer, annotations[i]); err != nil {
+			t.Fatalf("unexpected error validating layer %d: %v", i, err)
+		}
+	}
+
+	if compression, _ := LayerCompression(deserialized.Layers[1].MediaType); compression != CompressionZstd {
+		t.Fatalf("unexpected compression for zstd layer: %q", compression)
+	}
+
+	if _, ok := LayerCompression(MediaTypeConfig); ok {
+		t.Fatalf("config media type should not be a layer media type")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	var deserialized DeserializedManifest
+	if err := deserialized.UnmarshalJSON(estargzManifest); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	annotations, err := deserialized.Annotations()
+	if err != nil {
+		t.Fatalf("error getting manifest annotations: %v", err)
+	}
+
+	if len(annotations) != 0 {
+		t.Fatalf("unexpected manifest annotations: %v", annotations)
+	}
+}
+
+func TestArtifact(t *testing.T) {
+	var deserialized DeserializedManifest
+	if err := deserialized.UnmarshalJSON(expectedManifestSerialization); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	subject, err := deserialized.Subject()
+	if err != nil || subject != nil {
+		t.Fatalf("unexpected subject of image manifest: %v, %v", subject, err)
+	}
+	artifactType, err := deserialized.ArtifactType()
+	if err != nil || artifactType != MediaTypeConfig {
+		t.Fatalf("unexpected artifact type of image manifest: %q, %v", artifactType, err)
+	}
+
+	artifact := []byte(`{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+   "artifactType": "application/spdx+json",
+   "config": {
+      "mediaType": "application/vnd.oci.empty.v1+json",
+      "size": 2,
+      "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+   },
+   "layers": [
+      {
+         "mediaType": "application/spdx+json",
+         "size": 1024,
+         "digest": "sha256:62d8908bee94c202b2d35224a221aaa2058318bfa9879fa541efaecba272331b"
+      }
+   ],
+   "subject": {
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "size": 528,
+      "digest": "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b"
+   }
+}`)
+	if err := deserialized.UnmarshalJSON(artifact); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	subject, err = deserialized.Subject()
+	if err != nil || subject == nil || subject.Digest != "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b" || subject.Size != 528 {
+		t.Fatalf("unexpected subject of artifact manifest: %v, %v", subject, err)
+	}
+	artifactType, err = deserialized.ArtifactType()
+	if err != nil || artifactType != "application/spdx+json" {
+		t.Fatalf("unexpected artifact type of artifact manifest: %q, %v", artifactType, err)
+	}
+}
+
+func TestValidateLayer(t *testing.T) {
+	validTOC := "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	for _, testcase := range []struct {
+		mediaType   string
+		annotations map[string]string
+		valid       bool
+	}{
+		{
+			mediaType: MediaTypeLayerZstd,
+			valid:     true,
+		},
+		{
+			mediaType:   MediaTypeLayer,
+			annotations: map[string]string{AnnotationEStargzTOCDigest: validTOC},
+			valid:       true,
+		},
+		{
+			// eStargz is only defined for gzip
+			mediaType:   MediaTypeOCILayerZstd,
+			annotations: map[string]string{AnnotationEStargzTOCDigest: validTOC},
+		},
+		{
+			mediaType:   MediaTypeOCILayerGzip,
+			annotations: map[string]string{AnnotationEStargzTOCDigest: "sha256:abc"},
+		},
+		{
+			mediaType: MediaTypeOCILayerGzip,
+			annotations: map[string]string{
+				AnnotationEStargzTOCDigest:        validTOC,
+				AnnotationEStargzUncompressedSize: "-1",
+			},
+		},
+	} {
+		err := ValidateLayer(distribution.Descriptor{MediaType: testcase.mediaType}, testcase.annotations)
+		if testcase.valid && err != nil {
+			t.Fatalf("unexpected error validating %v: %v", testcase, err)
+		}
+		if !testcase.valid && err == nil {
+			t.Fatalf("expected error validating %v", testcase)
+		}
+	}
+}
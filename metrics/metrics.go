@@ -0,0 +1,340 @@
+// Package metrics provides counters, gauges and histograms exported in the
+// Prometheus text exposition format. The metrics registered with
+// DefaultRegistry are served at /metrics on the default http mux, alongside
+// /debug/vars, usually by the debug server of the registry.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a metric, or a family of labeled metrics, written to the
+// exposition by a Registry.
+type Collector interface {
+	// Name returns the name of the metric.
+	Name() string
+
+	// Write writes the metric in the text exposition format.
+	Write(w io.Writer) error
+}
+
+// Registry holds the collectors exported together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// DefaultRegistry is the registry served at /metrics.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// Register adds c to the registry. It panics if a collector is already
+// registered with the same name, as would registering an expvar twice.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("metrics: %s already registered", c.Name()))
+	}
+	r.collectors[c.Name()] = c
+}
+
+// Register adds c to the default registry.
+func Register(c Collector) {
+	DefaultRegistry.Register(c)
+}
+
+// Export writes the metrics of the registry to w in the text exposition
+// format, sorted by name.
+func (r *Registry) Export(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Sort(byName(collectors))
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		if err := c.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics of the registry.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Export(w)
+}
+
+type byName []Collector
+
+func (c byName) Len() int           { return len(c) }
+func (c byName) Less(i, j int) bool { return c[i].Name() < c[j].Name() }
+func (c byName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// DefBuckets are the upper bounds, in seconds, of the buckets of histograms
+// of latencies created without buckets.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// vec holds the series of a metric family by label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series holds the value, or the buckets, of a metric for a set of label
+// values.
+type series struct {
+	values []string
+
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+// get returns the series of the label values, creating it with n buckets if
+// needed. It must be called with the lock held.
+func (v *vec) get(values []string, n int) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			values:  append([]string(nil), values...),
+			buckets: make([]uint64, n),
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// write writes the header of the family and calls fn for each series, in
+// the order of their label values.
+func (v *vec) write(w io.Writer, fn func(s *series) error) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(v.series[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSample writes a sample of the family, extra holding a last label
+// name and value pair, if any.
+func (v *vec) writeSample(w io.Writer, suffix string, values []string, value float64, extra ...string) error {
+	var labels []string
+	for i, name := range v.labels {
+		labels = append(labels, name+"="+quoteLabel(values[i]))
+	}
+	if len(extra) == 2 {
+		labels = append(labels, extra[0]+"="+quoteLabel(extra[1]))
+	}
+
+	var set string
+	if len(labels) > 0 {
+		set = "{" + strings.Join(labels, ",") + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s%s%s %s\n", v.name, suffix, set, formatFloat(value))
+	return err
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec returns a counter family. The name of counters ends in
+// _total by convention.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+// Add adds delta, which must not be negative, to the counter of the label
+// values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(values, 0).value += delta
+}
+
+// Inc increments the counter of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Write implements Collector.
+func (c *CounterVec) Write(w io.Writer) error {
+	return c.write(w, func(s *series) error {
+		return c.writeSample(w, "", s.values, s.value)
+	})
+}
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec returns a gauge family.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+// Set sets the gauge of the label values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(values, 0).value = value
+}
+
+// Add adds delta to the gauge of the label values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(values, 0).value += delta
+}
+
+// Write implements Collector.
+func (g *GaugeVec) Write(w io.Writer) error {
+	return g.write(w, func(s *series) error {
+		return g.writeSample(w, "", s.values, s.value)
+	})
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	*vec
+	bounds []float64
+}
+
+// NewHistogramVec returns a histogram family counting observations in
+// buckets with the given upper bounds, DefBuckets if nil.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	return &HistogramVec{
+		vec:    newVec(name, help, "histogram", labels),
+		bounds: bounds,
+	}
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values, len(h.bounds))
+	if i := sort.SearchFloat64s(h.bounds, value); i < len(h.bounds) {
+		s.buckets[i]++
+	}
+	s.value += value
+	s.count++
+}
+
+// Write implements Collector. Buckets are written cumulatively, as the
+// exposition format requires.
+func (h *HistogramVec) Write(w io.Writer) error {
+	return h.write(w, func(s *series) error {
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += s.buckets[i]
+			if err := h.writeSample(w, "_bucket", s.values, float64(cumulative), "le", formatFloat(bound)); err != nil {
+				return err
+			}
+		}
+		if err := h.writeSample(w, "_bucket", s.values, float64(s.count), "le", "+Inf"); err != nil {
+			return err
+		}
+		if err := h.writeSample(w, "_sum", s.values, s.value); err != nil {
+			return err
+		}
+		return h.writeSample(w, "_count", s.values, float64(s.count))
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// quoteLabel quotes a label value, escaping backslashes, double quotes and
+// line feeds.
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func init() {
+	http.Handle("/metrics", DefaultRegistry)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := NewCounterVec("test_requests_total", "Requests handled.", "handler", "code")
+	requests.Inc("blob", "200")
+	requests.Add(2, "blob", "200")
+	requests.Inc("manifest\n\"latest\"", "404")
+	registry.Register(requests)
+
+	inflight := NewGaugeVec("test_inflight", "Requests in flight.\nNot counting \\ retries.")
+	inflight.Add(3)
+	inflight.Add(-1)
+	registry.Register(inflight)
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, .1}, "handler")
+	latency.Observe(.05, "blob")
+	latency.Observe(.5, "blob")
+	latency.Observe(2, "blob")
+	registry.Register(latency)
+
+	expected := `# HELP test_inflight Requests in flight.\nNot counting \\ retries.
+# TYPE test_inflight gauge
+test_inflight 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{handler="blob",le="0.1"} 1
+test_latency_seconds_bucket{handler="blob",le="1"} 2
+test_latency_seconds_bucket{handler="blob",le="+Inf"} 3
+test_latency_seconds_sum{handler="blob"} 2.55
+test_latency_seconds_count{handler="blob"} 3
+# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{handler="blob",code="200"} 3
+test_requests_total{handler="manifest\n\"latest\"",code="404"} 1
+`
+
+	var buf bytes.Buffer
+	if err := registry.Export(&buf); err != nil {
+		t.Fatalf("unexpected error writing metrics: %v", err)
+	}
+	if buf.String() != expected {
+		t.Fatalf("unexpected metrics:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, &http.Request{Method: "GET"})
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if recorder.Body.String() != expected {
+		t.Fatalf("unexpected metrics served:\n%s", recorder.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected registering a metric twice to panic")
+		}
+	}()
+	registry.Register(NewCounterVec("test_requests_total", "Requests handled."))
+}
@@ -85,6 +85,16 @@ func (b *bridge) BlobDeleted(repo reference.Named, desc distribution.Descriptor)
 	return b.createBlobEventAndWrite(EventActionDelete, repo, desc)
 }
 
+func (b *bridge) TagMoved(repo reference.Named, tag string, sm distribution.Manifest) error {
+	event, err := b.createManifestEvent(EventActionMove, repo, sm)
+	if err != nil {
+		return err
+	}
+	event.Target.Tag = tag
+
+	return b.sink.Write(*event)
+}
+
 func (b *bridge) createManifestEventAndWrite(action string, repo reference.Named, sm distribution.Manifest) error {
 	manifestEvent, err := b.createManifestEvent(action, repo, sm)
 	if err != nil {
@@ -114,6 +124,10 @@ func (b *bridge) createManifestEvent(action string, repo reference.Named, sm dis
 	event.Target.Size = desc.Size
 	event.Target.Digest = desc.Digest
 
+	if err := describeManifest(event, sm); err != nil {
+		return nil, err
+	}
+
 	ref, err := reference.WithDigest(repo, event.Target.Digest)
 	if err != nil {
 		return nil, err
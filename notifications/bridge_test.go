@@ -1,10 +1,12 @@
 package notifications
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/uuid"
@@ -22,7 +24,9 @@ var (
 	ub = mustUB(v2.NewURLBuilderFromString("http://test.example.com/"))
 
 	actor = ActorRecord{
-		Name: "test",
+		Name:   "test",
+		Issuer: "auth.example.com",
+		Claims: map[string]interface{}{"email": "test@example.com"},
 	}
 	request = RequestRecord{}
 	m       = schema1.Manifest{
@@ -74,6 +78,67 @@ func TestEventBridgeManifestDeleted(t *testing.T) {
 	}
 }
 
+func TestEventBridgeTagMoved(t *testing.T) {
+	l := createTestEnv(t, testSinkFn(func(events ...Event) error {
+		checkCommonManifest(t, EventActionMove, events...)
+		if events[0].Target.Tag != "latest" {
+			t.Fatalf("unexpected event tag: %q", events[0].Target.Tag)
+		}
+
+		return nil
+	}))
+
+	repoRef, _ := reference.ParseNamed(repo)
+	if err := l.TagMoved(repoRef, "latest", sm); err != nil {
+		t.Fatalf("unexpected error notifying tag move: %v", err)
+	}
+}
+
+func TestEventBridgeReferrerPushed(t *testing.T) {
+	var referrer schema2.DeserializedManifest
+	if err := referrer.UnmarshalJSON([]byte(`{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+   "artifactType": "application/spdx+json",
+   "config": {
+      "mediaType": "application/vnd.oci.empty.v1+json",
+      "size": 2,
+      "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+   },
+   "layers": [],
+   "subject": {
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "size": 528,
+      "digest": "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b"
+   },
+   "annotations": {
+      "org.opencontainers.image.created": "2006-01-02T15:04:05Z"
+   }
+}`)); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	l := NewBridge(ub, source, actor, request, testSinkFn(func(events ...Event) error {
+		target := events[0].Target
+		if target.ArtifactType != "application/spdx+json" {
+			t.Fatalf("unexpected artifact type: %q", target.ArtifactType)
+		}
+		if target.Annotations["org.opencontainers.image.created"] != "2006-01-02T15:04:05Z" {
+			t.Fatalf("unexpected annotations: %v", target.Annotations)
+		}
+		if target.Subject == nil || target.Subject.Digest != "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b" {
+			t.Fatalf("unexpected subject: %v", target.Subject)
+		}
+
+		return nil
+	}))
+
+	repoRef, _ := reference.ParseNamed(repo)
+	if err := l.ManifestPushed(repoRef, &referrer); err != nil {
+		t.Fatalf("unexpected error notifying manifest push: %v", err)
+	}
+}
+
 func createTestEnv(t *testing.T, fn testSinkFn) Listener {
 	pk, err := libtrust.GenerateECP256PrivateKey()
 	if err != nil {
@@ -126,7 +191,7 @@ func checkCommon(t *testing.T, events ...Event) {
 		t.Fatalf("request not equal: %#v != %#v", event.Request, request)
 	}
 
-	if event.Actor != actor {
+	if !reflect.DeepEqual(event.Actor, actor) {
 		t.Fatalf("request not equal: %#v != %#v", event.Actor, actor)
 	}
 
@@ -12,6 +12,10 @@ type EndpointConfig struct {
 	Timeout   time.Duration
 	Threshold int
 	Backoff   time.Duration
+
+	// Envelope is the version of the envelope events are sent in,
+	// EnvelopeVersion1 by default.
+	Envelope string
 }
 
 // defaults set any zero-valued fields to a reasonable default.
@@ -27,6 +31,10 @@ func (ec *EndpointConfig) defaults() {
 	if ec.Backoff <= 0 {
 		ec.Backoff = time.Second
 	}
+
+	if ec.Envelope == "" {
+		ec.Envelope = EnvelopeVersion1
+	}
 }
 
 // Endpoint is a reliable, queued, thread-safe sink that notify external http
@@ -49,13 +57,14 @@ func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
 	endpoint.url = url
 	endpoint.EndpointConfig = config
 	endpoint.defaults()
-	endpoint.metrics = newSafeMetrics()
+	endpoint.metrics = newSafeMetrics(name)
 
 	// Configures the inmemory queue, retry, http pipeline.
 	endpoint.Sink = newHTTPSink(
-		endpoint.url, endpoint.Timeout, endpoint.Headers,
+		endpoint.url, endpoint.Timeout, endpoint.Headers, endpoint.Envelope,
 		endpoint.metrics.httpStatusListener())
-	endpoint.Sink = newRetryingSink(endpoint.Sink, endpoint.Threshold, endpoint.Backoff)
+	endpoint.Sink = newRetryingSink(endpoint.Sink, endpoint.Threshold, endpoint.Backoff,
+		endpoint.metrics.retryingSinkListener())
 	endpoint.Sink = newEventQueue(endpoint.Sink, endpoint.metrics.eventQueueListener())
 
 	register(&endpoint)
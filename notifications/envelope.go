@@ -0,0 +1,215 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+)
+
+// Envelope versions endpoints can be configured to receive.
+const (
+	// EnvelopeVersion1 is the version of Envelope, sent by default.
+	EnvelopeVersion1 = "v1"
+
+	// EnvelopeVersion3 is the version of EnvelopeV3.
+	EnvelopeVersion3 = "v3"
+)
+
+// ValidEnvelope returns an error if version is not an envelope version
+// endpoints can receive. The empty version is the default version.
+func ValidEnvelope(version string) error {
+	switch version {
+	case "", EnvelopeVersion1, EnvelopeVersion3:
+		return nil
+	}
+	return fmt.Errorf("unknown event envelope version %q", version)
+}
+
+// EnvelopeV3 is version 3 of the json event envelope, for consumers needing
+// more context than Envelope provides: the OCI descriptors of targets, the
+// subject of referrers, whether the actor was authenticated and the id of the
+// request at the top level of events.
+type EnvelopeV3 struct {
+	// Events make up the contents of the envelope. Events present in a single
+	// envelope are not necessarily related.
+	Events []EventV3 `json:"events,omitempty"`
+}
+
+// EventV3 is the representation of an event in a version 3 envelope.
+type EventV3 struct {
+	// ID provides a unique identifier for the event.
+	ID string `json:"id"`
+
+	// Timestamp is the time at which the event occurred.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Action indicates what action encompasses the provided event.
+	Action string `json:"action"`
+
+	// RequestID identifies the request that generated the event, empty for
+	// events not generated by a request, such as the moves of tags found by
+	// the pull through cache.
+	RequestID string `json:"requestID,omitempty"`
+
+	// Target uniquely describes the target of the event.
+	Target TargetRecordV3 `json:"target"`
+
+	// Request covers the request that generated the event.
+	Request RequestRecord `json:"request"`
+
+	// Actor specifies the agent that initiated the event.
+	Actor ActorRecordV3 `json:"actor"`
+
+	// Source identifies the registry node that generated the event.
+	Source SourceRecord `json:"source"`
+}
+
+// TargetRecordV3 describes the target of an event in a version 3 envelope.
+type TargetRecordV3 struct {
+	// Descriptor is the OCI descriptor of the content.
+	Descriptor DescriptorV3 `json:"descriptor"`
+
+	// Subject is the descriptor of the manifest the target refers to, for
+	// referrers such as signatures and SBOMs.
+	Subject *DescriptorV3 `json:"subject,omitempty"`
+
+	// Repository identifies the named repository.
+	Repository string `json:"repository"`
+
+	// Tag is the tag of the manifest, for the events of tags.
+	Tag string `json:"tag,omitempty"`
+
+	// FromRepository identifies the named repository which a blob was mounted
+	// from if appropriate.
+	FromRepository string `json:"fromRepository,omitempty"`
+
+	// URL provides a direct link to the content.
+	URL string `json:"url,omitempty"`
+}
+
+// DescriptorV3 is an OCI content descriptor.
+type DescriptorV3 struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ActorRecordV3 specifies the agent that initiated an event in a version 3
+// envelope.
+type ActorRecordV3 struct {
+	// Name corresponds to the subject or username associated with the
+	// request context that generated the event.
+	Name string `json:"name,omitempty"`
+
+	// Authenticated is true if the access controller authenticated the
+	// actor, false if the name was only taken from the credentials of the
+	// request.
+	Authenticated bool `json:"authenticated"`
+
+	// Issuer is the issuer of the token the actor authenticated with, if
+	// any.
+	Issuer string `json:"issuer,omitempty"`
+
+	// Claims holds the claims of the token the actor authenticated with
+	// which the registry is configured to include in events.
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// newEventV3 returns the version 3 representation of event.
+func newEventV3(event Event) EventV3 {
+	v3 := EventV3{
+		ID:        event.ID,
+		Timestamp: event.Timestamp,
+		Action:    event.Action,
+		RequestID: event.Request.ID,
+		Request:   event.Request,
+		Actor: ActorRecordV3{
+			Name:          event.Actor.Name,
+			Authenticated: event.Actor.Authenticated,
+			Issuer:        event.Actor.Issuer,
+			Claims:        event.Actor.Claims,
+		},
+		Source: event.Source,
+	}
+
+	v3.Target.Descriptor = DescriptorV3{
+		MediaType:    event.Target.MediaType,
+		Digest:       event.Target.Digest,
+		Size:         event.Target.Size,
+		ArtifactType: event.Target.ArtifactType,
+		Annotations:  event.Target.Annotations,
+	}
+	if event.Target.Subject != nil {
+		v3.Target.Subject = &DescriptorV3{
+			MediaType: event.Target.Subject.MediaType,
+			Digest:    event.Target.Subject.Digest,
+			Size:      event.Target.Subject.Size,
+		}
+	}
+	v3.Target.Repository = event.Target.Repository
+	v3.Target.Tag = event.Target.Tag
+	v3.Target.FromRepository = event.Target.FromRepository
+	v3.Target.URL = event.Target.URL
+
+	return v3
+}
+
+// marshalEnvelope returns the media type and the content of the envelope of
+// the given version holding events.
+func marshalEnvelope(version string, events []Event) (string, []byte, error) {
+	if version == EnvelopeVersion3 {
+		envelope := EnvelopeV3{
+			Events: make([]EventV3, len(events)),
+		}
+		for i, event := range events {
+			envelope.Events[i] = newEventV3(event)
+		}
+
+		p, err := json.MarshalIndent(envelope, "", "   ")
+		return EventsMediaTypeV3, p, err
+	}
+
+	p, err := json.MarshalIndent(Envelope{Events: events}, "", "   ")
+	return EventsMediaType, p, err
+}
+
+// describeManifest sets the artifact type, annotations and subject of the
+// target of event from the manifest, for the manifests providing them.
+func describeManifest(event *Event, sm distribution.Manifest) error {
+	if m, ok := sm.(interface {
+		ArtifactType() (string, error)
+	}); ok {
+		artifactType, err := m.ArtifactType()
+		if err != nil {
+			return err
+		}
+		event.Target.ArtifactType = artifactType
+	}
+
+	if m, ok := sm.(interface {
+		Annotations() (map[string]string, error)
+	}); ok {
+		annotations, err := m.Annotations()
+		if err != nil {
+			return err
+		}
+		event.Target.Annotations = annotations
+	}
+
+	if m, ok := sm.(interface {
+		Subject() (*distribution.Descriptor, error)
+	}); ok {
+		subject, err := m.Subject()
+		if err != nil {
+			return err
+		}
+		event.Target.Subject = subject
+	}
+
+	return nil
+}
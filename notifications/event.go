@@ -13,6 +13,10 @@ const (
 	EventActionPush   = "push"
 	EventActionMount  = "mount"
 	EventActionDelete = "delete"
+
+	// EventActionMove is the action of the events of the tags of a pull
+	// through cache found pointing at another manifest on the remote.
+	EventActionMove = "move"
 )
 
 const (
@@ -20,6 +24,10 @@ const (
 	// Event, ActorRecord, SourceRecord or Envelope structs change, the version
 	// number should be incremented.
 	EventsMediaType = "application/vnd.docker.distribution.events.v1+json"
+
+	// EventsMediaTypeV3 is the mediatype for version 3 of the json event
+	// envelope, sent to the endpoints configured for it. See EnvelopeV3.
+	EventsMediaTypeV3 = "application/vnd.docker.distribution.events.v3+json"
 	// LayerMediaType is the media type for image rootfs diffs (aka "layers")
 	// used by Docker. We don't expect this to change for quite a while.
 	layerMediaType = "application/vnd.docker.container.image.rootfs.diff+x-gtar"
@@ -62,12 +70,22 @@ type Event struct {
 		// Repository identifies the named repository.
 		Repository string `json:"repository,omitempty"`
 
+		// Tag is the tag of the manifest, for the events of tags.
+		Tag string `json:"tag,omitempty"`
+
 		// FromRepository identifies the named repository which a blob was mounted
 		// from if appropriate.
 		FromRepository string `json:"fromRepository,omitempty"`
 
 		// URL provides a direct link to the content.
 		URL string `json:"url,omitempty"`
+
+		// ArtifactType and Annotations further describe manifests, and
+		// Subject the manifest a referrer such as a signature refers to.
+		// They are only sent in version 3 envelopes.
+		ArtifactType string                   `json:"-"`
+		Annotations  map[string]string        `json:"-"`
+		Subject      *distribution.Descriptor `json:"-"`
 	} `json:"target,omitempty"`
 
 	// Request covers the request that generated the event.
@@ -92,6 +110,19 @@ type ActorRecord struct {
 	// request context that generated the event.
 	Name string `json:"name,omitempty"`
 
+	// Issuer is the issuer of the token the actor authenticated with, if
+	// any.
+	Issuer string `json:"issuer,omitempty"`
+
+	// Claims holds the claims of the token the actor authenticated with
+	// which the registry is configured to include in events.
+	Claims map[string]interface{} `json:"claims,omitempty"`
+
+	// Authenticated is true if the actor was authenticated by the access
+	// controller, rather than named by the credentials of the request
+	// alone. It is only sent in version 3 envelopes.
+	Authenticated bool `json:"-"`
+
 	// TODO(stevvooe): Look into setting a session cookie to get this
 	// without docker daemon.
 	//    SessionID
@@ -6,7 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
 )
 
 // TestEventJSONFormat provides silly test to detect if the event format or
@@ -155,3 +157,112 @@ func TestEventEnvelopeJSONFormat(t *testing.T) {
 		t.Fatalf("format has changed\n%s\n != \n%s", string(p), expected)
 	}
 }
+
+// TestEventEnvelopeV3JSONFormat detects changes to the format of version 3
+// envelopes, and checks that their additional fields are left out of the
+// default envelope.
+func TestEventEnvelopeV3JSONFormat(t *testing.T) {
+	var expected = strings.TrimSpace(`
+{
+   "events": [
+      {
+         "id": "asdf-asdf-asdf-asdf-0",
+         "timestamp": "2006-01-02T15:04:05Z",
+         "action": "push",
+         "requestID": "asdfasdf",
+         "target": {
+            "descriptor": {
+               "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+               "digest": "sha256:0123456789abcdef0",
+               "size": 1,
+               "artifactType": "application/spdx+json",
+               "annotations": {
+                  "org.opencontainers.image.created": "2006-01-02T15:04:05Z"
+               }
+            },
+            "subject": {
+               "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+               "digest": "sha256:0123456789abcdef1",
+               "size": 2
+            },
+            "repository": "library/test",
+            "tag": "sbom",
+            "url": "http://example.com/v2/library/test/manifests/sbom"
+         },
+         "request": {
+            "id": "asdfasdf",
+            "addr": "client.local",
+            "host": "registrycluster.local",
+            "method": "PUT",
+            "useragent": "test/0.1"
+         },
+         "actor": {
+            "name": "test-actor",
+            "authenticated": true,
+            "issuer": "auth.example.com"
+         },
+         "source": {
+            "addr": "hostname.local:port"
+         }
+      }
+   ]
+}
+	`)
+
+	tm, err := time.Parse(time.RFC3339, time.RFC3339[:len(time.RFC3339)-5])
+	if err != nil {
+		t.Fatalf("error creating time: %v", err)
+	}
+
+	var referrerPush Event
+	referrerPush.ID = "asdf-asdf-asdf-asdf-0"
+	referrerPush.Action = EventActionPush
+	referrerPush.Timestamp = tm
+	referrerPush.Actor.Name = "test-actor"
+	referrerPush.Actor.Issuer = "auth.example.com"
+	referrerPush.Actor.Authenticated = true
+	referrerPush.Request.ID = "asdfasdf"
+	referrerPush.Request.Addr = "client.local"
+	referrerPush.Request.Host = "registrycluster.local"
+	referrerPush.Request.Method = "PUT"
+	referrerPush.Request.UserAgent = "test/0.1"
+	referrerPush.Source.Addr = "hostname.local:port"
+	referrerPush.Target.Digest = "sha256:0123456789abcdef0"
+	referrerPush.Target.Length = 1
+	referrerPush.Target.Size = 1
+	referrerPush.Target.MediaType = schema2.MediaTypeManifest
+	referrerPush.Target.Repository = "library/test"
+	referrerPush.Target.Tag = "sbom"
+	referrerPush.Target.URL = "http://example.com/v2/library/test/manifests/sbom"
+	referrerPush.Target.ArtifactType = "application/spdx+json"
+	referrerPush.Target.Annotations = map[string]string{"org.opencontainers.image.created": "2006-01-02T15:04:05Z"}
+	referrerPush.Target.Subject = &distribution.Descriptor{
+		MediaType: schema2.MediaTypeManifest,
+		Digest:    "sha256:0123456789abcdef1",
+		Size:      2,
+	}
+
+	mediaType, p, err := marshalEnvelope(EnvelopeVersion3, []Event{referrerPush})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling envelope: %v", err)
+	}
+	if mediaType != EventsMediaTypeV3 {
+		t.Fatalf("unexpected media type: %q != %q", mediaType, EventsMediaTypeV3)
+	}
+	if string(p) != expected {
+		t.Fatalf("format has changed\n%s\n != \n%s", string(p), expected)
+	}
+
+	mediaType, p, err = marshalEnvelope(EnvelopeVersion1, []Event{referrerPush})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling envelope: %v", err)
+	}
+	if mediaType != EventsMediaType {
+		t.Fatalf("unexpected media type: %q != %q", mediaType, EventsMediaType)
+	}
+	for _, field := range []string{"artifactType", "annotations", "subject", "authenticated"} {
+		if strings.Contains(string(p), field) {
+			t.Fatalf("unexpected %s field in envelope:\n%s", field, string(p))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+)
+
+// History is a sink retaining the most recent events in memory, allowing
+// them to be replayed to endpoints, for example after an endpoint outage
+// outlasted its retries.
+type History struct {
+	mu     sync.Mutex
+	events []Event // ring buffer of retained events
+	next   int     // index of the next write in events
+	full   bool    // events has wrapped around
+	closed bool
+}
+
+// NewHistory returns a History retaining up to size events.
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+
+	return &History{
+		events: make([]Event, size),
+	}
+}
+
+// Write records the events, discarding the oldest retained events when the
+// history is full.
+func (h *History) Write(events ...Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrSinkClosed
+	}
+
+	for _, event := range events {
+		h.events[h.next] = event
+		h.next = (h.next + 1) % len(h.events)
+		if h.next == 0 {
+			h.full = true
+		}
+	}
+
+	return nil
+}
+
+// Close the history. Retained events remain available.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	return nil
+}
+
+// Since returns the retained events with a timestamp after t, oldest first.
+func (h *History) Since(t time.Time) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var ordered []Event
+	if h.full {
+		ordered = append(ordered, h.events[h.next:]...)
+	}
+	ordered = append(ordered, h.events[:h.next]...)
+
+	var events []Event
+	for _, event := range ordered {
+		if event.Timestamp.After(t) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,51 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	history := NewHistory(3)
+	start := time.Now()
+
+	var events []Event
+	for i := 0; i < 5; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		event.Timestamp = start.Add(time.Duration(i) * time.Second)
+		events = append(events, event)
+	}
+
+	if err := history.Write(events[:2]...); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+
+	if retained := history.Since(time.Time{}); len(retained) != 2 || retained[0].ID != events[0].ID {
+		t.Fatalf("unexpected retained events: %v", retained)
+	}
+
+	if err := history.Write(events[2:]...); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+
+	// Only the last three events are retained, oldest first.
+	retained := history.Since(time.Time{})
+	if len(retained) != 3 {
+		t.Fatalf("unexpected number of retained events: %d != 3", len(retained))
+	}
+
+	for i, event := range retained {
+		if event.ID != events[i+2].ID {
+			t.Fatalf("unexpected event at %d: %v != %v", i, event.ID, events[i+2].ID)
+		}
+	}
+
+	if since := history.Since(events[3].Timestamp); len(since) != 1 || since[0].ID != events[4].ID {
+		t.Fatalf("unexpected events since %v: %v", events[3].Timestamp, since)
+	}
+
+	history.Close()
+	if err := history.Write(events[0]); err != ErrSinkClosed {
+		t.Fatalf("expected ErrSinkClosed, got %v", err)
+	}
+}
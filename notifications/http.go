@@ -2,7 +2,6 @@ package notifications
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
@@ -20,16 +19,18 @@ type httpSink struct {
 	client    *http.Client
 	listeners []httpStatusListener
 
-	// TODO(stevvooe): Allow one to configure the media type accepted by this
-	// sink and choose the serialization based on that.
+	// envelope is the version of the envelope the events are sent in.
+	envelope string
 }
 
-// newHTTPSink returns an unreliable, single-flight http sink. Wrap in other
-// sinks for increased reliability.
-func newHTTPSink(u string, timeout time.Duration, headers http.Header, listeners ...httpStatusListener) *httpSink {
+// newHTTPSink returns an unreliable, single-flight http sink, sending events
+// in envelopes of the given version. Wrap in other sinks for increased
+// reliability.
+func newHTTPSink(u string, timeout time.Duration, headers http.Header, envelope string, listeners ...httpStatusListener) *httpSink {
 	return &httpSink{
 		url:       u,
 		listeners: listeners,
+		envelope:  envelope,
 		client: &http.Client{
 			Transport: &headerRoundTripper{
 				Transport: http.DefaultTransport.(*http.Transport),
@@ -59,15 +60,11 @@ func (hs *httpSink) Write(events ...Event) error {
 		return ErrSinkClosed
 	}
 
-	envelope := Envelope{
-		Events: events,
-	}
-
 	// TODO(stevvooe): It is not ideal to keep re-encoding the request body on
 	// retry but we are going to do it to keep the code simple. It is likely
 	// we could change the event struct to manage its own buffer.
 
-	p, err := json.MarshalIndent(envelope, "", "   ")
+	mediaType, p, err := marshalEnvelope(hs.envelope, events)
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, events...)
@@ -76,7 +73,7 @@ func (hs *httpSink) Write(events ...Event) error {
 	}
 
 	body := bytes.NewReader(p)
-	resp, err := hs.client.Post(hs.url, EventsMediaType, body)
+	resp, err := hs.client.Post(hs.url, mediaType, body)
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, events...)
@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"mime"
@@ -8,9 +9,11 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/docker/distribution/manifest/schema1"
+	prometheus "github.com/docker/distribution/metrics"
 )
 
 // TestHTTPSink mocks out an http endpoint and notifies it under a couple of
@@ -59,8 +62,8 @@ func TestHTTPSink(t *testing.T) {
 		w.WriteHeader(status)
 	}))
 
-	metrics := newSafeMetrics()
-	sink := newHTTPSink(server.URL, 0, nil,
+	metrics := newSafeMetrics("httpsink")
+	sink := newHTTPSink(server.URL, 0, nil, EnvelopeVersion1,
 		&endpointMetricsHTTPStatusListener{safeMetrics: metrics})
 
 	var expectedMetrics EndpointMetrics
@@ -136,6 +139,20 @@ func TestHTTPSink(t *testing.T) {
 		}
 	}
 
+	var exposition bytes.Buffer
+	if err := prometheus.DefaultRegistry.Export(&exposition); err != nil {
+		t.Fatalf("unexpected error writing metrics: %v", err)
+	}
+	for _, sample := range []string{
+		`registry_notifications_successes_total{endpoint="httpsink"} 4`,
+		`registry_notifications_status_total{endpoint="httpsink",code="200"} 4`,
+		`registry_notifications_delivery_latency_seconds_count{endpoint="httpsink"} 4`,
+	} {
+		if !strings.Contains(exposition.String(), sample+"\n") {
+			t.Fatalf("sample %q missing from metrics:\n%s", sample, exposition.String())
+		}
+	}
+
 	if err := sink.Close(); err != nil {
 		t.Fatalf("unexpected error closing http sink: %v", err)
 	}
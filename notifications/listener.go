@@ -33,10 +33,18 @@ type BlobListener interface {
 	BlobDeleted(repo reference.Named, desc distribution.Descriptor) error
 }
 
+// TagListener describes a listener that can respond to tag related events.
+type TagListener interface {
+	// TagMoved is called when a tag of a pull through cache is found
+	// pointing at another manifest on the remote, with that manifest.
+	TagMoved(repo reference.Named, tag string, sm distribution.Manifest) error
+}
+
 // Listener combines all repository events into a single interface.
 type Listener interface {
 	ManifestListener
 	BlobListener
+	TagListener
 }
 
 type repositoryListener struct {
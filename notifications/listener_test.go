@@ -93,6 +93,11 @@ func (tl *testListener) BlobDeleted(repo reference.Named, desc distribution.Desc
 	return nil
 }
 
+func (tl *testListener) TagMoved(repo reference.Named, tag string, m distribution.Manifest) error {
+	tl.ops["tag:move"]++
+	return nil
+}
+
 // checkExerciseRegistry takes the registry through all of its operations,
 // carrying out generic checks.
 func checkExerciseRepository(t *testing.T, repository distribution.Repository) {
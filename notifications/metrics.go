@@ -4,7 +4,11 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/docker/distribution/metrics"
 )
 
 // EndpointMetrics track various actions taken by the endpoint, typically by
@@ -16,20 +20,26 @@ type EndpointMetrics struct {
 	Successes int            // total events written successfully
 	Failures  int            // total events failed
 	Errors    int            // total events errored
+	Retries   int            // total events retried
 	Statuses  map[string]int // status code histogram, per call event
 }
 
 // safeMetrics guards the metrics implementation with a lock and provides a
-// safe update function.
+// safe update function. Updates are also exported to Prometheus, labeled
+// with the name of the endpoint.
 type safeMetrics struct {
 	EndpointMetrics
 	sync.Mutex // protects statuses map
+
+	name string
 }
 
-// newSafeMetrics returns safeMetrics with map allocated.
-func newSafeMetrics() *safeMetrics {
+// newSafeMetrics returns safeMetrics with map allocated, for the named
+// endpoint.
+func newSafeMetrics(name string) *safeMetrics {
 	var sm safeMetrics
 	sm.Statuses = make(map[string]int)
+	sm.name = name
 	return &sm
 }
 
@@ -48,6 +58,13 @@ func (sm *safeMetrics) eventQueueListener() eventQueueListener {
 	}
 }
 
+// retryingSinkListener returns a listener counting the events retried.
+func (sm *safeMetrics) retryingSinkListener() retryingSinkListener {
+	return &endpointMetricsRetryingSinkListener{
+		safeMetrics: sm,
+	}
+}
+
 // endpointMetricsHTTPStatusListener increments counters related to http sinks
 // for the relevent events.
 type endpointMetricsHTTPStatusListener struct {
@@ -61,6 +78,14 @@ func (emsl *endpointMetricsHTTPStatusListener) success(status int, events ...Eve
 	defer emsl.safeMetrics.Unlock()
 	emsl.Statuses[fmt.Sprintf("%d %s", status, http.StatusText(status))] += len(events)
 	emsl.Successes += len(events)
+
+	statusCounter.Add(float64(len(events)), emsl.name, strconv.Itoa(status))
+	successesCounter.Add(float64(len(events)), emsl.name)
+	for _, event := range events {
+		if !event.Timestamp.IsZero() {
+			latencyHistogram.Observe(time.Since(event.Timestamp).Seconds(), emsl.name)
+		}
+	}
 }
 
 func (emsl *endpointMetricsHTTPStatusListener) failure(status int, events ...Event) {
@@ -68,12 +93,33 @@ func (emsl *endpointMetricsHTTPStatusListener) failure(status int, events ...Eve
 	defer emsl.safeMetrics.Unlock()
 	emsl.Statuses[fmt.Sprintf("%d %s", status, http.StatusText(status))] += len(events)
 	emsl.Failures += len(events)
+
+	statusCounter.Add(float64(len(events)), emsl.name, strconv.Itoa(status))
+	failuresCounter.Add(float64(len(events)), emsl.name)
 }
 
 func (emsl *endpointMetricsHTTPStatusListener) err(err error, events ...Event) {
 	emsl.safeMetrics.Lock()
 	defer emsl.safeMetrics.Unlock()
 	emsl.Errors += len(events)
+
+	errorsCounter.Add(float64(len(events)), emsl.name)
+}
+
+// endpointMetricsRetryingSinkListener counts the events retried by the
+// retrying sink.
+type endpointMetricsRetryingSinkListener struct {
+	*safeMetrics
+}
+
+var _ retryingSinkListener = &endpointMetricsRetryingSinkListener{}
+
+func (emrl *endpointMetricsRetryingSinkListener) retry(events ...Event) {
+	emrl.safeMetrics.Lock()
+	defer emrl.safeMetrics.Unlock()
+	emrl.Retries += len(events)
+
+	retriesCounter.Add(float64(len(events)), emrl.name)
 }
 
 // endpointMetricsEventQueueListener maintains the incoming events counter and
@@ -87,14 +133,52 @@ func (eqc *endpointMetricsEventQueueListener) ingress(events ...Event) {
 	defer eqc.Unlock()
 	eqc.Events += len(events)
 	eqc.Pending += len(events)
+
+	eventsCounter.Add(float64(len(events)), eqc.name)
+	pendingGauge.Add(float64(len(events)), eqc.name)
 }
 
 func (eqc *endpointMetricsEventQueueListener) egress(events ...Event) {
 	eqc.Lock()
 	defer eqc.Unlock()
 	eqc.Pending -= len(events)
+
+	pendingGauge.Add(-float64(len(events)), eqc.name)
 }
 
+// Prometheus metrics of the endpoints, served at /metrics by the debug
+// server along with the expvars.
+var (
+	eventsCounter = metrics.NewCounterVec(
+		"registry_notifications_events_total",
+		"Events received by the notification endpoint.", "endpoint")
+	pendingGauge = metrics.NewGaugeVec(
+		"registry_notifications_pending_events",
+		"Events queued by the notification endpoint, pending delivery.", "endpoint")
+	successesCounter = metrics.NewCounterVec(
+		"registry_notifications_successes_total",
+		"Events delivered to the notification endpoint.", "endpoint")
+	failuresCounter = metrics.NewCounterVec(
+		"registry_notifications_failures_total",
+		"Events rejected by the notification endpoint with a status other than 2xx.", "endpoint")
+	errorsCounter = metrics.NewCounterVec(
+		"registry_notifications_errors_total",
+		"Events which could not be sent to the notification endpoint.", "endpoint")
+	retriesCounter = metrics.NewCounterVec(
+		"registry_notifications_retries_total",
+		"Events retried after failing to be delivered to the notification endpoint.", "endpoint")
+	statusCounter = metrics.NewCounterVec(
+		"registry_notifications_status_total",
+		"Events sent to the notification endpoint, by status of the response.", "endpoint", "code")
+
+	// latencyHistogram measures the time from the occurrence of events to
+	// their delivery, including the time spent queued and retrying.
+	latencyHistogram = metrics.NewHistogramVec(
+		"registry_notifications_delivery_latency_seconds",
+		"Time from the occurrence of events to their delivery to the notification endpoint.",
+		[]float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}, "endpoint")
+)
+
 // endpoints is global registry of endpoints used to report metrics to expvar
 var endpoints struct {
 	registered []*Endpoint
@@ -149,4 +233,11 @@ func init() {
 	}))
 
 	registry.(*expvar.Map).Set("notifications", &notifications)
+
+	for _, c := range []metrics.Collector{
+		eventsCounter, pendingGauge, successesCounter, failuresCounter,
+		errorsCounter, retriesCounter, statusCounter, latencyHistogram,
+	} {
+		metrics.Register(c)
+	}
 }
@@ -216,9 +216,10 @@ func (eq *eventQueue) next() []Event {
 // Concurrent calls to a retrying sink are serialized through the sink,
 // meaning that if one is in-flight, another will not proceed.
 type retryingSink struct {
-	mu     sync.Mutex
-	sink   Sink
-	closed bool
+	mu        sync.Mutex
+	sink      Sink
+	closed    bool
+	listeners []retryingSinkListener
 
 	// circuit breaker heuristics
 	failures struct {
@@ -230,7 +231,8 @@ type retryingSink struct {
 }
 
 type retryingSinkListener interface {
-	active(events ...Event)
+	// retry is called with events which failed to be written, before
+	// they are retried.
 	retry(events ...Event)
 }
 
@@ -240,10 +242,11 @@ type retryingSinkListener interface {
 
 // newRetryingSink returns a sink that will retry writes to a sink, backing
 // off on failure. Parameters threshold and backoff adjust the behavior of the
-// circuit breaker.
-func newRetryingSink(sink Sink, threshold int, backoff time.Duration) *retryingSink {
+// circuit breaker. Listeners are notified of the events retried.
+func newRetryingSink(sink Sink, threshold int, backoff time.Duration, listeners ...retryingSinkListener) *retryingSink {
 	rs := &retryingSink{
-		sink: sink,
+		sink:      sink,
+		listeners: listeners,
 	}
 	rs.failures.threshold = threshold
 	rs.failures.backoff = backoff
@@ -276,6 +279,9 @@ retry:
 		}
 
 		logrus.Errorf("retryingsink: error writing events: %v, retrying", err)
+		for _, listener := range rs.listeners {
+			listener.retry(events...)
+		}
 		goto retry
 	}
 
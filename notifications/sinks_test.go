@@ -62,7 +62,7 @@ func TestBroadcaster(t *testing.T) {
 func TestEventQueue(t *testing.T) {
 	const nevents = 1000
 	var ts testSink
-	metrics := newSafeMetrics()
+	metrics := newSafeMetrics("")
 	eq := newEventQueue(
 		// delayed sync simulates destination slower than channel comms
 		&delayedSink{
@@ -121,7 +121,8 @@ func TestRetryingSink(t *testing.T) {
 		rate: 1.0, // start out always failing.
 		Sink: &ts,
 	}
-	s := newRetryingSink(flaky, 3, 10*time.Millisecond)
+	metrics := newSafeMetrics("")
+	s := newRetryingSink(flaky, 3, 10*time.Millisecond, metrics.retryingSinkListener())
 
 	var wg sync.WaitGroup
 	var block []Event
@@ -157,6 +158,11 @@ func TestRetryingSink(t *testing.T) {
 	if len(ts.events) != 100 {
 		t.Fatalf("events not propagated: %d != %d", len(ts.events), 100)
 	}
+
+	// The sink always fails at first, so events must have been retried.
+	if metrics.Retries == 0 {
+		t.Fatalf("retried events not counted")
+	}
 }
 
 type testSink struct {
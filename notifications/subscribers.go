@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"sync"
+)
+
+// Subscribers is a sink dispatching events to subscriptions, such as the
+// clients watching the event stream of the admin API. Each subscription
+// buffers the events it was not read yet. Events are dropped for a
+// subscription whose buffer is full, so that a slow subscriber never blocks
+// the sinks written after it.
+type Subscribers struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	buffer        int
+	closed        bool
+}
+
+// NewSubscribers returns a Subscribers buffering up to buffer events per
+// subscription.
+func NewSubscribers(buffer int) *Subscribers {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	return &Subscribers{
+		subscriptions: make(map[*Subscription]struct{}),
+		buffer:        buffer,
+	}
+}
+
+// Subscribe returns a subscription receiving the events written from now on
+// which match filter, or all of them if filter is nil. The subscription must
+// be closed once done.
+func (s *Subscribers) Subscribe(filter func(event Event) bool) *Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := &Subscription{
+		subscribers: s,
+		filter:      filter,
+		events:      make(chan Event, s.buffer),
+	}
+	if s.closed {
+		close(sub.events)
+		return sub
+	}
+
+	s.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Write dispatches the events to the subscriptions they match.
+func (s *Subscribers) Write(events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSinkClosed
+	}
+
+	for sub := range s.subscriptions {
+		for _, event := range events {
+			if sub.filter != nil && !sub.filter(event) {
+				continue
+			}
+
+			select {
+			case sub.events <- event:
+			default:
+				sub.dropped++
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close closes the subscriptions.
+func (s *Subscribers) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for sub := range s.subscriptions {
+		close(sub.events)
+		delete(s.subscriptions, sub)
+	}
+
+	return nil
+}
+
+// Subscription receives the events written to Subscribers.
+type Subscription struct {
+	subscribers *Subscribers
+	filter      func(event Event) bool
+	events      chan Event
+	dropped     int
+}
+
+// Events returns the channel the events of the subscription are received
+// from, which is closed once the subscription or the Subscribers is closed.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+// Dropped returns the number of events dropped so far since the buffer of the
+// subscription was full.
+func (sub *Subscription) Dropped() int {
+	sub.subscribers.mu.Lock()
+	defer sub.subscribers.mu.Unlock()
+
+	return sub.dropped
+}
+
+// Close ends the subscription.
+func (sub *Subscription) Close() {
+	s := sub.subscribers
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[sub]; ok {
+		close(sub.events)
+		delete(s.subscriptions, sub)
+	}
+}
@@ -0,0 +1,65 @@
+package notifications
+
+import (
+	"testing"
+)
+
+func TestSubscribers(t *testing.T) {
+	subscribers := NewSubscribers(2)
+
+	all := subscribers.Subscribe(nil)
+	filtered := subscribers.Subscribe(func(event Event) bool {
+		return event.Target.Repository == "library/test"
+	})
+
+	events := []Event{
+		createTestEvent("push", "library/test", "blob"),
+		createTestEvent("push", "library/other", "blob"),
+		createTestEvent("pull", "library/test", "manifest"),
+	}
+	if err := subscribers.Write(events...); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+
+	// The buffer of the first subscription only holds two events.
+	for _, expected := range events[:2] {
+		if event := <-all.Events(); event.ID != expected.ID {
+			t.Fatalf("unexpected event: %v != %v", event.ID, expected.ID)
+		}
+	}
+	if dropped := all.Dropped(); dropped != 1 {
+		t.Fatalf("unexpected number of dropped events: %d != 1", dropped)
+	}
+
+	for _, expected := range []Event{events[0], events[2]} {
+		if event := <-filtered.Events(); event.ID != expected.ID {
+			t.Fatalf("unexpected filtered event: %v != %v", event.ID, expected.ID)
+		}
+	}
+	if dropped := filtered.Dropped(); dropped != 0 {
+		t.Fatalf("unexpected number of dropped filtered events: %d != 0", dropped)
+	}
+
+	// Closed subscriptions no longer receive events.
+	filtered.Close()
+	if _, ok := <-filtered.Events(); ok {
+		t.Fatalf("expected closed subscription")
+	}
+	if err := subscribers.Write(events[0]); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+	if event := <-all.Events(); event.ID != events[0].ID {
+		t.Fatalf("unexpected event: %v != %v", event.ID, events[0].ID)
+	}
+
+	subscribers.Close()
+	if _, ok := <-all.Events(); ok {
+		t.Fatalf("expected subscription closed with the sink")
+	}
+	if err := subscribers.Write(events[0]); err != ErrSinkClosed {
+		t.Fatalf("expected ErrSinkClosed, got %v", err)
+	}
+	if _, ok := <-subscribers.Subscribe(nil).Events(); ok {
+		t.Fatalf("expected subscription to a closed sink to be closed")
+	}
+}
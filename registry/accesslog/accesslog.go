@@ -0,0 +1,113 @@
+// Package accesslog emits a structured record for each blob read served by
+// the registry, to a file or a Kafka topic, so that egress can be attributed
+// to repositories and clients for billing.
+package accesslog
+
+import (
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/distribution/digest"
+)
+
+// Record describes a blob read served by the registry.
+type Record struct {
+	Time       time.Time     `json:"time"`
+	RequestID  string        `json:"requestID,omitempty"`
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+
+	// Range is the Range header of the request, if any.
+	Range string `json:"range,omitempty"`
+
+	// Bytes is the number of bytes of the blob written to the client. For
+	// a redirected read, it is the size of the requested range or of the
+	// blob, served by the storage backend.
+	Bytes int64 `json:"bytes"`
+
+	// Redirected is true if the client was redirected to the storage
+	// backend, such as a KODO or S3 bucket, to read the blob.
+	Redirected bool `json:"redirected,omitempty"`
+
+	Status int `json:"status"`
+
+	// ClientAddr is the address of the client, taking forwarding headers
+	// into account.
+	ClientAddr string `json:"clientAddr"`
+	UserAgent  string `json:"userAgent,omitempty"`
+
+	// Subject is the name of the authenticated user, if any, and Issuer
+	// the issuer of the token the user authenticated with.
+	Subject string `json:"subject,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+}
+
+// Sink accepts access records.
+type Sink interface {
+	// Write emits the record. Sinks must not block the request for long:
+	// sinks sending records over the network queue them.
+	Write(record Record) error
+
+	// Close flushes the queued records and releases the sink.
+	Close() error
+}
+
+// ErrSinkClosed is returned when writing to a closed sink.
+var ErrSinkClosed = errors.New("accesslog: sink closed")
+
+// Metrics holds counters of the records emitted.
+type Metrics struct {
+	Written uint64
+	Dropped uint64
+	Failed  uint64
+}
+
+// metrics tracks the records emitted by all sinks. This is kept globally and
+// made available via expvar.
+var metrics Metrics
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("accesslog", expvar.Func(func() interface{} {
+		return Metrics{
+			Written: atomic.LoadUint64(&metrics.Written),
+			Dropped: atomic.LoadUint64(&metrics.Dropped),
+			Failed:  atomic.LoadUint64(&metrics.Failed),
+		}
+	}))
+}
+
+// multiSink writes each record to all of its sinks.
+type multiSink []Sink
+
+// NewMultiSink returns a sink writing each record to all the given sinks.
+// Writing fails with the first error of a sink, after all sinks were written.
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (ms multiSink) Write(record Record) error {
+	var firstErr error
+	for _, sink := range ms {
+		if err := sink.Write(record); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (ms multiSink) Close() error {
+	var firstErr error
+	for _, sink := range ms {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,124 @@
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/digest"
+)
+
+var testRecord = Record{
+	Time:       time.Unix(1475467200, 0).UTC(),
+	Repository: "foo/bar",
+	Digest:     digest.FromBytes([]byte("layer")),
+	Bytes:      5,
+	Status:     http.StatusOK,
+	ClientAddr: "10.0.0.1",
+	Subject:    "alice",
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("error creating file sink: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(testRecord); err != nil {
+			t.Fatalf("error writing record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("error closing sink: %v", err)
+	}
+	if err := sink.Write(testRecord); err != ErrSinkClosed {
+		t.Fatalf("expected ErrSinkClosed writing to a closed sink, got %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("error decoding record: %v", err)
+		}
+		if record != testRecord {
+			t.Fatalf("unexpected record: %#v", record)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 records, got %d", lines)
+	}
+}
+
+func TestKafkaSink(t *testing.T) {
+	batches := make(chan []kafkaMessage, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/registry-access" || r.Header.Get("Content-Type") != kafkaMediaType {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var body struct {
+			Records []kafkaMessage `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("error decoding records: %v", err)
+		}
+		batches <- body.Records
+	}))
+	defer server.Close()
+
+	if _, err := NewKafkaSink(KafkaConfig{URL: server.URL}); err == nil {
+		t.Fatalf("expected an error without a topic")
+	}
+
+	sink, err := NewKafkaSink(KafkaConfig{URL: server.URL, Topic: "registry-access", BatchSize: 2})
+	if err != nil {
+		t.Fatalf("error creating kafka sink: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(testRecord); err != nil {
+			t.Fatalf("error writing record: %v", err)
+		}
+	}
+	// Closing produces the incomplete batch.
+	if err := sink.Close(); err != nil {
+		t.Fatalf("error closing sink: %v", err)
+	}
+
+	var produced int
+	for produced < 3 {
+		select {
+		case batch := <-batches:
+			for _, message := range batch {
+				if message.Key != "foo/bar" || message.Value != testRecord {
+					t.Fatalf("unexpected message: %#v", message)
+				}
+			}
+			produced += len(batch)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 3 records, got %d", produced)
+		}
+	}
+}
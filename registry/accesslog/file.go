@@ -0,0 +1,60 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// fileSink appends records to a file, one JSON object per line.
+type fileSink struct {
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+// NewFileSink returns a sink appending records to the file at path, which is
+// created if needed. Since the file is opened in append mode, it may be
+// rotated by copying and truncating it.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (fs *fileSink) Write(record Record) error {
+	p, err := json.Marshal(record)
+	if err != nil {
+		atomic.AddUint64(&metrics.Failed, 1)
+		return err
+	}
+	p = append(p, '\n')
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return ErrSinkClosed
+	}
+
+	if _, err := fs.f.Write(p); err != nil {
+		atomic.AddUint64(&metrics.Failed, 1)
+		return err
+	}
+	atomic.AddUint64(&metrics.Written, 1)
+	return nil
+}
+
+func (fs *fileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return nil
+	}
+	fs.closed = true
+	return fs.f.Close()
+}
@@ -0,0 +1,190 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// kafkaMediaType is the media type of the JSON records produced to a Kafka
+// REST proxy.
+const kafkaMediaType = "application/vnd.kafka.json.v2+json"
+
+const (
+	defaultKafkaBatchSize     = 500
+	defaultKafkaQueueSize     = 10000
+	defaultKafkaFlushInterval = time.Second
+	defaultKafkaTimeout       = 5 * time.Second
+)
+
+// KafkaConfig configures a sink producing records to a Kafka topic.
+type KafkaConfig struct {
+	// URL is the base url of the Kafka REST proxy.
+	URL string
+
+	Topic   string
+	Headers http.Header
+	Timeout time.Duration
+
+	// BatchSize is the maximum number of records produced by a request.
+	BatchSize int
+
+	// QueueSize is the number of records queued while the proxy is slow
+	// or unavailable. Records written to a full queue are dropped.
+	QueueSize int
+}
+
+// kafkaSink produces records to a Kafka topic through a Kafka REST proxy,
+// in batches, from a background goroutine. Records are keyed by repository.
+type kafkaSink struct {
+	url    string
+	config KafkaConfig
+	client *http.Client
+
+	records chan Record
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// kafkaMessage is a record produced to the topic.
+type kafkaMessage struct {
+	Key   string `json:"key"`
+	Value Record `json:"value"`
+}
+
+// NewKafkaSink returns a sink producing records to a Kafka topic.
+func NewKafkaSink(config KafkaConfig) (Sink, error) {
+	if config.URL == "" || config.Topic == "" {
+		return nil, fmt.Errorf("accesslog: kafka sink requires a url and a topic")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultKafkaTimeout
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultKafkaBatchSize
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultKafkaQueueSize
+	}
+
+	ks := &kafkaSink{
+		url:     strings.TrimSuffix(config.URL, "/") + "/topics/" + config.Topic,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		records: make(chan Record, config.QueueSize),
+		done:    make(chan struct{}),
+	}
+	go ks.run()
+	return ks, nil
+}
+
+// Write queues the record, dropping it if the queue is full.
+func (ks *kafkaSink) Write(record Record) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.closed {
+		return ErrSinkClosed
+	}
+
+	select {
+	case ks.records <- record:
+		return nil
+	default:
+		atomic.AddUint64(&metrics.Dropped, 1)
+		return fmt.Errorf("accesslog: kafka queue full, record dropped")
+	}
+}
+
+// Close produces the queued records and stops the sink.
+func (ks *kafkaSink) Close() error {
+	ks.mu.Lock()
+	if ks.closed {
+		ks.mu.Unlock()
+		return nil
+	}
+	ks.closed = true
+	close(ks.records)
+	ks.mu.Unlock()
+
+	<-ks.done
+	return nil
+}
+
+// run produces batches of queued records until the sink is closed.
+func (ks *kafkaSink) run() {
+	defer close(ks.done)
+
+	ticker := time.NewTicker(defaultKafkaFlushInterval)
+	defer ticker.Stop()
+
+	var batch []kafkaMessage
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := ks.produce(batch); err != nil {
+			logrus.Errorf("accesslog: error producing %d records to %s: %v", len(batch), ks.url, err)
+			atomic.AddUint64(&metrics.Failed, uint64(len(batch)))
+		} else {
+			atomic.AddUint64(&metrics.Written, uint64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case record, ok := <-ks.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, kafkaMessage{Key: record.Repository, Value: record})
+			if len(batch) >= ks.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (ks *kafkaSink) produce(batch []kafkaMessage) error {
+	p, err := json.Marshal(struct {
+		Records []kafkaMessage `json:"records"`
+	}{batch})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", ks.url, bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	for name, values := range ks.config.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", kafkaMediaType)
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
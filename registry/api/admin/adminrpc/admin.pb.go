@@ -0,0 +1,351 @@
+// Code generated by protoc-gen-go.
+// source: admin.proto
+// DO NOT EDIT!
+
+package adminrpc
+
+import proto "github.com/golang/protobuf/proto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+
+type Empty struct {
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+
+type GarbageCollectRequest struct {
+	DryRun bool `protobuf:"varint,1,opt,name=dry_run" json:"dry_run,omitempty"`
+	// workers is the number of repositories marked concurrently.
+	Workers int32 `protobuf:"varint,2,opt,name=workers" json:"workers,omitempty"`
+	// rate_limit is the maximum number of storage operations per second.
+	RateLimit float64 `protobuf:"fixed64,3,opt,name=rate_limit" json:"rate_limit,omitempty"`
+	// resume resumes an interrupted run.
+	Resume bool `protobuf:"varint,4,opt,name=resume" json:"resume,omitempty"`
+}
+
+func (m *GarbageCollectRequest) Reset()         { *m = GarbageCollectRequest{} }
+func (m *GarbageCollectRequest) String() string { return proto.CompactTextString(m) }
+func (*GarbageCollectRequest) ProtoMessage()    {}
+
+type GarbageCollectResponse struct {
+	DryRun bool `protobuf:"varint,1,opt,name=dry_run" json:"dry_run,omitempty"`
+	// marked is the number of blobs referenced by manifests.
+	Marked int64 `protobuf:"varint,2,opt,name=marked" json:"marked,omitempty"`
+	// deleted lists the digests of the unreferenced blobs which were
+	// deleted or, for a dry run, which would have been deleted.
+	Deleted []string `protobuf:"bytes,3,rep,name=deleted" json:"deleted,omitempty"`
+}
+
+func (m *GarbageCollectResponse) Reset()         { *m = GarbageCollectResponse{} }
+func (m *GarbageCollectResponse) String() string { return proto.CompactTextString(m) }
+func (*GarbageCollectResponse) ProtoMessage()    {}
+
+type ReadOnlyStatus struct {
+	Enabled bool `protobuf:"varint,1,opt,name=enabled" json:"enabled,omitempty"`
+}
+
+func (m *ReadOnlyStatus) Reset()         { *m = ReadOnlyStatus{} }
+func (m *ReadOnlyStatus) String() string { return proto.CompactTextString(m) }
+func (*ReadOnlyStatus) ProtoMessage()    {}
+
+type DeleteRepositoryRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *DeleteRepositoryRequest) Reset()         { *m = DeleteRepositoryRequest{} }
+func (m *DeleteRepositoryRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRepositoryRequest) ProtoMessage()    {}
+
+type RepositoryDeletionRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Id   string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *RepositoryDeletionRequest) Reset()         { *m = RepositoryDeletionRequest{} }
+func (m *RepositoryDeletionRequest) String() string { return proto.CompactTextString(m) }
+func (*RepositoryDeletionRequest) ProtoMessage()    {}
+
+type RepositoryDeletion struct {
+	Id   string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	// state is "running" until the deletion ends, then "failed" with error
+	// set, "canceled" or "completed".
+	State string `protobuf:"bytes,3,opt,name=state" json:"state,omitempty"`
+	// tags and manifests are the number of tags and manifests removed so
+	// far.
+	Tags      int64  `protobuf:"varint,4,opt,name=tags" json:"tags,omitempty"`
+	Manifests int64  `protobuf:"varint,5,opt,name=manifests" json:"manifests,omitempty"`
+	Error     string `protobuf:"bytes,6,opt,name=error" json:"error,omitempty"`
+	// started and finished are in nanoseconds since the epoch. finished is
+	// zero until the deletion ends.
+	Started  int64 `protobuf:"varint,7,opt,name=started" json:"started,omitempty"`
+	Finished int64 `protobuf:"varint,8,opt,name=finished" json:"finished,omitempty"`
+}
+
+func (m *RepositoryDeletion) Reset()         { *m = RepositoryDeletion{} }
+func (m *RepositoryDeletion) String() string { return proto.CompactTextString(m) }
+func (*RepositoryDeletion) ProtoMessage()    {}
+
+type Stats struct {
+	// computed is when the report was computed, in nanoseconds since the
+	// epoch, and duration how long it took, in nanoseconds.
+	Computed int64 `protobuf:"varint,1,opt,name=computed" json:"computed,omitempty"`
+	Duration int64 `protobuf:"varint,2,opt,name=duration" json:"duration,omitempty"`
+	// blobs and bytes are the number and size of the blobs referenced by
+	// the repositories, shared_bytes the size of those referenced by more
+	// than one.
+	Blobs        int64              `protobuf:"varint,3,opt,name=blobs" json:"blobs,omitempty"`
+	Bytes        int64              `protobuf:"varint,4,opt,name=bytes" json:"bytes,omitempty"`
+	SharedBytes  int64              `protobuf:"varint,5,opt,name=shared_bytes" json:"shared_bytes,omitempty"`
+	Repositories []*RepositoryStats `protobuf:"bytes,6,rep,name=repositories" json:"repositories,omitempty"`
+}
+
+func (m *Stats) Reset()         { *m = Stats{} }
+func (m *Stats) String() string { return proto.CompactTextString(m) }
+func (*Stats) ProtoMessage()    {}
+
+func (m *Stats) GetRepositories() []*RepositoryStats {
+	if m != nil {
+		return m.Repositories
+	}
+	return nil
+}
+
+type RepositoryStats struct {
+	Name        string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Blobs       int64  `protobuf:"varint,2,opt,name=blobs" json:"blobs,omitempty"`
+	Bytes       int64  `protobuf:"varint,3,opt,name=bytes" json:"bytes,omitempty"`
+	UniqueBytes int64  `protobuf:"varint,4,opt,name=unique_bytes" json:"unique_bytes,omitempty"`
+	SharedBytes int64  `protobuf:"varint,5,opt,name=shared_bytes" json:"shared_bytes,omitempty"`
+}
+
+func (m *RepositoryStats) Reset()         { *m = RepositoryStats{} }
+func (m *RepositoryStats) String() string { return proto.CompactTextString(m) }
+func (*RepositoryStats) ProtoMessage()    {}
+
+func init() {
+}
+
+// Client API for RegistryAdmin service
+
+type RegistryAdminClient interface {
+	// GarbageCollect runs a mark and sweep of the blob store. Unless the
+	// request is a dry run, the registry must be in read-only mode.
+	GarbageCollect(ctx context.Context, in *GarbageCollectRequest, opts ...grpc.CallOption) (*GarbageCollectResponse, error)
+	// GetReadOnly returns whether the registry is in read-only mode.
+	GetReadOnly(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ReadOnlyStatus, error)
+	// SetReadOnly enables or disables read-only mode, until the registry
+	// restarts.
+	SetReadOnly(ctx context.Context, in *ReadOnlyStatus, opts ...grpc.CallOption) (*ReadOnlyStatus, error)
+	// DeleteRepository starts deleting a repository in the background and
+	// returns the status of the deletion.
+	DeleteRepository(ctx context.Context, in *DeleteRepositoryRequest, opts ...grpc.CallOption) (*RepositoryDeletion, error)
+	// GetRepositoryDeletion returns the status of a repository deletion.
+	GetRepositoryDeletion(ctx context.Context, in *RepositoryDeletionRequest, opts ...grpc.CallOption) (*RepositoryDeletion, error)
+	// GetStats returns the last storage usage report, computed by any
+	// registry instance sharing the storage.
+	GetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Stats, error)
+}
+
+type registryAdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRegistryAdminClient(cc *grpc.ClientConn) RegistryAdminClient {
+	return &registryAdminClient{cc}
+}
+
+func (c *registryAdminClient) GarbageCollect(ctx context.Context, in *GarbageCollectRequest, opts ...grpc.CallOption) (*GarbageCollectResponse, error) {
+	out := new(GarbageCollectResponse)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/GarbageCollect", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *registryAdminClient) GetReadOnly(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ReadOnlyStatus, error) {
+	out := new(ReadOnlyStatus)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/GetReadOnly", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *registryAdminClient) SetReadOnly(ctx context.Context, in *ReadOnlyStatus, opts ...grpc.CallOption) (*ReadOnlyStatus, error) {
+	out := new(ReadOnlyStatus)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/SetReadOnly", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *registryAdminClient) DeleteRepository(ctx context.Context, in *DeleteRepositoryRequest, opts ...grpc.CallOption) (*RepositoryDeletion, error) {
+	out := new(RepositoryDeletion)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/DeleteRepository", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *registryAdminClient) GetRepositoryDeletion(ctx context.Context, in *RepositoryDeletionRequest, opts ...grpc.CallOption) (*RepositoryDeletion, error) {
+	out := new(RepositoryDeletion)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/GetRepositoryDeletion", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *registryAdminClient) GetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := grpc.Invoke(ctx, "/registryadmin.RegistryAdmin/GetStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for RegistryAdmin service
+
+type RegistryAdminServer interface {
+	// GarbageCollect runs a mark and sweep of the blob store. Unless the
+	// request is a dry run, the registry must be in read-only mode.
+	GarbageCollect(context.Context, *GarbageCollectRequest) (*GarbageCollectResponse, error)
+	// GetReadOnly returns whether the registry is in read-only mode.
+	GetReadOnly(context.Context, *Empty) (*ReadOnlyStatus, error)
+	// SetReadOnly enables or disables read-only mode, until the registry
+	// restarts.
+	SetReadOnly(context.Context, *ReadOnlyStatus) (*ReadOnlyStatus, error)
+	// DeleteRepository starts deleting a repository in the background and
+	// returns the status of the deletion.
+	DeleteRepository(context.Context, *DeleteRepositoryRequest) (*RepositoryDeletion, error)
+	// GetRepositoryDeletion returns the status of a repository deletion.
+	GetRepositoryDeletion(context.Context, *RepositoryDeletionRequest) (*RepositoryDeletion, error)
+	// GetStats returns the last storage usage report, computed by any
+	// registry instance sharing the storage.
+	GetStats(context.Context, *Empty) (*Stats, error)
+}
+
+func RegisterRegistryAdminServer(s *grpc.Server, srv RegistryAdminServer) {
+	s.RegisterService(&_RegistryAdmin_serviceDesc, srv)
+}
+
+func _RegistryAdmin_GarbageCollect_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(GarbageCollectRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).GarbageCollect(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _RegistryAdmin_GetReadOnly_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(Empty)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).GetReadOnly(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _RegistryAdmin_SetReadOnly_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ReadOnlyStatus)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).SetReadOnly(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _RegistryAdmin_DeleteRepository_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(DeleteRepositoryRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).DeleteRepository(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _RegistryAdmin_GetRepositoryDeletion_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RepositoryDeletionRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).GetRepositoryDeletion(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _RegistryAdmin_GetStats_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(Empty)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(RegistryAdminServer).GetStats(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _RegistryAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "registryadmin.RegistryAdmin",
+	HandlerType: (*RegistryAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GarbageCollect",
+			Handler:    _RegistryAdmin_GarbageCollect_Handler,
+		},
+		{
+			MethodName: "GetReadOnly",
+			Handler:    _RegistryAdmin_GetReadOnly_Handler,
+		},
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _RegistryAdmin_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "DeleteRepository",
+			Handler:    _RegistryAdmin_DeleteRepository_Handler,
+		},
+		{
+			MethodName: "GetRepositoryDeletion",
+			Handler:    _RegistryAdmin_GetRepositoryDeletion_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _RegistryAdmin_GetStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
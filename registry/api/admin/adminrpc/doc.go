@@ -0,0 +1,6 @@
+// Package adminrpc defines the gRPC service serving administrative operations
+// of the registry to cluster tooling, as an alternative to the HTTP admin
+// API. The service is served by the registry on its own address, with mutual
+// TLS: clients dial it with NewRegistryAdminClient over a connection
+// presenting a certificate signed by one of the configured client CAs.
+package adminrpc
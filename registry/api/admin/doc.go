@@ -0,0 +1,5 @@
+// Package admin describes the administrative API of the registry, used by
+// operators to inspect and maintain a running instance. The routes are served
+// by the registry application alongside the V2 API when enabled and require
+// the "registry:admin:*" access scope.
+package admin
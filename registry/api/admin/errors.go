@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+const errGroup = "registry.api.admin"
+
+var (
+	// ErrorCodeRequestInvalid is returned when the parameters or body of an
+	// admin request cannot be parsed.
+	ErrorCodeRequestInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "REQUEST_INVALID",
+		Message:        "invalid admin request",
+		Description:    `The request parameters or body could not be parsed.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeNotReadOnly is returned when an operation requires the
+	// registry to be in read-only mode, such as garbage collection.
+	ErrorCodeNotReadOnly = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "NOT_READ_ONLY",
+		Message: "registry is not in read-only mode",
+		Description: `The operation may only run while the registry rejects
+		writes, since concurrent uploads could be affected. Enable read-only
+		mode and retry.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeTagUnknown is returned when removing a tag that does not
+	// exist.
+	ErrorCodeTagUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "TAG_UNKNOWN",
+		Message:        "tag unknown to registry",
+		Description:    `The tag does not exist in the repository.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodePinUnknown is returned when removing a garbage collection pin
+	// that does not exist.
+	ErrorCodePinUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "PIN_UNKNOWN",
+		Message: "pin unknown to registry",
+		Description: `No pin of the digest or repository is stored in the
+		registry. Pins of the configuration cannot be removed through the
+		API.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodePrewarmUnknown is returned when polling the status of a
+	// prewarm job that does not exist.
+	ErrorCodePrewarmUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "PREWARM_UNKNOWN",
+		Message: "prewarm job unknown to registry",
+		Description: `The prewarm job was not started by this registry
+		instance, or ended long enough ago that its status was discarded.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeUsageUnknown is returned when getting the storage usage
+	// report before one was computed.
+	ErrorCodeUsageUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "USAGE_UNKNOWN",
+		Message: "storage usage report unknown to registry",
+		Description: `No storage usage report was computed yet. Enable the
+		usagereport maintenance job, or compute a report with a POST
+		request.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeUserUnknown is returned when removing a user that does not
+	// exist.
+	ErrorCodeUserUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "USER_UNKNOWN",
+		Message:        "user unknown to registry",
+		Description:    `The user does not exist.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeJobUnknown is returned when polling or canceling a job that
+	// does not exist.
+	ErrorCodeJobUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "JOB_UNKNOWN",
+		Message: "job unknown to registry",
+		Description: `The job was not started by this registry instance,
+		or ended long enough ago that its status was discarded.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+)
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"github.com/docker/distribution/reference"
+	"github.com/gorilla/mux"
+)
+
+// The following are definitions of the name under which all admin routes are
+// registered. These symbols can be used to look up a route based on the name.
+const (
+	RouteNameRepositories   = "admin-repositories"
+	RouteNameTag            = "admin-tag"
+	RouteNameGC             = "admin-gc"
+	RouteNameGCPins         = "admin-gc-pins"
+	RouteNameReadOnly       = "admin-readonly"
+	RouteNameEventsReplay   = "admin-events-replay"
+	RouteNameEventsStream   = "admin-events-stream"
+	RouteNameLayout         = "admin-layout"
+	RouteNameJournal        = "admin-journal"
+	RouteNameJournalRecover = "admin-journal-recover"
+	RouteNameSnapshot       = "admin-snapshot"
+	RouteNameRestore        = "admin-restore"
+	RouteNamePrewarm        = "admin-prewarm"
+	RouteNamePrewarmStatus  = "admin-prewarm-status"
+	RouteNameUsage          = "admin-usage"
+	RouteNameUsers          = "admin-users"
+	RouteNameUser           = "admin-user"
+	RouteNameJobs           = "admin-jobs"
+	RouteNameJob            = "admin-job"
+	RouteNameLeader         = "admin-leader"
+)
+
+// RouteNames lists the names of all admin routes.
+var RouteNames = []string{
+	RouteNameRepositories,
+	RouteNameTag,
+	RouteNameGC,
+	RouteNameGCPins,
+	RouteNameReadOnly,
+	RouteNameEventsReplay,
+	RouteNameEventsStream,
+	RouteNameLayout,
+	RouteNameJournal,
+	RouteNameJournalRecover,
+	RouteNameSnapshot,
+	RouteNameRestore,
+	RouteNamePrewarm,
+	RouteNamePrewarmStatus,
+	RouteNameUsage,
+	RouteNameUsers,
+	RouteNameUser,
+	RouteNameJobs,
+	RouteNameJob,
+	RouteNameLeader,
+}
+
+var routePaths = map[string]string{
+	RouteNameRepositories:   "/admin/v1/repositories",
+	RouteNameTag:            "/admin/v1/repositories/{name:" + reference.NameRegexp.String() + "}/tags/{tag:" + reference.TagRegexp.String() + "}",
+	RouteNameGC:             "/admin/v1/gc",
+	RouteNameGCPins:         "/admin/v1/gc/pins",
+	RouteNameReadOnly:       "/admin/v1/readonly",
+	RouteNameEventsReplay:   "/admin/v1/events/replay",
+	RouteNameEventsStream:   "/admin/v1/events/stream",
+	RouteNameLayout:         "/admin/v1/layout/migrate",
+	RouteNameJournal:        "/admin/v1/journal",
+	RouteNameJournalRecover: "/admin/v1/journal/recover",
+	RouteNameSnapshot:       "/admin/v1/repositories/{name:" + reference.NameRegexp.String() + "}/snapshot",
+	RouteNameRestore:        "/admin/v1/repositories/{name:" + reference.NameRegexp.String() + "}/restore",
+	RouteNamePrewarm:        "/admin/v1/repositories/{name:" + reference.NameRegexp.String() + "}/prewarm",
+	RouteNamePrewarmStatus:  "/admin/v1/prewarm/{id:[a-zA-Z0-9-]+}",
+	RouteNameUsage:          "/admin/v1/usage",
+	RouteNameUsers:          "/admin/v1/users",
+	RouteNameUser:           "/admin/v1/users/{username:[^/:]+}",
+	RouteNameJobs:           "/admin/v1/jobs",
+	RouteNameJob:            "/admin/v1/jobs/{id:[a-zA-Z0-9-]+}",
+	RouteNameLeader:         "/admin/v1/leader",
+}
+
+// Router builds a gorilla router with the named admin routes.
+func Router() *mux.Router {
+	return RouterWithPrefix("")
+}
+
+// RouterWithPrefix builds a gorilla router with a configured prefix on all
+// admin routes.
+func RouterWithPrefix(prefix string) *mux.Router {
+	rootRouter := mux.NewRouter()
+	AddRoutes(rootRouter, prefix)
+	return rootRouter
+}
+
+// AddRoutes registers the named admin routes with an existing router, such
+// as the one serving the V2 API.
+func AddRoutes(rootRouter *mux.Router, prefix string) {
+	router := rootRouter
+	if prefix != "" {
+		router = router.PathPrefix(prefix).Subrouter()
+	}
+
+	router.StrictSlash(true)
+
+	for _, name := range RouteNames {
+		router.Path(routePaths[name]).Name(name)
+	}
+}
+
+// IsAdminRoute returns true if the route name belongs to the admin API.
+func IsAdminRoute(name string) bool {
+	_, ok := routePaths[name]
+	return ok
+}
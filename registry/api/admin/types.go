@@ -0,0 +1,316 @@
+package admin
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/docker/distribution/digest"
+)
+
+// RepositoryList is the response body of the repositories route.
+type RepositoryList struct {
+	Repositories []string `json:"repositories"`
+}
+
+// Media types of the bucket inventories which may be sent as the request body
+// of the gc route, to sweep the listed blobs rather than listing the blob
+// store.
+const (
+	// MediaTypeInventoryCSV is an S3 inventory report, with the bucket in
+	// the first column and the key in the second, or a list of keys.
+	MediaTypeInventoryCSV = "text/csv"
+
+	// MediaTypeInventoryJSON is a stream of JSON objects carrying the key in
+	// their "key" field, such as a KODO bucket listing.
+	MediaTypeInventoryJSON = "application/x-ndjson"
+)
+
+// GCResult is the response body of the gc route.
+type GCResult struct {
+	// DryRun is true if no blobs were deleted.
+	DryRun bool `json:"dryRun"`
+
+	// Marked is the number of blobs referenced by manifests.
+	Marked int `json:"marked"`
+
+	// Deleted lists the unreferenced blobs which were deleted or, for a dry
+	// run, which would have been deleted.
+	Deleted []digest.Digest `json:"deleted"`
+}
+
+// Pin protects content from garbage collection. It is the request body of
+// the gc pins route, adding a pin. Exactly one of Digest and Repository is
+// set.
+type Pin struct {
+	// Digest keeps a blob and, if it is a manifest, the content it
+	// references, even once no repository links it.
+	Digest digest.Digest `json:"digest,omitempty"`
+
+	// Repository keeps every blob linked by the repositories matching the
+	// name, in which * matches any sequence of characters.
+	Repository string `json:"repository,omitempty"`
+
+	Comment string    `json:"comment,omitempty"`
+	Created time.Time `json:"created"`
+
+	// Configured is true for the pins of the registry configuration, which
+	// cannot be removed through the API.
+	Configured bool `json:"configured,omitempty"`
+}
+
+// PinList is the response body of the gc pins route.
+type PinList struct {
+	Pins []Pin `json:"pins"`
+}
+
+// ReadOnlyStatus is the request and response body of the readonly route.
+type ReadOnlyStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ReplayResult is the response body of the events replay route.
+type ReplayResult struct {
+	// Since is the time from which retained events were replayed.
+	Since time.Time `json:"since"`
+
+	// Replayed is the number of events sent to the notification endpoints.
+	Replayed int `json:"replayed"`
+}
+
+// LayoutMigrationResult is the response body of the layout route.
+type LayoutMigrationResult struct {
+	// DryRun is true if no blobs were moved.
+	DryRun bool `json:"dryRun"`
+
+	// Version is the layout version the blob store was migrated to.
+	Version int `json:"version"`
+
+	// Migrated is the number of blobs moved, or to move for a dry run, to
+	// the layout.
+	Migrated int `json:"migrated"`
+
+	// Skipped is the number of blobs already present in the layout, whose
+	// copies in other layouts were removed.
+	Skipped int `json:"skipped"`
+}
+
+// JournalEntry is a mutation of the repository metadata recorded in the
+// journal.
+type JournalEntry struct {
+	ID         string        `json:"id"`
+	Time       time.Time     `json:"time"`
+	Action     string        `json:"action"`
+	Path       string        `json:"path"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	Repository string        `json:"repository,omitempty"`
+	Tag        string        `json:"tag,omitempty"`
+}
+
+// JournalEntries is the response body of the journal route.
+type JournalEntries struct {
+	Entries []JournalEntry `json:"entries"`
+}
+
+// JournalRecoveryResult is the response body of the journal recover route.
+type JournalRecoveryResult struct {
+	// Since is the time from which journal entries were considered.
+	Since time.Time `json:"since"`
+
+	// Applied is the number of mutations which were missing and applied.
+	Applied int `json:"applied"`
+}
+
+// RepositorySnapshot is the response body of the snapshot route and the
+// request body of the restore route. It records the manifest each tag of a
+// repository pointed at, at a point in time.
+type RepositorySnapshot struct {
+	Name string                   `json:"name"`
+	Time time.Time                `json:"time"`
+	Tags map[string]digest.Digest `json:"tags"`
+
+	// Unknown lists the tags whose state at Time is not recorded in the
+	// journal. A restore leaves them unchanged.
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// RestoreResult is the response body of the restore route.
+type RestoreResult struct {
+	// DryRun is true if no tags were changed.
+	DryRun bool `json:"dryRun"`
+
+	// Tagged lists the tags pointed back at their snapshot manifest.
+	Tagged []string `json:"tagged"`
+
+	// Untagged lists the tags removed since they did not exist in the
+	// snapshot.
+	Untagged []string `json:"untagged"`
+
+	// Missing lists the tags left unchanged since their snapshot manifest is
+	// no longer in the blob store.
+	Missing []string `json:"missing"`
+}
+
+// PrewarmRequest is the request body of the prewarm route.
+type PrewarmRequest struct {
+	// References lists the tags and digests of the manifests to fetch into
+	// the cache, along with the manifests they list and their blobs.
+	References []string `json:"references"`
+}
+
+// States of a prewarm job.
+const (
+	PrewarmStateRunning   = "running"
+	PrewarmStateCompleted = "completed"
+	PrewarmStateFailed    = "failed"
+	PrewarmStateCanceled  = "canceled"
+)
+
+// PrewarmStatus is the response body of the prewarm and prewarm status
+// routes, describing the progress of a prewarm job.
+type PrewarmStatus struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	References []string `json:"references"`
+
+	// State is PrewarmStateRunning until the job ends, then
+	// PrewarmStateCanceled if it was canceled through the job route,
+	// PrewarmStateFailed if any manifest or blob could not be fetched, and
+	// PrewarmStateCompleted otherwise.
+	State string `json:"state"`
+
+	// Blobs is the number of blobs referenced by the manifests resolved so
+	// far, of which Completed were cached, Fetched from the remote rather
+	// than already cached. Bytes is the size of the blobs fetched.
+	Blobs     int   `json:"blobs"`
+	Completed int   `json:"completed"`
+	Fetched   int   `json:"fetched"`
+	Bytes     int64 `json:"bytes"`
+
+	// Errors lists the references and blobs which could not be fetched.
+	Errors []string `json:"errors,omitempty"`
+
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// RepositoryUsage is the storage consumed by the blobs a repository
+// references.
+type RepositoryUsage struct {
+	Name  string `json:"name"`
+	Blobs int    `json:"blobs"`
+	Bytes int64  `json:"bytes"`
+
+	// UniqueBytes is the size of the blobs referenced by no other
+	// repository, which deleting the repository would reclaim, and
+	// SharedBytes the size of those also referenced by other repositories.
+	UniqueBytes int64 `json:"uniqueBytes"`
+	SharedBytes int64 `json:"sharedBytes"`
+}
+
+// UsageReport is the response body of the usage route, describing the
+// storage consumed by the blobs referenced by manifests.
+type UsageReport struct {
+	// Computed is the time at which the computation of the report started,
+	// and Duration the time it took.
+	Computed time.Time     `json:"computed"`
+	Duration time.Duration `json:"duration"`
+
+	// Blobs is the number of distinct blobs referenced by manifests, Bytes
+	// their size and SharedBytes the size of those referenced by more than
+	// one repository.
+	Blobs       int   `json:"blobs"`
+	Bytes       int64 `json:"bytes"`
+	SharedBytes int64 `json:"sharedBytes"`
+
+	Repositories []RepositoryUsage `json:"repositories"`
+}
+
+// UserList is the response body of the users route.
+type UserList struct {
+	Users []string `json:"users"`
+}
+
+// UserPassword is the request body of the user route, setting the password
+// of a user.
+type UserPassword struct {
+	Password string `json:"password"`
+}
+
+// Types of the jobs run in the background.
+const (
+	JobTypeGC                 = "gc"
+	JobTypeLayoutMigration    = "layout-migration"
+	JobTypePrewarm            = "prewarm"
+	JobTypeRepositoryDeletion = "repository-deletion"
+	JobTypeSBOM               = "sbom"
+)
+
+// States of a job.
+const (
+	JobStateRunning   = "running"
+	JobStateCompleted = "completed"
+	JobStateFailed    = "failed"
+	JobStateCanceled  = "canceled"
+)
+
+// Job describes a long-running operation the registry runs in the
+// background, such as a garbage collection started with the async query
+// parameter. It is the response body of the routes starting jobs and of the
+// job route.
+type Job struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	// Target names what the job operates on, such as a repository, if
+	// it does not operate on the whole registry.
+	Target string `json:"target,omitempty"`
+
+	// State is JobStateRunning until the job ends, then JobStateCompleted,
+	// JobStateFailed with Error set, or JobStateCanceled if it was canceled
+	// through the job route.
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+
+	// Progress counts what the job has processed so far, with counters
+	// depending on its type.
+	Progress map[string]int64 `json:"progress,omitempty"`
+
+	// Result is the result of a completed job, the response body the
+	// route which started it returns when run synchronously, such as a
+	// GCResult.
+	Result json.RawMessage `json:"result,omitempty"`
+
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// JobList is the response body of the jobs route.
+type JobList struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Leadership is the response body of the leader route, identifying the
+// registry instance serving the request and the instance elected to run the
+// background maintenance jobs.
+type Leadership struct {
+	// Instance identifies the registry instance serving the request.
+	Instance string `json:"instance"`
+
+	// Election is the backend holding the lease of the leader, "redis" or
+	// "storage", or empty if leader election is disabled and every instance
+	// runs the maintenance jobs it enables.
+	Election string `json:"election,omitempty"`
+
+	// Leader is the instance holding the lease, and Expires the time it
+	// expires unless renewed, if any instance holds it.
+	Leader  string     `json:"leader,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// Leading is true if the instance serving the request runs its
+	// maintenance jobs.
+	Leading bool `json:"leading"`
+
+	// Jobs lists the maintenance jobs enabled on the instance serving the
+	// request, which only run while it is leading.
+	Jobs []string `json:"jobs"`
+}
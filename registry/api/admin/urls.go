@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/gorilla/mux"
+)
+
+// URLBuilder creates admin API urls from a single base endpoint.
+type URLBuilder struct {
+	root   *url.URL // url root (ie http://localhost/)
+	router *mux.Router
+}
+
+// NewURLBuilder creates a URLBuilder with provided root url object.
+func NewURLBuilder(root *url.URL) *URLBuilder {
+	return &URLBuilder{
+		root:   root,
+		router: Router(),
+	}
+}
+
+// NewURLBuilderFromString works identically to NewURLBuilder except it takes
+// a string argument for the root, returning an error if it is not a valid
+// url.
+func NewURLBuilderFromString(root string) (*URLBuilder, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewURLBuilder(u), nil
+}
+
+// BuildRepositoriesURL constructs a url to list the repositories.
+func (ub *URLBuilder) BuildRepositoriesURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameRepositories, values)
+}
+
+// BuildTagURL constructs a url to manage a tag of the named repository.
+func (ub *URLBuilder) BuildTagURL(name reference.Named, tag string) (string, error) {
+	return ub.build(RouteNameTag, nil, "name", name.Name(), "tag", tag)
+}
+
+// BuildGCURL constructs a url to run the garbage collector.
+func (ub *URLBuilder) BuildGCURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameGC, values)
+}
+
+// BuildGCPinsURL constructs a url to manage the pins protecting content from
+// the garbage collector.
+func (ub *URLBuilder) BuildGCPinsURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameGCPins, values)
+}
+
+// BuildReadOnlyURL constructs a url to manage read-only mode.
+func (ub *URLBuilder) BuildReadOnlyURL() (string, error) {
+	return ub.build(RouteNameReadOnly, nil)
+}
+
+// BuildEventsReplayURL constructs a url to replay notification events.
+func (ub *URLBuilder) BuildEventsReplayURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameEventsReplay, values)
+}
+
+// BuildEventsStreamURL constructs a url to watch notification events.
+func (ub *URLBuilder) BuildEventsStreamURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameEventsStream, values)
+}
+
+// BuildLayoutURL constructs a url to migrate the blob store layout.
+func (ub *URLBuilder) BuildLayoutURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameLayout, values)
+}
+
+// BuildJournalURL constructs a url to read the metadata journal.
+func (ub *URLBuilder) BuildJournalURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameJournal, values)
+}
+
+// BuildJournalRecoverURL constructs a url to recover from the metadata
+// journal.
+func (ub *URLBuilder) BuildJournalRecoverURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameJournalRecover, values)
+}
+
+// BuildSnapshotURL constructs a url to snapshot the tags of the named
+// repository.
+func (ub *URLBuilder) BuildSnapshotURL(name reference.Named, values ...url.Values) (string, error) {
+	return ub.build(RouteNameSnapshot, values, "name", name.Name())
+}
+
+// BuildRestoreURL constructs a url to restore the tags of the named
+// repository.
+func (ub *URLBuilder) BuildRestoreURL(name reference.Named, values ...url.Values) (string, error) {
+	return ub.build(RouteNameRestore, values, "name", name.Name())
+}
+
+// BuildPrewarmURL constructs a url to prewarm the cache with content of the
+// named repository.
+func (ub *URLBuilder) BuildPrewarmURL(name reference.Named) (string, error) {
+	return ub.build(RouteNamePrewarm, nil, "name", name.Name())
+}
+
+// BuildPrewarmStatusURL constructs a url to poll the status of a prewarm job.
+func (ub *URLBuilder) BuildPrewarmStatusURL(id string) (string, error) {
+	return ub.build(RouteNamePrewarmStatus, nil, "id", id)
+}
+
+// BuildUsageURL constructs a url to get or compute the storage usage report.
+func (ub *URLBuilder) BuildUsageURL(values ...url.Values) (string, error) {
+	return ub.build(RouteNameUsage, values)
+}
+
+// BuildUsersURL constructs a url to list the users of the registry.
+func (ub *URLBuilder) BuildUsersURL() (string, error) {
+	return ub.build(RouteNameUsers, nil)
+}
+
+// BuildUserURL constructs a url to set the password of, or remove, a user.
+func (ub *URLBuilder) BuildUserURL(username string) (string, error) {
+	return ub.build(RouteNameUser, nil, "username", username)
+}
+
+// BuildJobsURL constructs a url to list the jobs of the registry.
+func (ub *URLBuilder) BuildJobsURL() (string, error) {
+	return ub.build(RouteNameJobs, nil)
+}
+
+// BuildJobURL constructs a url to poll the status of, or cancel, a job.
+func (ub *URLBuilder) BuildJobURL(id string) (string, error) {
+	return ub.build(RouteNameJob, nil, "id", id)
+}
+
+// BuildLeaderURL constructs a url to get the leadership of the background
+// maintenance jobs.
+func (ub *URLBuilder) BuildLeaderURL() (string, error) {
+	return ub.build(RouteNameLeader, nil)
+}
+
+// build constructs the url of the named route relative to the root url,
+// appending any url values.
+func (ub *URLBuilder) build(routeName string, values []url.Values, pairs ...string) (string, error) {
+	routeURL, err := ub.router.GetRoute(routeName).URL(pairs...)
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve the route relative to the root, keeping any path prefix.
+	routeURL.Path = strings.TrimPrefix(routeURL.Path, "/")
+	u := ub.root.ResolveReference(routeURL)
+
+	merged := u.Query()
+	for _, v := range values {
+		for k, vv := range v {
+			merged[k] = append(merged[k], vv...)
+		}
+	}
+	u.RawQuery = merged.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+func TestURLBuilder(t *testing.T) {
+	named, _ := reference.ParseNamed("foo/bar")
+
+	for _, root := range []string{"http://example.com/", "http://example.com/prefix/"} {
+		ub, err := NewURLBuilderFromString(root)
+		if err != nil {
+			t.Fatalf("unexpected error creating url builder: %v", err)
+		}
+
+		for _, testcase := range []struct {
+			build    func() (string, error)
+			expected string
+		}{
+			{
+				build:    func() (string, error) { return ub.BuildRepositoriesURL(url.Values{"n": {"10"}}) },
+				expected: "admin/v1/repositories?n=10",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildTagURL(named, "latest") },
+				expected: "admin/v1/repositories/foo/bar/tags/latest",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildGCURL(url.Values{"dryrun": {"true"}}) },
+				expected: "admin/v1/gc?dryrun=true",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildGCPinsURL(url.Values{"repository": {"library/*"}}) },
+				expected: "admin/v1/gc/pins?repository=library%2F%2A",
+			},
+			{
+				build:    ub.BuildReadOnlyURL,
+				expected: "admin/v1/readonly",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildEventsReplayURL() },
+				expected: "admin/v1/events/replay",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildEventsStreamURL(url.Values{"repository": {"foo/bar"}}) },
+				expected: "admin/v1/events/stream?repository=foo%2Fbar",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildLayoutURL(url.Values{"version": {"2"}}) },
+				expected: "admin/v1/layout/migrate?version=2",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildJournalURL(url.Values{"n": {"100"}}) },
+				expected: "admin/v1/journal?n=100",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildJournalRecoverURL() },
+				expected: "admin/v1/journal/recover",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildSnapshotURL(named, url.Values{"at": {"2016-01-02T15:04:05Z"}}) },
+				expected: "admin/v1/repositories/foo/bar/snapshot?at=2016-01-02T15%3A04%3A05Z",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildRestoreURL(named) },
+				expected: "admin/v1/repositories/foo/bar/restore",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildPrewarmURL(named) },
+				expected: "admin/v1/repositories/foo/bar/prewarm",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildPrewarmStatusURL("2b3c4d") },
+				expected: "admin/v1/prewarm/2b3c4d",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildUsageURL() },
+				expected: "admin/v1/usage",
+			},
+			{
+				build:    ub.BuildUsersURL,
+				expected: "admin/v1/users",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildUserURL("frodo") },
+				expected: "admin/v1/users/frodo",
+			},
+			{
+				build:    ub.BuildJobsURL,
+				expected: "admin/v1/jobs",
+			},
+			{
+				build:    func() (string, error) { return ub.BuildJobURL("2b3c4d") },
+				expected: "admin/v1/jobs/2b3c4d",
+			},
+			{
+				build:    ub.BuildLeaderURL,
+				expected: "admin/v1/leader",
+			},
+		} {
+			u, err := testcase.build()
+			if err != nil {
+				t.Fatalf("unexpected error building url: %v", err)
+			}
+
+			if expected := root + testcase.expected; u != expected {
+				t.Fatalf("unexpected url: %q != %q", u, expected)
+			}
+		}
+	}
+}
@@ -101,6 +101,14 @@ type Error struct {
 	Message string      `json:"message"`
 	Detail  interface{} `json:"detail,omitempty"`
 
+	// DocumentationURL links to documentation of the error, such as how to
+	// resolve it.
+	DocumentationURL string `json:"documentation_url,omitempty"`
+
+	// RequestID identifies the request which failed, for correlation with
+	// the logs of the registry.
+	RequestID string `json:"request_id,omitempty"`
+
 	// TODO(duglin): See if we need an "args" property so we can do the
 	// variable substitution right before showing the message to the user
 }
@@ -120,21 +128,15 @@ func (e Error) Error() string {
 // WithDetail will return a new Error, based on the current one, but with
 // some Detail info added
 func (e Error) WithDetail(detail interface{}) Error {
-	return Error{
-		Code:    e.Code,
-		Message: e.Message,
-		Detail:  detail,
-	}
+	e.Detail = detail
+	return e
 }
 
 // WithArgs uses the passed-in list of interface{} as the substitution
 // variables in the Error's Message string, but returns a new Error
 func (e Error) WithArgs(args ...interface{}) Error {
-	return Error{
-		Code:    e.Code,
-		Message: fmt.Sprintf(e.Code.Message(), args...),
-		Detail:  e.Detail,
-	}
+	e.Message = fmt.Sprintf(e.Code.Message(), args...)
+	return e
 }
 
 // ErrorDescriptor provides relevant information about a given error code.
@@ -158,6 +160,10 @@ type ErrorDescriptor struct {
 	// HTTPStatusCode provides the http status code that is associated with
 	// this error condition.
 	HTTPStatusCode int
+
+	// DocumentationURL optionally links to documentation of the error
+	// condition, such as how to resolve it. It is included in API responses.
+	DocumentationURL string
 }
 
 // ParseErrorCode returns the value by the string error code.
@@ -205,17 +211,7 @@ func (errs Errors) MarshalJSON() ([]byte, error) {
 	}
 
 	for _, daErr := range errs {
-		var err Error
-
-		switch daErr.(type) {
-		case ErrorCode:
-			err = daErr.(ErrorCode).WithDetail(nil)
-		case Error:
-			err = daErr.(Error)
-		default:
-			err = ErrorCodeUnknown.WithDetail(daErr)
-
-		}
+		err := AsError(daErr)
 
 		// If the Error struct was setup and they forgot to set the
 		// Message field (meaning its "") then grab it from the ErrCode
@@ -224,16 +220,49 @@ func (errs Errors) MarshalJSON() ([]byte, error) {
 			msg = err.Code.Message()
 		}
 
+		// Likewise, link to the documentation of the ErrCode unless the
+		// error links elsewhere.
+		documentationURL := err.DocumentationURL
+		if documentationURL == "" {
+			documentationURL = err.Code.Descriptor().DocumentationURL
+		}
+
 		tmpErrs.Errors = append(tmpErrs.Errors, Error{
-			Code:    err.Code,
-			Message: msg,
-			Detail:  err.Detail,
+			Code:             err.Code,
+			Message:          msg,
+			Detail:           err.Detail,
+			DocumentationURL: documentationURL,
+			RequestID:        err.RequestID,
 		})
 	}
 
 	return json.Marshal(tmpErrs)
 }
 
+// AsError returns err as an Error. Errors with a code of their own, such as
+// those registered by extensions, keep it, even if they were wrapped as the
+// detail of an unknown error. Other errors become the detail of an unknown
+// error.
+func AsError(err error) Error {
+	switch e := err.(type) {
+	case ErrorCode:
+		return e.WithDetail(nil)
+	case Error:
+		if e.Code == ErrorCodeUnknown {
+			if detail, ok := e.Detail.(error); ok {
+				if _, ok := detail.(ErrorCoder); ok {
+					return AsError(detail)
+				}
+			}
+		}
+		return e
+	case ErrorCoder:
+		return e.ErrorCode().WithDetail(err.Error())
+	default:
+		return ErrorCodeUnknown.WithDetail(err)
+	}
+}
+
 // UnmarshalJSON deserializes []Error and then converts it into slice of
 // Error or ErrorCode
 func (errs *Errors) UnmarshalJSON(data []byte) error {
@@ -249,15 +278,19 @@ func (errs *Errors) UnmarshalJSON(data []byte) error {
 	for _, daErr := range tmpErrs.Errors {
 		// If Message is empty or exactly matches the Code's message string
 		// then just use the Code, no need for a full Error struct
-		if daErr.Detail == nil && (daErr.Message == "" || daErr.Message == daErr.Code.Message()) {
+		if daErr.Detail == nil && (daErr.Message == "" || daErr.Message == daErr.Code.Message()) &&
+			(daErr.DocumentationURL == "" || daErr.DocumentationURL == daErr.Code.Descriptor().DocumentationURL) &&
+			daErr.RequestID == "" {
 			// Error's w/o details get converted to ErrorCode
 			newErrs = append(newErrs, daErr.Code)
 		} else {
 			// Error's w/ details are untouched
 			newErrs = append(newErrs, Error{
-				Code:    daErr.Code,
-				Message: daErr.Message,
-				Detail:  daErr.Detail,
+				Code:             daErr.Code,
+				Message:          daErr.Message,
+				Detail:           daErr.Detail,
+				DocumentationURL: daErr.DocumentationURL,
+				RequestID:        daErr.RequestID,
 			})
 		}
 	}
@@ -3,6 +3,7 @@ package errcode
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -31,6 +32,14 @@ var ErrorCodeTest3 = Register("test.errors", ErrorDescriptor{
 	HTTPStatusCode: http.StatusNotFound,
 })
 
+var ErrorCodeTest4 = Register("test.errors", ErrorDescriptor{
+	Value:            "TEST4",
+	Message:          "test error 4",
+	Description:      `Just a test message #4.`,
+	HTTPStatusCode:   http.StatusForbidden,
+	DocumentationURL: "https://docs.example.com/errors/test4",
+})
+
 // TestErrorCodes ensures that error code format, mappings and
 // marshaling/unmarshaling. round trips are stable.
 func TestErrorCodes(t *testing.T) {
@@ -183,3 +192,66 @@ func TestErrorsManagement(t *testing.T) {
 	}
 
 }
+
+// TestErrorDocumentationAndRequestID checks that documentation links and
+// request ids are marshaled, and round trip.
+func TestErrorDocumentationAndRequestID(t *testing.T) {
+	withRequestID := ErrorCodeTest1.WithDetail(nil)
+	withRequestID.RequestID = "d9f2b5a0"
+	withRequestID.DocumentationURL = "https://docs.example.com/errors/test1"
+
+	errs := Errors{ErrorCodeTest4, withRequestID}
+	p, err := json.Marshal(errs)
+	if err != nil {
+		t.Fatalf("error marashaling errors: %v", err)
+	}
+
+	expectedJSON := `{"errors":[` +
+		`{"code":"TEST4","message":"test error 4","documentation_url":"https://docs.example.com/errors/test4"},` +
+		`{"code":"TEST1","message":"test error 1","documentation_url":"https://docs.example.com/errors/test1","request_id":"d9f2b5a0"}` +
+		`]}`
+	if string(p) != expectedJSON {
+		t.Fatalf("unexpected json:\ngot:\n%q\n\nexpected:\n%q", string(p), expectedJSON)
+	}
+
+	var unmarshaled Errors
+	if err := json.Unmarshal(p, &unmarshaled); err != nil {
+		t.Fatalf("unexpected error unmarshaling error envelope: %v", err)
+	}
+
+	if !reflect.DeepEqual(unmarshaled, errs) {
+		t.Fatalf("errors not equal after round trip:\nunmarshaled:\n%#v\n\nerrs:\n%#v", unmarshaled, errs)
+	}
+}
+
+type quotaExceeded struct{}
+
+func (quotaExceeded) Error() string        { return "quota of 10GB exceeded" }
+func (quotaExceeded) ErrorCode() ErrorCode { return ErrorCodeTest4 }
+
+// TestAsError checks that errors with a code of their own keep it when
+// wrapped as the detail of an unknown error.
+func TestAsError(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected Error
+	}{
+		{ErrorCodeTest1, Error{Code: ErrorCodeTest1, Message: "test error 1"}},
+		{quotaExceeded{}, Error{Code: ErrorCodeTest4, Message: "test error 4", Detail: "quota of 10GB exceeded"}},
+		{ErrorCodeUnknown.WithDetail(quotaExceeded{}), Error{Code: ErrorCodeTest4, Message: "test error 4", Detail: "quota of 10GB exceeded"}},
+		{ErrorCodeUnknown.WithDetail(ErrorCodeTest2.WithDetail("data")), Error{Code: ErrorCodeTest2, Message: "test error 2", Detail: "data"}},
+		{ErrorCodeUnknown.WithDetail("data"), Error{Code: ErrorCodeUnknown, Message: "unknown error", Detail: "data"}},
+	} {
+		if err := AsError(tc.err); !reflect.DeepEqual(err, tc.expected) {
+			t.Errorf("unexpected error for %#v: %#v", tc.err, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := ServeJSON(w, Errors{ErrorCodeUnknown.WithDetail(quotaExceeded{})}); err != nil {
+		t.Fatalf("unexpected error serving errors: %v", err)
+	}
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", w.Code)
+	}
+}
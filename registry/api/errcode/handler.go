@@ -18,11 +18,11 @@ func ServeJSON(w http.ResponseWriter, err error) error {
 			break
 		}
 
-		if err, ok := errs[0].(ErrorCoder); ok {
-			sc = err.ErrorCode().Descriptor().HTTPStatusCode
+		if _, ok := errs[0].(ErrorCoder); ok {
+			sc = AsError(errs[0]).Code.Descriptor().HTTPStatusCode
 		}
 	case ErrorCoder:
-		sc = errs.ErrorCode().Descriptor().HTTPStatusCode
+		sc = AsError(err).Code.Descriptor().HTTPStatusCode
 		err = Errors{err} // create an envelope.
 	default:
 		// We just have an unhandled error type, so just place in an envelope
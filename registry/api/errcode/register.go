@@ -63,6 +63,16 @@ var (
 		Description:    "Returned when a service is not available",
 		HTTPStatusCode: http.StatusServiceUnavailable,
 	})
+
+	// ErrorCodeRequestTimeout is returned when a request does not complete
+	// within the time configured for it.
+	ErrorCodeRequestTimeout = Register("errcode", ErrorDescriptor{
+		Value:   "REQUEST_TIMEOUT",
+		Message: "request timed out",
+		Description: `Returned when a request, including the reading of its
+		body, did not complete within the time the registry allows for it.`,
+		HTTPStatusCode: http.StatusRequestTimeout,
+	})
 )
 
 var nextCode = 1000
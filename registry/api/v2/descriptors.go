@@ -112,6 +112,26 @@ var (
 		},
 	}
 
+	trustRoleParameterDescriptor = ParameterDescriptor{
+		Name:        "role",
+		Type:        "string",
+		Format:      TrustRoleRegexp.String(),
+		Required:    true,
+		Description: `Name of the TUF role, such as root or a role delegated from targets.`,
+	}
+
+	trustNotEnabledResponseDescriptor = ResponseDescriptor{
+		Description: "Trust metadata storage is not enabled on the registry.",
+		StatusCode:  http.StatusMethodNotAllowed,
+		ErrorCodes: []errcode.ErrorCode{
+			errcode.ErrorCodeUnsupported,
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+	}
+
 	unauthorizedResponseDescriptor = ResponseDescriptor{
 		Name:        "Authentication Required",
 		StatusCode:  http.StatusUnauthorized,
@@ -175,9 +195,54 @@ var (
 			errcode.ErrorCodeDenied,
 		},
 	}
+
+	residencyDeniedResponseDescriptor = ResponseDescriptor{
+		Name:        "Residency Denied",
+		StatusCode:  http.StatusForbidden,
+		Description: "The data residency policy of the registry does not allow storing the content in the region of the repository.",
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeResidencyDenied,
+		},
+	}
+
+	blobRestoringResponseDescriptor = ResponseDescriptor{
+		Name:        "Blob Restoring",
+		StatusCode:  http.StatusAccepted,
+		Description: "The blob was moved to archive storage by the tiering policy of the registry, and is being restored. The request should be made again once the time given by `Retry-After` has elapsed.",
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Retry-After",
+				Type:        "integer",
+				Description: "The number of seconds after which the blob may be readable.",
+				Format:      "<seconds>",
+			},
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeBlobRestoring,
+		},
+	}
 )
 
 const (
+	repositoryDeletionBody = `{
+    "id": <id>,
+    "name": <name>,
+    "state": "running" | "completed" | "failed",
+    "tags": <number of tags removed>,
+    "manifests": <number of manifests removed>,
+    "error": <message>,
+    "started": <RFC3339 time>,
+    "finished": <RFC3339 time>
+}`
+
 	manifestBody = `{
    "name": <name>,
    "tag": <tag>,
@@ -447,6 +512,71 @@ var routeDescriptors = []RouteDescriptor{
 							deniedResponseDescriptor,
 						},
 					},
+					{
+						Name:           "Tags Ordered",
+						Description:    "Return the tags of the repository in the order given by the `order` query parameter: `lastupdate` lists the most recently pushed tags first.",
+						PathParameters: []ParameterDescriptor{nameParameterDescriptor},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "order",
+								Type:        "string",
+								Format:      "lastupdate",
+								Required:    true,
+								Description: "Order of the tags. `lastupdate` sorts tags by the time they were last pushed, most recent first, tags pushed at the same time being sorted by name.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "A list of tags for the named repository, in the requested order.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "tags": [
+        <tag>,
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The order is not supported.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeOrderInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The registry is a pull through cache, which cannot order tags by their last update.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
 					{
 						Name:            "Tags Paginated",
 						Description:     "Return a portion of the tags for the specified repository.",
@@ -488,14 +618,14 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 	{
-		Name:        RouteNameManifest,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
-		Entity:      "Manifest",
-		Description: "Create, update, delete and retrieve manifests.",
+		Name:        RouteNameTagsSnapshot,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/tags/snapshot",
+		Entity:      "Tags Snapshot",
+		Description: "Retrieve a signed snapshot of the tags of a repository, allowing deployment tools to verify the digest each tag pointed to at a point in time. The endpoint is only available if enabled in the registry configuration.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the tags under the repository identified by `name` and the digests they point to, signed by the registry.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -504,28 +634,40 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
 								StatusCode:  http.StatusOK,
+								Description: "A snapshot of the tags of the named repository, signed with a JSON web signature in the `signatures` field. The signature header includes the public key of the registry.",
 								Headers: []ParameterDescriptor{
 									digestHeader,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/json; charset=utf-8",
-									Format:      manifestBody,
+									ContentType: "application/vnd.docker.distribution.tags.snapshot.v1+prettyjws",
+									Format: `{
+   "name": <name>,
+   "timestamp": <RFC3339 time>,
+   "tags": {
+      <tag>: <digest>,
+      ...
+   },
+   "signatures": [
+      {
+         "header": <jws header>,
+         "signature": <signature>,
+         "protected": <protected header>
+      }
+   ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "The name or reference was invalid.",
-								StatusCode:  http.StatusBadRequest,
+								Description: "Tag snapshots are not enabled on the registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
+									errcode.ErrorCodeUnsupported,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -539,9 +681,17 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameManifestSearch,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_manifests",
+		Entity:      "Manifest Search",
+		Description: "Find the image manifests of a repository by their annotations or the labels of their image configuration, for deployment tools resolving images by metadata rather than by tag. Manifests are selected from an index built as they are pushed, so manifests pushed before the index was enabled are not found. The endpoint is only available if enabled in the registry configuration.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PUT",
-				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Method:      "GET",
+				Description: "Fetch the digests and metadata of the manifests of the repository identified by `name` which match every selector of the query, most recently pushed first.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -550,85 +700,99 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/json; charset=utf-8",
-							Format:      manifestBody,
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "annotation",
+								Type:        "query",
+								Format:      "<key>=<pattern>",
+								Description: "Select the manifests whose annotation `key` has a value matching `pattern`, in which `*` matches any sequence of characters. May be repeated.",
+							},
+							{
+								Name:        "label",
+								Type:        "query",
+								Format:      "<key>=<pattern>",
+								Description: "Select the manifests whose image configuration has a label `key` with a value matching `pattern`. May be repeated.",
+							},
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
-								StatusCode:  http.StatusCreated,
+								StatusCode:  http.StatusOK,
+								Description: "The manifests of the repository selected by the query.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The canonical location url of the uploaded manifest.",
-										Format:      "<url>",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									digestHeader,
 								},
-							},
-						},
-						Failures: []ResponseDescriptor{
-							{
-								Name:        "Invalid Manifest",
-								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
-								StatusCode:  http.StatusBadRequest,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
-									Format:      errorsBody,
-								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-									ErrorCodeManifestInvalid,
-									ErrorCodeManifestUnverified,
-									ErrorCodeBlobUnknown,
+									Format: `{
+	"name": <name>,
+	"manifests": [
+		{
+			"digest": <digest>,
+			"mediaType": <media type>,
+			"annotations": {
+				<key>: <value>,
+				...
+			},
+			"labels": {
+				<key>: <value>,
+				...
+			},
+			"image": <image metadata>,
+			"indexed": <RFC3339 time>
+		},
+		...
+	]
+}`,
 								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
+						},
+						Failures: []ResponseDescriptor{
 							{
-								Name:        "Missing Layer(s)",
-								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
+								Description: "A selector of the query is not of the form `<key>=<pattern>`.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUnknown,
+									ErrorCodeSelectorInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
-									Format: `{
-    "errors:" [{
-            "code": "BLOB_UNKNOWN",
-            "message": "blob unknown to registry",
-            "detail": {
-                "digest": "<digest>"
-            }
-        },
-        ...
-    ]
-}`,
+									Format:      errorsBody,
 								},
 							},
 							{
-								Name:        "Not allowed",
-								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								Description: "The manifest index is not enabled on the registry.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
 							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
 						},
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameManifestCompare,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_compare",
+		Entity:      "Manifest Comparison",
+		Description: "Compare the layers of two image manifests of a repository, so that clients can report the layers and size a release adds or removes without downloading its blobs.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "DELETE",
-				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Method:      "GET",
+				Description: "Fetch the layers shared by the manifests `from` and `to` of the repository identified by `name`, and the layers only found in either of them, with their sizes. Layers are listed once, in the order of the manifests, base layers first.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -637,20 +801,75 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<reference>",
+								Required:    true,
+								Description: "Tag or digest of the manifest compared against.",
+							},
+							{
+								Name:        "to",
+								Type:        "query",
+								Format:      "<reference>",
+								Required:    true,
+								Description: "Tag or digest of the manifest compared.",
+							},
+							{
+								Name:        "platform",
+								Type:        "query",
+								Format:      "<os>/<architecture>[/<variant>]",
+								Description: "Platform of the image manifests compared when a reference is a manifest list. Defaults to `linux/amd64`.",
+							},
 						},
 						Successes: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusAccepted,
+								StatusCode:  http.StatusOK,
+								Description: "The layers of the manifests compared.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"name": <name>,
+	"from": {
+		"digest": <digest>,
+		"size": <size of all layers>
+	},
+	"to": {
+		"digest": <digest>,
+		"size": <size of all layers>
+	},
+	"shared": [
+		{
+			"mediaType": <media type>,
+			"size": <size>,
+			"digest": <digest>
+		},
+		...
+	],
+	"added": [...],
+	"removed": [...],
+	"sharedSize": <size of shared layers>,
+	"addedSize": <size of added layers>,
+	"removedSize": <size of removed layers>
+}`,
+								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:        "Invalid Name or Reference",
-								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								Description: "A reference is missing or invalid, or the platform is malformed.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
 									ErrorCodeTagInvalid,
 								},
 								Body: BodyDescriptor{
@@ -658,15 +877,10 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
 							{
-								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								Description: "A manifest is unknown to the registry, or a manifest list has no manifest of the platform.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
 									ErrorCodeManifestUnknown,
 								},
 								Body: BodyDescriptor{
@@ -674,182 +888,204 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
-							{
-								Name:        "Not allowed",
-								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
-								StatusCode:  http.StatusMethodNotAllowed,
-								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
-								},
-							},
-						},
-					},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
 				},
 			},
 		},
 	},
-
 	{
-		Name:        RouteNameBlob,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
-		Entity:      "Blob",
-		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Name:        RouteNameManifest,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Manifest",
+		Description: "Create, update, delete and retrieve manifests.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
 				Requests: []RequestDescriptor{
 					{
-						Name: "Fetch Blob",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							digestPathParameter,
+							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
+								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
 								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
-									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "The length of the requested blob content.",
-										Format:      "<length>",
-									},
 									digestHeader,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
-								},
-							},
-							{
-								Description: "The blob identified by `digest` is available at the provided location.",
-								StatusCode:  http.StatusTemporaryRedirect,
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The location where the layer should be accessible.",
-										Format:      "<blob location>",
-									},
-									digestHeader,
+									ContentType: "application/json; charset=utf-8",
+									Format:      manifestBody,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								Description: "The name or reference was invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeDigestInvalid,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json; charset=utf-8",
-									Format:      errorsBody,
+									ErrorCodeTagInvalid,
 								},
-							},
-							{
-								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
-								StatusCode:  http.StatusNotFound,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
-								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 						},
 					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Fetch Blob Part",
-						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 							{
-								Name:        "Range",
+								Name:        "If-Match",
 								Type:        "string",
-								Description: "HTTP Range header specifying blob chunk.",
-								Format:      "bytes=<start>-<end>",
+								Description: "When putting the manifest under a tag, only move the tag if it currently points at one of the listed digests, quoted or not, or if it exists for `*`. Concurrent clients can then update a tag without overwriting each other's updates.",
+								Format:      `"<digest>"[, "<digest>"...] | *`,
 							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							digestPathParameter,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json; charset=utf-8",
+							Format:      manifestBody,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
-								StatusCode:  http.StatusPartialContent,
+								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
+								StatusCode:  http.StatusCreated,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "The length of the requested blob chunk.",
-										Format:      "<length>",
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the uploaded manifest.",
+										Format:      "<url>",
 									},
+									contentLengthZeroHeader,
+									digestHeader,
 									{
-										Name:        "Content-Range",
-										Type:        "byte range",
-										Description: "Content range of blob chunk.",
-										Format:      "bytes <start>-<end>/<size>",
+										Name:        "Docker-Build-Group-Digest",
+										Type:        "digest",
+										Description: "If build groups are enabled in the registry configuration and the image manifest carries the build group annotation, the digest of the manifest list tagged with the name of the group, which the manifest was added to.",
+										Format:      "<digest>",
 									},
 								},
-								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
-								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								Name:        "Invalid Manifest",
+								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
 								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeDigestInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeManifestUnverified,
+									ErrorCodeBlobUnknown,
 								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							residencyDeniedResponseDescriptor,
+							{
+								Name:        "Tag Precondition Failed",
+								Description: "The tag does not point at a manifest listed in the `If-Match` header. The tag was left unchanged and the error detail holds the digest it points at, empty if the tag does not exist.",
+								StatusCode:  http.StatusPreconditionFailed,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
-									Format:      errorsBody,
+									Format: `{
+    "errors:" [{
+            "code": "TAG_PRECONDITION_FAILED",
+            "message": "tag does not point at the expected manifest",
+            "detail": {
+                "tag": "<tag>",
+                "digest": "<digest>"
+            }
+        }
+    ]
+}`,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTagPreconditionFailed,
 								},
 							},
 							{
-								StatusCode: http.StatusNotFound,
+								Name:        "Missing Layer(s)",
+								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
 									ErrorCodeBlobUnknown,
 								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "errors:" [{
+            "code": "BLOB_UNKNOWN",
+            "message": "blob unknown to registry",
+            "detail": {
+                "digest": "<digest>"
+            }
+        },
+        ...
+    ]
+}`,
+								},
+							},
+							{
+								Name:        "Manifest Too Large",
+								Description: "The manifest is larger than the registry accepts for manifests of its media type. The error detail holds the limit, in bytes.",
+								StatusCode:  http.StatusRequestEntityTooLarge,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestTooLarge,
+								},
 							},
 							{
-								Description: "The range specification cannot be satisfied for the requested content. This can happen when the range is not formatted correctly or if the range is outside of the valid size of the content.",
-								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+								Name:        "Not allowed",
+								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
 						},
 					},
 				},
 			},
 			{
 				Method:      "DELETE",
-				Description: "Delete the blob identified by `name` and `digest`",
+				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -858,246 +1094,233 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							digestPathParameter,
+							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
 								StatusCode: http.StatusAccepted,
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "0",
-										Format:      "0",
-									},
-									digestHeader,
-								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Name:        "Invalid Name or Reference",
+								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
 								},
-							},
-							{
-								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
-								StatusCode:  http.StatusNotFound,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							{
+								Name:        "Unknown Manifest",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
+									ErrorCodeManifestUnknown,
 								},
-							},
-							{
-								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
-								StatusCode:  http.StatusMethodNotAllowed,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
 						},
 					},
 				},
 			},
-
-			// TODO(stevvooe): We may want to add a PUT request here to
-			// kickoff an upload of a blob, integrated with the blob upload
-			// API.
 		},
 	},
 
 	{
-		Name:        RouteNameBlobUpload,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/",
-		Entity:      "Initiate Blob Upload",
-		Description: "Initiate a blob upload. This endpoint can be used to create resumable uploads or monolithic uploads.",
+		Name:        RouteNameManifestMetadata,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}/metadata",
+		Entity:      "Manifest Metadata",
+		Description: "Details of an image manifest and of its image configuration, extracted when the manifest was pushed, so that clients can describe images without fetching their configuration blob. Only image manifests pushed while the manifest index is enabled in the registry configuration have metadata.",
 		Methods: []MethodDescriptor{
 			{
-				Method:      "POST",
-				Description: "Initiate a resumable blob upload. If successful, an upload location will be provided to complete the upload. Optionally, if the `digest` parameter is present, the request body will be used to complete the upload in a single request.",
+				Method:      "GET",
+				Description: "Fetch the metadata of the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Initiate Monolithic Blob Upload",
-						Description: "Upload a blob identified by the `digest` parameter in single request. This upload will not be resumable unless a recoverable error is returned.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:   "Content-Length",
-								Type:   "integer",
-								Format: "<length of blob>",
-							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-						},
-						QueryParameters: []ParameterDescriptor{
-							{
-								Name:        "digest",
-								Type:        "query",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Description: `Digest of uploaded blob. If present, the upload will be completed, in a single request, with contents of the request body as the resulting blob.`,
-							},
-						},
-						Body: BodyDescriptor{
-							ContentType: "application/octect-stream",
-							Format:      "<binary data>",
+							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob has been created in the registry and is available at the provided location.",
-								StatusCode:  http.StatusCreated,
+								StatusCode:  http.StatusOK,
+								Description: "The metadata of the manifest.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:   "Location",
-										Type:   "url",
-										Format: "<blob location>",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
 								},
-							},
-						},
-						Failures: []ResponseDescriptor{
-							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"digest": <digest>,
+	"mediaType": <media type>,
+	"annotations": {
+		<key>: <value>,
+		...
+	},
+	"labels": {
+		<key>: <value>,
+		...
+	},
+	"image": {
+		"created": <RFC3339 time>,
+		"architecture": <architecture>,
+		"os": <os>,
+		"entrypoint": [<argument>, ...],
+		"cmd": [<argument>, ...],
+		"env": [<name>=<value>, ...],
+		"exposedPorts": [<port>/<protocol>, ...]
+	},
+	"indexed": <RFC3339 time>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name or reference are invalid.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
 								},
 							},
 							{
-								Name:        "Not allowed",
-								Description: "Blob upload is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								Description: "The manifest is unknown to the registry, or has no metadata because it is not an image manifest or was pushed before the index was enabled.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The manifest index is not enabled on the registry.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 						},
 					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameManifestSBOM,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}/sbom",
+		Entity:      "Manifest SBOM",
+		Description: "The software bill of materials of an image. SBOMs are stored as artifact manifests referring to the image manifest as their subject, either pushed by clients or generated by the registry when an SBOM generator is configured.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the most recently stored SBOM of the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Initiate Resumable Blob Upload",
-						Description: "Initiate a resumable blob upload with an empty request body.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							contentLengthZeroHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
+							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The upload has been created. The `Location` header must be used to complete the upload. The response should be identical to a `GET` request on the contents of the returned `Location` header.",
-								StatusCode:  http.StatusAccepted,
+								StatusCode:  http.StatusOK,
+								Description: "The SBOM of the manifest, in the format it was stored in.",
 								Headers: []ParameterDescriptor{
-									contentLengthZeroHeader,
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the created upload. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the SBOM.",
+										Format:      "<length>",
 									},
 									{
-										Name:        "Range",
-										Format:      "0-0",
-										Description: "Range header indicating the progress of the upload. When starting an upload, it will return an empty range, since no content has been received.",
+										Name:        "Docker-Content-Digest",
+										Type:        "digest",
+										Description: "Digest of the SBOM blob.",
+										Format:      "<digest>",
 									},
-									dockerUploadUUIDHeader,
-								},
-							},
-						},
-						Failures: []ResponseDescriptor{
-							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
-									ErrorCodeNameInvalid,
-								},
-							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-						},
-					},
-					{
-						Name:        "Mount Blob",
-						Description: "Mount a blob identified by the `mount` parameter from another repository.",
-						Headers: []ParameterDescriptor{
-							hostHeader,
-							authHeader,
-							contentLengthZeroHeader,
-						},
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-						},
-						QueryParameters: []ParameterDescriptor{
-							{
-								Name:        "mount",
-								Type:        "query",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Description: `Digest of blob to mount from the source repository.`,
-							},
-							{
-								Name:        "from",
-								Type:        "query",
-								Format:      "<repository name>",
-								Regexp:      reference.NameRegexp,
-								Description: `Name of the source repository.`,
-							},
-						},
-						Successes: []ResponseDescriptor{
-							{
-								Description: "The blob has been mounted in the repository and is available at the provided location.",
-								StatusCode:  http.StatusCreated,
-								Headers: []ParameterDescriptor{
 									{
-										Name:   "Location",
-										Type:   "url",
-										Format: "<blob location>",
+										Name:        "Docker-Artifact-Digest",
+										Type:        "digest",
+										Description: "Digest of the artifact manifest of the SBOM.",
+										Format:      "<digest>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "<SBOM media type>",
+									Format:      "<SBOM>",
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:       "Invalid Name or Digest",
-								StatusCode: http.StatusBadRequest,
+								Description: "The name or reference are invalid.",
+								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
 								},
 							},
 							{
-								Name:        "Not allowed",
-								Description: "Blob mount is not allowed because the registry is configured as a pull-through cache or for some other reason",
-								StatusCode:  http.StatusMethodNotAllowed,
+								Description: "The manifest is unknown to the registry, or has no SBOM.",
+								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
+									ErrorCodeManifestUnknown,
+									ErrorCodeSBOMUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
 								},
 							},
 							unauthorizedResponseDescriptor,
@@ -1111,50 +1334,75 @@ var routeDescriptors = []RouteDescriptor{
 	},
 
 	{
-		Name:        RouteNameBlobUploadChunk,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/{uuid:[a-zA-Z0-9-_.=]+}",
-		Entity:      "Blob Upload",
-		Description: "Interact with blob uploads. Clients should never assemble URLs for this endpoint and should only take it through the `Location` header on related API requests. The `Location` header and its parameters should be preserved by clients, using the latest value returned via upload related API calls.",
+		Name:        RouteNameManifestGraph,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}/graph",
+		Entity:      "Manifest Graph",
+		Description: "The graph of the manifests and blobs an image is made of, from a manifest list down to the configuration and layers of the manifest of each platform, so that tooling can reason about an image without fetching each of its manifests.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Retrieve status of upload identified by `uuid`. The primary purpose of this endpoint is to resolve the current status of a resumable upload.",
+				Description: "Fetch the graph of the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Retrieve the progress of the current upload, as reported by the `Range` header.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							uuidParameterDescriptor,
+							referenceParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Progress",
-								Description: "The upload is known and in progress. The last received offset is available in the `Range` header.",
-								StatusCode:  http.StatusNoContent,
+								StatusCode:  http.StatusOK,
+								Description: "The graph of the manifest. Each node is a descriptor of a manifest or blob, with its role, the platform of the manifests of a list, and its children: the manifests of a list, or the configuration and layers of a manifest, base layers first. Manifests of a list which are not stored are marked as missing. The total size counts each distinct manifest and blob once.",
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"name": <name>,
+	"reference": <tag or digest>,
+	"root": {
+		"mediaType": <media type>,
+		"size": <size>,
+		"digest": <digest>,
+		"role": "manifest",
+		"children": [
+			{
+				"mediaType": <media type>,
+				"size": <size>,
+				"digest": <digest>,
+				"role": "manifest" | "config" | "layer",
+				"platform": {
+					"architecture": <architecture>,
+					"os": <os>,
+					...
+				},
+				"missing": <boolean>,
+				"children": [...]
+			},
+			...
+		]
+	},
+	"totalSize": <size>
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "The name or reference are invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeTagInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1162,10 +1410,10 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								Description: "The manifest is unknown to the registry.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									ErrorCodeManifestUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1179,56 +1427,68 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlob,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Blob",
+		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PATCH",
-				Description: "Upload a chunk of data for the specified upload.",
+				Method:      "GET",
+				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Stream upload",
-						Description: "Upload a stream of data to upload without completing the upload.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
+						Name: "Fetch Blob",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary data>",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Data Accepted",
-								Description: "The stream of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
+								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob content.",
+										Format:      "<length>",
 									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+							{
+								Description: "The blob identified by `digest` is available at the provided location.",
+								StatusCode:  http.StatusTemporaryRedirect,
+								Headers: []ParameterDescriptor{
 									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Name:        "Location",
+										Type:        "url",
+										Description: "The location where the layer should be accessible.",
+										Format:      "<blob location>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+									digestHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1236,80 +1496,71 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
 								StatusCode:  http.StatusNotFound,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
-								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+								},
 							},
+							blobRestoringResponseDescriptor,
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 						},
 					},
 					{
-						Name:        "Chunked upload",
-						Description: "Upload a chunk of data to specified upload without completing the upload. The data will be uploaded to the specified Content Range.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
+						Name:        "Fetch Blob Part",
+						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
 							{
-								Name:        "Content-Range",
-								Type:        "header",
-								Format:      "<start of range>-<end of range, inclusive>",
-								Required:    true,
-								Description: "Range of bytes identifying the desired block of content represented by the body. Start must the end offset retrieved via status check plus one. Note that this is a non-standard use of the `Content-Range` header.",
-							},
-							{
-								Name:        "Content-Length",
-								Type:        "integer",
-								Format:      "<length of chunk>",
-								Description: "Length of the chunk being uploaded, corresponding the length of the request body.",
+								Name:        "Range",
+								Type:        "string",
+								Description: "HTTP Range header specifying blob chunk.",
+								Format:      "bytes=<start>-<end>",
 							},
 						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary chunk>",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Chunk Accepted",
-								Description: "The chunk of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
+								StatusCode:  http.StatusPartialContent,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "/v2/<name>/blobs/uploads/<uuid>",
-										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob chunk.",
+										Format:      "<length>",
 									},
 									{
-										Name:        "Range",
-										Type:        "header",
-										Format:      "0-<offset>",
-										Description: "Range indicating the current progress of the upload.",
+										Name:        "Content-Range",
+										Type:        "byte range",
+										Description: "Content range of blob chunk.",
+										Format:      "bytes <start>-<end>/<size>",
 									},
-									contentLengthZeroHeader,
-									dockerUploadUUIDHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1317,10 +1568,10 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
-								StatusCode:  http.StatusNotFound,
+								StatusCode: http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1328,9 +1579,10 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
+								Description: "The range specification cannot be satisfied for the requested content. This can happen when the range is not formatted correctly or if the range is outside of the valid size of the content.",
 								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
 							},
+							blobRestoringResponseDescriptor,
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
@@ -1339,87 +1591,63 @@ var routeDescriptors = []RouteDescriptor{
 				},
 			},
 			{
-				Method:      "PUT",
-				Description: "Complete the upload specified by `uuid`, optionally appending the body as the final chunk.",
+				Method:      "DELETE",
+				Description: "Delete the blob identified by `name` and `digest`",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Complete the upload, providing all the data in the body, if necessary. A request without a body will just complete the upload with previously uploaded content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:        "Content-Length",
-								Type:        "integer",
-								Format:      "<length of data>",
-								Description: "Length of the data being uploaded, corresponding to the length of the request body. May be zero if no data is provided.",
-							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
-						QueryParameters: []ParameterDescriptor{
-							{
-								Name:        "digest",
-								Type:        "string",
-								Format:      "<digest>",
-								Regexp:      digest.DigestRegexp,
-								Required:    true,
-								Description: `Digest of uploaded blob.`,
-							},
-						},
-						Body: BodyDescriptor{
-							ContentType: "application/octet-stream",
-							Format:      "<binary data>",
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Complete",
-								Description: "The upload has been completed and accepted by the registry. The canonical location will be available in the `Location` header.",
-								StatusCode:  http.StatusNoContent,
+								StatusCode: http.StatusAccepted,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Format:      "<blob location>",
-										Description: "The canonical location of the blob for retrieval",
-									},
-									{
-										Name:        "Content-Range",
-										Type:        "header",
-										Format:      "<start of range>-<end of range, inclusive>",
-										Description: "Range of bytes identifying the desired block of content represented by the body. Start must match the end of offset retrieved via status check. Note that this is a non-standard use of the `Content-Range` header.",
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "0",
+										Format:      "0",
 									},
-									contentLengthZeroHeader,
 									digestHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was an error processing the upload and it must be restarted.",
-								StatusCode:  http.StatusBadRequest,
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
-									errcode.ErrorCodeUnsupported,
 								},
+							},
+							{
+								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
-							},
-							{
-								Description: "The upload is unknown to the registry. The upload must be restarted.",
-								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
 								},
+							},
+							{
+								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
+								StatusCode:  http.StatusMethodNotAllowed,
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
@@ -1428,38 +1656,64 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+
+			// TODO(stevvooe): We may want to add a PUT request here to
+			// kickoff an upload of a blob, integrated with the blob upload
+			// API.
+		},
+	},
+
+	{
+		Name:        RouteNameBlobTOC,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}/toc",
+		Entity:      "Blob TOC",
+		Description: "Access to the table of contents of eStargz layers, allowing lazy-pulling clients to locate files within a layer before fetching them with range requests on the blob.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "DELETE",
-				Description: "Cancel outstanding upload processes, releasing associated resources. If this is not called, the unfinished uploads will eventually timeout.",
+				Method:      "GET",
+				Description: "Retrieve the table of contents section of the eStargz blob identified by `digest`, as stored in the blob. A `HEAD` request can also be issued to this endpoint to obtain the location of the section without receiving it.",
 				Requests: []RequestDescriptor{
 					{
-						Description: "Cancel the upload specified by `uuid`.",
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							uuidParameterDescriptor,
-						},
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Name:        "Upload Deleted",
-								Description: "The upload has been successfully deleted.",
-								StatusCode:  http.StatusNoContent,
+								Description: "The table of contents of the blob is available. The gzip compressed section will be present in the body of the response.",
+								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
-									contentLengthZeroHeader,
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the table of contents section.",
+										Format:      "<length>",
+									},
+									{
+										Name:        "Docker-TOC-Offset",
+										Type:        "integer",
+										Description: "The offset of the table of contents section within the blob.",
+										Format:      "<offset>",
+									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<gzip compressed table of contents>",
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "An error was encountered processing the delete. The client may ignore this error.",
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `digest`.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeBlobUploadInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -1467,15 +1721,17 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The upload is unknown to the registry. The client may ignore this error and assume the upload has been deleted.",
+								Description: "The blob is unknown to the registry or is not an eStargz layer.",
 								StatusCode:  http.StatusNotFound,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUploadUnknown,
-								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+									ErrorCodeBlobTOCUnknown,
+								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
@@ -1486,70 +1742,1390 @@ var routeDescriptors = []RouteDescriptor{
 			},
 		},
 	},
+
 	{
-		Name:        RouteNameCatalog,
-		Path:        "/v2/_catalog",
-		Entity:      "Catalog",
-		Description: "List a set of available repositories in the local registry cluster. Does not provide any indication of what may be available upstream. Applications can only determine if a repository is available but not if it is not available.",
+		Name:        RouteNameBlobDelta,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}/delta",
+		Entity:      "Blob Delta",
+		Description: "Access to binary deltas between the blobs of a repository, so that clients holding a layer of a previous build of an image can rebuild the layer of the new build instead of downloading it.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      "GET",
-				Description: "Retrieve a sorted, json list of repositories available in the registry.",
+				Description: "Retrieve the delta rebuilding the blob identified by `digest` from the blob `from`. The delta is computed on the first request and kept by the registry. A `HEAD` request can also be issued to this endpoint to obtain the size of the delta, computing it if needed.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Catalog Fetch Complete",
-						Description: "Request an unabridged list of repositories available.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<digest>",
+								Required:    true,
+								Description: "Digest of the blob of the repository held by the client, which the delta is applied to.",
+							},
+						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "Returns the unabridged list of repositories as a json response.",
+								Description: "The delta is available. Applying it to the blob `from` yields the blob `digest`, which the client should verify.",
 								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Content-Length",
 										Type:        "integer",
-										Description: "Length of the JSON response body.",
+										Description: "The length of the delta.",
 										Format:      "<length>",
 									},
+									{
+										Name:        "Docker-Delta-Source",
+										Type:        "digest",
+										Description: "Digest of the blob the delta is applied to.",
+										Format:      "<digest>",
+									},
+									digestHeader,
 								},
 								Body: BodyDescriptor{
-									ContentType: "application/json; charset=utf-8",
-									Format: `{
-	"repositories": [
-		<name>,
-		...
-	]
-}`,
+									ContentType: "application/vnd.docker.distribution.blob.delta.v1",
+									Format:      "<delta>",
 								},
 							},
 						},
-					},
-					{
-						Name:            "Catalog Fetch Paginated",
-						Description:     "Return the specified portion of repositories.",
-						QueryParameters: paginationParameters,
-						Successes: []ResponseDescriptor{
+						Failures: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusOK,
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name`, `digest` or `from`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
-									Format: `{
-	"repositories": [
-		<name>,
-		...
-	]
-	"next": "<url>?last=<name>&n=<last value of n>"
-}`,
-								},
-								Headers: []ParameterDescriptor{
-									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "Length of the JSON response body.",
-										Format:      "<length>",
-									},
-									linkHeader,
+									Format:      errorsBody,
 								},
 							},
+							{
+								Description: "Either blob is unknown to the repository, or too large for the registry to compute the delta.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+									ErrorCodeBlobDeltaUnavailable,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobFiles,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}/files",
+		Entity:      "Blob Files",
+		Description: "Access to the index of the files of the layers of a repository, so that their content can be browsed or searched without downloading them.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the files of the layer identified by `digest`, in their order in the layer. Layers are indexed when pushed if the registry is configured to, or else on the first request, and their index kept by the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "q",
+								Type:        "query",
+								Format:      "<string>",
+								Required:    false,
+								Description: "Only list the files whose path contains the string.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The files of the layer are listed, with their path relative to the root of the image file system. Whiteout files are listed as stored in the layer.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "digest": <digest>,
+    "files": [
+        {
+            "path": <path>,
+            "type": "file" | "dir" | "symlink" | "hardlink" | "char" | "block" | "fifo" | "other",
+            "size": <size>,
+            "mode": <permission bits>,
+            "uid": <uid>,
+            "gid": <gid>,
+            "modtime": <time>,
+            "linkname": <link target>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `digest`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The blob is unknown to the repository, is not a layer, or is too large for the registry to index.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+									ErrorCodeBlobFilesUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobVariant,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}/variant",
+		Entity:      "Blob Variant",
+		Description: "Access to the zstd variants the registry stores of the popular gzip layers of a repository, so that clients accepting zstd layers download less. A variant is a blob of its own, addressed by its own digest: the blob itself is always served as pushed.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the zstd variant of the gzip layer identified by `digest`. A `HEAD` request can also be issued to this endpoint to check whether a variant is stored without receiving it. The layer should be fetched instead if no variant is stored.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The variant of the layer is available. Its digest, which the content must be verified against, is returned in `Docker-Content-Digest`.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the variant.",
+										Format:      "<length>",
+									},
+									digestHeader,
+									{
+										Name:        "Docker-Variant-Source",
+										Type:        "digest",
+										Description: "Digest of the layer the variant was recompressed from.",
+										Format:      "<digest>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.layer.v1.tar+zstd",
+									Format:      "<zstd compressed layer>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `digest`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The blob is unknown to the repository, or has no variant stored.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+									ErrorCodeBlobVariantUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobUpload,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/",
+		Entity:      "Initiate Blob Upload",
+		Description: "Initiate a blob upload. This endpoint can be used to create resumable uploads or monolithic uploads.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Initiate a resumable blob upload. If successful, an upload location will be provided to complete the upload. Optionally, if the `digest` parameter is present, the request body will be used to complete the upload in a single request.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Initiate Monolithic Blob Upload",
+						Description: "Upload a blob identified by the `digest` parameter in single request. This upload will not be resumable unless a recoverable error is returned.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:   "Content-Length",
+								Type:   "integer",
+								Format: "<length of blob>",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Description: `Digest of uploaded blob. If present, the upload will be completed, in a single request, with contents of the request body as the resulting blob.`,
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octect-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob has been created in the registry and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:   "Location",
+										Type:   "url",
+										Format: "<blob location>",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Blob upload is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							residencyDeniedResponseDescriptor,
+						},
+					},
+					{
+						Name:        "Initiate Resumable Blob Upload",
+						Description: "Initiate a resumable blob upload with an empty request body.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The upload has been created. The `Location` header must be used to complete the upload. The response should be identical to a `GET` request on the contents of the returned `Location` header.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the created upload. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Format:      "0-0",
+										Description: "Range header indicating the progress of the upload. When starting an upload, it will return an empty range, since no content has been received.",
+									},
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							residencyDeniedResponseDescriptor,
+						},
+					},
+					{
+						Name:        "Mount Blob",
+						Description: "Mount a blob identified by the `mount` parameter from another repository.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "mount",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Description: `Digest of blob to mount from the source repository.`,
+							},
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<repository name>",
+								Regexp:      reference.NameRegexp,
+								Description: `Name of the source repository.`,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob has been mounted in the repository and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:   "Location",
+										Type:   "url",
+										Format: "<blob location>",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Blob mount is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							residencyDeniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobUploadChunk,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/{uuid:[a-zA-Z0-9-_.=]+}",
+		Entity:      "Blob Upload",
+		Description: "Interact with blob uploads. Clients should never assemble URLs for this endpoint and should only take it through the `Location` header on related API requests. The `Location` header and its parameters should be preserved by clients, using the latest value returned via upload related API calls.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve status of upload identified by `uuid`. The primary purpose of this endpoint is to resolve the current status of a resumable upload.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Retrieve the progress of the current upload, as reported by the `Range` header.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Progress",
+								Description: "The upload is known and in progress. The last received offset is available in the `Range` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry or its session has expired. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+									ErrorCodeSessionExpired,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PATCH",
+				Description: "Upload a chunk of data for the specified upload.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Stream upload",
+						Description: "Upload a stream of data to upload without completing the upload.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Data Accepted",
+								Description: "The stream of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry or its session has expired. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+									ErrorCodeSessionExpired,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+					{
+						Name:        "Chunked upload",
+						Description: "Upload a chunk of data to specified upload without completing the upload. The data will be uploaded to the specified Content Range.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Range",
+								Type:        "header",
+								Format:      "<start of range>-<end of range, inclusive>",
+								Required:    true,
+								Description: "Range of bytes identifying the desired block of content represented by the body. Start must the end offset retrieved via status check plus one. Note that this is a non-standard use of the `Content-Range` header.",
+							},
+							{
+								Name:        "Content-Length",
+								Type:        "integer",
+								Format:      "<length of chunk>",
+								Description: "Length of the chunk being uploaded, corresponding the length of the request body.",
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary chunk>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Chunk Accepted",
+								Description: "The chunk of data has been accepted and the current progress is available in the range header. The updated upload location is available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/blobs/uploads/<uuid>",
+										Description: "The location of the upload. Clients should assume this changes after each request. Clients should use the contents verbatim to complete the upload, adding parameters where required.",
+									},
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry or its session has expired. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+									ErrorCodeSessionExpired,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
+								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Complete the upload specified by `uuid`, optionally appending the body as the final chunk.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Complete the upload, providing all the data in the body, if necessary. A request without a body will just complete the upload with previously uploaded content.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Length",
+								Type:        "integer",
+								Format:      "<length of data>",
+								Description: "Length of the data being uploaded, corresponding to the length of the request body. May be zero if no data is provided.",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "string",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Required:    true,
+								Description: `Digest of uploaded blob.`,
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Complete",
+								Description: "The upload has been completed and accepted by the registry. The canonical location will be available in the `Location` header.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<blob location>",
+										Description: "The canonical location of the blob for retrieval",
+									},
+									{
+										Name:        "Content-Range",
+										Type:        "header",
+										Format:      "<start of range>-<end of range, inclusive>",
+										Description: "Range of bytes identifying the desired block of content represented by the body. Start must match the end of offset retrieved via status check. Note that this is a non-standard use of the `Content-Range` header.",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was an error processing the upload and it must be restarted.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry or its session has expired. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+									ErrorCodeSessionExpired,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Cancel outstanding upload processes, releasing associated resources. If this is not called, the unfinished uploads will eventually timeout.",
+				Requests: []RequestDescriptor{
+					{
+						Description: "Cancel the upload specified by `uuid`.",
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Name:        "Upload Deleted",
+								Description: "The upload has been successfully deleted.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "An error was encountered processing the delete. The client may ignore this error.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeBlobUploadInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The client may ignore this error and assume the upload has been deleted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameCatalog,
+		Path:        "/v2/_catalog",
+		Entity:      "Catalog",
+		Description: "List a set of available repositories in the local registry cluster. Does not provide any indication of what may be available upstream. Applications can only determine if a repository is available but not if it is not available.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve a sorted, json list of repositories available in the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Catalog Fetch Complete",
+						Description: "Request an unabridged list of repositories available.",
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Returns the unabridged list of repositories as a json response.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+							},
+						},
+					},
+					{
+						Name:            "Catalog Fetch Paginated",
+						Description:     "Return the specified portion of repositories.",
+						QueryParameters: paginationParameters,
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+	"next": "<url>?last=<name>&n=<last value of n>"
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameExtensions,
+		Path:        "/v2/_extensions",
+		Entity:      "Extensions",
+		Description: "List the extensions of the API provided by the registry, so that clients can detect the features available instead of probing their endpoints. Only the extensions enabled in the registry configuration are listed.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the extensions of the API enabled in the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Returns the extensions as a json response. The endpoints of an extension are path templates relative to the registry host.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"extensions": [
+		{
+			"name": <name>,
+			"description": <description>,
+			"endpoints": [
+				<path>,
+				...
+			]
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameTrust,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_trust/tuf/{role:" + TrustRoleRegexp.String() + "}{checksum:(?:\\.[a-f0-9]{64})?}.json",
+		Entity:      "Trust Metadata",
+		Description: "Store and retrieve the TUF trust metadata of a repository alongside its content, so that signing clients do not require a separate Notary deployment. The metadata of each role is kept in revisions addressed by their sha256 checksum. The registry stores the metadata as uploaded and does not verify its signatures. The endpoint is only available if enabled in the registry configuration.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the current trust metadata of `role`, or the revision of it with the given checksum if the path has the form `<role>.<checksum>.json`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							trustRoleParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The trust metadata of the role.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the trust metadata.",
+										Format:      "<length>",
+									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      "<trust metadata>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							trustNotEnabledResponseDescriptor,
+							{
+								Description: "No trust metadata is stored for the role, or no revision of it has the requested checksum.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTrustMetadataUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Store new trust metadata for `role`, which becomes its current revision.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							trustRoleParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json; charset=utf-8",
+							Format:      "<trust metadata>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The trust metadata has been stored.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location of the stored revision.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							trustNotEnabledResponseDescriptor,
+							{
+								Description: "The trust metadata is not a JSON document or is too large.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTrustMetadataInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Delete all revisions of the trust metadata of `role`. The metadata of roles delegated from it is kept.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							trustRoleParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The trust metadata has been deleted.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							trustNotEnabledResponseDescriptor,
+							{
+								Description: "No trust metadata is stored for the role.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTrustMetadataUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryDeletion,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_deletions/{id:[a-zA-Z0-9-]+}",
+		Entity:      "Repository Deletion",
+		Description: "Poll the status of the deletion of a repository. Clients should take this URL from the `Location` header of the response starting the deletion.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the progress of the deletion identified by `id` of the repository identified by `name`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							{
+								Name:        "id",
+								Type:        "opaque",
+								Required:    true,
+								Description: "The identifier of the deletion, returned by the registry when starting it.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The status of the deletion. Its `state` is `running` until the deletion ends, then `completed`, or `failed` with an `error` describing why the repository could not be fully deleted.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      repositoryDeletionBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The deletion is unknown to the registry instance, or no longer retained.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeRepositoryDeletionUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryImport,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_import",
+		Entity:      "Repository Import",
+		Description: "Import the images of an image archive into a repository, so that registries can be bootstrapped from archives where no client can push. The endpoint is only available if imports are enabled in the registry configuration.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Import the images of the archive uploaded as the request body, written by `docker save` or holding an OCI image layout, into the repository identified by `name`. Images are stored as schema2 manifests, and image indexes as manifest lists, along with their configuration and layers. Each image is tagged with the tags it is named by in the archive, ignoring their repository, unless a `tag` is given.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Type",
+								Type:        "string",
+								Format:      "application/x-tar",
+								Description: "The archive is uploaded as an uncompressed tar archive.",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "tag",
+								Type:        "query",
+								Format:      "<tag>",
+								Description: "Tag of the imported image, instead of the tags of the archive. The archive must then hold a single image.",
+							},
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/x-tar",
+							Format:      "<binary data>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusCreated,
+								Description: "The images of the archive were imported, in the order of the archive.",
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"name": <name>,
+	"images": [
+		{
+			"digest": <digest>,
+			"mediaType": <media type>,
+			"size": <size>,
+			"tags": [<tag>, ...]
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The archive is not a valid image archive, is larger than the configured maximum size, or the tag is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeArchiveInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Importing is not allowed because the registry is configured as a pull-through cache, imports are disabled, or the registry is in read-only mode.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryChecksum,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_checksum",
+		Entity:      "Repository Checksum",
+		Description: "Summarize the tags and manifests of a repository as a single digest, so that replicas and sync jobs can tell whether they hold the same content before enumerating it.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the checksum of the repository identified by `name`. The `tags` and `manifests` digests are the roots of SHA-256 Merkle trees, whose leaves hash `<tag> <digest>\\n` for each tag in the order of the tags, and `<digest>\\n` for each manifest in the order of the digests. Each node hashes the concatenation of its two children, an odd last node is carried to the next level, and the tree of no leaves is the hash of no bytes. The `digest` of the repository hashes the concatenation of the roots of both trees.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "If-None-Match",
+								Type:        "string",
+								Format:      "\"<digest>\"",
+								Description: "The digest of a previous checksum of the repository, answered with `304 Not Modified` if the repository did not change.",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The checksum of the repository.",
+								Headers: []ParameterDescriptor{
+									digestHeader,
+									{
+										Name:        "Etag",
+										Type:        "string",
+										Format:      "\"<digest>\"",
+										Description: "The digest of the repository, quoted.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"name": <name>,
+	"digest": <digest>,
+	"tags": {
+		"digest": <digest>,
+		"count": <number of tags>
+	},
+	"manifests": {
+		"digest": <digest>,
+		"count": <number of manifests>
+	}
+}`,
+								},
+							},
+							{
+								StatusCode:  http.StatusNotModified,
+								Description: "The digest of the repository matches the `If-None-Match` header.",
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		// The repository route matches the paths of other routes, so it
+		// must be routed last.
+		Name:        RouteNameRepository,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}",
+		Entity:      "Repository",
+		Description: "Delete a repository as a whole. The endpoint is only available if deleting repositories is enabled in the registry configuration.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "DELETE",
+				Description: "Delete the tags, manifests and layer links of the repository identified by `name`. The deletion runs in the background, its progress can be polled at the URL returned in the `Location` header. The layers and manifests themselves are removed by the next garbage collection, if no other repository references them.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The deletion has started, or was already running.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/_deletions/<id>",
+										Description: "The URL at which the status of the deletion can be polled.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      repositoryDeletionBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Not allowed",
+								Description: "Repository deletion is not allowed because the registry is configured as a pull-through cache, deletion is disabled, or the registry is in read-only mode.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
 						},
 					},
 				},
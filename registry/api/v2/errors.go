@@ -83,6 +83,17 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeManifestTooLarge is returned when a manifest is larger than
+	// the limit of its media type.
+	ErrorCodeManifestTooLarge = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MANIFEST_TOO_LARGE",
+		Message: "manifest too large",
+		Description: `This error is returned during manifest upload when the
+		payload of the manifest is larger than the size the registry accepts
+		for manifests of its media type. The detail contains the limit.`,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
+
 	// ErrorCodeManifestUnverified is returned when the manifest fails
 	// signature verfication.
 	ErrorCodeManifestUnverified = errcode.Register(errGroup, errcode.ErrorDescriptor{
@@ -116,6 +127,27 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeBlobTOCUnknown is returned when the table of contents of a
+	// blob is requested but the blob is not an eStargz layer.
+	ErrorCodeBlobTOCUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_TOC_UNKNOWN",
+		Message: "blob table of contents unknown",
+		Description: `This error may be returned when the table of contents
+		of a blob is requested but the blob is not an eStargz layer.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeBlobDeltaUnavailable is returned when the delta between two
+	// blobs is requested but the registry does not compute it.
+	ErrorCodeBlobDeltaUnavailable = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_DELTA_UNAVAILABLE",
+		Message: "blob delta unavailable",
+		Description: `This error may be returned when the delta between two
+		blobs is requested but either blob is larger than the registry
+		computes deltas for. The blob should be fetched instead.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
 	// ErrorCodeBlobUploadUnknown is returned when an upload is unknown.
 	ErrorCodeBlobUploadUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "BLOB_UPLOAD_UNKNOWN",
@@ -133,4 +165,156 @@ var (
 		longer proceed.`,
 		HTTPStatusCode: http.StatusNotFound,
 	})
+
+	// ErrorCodeSessionExpired is returned when an upload session has
+	// outlived its deadline.
+	ErrorCodeSessionExpired = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "SESSION_EXPIRED",
+		Message: "blob upload session expired",
+		Description: `The blob upload was started longer ago than the
+		registry allows uploads to last. Its data has been discarded and the
+		upload must be started again.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeTrustMetadataUnknown is returned when no trust metadata is
+	// stored for a role, or no revision with the requested checksum.
+	ErrorCodeTrustMetadataUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TRUST_METADATA_UNKNOWN",
+		Message: "trust metadata unknown to registry",
+		Description: `This error is returned when the trust metadata of a
+		role is requested but none has been stored in the repository, or no
+		revision of it has the requested checksum.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeTrustMetadataInvalid is returned when uploaded trust metadata
+	// cannot be stored.
+	ErrorCodeTrustMetadataInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TRUST_METADATA_INVALID",
+		Message: "trust metadata invalid",
+		Description: `When trust metadata is uploaded, it must be a JSON
+		document no larger than the registry accepts. This error is returned
+		otherwise.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeResidencyDenied is returned when a push or a blob mount
+	// would store data of a repository outside of the regions allowed by
+	// the residency policy of the registry.
+	ErrorCodeResidencyDenied = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "RESIDENCY_DENIED",
+		Message: "data residency policy denies storing the content in this region",
+		Description: `The registry pins repositories to the regions their
+		data may be stored in. This error is returned when content is pushed
+		to a repository stored outside of its allowed regions, or mounted
+		from a repository whose content may not be stored in the region of
+		the target repository.`,
+		HTTPStatusCode: http.StatusForbidden,
+	})
+
+	// ErrorCodeRepositoryDeletionUnknown is returned when polling the
+	// status of a repository deletion that does not exist.
+	ErrorCodeRepositoryDeletionUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "DELETION_UNKNOWN",
+		Message: "repository deletion unknown to registry",
+		Description: `The status of a repository deletion is only retained
+		by the registry instance which started it, and only for its most
+		recent deletions. This error is returned when the deletion is not
+		one of them.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeSelectorInvalid is returned when a manifest search has a
+	// malformed selector.
+	ErrorCodeSelectorInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "SELECTOR_INVALID",
+		Message: "invalid manifest selector",
+		Description: `Manifests are selected by annotations and labels
+		given as <key>=<pattern>. This error is returned when a selector is
+		not of this form.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeSBOMUnknown is returned when a manifest has no software bill
+	// of materials.
+	ErrorCodeSBOMUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "SBOM_UNKNOWN",
+		Message: "SBOM unknown to registry",
+		Description: `This error is returned when the software bill of
+		materials of a manifest is requested, but no SBOM referring to the
+		manifest is stored in the repository.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeTagPreconditionFailed is returned when a manifest is put
+	// under a tag with an If-Match header, and the tag does not point at
+	// one of the given digests.
+	ErrorCodeTagPreconditionFailed = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_PRECONDITION_FAILED",
+		Message: "tag does not point at the expected manifest",
+		Description: `A manifest put under a tag with an If-Match header
+		only moves the tag if it currently points at one of the listed
+		digests, or exists for "*". This error is returned, along with the
+		digest the tag currently points at, when it does not.`,
+		HTTPStatusCode: http.StatusPreconditionFailed,
+	})
+
+	// ErrorCodeArchiveInvalid is returned when an archive imported into a
+	// repository is not a valid image archive.
+	ErrorCodeArchiveInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "ARCHIVE_INVALID",
+		Message: "image archive invalid",
+		Description: `Archives imported into a repository must be docker
+		save archives or OCI image layouts, whose images only refer to
+		files of the archive. This error is returned when the archive is
+		malformed, or an image refers to a file it does not hold.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeOrderInvalid is returned when a list is requested in an
+	// unknown order.
+	ErrorCodeOrderInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "ORDER_INVALID",
+		Message: "invalid list order",
+		Description: `Tags may be listed in the order of their last update
+		with order=lastupdate. This error is returned when the order
+		parameter has another value.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeBlobRestoring is returned when a blob is read while it is
+	// restored from archive storage.
+	ErrorCodeBlobRestoring = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_RESTORING",
+		Message: "blob is being restored from archive storage",
+		Description: `Blobs unread for long may be moved to archive storage
+		by the tiering policy of the registry, from which they are restored
+		when read again. This error is returned, along with a Retry-After
+		header, while the blob is restored: the request should be made
+		again later.`,
+		HTTPStatusCode: http.StatusAccepted,
+	})
+
+	// ErrorCodeBlobFilesUnknown is returned when the index of the files of a
+	// blob is requested but the registry does not index the blob.
+	ErrorCodeBlobFilesUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_FILES_UNKNOWN",
+		Message: "blob files unknown",
+		Description: `This error may be returned when the files of a blob
+		are requested but the blob is not a layer, or is larger than the
+		registry indexes. The blob should be fetched instead.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeBlobVariantUnknown is returned when the variant of a blob is
+	// requested but the registry has not stored it.
+	ErrorCodeBlobVariantUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_VARIANT_UNKNOWN",
+		Message: "blob variant unknown",
+		Description: `This error may be returned when the zstd variant of a
+		blob is requested but the registry has not recompressed the blob.
+		The blob should be fetched instead.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
 )
@@ -1,26 +1,67 @@
 package v2
 
-import "github.com/gorilla/mux"
+import (
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
 
 // The following are definitions of the name under which all V2 routes are
 // registered. These symbols can be used to look up a route based on the name.
 const (
-	RouteNameBase            = "base"
-	RouteNameManifest        = "manifest"
-	RouteNameTags            = "tags"
-	RouteNameBlob            = "blob"
-	RouteNameBlobUpload      = "blob-upload"
-	RouteNameBlobUploadChunk = "blob-upload-chunk"
-	RouteNameCatalog         = "catalog"
+	RouteNameBase               = "base"
+	RouteNameManifest           = "manifest"
+	RouteNameManifestMetadata   = "manifest-metadata"
+	RouteNameManifestSBOM       = "manifest-sbom"
+	RouteNameManifestGraph      = "manifest-graph"
+	RouteNameManifestSearch     = "manifest-search"
+	RouteNameManifestCompare    = "manifest-compare"
+	RouteNameTags               = "tags"
+	RouteNameTagsSnapshot       = "tags-snapshot"
+	RouteNameBlob               = "blob"
+	RouteNameBlobTOC            = "blob-toc"
+	RouteNameBlobDelta          = "blob-delta"
+	RouteNameBlobFiles          = "blob-files"
+	RouteNameBlobVariant        = "blob-variant"
+	RouteNameBlobUpload         = "blob-upload"
+	RouteNameBlobUploadChunk    = "blob-upload-chunk"
+	RouteNameCatalog            = "catalog"
+	RouteNameTrust              = "trust"
+	RouteNameExtensions         = "extensions"
+	RouteNameRepository         = "repository"
+	RouteNameRepositoryDeletion = "repository-deletion"
+	RouteNameRepositoryImport   = "repository-import"
+	RouteNameRepositoryChecksum = "repository-checksum"
 )
 
+// TrustRoleRegexp matches the names of the TUF roles whose trust metadata may
+// be stored in a repository: the top-level roles and roles delegated from
+// targets.
+var TrustRoleRegexp = regexp.MustCompile(`(?:root|snapshot|timestamp|targets(?:/[a-zA-Z0-9][a-zA-Z0-9_-]*)*)`)
+
 var allEndpoints = []string{
 	RouteNameManifest,
+	RouteNameManifestMetadata,
+	RouteNameManifestSBOM,
+	RouteNameManifestGraph,
+	RouteNameManifestSearch,
+	RouteNameManifestCompare,
 	RouteNameCatalog,
 	RouteNameTags,
+	RouteNameTagsSnapshot,
 	RouteNameBlob,
+	RouteNameBlobTOC,
+	RouteNameBlobDelta,
+	RouteNameBlobFiles,
+	RouteNameBlobVariant,
 	RouteNameBlobUpload,
 	RouteNameBlobUploadChunk,
+	RouteNameTrust,
+	RouteNameExtensions,
+	RouteNameRepositoryDeletion,
+	RouteNameRepositoryImport,
+	RouteNameRepositoryChecksum,
+	RouteNameRepository,
 }
 
 // Router builds a gorilla router with named routes for the various API
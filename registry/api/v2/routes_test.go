@@ -51,6 +51,30 @@ func TestRouter(t *testing.T) {
 				"reference": "tag",
 			},
 		},
+		{
+			RouteName:  RouteNameManifestMetadata,
+			RequestURI: "/v2/foo/bar/manifests/tag/metadata",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "tag",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestSBOM,
+			RequestURI: "/v2/foo/bar/manifests/tag/sbom",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "tag",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestGraph,
+			RequestURI: "/v2/foo/bar/manifests/tag/graph",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "tag",
+			},
+		},
 		{
 			RouteName:  RouteNameManifest,
 			RequestURI: "/v2/foo/bar/manifests/sha256:abcdef01234567890",
@@ -87,6 +111,83 @@ func TestRouter(t *testing.T) {
 				"name": "docker.com/foo/bar/baz",
 			},
 		},
+		{
+			RouteName:  RouteNameTrust,
+			RequestURI: "/v2/foo/bar/_trust/tuf/root.json",
+			Vars: map[string]string{
+				"name":     "foo/bar",
+				"role":     "root",
+				"checksum": "",
+			},
+		},
+		{
+			RouteName:  RouteNameTrust,
+			RequestURI: "/v2/foo/bar/_trust/tuf/targets/releases.abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789.json",
+			Vars: map[string]string{
+				"name":     "foo/bar",
+				"role":     "targets/releases",
+				"checksum": ".abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameTagsSnapshot,
+			RequestURI: "/v2/foo/bar/tags/snapshot",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestSearch,
+			RequestURI: "/v2/foo/bar/_manifests",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestCompare,
+			RequestURI: "/v2/foo/bar/_compare",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepository,
+			RequestURI: "/v2/foo/bar",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			// The repository route matches names ending like the paths
+			// of other routes, which are routed first.
+			RouteName:  RouteNameRepository,
+			RequestURI: "/v2/foo/bar/manifests",
+			Vars: map[string]string{
+				"name": "foo/bar/manifests",
+			},
+		},
+		{
+			RouteName:  RouteNameRepositoryDeletion,
+			RequestURI: "/v2/foo/bar/_deletions/0b3b4d9e-7b7a-4b8c-a6a0-f7c2f4b3a5e1",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"id":   "0b3b4d9e-7b7a-4b8c-a6a0-f7c2f4b3a5e1",
+			},
+		},
+		{
+			RouteName:  RouteNameRepositoryImport,
+			RequestURI: "/v2/foo/bar/_import",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepositoryChecksum,
+			RequestURI: "/v2/foo/bar/_checksum",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
 		{
 			RouteName:  RouteNameBlob,
 			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234",
@@ -95,6 +196,38 @@ func TestRouter(t *testing.T) {
 				"digest": "sha256:abcdef0919234",
 			},
 		},
+		{
+			RouteName:  RouteNameBlobTOC,
+			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234/toc",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameBlobDelta,
+			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234/delta",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameBlobFiles,
+			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234/files",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameBlobVariant,
+			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234/variant",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0919234",
+			},
+		},
 		{
 			RouteName:  RouteNameBlobUpload,
 			RequestURI: "/v2/foo/bar/blobs/uploads/",
@@ -5,6 +5,8 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/gorilla/mux"
 )
@@ -17,8 +19,9 @@ import (
 // under "/foo/v2/...". Most application will only provide a schema, host and
 // port, such as "https://localhost:5000/".
 type URLBuilder struct {
-	root   *url.URL // url root (ie http://localhost/)
-	router *mux.Router
+	root     *url.URL // url root (ie http://localhost/)
+	router   *mux.Router
+	relative bool // build urls without scheme and host
 }
 
 // NewURLBuilder creates a URLBuilder with provided root url object.
@@ -41,34 +44,24 @@ func NewURLBuilderFromString(root string) (*URLBuilder, error) {
 	return NewURLBuilder(u), nil
 }
 
-// NewURLBuilderFromRequest uses information from an *http.Request to
-// construct the root url.
-func NewURLBuilderFromRequest(r *http.Request) *URLBuilder {
-	var scheme string
-
-	forwardedProto := r.Header.Get("X-Forwarded-Proto")
-
-	switch {
-	case len(forwardedProto) > 0:
-		scheme = forwardedProto
-	case r.TLS != nil:
-		scheme = "https"
-	case len(r.URL.Scheme) > 0:
-		scheme = r.URL.Scheme
-	default:
-		scheme = "http"
+// Relative returns a URLBuilder creating the same urls as ub without their
+// scheme and host, such as "/foo/v2/...", for clients reaching the registry
+// through proxies which do not report the address requested.
+func (ub *URLBuilder) Relative() *URLBuilder {
+	return &URLBuilder{
+		root:     ub.root,
+		router:   ub.router,
+		relative: true,
 	}
+}
 
-	host := r.Host
-	forwardedHost := r.Header.Get("X-Forwarded-Host")
-	if len(forwardedHost) > 0 {
-		// According to the Apache mod_proxy docs, X-Forwarded-Host can be a
-		// comma-separated list of hosts, to which each proxy appends the
-		// requested host. We want to grab the first from this comma-separated
-		// list.
-		hosts := strings.SplitN(forwardedHost, ",", 2)
-		host = strings.TrimSpace(hosts[0])
-	}
+// NewURLBuilderFromRequest uses information from an *http.Request to
+// construct the root url. The scheme and host requested through proxies are
+// taken from the Forwarded header, or the X-Forwarded-Proto, X-Forwarded-Host
+// and X-Forwarded-Port headers.
+func NewURLBuilderFromRequest(r *http.Request) *URLBuilder {
+	scheme := context.RequestScheme(r)
+	host := context.RequestHost(r)
 
 	basePath := routeDescriptorsMap[RouteNameBase].Path
 
@@ -112,6 +105,19 @@ func (ub *URLBuilder) BuildCatalogURL(values ...url.Values) (string, error) {
 	return appendValuesURL(catalogURL, values...).String(), nil
 }
 
+// BuildExtensionsURL constructs a url to list the extensions of the API
+// provided by the registry.
+func (ub *URLBuilder) BuildExtensionsURL() (string, error) {
+	route := ub.cloneRoute(RouteNameExtensions)
+
+	extensionsURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return extensionsURL.String(), nil
+}
+
 // BuildTagsURL constructs a url to list the tags in the named repository.
 func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
 	route := ub.cloneRoute(RouteNameTags)
@@ -124,6 +130,46 @@ func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
 	return tagsURL.String(), nil
 }
 
+// BuildTagsSnapshotURL constructs a url to fetch a signed snapshot of the
+// tags in the named repository.
+func (ub *URLBuilder) BuildTagsSnapshotURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameTagsSnapshot)
+
+	snapshotURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return snapshotURL.String(), nil
+}
+
+// BuildManifestSearchURL constructs a url to find the manifests of the named
+// repository selected by the annotation and label parameters of values.
+func (ub *URLBuilder) BuildManifestSearchURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestSearch)
+
+	searchURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(searchURL, values...).String(), nil
+}
+
+// BuildManifestCompareURL constructs a url to compare the layers of the
+// manifests of the named repository given by the from and to parameters of
+// values.
+func (ub *URLBuilder) BuildManifestCompareURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestCompare)
+
+	compareURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(compareURL, values...).String(), nil
+}
+
 // BuildManifestURL constructs a url for the manifest identified by name and
 // reference. The argument reference may be either a tag or digest.
 func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
@@ -145,6 +191,72 @@ func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
 	return manifestURL.String(), nil
 }
 
+// BuildManifestMetadataURL constructs a url for the metadata of the manifest
+// identified by name and reference. The argument reference may be either a
+// tag or digest.
+func (ub *URLBuilder) BuildManifestMetadataURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestMetadata)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	}
+
+	metadataURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return metadataURL.String(), nil
+}
+
+// BuildManifestSBOMURL constructs a url for the software bill of materials
+// of the manifest identified by name and reference. The argument reference may
+// be either a tag or digest.
+func (ub *URLBuilder) BuildManifestSBOMURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestSBOM)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	}
+
+	sbomURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return sbomURL.String(), nil
+}
+
+// BuildManifestGraphURL constructs a url for the graph of the manifests and
+// blobs of the manifest identified by name and reference. The argument
+// reference may be either a tag or digest.
+func (ub *URLBuilder) BuildManifestGraphURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestGraph)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	}
+
+	graphURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return graphURL.String(), nil
+}
+
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
 func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
@@ -157,6 +269,81 @@ func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	return layerURL.String(), nil
 }
 
+// BuildBlobTOCURL constructs the url for the table of contents of the blob
+// identified by name and dgst.
+func (ub *URLBuilder) BuildBlobTOCURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobTOC)
+
+	tocURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return tocURL.String(), nil
+}
+
+// BuildBlobDeltaURL constructs the url for the delta rebuilding the blob
+// identified by name and dgst from the blob from.
+func (ub *URLBuilder) BuildBlobDeltaURL(ref reference.Canonical, from digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobDelta)
+
+	deltaURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(deltaURL, url.Values{"from": []string{from.String()}}).String(), nil
+}
+
+// BuildBlobFilesURL constructs the url for the index of the files of the
+// layer identified by name and dgst. If query is set, only the files whose
+// path contains it are listed.
+func (ub *URLBuilder) BuildBlobFilesURL(ref reference.Canonical, query string) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobFiles)
+
+	filesURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	if query == "" {
+		return filesURL.String(), nil
+	}
+	return appendValuesURL(filesURL, url.Values{"q": []string{query}}).String(), nil
+}
+
+// BuildBlobVariantURL constructs the url for the zstd variant of the blob
+// identified by name and dgst.
+func (ub *URLBuilder) BuildBlobVariantURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobVariant)
+
+	variantURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return variantURL.String(), nil
+}
+
+// BuildTrustMetadataURL constructs the url for the trust metadata of role in
+// the named repository. If dgst is set, the url addresses the revision of the
+// metadata with that digest rather than the current revision.
+func (ub *URLBuilder) BuildTrustMetadataURL(name reference.Named, role string, dgst digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameTrust)
+
+	checksum := ""
+	if dgst != "" {
+		checksum = "." + dgst.Hex()
+	}
+
+	trustURL, err := route.URL("name", name.Name(), "role", role, "checksum", checksum)
+	if err != nil {
+		return "", err
+	}
+
+	return trustURL.String(), nil
+}
+
 // BuildBlobUploadURL constructs a url to begin a blob upload in the
 // repository identified by name.
 func (ub *URLBuilder) BuildBlobUploadURL(name reference.Named, values ...url.Values) (string, error) {
@@ -185,6 +372,58 @@ func (ub *URLBuilder) BuildBlobUploadChunkURL(name reference.Named, uuid string,
 	return appendValuesURL(uploadURL, values...).String(), nil
 }
 
+// BuildRepositoryURL constructs a url for the named repository, used to
+// delete it.
+func (ub *URLBuilder) BuildRepositoryURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepository)
+
+	repositoryURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return repositoryURL.String(), nil
+}
+
+// BuildRepositoryDeletionURL constructs a url to poll the status of the
+// deletion of the named repository identified by id.
+func (ub *URLBuilder) BuildRepositoryDeletionURL(name reference.Named, id string) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryDeletion)
+
+	deletionURL, err := route.URL("name", name.Name(), "id", id)
+	if err != nil {
+		return "", err
+	}
+
+	return deletionURL.String(), nil
+}
+
+// BuildRepositoryImportURL constructs a url to import an image archive into
+// the named repository, with the given query values.
+func (ub *URLBuilder) BuildRepositoryImportURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryImport)
+
+	importURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(importURL, values...).String(), nil
+}
+
+// BuildRepositoryChecksumURL constructs a url for the checksum of the tags
+// and manifests of the named repository.
+func (ub *URLBuilder) BuildRepositoryChecksumURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryChecksum)
+
+	checksumURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return checksumURL.String(), nil
+}
+
 // clondedRoute returns a clone of the named route from the router. Routes
 // must be cloned to avoid modifying them during url generation.
 func (ub *URLBuilder) cloneRoute(name string) clonedRoute {
@@ -194,12 +433,13 @@ func (ub *URLBuilder) cloneRoute(name string) clonedRoute {
 	*route = *ub.router.GetRoute(name) // clone the route
 	*root = *ub.root
 
-	return clonedRoute{Route: route, root: root}
+	return clonedRoute{Route: route, root: root, relative: ub.relative}
 }
 
 type clonedRoute struct {
 	*mux.Route
-	root *url.URL
+	root     *url.URL
+	relative bool
 }
 
 func (cr clonedRoute) URL(pairs ...string) (*url.URL, error) {
@@ -214,6 +454,11 @@ func (cr clonedRoute) URL(pairs ...string) (*url.URL, error) {
 
 	url := cr.root.ResolveReference(routeURL)
 	url.Scheme = cr.root.Scheme
+	if cr.relative {
+		url.Scheme = ""
+		url.User = nil
+		url.Host = ""
+	}
 	return url, nil
 }
 
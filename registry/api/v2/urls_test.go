@@ -22,6 +22,11 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 			expectedPath: "/v2/",
 			build:        urlBuilder.BuildBaseURL,
 		},
+		{
+			description:  "test extensions url",
+			expectedPath: "/v2/_extensions",
+			build:        urlBuilder.BuildExtensionsURL,
+		},
 		{
 			description:  "test tags url",
 			expectedPath: "/v2/foo/bar/tags/list",
@@ -29,6 +34,55 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildTagsURL(fooBarRef)
 			},
 		},
+		{
+			description:  "test tags snapshot url",
+			expectedPath: "/v2/foo/bar/tags/snapshot",
+			build: func() (string, error) {
+				return urlBuilder.BuildTagsSnapshotURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test manifest search url",
+			expectedPath: "/v2/foo/bar/_manifests?annotation=org.opencontainers.image.version%3D1.2.%2A",
+			build: func() (string, error) {
+				return urlBuilder.BuildManifestSearchURL(fooBarRef, url.Values{"annotation": {"org.opencontainers.image.version=1.2.*"}})
+			},
+		},
+		{
+			description:  "test manifest compare url",
+			expectedPath: "/v2/foo/bar/_compare?from=v1&to=v2",
+			build: func() (string, error) {
+				return urlBuilder.BuildManifestCompareURL(fooBarRef, url.Values{"from": {"v1"}, "to": {"v2"}})
+			},
+		},
+		{
+			description:  "test repository url",
+			expectedPath: "/v2/foo/bar",
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test repository deletion url",
+			expectedPath: "/v2/foo/bar/_deletions/0b3b4d9e-7b7a-4b8c-a6a0-f7c2f4b3a5e1",
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryDeletionURL(fooBarRef, "0b3b4d9e-7b7a-4b8c-a6a0-f7c2f4b3a5e1")
+			},
+		},
+		{
+			description:  "test repository import url",
+			expectedPath: "/v2/foo/bar/_import?tag=latest",
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryImportURL(fooBarRef, url.Values{"tag": {"latest"}})
+			},
+		},
+		{
+			description:  "test repository checksum url",
+			expectedPath: "/v2/foo/bar/_checksum",
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryChecksumURL(fooBarRef)
+			},
+		},
 		{
 			description:  "test manifest url",
 			expectedPath: "/v2/foo/bar/manifests/tag",
@@ -37,6 +91,30 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildManifestURL(ref)
 			},
 		},
+		{
+			description:  "test manifest metadata url",
+			expectedPath: "/v2/foo/bar/manifests/tag/metadata",
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildManifestMetadataURL(ref)
+			},
+		},
+		{
+			description:  "test manifest sbom url",
+			expectedPath: "/v2/foo/bar/manifests/tag/sbom",
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildManifestSBOMURL(ref)
+			},
+		},
+		{
+			description:  "test manifest graph url",
+			expectedPath: "/v2/foo/bar/manifests/tag/graph",
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildManifestGraphURL(ref)
+			},
+		},
 		{
 			description:  "build blob url",
 			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
@@ -45,6 +123,52 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildBlobURL(ref)
 			},
 		},
+		{
+			description:  "build blob toc url",
+			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/toc",
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildBlobTOCURL(ref)
+			},
+		},
+		{
+			description:  "build blob delta url",
+			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/delta?from=sha256%3Ad3fe1a6d2d6c69f1b3b0da1b1b2bd7b7e9f41e9b9b3b0c0d1b1f6f2e4d5c6b7a",
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildBlobDeltaURL(ref, "sha256:d3fe1a6d2d6c69f1b3b0da1b1b2bd7b7e9f41e9b9b3b0c0d1b1f6f2e4d5c6b7a")
+			},
+		},
+		{
+			description:  "build blob files url",
+			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/files?q=etc%2Fpasswd",
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildBlobFilesURL(ref, "etc/passwd")
+			},
+		},
+		{
+			description:  "build blob variant url",
+			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/variant",
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildBlobVariantURL(ref)
+			},
+		},
+		{
+			description:  "build trust metadata url",
+			expectedPath: "/v2/foo/bar/_trust/tuf/targets/releases.json",
+			build: func() (string, error) {
+				return urlBuilder.BuildTrustMetadataURL(fooBarRef, "targets/releases", "")
+			},
+		},
+		{
+			description:  "build trust metadata revision url",
+			expectedPath: "/v2/foo/bar/_trust/tuf/root.3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5.json",
+			build: func() (string, error) {
+				return urlBuilder.BuildTrustMetadataURL(fooBarRef, "root", "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+			},
+		},
 		{
 			description:  "build blob upload url",
 			expectedPath: "/v2/foo/bar/blobs/uploads/",
@@ -302,3 +426,76 @@ func TestBuilderFromRequestWithPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestBuilderFromRequestForwarded(t *testing.T) {
+	u, err := url.Parse("http://10.0.0.1:5000/prefix/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		header http.Header
+		base   string
+	}{
+		{
+			header: http.Header{"Forwarded": {`for=192.0.2.60;proto=https;host="registry.example.com"`}},
+			base:   "https://registry.example.com/prefix",
+		},
+		{
+			header: http.Header{
+				"Forwarded":         {"host=first.example.com, host=proxy.example.com"},
+				"X-Forwarded-Host":  {"second.example.com"},
+				"X-Forwarded-Proto": {"https"},
+			},
+			base: "https://first.example.com/prefix",
+		},
+		{
+			header: http.Header{
+				"X-Forwarded-Host":  {"registry.example.com"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Port":  {"8443"},
+			},
+			base: "https://registry.example.com:8443/prefix",
+		},
+		{
+			header: http.Header{
+				"X-Forwarded-Host":  {"registry.example.com"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Port":  {"443"},
+			},
+			base: "https://registry.example.com/prefix",
+		},
+	} {
+		builder := NewURLBuilderFromRequest(&http.Request{URL: u, Host: u.Host, Header: tc.header})
+
+		for _, testCase := range makeURLBuilderTestCases(builder) {
+			buildURL, err := testCase.build()
+			if err != nil {
+				t.Fatalf("%s: error building url: %v", testCase.description, err)
+			}
+
+			if expectedURL := tc.base + testCase.expectedPath; buildURL != expectedURL {
+				t.Fatalf("%s: %q != %q", testCase.description, buildURL, expectedURL)
+			}
+		}
+	}
+}
+
+func TestRelativeURLBuilder(t *testing.T) {
+	root, err := url.Parse("https://registry.example.com/prefix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := NewURLBuilder(root).Relative()
+	for _, testCase := range makeURLBuilderTestCases(builder) {
+		buildURL, err := testCase.build()
+		if err != nil {
+			t.Fatalf("%s: error building url: %v", testCase.description, err)
+		}
+
+		if expectedURL := "/prefix" + testCase.expectedPath; buildURL != expectedURL {
+			t.Fatalf("%s: %q != %q", testCase.description, buildURL, expectedURL)
+		}
+	}
+}
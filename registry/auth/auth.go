@@ -30,11 +30,18 @@
 //			}
 // 		}
 //
+// The context returned by a successful authorization carries the UserInfo of
+// the user, whose name, issuer and claims are also available with the
+// UserNameKey, UserIssuerKey and UserClaimsKey keys, for middleware to base
+// policy decisions on.
+//
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/docker/distribution/context"
 )
@@ -47,12 +54,34 @@ const (
 	// UserNameKey is used to get the user name from
 	// a user context
 	UserNameKey = "auth.user.name"
+
+	// UserIssuerKey is used to get the issuer of the
+	// credentials of the user from a user context
+	UserIssuerKey = "auth.user.issuer"
+
+	// UserClaimsKey is used to get the claims of the
+	// credentials of the user from a user context
+	UserClaimsKey = "auth.user.claims"
 )
 
 // UserInfo carries information about
 // an autenticated/authorized client.
 type UserInfo struct {
 	Name string
+
+	// Issuer is the issuer of the credentials the user authenticated
+	// with, such as the issuer of a token, if any.
+	Issuer string
+
+	// Claims are the claims of the credentials the user authenticated
+	// with, such as the claims of a token, for middleware to base policy
+	// decisions on. Claims are nil for credentials without claims.
+	Claims map[string]interface{}
+
+	// Expires is when the credentials the user authenticated with
+	// expire, such as the expiration of a token. It is zero for
+	// credentials which do not expire.
+	Expires time.Time
 }
 
 // Resource describes a resource by type and name.
@@ -97,6 +126,26 @@ type AccessController interface {
 	Authorized(ctx context.Context, access ...Access) (context.Context, error)
 }
 
+// ErrUserUnknown is returned by a UserManager removing a user which does not
+// exist.
+var ErrUserUnknown = errors.New("user unknown")
+
+// UserManager is implemented by access controllers whose users can be
+// managed while the registry is running, such as the htpasswd access
+// controller with a writable file.
+type UserManager interface {
+	// Users returns the names of the users.
+	Users(ctx context.Context) ([]string, error)
+
+	// SetPassword creates a user, or changes the password of an existing
+	// one.
+	SetPassword(ctx context.Context, username, password string) error
+
+	// RemoveUser removes a user, returning ErrUserUnknown if it does not
+	// exist.
+	RemoveUser(ctx context.Context, username string) error
+}
+
 // WithUser returns a context with the authorized user info.
 func WithUser(ctx context.Context, user UserInfo) context.Context {
 	return userInfoContext{
@@ -116,6 +165,10 @@ func (uic userInfoContext) Value(key interface{}) interface{} {
 		return uic.user
 	case UserNameKey:
 		return uic.user.Name
+	case UserIssuerKey:
+		return uic.user.Issuer
+	case UserClaimsKey:
+		return uic.user.Claims
 	}
 
 	return uic.Context.Value(key)
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+)
+
+// DefaultCacheSize is the number of authorizations cached by an access
+// controller returned by NewCachedAccessController if no size is given.
+const DefaultCacheSize = 10000
+
+// checker is implemented by access controllers whose backend can be checked,
+// such as health.Checker.
+type checker interface {
+	Check() error
+}
+
+// revisioned is implemented by access controllers whose users may change
+// while the registry is running, such as the htpasswd access controller. The
+// revision changes whenever users are changed or removed.
+type revisioned interface {
+	Revision(ctx context.Context) uint64
+}
+
+// cachedAccessController caches the successful authorizations of an access
+// controller, so that requests carrying the same credentials for the same
+// access are not checked against its backend again until they expire.
+type cachedAccessController struct {
+	AccessController
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]cachedAuthorization
+}
+
+// cachedAuthorization is a successful authorization of a user, checked
+// against the given revision of the users of the access controller.
+type cachedAuthorization struct {
+	user     UserInfo
+	expires  time.Time
+	revision uint64
+}
+
+// checkedCachedAccessController is a cachedAccessController whose backend can
+// be checked.
+type checkedCachedAccessController struct {
+	*cachedAccessController
+	checker
+}
+
+// NewCachedAccessController returns an access controller caching the
+// successful authorizations of ac for ttl, keyed by the hash of the
+// credentials of requests and the access they request. At most size
+// authorizations are cached. Only the user of authorizations is cached, other
+// values ac adds to the context are not. Failed authorizations are never
+// cached. An authorization is cached no longer than its credentials expire,
+// and dropped once the users of ac are changed or removed, but credentials
+// revoked otherwise are still accepted until their cached authorizations
+// expire.
+func NewCachedAccessController(ac AccessController, ttl time.Duration, size int) AccessController {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	cac := &cachedAccessController{
+		AccessController: ac,
+		ttl:              ttl,
+		size:             size,
+		entries:          make(map[string]cachedAuthorization),
+	}
+
+	if c, ok := ac.(checker); ok {
+		return &checkedCachedAccessController{cachedAccessController: cac, checker: c}
+	}
+	return cac
+}
+
+// Authorized implements AccessController, checking the access with the
+// wrapped access controller unless it was authorized recently.
+func (cac *cachedAccessController) Authorized(ctx context.Context, access ...Access) (context.Context, error) {
+	req, err := context.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := req.Header.Get("Authorization")
+	if credentials == "" {
+		// Anonymous requests are challenged, or authorized without
+		// checking any backend.
+		return cac.AccessController.Authorized(ctx, access...)
+	}
+
+	key := cacheKey(credentials, access)
+	now := time.Now()
+
+	// The revision is read before authorizing, so that an authorization
+	// checked against users changed meanwhile is not used.
+	var revision uint64
+	if r, ok := cac.AccessController.(revisioned); ok {
+		revision = r.Revision(ctx)
+	}
+
+	cac.mu.Lock()
+	entry, ok := cac.entries[key]
+	cac.mu.Unlock()
+
+	if ok && now.Before(entry.expires) && entry.revision == revision {
+		return WithUser(ctx, entry.user), nil
+	}
+
+	authorizedCtx, err := cac.AccessController.Authorized(ctx, access...)
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := authorizedCtx.Value(UserKey).(UserInfo)
+	expires := now.Add(cac.ttl)
+	if !user.Expires.IsZero() && user.Expires.Before(expires) {
+		expires = user.Expires
+	}
+	cac.add(key, cachedAuthorization{user: user, expires: expires, revision: revision}, now)
+
+	return authorizedCtx, nil
+}
+
+// add caches an authorization, evicting expired authorizations and those of
+// previous revisions, or arbitrary ones if none are, if the cache is full.
+func (cac *cachedAccessController) add(key string, entry cachedAuthorization, now time.Time) {
+	cac.mu.Lock()
+	defer cac.mu.Unlock()
+
+	if _, ok := cac.entries[key]; !ok && len(cac.entries) >= cac.size {
+		for k, e := range cac.entries {
+			if !now.Before(e.expires) || e.revision != entry.revision {
+				delete(cac.entries, k)
+			}
+		}
+		for k := range cac.entries {
+			if len(cac.entries) < cac.size {
+				break
+			}
+			delete(cac.entries, k)
+		}
+	}
+
+	cac.entries[key] = entry
+}
+
+// cacheKey returns the key of the authorization of credentials for access.
+// Credentials are hashed so that they are not kept in memory.
+func cacheKey(credentials string, access []Access) string {
+	h := sha256.New()
+	h.Write([]byte(credentials))
+	for _, a := range access {
+		h.Write([]byte{0})
+		h.Write([]byte(a.Type + ":" + a.Name + ":" + a.Action))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
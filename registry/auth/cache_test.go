@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+)
+
+// countingAccessController authorizes requests carrying the "valid"
+// credentials, counting the authorizations checked.
+type countingAccessController struct {
+	checked int
+}
+
+func (ac *countingAccessController) Authorized(ctx context.Context, access ...Access) (context.Context, error) {
+	ac.checked++
+	req, err := context.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") != "valid" {
+		return nil, errors.New("invalid credentials")
+	}
+	return WithUser(ctx, UserInfo{Name: "user"}), nil
+}
+
+func TestCachedAccessController(t *testing.T) {
+	backend := &countingAccessController{}
+	ac := NewCachedAccessController(backend, 50*time.Millisecond, 2)
+
+	authorize := func(credentials string, access ...Access) error {
+		req, _ := http.NewRequest("GET", "/v2/", nil)
+		if credentials != "" {
+			req.Header.Set("Authorization", credentials)
+		}
+		ctx, err := ac.Authorized(context.WithRequest(context.Background(), req), access...)
+		if err != nil {
+			return err
+		}
+		if name := context.GetStringValue(ctx, UserNameKey); name != "user" {
+			t.Fatalf("unexpected user name: %q", name)
+		}
+		return nil
+	}
+
+	pull := Access{Resource: Resource{Type: "repository", Name: "foo/bar"}, Action: "pull"}
+	push := Access{Resource: Resource{Type: "repository", Name: "foo/bar"}, Action: "push"}
+
+	for i := 0; i < 3; i++ {
+		if err := authorize("valid", pull); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if backend.checked != 1 {
+		t.Fatalf("expected 1 authorization checked, got %d", backend.checked)
+	}
+
+	// Other access is checked separately.
+	if err := authorize("valid", push); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if backend.checked != 2 {
+		t.Fatalf("expected 2 authorizations checked, got %d", backend.checked)
+	}
+
+	// Failures are not cached.
+	for i := 0; i < 2; i++ {
+		if err := authorize("invalid", pull); err == nil {
+			t.Fatalf("expected invalid credentials to fail")
+		}
+	}
+	if backend.checked != 4 {
+		t.Fatalf("expected 4 authorizations checked, got %d", backend.checked)
+	}
+
+	// Authorizations are checked again once expired.
+	time.Sleep(60 * time.Millisecond)
+	if err := authorize("valid", pull); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if backend.checked != 5 {
+		t.Fatalf("expected 5 authorizations checked, got %d", backend.checked)
+	}
+
+	if _, ok := ac.(checker); ok {
+		t.Fatalf("cached access controller should only be checkable if its backend is")
+	}
+}
+
+func TestCachedAccessControllerSize(t *testing.T) {
+	ac := NewCachedAccessController(&countingAccessController{}, time.Minute, 2).(*cachedAccessController)
+
+	for _, name := range []string{"a", "b", "c"} {
+		access := Access{Resource: Resource{Type: "repository", Name: name}, Action: "pull"}
+		req, _ := http.NewRequest("GET", "/v2/", nil)
+		req.Header.Set("Authorization", "valid")
+		if _, err := ac.Authorized(context.WithRequest(context.Background(), req), access); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(ac.entries) != 2 {
+		t.Fatalf("expected 2 cached authorizations, got %d", len(ac.entries))
+	}
+}
+
+// revisionedAccessController authorizes requests carrying the "valid"
+// credentials as a user whose credentials expire at the given time, under
+// the given revision of its users.
+type revisionedAccessController struct {
+	countingAccessController
+	expires  time.Time
+	revision uint64
+}
+
+func (ac *revisionedAccessController) Authorized(ctx context.Context, access ...Access) (context.Context, error) {
+	if _, err := ac.countingAccessController.Authorized(ctx, access...); err != nil {
+		return nil, err
+	}
+	return WithUser(ctx, UserInfo{Name: "user", Expires: ac.expires}), nil
+}
+
+func (ac *revisionedAccessController) Revision(ctx context.Context) uint64 {
+	return ac.revision
+}
+
+// TestCachedAccessControllerInvalidation checks that authorizations are not
+// cached past the expiration of their credentials, nor once users change.
+func TestCachedAccessControllerInvalidation(t *testing.T) {
+	backend := &revisionedAccessController{expires: time.Now().Add(50 * time.Millisecond)}
+	ac := NewCachedAccessController(backend, time.Minute, 0)
+
+	authorize := func() {
+		req, _ := http.NewRequest("GET", "/v2/", nil)
+		req.Header.Set("Authorization", "valid")
+		if _, err := ac.Authorized(context.WithRequest(context.Background(), req)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	authorize()
+	authorize()
+	if backend.checked != 1 {
+		t.Fatalf("expected 1 authorization checked, got %d", backend.checked)
+	}
+
+	// Credentials are checked again once expired, before the ttl.
+	time.Sleep(60 * time.Millisecond)
+	backend.expires = time.Time{}
+	authorize()
+	if backend.checked != 2 {
+		t.Fatalf("expected 2 authorizations checked, got %d", backend.checked)
+	}
+
+	// Authorizations are dropped once users change.
+	backend.revision++
+	authorize()
+	authorize()
+	if backend.checked != 3 {
+		t.Fatalf("expected 3 authorizations checked, got %d", backend.checked)
+	}
+}
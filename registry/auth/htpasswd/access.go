@@ -10,9 +10,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -21,15 +25,45 @@ var (
 
 	// ErrAuthenticationFailure returned when authentication failure to be presented to agent.
 	ErrAuthenticationFailure = errors.New("authentication failure")
+
+	// ErrCostExceeded is returned when the password hash of a user has a
+	// higher bcrypt cost than the configured maximum.
+	ErrCostExceeded = errors.New("password hash exceeds maximum bcrypt cost")
 )
 
 type accessController struct {
-	realm    string
+	realm string
+	path  string
+
+	// reloadInterval, if positive, is how often the file is checked for
+	// changes, which are loaded without restarting the registry.
+	reloadInterval time.Duration
+
+	// maxCost, if positive, is the highest bcrypt cost of the password
+	// hashes users are authenticated with, and cost is the bcrypt cost
+	// of the passwords set through the admin API.
+	maxCost int
+	cost    int
+
+	mu       sync.Mutex
 	htpasswd *htpasswd
+	modTime  time.Time
+	size     int64
+	checked  time.Time
+	// revision is incremented whenever the file is loaded.
+	revision uint64
 }
 
 var _ auth.AccessController = &accessController{}
 
+// writableAccessController is an accessController whose users can be managed
+// through the admin API.
+type writableAccessController struct {
+	*accessController
+}
+
+var _ auth.UserManager = &writableAccessController{}
+
 func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
 	realm, present := options["realm"]
 	if _, ok := realm.(string); !present || !ok {
@@ -41,18 +75,136 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		return nil, fmt.Errorf(`"path" must be set for htpasswd access controller`)
 	}
 
-	f, err := os.Open(path.(string))
-	if err != nil {
+	ac := &accessController{realm: realm.(string), path: path.(string), cost: bcrypt.DefaultCost}
+
+	switch v := options["reloadinterval"].(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid "reloadinterval" for htpasswd access controller: %v`, err)
+		}
+		ac.reloadInterval = d
+	case nil:
+	default:
+		return nil, fmt.Errorf(`"reloadinterval" must be a duration for htpasswd access controller`)
+	}
+
+	switch v := options["maxbcryptcost"].(type) {
+	case int:
+		ac.maxCost = v
+	case nil:
+	default:
+		return nil, fmt.Errorf(`"maxbcryptcost" must be an integer for htpasswd access controller`)
+	}
+
+	switch v := options["bcryptcost"].(type) {
+	case int:
+		if v < bcrypt.MinCost || v > bcrypt.MaxCost {
+			return nil, fmt.Errorf(`"bcryptcost" must be between %d and %d for htpasswd access controller`, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		ac.cost = v
+	case nil:
+	default:
+		return nil, fmt.Errorf(`"bcryptcost" must be an integer for htpasswd access controller`)
+	}
+	if ac.maxCost > 0 && ac.cost > ac.maxCost {
+		return nil, fmt.Errorf(`"bcryptcost" must not exceed "maxbcryptcost" for htpasswd access controller`)
+	}
+
+	if err := ac.load(); err != nil {
 		return nil, err
 	}
+
+	switch v := options["writable"].(type) {
+	case bool:
+		if v {
+			return &writableAccessController{ac}, nil
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf(`"writable" must be a boolean for htpasswd access controller`)
+	}
+
+	return ac, nil
+}
+
+// load reads the htpasswd file. The caller must hold ac.mu, unless ac is not
+// used yet.
+func (ac *accessController) load() error {
+	f, err := os.Open(ac.path)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
 	h, err := newHTPasswd(f)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	h.maxCost = ac.maxCost
 
-	return &accessController{realm: realm.(string), htpasswd: h}, nil
+	ac.htpasswd = h
+	ac.modTime = fi.ModTime()
+	ac.size = fi.Size()
+	ac.checked = time.Now()
+	ac.revision++
+	return nil
+}
+
+// current returns the users of the htpasswd file, reloading it first if it
+// changed since it was last checked, at most once per reload interval. If the
+// changed file cannot be loaded, the users it had before are returned.
+func (ac *accessController) current(ctx context.Context) *htpasswd {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.reloadInterval <= 0 || time.Since(ac.checked) < ac.reloadInterval {
+		return ac.htpasswd
+	}
+	ac.checked = time.Now()
+
+	fi, err := os.Stat(ac.path)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("error checking htpasswd file %s: %v", ac.path, err)
+		return ac.htpasswd
+	}
+	if fi.ModTime().Equal(ac.modTime) && fi.Size() == ac.size {
+		return ac.htpasswd
+	}
+
+	if err := ac.load(); err != nil {
+		context.GetLogger(ctx).Errorf("error reloading htpasswd file %s, keeping previous users: %v", ac.path, err)
+		return ac.htpasswd
+	}
+	context.GetLogger(ctx).Infof("reloaded htpasswd file %s", ac.path)
+	return ac.htpasswd
+}
+
+// Revision returns the revision of the users of the htpasswd file, which
+// changes whenever the file is loaded, reloading it first if it changed.
+// Cached authorizations are dropped once it changes, so that users changed or
+// removed are no longer authorized with their previous password.
+func (ac *accessController) Revision(ctx context.Context) uint64 {
+	ac.current(ctx)
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.revision
+}
+
+// Check implements health.Checker, failing if the htpasswd file is no longer
+// readable.
+func (ac *accessController) Check() error {
+	f, err := os.Open(ac.path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
 }
 
 func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
@@ -69,7 +221,7 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 		}
 	}
 
-	if err := ac.htpasswd.authenticateUser(username, password); err != nil {
+	if err := ac.current(ctx).authenticateUser(username, password); err != nil {
 		context.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
 		return nil, &challenge{
 			realm: ac.realm,
@@ -80,6 +232,44 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
 }
 
+// Users implements auth.UserManager.
+func (ac *writableAccessController) Users(ctx context.Context) ([]string, error) {
+	return ac.current(ctx).users(), nil
+}
+
+// SetPassword implements auth.UserManager, writing the bcrypt hash of the
+// password to the htpasswd file.
+func (ac *writableAccessController) SetPassword(ctx context.Context, username, password string) error {
+	if username == "" || strings.ContainsAny(username, ": \t\r\n") {
+		return fmt.Errorf("invalid htpasswd username %q", username)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), ac.cost)
+	if err != nil {
+		return err
+	}
+
+	return ac.update(username, hash)
+}
+
+// RemoveUser implements auth.UserManager, removing the user from the
+// htpasswd file.
+func (ac *writableAccessController) RemoveUser(ctx context.Context, username string) error {
+	return ac.update(username, nil)
+}
+
+// update writes the password hash of a user to the htpasswd file, or removes
+// the user if hash is nil, and loads the updated file.
+func (ac *writableAccessController) update(username string, hash []byte) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if err := updateHTPasswd(ac.path, username, hash); err != nil {
+		return err
+	}
+	return ac.load()
+}
+
 // challenge implements the auth.Challenge interface.
 type challenge struct {
 	realm string
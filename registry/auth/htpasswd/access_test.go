@@ -1,13 +1,17 @@
 package htpasswd
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
 	"testing"
 
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestBasicAccessController(t *testing.T) {
@@ -120,3 +124,89 @@ func TestBasicAccessController(t *testing.T) {
 	}
 
 }
+
+// authenticate authorizes a request with the given credentials.
+func authenticate(ac auth.AccessController, username, password string) error {
+	req, _ := http.NewRequest("GET", "/v2/", nil)
+	req.SetBasicAuth(username, password)
+	_, err := ac.Authorized(context.WithRequest(context.Background(), req))
+	return err
+}
+
+func TestReloadAndCost(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "htpasswd-test")
+	if err != nil {
+		t.Fatal("could not create temporary htpasswd file")
+	}
+	defer os.Remove(tempFile.Name())
+	tempFile.WriteString("# users\nfrodo:$2y$05$926C3y10Quzn/LnqQH86VOEVh/18T6RnLaS.khre96jLNL/7e.K5W\n")
+	tempFile.Close()
+
+	ac, err := newAccessController(map[string]interface{}{
+		"realm":          "The-Shire",
+		"path":           tempFile.Name(),
+		"reloadinterval": "1ns",
+		"maxbcryptcost":  5,
+		"bcryptcost":     4,
+		"writable":       true,
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	if err := authenticate(ac, "frodo", "baggins"); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+
+	// Changes of the file are loaded.
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gamgee"), 4)
+	if err := ioutil.WriteFile(tempFile.Name(), []byte("sam:"+string(hash)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate(ac, "sam", "gamgee"); err != nil {
+		t.Fatalf("unexpected error authenticating after reload: %v", err)
+	}
+	if err := authenticate(ac, "frodo", "baggins"); err == nil {
+		t.Fatalf("expected removed user to fail")
+	}
+
+	// Hashes costlier than the maximum are not verified.
+	costly, _ := bcrypt.GenerateFromPassword([]byte("gandalf"), 6)
+	h := &htpasswd{entries: map[string][]byte{"gandalf": costly}, maxCost: 5}
+	if err := h.authenticateUser("gandalf", "gandalf"); err != ErrCostExceeded {
+		t.Fatalf("expected %v, got %v", ErrCostExceeded, err)
+	}
+
+	// Users are managed through the file.
+	um := ac.(auth.UserManager)
+	ctx := context.Background()
+	if err := um.SetPassword(ctx, "pippin", "took"); err != nil {
+		t.Fatalf("unexpected error adding user: %v", err)
+	}
+	if err := um.SetPassword(ctx, "bad:name", "took"); err == nil {
+		t.Fatalf("expected invalid username to fail")
+	}
+	if err := authenticate(ac, "pippin", "took"); err != nil {
+		t.Fatalf("unexpected error authenticating added user: %v", err)
+	}
+	if err := um.RemoveUser(ctx, "sam"); err != nil {
+		t.Fatalf("unexpected error removing user: %v", err)
+	}
+	if err := um.RemoveUser(ctx, "sam"); err != auth.ErrUserUnknown {
+		t.Fatalf("expected %v removing unknown user, got %v", auth.ErrUserUnknown, err)
+	}
+
+	users, err := um.Users(ctx)
+	if err != nil || !reflect.DeepEqual(users, []string{"pippin"}) {
+		t.Fatalf("unexpected users: %v, %v", users, err)
+	}
+
+	p, _ := ioutil.ReadFile(tempFile.Name())
+	h, err = newHTPasswd(bytes.NewReader(p))
+	if err != nil || len(h.entries) != 1 {
+		t.Fatalf("unexpected htpasswd file: %q, %v", p, err)
+	}
+	if cost, _ := bcrypt.Cost(h.entries["pippin"]); cost != 4 {
+		t.Fatalf("unexpected bcrypt cost of added user: %d", cost)
+	}
+}
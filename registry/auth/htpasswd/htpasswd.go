@@ -2,10 +2,16 @@ package htpasswd
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/docker/distribution/registry/auth"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,6 +19,10 @@ import (
 // it. Only bcrypt hash entries are supported.
 type htpasswd struct {
 	entries map[string][]byte // maps username to password byte slice.
+
+	// maxCost, if positive, is the highest bcrypt cost of the entries
+	// passwords are verified against.
+	maxCost int
 }
 
 // newHTPasswd parses the reader and returns an htpasswd or an error.
@@ -36,6 +46,14 @@ func (htpasswd *htpasswd) authenticateUser(username string, password string) err
 		return ErrAuthenticationFailure
 	}
 
+	if htpasswd.maxCost > 0 {
+		// Refuse to spend more time than allowed on verifying a password,
+		// which clients could use to exhaust the registry.
+		if cost, err := bcrypt.Cost(credentials); err == nil && cost > htpasswd.maxCost {
+			return ErrCostExceeded
+		}
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(credentials), []byte(password))
 	if err != nil {
 		return ErrAuthenticationFailure
@@ -44,6 +62,16 @@ func (htpasswd *htpasswd) authenticateUser(username string, password string) err
 	return nil
 }
 
+// users returns the sorted names of the users of the file.
+func (htpasswd *htpasswd) users() []string {
+	users := make([]string, 0, len(htpasswd.entries))
+	for username := range htpasswd.entries {
+		users = append(users, username)
+	}
+	sort.Strings(users)
+	return users
+}
+
 // parseHTPasswd parses the contents of htpasswd. This will read all the
 // entries in the file, whether or not they are needed. An error is returned
 // if an syntax errors are encountered or if the reader fails.
@@ -78,3 +106,65 @@ func parseHTPasswd(rd io.Reader) (map[string][]byte, error) {
 
 	return entries, nil
 }
+
+// updateHTPasswd sets the password hash of a user in the htpasswd file at
+// path, removing the user if hash is nil. Comments and other entries are
+// preserved. The file is replaced atomically, so that it is never read while
+// partially written.
+func updateHTPasswd(path, username string, hash []byte) error {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		line := scanner.Text()
+		t := strings.TrimSpace(line)
+		if i := strings.Index(t, ":"); i > 0 && t[0] != '#' && t[:i] == username {
+			found = true
+			if hash == nil {
+				continue
+			}
+			line = username + ":" + string(hash)
+		}
+		buf.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !found {
+		if hash == nil {
+			return auth.ErrUserUnknown
+		}
+		buf.WriteString(username + ":" + string(hash) + "\n")
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(fi.Mode()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
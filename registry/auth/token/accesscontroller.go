@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/auth"
 	"github.com/docker/libtrust"
@@ -119,20 +121,32 @@ func (ac authChallenge) SetHeaders(w http.ResponseWriter) {
 
 // accessController implements the auth.AccessController interface.
 type accessController struct {
-	realm       string
-	issuer      string
-	service     string
+	realm   string
+	service string
+	issuers map[string]*trustedIssuer
+}
+
+// trustedIssuer is an issuer whose tokens are accepted, if signed with its
+// keys for one of its audiences.
+type trustedIssuer struct {
+	audiences   []string
 	rootCerts   *x509.CertPool
 	trustedKeys map[string]libtrust.PublicKey
 }
 
+// issuerOptions configures an issuer of tokens.
+type issuerOptions struct {
+	issuer         string
+	rootCertBundle string
+	audiences      []string
+}
+
 // tokenAccessOptions is a convenience type for handling
 // options to the contstructor of an accessController.
 type tokenAccessOptions struct {
-	realm          string
-	issuer         string
-	service        string
-	rootCertBundle string
+	realm   string
+	service string
+	issuers []issuerOptions
 }
 
 // checkOptions gathers the necessary options
@@ -140,7 +154,7 @@ type tokenAccessOptions struct {
 func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 	var opts tokenAccessOptions
 
-	keys := []string{"realm", "issuer", "service", "rootcertbundle"}
+	keys := []string{"realm", "service"}
 	vals := make([]string, 0, len(keys))
 	for _, key := range keys {
 		val, ok := options[key].(string)
@@ -150,27 +164,94 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		vals = append(vals, val)
 	}
 
-	opts.realm, opts.issuer, opts.service, opts.rootCertBundle = vals[0], vals[1], vals[2], vals[3]
+	opts.realm, opts.service = vals[0], vals[1]
+
+	// A single issuer may be configured along with the service, for which
+	// its tokens must be issued.
+	_, hasIssuer := options["issuer"]
+	_, hasIssuers := options["issuers"]
+	if hasIssuer || !hasIssuers {
+		issuer, ok := options["issuer"].(string)
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option string: %q", "issuer")
+		}
+		rootCertBundle, ok := options["rootcertbundle"].(string)
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option string: %q", "rootcertbundle")
+		}
+
+		opts.issuers = append(opts.issuers, issuerOptions{
+			issuer:         issuer,
+			rootCertBundle: rootCertBundle,
+			audiences:      []string{opts.service},
+		})
+	}
+
+	if hasIssuers {
+		issuers, ok := options["issuers"].([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("token auth option %q must be a list of issuers", "issuers")
+		}
+
+		for i, v := range issuers {
+			issuer, err := checkIssuerOptions(v, opts.service)
+			if err != nil {
+				return opts, fmt.Errorf("token auth issuer %d: %v", i, err)
+			}
+			opts.issuers = append(opts.issuers, issuer)
+		}
+	}
 
 	return opts, nil
 }
 
-// newAccessController creates an accessController using the given options.
-func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
-	config, err := checkOptions(options)
-	if err != nil {
-		return nil, err
+// checkIssuerOptions gathers the options of an issuer from an element of the
+// "issuers" option. The audiences of the issuer default to the service.
+func checkIssuerOptions(v interface{}, service string) (issuerOptions, error) {
+	var opts issuerOptions
+
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return opts, fmt.Errorf("invalid issuer: %#v", v)
+	}
+
+	if opts.issuer, ok = m["issuer"].(string); !ok || opts.issuer == "" {
+		return opts, fmt.Errorf("requires a valid option string: %q", "issuer")
+	}
+	if opts.rootCertBundle, ok = m["rootcertbundle"].(string); !ok || opts.rootCertBundle == "" {
+		return opts, fmt.Errorf("requires a valid option string: %q", "rootcertbundle")
 	}
 
-	fp, err := os.Open(config.rootCertBundle)
+	switch audiences := m["audiences"].(type) {
+	case nil:
+		opts.audiences = []string{service}
+	case []interface{}:
+		for _, a := range audiences {
+			audience, ok := a.(string)
+			if !ok {
+				return opts, fmt.Errorf("invalid audience: %#v", a)
+			}
+			opts.audiences = append(opts.audiences, audience)
+		}
+	default:
+		return opts, fmt.Errorf("option %q must be a list of strings", "audiences")
+	}
+
+	return opts, nil
+}
+
+// loadRootCerts reads the certificates of a root certificate bundle, returning
+// them as a pool and the keys of the certificates by ID.
+func loadRootCerts(rootCertBundle string) (*x509.CertPool, map[string]libtrust.PublicKey, error) {
+	fp, err := os.Open(rootCertBundle)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, nil, fmt.Errorf("unable to open token auth root certificate bundle file %q: %s", rootCertBundle, err)
 	}
 	defer fp.Close()
 
 	rawCertBundle, err := ioutil.ReadAll(fp)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", config.rootCertBundle, err)
+		return nil, nil, fmt.Errorf("unable to read token auth root certificate bundle file %q: %s", rootCertBundle, err)
 	}
 
 	var rootCerts []*x509.Certificate
@@ -178,7 +259,7 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	for pemBlock != nil {
 		cert, err := x509.ParseCertificate(pemBlock.Bytes)
 		if err != nil {
-			return nil, fmt.Errorf("unable to parse token auth root certificate: %s", err)
+			return nil, nil, fmt.Errorf("unable to parse token auth root certificate: %s", err)
 		}
 
 		rootCerts = append(rootCerts, cert)
@@ -187,7 +268,7 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	}
 
 	if len(rootCerts) == 0 {
-		return nil, errors.New("token auth requires at least one token signing root certificate")
+		return nil, nil, errors.New("token auth requires at least one token signing root certificate")
 	}
 
 	rootPool := x509.NewCertPool()
@@ -196,17 +277,43 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		rootPool.AddCert(rootCert)
 		pubKey, err := libtrust.FromCryptoPublicKey(crypto.PublicKey(rootCert.PublicKey))
 		if err != nil {
-			return nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
+			return nil, nil, fmt.Errorf("unable to get public key from token auth root certificate: %s", err)
 		}
 		trustedKeys[pubKey.KeyID()] = pubKey
 	}
 
+	return rootPool, trustedKeys, nil
+}
+
+// newAccessController creates an accessController using the given options.
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	config, err := checkOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := make(map[string]*trustedIssuer, len(config.issuers))
+	for _, issuer := range config.issuers {
+		if _, exists := issuers[issuer.issuer]; exists {
+			return nil, fmt.Errorf("token auth issuer %q configured more than once", issuer.issuer)
+		}
+
+		rootCerts, trustedKeys, err := loadRootCerts(issuer.rootCertBundle)
+		if err != nil {
+			return nil, err
+		}
+
+		issuers[issuer.issuer] = &trustedIssuer{
+			audiences:   issuer.audiences,
+			rootCerts:   rootCerts,
+			trustedKeys: trustedKeys,
+		}
+	}
+
 	return &accessController{
-		realm:       config.realm,
-		issuer:      config.issuer,
-		service:     config.service,
-		rootCerts:   rootPool,
-		trustedKeys: trustedKeys,
+		realm:   config.realm,
+		service: config.service,
+		issuers: issuers,
 	}, nil
 }
 
@@ -239,11 +346,20 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		return nil, challenge
 	}
 
+	// Tokens are verified with the keys and audiences of their issuer only,
+	// so that an issuer cannot grant access on behalf of another.
+	issuer, ok := ac.issuers[token.Claims.Issuer]
+	if !ok {
+		log.Errorf("token from untrusted issuer: %q", token.Claims.Issuer)
+		challenge.err = ErrInvalidToken
+		return nil, challenge
+	}
+
 	verifyOpts := VerifyOptions{
-		TrustedIssuers:    []string{ac.issuer},
-		AcceptedAudiences: []string{ac.service},
-		Roots:             ac.rootCerts,
-		TrustedKeys:       ac.trustedKeys,
+		TrustedIssuers:    []string{token.Claims.Issuer},
+		AcceptedAudiences: issuer.audiences,
+		Roots:             issuer.rootCerts,
+		TrustedKeys:       issuer.trustedKeys,
 	}
 
 	if err = token.Verify(verifyOpts); err != nil {
@@ -259,7 +375,33 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		}
 	}
 
-	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
+	return auth.WithUser(ctx, auth.UserInfo{
+		Name:    token.Claims.Subject,
+		Issuer:  token.Claims.Issuer,
+		Claims:  token.RawClaims,
+		Expires: time.Unix(token.Claims.Expiration, 0),
+	}), nil
+}
+
+// healthCheckTimeout bounds the requests checking that the token server is
+// reachable.
+const healthCheckTimeout = 5 * time.Second
+
+// Check implements health.Checker, failing if the token server of the realm
+// cannot be reached or fails with a server error. Clients cannot obtain
+// tokens, and therefore cannot use the registry, while it is unavailable.
+func (ac *accessController) Check() error {
+	client := &http.Client{Timeout: healthCheckTimeout}
+	resp, err := client.Get(ac.realm)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("token server %s returned %s", ac.realm, resp.Status)
+	}
+	return nil
 }
 
 // init handles registering the token auth backend.
@@ -65,6 +65,10 @@ type Token struct {
 	Header    *Header
 	Claims    *ClaimSet
 	Signature []byte
+
+	// RawClaims holds all the claims of the token, including the private
+	// claims of its issuer not described by Claims.
+	RawClaims map[string]interface{}
 }
 
 // VerifyOptions is used to specify
@@ -124,6 +128,10 @@ func NewToken(rawToken string) (*Token, error) {
 		return nil, ErrMalformedToken
 	}
 
+	if err = json.Unmarshal(claimsJSON, &token.RawClaims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
 	return token, nil
 }
 
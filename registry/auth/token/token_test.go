@@ -384,4 +384,97 @@ func TestAccessController(t *testing.T) {
 	if userInfo.Name != "foo" {
 		t.Fatalf("expected user name %q, got %q", "foo", userInfo.Name)
 	}
+
+	if userIssuer := authCtx.Value(auth.UserIssuerKey); userIssuer != issuer {
+		t.Fatalf("expected user issuer %q, got %q", issuer, userIssuer)
+	}
+
+	claims, ok := authCtx.Value(auth.UserClaimsKey).(map[string]interface{})
+	if !ok || claims["sub"] != "foo" || claims["aud"] != service {
+		t.Fatalf("unexpected user claims: %v", claims)
+	}
+}
+
+// TestAccessControllerIssuers checks that tokens of multiple issuers are
+// accepted, only if signed with the keys of their issuer for one of its
+// audiences.
+func TestAccessControllerIssuers(t *testing.T) {
+	rootKeys, err := makeRootKeys(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corpBundle, err := writeTempRootCerts(rootKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(corpBundle)
+
+	ciBundle, err := writeTempRootCerts(rootKeys[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(ciBundle)
+
+	service := "registry.example.com"
+	options := map[string]interface{}{
+		"realm":          "https://sso.example.com/token/",
+		"service":        service,
+		"issuer":         "sso.example.com",
+		"rootcertbundle": corpBundle,
+		"issuers": []interface{}{
+			map[interface{}]interface{}{
+				"issuer":         "ci.example.com",
+				"rootcertbundle": ciBundle,
+				"audiences":      []interface{}{"registry-ci"},
+			},
+		},
+	}
+
+	accessController, err := newAccessController(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testAccess := auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: "foo/bar"},
+		Action:   "pull",
+	}
+	access := []*ResourceActions{{
+		Type:    testAccess.Type,
+		Name:    testAccess.Name,
+		Actions: []string{testAccess.Action},
+	}}
+
+	for _, tc := range []struct {
+		issuer, audience string
+		rootKey          libtrust.PrivateKey
+		authorized       bool
+	}{
+		{"sso.example.com", service, rootKeys[0], true},
+		{"ci.example.com", "registry-ci", rootKeys[1], true},
+		// The audiences of an issuer replace the service.
+		{"ci.example.com", service, rootKeys[1], false},
+		// Issuers cannot sign tokens on behalf of each other.
+		{"ci.example.com", "registry-ci", rootKeys[0], false},
+		{"sso.example.com", service, rootKeys[1], false},
+		{"other.example.com", service, rootKeys[0], false},
+	} {
+		token, err := makeTestToken(tc.issuer, tc.audience, access, tc.rootKey, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("GET", "http://example.com/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.compactRaw()))
+
+		ctx := context.WithValue(nil, "http.request", req)
+		_, err = accessController.Authorized(ctx, testAccess)
+		if authorized := err == nil; authorized != tc.authorized {
+			t.Errorf("token of %s for %s: authorized %v, expected %v (%v)", tc.issuer, tc.audience, authorized, tc.authorized, err)
+		}
+	}
 }
@@ -0,0 +1,709 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+)
+
+// Admin is a client for the administrative API of a registry.
+type Admin interface {
+	// Repositories fills 'entries' with a lexigraphically sorted list of
+	// repositories, starting after 'last'. io.EOF is returned if there are
+	// no more entries.
+	Repositories(ctx context.Context, entries []string, last string) (int, error)
+
+	// Untag removes a tag from the named repository.
+	Untag(ctx context.Context, name reference.Named, tag string) error
+
+	// GarbageCollect removes the blobs not referenced by any manifest. The
+	// registry must be in read-only mode unless opts.DryRun is true.
+	GarbageCollect(ctx context.Context, opts GCOptions) (admin.GCResult, error)
+
+	// StartGarbageCollect starts a garbage collection run as a job, whose
+	// result is that of GarbageCollect once it completes.
+	StartGarbageCollect(ctx context.Context, opts GCOptions) (admin.Job, error)
+
+	// Pins returns the pins protecting content from garbage collection,
+	// those of the registry configuration first.
+	Pins(ctx context.Context) ([]admin.Pin, error)
+
+	// AddPin stores a pin of the digest or repository pattern set in pin,
+	// replacing any pin of the same digest or repository pattern.
+	AddPin(ctx context.Context, pin admin.Pin) (admin.Pin, error)
+
+	// RemovePin removes the stored pin of the digest or repository pattern
+	// set in pin.
+	RemovePin(ctx context.Context, pin admin.Pin) error
+
+	// ReadOnly returns whether the registry is in read-only mode.
+	ReadOnly(ctx context.Context) (bool, error)
+
+	// SetReadOnly enables or disables read-only mode.
+	SetReadOnly(ctx context.Context, enabled bool) error
+
+	// ReplayEvents sends the retained notification events newer than since
+	// to the endpoints again, returning the number of events replayed.
+	ReplayEvents(ctx context.Context, since time.Time) (int, error)
+
+	// WatchEvents streams the notification events of the given
+	// repositories, or of all repositories if none is given, as they are
+	// sent, calling fn with each until ctx is done or fn returns an error,
+	// which is returned.
+	WatchEvents(ctx context.Context, repositories []string, fn func(event notifications.Event) error) error
+
+	// MigrateLayout moves the blobs of the blob store to a layout version,
+	// the one configured in the registry if version is zero.
+	MigrateLayout(ctx context.Context, version int, dryRun bool) (admin.LayoutMigrationResult, error)
+
+	// StartMigrateLayout starts a layout migration as a job, whose result is
+	// that of MigrateLayout once it completes.
+	StartMigrateLayout(ctx context.Context, version int, dryRun bool) (admin.Job, error)
+
+	// Jobs returns the jobs retained by the registry, oldest first.
+	Jobs(ctx context.Context) ([]admin.Job, error)
+
+	// Job returns the status of the job with the given id.
+	Job(ctx context.Context, id string) (admin.Job, error)
+
+	// CancelJob asks the job with the given id to stop, returning its
+	// status.
+	CancelJob(ctx context.Context, id string) (admin.Job, error)
+
+	// Journal returns up to n entries of the metadata journal written after
+	// since and, among those written at since, after the entry with id last.
+	Journal(ctx context.Context, since time.Time, last string, n int) ([]admin.JournalEntry, error)
+
+	// RecoverJournal applies the mutations recorded in the journal since the
+	// given time which are missing from the storage backend, returning the
+	// number applied.
+	RecoverJournal(ctx context.Context, since time.Time) (int, error)
+
+	// Snapshot returns the tags of the named repository as they were at the
+	// given time, reconstructed from the journal, or the current tags if at
+	// is zero.
+	Snapshot(ctx context.Context, name reference.Named, at time.Time) (admin.RepositorySnapshot, error)
+
+	// Restore points the tags of the named repository back at the manifests
+	// recorded in a snapshot, removing the tags it does not record.
+	Restore(ctx context.Context, name reference.Named, snapshot admin.RepositorySnapshot, dryRun bool) (admin.RestoreResult, error)
+
+	// Prewarm starts fetching the manifests with the given tags or digests
+	// of the named repository, and their blobs, into a pull through cache.
+	Prewarm(ctx context.Context, name reference.Named, references []string) (admin.PrewarmStatus, error)
+
+	// PrewarmStatus returns the progress of the prewarm job with the given
+	// id.
+	PrewarmStatus(ctx context.Context, id string) (admin.PrewarmStatus, error)
+
+	// Usage returns the last storage usage report.
+	Usage(ctx context.Context) (admin.UsageReport, error)
+
+	// ComputeUsage computes a storage usage report and returns it.
+	ComputeUsage(ctx context.Context, opts UsageOptions) (admin.UsageReport, error)
+
+	// Users returns the users of the registry, if its access controller
+	// supports managing them.
+	Users(ctx context.Context) ([]string, error)
+
+	// SetPassword creates a user, or changes the password of an existing
+	// one.
+	SetPassword(ctx context.Context, username, password string) error
+
+	// RemoveUser removes a user.
+	RemoveUser(ctx context.Context, username string) error
+
+	// Leader returns the identity of the registry instance serving the
+	// request and which instance runs the background maintenance jobs.
+	Leader(ctx context.Context) (admin.Leadership, error)
+}
+
+// UsageOptions configures the computation of a storage usage report.
+type UsageOptions struct {
+	// Workers is the number of repositories read, or blobs sized,
+	// concurrently. The registry defaults to one.
+	Workers int
+
+	// RateLimit, if positive, is the maximum number of repositories read,
+	// or blobs sized, per second.
+	RateLimit float64
+}
+
+// GCOptions configures a garbage collection run.
+type GCOptions struct {
+	// DryRun reports the unreferenced blobs without deleting them.
+	DryRun bool
+
+	// Inventory, if set, is a bucket inventory of the type InventoryType
+	// listing the blobs to sweep, which the registry reads instead of
+	// listing the blob store. See admin.MediaTypeInventoryCSV and
+	// admin.MediaTypeInventoryJSON.
+	Inventory     io.Reader
+	InventoryType string
+
+	// Workers is the number of repositories marked, or blobs deleted,
+	// concurrently. The registry uses one worker if it is zero.
+	Workers int
+
+	// RateLimit, if positive, is the maximum number of repositories marked,
+	// or blobs deleted, per second.
+	RateLimit float64
+
+	// Resume continues an interrupted run from its checkpoint.
+	Resume bool
+}
+
+// NewAdmin creates a client for the admin API of the registry at baseURL.
+func NewAdmin(ctx context.Context, baseURL string, transport http.RoundTripper) (Admin, error) {
+	ub, err := admin.NewURLBuilderFromString(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkHTTPRedirect,
+	}
+
+	return &adminClient{
+		client:  client,
+		ub:      ub,
+		context: ctx,
+	}, nil
+}
+
+type adminClient struct {
+	client  *http.Client
+	ub      *admin.URLBuilder
+	context context.Context
+}
+
+func (ac *adminClient) Repositories(ctx context.Context, entries []string, last string) (int, error) {
+	values := url.Values{"n": {strconv.Itoa(len(entries))}}
+	if last != "" {
+		values.Set("last", last)
+	}
+
+	u, err := ac.ub.BuildRepositoriesURL(values)
+	if err != nil {
+		return 0, err
+	}
+
+	var list admin.RepositoryList
+	resp, err := ac.do("GET", u, nil, &list)
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(entries, list.Repositories)
+	if resp.Header.Get("Link") == "" {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (ac *adminClient) Untag(ctx context.Context, name reference.Named, tag string) error {
+	u, err := ac.ub.BuildTagURL(name, tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("DELETE", u, nil, nil)
+	return err
+}
+
+func (ac *adminClient) GarbageCollect(ctx context.Context, opts GCOptions) (admin.GCResult, error) {
+	var result admin.GCResult
+	err := ac.garbageCollect(opts, false, &result)
+	return result, err
+}
+
+func (ac *adminClient) StartGarbageCollect(ctx context.Context, opts GCOptions) (admin.Job, error) {
+	var job admin.Job
+	err := ac.garbageCollect(opts, true, &job)
+	return job, err
+}
+
+// garbageCollect sends a garbage collection request, decoding its response
+// into out.
+func (ac *adminClient) garbageCollect(opts GCOptions, async bool, out interface{}) error {
+	values := url.Values{}
+	if opts.DryRun {
+		values.Set("dryrun", "true")
+	}
+	if opts.Workers > 0 {
+		values.Set("workers", strconv.Itoa(opts.Workers))
+	}
+	if opts.RateLimit > 0 {
+		values.Set("ratelimit", strconv.FormatFloat(opts.RateLimit, 'f', -1, 64))
+	}
+	if opts.Resume {
+		values.Set("resume", "true")
+	}
+	if async {
+		values.Set("async", "true")
+	}
+
+	u, err := ac.ub.BuildGCURL(values)
+	if err != nil {
+		return err
+	}
+
+	if opts.Inventory == nil {
+		_, err = ac.do("POST", u, nil, out)
+		return err
+	}
+
+	req, err := http.NewRequest("POST", u, opts.Inventory)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", opts.InventoryType)
+
+	_, err = ac.send(req, out)
+	return err
+}
+
+func (ac *adminClient) Pins(ctx context.Context) ([]admin.Pin, error) {
+	u, err := ac.ub.BuildGCPinsURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var list admin.PinList
+	_, err = ac.do("GET", u, nil, &list)
+	return list.Pins, err
+}
+
+func (ac *adminClient) AddPin(ctx context.Context, pin admin.Pin) (admin.Pin, error) {
+	u, err := ac.ub.BuildGCPinsURL()
+	if err != nil {
+		return admin.Pin{}, err
+	}
+
+	var added admin.Pin
+	_, err = ac.do("POST", u, pin, &added)
+	return added, err
+}
+
+func (ac *adminClient) RemovePin(ctx context.Context, pin admin.Pin) error {
+	values := url.Values{}
+	if pin.Digest != "" {
+		values.Set("digest", pin.Digest.String())
+	}
+	if pin.Repository != "" {
+		values.Set("repository", pin.Repository)
+	}
+
+	u, err := ac.ub.BuildGCPinsURL(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("DELETE", u, nil, nil)
+	return err
+}
+
+func (ac *adminClient) ReadOnly(ctx context.Context) (bool, error) {
+	u, err := ac.ub.BuildReadOnlyURL()
+	if err != nil {
+		return false, err
+	}
+
+	var status admin.ReadOnlyStatus
+	_, err = ac.do("GET", u, nil, &status)
+	return status.Enabled, err
+}
+
+func (ac *adminClient) SetReadOnly(ctx context.Context, enabled bool) error {
+	u, err := ac.ub.BuildReadOnlyURL()
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("PUT", u, admin.ReadOnlyStatus{Enabled: enabled}, nil)
+	return err
+}
+
+func (ac *adminClient) ReplayEvents(ctx context.Context, since time.Time) (int, error) {
+	var values []url.Values
+	if !since.IsZero() {
+		values = append(values, url.Values{"since": {since.Format(time.RFC3339)}})
+	}
+
+	u, err := ac.ub.BuildEventsReplayURL(values...)
+	if err != nil {
+		return 0, err
+	}
+
+	var result admin.ReplayResult
+	_, err = ac.do("POST", u, nil, &result)
+	return result.Replayed, err
+}
+
+func (ac *adminClient) WatchEvents(ctx context.Context, repositories []string, fn func(event notifications.Event) error) error {
+	var values []url.Values
+	if len(repositories) > 0 {
+		values = append(values, url.Values{"repository": repositories})
+	}
+
+	u, err := ac.ub.BuildEventsStreamURL(values...)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := ac.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !SuccessStatus(resp.StatusCode) {
+		return HandleErrorResponse(resp)
+	}
+
+	// Events are separated by blank lines. Of their fields, only the event
+	// type and the data are used, comments are ignored.
+	var eventType string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxStreamedEventSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := dispatchStreamedEvent(ctx, eventType, strings.Join(data, "\n"), fn); err != nil {
+					return err
+				}
+			}
+			eventType, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// maxStreamedEventSize bounds the size of a line of the event stream.
+const maxStreamedEventSize = 1 << 20
+
+// dispatchStreamedEvent calls fn with an event of the event stream. The
+// number of events dropped by the registry is logged.
+func dispatchStreamedEvent(ctx context.Context, eventType, data string, fn func(event notifications.Event) error) error {
+	if eventType == "dropped" {
+		context.GetLogger(ctx).Warnf("%s events dropped by the registry", data)
+		return nil
+	}
+
+	var event notifications.Event
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return fmt.Errorf("invalid streamed event: %v", err)
+	}
+	return fn(event)
+}
+
+func (ac *adminClient) MigrateLayout(ctx context.Context, version int, dryRun bool) (admin.LayoutMigrationResult, error) {
+	var result admin.LayoutMigrationResult
+	err := ac.migrateLayout(version, dryRun, false, &result)
+	return result, err
+}
+
+func (ac *adminClient) StartMigrateLayout(ctx context.Context, version int, dryRun bool) (admin.Job, error) {
+	var job admin.Job
+	err := ac.migrateLayout(version, dryRun, true, &job)
+	return job, err
+}
+
+// migrateLayout sends a layout migration request, decoding its response into
+// out.
+func (ac *adminClient) migrateLayout(version int, dryRun, async bool, out interface{}) error {
+	values := url.Values{}
+	if version > 0 {
+		values.Set("version", strconv.Itoa(version))
+	}
+	if dryRun {
+		values.Set("dryrun", "true")
+	}
+	if async {
+		values.Set("async", "true")
+	}
+
+	u, err := ac.ub.BuildLayoutURL(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("POST", u, nil, out)
+	return err
+}
+
+func (ac *adminClient) Jobs(ctx context.Context) ([]admin.Job, error) {
+	u, err := ac.ub.BuildJobsURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var list admin.JobList
+	_, err = ac.do("GET", u, nil, &list)
+	return list.Jobs, err
+}
+
+func (ac *adminClient) Job(ctx context.Context, id string) (admin.Job, error) {
+	u, err := ac.ub.BuildJobURL(id)
+	if err != nil {
+		return admin.Job{}, err
+	}
+
+	var job admin.Job
+	_, err = ac.do("GET", u, nil, &job)
+	return job, err
+}
+
+func (ac *adminClient) CancelJob(ctx context.Context, id string) (admin.Job, error) {
+	u, err := ac.ub.BuildJobURL(id)
+	if err != nil {
+		return admin.Job{}, err
+	}
+
+	var job admin.Job
+	_, err = ac.do("DELETE", u, nil, &job)
+	return job, err
+}
+
+func (ac *adminClient) Journal(ctx context.Context, since time.Time, last string, n int) ([]admin.JournalEntry, error) {
+	values := url.Values{}
+	if !since.IsZero() {
+		values.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if last != "" {
+		values.Set("last", last)
+	}
+	if n > 0 {
+		values.Set("n", strconv.Itoa(n))
+	}
+
+	u, err := ac.ub.BuildJournalURL(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var result admin.JournalEntries
+	_, err = ac.do("GET", u, nil, &result)
+	return result.Entries, err
+}
+
+func (ac *adminClient) RecoverJournal(ctx context.Context, since time.Time) (int, error) {
+	values := url.Values{}
+	if !since.IsZero() {
+		values.Set("since", since.Format(time.RFC3339Nano))
+	}
+
+	u, err := ac.ub.BuildJournalRecoverURL(values)
+	if err != nil {
+		return 0, err
+	}
+
+	var result admin.JournalRecoveryResult
+	_, err = ac.do("POST", u, nil, &result)
+	return result.Applied, err
+}
+
+func (ac *adminClient) Snapshot(ctx context.Context, name reference.Named, at time.Time) (admin.RepositorySnapshot, error) {
+	values := url.Values{}
+	if !at.IsZero() {
+		values.Set("at", at.Format(time.RFC3339Nano))
+	}
+
+	u, err := ac.ub.BuildSnapshotURL(name, values)
+	if err != nil {
+		return admin.RepositorySnapshot{}, err
+	}
+
+	var snapshot admin.RepositorySnapshot
+	_, err = ac.do("GET", u, nil, &snapshot)
+	return snapshot, err
+}
+
+func (ac *adminClient) Restore(ctx context.Context, name reference.Named, snapshot admin.RepositorySnapshot, dryRun bool) (admin.RestoreResult, error) {
+	values := url.Values{}
+	if dryRun {
+		values.Set("dryrun", "true")
+	}
+
+	u, err := ac.ub.BuildRestoreURL(name, values)
+	if err != nil {
+		return admin.RestoreResult{}, err
+	}
+
+	var result admin.RestoreResult
+	_, err = ac.do("POST", u, snapshot, &result)
+	return result, err
+}
+
+func (ac *adminClient) Prewarm(ctx context.Context, name reference.Named, references []string) (admin.PrewarmStatus, error) {
+	u, err := ac.ub.BuildPrewarmURL(name)
+	if err != nil {
+		return admin.PrewarmStatus{}, err
+	}
+
+	var status admin.PrewarmStatus
+	_, err = ac.do("POST", u, admin.PrewarmRequest{References: references}, &status)
+	return status, err
+}
+
+func (ac *adminClient) PrewarmStatus(ctx context.Context, id string) (admin.PrewarmStatus, error) {
+	u, err := ac.ub.BuildPrewarmStatusURL(id)
+	if err != nil {
+		return admin.PrewarmStatus{}, err
+	}
+
+	var status admin.PrewarmStatus
+	_, err = ac.do("GET", u, nil, &status)
+	return status, err
+}
+
+func (ac *adminClient) Usage(ctx context.Context) (admin.UsageReport, error) {
+	u, err := ac.ub.BuildUsageURL()
+	if err != nil {
+		return admin.UsageReport{}, err
+	}
+
+	var report admin.UsageReport
+	_, err = ac.do("GET", u, nil, &report)
+	return report, err
+}
+
+func (ac *adminClient) ComputeUsage(ctx context.Context, opts UsageOptions) (admin.UsageReport, error) {
+	values := url.Values{}
+	if opts.Workers > 0 {
+		values.Set("workers", strconv.Itoa(opts.Workers))
+	}
+	if opts.RateLimit > 0 {
+		values.Set("ratelimit", strconv.FormatFloat(opts.RateLimit, 'f', -1, 64))
+	}
+
+	u, err := ac.ub.BuildUsageURL(values)
+	if err != nil {
+		return admin.UsageReport{}, err
+	}
+
+	var report admin.UsageReport
+	_, err = ac.do("POST", u, nil, &report)
+	return report, err
+}
+
+func (ac *adminClient) Users(ctx context.Context) ([]string, error) {
+	u, err := ac.ub.BuildUsersURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var list admin.UserList
+	_, err = ac.do("GET", u, nil, &list)
+	return list.Users, err
+}
+
+func (ac *adminClient) SetPassword(ctx context.Context, username, password string) error {
+	u, err := ac.ub.BuildUserURL(username)
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("PUT", u, admin.UserPassword{Password: password}, nil)
+	return err
+}
+
+func (ac *adminClient) RemoveUser(ctx context.Context, username string) error {
+	u, err := ac.ub.BuildUserURL(username)
+	if err != nil {
+		return err
+	}
+
+	_, err = ac.do("DELETE", u, nil, nil)
+	return err
+}
+
+func (ac *adminClient) Leader(ctx context.Context) (admin.Leadership, error) {
+	u, err := ac.ub.BuildLeaderURL()
+	if err != nil {
+		return admin.Leadership{}, err
+	}
+
+	var leadership admin.Leadership
+	_, err = ac.do("GET", u, nil, &leadership)
+	return leadership, err
+}
+
+// do issues a request with an optional JSON body, decoding a successful JSON
+// response into out, if provided.
+func (ac *adminClient) do(method, u string, in, out interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		p, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(p)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return ac.send(req, out)
+}
+
+// send sends the request and decodes a successful JSON response into out,
+// unless out is nil.
+func (ac *adminClient) send(req *http.Request, out interface{}) (*http.Response, error) {
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !SuccessStatus(resp.StatusCode) {
+		return nil, HandleErrorResponse(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
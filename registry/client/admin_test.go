@@ -0,0 +1,379 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/testutil"
+)
+
+func TestAdminClient(t *testing.T) {
+	deleted := digest.FromBytes([]byte("orphan"))
+
+	m := testutil.RequestResponseMap([]testutil.RequestResponseMapping{
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/repositories?n=10",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"repositories":["foo/bar","hello/world"]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "DELETE",
+				Route:  "/admin/v1/repositories/foo/bar/tags/latest",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusAccepted,
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/gc",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusConflict,
+				Body:       []byte(`{"errors":[{"code":"NOT_READ_ONLY","message":"registry is not in read-only mode"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/gc?dryrun=true",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"dryRun":true,"marked":3,"deleted":["` + deleted.String() + `"]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/gc?dryrun=true",
+				Body:   []byte(`{"key":"docker/registry/v2/blobs/` + deleted.Algorithm().String() + `/` + deleted.Hex()[:2] + `/` + deleted.Hex() + `/data"}` + "\n"),
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"dryRun":true,"marked":3,"deleted":["` + deleted.String() + `"]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/gc/pins",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"pins":[{"repository":"library/*","created":"0001-01-01T00:00:00Z","configured":true},{"digest":"` + deleted.String() + `","comment":"base image","created":"2016-01-02T15:04:05Z"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/gc/pins",
+				Body:   []byte(`{"digest":"` + deleted.String() + `","comment":"base image","created":"0001-01-01T00:00:00Z"}`),
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusCreated,
+				Body:       []byte(`{"digest":"` + deleted.String() + `","comment":"base image","created":"2016-01-02T15:04:05Z"}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "DELETE",
+				Route:  "/admin/v1/gc/pins?repository=library%2F%2A",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       []byte(`{"errors":[{"code":"PIN_UNKNOWN","message":"pin unknown to registry"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "PUT",
+				Route:  "/admin/v1/readonly",
+				Body:   []byte(`{"enabled":true}`),
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"enabled":true}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/readonly",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"enabled":true}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/events/replay",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"since":"0001-01-01T00:00:00Z","replayed":4}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/users",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"users":["frodo","sam"]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "PUT",
+				Route:  "/admin/v1/users/pippin",
+				Body:   []byte(`{"password":"took"}`),
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusNoContent,
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "DELETE",
+				Route:  "/admin/v1/users/merry",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       []byte(`{"errors":[{"code":"USER_UNKNOWN","message":"user unknown to registry"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "POST",
+				Route:  "/admin/v1/gc?async=true&dryrun=true",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusAccepted,
+				Body:       []byte(`{"id":"a1","type":"gc","state":"running","started":"2016-01-02T03:04:05Z"}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/jobs",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"jobs":[{"id":"a1","type":"gc","state":"running","started":"2016-01-02T03:04:05Z"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/jobs/a1",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"id":"a1","type":"gc","state":"completed","result":{"dryRun":true,"marked":3},"started":"2016-01-02T03:04:05Z","finished":"2016-01-02T03:04:06Z"}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "DELETE",
+				Route:  "/admin/v1/jobs/b2",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       []byte(`{"errors":[{"code":"JOB_UNKNOWN","message":"job unknown to registry"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/admin/v1/leader",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"instance":"registry-1","election":"redis","leader":"registry-2","expires":"2016-01-02T03:04:05Z","leading":false,"jobs":["uploadpurging"]}`),
+			},
+		},
+	})
+
+	e, c := testServer(m)
+	defer c()
+
+	ctx := context.Background()
+	ac, err := NewAdmin(ctx, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make([]string, 10)
+	n, err := ac.Repositories(ctx, entries, "")
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF listing repositories, got %v", err)
+	}
+	if n != 2 || entries[0] != "foo/bar" || entries[1] != "hello/world" {
+		t.Fatalf("unexpected repositories: %v", entries[:n])
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	if err := ac.Untag(ctx, named, "latest"); err != nil {
+		t.Fatalf("unexpected error removing tag: %v", err)
+	}
+
+	_, err = ac.GarbageCollect(ctx, GCOptions{})
+	if errs, ok := err.(errcode.Errors); !ok || len(errs) != 1 || errs[0].(errcode.ErrorCoder).ErrorCode() != admin.ErrorCodeNotReadOnly {
+		t.Fatalf("expected NOT_READ_ONLY error, got %#v", err)
+	}
+
+	result, err := ac.GarbageCollect(ctx, GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error running gc: %v", err)
+	}
+	if !result.DryRun || result.Marked != 3 || len(result.Deleted) != 1 || result.Deleted[0] != deleted {
+		t.Fatalf("unexpected gc result: %#v", result)
+	}
+
+	result, err = ac.GarbageCollect(ctx, GCOptions{
+		DryRun:        true,
+		Inventory:     strings.NewReader(`{"key":"docker/registry/v2/blobs/` + deleted.Algorithm().String() + `/` + deleted.Hex()[:2] + `/` + deleted.Hex() + `/data"}` + "\n"),
+		InventoryType: admin.MediaTypeInventoryJSON,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error running gc with inventory: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != deleted {
+		t.Fatalf("unexpected gc result: %#v", result)
+	}
+
+	pins, err := ac.Pins(ctx)
+	if err != nil || len(pins) != 2 || !pins[0].Configured || pins[0].Repository != "library/*" || pins[1].Digest != deleted {
+		t.Fatalf("unexpected pins: %+v, %v", pins, err)
+	}
+
+	pin, err := ac.AddPin(ctx, admin.Pin{Digest: deleted, Comment: "base image"})
+	if err != nil || pin.Digest != deleted || pin.Created.IsZero() {
+		t.Fatalf("unexpected pin: %+v, %v", pin, err)
+	}
+
+	err = ac.RemovePin(ctx, admin.Pin{Repository: "library/*"})
+	if errs, ok := err.(errcode.Errors); !ok || len(errs) != 1 || errs[0].(errcode.ErrorCoder).ErrorCode() != admin.ErrorCodePinUnknown {
+		t.Fatalf("expected PIN_UNKNOWN error, got %#v", err)
+	}
+
+	job, err := ac.StartGarbageCollect(ctx, GCOptions{DryRun: true})
+	if err != nil || job.ID != "a1" || job.State != admin.JobStateRunning {
+		t.Fatalf("unexpected gc job: %+v, %v", job, err)
+	}
+
+	if jobs, err := ac.Jobs(ctx); err != nil || len(jobs) != 1 || jobs[0].ID != "a1" {
+		t.Fatalf("unexpected jobs: %+v, %v", jobs, err)
+	}
+
+	job, err = ac.Job(ctx, "a1")
+	if err != nil || job.State != admin.JobStateCompleted || job.Finished == nil {
+		t.Fatalf("unexpected job status: %+v, %v", job, err)
+	}
+	var jobResult admin.GCResult
+	if err := json.Unmarshal(job.Result, &jobResult); err != nil || !jobResult.DryRun || jobResult.Marked != 3 {
+		t.Fatalf("unexpected job result: %#v, %v", jobResult, err)
+	}
+
+	_, err = ac.CancelJob(ctx, "b2")
+	if errs, ok := err.(errcode.Errors); !ok || len(errs) != 1 || errs[0].(errcode.ErrorCoder).ErrorCode() != admin.ErrorCodeJobUnknown {
+		t.Fatalf("expected JOB_UNKNOWN error, got %#v", err)
+	}
+
+	leadership, err := ac.Leader(ctx)
+	if err != nil || leadership.Instance != "registry-1" || leadership.Leader != "registry-2" || leadership.Leading || len(leadership.Jobs) != 1 {
+		t.Fatalf("unexpected leadership: %+v, %v", leadership, err)
+	}
+
+	if err := ac.SetReadOnly(ctx, true); err != nil {
+		t.Fatalf("unexpected error enabling read-only mode: %v", err)
+	}
+
+	if readOnly, err := ac.ReadOnly(ctx); err != nil || !readOnly {
+		t.Fatalf("unexpected read-only status: %v, %v", readOnly, err)
+	}
+
+	if replayed, err := ac.ReplayEvents(ctx, time.Time{}); err != nil || replayed != 4 {
+		t.Fatalf("unexpected replay result: %d, %v", replayed, err)
+	}
+
+	if users, err := ac.Users(ctx); err != nil || len(users) != 2 || users[0] != "frodo" || users[1] != "sam" {
+		t.Fatalf("unexpected users: %v, %v", users, err)
+	}
+
+	if err := ac.SetPassword(ctx, "pippin", "took"); err != nil {
+		t.Fatalf("unexpected error setting password: %v", err)
+	}
+
+	err = ac.RemoveUser(ctx, "merry")
+	if errs, ok := err.(errcode.Errors); !ok || len(errs) != 1 || errs[0].(errcode.ErrorCoder).ErrorCode() != admin.ErrorCodeUserUnknown {
+		t.Fatalf("expected USER_UNKNOWN error, got %#v", err)
+	}
+}
+
+func TestAdminClientWatchEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/v1/events/stream" || r.URL.RawQuery != "repository=foo%2Fbar" {
+			t.Errorf("unexpected request: %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": heartbeat\n\n")
+		io.WriteString(w, "id: 1\nevent: push\ndata: {\"id\":\"1\",\"action\":\"push\",\"target\":{\"repository\":\"foo/bar\"}}\n\n")
+		io.WriteString(w, "event: dropped\ndata: 3\n\n")
+		io.WriteString(w, "id: 2\nevent: pull\ndata: {\"id\":\"2\",\"action\":\"pull\",\"target\":{\"repository\":\"foo/bar\"}}\n\n")
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	ac, err := NewAdmin(ctx, server.URL, nil)
+	if err != nil {
+		t.Fatalf("error creating admin client: %v", err)
+	}
+
+	var events []notifications.Event
+	err = ac.WatchEvents(ctx, []string{"foo/bar"}, func(event notifications.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF once the stream ends, got %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "1" || events[0].Action != "push" || events[1].ID != "2" || events[1].Target.Repository != "foo/bar" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+
+	// An error returned by fn ends the stream.
+	stop := errors.New("stop")
+	err = ac.WatchEvents(ctx, []string{"foo/bar"}, func(event notifications.Event) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+}
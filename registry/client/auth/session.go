@@ -52,15 +52,20 @@ type endpointAuthorizer struct {
 }
 
 func (ea *endpointAuthorizer) ModifyRequest(req *http.Request) error {
-	v2Root := strings.Index(req.URL.Path, "/v2/")
-	if v2Root == -1 {
-		return nil
+	apiRoot := strings.Index(req.URL.Path, "/v2/")
+	if apiRoot == -1 {
+		// Requests to the admin API are authorized with the challenges
+		// of the V2 API endpoint of the same registry.
+		apiRoot = strings.Index(req.URL.Path, "/admin/v1/")
+		if apiRoot == -1 {
+			return nil
+		}
 	}
 
 	ping := url.URL{
 		Host:   req.URL.Host,
 		Scheme: req.URL.Scheme,
-		Path:   req.URL.Path[:v2Root+4],
+		Path:   req.URL.Path[:apiRoot] + "/v2/",
 	}
 
 	pingEndpoint := ping.String()
@@ -136,6 +141,15 @@ func NewTokenHandler(transport http.RoundTripper, creds CredentialStore, scope s
 	return newTokenHandler(transport, creds, realClock{}, scope, actions...)
 }
 
+// NewRegistryTokenHandler creates a new AuthenticationHandler which fetches
+// tokens scoped to a registry-wide resource, such as "catalog" or "admin",
+// rather than to a repository.
+func NewRegistryTokenHandler(transport http.RoundTripper, creds CredentialStore, name string, actions ...string) AuthenticationHandler {
+	th := newTokenHandler(transport, creds, realClock{}, name, actions...).(*tokenHandler)
+	th.scope.Resource = "registry"
+	return th
+}
+
 // newTokenHandler exposes the option to provide a clock to manipulate time in unit testing.
 func newTokenHandler(transport http.RoundTripper, creds CredentialStore, c clock, scope string, actions ...string) AuthenticationHandler {
 	return &tokenHandler{
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/distribution"
+)
+
+// ProgressFunc is called while blob content is uploaded with the total number
+// of bytes sent so far.
+type ProgressFunc func(sent int64)
+
+// WithProgress returns a BlobCreateOption which reports the progress of the
+// upload to fn.
+func WithProgress(fn ProgressFunc) distribution.BlobCreateOption {
+	return optionFunc(func(v interface{}) error {
+		opts, ok := v.(*createOptions)
+		if !ok {
+			return fmt.Errorf("unexpected options type: %T", v)
+		}
+
+		opts.Progress = fn
+
+		return nil
+	})
+}
+
+// WithBandwidthLimit returns a BlobCreateOption which caps the rate at which
+// blob content is uploaded to bytesPerSecond. A value of zero disables the
+// limit.
+func WithBandwidthLimit(bytesPerSecond int64) distribution.BlobCreateOption {
+	return optionFunc(func(v interface{}) error {
+		opts, ok := v.(*createOptions)
+		if !ok {
+			return fmt.Errorf("unexpected options type: %T", v)
+		}
+
+		if bytesPerSecond < 0 {
+			return fmt.Errorf("invalid bandwidth limit: %d", bytesPerSecond)
+		}
+		opts.BandwidthLimit = bytesPerSecond
+
+		return nil
+	})
+}
+
+// bandwidthLimiter paces writes so that the average rate since the first
+// write does not exceed rate bytes per second.
+type bandwidthLimiter struct {
+	rate  int64
+	start time.Time
+	sent  int64
+
+	// sleep is replaced in tests.
+	sleep func(time.Duration)
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &bandwidthLimiter{
+		rate:  bytesPerSecond,
+		sleep: time.Sleep,
+	}
+}
+
+// chunk returns the largest number of bytes which may be sent at once.
+func (bl *bandwidthLimiter) chunk(n int) int {
+	if int64(n) > bl.rate {
+		return int(bl.rate)
+	}
+	return n
+}
+
+// wait accounts for n sent bytes, blocking until the rate allows them.
+func (bl *bandwidthLimiter) wait(n int) {
+	if bl.start.IsZero() {
+		bl.start = time.Now()
+	}
+	bl.sent += int64(n)
+
+	due := time.Duration(float64(bl.sent) / float64(bl.rate) * float64(time.Second))
+	if delay := due - time.Since(bl.start); delay > 0 {
+		bl.sleep(delay)
+	}
+}
+
+// uploadReader wraps the content of an upload request, reporting progress and
+// enforcing the bandwidth limit of the upload.
+type uploadReader struct {
+	r   io.Reader
+	hbu *httpBlobUpload
+}
+
+func (ur *uploadReader) Read(p []byte) (int, error) {
+	if ur.hbu.limiter != nil {
+		p = p[:ur.hbu.limiter.chunk(len(p))]
+	}
+
+	n, err := ur.r.Read(p)
+	if n > 0 {
+		if ur.hbu.limiter != nil {
+			ur.hbu.limiter.wait(n)
+		}
+
+		ur.hbu.sent += int64(n)
+		if ur.hbu.progress != nil {
+			ur.hbu.progress(ur.hbu.sent)
+		}
+	}
+
+	return n, err
+}
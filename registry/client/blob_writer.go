@@ -23,6 +23,18 @@ type httpBlobUpload struct {
 	location string // always the last value of the location header.
 	offset   int64
 	closed   bool
+
+	progress ProgressFunc
+	limiter  *bandwidthLimiter
+	sent     int64 // bytes of content sent, reported to progress.
+}
+
+// body wraps r for reporting progress and limiting bandwidth, if configured.
+func (hbu *httpBlobUpload) body(r io.Reader) io.Reader {
+	if hbu.progress == nil && hbu.limiter == nil {
+		return r
+	}
+	return &uploadReader{r: r, hbu: hbu}
 }
 
 func (hbu *httpBlobUpload) Reader() (io.ReadCloser, error) {
@@ -37,7 +49,7 @@ func (hbu *httpBlobUpload) handleErrorResponse(resp *http.Response) error {
 }
 
 func (hbu *httpBlobUpload) ReadFrom(r io.Reader) (n int64, err error) {
-	req, err := http.NewRequest("PATCH", hbu.location, ioutil.NopCloser(r))
+	req, err := http.NewRequest("PATCH", hbu.location, ioutil.NopCloser(hbu.body(r)))
 	if err != nil {
 		return 0, err
 	}
@@ -70,10 +82,11 @@ func (hbu *httpBlobUpload) ReadFrom(r io.Reader) (n int64, err error) {
 }
 
 func (hbu *httpBlobUpload) Write(p []byte) (n int, err error) {
-	req, err := http.NewRequest("PATCH", hbu.location, bytes.NewReader(p))
+	req, err := http.NewRequest("PATCH", hbu.location, hbu.body(bytes.NewReader(p)))
 	if err != nil {
 		return 0, err
 	}
+	req.ContentLength = int64(len(p))
 	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", hbu.offset, hbu.offset+int64(len(p)-1)))
 	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(p)))
 	req.Header.Set("Content-Type", "application/octet-stream")
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
@@ -209,3 +210,71 @@ func TestUploadReadFrom(t *testing.T) {
 		t.Fatalf("Unexpected response status: %s, expected %s", uploadErr.Status, expected)
 	}
 }
+
+func TestUploadProgressAndBandwidthLimit(t *testing.T) {
+	_, b := newRandomBlob(1024)
+	repo := "test/upload/progress"
+	locationPath := fmt.Sprintf("/v2/%s/uploads/testid", repo)
+
+	m := testutil.RequestResponseMap([]testutil.RequestResponseMapping{
+		{
+			Request: testutil.Request{
+				Method: "PATCH",
+				Route:  locationPath,
+				Body:   b,
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusAccepted,
+				Headers: http.Header(map[string][]string{
+					"Docker-Upload-UUID": {"46603072-7a1b-4b41-98f9-fd8a7da89f9b"},
+					"Location":           {locationPath},
+					"Range":              {"0-1023"},
+				}),
+			},
+		},
+	})
+
+	e, c := testServer(m)
+	defer c()
+
+	var progress []int64
+	var slept time.Duration
+	limiter := newBandwidthLimiter(256)
+	limiter.sleep = func(d time.Duration) {
+		// Move the start of the upload back instead of sleeping.
+		slept += d
+		limiter.start = limiter.start.Add(-d)
+	}
+
+	blobUpload := &httpBlobUpload{
+		client:   &http.Client{},
+		location: e + locationPath,
+		progress: func(sent int64) { progress = append(progress, sent) },
+		limiter:  limiter,
+	}
+
+	n, err := blobUpload.ReadFrom(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Error calling ReadFrom: %s", err)
+	}
+	if n != 1024 {
+		t.Fatalf("Wrong length returned from ReadFrom: %d, expected 1024", n)
+	}
+
+	// Reads are capped to the rate, so at least four progress updates are
+	// reported, ending with the full size.
+	if len(progress) < 4 || progress[len(progress)-1] != 1024 {
+		t.Fatalf("Unexpected progress updates: %v", progress)
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("Progress is not increasing: %v", progress)
+		}
+	}
+
+	// Sending 1024 bytes at 256 bytes per second takes four seconds.
+	if slept < 3*time.Second || slept > 4*time.Second {
+		t.Fatalf("Unexpected time spent waiting for bandwidth: %v", slept)
+	}
+}
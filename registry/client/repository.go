@@ -303,6 +303,8 @@ check:
 	switch {
 	case resp.StatusCode >= 200 && resp.StatusCode < 400:
 		return descriptorFromResponse(resp)
+	case resp.StatusCode == http.StatusNotFound:
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
 	case resp.StatusCode == http.StatusMethodNotAllowed:
 		resp, err = t.client.Get(u)
 		attempts++
@@ -599,6 +601,10 @@ func (bs *blobs) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
 	return ioutil.ReadAll(reader)
 }
 
+// maxBlobReadResumes is the number of times an interrupted blob download is
+// resumed from the last offset read before the error is returned.
+const maxBlobReadResumes = 3
+
 func (bs *blobs) Open(ctx context.Context, dgst digest.Digest) (distribution.ReadSeekCloser, error) {
 	ref, err := reference.WithDigest(bs.name, dgst)
 	if err != nil {
@@ -609,13 +615,13 @@ func (bs *blobs) Open(ctx context.Context, dgst digest.Digest) (distribution.Rea
 		return nil, err
 	}
 
-	return transport.NewHTTPReadSeeker(bs.client, blobURL,
+	return transport.NewResumableHTTPReadSeeker(bs.client, blobURL,
 		func(resp *http.Response) error {
 			if resp.StatusCode == http.StatusNotFound {
 				return distribution.ErrBlobUnknown
 			}
 			return HandleErrorResponse(resp)
-		}), nil
+		}, maxBlobReadResumes, nil), nil
 }
 
 func (bs *blobs) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
@@ -652,6 +658,9 @@ type createOptions struct {
 		ShouldMount bool
 		From        reference.Canonical
 	}
+
+	Progress       ProgressFunc
+	BandwidthLimit int64
 }
 
 type optionFunc func(interface{}) error
@@ -724,6 +733,8 @@ func (bs *blobs) Create(ctx context.Context, options ...distribution.BlobCreateO
 			uuid:      uuid,
 			startedAt: time.Now(),
 			location:  location,
+			progress:  opts.Progress,
+			limiter:   newBandwidthLimiter(opts.BandwidthLimit),
 		}, nil
 	default:
 		return nil, HandleErrorResponse(resp)
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 var (
@@ -37,10 +39,34 @@ func NewHTTPReadSeeker(client *http.Client, url string, errorHandler func(*http.
 	}
 }
 
+// NewResumableHTTPReadSeeker is like NewHTTPReadSeeker but resumes reading
+// when the connection fails before the content has been read completely. The
+// request is reissued with a Range header from the current offset, up to
+// maxResumes times per read, waiting according to backoff between attempts.
+// If backoff is nil, DefaultBackoff is used.
+func NewResumableHTTPReadSeeker(client *http.Client, url string, errorHandler func(*http.Response) error, maxResumes int, backoff Backoff) ReadSeekCloser {
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	return &httpReadSeeker{
+		client:       client,
+		url:          url,
+		errorHandler: errorHandler,
+		maxResumes:   maxResumes,
+		backoff:      backoff,
+	}
+}
+
 type httpReadSeeker struct {
 	client *http.Client
 	url    string
 
+	// maxResumes is the number of times a failed read may be resumed with
+	// a range request, waiting according to backoff between attempts.
+	maxResumes int
+	backoff    Backoff
+
 	// errorHandler creates an error from an unsuccessful HTTP response.
 	// This allows the error to be created with the HTTP response body
 	// without leaking the body through a returned error.
@@ -78,16 +104,33 @@ func (hrs *httpReadSeeker) Read(p []byte) (n int, err error) {
 
 	hrs.readerOffset = hrs.seekOffset
 
-	rd, err := hrs.reader()
-	if err != nil {
-		return 0, err
-	}
+	for attempt := 0; ; attempt++ {
+		rd, err := hrs.reader()
+		if err != nil {
+			// Only failures to reach the server are retried; errors derived
+			// from a response, such as an unknown blob, are permanent.
+			if _, ok := err.(*url.Error); !ok || attempt >= hrs.maxResumes {
+				return 0, err
+			}
+		} else {
+			n, err = rd.Read(p)
+			hrs.seekOffset += int64(n)
+			hrs.readerOffset += int64(n)
 
-	n, err = rd.Read(p)
-	hrs.seekOffset += int64(n)
-	hrs.readerOffset += int64(n)
+			if err == nil || err == io.EOF || attempt >= hrs.maxResumes {
+				return n, err
+			}
 
-	return n, err
+			// Drop the failed connection. The next request resumes from
+			// the current offset.
+			hrs.reset()
+			if n > 0 {
+				return n, nil
+			}
+		}
+
+		time.Sleep(hrs.backoff(attempt + 1))
+	}
 }
 
 func (hrs *httpReadSeeker) Seek(offset int64, whence int) (int64, error) {
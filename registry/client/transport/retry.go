@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff returns the delay to wait before the given retry attempt, counting
+// from 1.
+type Backoff func(attempt int) time.Duration
+
+// ExponentialBackoff returns a Backoff doubling the delay after each attempt,
+// starting at base and never exceeding max.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// DefaultBackoff is the backoff used when none is provided.
+var DefaultBackoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+
+// MaxRetryAfter bounds the delay taken from a Retry-After response header, so
+// that a server cannot hold a request indefinitely.
+var MaxRetryAfter = time.Minute
+
+// NewRetryTransport returns a transport which retries idempotent requests
+// (GET and HEAD) that fail with a network error or a transient status (429,
+// 502, 503 and 504), up to maxRetries times. The delay between attempts is
+// taken from a Retry-After response header if present, up to MaxRetryAfter,
+// and from backoff otherwise. If backoff is nil, DefaultBackoff is used. A
+// request whose context is done while waiting fails with the error of the
+// context.
+func NewRetryTransport(base http.RoundTripper, maxRetries int, backoff Backoff) http.RoundTripper {
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	return &retryTransport{
+		Base:       base,
+		MaxRetries: maxRetries,
+		Backoff:    backoff,
+	}
+}
+
+// retryTransport is an http.RoundTripper that retries failed idempotent
+// requests.
+type retryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	Backoff    Backoff
+
+	// sleep is replaced in tests.
+	sleep func(time.Duration)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return t.base().RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base().RoundTrip(req)
+		if attempt > t.MaxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := t.Backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = after
+			}
+
+			// Drain and release the connection before retrying.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := t.wait(req, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *retryTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// wait waits for d before retrying req, returning early with the error of
+// the context of req if it is done first.
+func (t *retryTransport) wait(req *http.Request, d time.Duration) error {
+	if t.sleep != nil {
+		t.sleep(d)
+		return nil
+	}
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// retryable returns true if the outcome of a request indicates a transient
+// failure.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// retryAfter parses the Retry-After header of resp, supporting only the
+// delay-seconds form, and bounds it by MaxRetryAfter.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	if int64(seconds) > int64(MaxRetryAfter/time.Second) {
+		return MaxRetryAfter
+	}
+	return time.Duration(seconds) * time.Second
+}
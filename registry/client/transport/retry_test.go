@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+	for attempt, expected := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		if d := backoff(attempt + 1); d != expected {
+			t.Fatalf("unexpected backoff for attempt %d: %v != %v", attempt+1, d, expected)
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	rt := NewRetryTransport(nil, 3, ExponentialBackoff(time.Millisecond, time.Millisecond)).(*retryTransport)
+	rt.sleep = func(d time.Duration) { delays = append(delays, d) }
+	client := &http.Client{Transport: rt}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %v", resp.Status)
+	}
+
+	if requests != 3 || len(delays) != 2 {
+		t.Fatalf("unexpected number of attempts: %d requests, %d delays", requests, len(delays))
+	}
+
+	// Non-idempotent requests are not retried.
+	atomic.StoreInt32(&requests, 0)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Fatalf("POST should not be retried: %v after %d requests", resp.Status, requests)
+	}
+
+	// Retries are bounded.
+	atomic.StoreInt32(&requests, -10)
+	rt.MaxRetries = 2
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || requests != -7 {
+		t.Fatalf("unexpected result after exhausting retries: %v after %d requests", resp.Status, requests+10)
+	}
+}
+
+// TestRetryTransportWait checks that Retry-After delays are bounded, and that
+// waiting to retry stops once the context of the request is done.
+func TestRetryTransportWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"86400"}}}
+	if d := retryAfter(resp); d != MaxRetryAfter {
+		t.Fatalf("unexpected delay for a long Retry-After: %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+
+	start := time.Now()
+	client := &http.Client{Transport: NewRetryTransport(nil, 3, nil)}
+	if _, err := client.Do(req.WithContext(ctx)); err == nil {
+		t.Fatalf("expected the request to fail once its context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("waiting to retry outlived the context: %v", elapsed)
+	}
+}
+
+func TestResumableHTTPReadSeeker(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		var start int
+		if rng := r.Header.Get("Range"); rng != "" {
+			var err error
+			start, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if err != nil {
+				t.Errorf("unexpected range header %q", rng)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		}
+
+		remaining := content[start:]
+		if n < 3 {
+			// Interrupt the response after a part of the content, which
+			// the client sees as an unexpected EOF.
+			w.Write(remaining[:len(remaining)/3])
+			return
+		}
+		w.Write(remaining)
+	}))
+	defer server.Close()
+
+	rs := NewResumableHTTPReadSeeker(http.DefaultClient, server.URL, nil, 3, ExponentialBackoff(time.Millisecond, time.Millisecond))
+	defer rs.Close()
+
+	p, err := ioutil.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("unexpected error reading content: %v", err)
+	}
+
+	if !bytes.Equal(p, content) {
+		t.Fatalf("resumed content does not match: %d != %d bytes", len(p), len(content))
+	}
+
+	if requests != 3 {
+		t.Fatalf("unexpected number of requests: %d", requests)
+	}
+
+	// Without resumption, the interrupted read fails.
+	atomic.StoreInt32(&requests, 0)
+	rs = NewHTTPReadSeeker(http.DefaultClient, server.URL, nil)
+	defer rs.Close()
+
+	if _, err := ioutil.ReadAll(rs); err == nil {
+		t.Fatalf("expected error reading interrupted content")
+	}
+}
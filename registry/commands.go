@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+// commandsCmd holds the commands run instead of the registry when named by
+// the first argument of Cmd. They are not subcommands of Cmd, as cobra would
+// then take the path of the configuration of the registry for an unknown
+// subcommand.
+var commandsCmd = &cobra.Command{
+	Use: "registry",
+}
+
+// runCommand runs the command named by the first of args, if any, and
+// returns whether it did.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if cmd, _, err := commandsCmd.Find(args); err != nil || cmd == commandsCmd {
+		return false
+	}
+	commandsCmd.SetArgs(args)
+	if err := commandsCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+	return true
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "config inspects registry configurations",
+	Long:  "config inspects registry configurations.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate <config>",
+	Short: "validate checks a configuration",
+	Long: "validate parses a configuration and checks the parameters of its storage\n" +
+		"driver against the parameters the driver accepts, which are printed along\n" +
+		"with any problem found.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := loadStoragePlugins(config); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			os.Exit(1)
+		}
+
+		name := config.Storage.Type()
+		if err := factory.Validate(name, config.Storage.Parameters()); err != nil {
+			errs, ok := err.(factory.ParameterErrors)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			}
+			fmt.Fprintln(os.Stderr)
+			printDriver(os.Stderr, name)
+			os.Exit(1)
+		}
+
+		fmt.Println("configuration is valid")
+	},
+}
+
+var driversCmd = &cobra.Command{
+	Use:   "drivers [driver...]",
+	Short: "drivers lists the storage drivers and their parameters",
+	Long: "drivers lists the storage drivers compiled into the registry, or those\n" +
+		"given, with the parameters they accept.",
+	Run: func(cmd *cobra.Command, args []string) {
+		names := args
+		if len(names) == 0 {
+			names = factory.Drivers()
+		}
+		for i, name := range names {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := printDriver(os.Stdout, name); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	commandsCmd.AddCommand(configCmd, driversCmd)
+}
+
+// printDriver prints the parameters accepted by the named storage driver.
+func printDriver(w io.Writer, name string) error {
+	parameters, described, err := factory.Parameters(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s:\n", name)
+	if !described {
+		fmt.Fprintln(w, "  parameters not described by the driver")
+		return nil
+	}
+	if len(parameters) == 0 {
+		fmt.Fprintln(w, "  no parameters")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION")
+	for _, p := range parameters {
+		required := "no"
+		if p.Required {
+			required = "yes"
+		}
+		def := p.Default
+		if def == "" {
+			def = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", p.Name, p.Type, required, def, p.Description)
+	}
+	return tw.Flush()
+}
+
+// loadStoragePlugins loads the storage driver plugins of the configuration,
+// so that the drivers they provide can be validated.
+func loadStoragePlugins(config *configuration.Configuration) error {
+	pc, ok := config.Storage["plugins"]
+	if !ok {
+		return nil
+	}
+	v, ok := pc["paths"]
+	if !ok {
+		return nil
+	}
+	paths, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("plugins paths config key must contain a list of paths")
+	}
+	for _, path := range paths {
+		if err := factory.LoadPlugin(fmt.Sprint(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
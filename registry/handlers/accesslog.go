@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/accesslog"
+	"github.com/docker/distribution/registry/auth"
+)
+
+// logBlobAccess writes the access record of the blob read served by the
+// request, once the response was written. Reads which failed are not
+// recorded.
+func (bh *blobHandler) logBlobAccess(r *http.Request, desc distribution.Descriptor) {
+	if bh.App.accessLog == nil || r.Method != "GET" {
+		return
+	}
+
+	status, _ := bh.Value("http.response.status").(int)
+	if status == 0 || status >= 400 {
+		return
+	}
+
+	written, _ := bh.Value("http.response.written").(int64)
+	record := accesslog.Record{
+		Time:       time.Now(),
+		RequestID:  ctxu.GetRequestID(bh),
+		Repository: bh.Repository.Named().Name(),
+		Digest:     desc.Digest,
+		Range:      r.Header.Get("Range"),
+		Bytes:      written,
+		Status:     status,
+		ClientAddr: ctxu.RemoteAddr(r),
+		UserAgent:  r.UserAgent(),
+		Subject:    ctxu.GetStringValue(bh, auth.UserNameKey),
+		Issuer:     ctxu.GetStringValue(bh, auth.UserIssuerKey),
+	}
+
+	// The content of a redirected read is served by the storage backend.
+	if status >= 300 && status < 400 && status != http.StatusNotModified {
+		record.Redirected = true
+		record.Bytes = rangeLength(record.Range, desc.Size)
+	}
+
+	if err := bh.App.accessLog.Write(record); err != nil {
+		ctxu.GetLogger(bh).Errorf("error writing blob access record: %v", err)
+	}
+}
+
+// rangeLength returns the number of bytes of a blob of the given size
+// requested by a Range header, or the size if the header does not request a
+// single satisfiable range.
+func rangeLength(header string, size int64) int64 {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return size
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(header[len("bytes="):]), "-", 2)
+	if len(parts) != 2 {
+		return size
+	}
+
+	if parts[0] == "" {
+		// A suffix range of the last n bytes.
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return size
+		}
+		if n > size {
+			return size
+		}
+		return n
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start >= size {
+		return size
+	}
+	end := size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return size
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return end - start + 1
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/accesslog"
+)
+
+// TestBlobAccessLog checks the records written for blob reads.
+func TestBlobAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.AccessLog.Enabled = true
+	config.AccessLog.Sinks = []configuration.AccessLogSink{{Type: "file", Path: path}}
+	env := newTestEnvWithConfig(t, &config)
+
+	name, _ := reference.ParseNamed("foo/bar")
+	content := []byte("some layer content")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env.builder, name)
+	blobURL := pushLayer(t, env.builder, name, dgst, uploadURLBase, bytes.NewReader(content))
+
+	resp, err := http.Get(blobURL)
+	checkErr(t, err, "fetching blob")
+	checkResponse(t, "fetching blob", resp, http.StatusOK)
+	resp.Body.Close()
+
+	req, err := http.NewRequest("GET", blobURL, nil)
+	checkErr(t, err, "building request")
+	req.Header.Set("Range", "bytes=5-9")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching blob range")
+	checkResponse(t, "fetching blob range", resp, http.StatusPartialContent)
+	resp.Body.Close()
+
+	// Neither HEAD requests nor failed reads are recorded.
+	resp, err = http.Head(blobURL)
+	checkErr(t, err, "checking blob")
+	resp.Body.Close()
+	unknownURL, err := env.builder.BuildBlobURL(mustCanonical(t, name, digest.FromBytes([]byte("unknown"))))
+	checkErr(t, err, "building blob url")
+	resp, err = http.Get(unknownURL)
+	checkErr(t, err, "fetching unknown blob")
+	checkResponse(t, "fetching unknown blob", resp, http.StatusNotFound)
+	resp.Body.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []accesslog.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record accesslog.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("error decoding record: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %#v", records)
+	}
+	for i, expected := range []struct {
+		status int
+		bytes  int64
+		rng    string
+	}{
+		{http.StatusOK, int64(len(content)), ""},
+		{http.StatusPartialContent, 5, "bytes=5-9"},
+	} {
+		record := records[i]
+		if record.Repository != "foo/bar" || record.Digest != dgst || record.Status != expected.status || record.Bytes != expected.bytes || record.Range != expected.rng || record.ClientAddr == "" || record.RequestID == "" {
+			t.Fatalf("unexpected record: %#v", record)
+		}
+	}
+}
+
+func TestRangeLength(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		expected int64
+	}{
+		{"", 100},
+		{"bytes=0-9", 10},
+		{"bytes=90-", 10},
+		{"bytes=-20", 20},
+		{"bytes=50-500", 50},
+		{"bytes=0-1,5-6", 100},
+		{"bytes=200-", 100},
+		{"items=0-1", 100},
+	} {
+		if n := rangeLength(tc.header, 100); n != tc.expected {
+			t.Errorf("range %q: expected %d, got %d", tc.header, tc.expected, n)
+		}
+	}
+}
+
+func mustCanonical(t *testing.T, name reference.Named, dgst digest.Digest) reference.Canonical {
+	ref, err := reference.WithDigest(name, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
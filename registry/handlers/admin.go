@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/gorilla/handlers"
+)
+
+// defaultEventHistory is the number of events retained for replay if not
+// configured.
+const defaultEventHistory = 1000
+
+// defaultJournalEntries is the number of journal entries returned by a
+// request which does not set it.
+const defaultJournalEntries = 100
+
+// registerAdmin registers the dispatchers of the admin API routes.
+func (app *App) registerAdmin() {
+	admin.AddRoutes(app.router, app.Config.HTTP.Prefix)
+
+	app.register(admin.RouteNameRepositories, catalogDispatcher)
+	app.register(admin.RouteNameTag, adminTagDispatcher)
+	app.register(admin.RouteNameGC, adminGCDispatcher)
+	app.register(admin.RouteNameGCPins, adminGCPinsDispatcher)
+	app.register(admin.RouteNameReadOnly, adminReadOnlyDispatcher)
+	app.register(admin.RouteNameEventsReplay, adminEventsReplayDispatcher)
+	app.register(admin.RouteNameEventsStream, adminEventsStreamDispatcher)
+	app.register(admin.RouteNameLayout, adminLayoutDispatcher)
+	app.register(admin.RouteNameJournal, adminJournalDispatcher)
+	app.register(admin.RouteNameJournalRecover, adminJournalRecoverDispatcher)
+	app.register(admin.RouteNameSnapshot, adminSnapshotDispatcher)
+	app.register(admin.RouteNameRestore, adminRestoreDispatcher)
+	app.register(admin.RouteNamePrewarm, adminPrewarmDispatcher)
+	app.register(admin.RouteNamePrewarmStatus, adminPrewarmStatusDispatcher)
+	app.register(admin.RouteNameUsage, adminUsageDispatcher)
+	app.register(admin.RouteNameUsers, adminUsersDispatcher)
+	app.register(admin.RouteNameUser, adminUserDispatcher)
+	app.register(admin.RouteNameJobs, adminJobsDispatcher)
+	app.register(admin.RouteNameJob, adminJobDispatcher)
+	app.register(admin.RouteNameLeader, adminLeaderDispatcher)
+
+	if app.accessController == nil {
+		if !app.Config.HTTP.Admin.Insecure {
+			panic("the admin API requires an access controller: configure auth, or set insecure to serve it unauthenticated")
+		}
+		ctxu.GetLogger(app).Warn("admin API enabled without an access controller, it is accessible to anyone")
+	}
+}
+
+// adminHandler handles requests to the admin API.
+type adminHandler struct {
+	*Context
+}
+
+func adminTagDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"DELETE": http.HandlerFunc(ah.DeleteTag),
+	}
+}
+
+// DeleteTag removes a tag from the repository. The tagged manifest remains
+// available by digest.
+func (ah *adminHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag := ctxu.GetStringValue(ah, "vars.tag")
+
+	err := ah.Repository.Tags(ah).Untag(ah, tag)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrTagUnknown, storagedriver.PathNotFoundError:
+			ah.Errors = append(ah.Errors, admin.ErrorCodeTagUnknown.WithDetail(map[string]string{"tag": tag}))
+		case distribution.ErrRepositoryUnknown:
+			ah.Errors = append(ah.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		case storage.LockTimeoutError:
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnavailable.WithDetail(err))
+		default:
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: removed tag %s:%s", ah.Repository.Named().Name(), tag)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func adminGCDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.GarbageCollect),
+	}
+}
+
+// GarbageCollect runs a mark and sweep of the blob store. Unless the request
+// is a dry run, the registry must be in read-only mode. The request body may
+// carry a bucket inventory listing the blobs to sweep. The number of workers,
+// the rate limit and whether to resume an interrupted run are set with query
+// parameters. With the async parameter, the collection runs as a job whose
+// status is returned.
+func (ah *adminHandler) GarbageCollect(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := q.Get("dryrun") == "true"
+	opts := storage.GCOpts{
+		DryRun: dryRun,
+		Resume: q.Get("resume") == "true",
+		Pins:   ah.gcPins,
+	}
+
+	if workers := q.Get("workers"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil || n < 1 {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid number of workers %q", workers)))
+			return
+		}
+		opts.Workers = n
+	}
+
+	if rateLimit := q.Get("ratelimit"); rateLimit != "" {
+		rate, err := strconv.ParseFloat(rateLimit, 64)
+		if err != nil || rate < 0 {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid rate limit %q", rateLimit)))
+			return
+		}
+		opts.RateLimit = rate
+	}
+
+	if ah.isCache {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("garbage collection is not supported by a pull through cache"))
+		return
+	}
+
+	if !dryRun && !ah.isReadOnly() {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeNotReadOnly)
+		return
+	}
+
+	// inventoryFile is the file the inventory of an asynchronous run is
+	// spooled to, which the job removes once done.
+	var inventoryFile *os.File
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var format storage.InventoryFormat
+
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case admin.MediaTypeInventoryCSV:
+			format = storage.InventoryFormatCSV
+		case admin.MediaTypeInventoryJSON:
+			format = storage.InventoryFormatJSON
+		default:
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("unsupported inventory media type %q", contentType)))
+			return
+		}
+
+		var body io.Reader = r.Body
+		if isAsync(r) {
+			// The job outlives the request, so the inventory is
+			// spooled to a file it reads instead of the request body.
+			f, err := spoolRequestBody(r)
+			if err != nil {
+				ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return
+			}
+			body, inventoryFile = f, f
+		}
+
+		inventory, err := storage.NewInventory(body, format)
+		if err != nil {
+			if inventoryFile != nil {
+				removeSpooled(inventoryFile)
+			}
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+			return
+		}
+		opts.Inventory = inventory
+	}
+
+	gc := func(ctx ctxu.Context, j *job) (interface{}, error) {
+		result, err := ah.App.garbageCollect(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if isAsync(r) {
+		ah.startJob(w, admin.JobTypeGC, "", func(ctx ctxu.Context, j *job) (interface{}, error) {
+			if inventoryFile != nil {
+				defer removeSpooled(inventoryFile)
+			}
+			return gc(ctx, j)
+		})
+		return
+	}
+
+	result, err := gc(ah, nil)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	ah.serveJSON(w, result)
+}
+
+// garbageCollect runs a mark and sweep of the blob store of the registry.
+func (app *App) garbageCollect(ctx ctxu.Context, opts storage.GCOpts) (admin.GCResult, error) {
+	result, err := storage.MarkAndSweep(ctx, app.driver, app.storageRegistry, opts)
+	if err != nil {
+		return admin.GCResult{}, err
+	}
+
+	ctxu.GetLogger(ctx).Infof("admin: garbage collection marked %d blobs, deleted %d (dry run: %t, inventory: %t)", result.Marked, len(result.Deleted), opts.DryRun, opts.Inventory != nil)
+
+	return admin.GCResult{
+		DryRun:  opts.DryRun,
+		Marked:  result.Marked,
+		Deleted: result.Deleted,
+	}, nil
+}
+
+func adminReadOnlyDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetReadOnly),
+		"PUT": http.HandlerFunc(ah.PutReadOnly),
+	}
+}
+
+// GetReadOnly returns whether the registry is in read-only mode.
+func (ah *adminHandler) GetReadOnly(w http.ResponseWriter, r *http.Request) {
+	ah.serveJSON(w, admin.ReadOnlyStatus{Enabled: ah.isReadOnly()})
+}
+
+// PutReadOnly enables or disables read-only mode. The setting is not
+// persisted and reverts to the configured value on restart.
+func (ah *adminHandler) PutReadOnly(w http.ResponseWriter, r *http.Request) {
+	var status admin.ReadOnlyStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+
+	ah.setReadOnly(status.Enabled)
+	ctxu.GetLogger(ah).Infof("admin: read-only mode set to %t", status.Enabled)
+
+	ah.serveJSON(w, status)
+}
+
+func adminEventsReplayDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.ReplayEvents),
+	}
+}
+
+// ReplayEvents sends the retained events with a timestamp after the "since"
+// parameter to the notification endpoints again. Without the parameter, all
+// retained events are replayed.
+func (ah *adminHandler) ReplayEvents(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	events := ah.events.history.Since(since)
+	if len(events) > 0 {
+		if err := ah.events.replay.Write(events...); err != nil {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: replayed %d events since %v", len(events), since)
+
+	ah.serveJSON(w, admin.ReplayResult{
+		Since:    since,
+		Replayed: len(events),
+	})
+}
+
+func adminLayoutDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.MigrateLayout),
+	}
+}
+
+// MigrateLayout moves the blobs of the blob store to a layout version, the
+// configured one unless set by the "version" parameter. The registry keeps
+// serving during the migration, provided it reads the layouts migrated from.
+// With the async parameter, the migration runs as a job whose status is
+// returned.
+func (ah *adminHandler) MigrateLayout(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := q.Get("dryrun") == "true"
+
+	version := ah.blobPathLayout
+	if v := q.Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > storage.MaxBlobPathLayout {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid layout version %q", v)))
+			return
+		}
+		version = n
+	}
+
+	if ah.isCache {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("layout migration is not supported by a pull through cache"))
+		return
+	}
+
+	migrate := func(ctx ctxu.Context, j *job) (interface{}, error) {
+		result, err := storage.MigrateBlobPathLayout(ctx, ah.driver, version, dryRun)
+		if err != nil {
+			return nil, err
+		}
+
+		ctxu.GetLogger(ctx).Infof("admin: layout migration to version %d moved %d blobs, skipped %d (dry run: %t)", version, result.Migrated, result.Skipped, dryRun)
+
+		return admin.LayoutMigrationResult{
+			DryRun:   dryRun,
+			Version:  version,
+			Migrated: result.Migrated,
+			Skipped:  result.Skipped,
+		}, nil
+	}
+
+	if isAsync(r) {
+		ah.startJob(w, admin.JobTypeLayoutMigration, "", migrate)
+		return
+	}
+
+	result, err := migrate(ah, nil)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	ah.serveJSON(w, result)
+}
+
+func adminJournalDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetJournal),
+	}
+}
+
+// GetJournal returns the journal entries written after the "since" time and,
+// among the entries written at that time, after the "last" entry id. At most
+// "n" entries are returned, 100 by default.
+func (ah *adminHandler) GetJournal(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	limit := defaultJournalEntries
+	if n := q.Get("n"); n != "" {
+		var err error
+		limit, err = strconv.Atoi(n)
+		if err != nil || limit < 1 {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid number of entries %q", n)))
+			return
+		}
+	}
+
+	entries, err := storage.ReadJournal(ah, ah.driver, since, q.Get("last"), limit)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	result := admin.JournalEntries{Entries: make([]admin.JournalEntry, 0, len(entries))}
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, admin.JournalEntry(entry))
+	}
+	ah.serveJSON(w, result)
+}
+
+func adminJournalRecoverDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.RecoverJournal),
+	}
+}
+
+// RecoverJournal applies the mutations recorded in the journal after the
+// "since" time which are missing from the storage backend.
+func (ah *adminHandler) RecoverJournal(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	applied, err := storage.RecoverJournal(ah, ah.driver, since)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: applied %d journal entries since %v", applied, since)
+
+	ah.serveJSON(w, admin.JournalRecoveryResult{
+		Since:   since,
+		Applied: applied,
+	})
+}
+
+func adminSnapshotDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetSnapshot),
+	}
+}
+
+// GetSnapshot returns the tags of the repository as they were at the time
+// given by the "at" parameter, reconstructed from the journal. Without the
+// parameter, the current tags are returned.
+func (ah *adminHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	at := time.Now().UTC()
+	if s := r.URL.Query().Get("at"); s != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	snapshot, err := storage.SnapshotRepository(ah, ah.driverFor(ah.Repository.Named().Name()), ah.Repository, at)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ah.serveJSON(w, admin.RepositorySnapshot{
+		Name:    ah.Repository.Named().Name(),
+		Time:    at,
+		Tags:    snapshot.Tags,
+		Unknown: snapshot.Unknown,
+	})
+}
+
+func adminRestoreDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.Restore),
+	}
+}
+
+// Restore points the tags of the repository back at the manifests recorded
+// in the snapshot sent as the request body, and removes the tags the snapshot
+// does not record.
+func (ah *adminHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dryrun") == "true"
+
+	var snapshot admin.RepositorySnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+
+	name := ah.Repository.Named().Name()
+	if snapshot.Name != "" && snapshot.Name != name {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("snapshot of %q cannot restore %q", snapshot.Name, name)))
+		return
+	}
+
+	if !dryRun && ah.isReadOnly() {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("the registry is in read-only mode"))
+		return
+	}
+
+	result, err := storage.RestoreRepository(ah, ah.Repository, snapshot.Tags, snapshot.Unknown, dryRun)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: restored %s to snapshot of %v: %d tagged, %d untagged, %d missing (dry run: %t)", name, snapshot.Time, len(result.Tagged), len(result.Untagged), len(result.Missing), dryRun)
+
+	ah.serveJSON(w, admin.RestoreResult{
+		DryRun:   dryRun,
+		Tagged:   result.Tagged,
+		Untagged: result.Untagged,
+		Missing:  result.Missing,
+	})
+}
+
+func (ah *adminHandler) serveJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
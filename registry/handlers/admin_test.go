@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestAdminAPI exercises the admin API: listing repositories, garbage
+// collection guarded by read-only mode, tag removal and event replay.
+func TestAdminAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	if err != nil {
+		t.Fatalf("error creating admin url builder: %v", err)
+	}
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	// Push a layer which no manifest references.
+	orphanFile, orphanDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, orphanDigest, uploadURLBase, orphanFile)
+
+	// repo ls
+	repositoriesURL, err := ub.BuildRepositoriesURL()
+	checkErr(t, err, "building repositories url")
+
+	resp, err := http.Get(repositoriesURL)
+	checkErr(t, err, "listing repositories")
+	checkResponse(t, "listing repositories", resp, http.StatusOK)
+
+	var repositories admin.RepositoryList
+	decodeAdminResponse(t, resp, &repositories)
+	if len(repositories.Repositories) != 1 || repositories.Repositories[0] != imageName.Name() {
+		t.Fatalf("unexpected repositories: %v", repositories.Repositories)
+	}
+
+	// gc run requires read-only mode
+	gcURL, err := ub.BuildGCURL()
+	checkErr(t, err, "building gc url")
+
+	resp, err = http.Post(gcURL, "", nil)
+	checkErr(t, err, "running gc")
+	checkResponse(t, "running gc while writable", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "running gc while writable", resp, admin.ErrorCodeNotReadOnly)
+
+	dryRunURL, err := ub.BuildGCURL(url.Values{"dryrun": {"true"}})
+	checkErr(t, err, "building gc url")
+
+	resp, err = http.Post(dryRunURL, "", nil)
+	checkErr(t, err, "running gc dry run")
+	checkResponse(t, "running gc dry run", resp, http.StatusOK)
+
+	var gcResult admin.GCResult
+	decodeAdminResponse(t, resp, &gcResult)
+	if !gcResult.DryRun || len(gcResult.Deleted) != 1 || gcResult.Deleted[0] != orphanDigest {
+		t.Fatalf("unexpected dry run result: %#v", gcResult)
+	}
+
+	parallelURL, err := ub.BuildGCURL(url.Values{"dryrun": {"true"}, "workers": {"4"}, "ratelimit": {"100"}})
+	checkErr(t, err, "building gc url")
+
+	resp, err = http.Post(parallelURL, "", nil)
+	checkErr(t, err, "running parallel gc dry run")
+	checkResponse(t, "running parallel gc dry run", resp, http.StatusOK)
+
+	decodeAdminResponse(t, resp, &gcResult)
+	if !gcResult.DryRun || len(gcResult.Deleted) != 1 || gcResult.Deleted[0] != orphanDigest {
+		t.Fatalf("unexpected parallel dry run result: %#v", gcResult)
+	}
+
+	invalidURL, err := ub.BuildGCURL(url.Values{"dryrun": {"true"}, "workers": {"0"}})
+	checkErr(t, err, "building gc url")
+
+	resp, err = http.Post(invalidURL, "", nil)
+	checkErr(t, err, "running gc without workers")
+	checkResponse(t, "running gc without workers", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "running gc without workers", resp, admin.ErrorCodeRequestInvalid)
+
+	// usage
+	usageURL, err := ub.BuildUsageURL()
+	checkErr(t, err, "building usage url")
+
+	resp, err = http.Get(usageURL)
+	checkErr(t, err, "getting usage")
+	checkResponse(t, "getting usage before a report", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting usage before a report", resp, admin.ErrorCodeUsageUnknown)
+
+	resp, err = http.Post(usageURL, "", nil)
+	checkErr(t, err, "computing usage")
+	checkResponse(t, "computing usage", resp, http.StatusOK)
+
+	var usage admin.UsageReport
+	decodeAdminResponse(t, resp, &usage)
+	if usage.Blobs == 0 || usage.Bytes == 0 || usage.SharedBytes != 0 || len(usage.Repositories) != 1 {
+		t.Fatalf("unexpected usage report: %#v", usage)
+	}
+	if repo := usage.Repositories[0]; repo.Name != imageName.Name() || repo.Bytes != usage.Bytes || repo.UniqueBytes != usage.Bytes {
+		t.Fatalf("unexpected repository usage: %#v", repo)
+	}
+
+	resp, err = http.Get(usageURL)
+	checkErr(t, err, "getting usage")
+	checkResponse(t, "getting usage", resp, http.StatusOK)
+
+	var saved admin.UsageReport
+	decodeAdminResponse(t, resp, &saved)
+	if !saved.Computed.Equal(usage.Computed) || saved.Bytes != usage.Bytes {
+		t.Fatalf("unexpected saved usage report: %#v", saved)
+	}
+
+	// readonly on
+	readOnlyURL, err := ub.BuildReadOnlyURL()
+	checkErr(t, err, "building readonly url")
+
+	req, err := http.NewRequest("PUT", readOnlyURL, strings.NewReader(`{"enabled": true}`))
+	checkErr(t, err, "building readonly request")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "enabling read-only mode")
+	checkResponse(t, "enabling read-only mode", resp, http.StatusOK)
+
+	resp, err = http.Get(readOnlyURL)
+	checkErr(t, err, "getting read-only mode")
+	checkResponse(t, "getting read-only mode", resp, http.StatusOK)
+
+	var status admin.ReadOnlyStatus
+	decodeAdminResponse(t, resp, &status)
+	if !status.Enabled {
+		t.Fatalf("expected read-only mode to be enabled")
+	}
+
+	resp, err = http.Post(gcURL, "", nil)
+	checkErr(t, err, "running gc")
+	checkResponse(t, "running gc", resp, http.StatusOK)
+
+	decodeAdminResponse(t, resp, &gcResult)
+	if gcResult.DryRun || len(gcResult.Deleted) != 1 || gcResult.Deleted[0] != orphanDigest {
+		t.Fatalf("unexpected gc result: %#v", gcResult)
+	}
+
+	orphanRef, _ := reference.WithDigest(imageName, orphanDigest)
+	orphanURL, err := env.builder.BuildBlobURL(orphanRef)
+	checkErr(t, err, "building blob url")
+
+	resp, err = http.Head(orphanURL)
+	checkErr(t, err, "checking collected blob")
+	checkResponse(t, "checking collected blob", resp, http.StatusNotFound)
+
+	// tag rm
+	tagURL, err := ub.BuildTagURL(imageName, "latest")
+	checkErr(t, err, "building tag url")
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "removing tag")
+	checkResponse(t, "removing tag", resp, http.StatusAccepted)
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "removing unknown tag")
+	checkResponse(t, "removing unknown tag", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "removing unknown tag", resp, admin.ErrorCodeTagUnknown)
+
+	// events replay
+	replayURL, err := ub.BuildEventsReplayURL()
+	checkErr(t, err, "building replay url")
+
+	resp, err = http.Post(replayURL, "", nil)
+	checkErr(t, err, "replaying events")
+	checkResponse(t, "replaying events", resp, http.StatusOK)
+
+	var replay admin.ReplayResult
+	decodeAdminResponse(t, resp, &replay)
+	if replay.Replayed == 0 {
+		t.Fatalf("expected retained events to be replayed")
+	}
+
+	invalidReplayURL, err := ub.BuildEventsReplayURL(url.Values{"since": {"yesterday"}})
+	checkErr(t, err, "building replay url")
+
+	resp, err = http.Post(invalidReplayURL, "", nil)
+	checkErr(t, err, "replaying events")
+	checkResponse(t, "replaying events with invalid time", resp, http.StatusBadRequest)
+
+	// prewarm is only supported by a pull through cache
+	prewarmURL, err := ub.BuildPrewarmURL(imageName)
+	checkErr(t, err, "building prewarm url")
+
+	resp, err = http.Post(prewarmURL, "application/json", strings.NewReader(`{"references":["latest"]}`))
+	checkErr(t, err, "prewarming")
+	checkResponse(t, "prewarming without a cache", resp, http.StatusMethodNotAllowed)
+
+	prewarmStatusURL, err := ub.BuildPrewarmStatusURL("unknown")
+	checkErr(t, err, "building prewarm status url")
+
+	resp, err = http.Get(prewarmStatusURL)
+	checkErr(t, err, "polling prewarm status")
+	checkResponse(t, "polling unknown prewarm job", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "polling unknown prewarm job", resp, admin.ErrorCodePrewarmUnknown)
+}
+
+// TestAdminSnapshotRestore checks that the tags of a repository are restored
+// through the admin API to a snapshot taken before they were removed.
+func TestAdminSnapshotRestore(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"journal":  configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	if err != nil {
+		t.Fatalf("error creating admin url builder: %v", err)
+	}
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	dgst := createRepository(env, t, imageName.Name(), "latest")
+	at := time.Now().UTC()
+
+	tagURL, err := ub.BuildTagURL(imageName, "latest")
+	checkErr(t, err, "building tag url")
+	resp, err := httpDelete(tagURL)
+	checkErr(t, err, "removing tag")
+	checkResponse(t, "removing tag", resp, http.StatusAccepted)
+
+	snapshotURL, err := ub.BuildSnapshotURL(imageName, url.Values{"at": {at.Format(time.RFC3339Nano)}})
+	checkErr(t, err, "building snapshot url")
+	resp, err = http.Get(snapshotURL)
+	checkErr(t, err, "getting snapshot")
+	checkResponse(t, "getting snapshot", resp, http.StatusOK)
+
+	var snapshot admin.RepositorySnapshot
+	decodeAdminResponse(t, resp, &snapshot)
+	if snapshot.Name != imageName.Name() || len(snapshot.Tags) != 1 || snapshot.Tags["latest"] != dgst {
+		t.Fatalf("unexpected snapshot: %#v", snapshot)
+	}
+
+	body, err := json.Marshal(snapshot)
+	checkErr(t, err, "encoding snapshot")
+	restoreURL, err := ub.BuildRestoreURL(imageName)
+	checkErr(t, err, "building restore url")
+	resp, err = http.Post(restoreURL, "application/json", bytes.NewReader(body))
+	checkErr(t, err, "restoring snapshot")
+	checkResponse(t, "restoring snapshot", resp, http.StatusOK)
+
+	var result admin.RestoreResult
+	decodeAdminResponse(t, resp, &result)
+	if result.DryRun || len(result.Tagged) != 1 || result.Tagged[0] != "latest" {
+		t.Fatalf("unexpected restore result: %#v", result)
+	}
+
+	ref, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Head(manifestURL)
+	checkErr(t, err, "checking restored tag")
+	checkResponse(t, "checking restored tag", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{"Docker-Content-Digest": []string{dgst.String()}})
+}
+
+// TestAdminPrewarm checks that a pull through cache prewarmed through the
+// admin API fetches the manifest of a tag and its blobs from the remote.
+func TestAdminPrewarm(t *testing.T) {
+	remoteConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	remoteConfig.HTTP.Headers = headerConfig
+	remoteEnv := newTestEnvWithConfig(t, &remoteConfig)
+	defer remoteEnv.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	createRepository(remoteEnv, t, imageName.Name(), "latest")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Proxy: configuration.Proxy{
+			RemoteURL: remoteEnv.server.URL,
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	if err != nil {
+		t.Fatalf("error creating admin url builder: %v", err)
+	}
+
+	prewarmURL, err := ub.BuildPrewarmURL(imageName)
+	checkErr(t, err, "building prewarm url")
+	resp, err := http.Post(prewarmURL, "application/json", strings.NewReader(`{"references":["latest"]}`))
+	checkErr(t, err, "prewarming")
+	checkResponse(t, "prewarming", resp, http.StatusAccepted)
+
+	var status admin.PrewarmStatus
+	decodeAdminResponse(t, resp, &status)
+	if status.ID == "" || status.Name != imageName.Name() {
+		t.Fatalf("unexpected prewarm status: %#v", status)
+	}
+
+	statusURL, err := ub.BuildPrewarmStatusURL(status.ID)
+	checkErr(t, err, "building prewarm status url")
+	deadline := time.Now().Add(10 * time.Second)
+	for status.State == admin.PrewarmStateRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("prewarm did not complete: %#v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err = http.Get(statusURL)
+		checkErr(t, err, "polling prewarm status")
+		checkResponse(t, "polling prewarm status", resp, http.StatusOK)
+		decodeAdminResponse(t, resp, &status)
+	}
+	if status.State != admin.PrewarmStateCompleted || status.Blobs == 0 || status.Completed != status.Blobs || status.Fetched != status.Blobs {
+		t.Fatalf("unexpected prewarm status: %#v", status)
+	}
+}
+
+func TestAdminAPIDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	if err != nil {
+		t.Fatalf("error creating admin url builder: %v", err)
+	}
+
+	readOnlyURL, err := ub.BuildReadOnlyURL()
+	checkErr(t, err, "building readonly url")
+
+	resp, err := http.Get(readOnlyURL)
+	checkErr(t, err, "getting read-only mode")
+	checkResponse(t, "getting read-only mode with admin API disabled", resp, http.StatusNotFound)
+}
+
+// TestAdminAPIAuthorization checks that the admin API is not served without
+// an access controller unless insecure is set, and that requests without
+// credentials are rejected.
+func TestAdminAPIAuthorization(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Admin.Enabled = true
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the admin API not to be served without an access controller")
+			}
+		}()
+		NewApp(context.Background(), &config)
+	}()
+
+	config.Auth = configuration.Auth{
+		"silly": {
+			"realm":   "realm-test",
+			"service": "service-test",
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+	readOnlyURL, err := ub.BuildReadOnlyURL()
+	checkErr(t, err, "building readonly url")
+	gcURL, err := ub.BuildGCURL()
+	checkErr(t, err, "building gc url")
+
+	resp, err := http.Get(readOnlyURL)
+	checkErr(t, err, "getting read-only mode")
+	resp.Body.Close()
+	checkResponse(t, "getting read-only mode without credentials", resp, http.StatusUnauthorized)
+
+	resp, err = http.Post(gcURL, "", nil)
+	checkErr(t, err, "running gc")
+	resp.Body.Close()
+	checkResponse(t, "running gc without credentials", resp, http.StatusUnauthorized)
+}
+
+func decodeAdminResponse(t *testing.T, resp *http.Response, v interface{}) {
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("error decoding admin response: %v", err)
+	}
+}
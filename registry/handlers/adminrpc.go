@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin/adminrpc"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// ListenAndServeAdminRPC serves the gRPC admin service on the address of the
+// grpc admin section until it fails. It returns nil at once if the service is
+// not configured.
+func (app *App) ListenAndServeAdminRPC() error {
+	config := app.Config.HTTP.Admin.GRPC
+	if config.Addr == "" {
+		return nil
+	}
+
+	server, err := app.newAdminRPCServer()
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return err
+	}
+	ctxu.GetLogger(app).Infof("admin gRPC service listening on %v, tls", ln.Addr())
+
+	return server.Serve(ln)
+}
+
+// newAdminRPCServer returns a gRPC server serving the admin service with
+// mutual TLS, as configured by the grpc admin section. Only clients presenting
+// a certificate signed by one of the client CAs are served, since the service
+// does not check the access of calls otherwise.
+func (app *App) newAdminRPCServer() (*grpc.Server, error) {
+	config := app.Config.HTTP.Admin.GRPC.TLS
+	if config.Certificate == "" || config.Key == "" || len(config.ClientCAs) == 0 {
+		return nil, fmt.Errorf("the admin gRPC service requires a certificate, a key and client CAs")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.Certificate, config.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, ca := range config.ClientCAs {
+		caPem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		if ok := pool.AppendCertsFromPEM(caPem); !ok {
+			return nil, fmt.Errorf("could not add CA %s to pool", ca)
+		}
+	}
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	})))
+	adminrpc.RegisterRegistryAdminServer(server, &adminRPCServer{app: app})
+	return server, nil
+}
+
+// adminRPCServer implements the gRPC admin service on top of the registry
+// application, with the logic of the admin API.
+type adminRPCServer struct {
+	app *App
+}
+
+var _ adminrpc.RegistryAdminServer = &adminRPCServer{}
+
+// context returns the context of a call, logging with the logger of the
+// registry.
+func (s *adminRPCServer) context(ctx netcontext.Context, method string) ctxu.Context {
+	return ctxu.WithLogger(ctx, ctxu.GetLoggerWithField(s.app, "rpc.method", method))
+}
+
+func (s *adminRPCServer) GarbageCollect(ctx netcontext.Context, req *adminrpc.GarbageCollectRequest) (*adminrpc.GarbageCollectResponse, error) {
+	if req.Workers < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid number of workers %d", req.Workers)
+	}
+	if req.RateLimit < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid rate limit %g", req.RateLimit)
+	}
+	if s.app.isCache {
+		return nil, grpc.Errorf(codes.Unimplemented, "garbage collection is not supported by a pull through cache")
+	}
+	if !req.DryRun && !s.app.isReadOnly() {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "the registry must be in read-only mode")
+	}
+
+	result, err := s.app.garbageCollect(s.context(ctx, "GarbageCollect"), storage.GCOpts{
+		DryRun:    req.DryRun,
+		Workers:   int(req.Workers),
+		RateLimit: req.RateLimit,
+		Resume:    req.Resume,
+		Pins:      s.app.gcPins,
+	})
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+
+	response := &adminrpc.GarbageCollectResponse{
+		DryRun:  result.DryRun,
+		Marked:  int64(result.Marked),
+		Deleted: make([]string, 0, len(result.Deleted)),
+	}
+	for _, dgst := range result.Deleted {
+		response.Deleted = append(response.Deleted, dgst.String())
+	}
+	return response, nil
+}
+
+func (s *adminRPCServer) GetReadOnly(ctx netcontext.Context, req *adminrpc.Empty) (*adminrpc.ReadOnlyStatus, error) {
+	return &adminrpc.ReadOnlyStatus{Enabled: s.app.isReadOnly()}, nil
+}
+
+func (s *adminRPCServer) SetReadOnly(ctx netcontext.Context, req *adminrpc.ReadOnlyStatus) (*adminrpc.ReadOnlyStatus, error) {
+	s.app.setReadOnly(req.Enabled)
+	ctxu.GetLogger(s.context(ctx, "SetReadOnly")).Infof("admin: read-only mode set to %t", req.Enabled)
+
+	return &adminrpc.ReadOnlyStatus{Enabled: req.Enabled}, nil
+}
+
+func (s *adminRPCServer) DeleteRepository(ctx netcontext.Context, req *adminrpc.DeleteRepositoryRequest) (*adminrpc.RepositoryDeletion, error) {
+	if !s.app.repositoryDeletionEnabled || s.app.isCache {
+		return nil, grpc.Errorf(codes.Unimplemented, "repository deletion is not enabled")
+	}
+
+	name, err := reference.ParseNamed(req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid repository name %q: %v", req.Name, err)
+	}
+
+	// The deletion outlives the call, so it is bound to the context of the
+	// registry. Its events are notified without an actor, as for
+	// maintenance jobs.
+	detached := ctxu.WithLogger(s.app, ctxu.GetLogger(s.context(ctx, "DeleteRepository")))
+	j, err := s.app.startRepositoryDeletion(detached, name, s.app.maintenanceBridge())
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			return nil, grpc.Errorf(codes.NotFound, "%v", err)
+		}
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	return rpcRepositoryDeletion(j), nil
+}
+
+func (s *adminRPCServer) GetRepositoryDeletion(ctx netcontext.Context, req *adminrpc.RepositoryDeletionRequest) (*adminrpc.RepositoryDeletion, error) {
+	j, ok := s.app.repositoryDeletion(req.Name, req.Id)
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "unknown deletion %q of repository %q", req.Id, req.Name)
+	}
+	return rpcRepositoryDeletion(j), nil
+}
+
+func (s *adminRPCServer) GetStats(ctx netcontext.Context, req *adminrpc.Empty) (*adminrpc.Stats, error) {
+	report, err := storage.LoadUsageReport(s.context(ctx, "GetStats"), s.app.driver)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, grpc.Errorf(codes.NotFound, "no usage report was computed")
+		}
+		return nil, grpc.Errorf(codes.Unknown, "%v", err)
+	}
+	updateUsageMetrics(report)
+
+	stats := &adminrpc.Stats{
+		Computed:     report.Computed.UnixNano(),
+		Duration:     int64(report.Duration),
+		Blobs:        int64(report.Blobs),
+		Bytes:        report.Bytes,
+		SharedBytes:  report.SharedBytes,
+		Repositories: make([]*adminrpc.RepositoryStats, 0, len(report.Repositories)),
+	}
+	for _, usage := range report.Repositories {
+		stats.Repositories = append(stats.Repositories, &adminrpc.RepositoryStats{
+			Name:        usage.Name,
+			Blobs:       int64(usage.Blobs),
+			Bytes:       usage.Bytes,
+			UniqueBytes: usage.UniqueBytes,
+			SharedBytes: usage.SharedBytes,
+		})
+	}
+	return stats, nil
+}
+
+// rpcRepositoryDeletion returns the status of the deletion run by a
+// repository deletion job, as returned by the gRPC admin service.
+func rpcRepositoryDeletion(j *job) *adminrpc.RepositoryDeletion {
+	status := repositoryDeletionStatus(j)
+	deletion := &adminrpc.RepositoryDeletion{
+		Id:        status.ID,
+		Name:      status.Name,
+		State:     status.State,
+		Tags:      int64(status.Tags),
+		Manifests: int64(status.Manifests),
+		Error:     status.Error,
+		Started:   status.Started.UnixNano(),
+	}
+	if status.Finished != nil {
+		deletion.Finished = status.Finished.UnixNano()
+	}
+	return deletion
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin/adminrpc"
+	"github.com/docker/distribution/registry/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// testCertificate is a certificate issued for the tests, with its key.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// issueTestCertificate returns a certificate signed by parent, or
+// self-signed if parent is nil.
+func issueTestCertificate(t *testing.T, parent *testCertificate, serial int64, name string) *testCertificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+// write writes the certificate and its key to PEM files of dir.
+func (c *testCertificate) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(c.key)})
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatalf("error writing certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// TestAdminRPC exercises the gRPC admin service over mutual TLS: clients
+// without a certificate signed by the client CA are rejected, and the
+// operations share the logic and state of the admin API.
+func TestAdminRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adminrpc")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issueTestCertificate(t, nil, 1, "ca")
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := issueTestCertificate(t, ca, 2, "registry").write(t, dir, "registry")
+	trusted := issueTestCertificate(t, ca, 3, "client")
+	stranger := issueTestCertificate(t, nil, 4, "stranger")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true, "repositories": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.GRPC.TLS.Certificate = serverCert
+	config.HTTP.Admin.GRPC.TLS.Key = serverKey
+	config.HTTP.Admin.GRPC.TLS.ClientCAs = []string{caFile}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	server, err := env.app.newAdminRPCServer()
+	if err != nil {
+		t.Fatalf("error creating admin gRPC server: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(cert *testCertificate) (adminrpc.RegistryAdminClient, *grpc.ClientConn) {
+		tlsConfig := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{cert.tlsCertificate()}
+		}
+		conn, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), grpc.WithTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("error dialing admin gRPC service: %v", err)
+		}
+		return adminrpc.NewRegistryAdminClient(conn), conn
+	}
+	ctx := context.Background()
+
+	// The client retries the rejected handshakes until the call times out.
+	for _, cert := range []*testCertificate{nil, stranger} {
+		client, conn := dial(cert)
+		callCtx, cancel := context.WithTimeout(ctx, time.Second)
+		_, err := client.GetReadOnly(callCtx, &adminrpc.Empty{})
+		cancel()
+		conn.Close()
+		if err == nil {
+			t.Fatalf("call without a certificate signed by the client CA succeeded")
+		}
+	}
+
+	adminClient, conn := dial(trusted)
+	defer conn.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	createRepository(env, t, name.Name(), "latest")
+
+	// gc requires read-only mode, toggled through the service
+	if _, err := adminClient.GarbageCollect(ctx, &adminrpc.GarbageCollectRequest{}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("unexpected error running gc while writable: %v", err)
+	}
+
+	gcResult, err := adminClient.GarbageCollect(ctx, &adminrpc.GarbageCollectRequest{DryRun: true})
+	if err != nil {
+		t.Fatalf("error running gc dry run: %v", err)
+	}
+	if !gcResult.DryRun || gcResult.Marked == 0 || len(gcResult.Deleted) != 0 {
+		t.Fatalf("unexpected dry run result: %v", gcResult)
+	}
+
+	status, err := adminClient.SetReadOnly(ctx, &adminrpc.ReadOnlyStatus{Enabled: true})
+	if err != nil || !status.Enabled {
+		t.Fatalf("error enabling read-only mode: %v, %v", status, err)
+	}
+	if !env.app.isReadOnly() {
+		t.Fatalf("read-only mode not enabled")
+	}
+	if status, err := adminClient.GetReadOnly(ctx, &adminrpc.Empty{}); err != nil || !status.Enabled {
+		t.Fatalf("unexpected read-only status: %v, %v", status, err)
+	}
+
+	if _, err := adminClient.GarbageCollect(ctx, &adminrpc.GarbageCollectRequest{Workers: 2}); err != nil {
+		t.Fatalf("error running gc: %v", err)
+	}
+	if _, err := adminClient.SetReadOnly(ctx, &adminrpc.ReadOnlyStatus{Enabled: false}); err != nil {
+		t.Fatalf("error disabling read-only mode: %v", err)
+	}
+
+	// stats are read from the last usage report
+	if _, err := adminClient.GetStats(ctx, &adminrpc.Empty{}); grpc.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error getting stats before any usage report: %v", err)
+	}
+	if _, err := env.app.computeUsageReport(env.app, storage.UsageOpts{}); err != nil {
+		t.Fatalf("error computing usage report: %v", err)
+	}
+	stats, err := adminClient.GetStats(ctx, &adminrpc.Empty{})
+	if err != nil {
+		t.Fatalf("error getting stats: %v", err)
+	}
+	if stats.Blobs == 0 || len(stats.Repositories) != 1 || stats.Repositories[0].Name != name.Name() {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+
+	// repository deletion
+	if _, err := adminClient.DeleteRepository(ctx, &adminrpc.DeleteRepositoryRequest{Name: "foo/missing"}); grpc.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error deleting missing repository: %v", err)
+	}
+	if _, err := adminClient.DeleteRepository(ctx, &adminrpc.DeleteRepositoryRequest{Name: "Foo"}); grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unexpected error deleting invalid repository: %v", err)
+	}
+
+	deletion, err := adminClient.DeleteRepository(ctx, &adminrpc.DeleteRepositoryRequest{Name: name.Name()})
+	if err != nil {
+		t.Fatalf("error deleting repository: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for deletion.State == RepositoryDeletionRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("repository deletion did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		deletion, err = adminClient.GetRepositoryDeletion(ctx, &adminrpc.RepositoryDeletionRequest{Name: name.Name(), Id: deletion.Id})
+		if err != nil {
+			t.Fatalf("error polling repository deletion: %v", err)
+		}
+	}
+	if deletion.State != RepositoryDeletionCompleted || deletion.Tags != 1 || deletion.Manifests != 1 || deletion.Finished == 0 {
+		t.Fatalf("unexpected deletion status: %v", deletion)
+	}
+
+	if _, err := adminClient.GetRepositoryDeletion(ctx, &adminrpc.RepositoryDeletionRequest{Name: "foo/missing", Id: deletion.Id}); grpc.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error getting deletion of another repository: %v", err)
+	}
+}
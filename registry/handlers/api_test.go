@@ -16,7 +16,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
@@ -29,6 +31,7 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/docker/libtrust"
@@ -71,6 +74,48 @@ func TestCheckAPI(t *testing.T) {
 	}
 }
 
+// TestExtensionsAPI tests the /v2/_extensions endpoint lists the enabled
+// extensions.
+func TestExtensionsAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Trust.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+
+	extensionsURL, err := env.builder.BuildExtensionsURL()
+	if err != nil {
+		t.Fatalf("unexpected error building extensions url: %v", err)
+	}
+
+	resp, err := http.Get(extensionsURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "listing extensions", resp, http.StatusOK)
+
+	var body extensionsAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error decoding extensions: %v", err)
+	}
+
+	var names []string
+	for _, extension := range body.Extensions {
+		names = append(names, extension.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"blob-toc", "manifest-compare", "manifest-graph", "repository-checksum", "sbom", "trust"}) {
+		t.Fatalf("unexpected extensions: %v", names)
+	}
+	if endpoints := body.Extensions[5].Endpoints; len(endpoints) != 1 || endpoints[0] != "/v2/<name>/_trust/tuf/<role>.json" {
+		t.Fatalf("unexpected trust endpoints: %v", endpoints)
+	}
+}
+
 // TestCatalogAPI tests the /v2/_catalog endpoint
 func TestCatalogAPI(t *testing.T) {
 	chunkLen := 2
@@ -610,6 +655,85 @@ func testBlobDelete(t *testing.T, env *testEnv, args blobArgs) {
 	})
 }
 
+// TestBlobUploadSessionExpired checks that an upload session which outlived
+// its deadline is refused and its staged data removed.
+func TestBlobUploadSessionExpired(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UploadSessionTTL = 50 * time.Millisecond
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, _, err := doPushChunk(t, uploadURLBase, bytes.NewReader([]byte("chunk")))
+	checkErr(t, err, "pushing chunk to expired upload")
+	defer resp.Body.Close()
+	checkResponse(t, "pushing chunk to expired upload", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "pushing chunk to expired upload", resp, v2.ErrorCodeSessionExpired)
+
+	// The staged data is removed in the background, after which the upload
+	// is unknown.
+	for i := 0; ; i++ {
+		resp, err = http.Get(uploadURLBase)
+		checkErr(t, err, "getting status of expired upload")
+
+		var errs errcode.Errors
+		json.NewDecoder(resp.Body).Decode(&errs)
+		resp.Body.Close()
+
+		if len(errs) == 1 && errs[0].(errcode.Error).Code == v2.ErrorCodeBlobUploadUnknown {
+			break
+		}
+
+		if i == 50 {
+			t.Fatalf("expired upload was not removed: %v", resp.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestBlobUploadSessionExpiredUntouched checks that an upload session
+// abandoned by its client is removed from storage once it outlived its
+// deadline, without being touched again.
+func TestBlobUploadSessionExpiredUntouched(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UploadSessionTTL = 50 * time.Millisecond
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	startPushLayer(t, env.builder, imageName)
+
+	uploadsPath := "/docker/registry/v2/repositories/foo/bar/_uploads"
+	uploads, err := env.app.driver.List(env.ctx, uploadsPath)
+	if err != nil || len(uploads) != 1 {
+		t.Fatalf("expected 1 upload session, got %v: %v", uploads, err)
+	}
+
+	for i := 0; ; i++ {
+		uploads, err = env.app.driver.List(env.ctx, uploadsPath)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok || (err == nil && len(uploads) == 0) {
+			break
+		}
+
+		if i == 50 {
+			t.Fatalf("untouched upload session was not removed: %v, %v", uploads, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 func TestDeleteDisabled(t *testing.T) {
 	env := newTestEnv(t, false)
 
@@ -636,6 +760,110 @@ func TestDeleteDisabled(t *testing.T) {
 	checkResponse(t, "deleting layer with delete disabled", resp, http.StatusMethodNotAllowed)
 }
 
+// TestBlobTOC exercises partial access to eStargz blobs: the table of
+// contents endpoint and range requests on the blob itself.
+func TestBlobTOC(t *testing.T) {
+	env := newTestEnv(t, false)
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	// Assemble an eStargz blob: layer content, the table of contents section
+	// and a footer recording the offset of the table of contents.
+	layer := bytes.Repeat([]byte("layer"), 64)
+	toc := []byte(`{"version":1,"entries":[]}`)
+	payload := []byte(fmt.Sprintf("%016xSTARGZ", len(layer)))
+	extra := append([]byte{'S', 'G', byte(len(payload)), 0}, payload...)
+	footer := append([]byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, byte(len(extra)), 0}, extra...)
+	footer = append(footer, 1, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0)
+	blob := append(append(append([]byte{}, layer...), toc...), footer...)
+	blobDigest := digest.FromBytes(blob)
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, blobDigest, uploadURLBase, bytes.NewReader(blob))
+
+	ref, _ := reference.WithDigest(imageName, blobDigest)
+	tocURL, err := env.builder.BuildBlobTOCURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob toc url: %v", err)
+	}
+
+	resp, err := http.Get(tocURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob toc: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching blob toc", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Length":        []string{fmt.Sprint(len(toc))},
+		"Docker-TOC-Offset":     []string{fmt.Sprint(len(layer))},
+		"Docker-Content-Digest": []string{blobDigest.String()},
+	})
+
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading blob toc: %v", err)
+	}
+	if !bytes.Equal(p, toc) {
+		t.Fatalf("unexpected blob toc: %q != %q", p, toc)
+	}
+
+	// Fetch the table of contents with a range request on the blob, as a
+	// client would after a HEAD on the toc endpoint.
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob url: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", blobURL, nil)
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", len(layer), len(layer)+len(toc)-1))
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob range: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching blob range", resp, http.StatusPartialContent)
+	p, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading blob range: %v", err)
+	}
+	if !bytes.Equal(p, toc) {
+		t.Fatalf("unexpected blob range: %q != %q", p, toc)
+	}
+
+	// Blobs which are not eStargz have no table of contents.
+	layerFile, layerDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layerFile)
+
+	ref, _ = reference.WithDigest(imageName, layerDigest)
+	tocURL, err = env.builder.BuildBlobTOCURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob toc url: %v", err)
+	}
+
+	resp, err = http.Get(tocURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob toc: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching toc of plain blob", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching toc of plain blob", resp, v2.ErrorCodeBlobTOCUnknown)
+
+	metrics := blobMetrics.Snapshot()
+	if metrics.RangeRequests == 0 || metrics.TOCHits == 0 || metrics.TOCMisses == 0 {
+		t.Fatalf("unexpected blob metrics: %#v", metrics)
+	}
+}
+
 func TestDeleteReadOnly(t *testing.T) {
 	env := newTestEnv(t, true)
 
@@ -698,6 +926,15 @@ func httpDelete(url string) (*http.Response, error) {
 	return resp, err
 }
 
+func httpPut(url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
 type manifestArgs struct {
 	imageName reference.Named
 	mediaType string
@@ -716,12 +953,352 @@ func TestManifestAPI(t *testing.T) {
 	testManifestAPIManifestList(t, env, schema2Args)
 
 	deleteEnabled = true
-	env = newTestEnv(t, deleteEnabled)
+	env = newTestEnvSchema1Conversion(t, deleteEnabled, "")
 	testManifestAPISchema1(t, env, schema1Repo)
 	schema2Args = testManifestAPISchema2(t, env, schema2Repo)
 	testManifestAPIManifestList(t, env, schema2Args)
 }
 
+// TestManifestAPISchema1SigningKey checks that manifests converted to schema1
+// are signed with the configured key.
+func TestManifestAPISchema1SigningKey(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/schema2")
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "schema1-key")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := path.Join(dir, "key.json")
+	if err := libtrust.SaveKey(keyFile, pk); err != nil {
+		t.Fatalf("unexpected error saving private key: %v", err)
+	}
+
+	env := newTestEnvSchema1Conversion(t, false, keyFile)
+	args := testManifestAPISchema2(t, env, imageName)
+
+	tagRef, _ := reference.WithTag(imageName, "schema2tag")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest as schema1")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest as schema1", resp, http.StatusOK)
+
+	var fetched schema1.SignedManifest
+	if err := json.NewDecoder(resp.Body).Decode(&fetched); err != nil {
+		t.Fatalf("error decoding fetched schema1 manifest: %v", err)
+	}
+
+	keys, err := schema1.Verify(&fetched)
+	if err != nil {
+		t.Fatalf("error verifying converted manifest of %s: %v", args.dgst, err)
+	}
+	if len(keys) != 1 || keys[0].KeyID() != pk.KeyID() {
+		t.Fatalf("converted manifest not signed with configured key %s", pk.KeyID())
+	}
+}
+
+// slowReader returns its content in two parts, waiting between them.
+type slowReader struct {
+	parts [][]byte
+	delay time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	if len(sr.parts) == 0 {
+		return 0, io.EOF
+	}
+	if len(sr.parts) == 1 {
+		time.Sleep(sr.delay)
+	}
+	n := copy(p, sr.parts[0])
+	sr.parts = sr.parts[1:]
+	return n, nil
+}
+
+// TestRequestTimeout checks that a request exceeding the timeout configured
+// for its route fails, and that other routes use their own timeout.
+func TestRequestTimeout(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Timeouts.Default = time.Minute
+	config.HTTP.Timeouts.Uploads = 100 * time.Millisecond
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+
+	body := &slowReader{
+		parts: [][]byte{[]byte("first part"), []byte("second part")},
+		delay: 200 * time.Millisecond,
+	}
+	resp, _, err := doPushChunk(t, uploadURLBase, body)
+	checkErr(t, err, "pushing slow chunk")
+	defer resp.Body.Close()
+	checkResponse(t, "pushing slow chunk", resp, http.StatusRequestTimeout)
+	checkBodyHasErrorCodes(t, "pushing slow chunk", resp, errcode.ErrorCodeRequestTimeout)
+
+	// A client stalling mid-body is interrupted at the deadline, not once it
+	// sends more.
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	body = &slowReader{
+		parts: [][]byte{[]byte("first part"), []byte("second part")},
+		delay: 10 * time.Second,
+	}
+	start := time.Now()
+	resp, _, err = doPushChunk(t, uploadURLBase, body)
+	checkErr(t, err, "pushing stalled chunk")
+	defer resp.Body.Close()
+	checkResponse(t, "pushing stalled chunk", resp, http.StatusRequestTimeout)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("stalled chunk interrupted after %v", elapsed)
+	}
+
+	// The default timeout applies to the catalog.
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+
+	resp, err = http.Get(catalogURL)
+	checkErr(t, err, "fetching catalog")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching catalog", resp, http.StatusOK)
+}
+
+// TestTagsSnapshot checks that a tag snapshot lists the digests of the tags
+// of a repository and is signed with the configured key.
+func TestTagsSnapshot(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/snapshot")
+
+	env := newTestEnv(t, false)
+	snapshotURL, err := env.builder.BuildTagsSnapshotURL(imageName)
+	checkErr(t, err, "building tags snapshot url")
+
+	resp, err := http.Get(snapshotURL)
+	checkErr(t, err, "fetching disabled tags snapshot")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching disabled tags snapshot", resp, errcode.ErrorCodeUnsupported.Descriptor().HTTPStatusCode)
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "snapshot-key")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := path.Join(dir, "key.json")
+	if err := libtrust.SaveKey(keyFile, pk); err != nil {
+		t.Fatalf("unexpected error saving private key: %v", err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.TagSnapshots.Enabled = true
+	config.HTTP.TagSnapshots.SigningKeyFile = keyFile
+
+	env = newTestEnvWithConfig(t, &config)
+	args := testManifestAPISchema2(t, env, imageName)
+
+	snapshotURL, err = env.builder.BuildTagsSnapshotURL(imageName)
+	checkErr(t, err, "building tags snapshot url")
+
+	resp, err = http.Get(snapshotURL)
+	checkErr(t, err, "fetching tags snapshot")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tags snapshot", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type": []string{TagsSnapshotMediaType},
+	})
+
+	p, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading tags snapshot")
+
+	js, err := libtrust.ParsePrettySignature(p, "signatures")
+	checkErr(t, err, "parsing tags snapshot signature")
+
+	keys, err := js.Verify()
+	checkErr(t, err, "verifying tags snapshot")
+	if len(keys) != 1 || keys[0].KeyID() != pk.KeyID() {
+		t.Fatalf("tags snapshot not signed with configured key %s", pk.KeyID())
+	}
+
+	payload, err := js.Payload()
+	checkErr(t, err, "reading tags snapshot payload")
+
+	var snapshot TagsSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		t.Fatalf("error decoding tags snapshot: %v", err)
+	}
+	if snapshot.Name != imageName.Name() {
+		t.Fatalf("unexpected name in tags snapshot: %q != %q", snapshot.Name, imageName.Name())
+	}
+	if snapshot.Tags["schema2tag"] != args.dgst {
+		t.Fatalf("unexpected digest for tag in tags snapshot: %q != %q", snapshot.Tags["schema2tag"], args.dgst)
+	}
+}
+
+// TestTrustMetadata exercises storing, fetching and deleting the trust
+// metadata of a repository.
+func TestTrustMetadata(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/trust")
+
+	env := newTestEnv(t, false)
+	trustURL, err := env.builder.BuildTrustMetadataURL(imageName, "root", "")
+	checkErr(t, err, "building trust metadata url")
+
+	resp, err := http.Get(trustURL)
+	checkErr(t, err, "fetching disabled trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching disabled trust metadata", resp, errcode.ErrorCodeUnsupported.Descriptor().HTTPStatusCode)
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Trust.Enabled = true
+	env = newTestEnvWithConfig(t, &config)
+
+	trustURL, err = env.builder.BuildTrustMetadataURL(imageName, "targets/releases", "")
+	checkErr(t, err, "building trust metadata url")
+
+	resp, err = http.Get(trustURL)
+	checkErr(t, err, "fetching unknown trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unknown trust metadata", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching unknown trust metadata", resp, v2.ErrorCodeTrustMetadataUnknown)
+
+	resp, err = httpPut(trustURL, []byte("not json"))
+	checkErr(t, err, "putting invalid trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "putting invalid trust metadata", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting invalid trust metadata", resp, v2.ErrorCodeTrustMetadataInvalid)
+
+	first := []byte(`{"signed":{"version":1}}`)
+	resp, err = httpPut(trustURL, first)
+	checkErr(t, err, "putting trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "putting trust metadata", resp, http.StatusCreated)
+	firstURL := resp.Header.Get("Location")
+
+	second := []byte(`{"signed":{"version":2}}`)
+	resp, err = httpPut(trustURL, second)
+	checkErr(t, err, "putting trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "putting trust metadata", resp, http.StatusCreated)
+
+	for _, testcase := range []struct {
+		url     string
+		content []byte
+	}{
+		{url: trustURL, content: second},
+		{url: firstURL, content: first},
+	} {
+		resp, err = http.Get(testcase.url)
+		checkErr(t, err, "fetching trust metadata")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching trust metadata", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Docker-Content-Digest": []string{digest.FromBytes(testcase.content).String()},
+		})
+
+		p, err := ioutil.ReadAll(resp.Body)
+		checkErr(t, err, "reading trust metadata")
+		if !bytes.Equal(p, testcase.content) {
+			t.Fatalf("unexpected trust metadata at %s: %q != %q", testcase.url, p, testcase.content)
+		}
+	}
+
+	resp, err = httpDelete(trustURL)
+	checkErr(t, err, "deleting trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting trust metadata", resp, http.StatusAccepted)
+
+	resp, err = http.Get(firstURL)
+	checkErr(t, err, "fetching deleted trust metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching deleted trust metadata", resp, http.StatusNotFound)
+}
+
+// TestManifestAPISchema1Deprecation checks that schema1 manifests are marked
+// as deprecated in warn mode and refused in reject mode.
+func TestManifestAPISchema1Deprecation(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/schema1")
+
+	env := newTestEnv(t, false)
+	env.app.Config.Compatibility.Schema1.Deprecation = configuration.Schema1Warn
+	createRepository(env, t, imageName.Name(), "latest")
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	before := schema1Metrics.Snapshot()
+
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching schema1 manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching schema1 manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Deprecation": []string{"true"},
+		"Warning":     []string{schema1Warning},
+	})
+
+	env.app.Config.Compatibility.Schema1.Deprecation = configuration.Schema1Reject
+
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching rejected schema1 manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching rejected schema1 manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching rejected schema1 manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	unsignedManifest := &schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: imageName.Name(),
+		Tag:  "rejected",
+		FSLayers: []schema1.FSLayer{
+			{BlobSum: digest.DigestSha256EmptyTar},
+		},
+		History: []schema1.History{
+			{V1Compatibility: ""},
+		},
+	}
+	sm, err := schema1.Sign(unsignedManifest, env.pk)
+	checkErr(t, err, "signing manifest")
+
+	resp = putManifest(t, "putting rejected schema1 manifest", manifestURL, "", sm)
+	defer resp.Body.Close()
+	checkResponse(t, "putting rejected schema1 manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting rejected schema1 manifest", resp, v2.ErrorCodeManifestInvalid)
+
+	after := schema1Metrics.Snapshot()
+	if after.Pulls-before.Pulls != 2 || after.Pushes-before.Pushes != 1 || after.Rejected-before.Rejected != 2 {
+		t.Fatalf("unexpected schema1 metrics: %+v, before: %+v", after, before)
+	}
+}
+
 func TestManifestDelete(t *testing.T) {
 	schema1Repo, _ := reference.ParseNamed("foo/schema1")
 	schema2Repo, _ := reference.ParseNamed("foo/schema2")
@@ -1378,6 +1955,12 @@ func testManifestAPISchema2(t *testing.T, env *testEnv, imageName reference.Name
 	}
 	defer resp.Body.Close()
 
+	if !env.config.Compatibility.Schema1.Enabled {
+		checkResponse(t, "fetching uploaded manifest as schema1 without conversion", resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, "fetching uploaded manifest as schema1 without conversion", resp, v2.ErrorCodeManifestUnknown)
+		return args
+	}
+
 	checkResponse(t, "fetching uploaded manifest as schema1", resp, http.StatusOK)
 	checkHeaders(t, resp, http.Header{
 		"Docker-Content-Digest": []string{dgst.String()},
@@ -1603,6 +2186,12 @@ func testManifestAPIManifestList(t *testing.T, env *testEnv, args manifestArgs)
 	}
 	defer resp.Body.Close()
 
+	if !env.config.Compatibility.Schema1.Enabled {
+		checkResponse(t, "fetching uploaded manifest list as schema1 without conversion", resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, "fetching uploaded manifest list as schema1 without conversion", resp, v2.ErrorCodeManifestUnknown)
+		return
+	}
+
 	checkResponse(t, "fetching uploaded manifest list as schema1", resp, http.StatusOK)
 	checkHeaders(t, resp, http.Header{
 		"Docker-Content-Digest": []string{dgst.String()},
@@ -1819,11 +2408,29 @@ func newTestEnv(t *testing.T, deleteEnabled bool) *testEnv {
 	return newTestEnvWithConfig(t, &config)
 }
 
+// newTestEnvSchema1Conversion returns a test environment which converts
+// schema2 manifests to schema1 for old clients, signing them with the key in
+// keyFile if set.
+func newTestEnvSchema1Conversion(t *testing.T, deleteEnabled bool, keyFile string) *testEnv {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": deleteEnabled},
+		},
+	}
+
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	config.Compatibility.Schema1.TrustKey = keyFile
+
+	return newTestEnvWithConfig(t, &config)
+}
+
 func newTestEnvWithConfig(t *testing.T, config *configuration.Configuration) *testEnv {
 	ctx := context.Background()
 
 	app := NewApp(ctx, config)
-	server := httptest.NewServer(handlers.CombinedLoggingHandler(os.Stderr, app))
+	server := httptest.NewServer(WithResponseController(handlers.CombinedLoggingHandler(os.Stderr, app)))
 	builder, err := v2.NewURLBuilderFromString(server.URL + config.HTTP.Prefix)
 
 	if err != nil {
@@ -2372,3 +2979,68 @@ func TestProxyManifestGetByTag(t *testing.T) {
 		"Docker-Content-Digest": []string{newDigest.String()},
 	})
 }
+
+// TestProxyRetries checks that the requests of a pull through cache to the
+// remote are retried when configured, and that they are not otherwise.
+func TestProxyRetries(t *testing.T) {
+	truthConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	truthConfig.HTTP.Headers = headerConfig
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	truthEnv := newTestEnvWithConfig(t, &truthConfig)
+	defer truthEnv.server.Close()
+	dgst := createRepository(truthEnv, t, imageName.Name(), "latest")
+
+	// The remote fails the first request of each manifest, as if
+	// overloaded.
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		mu.Lock()
+		fail := strings.Contains(r.URL.Path, "/manifests/") && !failed[key]
+		failed[key] = true
+		mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		truthEnv.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	for _, maxRetries := range []int{0, 1} {
+		mu.Lock()
+		failed = make(map[string]bool)
+		mu.Unlock()
+
+		proxyConfig := configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+			},
+			Proxy: configuration.Proxy{
+				RemoteURL:  flaky.URL,
+				MaxRetries: maxRetries,
+			},
+		}
+		proxyConfig.HTTP.Headers = headerConfig
+		proxyEnv := newTestEnvWithConfig(t, &proxyConfig)
+
+		digestRef, _ := reference.WithDigest(imageName, dgst)
+		manifestDigestURL, err := proxyEnv.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+
+		resp, err := http.Get(manifestDigestURL)
+		checkErr(t, err, "fetching manifest from proxy")
+		resp.Body.Close()
+		if fetched := resp.StatusCode == http.StatusOK; fetched != (maxRetries > 0) {
+			t.Fatalf("unexpected status fetching manifest from proxy with %d retries: %d", maxRetries, resp.StatusCode)
+		}
+		proxyEnv.server.Close()
+	}
+}
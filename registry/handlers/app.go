@@ -4,22 +4,30 @@ import (
 	cryptorand "crypto/rand"
 	"expvar"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"runtime"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
 	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/health"
 	"github.com/docker/distribution/health/checks"
 	"github.com/docker/distribution/notifications"
 	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/accesslog"
+	"github.com/docker/distribution/registry/api/admin"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
@@ -46,6 +54,11 @@ const randomSecretSize = 32
 // defaultCheckInterval is the default time in between health checks
 const defaultCheckInterval = 10 * time.Second
 
+// defaultMaxPendingEvents is the number of events pending for a notification
+// endpoint above which the notifications health check fails, if not
+// configured.
+const defaultMaxPendingEvents = 1000
+
 // App is a global registry application object. Shared resources can be placed
 // on this object that will be accessible from all requests. Any writable
 // fields should be protected.
@@ -57,36 +70,149 @@ type App struct {
 	router           *mux.Router                 // main application router, configured with dispatchers
 	driver           storagedriver.StorageDriver // driver maintains the app global storage driver instance.
 	registry         distribution.Namespace      // registry is the primary registry backend for the app instance.
+	storageRegistry  distribution.Namespace      // storageRegistry serves the repositories stored with the app global storage driver.
+	namespaces       *namespaceRouter            // namespaces routes repositories to the storage of their namespace, if configured.
 	accessController auth.AccessController       // main access controller for application
+	userManager      auth.UserManager            // manages the users of the access controller, if supported
 
 	// httpHost is a parsed representation of the http.host parameter from
 	// the configuration. Only the Scheme and Host fields are used.
 	httpHost url.URL
 
+	// httpHosts maps the hostnames of the http.hosts parameter to the
+	// addresses of the registry for requests to them.
+	httpHosts map[string]*url.URL
+
+	// trustedProxies are the networks of the proxies whose headers are
+	// trusted. If empty, the headers of every request are.
+	trustedProxies []*net.IPNet
+
+	// errorDocumentationURL and errorMessage are the templates of the
+	// documentation URL and message of errors, if configured.
+	errorDocumentationURL *template.Template
+	errorMessage          *template.Template
+
 	// events contains notification related configuration.
 	events struct {
 		sink   notifications.Sink
 		source notifications.SourceRecord
+
+		// history retains recent events, which can be written to the
+		// endpoints again through replay.
+		history *notifications.History
+		replay  notifications.Sink
+
+		// subscribers dispatches the events to the clients of the event
+		// stream.
+		subscribers *notifications.Subscribers
+
+		// endpoints are the enabled endpoints, whose queues are checked
+		// by the notifications health check.
+		endpoints []*notifications.Endpoint
 	}
 
 	redis *redis.Pool
 
 	// trustKey is a deprecated key used to sign manifests converted to
 	// schema1 for backward compatibility. It should not be used for any
-	// other purposes.
+	// other purposes. It is nil unless conversion is enabled.
 	trustKey libtrust.PrivateKey
 
+	// tagSnapshotKey signs snapshots of repository tags. It is nil unless
+	// tag snapshots are enabled.
+	tagSnapshotKey libtrust.PrivateKey
+
 	// isCache is true if this registry is configured as a pull through cache
 	isCache bool
 
-	// readOnly is true if the registry is in a read-only maintenance mode
-	readOnly bool
+	// deleteEnabled is true if the storage configuration allows deletion.
+	deleteEnabled bool
+
+	// repositoryDeletionEnabled is true if the storage configuration also
+	// allows deleting repositories as a whole.
+	repositoryDeletionEnabled bool
+
+	// manifestIndexEnabled is true if the metadata of manifests is indexed
+	// as they are pushed, so that they can be searched by it.
+	manifestIndexEnabled bool
+
+	// catalogIndex lists the repositories of the registry's storage for the
+	// catalog. It is nil unless the catalog index is enabled.
+	catalogIndex *storage.CatalogIndex
+
+	// locks is the lock manager of tag updates and manifest deletions,
+	// or nil if locks are not enabled.
+	locks *storage.LockManager
+
+	// scopeTenant is where the tenant of the storage scope of requests is
+	// set from, "namespace" or "header", or empty if it is not set.
+	// scopeTenantHeader is the request header holding it.
+	scopeTenant       string
+	scopeTenantHeader string
+
+	// gcPins are the pins of the storage configuration, protecting content
+	// from garbage collection in addition to those stored in the registry.
+	gcPins []storage.Pin
+
+	// readOnly is true if the registry is in a read-only maintenance mode.
+	// It may be toggled through the admin API and is read with isReadOnly.
+	readOnly   bool
+	readOnlyMu sync.RWMutex
+
+	// instance identifies this registry instance among those sharing the
+	// storage backend.
+	instance string
+
+	// leader elects the instance running the maintenance jobs. It is nil
+	// unless leader election is enabled, every instance running them.
+	leader *leaderElector
+
+	// maintenanceJobs lists the background maintenance jobs enabled on this
+	// instance.
+	maintenanceJobs []string
+
+	// buildGroupMu serializes the updates of build group manifest lists.
+	buildGroupMu sync.Mutex
+
+	// blobPathLayout is the layout version of the blob store blobs are
+	// written to, which the admin API migrates the blob store to.
+	blobPathLayout int
+
+	// prewarmJobs retains the prewarm jobs started through the admin API.
+	prewarmJobs prewarmJobs
+
+	// jobs retains the long-running operations run in the background, such
+	// as repository deletions.
+	jobs jobs
+
+	// accessLog receives a record for each blob read, if enabled.
+	accessLog accesslog.Sink
+
+	// deltas shares the computations of blob deltas in flight.
+	deltas deltaComputations
+
+	// layerIndexes shares the indexing of layers in flight.
+	layerIndexes deltaComputations
+
+	// recompressor counts the pulls of blobs and recompresses the popular
+	// gzip layers to zstd, if enabled.
+	recompressor *recompressor
+
+	// tiering moves the blobs unread for long to a cold storage class and
+	// recalls them when read, if enabled.
+	tiering *tiering
+
+	// shadow mirrors a sample of the read requests to a shadow deployment,
+	// if configured.
+	shadow *shadower
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
 // requests. The app only implements ServeHTTP and can be wrapped in other
 // handlers accordingly.
 func NewApp(ctx context.Context, config *configuration.Configuration) *App {
+	config.HTTP.Prefix = cleanPrefix(config.HTTP.Prefix)
+
 	app := &App{
 		Config:  config,
 		Context: ctx,
@@ -101,9 +227,27 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.register(v2.RouteNameManifest, imageManifestDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
+	app.register(v2.RouteNameTagsSnapshot, tagsSnapshotDispatcher)
+	app.register(v2.RouteNameManifestSearch, manifestSearchDispatcher)
+	app.register(v2.RouteNameManifestMetadata, manifestMetadataDispatcher)
+	app.register(v2.RouteNameManifestSBOM, manifestSBOMDispatcher)
+	app.register(v2.RouteNameManifestGraph, manifestGraphDispatcher)
+	app.register(v2.RouteNameManifestCompare, compareDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
+	app.register(v2.RouteNameBlobTOC, blobTOCDispatcher)
+	app.register(v2.RouteNameBlobDelta, blobDeltaDispatcher)
+	app.register(v2.RouteNameBlobFiles, blobFilesDispatcher)
+	app.register(v2.RouteNameBlobVariant, blobVariantDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameTrust, trustDispatcher)
+	app.register(v2.RouteNameExtensions, extensionsDispatcher)
+	app.register(v2.RouteNameRepository, repositoryDispatcher)
+	app.register(v2.RouteNameRepositoryDeletion, repositoryDeletionDispatcher)
+	app.register(v2.RouteNameRepositoryImport, repositoryImportDispatcher)
+	app.register(v2.RouteNameRepositoryChecksum, repositoryChecksumDispatcher)
+
+	checkRouteGroups(config.HTTP.RouteGroups)
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -112,6 +256,20 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 	storageParams["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
 
+	if pc, ok := config.Storage["plugins"]; ok {
+		if v, ok := pc["paths"]; ok {
+			paths, ok := v.([]interface{})
+			if !ok {
+				panic("plugins paths config key must contain a list of paths")
+			}
+			for _, path := range paths {
+				if err := factory.LoadPlugin(fmt.Sprint(path)); err != nil {
+					panic(err)
+				}
+			}
+		}
+	}
+
 	var err error
 	app.driver, err = factory.Create(config.Storage.Type(), storageParams)
 	if err != nil {
@@ -122,7 +280,38 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	purgeConfig := uploadPurgeDefaultConfig()
+	var usageConfig, untaggedConfig, recompressionConfig, tieringConfig, leaderConfig map[interface{}]interface{}
 	if mc, ok := config.Storage["maintenance"]; ok {
+		if v, ok := mc["usagereport"]; ok {
+			usageConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("usagereport config key must contain additional keys")
+			}
+		}
+		if v, ok := mc["untaggedmanifests"]; ok {
+			untaggedConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("untaggedmanifests config key must contain additional keys")
+			}
+		}
+		if v, ok := mc["recompression"]; ok {
+			recompressionConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("recompression config key must contain additional keys")
+			}
+		}
+		if v, ok := mc["tiering"]; ok {
+			tieringConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("tiering config key must contain additional keys")
+			}
+		}
+		if v, ok := mc["leaderelection"]; ok {
+			leaderConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("leaderelection config key must contain additional keys")
+			}
+		}
 		if v, ok := mc["uploadpurging"]; ok {
 			purgeConfig, ok = v.(map[interface{}]interface{})
 			if !ok {
@@ -143,7 +332,8 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
-	startUploadPurger(app, app.driver, ctxu.GetLogger(app), purgeConfig)
+	// Uploads are purged through the storage driver without middleware.
+	purgeDriver := app.driver
 
 	app.driver, err = applyStorageMiddleware(app.driver, config.Middleware["storage"])
 	if err != nil {
@@ -153,13 +343,19 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.configureSecret(config)
 	app.configureEvents(config)
 	app.configureRedis(config)
+	app.configureLeaderElection(leaderConfig)
+	startUploadPurger(app, purgeDriver, ctxu.GetLogger(app), purgeConfig)
+	startUploadSessionExpiry(app, purgeDriver, ctxu.GetLogger(app), config.HTTP.UploadSessionTTL)
 	app.configureLogHook(config)
+	app.configureAccessLog(config)
+	app.configureShadow(config)
 
-	// Generate an ephemeral key to be used for signing converted manifests
-	// for clients that don't support schema2.
-	app.trustKey, err = libtrust.GenerateECP256PrivateKey()
-	if err != nil {
-		panic(err)
+	if config.Compatibility.Schema1.Enabled {
+		app.configureSchema1(config)
+	}
+
+	if config.HTTP.TagSnapshots.Enabled {
+		app.configureTagSnapshots(config)
 	}
 
 	if config.HTTP.Host != "" {
@@ -167,9 +363,13 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		if err != nil {
 			panic(fmt.Sprintf(`could not parse http "host" parameter: %v`, err))
 		}
-		app.httpHost = *u
+		app.httpHost = *app.withPrefix(u)
 	}
 
+	app.configureHosts(config)
+	app.configureTrustedProxies(config)
+	app.configureErrors(config)
+
 	options := []storage.RegistryOption{}
 
 	if app.isCache {
@@ -182,6 +382,83 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		if ok {
 			if deleteEnabled, ok := e.(bool); ok && deleteEnabled {
 				options = append(options, storage.EnableDelete)
+				app.deleteEnabled = true
+			}
+		}
+
+		if r, ok := d["repositories"]; ok {
+			repositoryDeletionEnabled, ok := r.(bool)
+			if !ok {
+				panic(fmt.Sprintf("storage.delete.repositories must be a boolean, got %#v", r))
+			}
+			app.repositoryDeletionEnabled = app.deleteEnabled && repositoryDeletionEnabled
+		}
+	}
+
+	// configure the metadata journal
+	if j, ok := config.Storage["journal"]; ok {
+		if e, ok := j["enabled"]; ok {
+			if journalEnabled, ok := e.(bool); ok && journalEnabled {
+				options = append(options, storage.EnableJournal)
+				ctxu.GetLogger(app).Infof("recording metadata mutations in the journal")
+			}
+		}
+	}
+
+	// configure the locks of tag updates and manifest deletions
+	if l, ok := config.Storage["locks"]; ok {
+		if app.locks = app.configureLocks(l); app.locks != nil {
+			options = append(options, storage.Locks(app.locks))
+		}
+	}
+
+	// configure the storage scope of requests
+	if sc, ok := config.Storage["scope"]; ok {
+		app.configureScope(sc)
+	}
+
+	// configure the catalog index
+	if ci, ok := config.Storage["catalogindex"]; ok {
+		if app.catalogIndex = app.configureCatalogIndex(ci, app.locks); app.catalogIndex != nil {
+			options = append(options, storage.IndexCatalog(app.catalogIndex))
+		}
+	}
+
+	// configure the manifest index
+	if mi, ok := config.Storage["manifestindex"]; ok {
+		if e, ok := mi["enabled"]; ok {
+			if manifestIndexEnabled, ok := e.(bool); ok && manifestIndexEnabled {
+				options = append(options, storage.EnableManifestIndex)
+				app.manifestIndexEnabled = true
+				ctxu.GetLogger(app).Infof("indexing the annotations and labels of manifests")
+			}
+		}
+	}
+
+	// configure the garbage collection pins
+	if gc, ok := config.Storage["gc"]; ok {
+		if v, ok := gc["pins"]; ok {
+			pins, ok := v.([]interface{})
+			if !ok {
+				panic(fmt.Sprintf("invalid type for gc pins config: %#v", v))
+			}
+
+			for _, p := range pins {
+				s, ok := p.(string)
+				if !ok {
+					panic(fmt.Sprintf("invalid gc pin: %#v", p))
+				}
+
+				// Pins which do not parse as digests are repository
+				// patterns.
+				pin := storage.Pin{Repository: s}
+				if dgst, err := digest.ParseDigest(s); err == nil {
+					pin = storage.Pin{Digest: dgst}
+				}
+				if err := pin.Validate(); err != nil {
+					panic(fmt.Sprintf("invalid gc pin %q: %v", s, err))
+				}
+				app.gcPins = append(app.gcPins, pin)
 			}
 		}
 	}
@@ -203,6 +480,97 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		options = append(options, storage.EnableRedirect)
 	}
 
+	// configure accepted digest algorithms
+	if dc, ok := config.Storage["digest"]; ok {
+		if v, ok := dc["algorithms"]; ok {
+			algorithms, ok := v.([]interface{})
+			if !ok {
+				panic(fmt.Sprintf("invalid type for digest algorithms config: %#v", v))
+			}
+
+			var accepted []digest.Algorithm
+			for _, a := range algorithms {
+				name, ok := a.(string)
+				if !ok {
+					panic(fmt.Sprintf("invalid digest algorithm: %#v", a))
+				}
+				accepted = append(accepted, digest.Algorithm(name))
+			}
+
+			options = append(options, storage.DigestAlgorithms(accepted...))
+			ctxu.GetLogger(app).Infof("accepting digest algorithms: %v", accepted)
+		}
+	}
+
+	// configure the blob store layout
+	app.blobPathLayout = storage.DefaultBlobPathLayout
+	if lc, ok := config.Storage["layout"]; ok {
+		if v, ok := lc["version"]; ok {
+			app.blobPathLayout, ok = v.(int)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for layout version config: %#v", v))
+			}
+		}
+
+		var compatible []int
+		if v, ok := lc["compatible"]; ok {
+			versions, ok := v.([]interface{})
+			if !ok {
+				panic(fmt.Sprintf("invalid type for layout compatible config: %#v", v))
+			}
+
+			for _, version := range versions {
+				n, ok := version.(int)
+				if !ok {
+					panic(fmt.Sprintf("invalid layout version: %#v", version))
+				}
+				compatible = append(compatible, n)
+			}
+		}
+
+		options = append(options, storage.BlobPathLayout(app.blobPathLayout, compatible...))
+		ctxu.GetLogger(app).Infof("using blob store layout version %d, reading versions %v", app.blobPathLayout, compatible)
+	}
+
+	// configure storage classes selected by manifest annotations
+	if sc, ok := config.Storage["storageclass"]; ok {
+		annotation := storage.DefaultStorageClassAnnotation
+		if v, ok := sc["annotation"]; ok {
+			annotation, ok = v.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for storageclass annotation config: %#v", v))
+			}
+		}
+
+		classes := make(map[string]string)
+		if v, ok := sc["classes"]; ok {
+			m, ok := v.(map[interface{}]interface{})
+			if !ok {
+				panic(fmt.Sprintf("invalid type for storageclass classes config: %#v", v))
+			}
+
+			for k, c := range m {
+				value, ok := k.(string)
+				if !ok {
+					panic(fmt.Sprintf("invalid storageclass annotation value: %#v", k))
+				}
+				class, ok := c.(string)
+				if !ok {
+					panic(fmt.Sprintf("invalid storage class for annotation value %q: %#v", value, c))
+				}
+				classes[value] = class
+			}
+		}
+
+		options = append(options, storage.StorageClassAnnotation(annotation, classes))
+		ctxu.GetLogger(app).Infof("selecting storage class of layers from manifest annotation %q", annotation)
+	}
+
+	// configure the negative cache of tags and layers
+	if cc, ok := config.Storage["cache"]; ok && cc["negativettl"] != nil {
+		options = append(options, negativeCacheOption(app, cc))
+	}
+
 	// configure storage caches
 	if cc, ok := config.Storage["cache"]; ok {
 		v, ok := cc["blobdescriptor"]
@@ -260,11 +628,19 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 		app.accessController = accessController
 		ctxu.GetLogger(app).Debugf("configured %q access controller", authType)
+
+		if um, ok := accessController.(auth.UserManager); ok {
+			app.userManager = um
+		}
+
+		if cc, ok := config.Auth["cache"]; ok {
+			app.accessController = cachedAccessController(app, accessController, cc)
+		}
 	}
 
 	// configure as a pull through cache
 	if config.Proxy.RemoteURL != "" {
-		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
+		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy, app.proxyTagMoved)
 		if err != nil {
 			panic(err.Error())
 		}
@@ -272,16 +648,100 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		ctxu.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
 	}
 
+	app.storageRegistry = app.registry
+	app.configureNamespaces(config, options)
+	app.configureResidency(config)
+	app.configureFederation(config)
+
+	startUsageReporter(app, usageConfig)
+	startUntaggedManifestCleaner(app, untaggedConfig)
+	startRecompressor(app, recompressionConfig)
+	app.configureTiering(tieringConfig)
+	startCatalogIndexRepairer(app, config.Storage["catalogindex"])
+
+	if config.HTTP.Admin.Enabled {
+		app.registerAdmin()
+	}
+
+	if config.HTTP.UI.Enabled {
+		app.registerUI()
+	}
+
 	return app
 }
 
+// cachedAccessController wraps the access controller with a cache of
+// successful authorizations, configured by the auth cache parameters.
+func cachedAccessController(ctx ctxu.Context, accessController auth.AccessController, config configuration.Parameters) auth.AccessController {
+	var ttl time.Duration
+	switch v := config["ttl"].(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			panic(fmt.Sprintf("invalid auth cache ttl %q: %v", v, err))
+		}
+		ttl = d
+	case nil:
+		panic("auth cache ttl missing")
+	default:
+		panic(fmt.Sprintf("invalid type for auth cache ttl config: %#v", v))
+	}
+	if ttl <= 0 {
+		return accessController
+	}
+
+	var size int
+	switch v := config["size"].(type) {
+	case int:
+		size = v
+	case nil:
+	default:
+		panic(fmt.Sprintf("invalid type for auth cache size config: %#v", v))
+	}
+
+	ctxu.GetLogger(ctx).Infof("caching successful authorizations for %v", ttl)
+	return auth.NewCachedAccessController(accessController, ttl, size)
+}
+
+// negativeCacheOption returns the registry option remembering the tags and
+// layers found missing from storage, configured by the negative cache
+// parameters of the storage cache.
+func negativeCacheOption(ctx ctxu.Context, config configuration.Parameters) storage.RegistryOption {
+	var ttl time.Duration
+	switch v := config["negativettl"].(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			panic(fmt.Sprintf("invalid storage cache negativettl %q: %v", v, err))
+		}
+		ttl = d
+	default:
+		panic(fmt.Sprintf("invalid type for storage cache negativettl config: %#v", v))
+	}
+
+	var size int
+	switch v := config["negativesize"].(type) {
+	case int:
+		size = v
+	case nil:
+	default:
+		panic(fmt.Sprintf("invalid type for storage cache negativesize config: %#v", v))
+	}
+
+	if ttl > 0 {
+		ctxu.GetLogger(ctx).Infof("caching tags and layers missing from storage for %v", ttl)
+	}
+	return storage.NegativeCache(ttl, size)
+}
+
 // RegisterHealthChecks is an awful hack to defer health check registration
 // control to callers. This should only ever be called once per registry
 // process, typically in a main function. The correct way would be register
 // health checks outside of app, since multiple apps may exist in the same
 // process. Because the configuration and app are tightly coupled,
 // implementing this properly will require a refactor. This method may panic
-// if called twice in the same process.
+// if called twice in the same process. The checks are readiness checks: they
+// take the registry out of rotation while its backends are unavailable.
 func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 	if len(healthRegistries) > 1 {
 		panic("RegisterHealthChecks called with more than one registry")
@@ -299,7 +759,18 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 
 		storageDriverCheck := func() error {
 			_, err := app.driver.List(app, "/") // "/" should always exist
-			return err                          // any error will be treated as failure
+			if err != nil {
+				return err // any error will be treated as failure
+			}
+
+			if app.namespaces != nil {
+				for _, ns := range app.namespaces.storages {
+					if _, err := ns.driver.List(app, "/"); err != nil {
+						return fmt.Errorf("storage of namespaces %v: %v", ns.names, err)
+					}
+				}
+			}
+			return nil
 		}
 
 		if app.Config.Health.StorageDriver.Threshold != 0 {
@@ -309,6 +780,67 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 		}
 	}
 
+	if app.Config.Health.Auth.Enabled && app.accessController != nil {
+		interval := app.Config.Health.Auth.Interval
+		if interval == 0 {
+			interval = defaultCheckInterval
+		}
+
+		// Only the access controllers depending on a backend are checked.
+		if checker, ok := app.accessController.(health.Checker); ok {
+			name := "auth_" + app.Config.Auth.Type()
+			if app.Config.Health.Auth.Threshold != 0 {
+				healthRegistry.Register(name, health.PeriodicThresholdChecker(checker, interval, app.Config.Health.Auth.Threshold))
+			} else {
+				healthRegistry.Register(name, health.PeriodicChecker(checker, interval))
+			}
+		}
+	}
+
+	if app.Config.Health.Notifications.Enabled {
+		interval := app.Config.Health.Notifications.Interval
+		if interval == 0 {
+			interval = defaultCheckInterval
+		}
+
+		maxPending := app.Config.Health.Notifications.MaxPending
+		if maxPending <= 0 {
+			maxPending = defaultMaxPendingEvents
+		}
+
+		notificationsCheck := func() error {
+			for _, endpoint := range app.events.endpoints {
+				var metrics notifications.EndpointMetrics
+				endpoint.ReadMetrics(&metrics)
+				if metrics.Pending > maxPending {
+					return fmt.Errorf("%d events pending for notification endpoint %s", metrics.Pending, endpoint.Name())
+				}
+			}
+			return nil
+		}
+
+		if app.Config.Health.Notifications.Threshold != 0 {
+			healthRegistry.RegisterPeriodicThresholdFunc("notifications", interval, app.Config.Health.Notifications.Threshold, notificationsCheck)
+		} else {
+			healthRegistry.RegisterPeriodicFunc("notifications", interval, notificationsCheck)
+		}
+	}
+
+	if app.Config.Health.Proxy.Enabled && app.isCache {
+		interval := app.Config.Health.Proxy.Interval
+		if interval == 0 {
+			interval = defaultCheckInterval
+		}
+
+		if checker, ok := app.registry.(health.Checker); ok {
+			if app.Config.Health.Proxy.Threshold != 0 {
+				healthRegistry.Register("proxy_upstream", health.PeriodicThresholdChecker(checker, interval, app.Config.Health.Proxy.Threshold))
+			} else {
+				healthRegistry.Register("proxy_upstream", health.PeriodicChecker(checker, interval))
+			}
+		}
+	}
+
 	for _, fileChecker := range app.Config.Health.FileCheckers {
 		interval := fileChecker.Interval
 		if interval == 0 {
@@ -382,22 +914,36 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 			continue
 		}
 
+		if err := notifications.ValidEnvelope(endpoint.Envelope); err != nil {
+			panic(fmt.Sprintf("endpoint %s: %v", endpoint.Name, err))
+		}
+
 		ctxu.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
 		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
 			Timeout:   endpoint.Timeout,
 			Threshold: endpoint.Threshold,
 			Backoff:   endpoint.Backoff,
 			Headers:   endpoint.Headers,
+			Envelope:  endpoint.Envelope,
 		})
 
 		sinks = append(sinks, endpoint)
+		app.events.endpoints = append(app.events.endpoints, endpoint)
+	}
+
+	historySize := configuration.Notifications.History
+	if historySize <= 0 {
+		historySize = defaultEventHistory
 	}
+	app.events.history = notifications.NewHistory(historySize)
+	app.events.replay = notifications.NewBroadcaster(sinks...)
 
 	// NOTE(stevvooe): Moving to a new queueing implementation is as easy as
 	// replacing broadcaster with a rabbitmq implementation. It's recommended
 	// that the registry instances also act as the workers to keep deployment
 	// simple.
-	app.events.sink = notifications.NewBroadcaster(sinks...)
+	app.events.subscribers = notifications.NewSubscribers(eventStreamBuffer)
+	app.events.sink = notifications.NewBroadcaster(append(sinks, app.events.history, app.events.subscribers)...)
 
 	// Populate registry event source
 	hostname, err := os.Hostname()
@@ -417,6 +963,66 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	}
 }
 
+// configureAccessLog creates the sinks of the blob access records.
+func (app *App) configureAccessLog(configuration *configuration.Configuration) {
+	if !configuration.AccessLog.Enabled {
+		return
+	}
+
+	var sinks []accesslog.Sink
+	for _, sinkConfig := range configuration.AccessLog.Sinks {
+		var (
+			sink accesslog.Sink
+			err  error
+		)
+		switch sinkConfig.Type {
+		case "file":
+			sink, err = accesslog.NewFileSink(sinkConfig.Path)
+		case "kafka":
+			sink, err = accesslog.NewKafkaSink(accesslog.KafkaConfig{
+				URL:       sinkConfig.URL,
+				Topic:     sinkConfig.Topic,
+				Headers:   sinkConfig.Headers,
+				Timeout:   sinkConfig.Timeout,
+				BatchSize: sinkConfig.BatchSize,
+				QueueSize: sinkConfig.QueueSize,
+			})
+		default:
+			err = fmt.Errorf("unknown sink type %q", sinkConfig.Type)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure access log: %v", err))
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 0 {
+		panic("access log enabled without sinks")
+	}
+	app.accessLog = accesslog.NewMultiSink(sinks...)
+}
+
+// configureFederation falls through to the sibling registries configured for
+// the content not found locally.
+func (app *App) configureFederation(configuration *configuration.Configuration) {
+	if len(configuration.Federation.Registries) == 0 {
+		return
+	}
+	if app.isCache {
+		panic("federation is not supported by a pull through cache")
+	}
+
+	registry, err := proxy.NewFederatedRegistry(app, app.registry, configuration.Federation)
+	if err != nil {
+		panic(fmt.Sprintf("unable to configure federation: %v", err))
+	}
+	app.registry = registry
+
+	for _, sibling := range configuration.Federation.Registries {
+		ctxu.GetLogger(app).Infof("federated with registry %s", sibling.URL)
+	}
+}
+
 func (app *App) configureRedis(configuration *configuration.Configuration) {
 	if configuration.Redis.Addr == "" {
 		ctxu.GetLogger(app).Infof("redis not configured")
@@ -543,9 +1149,47 @@ func (app *App) configureSecret(configuration *configuration.Configuration) {
 	}
 }
 
+// configureSchema1 loads the key used to sign manifests converted to schema1
+// for clients that don't support schema2. An ephemeral key is generated if
+// no key file is configured, so the signatures of converted manifests change
+// whenever the registry restarts.
+func (app *App) configureSchema1(configuration *configuration.Configuration) {
+	app.trustKey = app.loadSigningKey(configuration.Compatibility.Schema1.TrustKey, "compatibility.schema1.signingkeyfile")
+}
+
+// configureTagSnapshots loads the key used to sign tag snapshots. As for
+// schema1, an ephemeral key is generated if no key file is configured.
+func (app *App) configureTagSnapshots(configuration *configuration.Configuration) {
+	app.tagSnapshotKey = app.loadSigningKey(configuration.HTTP.TagSnapshots.SigningKeyFile, "http.tagsnapshots.signingkeyfile")
+}
+
+// loadSigningKey loads the libtrust private key in keyFile, or generates an
+// ephemeral key if keyFile is empty. option names the configuration option
+// keyFile was read from.
+func (app *App) loadSigningKey(keyFile, option string) libtrust.PrivateKey {
+	if keyFile != "" {
+		key, err := libtrust.LoadKeyFile(keyFile)
+		if err != nil {
+			panic(fmt.Sprintf(`could not load %q: %v`, option, err))
+		}
+		return key
+	}
+
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		panic(err)
+	}
+	ctxu.GetLogger(app).Warnf("No signing key provided - generated ephemeral key. To provide a persistent key, fill in %s in the configuration file.", option)
+	return key
+}
+
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close() // ensure that request body is always closed.
 
+	if !app.trustsProxyHeaders(r) {
+		removeProxyHeaders(r)
+	}
+
 	// Instantiate an http context here so we can track the error codes
 	// returned by the request router.
 	ctx := defaultContextManager.context(app, w, r)
@@ -589,15 +1233,43 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 			}
 		}
 
+		// Preflight requests carry no credentials, so they are answered
+		// before authorization.
+		if app.setRouteGroupHeaders(w, r) {
+			return
+		}
+
 		context := app.context(w, r)
 
+		if app.shadow != nil {
+			defer app.shadow.mirror(context, w, r)
+		}
+
+		cancel := app.withRequestTimeout(context, w, r)
+		defer cancel()
+
 		if err := app.authorized(w, r, context); err != nil {
 			ctxu.GetLogger(context).Warnf("error authorizing context: %v", err)
 			return
 		}
 
-		// Add username to request logging
-		context.Context = ctxu.WithLogger(context.Context, ctxu.GetLogger(context.Context, auth.UserNameKey))
+		// Add username, and the issuer of its token, to request logging
+		logKeys := []interface{}{auth.UserNameKey}
+		if ctxu.GetStringValue(context, auth.UserIssuerKey) != "" {
+			logKeys = append(logKeys, auth.UserIssuerKey)
+		}
+		context.Context = ctxu.WithLogger(context.Context, ctxu.GetLogger(context.Context, logKeys...))
+
+		if err := app.withStorageScope(context, r); err != nil {
+			ctxu.GetLogger(context).Errorf("error setting storage scope: %v", err)
+			if _, ok := err.(errcode.ErrorCoder); ok {
+				context.Errors = append(context.Errors, err)
+			} else {
+				context.Errors = append(context.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			app.serveErrors(context, w, context.Errors)
+			return
+		}
 
 		if app.nameRequired(r) {
 			nameRef, err := reference.ParseNamed(getName(context))
@@ -607,9 +1279,7 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 					Name:   getName(context),
 					Reason: err,
 				})
-				if err := errcode.ServeJSON(w, context.Errors); err != nil {
-					ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-				}
+				app.serveErrors(context, w, context.Errors)
 				return
 			}
 			repository, err := app.registry.Repository(context, nameRef)
@@ -624,9 +1294,7 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 					context.Errors = append(context.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
 				}
 
-				if err := errcode.ServeJSON(w, context.Errors); err != nil {
-					ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-				}
+				app.serveErrors(context, w, context.Errors)
 				return
 			}
 
@@ -640,9 +1308,7 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 				ctxu.GetLogger(context).Errorf("error initializing repository middleware: %v", err)
 				context.Errors = append(context.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 
-				if err := errcode.ServeJSON(w, context.Errors); err != nil {
-					ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-				}
+				app.serveErrors(context, w, context.Errors)
 				return
 			}
 		}
@@ -652,15 +1318,135 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		// own errors if they need different behavior (such as range errors
 		// for layer upload).
 		if context.Errors.Len() > 0 {
-			if err := errcode.ServeJSON(w, context.Errors); err != nil {
-				ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			if timedOut(context) {
+				// The errors were most likely caused by the deadline,
+				// which is reported instead.
+				app.logError(context, context.Errors)
+				context.Errors = errcode.Errors{errcode.ErrorCodeRequestTimeout}
+			} else if unavailable, ok := backendUnavailable(context.Errors); ok {
+				// The storage backend is failing fast, clients are told
+				// when to try again.
+				app.logError(context, context.Errors)
+				w.Header().Set("Retry-After", retryAfter(unavailable.RetryAfter))
+				context.Errors = errcode.Errors{errcode.ErrorCodeUnavailable.WithDetail(unavailable)}
 			}
 
+			app.serveErrors(context, w, context.Errors)
+
 			app.logError(context, context.Errors)
 		}
 	})
 }
 
+// requestTimeout returns the timeout configured for the route of the request,
+// or zero if it is not bounded.
+func (app *App) requestTimeout(r *http.Request) time.Duration {
+	timeouts := app.Config.HTTP.Timeouts
+
+	var timeout time.Duration
+	if route := mux.CurrentRoute(r); route != nil {
+		switch route.GetName() {
+		case v2.RouteNameBlobUpload, v2.RouteNameBlobUploadChunk, v2.RouteNameRepositoryImport:
+			timeout = timeouts.Uploads
+		case v2.RouteNameBlob, v2.RouteNameBlobTOC, v2.RouteNameBlobDelta, v2.RouteNameBlobFiles, v2.RouteNameBlobVariant:
+			timeout = timeouts.Blobs
+		case v2.RouteNameManifest, v2.RouteNameManifestMetadata, v2.RouteNameManifestSBOM, v2.RouteNameManifestGraph, v2.RouteNameManifestCompare:
+			timeout = timeouts.Manifests
+		case v2.RouteNameTags, v2.RouteNameTagsSnapshot, v2.RouteNameRepositoryChecksum:
+			timeout = timeouts.Tags
+		case admin.RouteNameEventsStream:
+			// The event stream lasts until the client disconnects.
+			return 0
+		}
+	}
+
+	if timeout == 0 {
+		timeout = timeouts.Default
+	}
+	return timeout
+}
+
+// withRequestTimeout sets a deadline on the context of the request, and on
+// reading its body, from the timeout configured for its route. The read
+// deadline is set on the connection, so that a read blocked on a client
+// stalling mid-body is interrupted. The returned function releases the
+// deadline's resources and must be called once the request has been served.
+func (app *App) withRequestTimeout(ctx *Context, w http.ResponseWriter, r *http.Request) context.CancelFunc {
+	timeout := app.requestTimeout(r)
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithDeadline(ctx.Context, deadline)
+
+	rc, ok := r.Context().Value(responseControllerKey{}).(*http.ResponseController)
+	if !ok {
+		rc = http.NewResponseController(w)
+	}
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		ctxu.GetLogger(ctx).Debugf("unable to set read deadline, stalled reads are not interrupted: %v", err)
+	}
+
+	r.Body = &deadlineReader{ReadCloser: r.Body, ctx: ctx.Context, deadline: deadline}
+	return cancel
+}
+
+// responseControllerKey is the key of the controller of the response to a
+// request, in the context of the request.
+type responseControllerKey struct{}
+
+// WithResponseController returns a handler recording the controller of the
+// response to each request in the context of the request, for the registry
+// to set deadlines on reading request bodies although handler wraps the
+// response with writers which do not unwrap to the connection.
+func WithResponseController(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseControllerKey{}, http.NewResponseController(w))
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// timedOut returns true if the deadline of ctx has passed, even if ctx has
+// not noticed yet, as when the read deadline of the connection was reached
+// first.
+func timedOut(ctx context.Context) bool {
+	if ctx.Err() == context.DeadlineExceeded {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// deadlineReader fails reads of a request body once the request context is
+// done, so a client sending its body slowly cannot keep a request alive past
+// its deadline. Reads interrupted by the read deadline of the connection fail
+// with the error of the context too.
+type deadlineReader struct {
+	io.ReadCloser
+	ctx      context.Context
+	deadline time.Time
+}
+
+func (dr *deadlineReader) Read(p []byte) (int, error) {
+	if err := dr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := dr.ReadCloser.Read(p)
+	if ctxErr := dr.ctx.Err(); ctxErr != nil {
+		// The body was not received in time, even if this read ended it.
+		return n, ctxErr
+	}
+	if err != nil && err != io.EOF && !time.Now().Before(dr.deadline) {
+		// The read deadline passed before the context noticed.
+		return n, context.DeadlineExceeded
+	}
+	return n, err
+}
+
 func (app *App) logError(context context.Context, errors errcode.Errors) {
 	for _, e1 := range errors {
 		var c ctxu.Context
@@ -705,16 +1491,61 @@ func (app *App) context(w http.ResponseWriter, r *http.Request) *Context {
 		Context: ctx,
 	}
 
+	context.urlBuilder = app.urlBuilderFor(r)
+	if app.Config.HTTP.RelativeURLs {
+		context.urlBuilder = context.urlBuilder.Relative()
+	}
+
+	return context
+}
+
+// urlBuilderFor returns a builder of absolute URLs of the registry for the
+// client of r.
+func (app *App) urlBuilderFor(r *http.Request) *v2.URLBuilder {
+	if u, ok := app.hostFor(r); ok {
+		// A "hosts" item matching the requested hostname takes precedence
+		// over the "host" item, so that clients reaching the registry by
+		// another hostname are given URLs they can reach.
+		return v2.NewURLBuilder(u)
+	}
 	if app.httpHost.Scheme != "" && app.httpHost.Host != "" {
 		// A "host" item in the configuration takes precedence over
-		// X-Forwarded-Proto and X-Forwarded-Host headers, and the
-		// hostname in the request.
-		context.urlBuilder = v2.NewURLBuilder(&app.httpHost)
-	} else {
-		context.urlBuilder = v2.NewURLBuilderFromRequest(r)
+		// proxy headers and the hostname in the request.
+		return v2.NewURLBuilder(&app.httpHost)
 	}
+	if app.Config.HTTP.Prefix != "" {
+		// The API is served under the configured prefix, rather than
+		// whatever precedes /v2/ in the request path.
+		return v2.NewURLBuilder(app.withPrefix(&url.URL{
+			Scheme: ctxu.RequestScheme(r),
+			Host:   ctxu.RequestHost(r),
+		}))
+	}
+	return v2.NewURLBuilderFromRequest(r)
+}
 
-	return context
+// withPrefix returns u with the path of the http.prefix parameter, if u has
+// no path of its own, so that URLs built from an address configured without
+// the prefix include it.
+func (app *App) withPrefix(u *url.URL) *url.URL {
+	if app.Config.HTTP.Prefix == "" || (u.Path != "" && u.Path != "/") {
+		return u
+	}
+
+	prefixed := *u
+	prefixed.Path = app.Config.HTTP.Prefix
+	return &prefixed
+}
+
+// cleanPrefix returns the http.prefix parameter as an absolute path with a
+// trailing slash, such as "/registry/", or "" if the API is served at the
+// root.
+func cleanPrefix(prefix string) string {
+	prefix = path.Clean("/" + strings.Trim(prefix, "/"))
+	if prefix == "/" {
+		return ""
+	}
+	return prefix + "/"
 }
 
 // authorized checks if the request can proceed with access to the requested
@@ -730,8 +1561,23 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 
 	var accessRecords []auth.Access
 
-	if repo != "" {
-		accessRecords = appendAccessRecords(accessRecords, r.Method, repo)
+	if isAdminRequest(r) {
+		// The admin API requires full rights on the registry, regardless
+		// of the repository the request refers to.
+		accessRecords = append(accessRecords, auth.Access{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "admin",
+			},
+			Action: "*",
+		})
+	} else if repo != "" {
+		method := r.Method
+		if isUIRequest(r) && method == "POST" {
+			// The web UI deletes manifests with form posts.
+			method = "DELETE"
+		}
+		accessRecords = appendAccessRecords(accessRecords, method, repo)
 		if fromRepo := r.FormValue("from"); fromRepo != "" {
 			// mounting a blob from one repository to another requires pull (GET)
 			// access to the source repository.
@@ -746,9 +1592,7 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			// base route is accessed. This section prevents us from making
 			// that mistake elsewhere in the code, allowing any operation to
 			// proceed.
-			if err := errcode.ServeJSON(w, errcode.ErrorCodeUnauthorized); err != nil {
-				ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-			}
+			app.serveErrors(context, w, errcode.Errors{errcode.ErrorCodeUnauthorized})
 			return fmt.Errorf("forbidden: no repository name")
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
@@ -761,9 +1605,7 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			// Add the appropriate WWW-Auth header
 			err.SetHeaders(w)
 
-			if err := errcode.ServeJSON(w, errcode.ErrorCodeUnauthorized.WithDetail(accessRecords)); err != nil {
-				ctxu.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-			}
+			app.serveErrors(context, w, errcode.Errors{errcode.ErrorCodeUnauthorized.WithDetail(accessRecords)})
 		default:
 			// This condition is a potential security problem either in
 			// the configuration or whatever is backing the access
@@ -787,18 +1629,72 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 // correct actor and source.
 func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listener {
 	actor := notifications.ActorRecord{
-		Name: getUserName(ctx, r),
+		Name:          getUserName(ctx, r),
+		Issuer:        ctxu.GetStringValue(ctx, auth.UserIssuerKey),
+		Authenticated: ctxu.GetStringValue(ctx, auth.UserNameKey) != "",
+	}
+
+	if claims, ok := ctx.Value(auth.UserClaimsKey).(map[string]interface{}); ok {
+		for _, name := range app.Config.Notifications.ActorClaims {
+			if claim, ok := claims[name]; ok {
+				if actor.Claims == nil {
+					actor.Claims = make(map[string]interface{})
+				}
+				actor.Claims[name] = claim
+			}
+		}
 	}
 	request := notifications.NewRequestRecord(ctxu.GetRequestID(ctx), r)
 
-	return notifications.NewBridge(ctx.urlBuilder, app.events.source, actor, request, app.events.sink)
+	// Events are consumed away from the client, their URLs are absolute
+	// even if Location headers are relative.
+	return notifications.NewBridge(app.urlBuilderFor(r), app.events.source, actor, request, app.events.sink)
+}
+
+// proxyTagMoved notifies the move of a tag of the pull through cache, found
+// when revalidating the tag against the remote.
+func (app *App) proxyTagMoved(repo reference.Named, tag string, manifest distribution.Manifest) {
+	if err := app.maintenanceBridge().TagMoved(repo, tag, manifest); err != nil {
+		ctxu.GetLogger(app).Errorf("error dispatching tag move to listener: %v", err)
+	}
+}
+
+// isReadOnly returns true if the registry is in read-only maintenance mode.
+func (app *App) isReadOnly() bool {
+	app.readOnlyMu.RLock()
+	defer app.readOnlyMu.RUnlock()
+	return app.readOnly
+}
+
+// setReadOnly enables or disables read-only maintenance mode.
+func (app *App) setReadOnly(readOnly bool) {
+	app.readOnlyMu.Lock()
+	defer app.readOnlyMu.Unlock()
+	app.readOnly = readOnly
 }
 
 // nameRequired returns true if the route requires a name.
 func (app *App) nameRequired(r *http.Request) bool {
 	route := mux.CurrentRoute(r)
+	if route == nil {
+		return true
+	}
+
 	routeName := route.GetName()
-	return route == nil || (routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog)
+	if admin.IsAdminRoute(routeName) {
+		switch routeName {
+		case admin.RouteNameTag, admin.RouteNameSnapshot, admin.RouteNameRestore, admin.RouteNamePrewarm:
+			return true
+		}
+		return false
+	}
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog && routeName != v2.RouteNameExtensions && routeName != routeNameUIIndex
+}
+
+// isAdminRequest returns true if the request is routed to the admin API.
+func isAdminRequest(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	return route != nil && admin.IsAdminRoute(route.GetName())
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -853,7 +1749,7 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	route := mux.CurrentRoute(r)
 	routeName := route.GetName()
 
-	if routeName == v2.RouteNameCatalog {
+	if routeName == v2.RouteNameCatalog || routeName == routeNameUIIndex {
 		resource := auth.Resource{
 			Type: "registry",
 			Name: "catalog",
@@ -923,7 +1819,7 @@ func badPurgeUploadConfig(reason string) {
 
 // startUploadPurger schedules a goroutine which will periodically
 // check upload directories for old files and delete them
-func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log ctxu.Logger, config map[interface{}]interface{}) {
+func startUploadPurger(app *App, storageDriver storagedriver.StorageDriver, log ctxu.Logger, config map[interface{}]interface{}) {
 	if config["enabled"] == false {
 		return
 	}
@@ -971,6 +1867,7 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		badPurgeUploadConfig("dryrun missing")
 	}
 
+	leading := app.maintenanceJob("uploadpurging")
 	go func() {
 		rand.Seed(time.Now().Unix())
 		jitter := time.Duration(rand.Int()%60) * time.Minute
@@ -978,9 +1875,42 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		time.Sleep(jitter)
 
 		for {
-			storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+			if leading() {
+				storage.PurgeUploads(app, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+			}
 			log.Infof("Starting upload purge in %s", intervalDuration)
 			time.Sleep(intervalDuration)
 		}
 	}()
 }
+
+// startUploadSessionExpiry schedules a goroutine which will periodically
+// remove the upload sessions started longer than ttl ago, so that sessions
+// abandoned by their clients do not outlive it until upload purging. Touched
+// sessions are expired by the upload handlers.
+func startUploadSessionExpiry(app *App, storageDriver storagedriver.StorageDriver, log ctxu.Logger, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	interval := ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	leading := app.maintenanceJob("uploadsessionexpiry")
+	go func() {
+		for {
+			time.Sleep(interval)
+			if leading() {
+				expireUploadSessions(app, storageDriver, ttl)
+			}
+		}
+	}()
+}
+
+// expireUploadSessions removes the upload sessions started longer than ttl
+// ago.
+func expireUploadSessions(ctx context.Context, storageDriver storagedriver.StorageDriver, ttl time.Duration) {
+	storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-ttl), true)
+}
@@ -37,7 +37,7 @@ func blobDispatcher(ctx *Context, r *http.Request) http.Handler {
 		"HEAD": http.HandlerFunc(blobHandler.GetBlob),
 	}
 
-	if !ctx.readOnly {
+	if !ctx.isReadOnly() {
 		mhandler["DELETE"] = http.HandlerFunc(blobHandler.DeleteBlob)
 	}
 
@@ -55,6 +55,7 @@ type blobHandler struct {
 // response.
 func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("GetBlob")
+	blobMetrics.Request(r.Header.Get("Range") != "")
 	blobs := bh.Repository.Blobs(bh)
 	desc, err := blobs.Stat(bh, bh.Digest)
 	if err != nil {
@@ -66,6 +67,15 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defer bh.logBlobAccess(r, desc)
+	if rc := bh.App.recompressor; rc != nil && r.Method == "GET" {
+		rc.pulled(bh.Repository.Named().Name(), desc.Digest)
+	}
+
+	if bh.App.tiering != nil && r.Method == "GET" && !bh.recallBlob(w, desc.Digest) {
+		return
+	}
+
 	if err := blobs.ServeBlob(bh, w, r, desc.Digest); err != nil {
 		context.GetLogger(bh).Debugf("unexpected error getting blob HTTP handler: %v", err)
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
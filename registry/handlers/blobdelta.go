@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+const (
+	// defaultDeltaMaxSize is the size of the largest blob deltas are
+	// computed from or to unless another size is configured.
+	defaultDeltaMaxSize = 1 << 30
+
+	// deltaMediaType is the media type of blob deltas.
+	deltaMediaType = "application/vnd.docker.distribution.blob.delta.v1"
+)
+
+// blobDeltaDispatcher uses the request context to build a blobDeltaHandler.
+func blobDeltaDispatcher(ctx *Context, r *http.Request) http.Handler {
+	if !ctx.App.Config.HTTP.Deltas.Enabled {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail("blob deltas are not enabled"))
+		})
+	}
+
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	from, err := digest.ParseDigest(r.FormValue("from"))
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(fmt.Sprintf("invalid from digest: %v", err)))
+		})
+	}
+
+	blobDeltaHandler := &blobDeltaHandler{
+		Context: ctx,
+		Digest:  dgst,
+		From:    from,
+		Store:   storage.NewDeltaStore(ctx.App.driverFor(ctx.Repository.Named().Name()), ctx.Repository.Named()),
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(blobDeltaHandler.GetBlobDelta),
+		"HEAD": http.HandlerFunc(blobDeltaHandler.GetBlobDelta),
+	}
+}
+
+// blobDeltaHandler serves the deltas between the blobs of a repository.
+type blobDeltaHandler struct {
+	*Context
+
+	Digest digest.Digest
+	From   digest.Digest
+	Store  *storage.DeltaStore
+}
+
+// GetBlobDelta returns the delta rebuilding the blob from the blob given by
+// the "from" parameter, computing it if it is not stored yet.
+func (dh *blobDeltaHandler) GetBlobDelta(w http.ResponseWriter, r *http.Request) {
+	context.GetLogger(dh).Debug("GetBlobDelta")
+	blobs := dh.Repository.Blobs(dh)
+
+	maxSize := dh.App.Config.HTTP.Deltas.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultDeltaMaxSize
+	}
+	for _, dgst := range []digest.Digest{dh.Digest, dh.From} {
+		desc, err := blobs.Stat(dh, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				dh.Errors = append(dh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(dgst))
+			} else {
+				dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		if desc.Size > maxSize {
+			dh.Errors = append(dh.Errors, v2.ErrorCodeBlobDeltaUnavailable.WithDetail(fmt.Sprintf("blob %s is larger than %d bytes", dgst, maxSize)))
+			return
+		}
+	}
+
+	size, err := dh.Store.Stat(dh, dh.From, dh.Digest)
+	if err == storage.ErrDeltaUnknown {
+		if dh.isReadOnly() {
+			dh.Errors = append(dh.Errors, v2.ErrorCodeBlobDeltaUnavailable.WithDetail("deltas are not computed in read-only mode"))
+			return
+		}
+		size, err = dh.App.deltas.do(dh.Repository.Named().Name()+"@"+dh.From.String()+"@"+dh.Digest.String(), func() (int64, error) {
+			return dh.computeDelta(blobs)
+		})
+	}
+	if err != nil {
+		dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", deltaMediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	w.Header().Set("Docker-Delta-Source", dh.From.String())
+	w.Header().Set("Docker-Content-Digest", dh.Digest.String())
+
+	if r.Method == "HEAD" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rc, err := dh.Store.Open(dh, dh.From, dh.Digest)
+	if err != nil {
+		dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	defer rc.Close()
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.CopyN(w, rc, size); err != nil {
+		// The response has started, so the error can only be logged.
+		context.GetLogger(dh).Errorf("error copying delta of %s from %s: %v", dh.Digest, dh.From, err)
+	}
+}
+
+// computeDelta computes and stores the delta, returning its size.
+func (dh *blobDeltaHandler) computeDelta(blobs distribution.BlobStore) (int64, error) {
+	source, err := blobs.Open(dh, dh.From)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	target, err := blobs.Open(dh, dh.Digest)
+	if err != nil {
+		return 0, err
+	}
+	defer target.Close()
+
+	size, err := dh.Store.Put(dh, dh.From, dh.Digest, source, target)
+	if err != nil {
+		return 0, err
+	}
+	context.GetLogger(dh).Infof("computed delta of %s from %s: %d bytes", dh.Digest, dh.From, size)
+	return size, nil
+}
+
+// deltaComputations shares the computation of a delta between the requests
+// for it received while it is computed.
+type deltaComputations struct {
+	mu       sync.Mutex
+	inflight map[string]*deltaComputation
+}
+
+type deltaComputation struct {
+	done chan struct{}
+	size int64
+	err  error
+}
+
+// do runs fn unless a computation of the same key is in flight, in which
+// case its result is awaited instead.
+func (dc *deltaComputations) do(key string, fn func() (int64, error)) (int64, error) {
+	dc.mu.Lock()
+	if c, ok := dc.inflight[key]; ok {
+		dc.mu.Unlock()
+		<-c.done
+		return c.size, c.err
+	}
+	if dc.inflight == nil {
+		dc.inflight = make(map[string]*deltaComputation)
+	}
+	c := &deltaComputation{done: make(chan struct{})}
+	dc.inflight[key] = c
+	dc.mu.Unlock()
+
+	c.size, c.err = fn()
+	close(c.done)
+
+	dc.mu.Lock()
+	delete(dc.inflight, key)
+	dc.mu.Unlock()
+
+	return c.size, c.err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage/delta"
+)
+
+// TestBlobDelta checks that a blob is rebuilt from another blob of the
+// repository and the delta served between them.
+func TestBlobDelta(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Deltas.Enabled = true
+	config.HTTP.Deltas.MaxSize = 1 << 20
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	r := rand.New(rand.NewSource(1))
+	source := make([]byte, 256<<10)
+	r.Read(source)
+	target := append(append([]byte("a new file"), source[:128<<10]...), source[129<<10:]...)
+	large := make([]byte, 1<<20+1)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	blobs := map[digest.Digest][]byte{}
+	for _, blob := range [][]byte{source, target, large} {
+		dgst := digest.FromBytes(blob)
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(blob))
+		blobs[dgst] = blob
+	}
+	sourceDigest, targetDigest := digest.FromBytes(source), digest.FromBytes(target)
+
+	deltaURL := func(dgst, from digest.Digest) string {
+		ref, _ := reference.WithDigest(imageName, dgst)
+		u, err := env.builder.BuildBlobDeltaURL(ref, from)
+		checkErr(t, err, "building blob delta url")
+		return u
+	}
+
+	resp, err := http.Get(deltaURL(targetDigest, sourceDigest))
+	checkErr(t, err, "fetching blob delta")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blob delta", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{deltaMediaType},
+		"Docker-Delta-Source":   []string{sourceDigest.String()},
+		"Docker-Content-Digest": []string{targetDigest.String()},
+	})
+
+	p, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading blob delta")
+	if len(p) > 16<<10 {
+		t.Fatalf("delta too large: %d bytes", len(p))
+	}
+	var rebuilt bytes.Buffer
+	if err := delta.Apply(&rebuilt, bytes.NewReader(source), bytes.NewReader(p)); err != nil {
+		t.Fatalf("error applying delta: %v", err)
+	}
+	if digest.FromBytes(rebuilt.Bytes()) != targetDigest {
+		t.Fatalf("rebuilt blob differs from target")
+	}
+
+	// the stored delta is served again
+	resp, err = http.Head(deltaURL(targetDigest, sourceDigest))
+	checkErr(t, err, "fetching stored blob delta")
+	resp.Body.Close()
+	checkResponse(t, "fetching stored blob delta", resp, http.StatusOK)
+	if resp.ContentLength != int64(len(p)) {
+		t.Fatalf("unexpected length of stored delta: %d != %d", resp.ContentLength, len(p))
+	}
+
+	unknown := digest.FromBytes([]byte("unknown"))
+	for _, test := range []struct {
+		name      string
+		url       string
+		status    int
+		errorCode errcode.ErrorCode
+	}{
+		{"unknown source", deltaURL(targetDigest, unknown), http.StatusNotFound, v2.ErrorCodeBlobUnknown},
+		{"unknown target", deltaURL(unknown, sourceDigest), http.StatusNotFound, v2.ErrorCodeBlobUnknown},
+		{"large blob", deltaURL(digest.FromBytes(large), sourceDigest), http.StatusNotFound, v2.ErrorCodeBlobDeltaUnavailable},
+		{"invalid source", deltaURL(targetDigest, "sha256:invalid"), http.StatusBadRequest, v2.ErrorCodeDigestInvalid},
+	} {
+		resp, err := http.Get(test.url)
+		checkErr(t, err, test.name)
+		checkResponse(t, test.name, resp, test.status)
+		checkBodyHasErrorCodes(t, test.name, resp, test.errorCode)
+		resp.Body.Close()
+	}
+}
+
+func TestBlobDeltaDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	ref, _ := reference.WithDigest(imageName, digest.FromBytes([]byte("target")))
+	u, err := env.builder.BuildBlobDeltaURL(ref, digest.FromBytes([]byte("source")))
+	checkErr(t, err, "building blob delta url")
+
+	resp, err := http.Get(u)
+	checkErr(t, err, "fetching blob delta")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blob delta", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "fetching blob delta", resp, errcode.ErrorCodeUnsupported)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// defaultLayerIndexMaxSize is the size of the largest layer indexed unless
+// another size is configured.
+const defaultLayerIndexMaxSize = 1 << 30
+
+// blobFilesDispatcher uses the request context to build a blobFilesHandler.
+func blobFilesDispatcher(ctx *Context, r *http.Request) http.Handler {
+	if !ctx.App.Config.HTTP.LayerIndex.Enabled {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail("layer indexes are not enabled"))
+		})
+	}
+
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	blobFilesHandler := &blobFilesHandler{
+		Context: ctx,
+		Digest:  dgst,
+		Store:   storage.NewLayerIndexStore(ctx.App.driverFor(ctx.Repository.Named().Name()), ctx.Repository.Named()),
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(blobFilesHandler.GetBlobFiles),
+	}
+}
+
+// blobFilesHandler serves the indexes of the files of the layers of a
+// repository.
+type blobFilesHandler struct {
+	*Context
+
+	Digest digest.Digest
+	Store  *storage.LayerIndexStore
+}
+
+// GetBlobFiles lists the files of a layer, indexing it if it is not indexed
+// yet. The files may be filtered by the "q" parameter.
+func (fh *blobFilesHandler) GetBlobFiles(w http.ResponseWriter, r *http.Request) {
+	context.GetLogger(fh).Debug("GetBlobFiles")
+	blobs := fh.Repository.Blobs(fh)
+
+	desc, err := blobs.Stat(fh, fh.Digest)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(fh.Digest))
+		} else {
+			fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	index, err := fh.Store.Get(fh, desc.Digest)
+	if err == storage.ErrLayerIndexUnknown {
+		if fh.isReadOnly() {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeBlobFilesUnknown.WithDetail("layers are not indexed in read-only mode"))
+			return
+		}
+		if maxSize := fh.App.layerIndexMaxSize(); desc.Size > maxSize {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeBlobFilesUnknown.WithDetail(fmt.Sprintf("blob %s is larger than %d bytes", desc.Digest, maxSize)))
+			return
+		}
+		if _, err = fh.App.indexLayer(fh, fh.Repository, desc.Digest); err == nil {
+			index, err = fh.Store.Get(fh, desc.Digest)
+		}
+	}
+	if err != nil {
+		if err == storage.ErrNotLayer {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeBlobFilesUnknown.WithDetail(err))
+		} else {
+			fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if q := r.FormValue("q"); q != "" {
+		files := []storage.LayerFile{}
+		for _, file := range index.Files {
+			if strings.Contains(file.Path, q) {
+				files = append(files, file)
+			}
+		}
+		index.Files = files
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(index); err != nil {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// layerIndexMaxSize returns the size of the largest layer indexed.
+func (app *App) layerIndexMaxSize() int64 {
+	if maxSize := app.Config.HTTP.LayerIndex.MaxSize; maxSize != 0 {
+		return maxSize
+	}
+	return defaultLayerIndexMaxSize
+}
+
+// indexLayer indexes and stores the files of the layer dgst of the
+// repository, sharing the indexing with the requests for it received
+// meanwhile, and returns the number of files of the layer.
+func (app *App) indexLayer(ctx context.Context, repository distribution.Repository, dgst digest.Digest) (int, error) {
+	name := repository.Named().Name()
+	store := storage.NewLayerIndexStore(app.driverFor(name), repository.Named())
+
+	count, err := app.layerIndexes.do(name+"@"+dgst.String(), func() (int64, error) {
+		rc, err := repository.Blobs(ctx).Open(ctx, dgst)
+		if err != nil {
+			return 0, err
+		}
+		defer rc.Close()
+
+		index, err := store.Put(ctx, dgst, rc)
+		if err != nil {
+			return 0, err
+		}
+		context.GetLogger(ctx).Infof("indexed layer %s: %d files", dgst, len(index.Files))
+		return int64(len(index.Files)), nil
+	})
+	return int(count), err
+}
+
+// indexPushedLayer indexes the files of a blob just pushed in the background,
+// unless it is too large. Blobs which are not layers are left unindexed.
+func (buh *blobUploadHandler) indexPushedLayer(desc distribution.Descriptor) {
+	if desc.Size > buh.App.layerIndexMaxSize() {
+		return
+	}
+
+	ctx := detachedContext(buh.App, buh)
+	repository := buh.Repository
+
+	go func() {
+		if _, err := buh.App.indexLayer(ctx, repository, desc.Digest); err != nil && err != storage.ErrNotLayer {
+			context.GetLogger(ctx).Errorf("error indexing layer %s: %v", desc.Digest, err)
+		}
+	}()
+}
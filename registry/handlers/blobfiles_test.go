@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+)
+
+// TestBlobFiles checks that the files of a layer are indexed once pushed, and
+// listed without the layer being downloaded.
+func TestBlobFiles(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.LayerIndex.Enabled = true
+	config.HTTP.LayerIndex.OnPush = true
+	config.HTTP.LayerIndex.MaxSize = 1 << 20
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"etc/passwd", "etc/group", "bin/sh"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+		tw.Write([]byte("root\n"))
+	}
+	tw.Close()
+	gz.Close()
+	layer := buf.Bytes()
+	layerDigest := digest.FromBytes(layer)
+	config1 := []byte(`{"architecture":"amd64","os":"linux"}`)
+	large := make([]byte, 1<<20+1)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	for _, blob := range [][]byte{layer, config1, large} {
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, digest.FromBytes(blob), uploadURLBase, bytes.NewReader(blob))
+	}
+
+	// The layer is indexed in the background once pushed.
+	store := storage.NewLayerIndexStore(env.app.driver, imageName)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := store.Get(env.ctx, layerDigest); err == nil {
+			break
+		} else if err != storage.ErrLayerIndexUnknown || time.Now().After(deadline) {
+			t.Fatalf("expected the layer to be indexed once pushed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	filesURL := func(dgst digest.Digest, query string) string {
+		ref, _ := reference.WithDigest(imageName, dgst)
+		u, err := env.builder.BuildBlobFilesURL(ref, query)
+		checkErr(t, err, "building blob files url")
+		return u
+	}
+
+	for query, expected := range map[string][]string{
+		"":    {"etc/passwd", "etc/group", "bin/sh"},
+		"etc": {"etc/passwd", "etc/group"},
+		"usr": {},
+	} {
+		resp, err := http.Get(filesURL(layerDigest, query))
+		checkErr(t, err, "listing layer files")
+		defer resp.Body.Close()
+		checkResponse(t, "listing layer files", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Type":          []string{"application/json; charset=utf-8"},
+			"Docker-Content-Digest": []string{layerDigest.String()},
+		})
+
+		var index storage.LayerIndex
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding layer files: %v", err)
+		}
+		if index.Digest != layerDigest || len(index.Files) != len(expected) {
+			t.Fatalf("unexpected files of layer for %q: %+v", query, index)
+		}
+		for i, file := range index.Files {
+			if file.Path != expected[i] || file.Type != "file" || file.Size != 5 {
+				t.Fatalf("unexpected file %d for %q: %+v", i, query, file)
+			}
+		}
+	}
+
+	// Blobs which are not layers, or too large, are not indexed.
+	for _, dgst := range []digest.Digest{digest.FromBytes(config1), digest.FromBytes(large)} {
+		resp, err := http.Get(filesURL(dgst, ""))
+		checkErr(t, err, "listing blob files")
+		defer resp.Body.Close()
+		checkResponse(t, "listing blob files", resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, "listing blob files", resp, v2.ErrorCodeBlobFilesUnknown)
+	}
+
+	resp, err := http.Get(filesURL(digest.FromBytes([]byte("unknown")), ""))
+	checkErr(t, err, "listing unknown blob files")
+	defer resp.Body.Close()
+	checkResponse(t, "listing unknown blob files", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "listing unknown blob files", resp, v2.ErrorCodeBlobUnknown)
+
+	// Layers indexed before are indexed on their first request.
+	otherName, _ := reference.ParseNamed("foo/other")
+	uploadURLBase, _ := startPushLayer(t, env.builder, otherName)
+	config.HTTP.LayerIndex.OnPush = false
+	pushLayer(t, env.builder, otherName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+	ref, _ := reference.WithDigest(otherName, layerDigest)
+	u, err := env.builder.BuildBlobFilesURL(ref, "sh")
+	checkErr(t, err, "building blob files url")
+	resp, err = http.Get(u)
+	checkErr(t, err, "listing layer files on request")
+	defer resp.Body.Close()
+	checkResponse(t, "listing layer files on request", resp, http.StatusOK)
+	var index storage.LayerIndex
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil || len(index.Files) != 1 || index.Files[0].Path != "bin/sh" {
+		t.Fatalf("unexpected files of layer: %+v, %v", index, err)
+	}
+}
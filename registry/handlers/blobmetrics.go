@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// BlobMetrics holds counters related to blob reads, including the partial
+// reads made by lazy-pulling clients and the reads of zstd variants.
+type BlobMetrics struct {
+	Requests          uint64
+	RangeRequests     uint64
+	TOCRequests       uint64
+	TOCHits           uint64
+	TOCMisses         uint64
+	TOCBytes          uint64
+	VariantRequests   uint64
+	VariantBytesSaved uint64
+}
+
+type blobMetricsCollector struct {
+	metrics BlobMetrics
+}
+
+// Request tracks a blob fetch, noting whether a byte range was requested.
+func (bmc *blobMetricsCollector) Request(ranged bool) {
+	atomic.AddUint64(&bmc.metrics.Requests, 1)
+	if ranged {
+		atomic.AddUint64(&bmc.metrics.RangeRequests, 1)
+	}
+}
+
+// TOCHit tracks a table of contents request served from an eStargz blob.
+func (bmc *blobMetricsCollector) TOCHit(bytes uint64) {
+	atomic.AddUint64(&bmc.metrics.TOCRequests, 1)
+	atomic.AddUint64(&bmc.metrics.TOCHits, 1)
+	atomic.AddUint64(&bmc.metrics.TOCBytes, bytes)
+}
+
+// TOCMiss tracks a table of contents request for a blob without one.
+func (bmc *blobMetricsCollector) TOCMiss() {
+	atomic.AddUint64(&bmc.metrics.TOCRequests, 1)
+	atomic.AddUint64(&bmc.metrics.TOCMisses, 1)
+}
+
+// Variant tracks a blob read served from its zstd variant, saved being the
+// difference between the sizes of the blob and the variant.
+func (bmc *blobMetricsCollector) Variant(saved int64) {
+	atomic.AddUint64(&bmc.metrics.VariantRequests, 1)
+	if saved > 0 {
+		atomic.AddUint64(&bmc.metrics.VariantBytesSaved, uint64(saved))
+	}
+}
+
+// Snapshot returns a consistent copy of the counters.
+func (bmc *blobMetricsCollector) Snapshot() BlobMetrics {
+	return BlobMetrics{
+		Requests:          atomic.LoadUint64(&bmc.metrics.Requests),
+		RangeRequests:     atomic.LoadUint64(&bmc.metrics.RangeRequests),
+		TOCRequests:       atomic.LoadUint64(&bmc.metrics.TOCRequests),
+		TOCHits:           atomic.LoadUint64(&bmc.metrics.TOCHits),
+		TOCMisses:         atomic.LoadUint64(&bmc.metrics.TOCMisses),
+		TOCBytes:          atomic.LoadUint64(&bmc.metrics.TOCBytes),
+		VariantRequests:   atomic.LoadUint64(&bmc.metrics.VariantRequests),
+		VariantBytesSaved: atomic.LoadUint64(&bmc.metrics.VariantBytesSaved),
+	}
+}
+
+// blobMetrics tracks metrics about blob reads. This is kept globally and made
+// available via expvar.
+var blobMetrics = &blobMetricsCollector{}
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("blobs", expvar.Func(func() interface{} {
+		return blobMetrics.Snapshot()
+	}))
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage/estargz"
+	"github.com/gorilla/handlers"
+)
+
+// blobTOCDispatcher uses the request context to build a blobTOCHandler.
+func blobTOCDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	blobTOCHandler := &blobTOCHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(blobTOCHandler.GetBlobTOC),
+		"HEAD": http.HandlerFunc(blobTOCHandler.GetBlobTOC),
+	}
+}
+
+// blobTOCHandler serves the table of contents of eStargz blobs.
+type blobTOCHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetBlobTOC locates the table of contents section of an eStargz blob and
+// returns it as stored, along with its offset in the blob.
+func (th *blobTOCHandler) GetBlobTOC(w http.ResponseWriter, r *http.Request) {
+	context.GetLogger(th).Debug("GetBlobTOC")
+	blobs := th.Repository.Blobs(th)
+	desc, err := blobs.Stat(th, th.Digest)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			th.Errors = append(th.Errors, v2.ErrorCodeBlobUnknown.WithDetail(th.Digest))
+		} else {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	rsc, err := blobs.Open(th, desc.Digest)
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	defer rsc.Close()
+
+	offset, length, err := estargz.TOCRange(rsc, desc.Size)
+	if err != nil {
+		if err == estargz.ErrNotEStargz {
+			blobMetrics.TOCMiss()
+			th.Errors = append(th.Errors, v2.ErrorCodeBlobTOCUnknown.WithDetail(th.Digest))
+		} else {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if _, err := rsc.Seek(offset, os.SEEK_SET); err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(length))
+	w.Header().Set("Docker-TOC-Offset", fmt.Sprint(offset))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == "HEAD" {
+		blobMetrics.TOCHit(0)
+		return
+	}
+
+	n, err := io.CopyN(w, rsc, length)
+	blobMetrics.TOCHit(uint64(n))
+	if err != nil {
+		// The response has started, so the error can only be logged.
+		context.GetLogger(th).Errorf("error copying table of contents of %s: %v", desc.Digest, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/docker/distribution"
 	ctxu "github.com/docker/distribution/context"
@@ -14,11 +15,29 @@ import (
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
+	"golang.org/x/net/context"
 )
 
+// defaultUploadDeduplicationRepositories is the number of repositories
+// searched for a blob to mount in place of an upload, if not configured.
+const defaultUploadDeduplicationRepositories = 1000
+
 // blobUploadDispatcher constructs and returns the blob upload handler for the
 // given request context.
 func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
+	// Storage operations of an upload are aborted if the client disconnects,
+	// rather than writing data which will never be committed. The context is
+	// released once the request is served either way.
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithCancel(ctx.Context)
+	handler := cancelOnClientClose(dispatchBlobUpload(ctx, r), cancel)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer cancel()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func dispatchBlobUpload(ctx *Context, r *http.Request) http.Handler {
 	buh := &blobUploadHandler{
 		Context: ctx,
 		UUID:    getUploadUUID(ctx),
@@ -29,7 +48,7 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 		"HEAD": http.HandlerFunc(buh.GetUploadStatus),
 	}
 
-	if !ctx.readOnly {
+	if !ctx.isReadOnly() {
 		handler["POST"] = http.HandlerFunc(buh.StartBlobUpload)
 		handler["PATCH"] = http.HandlerFunc(buh.PatchBlobData)
 		handler["PUT"] = http.HandlerFunc(buh.PutBlobUploadComplete)
@@ -76,6 +95,14 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 		}
 		buh.Upload = upload
 
+		if ttl := ctx.Config.HTTP.UploadSessionTTL; ttl > 0 && r.Method != "DELETE" && time.Since(upload.StartedAt()) > ttl {
+			ctxu.GetLogger(ctx).Infof("upload %s started at %v expired", buh.UUID, upload.StartedAt())
+			buh.expireUpload()
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				buh.Errors = append(buh.Errors, v2.ErrorCodeSessionExpired)
+			})
+		}
+
 		if state.Offset > 0 {
 			// Seek the blob upload to the correct spot if it's non-zero.
 			// These error conditions should be rare and demonstrate really
@@ -125,11 +152,29 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 	fromRepo := r.FormValue("from")
 	mountDigest := r.FormValue("mount")
 
+	if err := buh.App.checkResidency(buh.Repository.Named().Name()); err != nil {
+		residencyDenied(buh.Context, err)
+		return
+	}
+
 	if mountDigest != "" && fromRepo != "" {
+		if err := buh.App.checkMountResidency(fromRepo, buh.Repository.Named().Name()); err != nil {
+			residencyDenied(buh.Context, err)
+			return
+		}
+
 		opt, err := buh.createBlobMountOption(fromRepo, mountDigest)
 		if opt != nil && err == nil {
 			options = append(options, opt)
 		}
+	} else if buh.Config.HTTP.UploadDeduplication.Enabled && !buh.App.isCache {
+		// A monolithic upload names the digest of its content, which may
+		// already be stored in another repository.
+		if dgst, err := digest.ParseDigest(r.FormValue("digest")); err == nil {
+			if opt := buh.deduplicationMountOption(dgst); opt != nil {
+				options = append(options, opt)
+			}
+		}
 	}
 
 	blobs := buh.Repository.Blobs(buh)
@@ -167,10 +212,10 @@ func (buh *blobUploadHandler) GetUploadStatus(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// TODO(dmcgowan): Set last argument to false in blobUploadResponse when
-	// resumable upload is supported. This will enable returning a non-zero
-	// range for clients to begin uploading at an offset.
-	if err := buh.blobUploadResponse(w, r, true); err != nil {
+	// Report the current offset, as documented in the specification, so that
+	// clients resume the upload after the last chunk received from the
+	// returned location, whose state carries the offset.
+	if err := buh.blobUploadResponse(w, r, false); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
@@ -276,6 +321,10 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
+
+	if config := buh.App.Config.HTTP.LayerIndex; config.Enabled && config.OnPush {
+		buh.indexPushedLayer(desc)
+	}
 }
 
 // CancelBlobUpload cancels an in-progress upload of a blob.
@@ -294,6 +343,20 @@ func (buh *blobUploadHandler) CancelBlobUpload(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// expireUpload removes the staged data of an expired upload in the
+// background. It is not tied to the request, so cleanup proceeds if the
+// client disconnects.
+func (buh *blobUploadHandler) expireUpload() {
+	upload := buh.Upload
+	ctx := detachedContext(buh.App, buh)
+
+	go func() {
+		if err := upload.Cancel(ctx); err != nil {
+			ctxu.GetLogger(ctx).Errorf("error removing expired upload %s: %v", upload.ID(), err)
+		}
+	}()
+}
+
 // blobUploadResponse provides a standard request for uploading blobs and
 // chunk responses. This sets the correct headers but the response status is
 // left to the caller. The fresh argument is used to ensure that new blob
@@ -368,6 +431,69 @@ func (buh *blobUploadHandler) createBlobMountOption(fromRepo, mountDigest string
 	return storage.WithMountFrom(canonical), nil
 }
 
+// deduplicationMountOption searches the repositories sharing the storage of
+// the upload for one holding the blob of the digest, which the client may pull
+// and whose content may be stored in the region of the upload, and returns the
+// option mounting the blob from it. It returns nil if no such repository is
+// found among the first repositories listed.
+func (buh *blobUploadHandler) deduplicationMountOption(dgst digest.Digest) distribution.BlobCreateOption {
+	name := buh.Repository.Named().Name()
+	ns := buh.App.namespaceStorageFor(name)
+
+	// Most uploads are of new content: check the blob is stored at all
+	// before searching the repositories.
+	registry := buh.App.storageRegistry
+	if ns != nil {
+		registry = ns.registry
+	}
+	if _, err := storage.StatBlob(buh, buh.App.driverFor(name), registry, dgst); err != nil {
+		return nil
+	}
+
+	maxRepositories := buh.Config.HTTP.UploadDeduplication.MaxRepositories
+	if maxRepositories <= 0 {
+		maxRepositories = defaultUploadDeduplicationRepositories
+	}
+	names, _, err := listRepositories(buh, buh.App.registry, maxRepositories, "", func(candidate string) bool {
+		return candidate != name && buh.App.namespaceStorageFor(candidate) == ns
+	})
+	if err != nil {
+		ctxu.GetLogger(buh).Errorf("error listing repositories to deduplicate upload of %s: %v", dgst, err)
+		return nil
+	}
+
+	for _, candidate := range names {
+		if buh.App.checkMountResidency(candidate, name) != nil {
+			continue
+		}
+		if buh.App.accessController != nil {
+			if _, err := buh.App.accessController.Authorized(buh.Context.Context, appendAccessRecords(nil, "GET", candidate)...); err != nil {
+				continue
+			}
+		}
+
+		named, err := reference.ParseNamed(candidate)
+		if err != nil {
+			continue
+		}
+		repository, err := buh.App.registry.Repository(buh, named)
+		if err != nil {
+			continue
+		}
+		if _, err := repository.Blobs(buh).Stat(buh, dgst); err != nil {
+			continue
+		}
+
+		canonical, err := reference.WithDigest(named, dgst)
+		if err != nil {
+			return nil
+		}
+		ctxu.GetLogger(buh).Infof("deduplicating upload of %s to %s by mounting it from %s", dgst, name, candidate)
+		return storage.WithMountFrom(canonical)
+	}
+	return nil
+}
+
 // writeBlobCreatedHeaders writes the standard headers describing a newly
 // created blob. A 201 Created is written as well as the canonical URL and
 // blob digest.
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/auth"
+)
+
+// denyPrefixAccessController denies access to the repositories whose name
+// starts with a prefix.
+type denyPrefixAccessController string
+
+func (ac denyPrefixAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	for _, a := range access {
+		if strings.HasPrefix(a.Name, string(ac)) {
+			return nil, errors.New("access denied")
+		}
+	}
+	return ctx, nil
+}
+
+// TestUploadDeduplication checks that a monolithic upload of a blob stored in
+// another repository the client may pull from is mounted from it.
+func TestUploadDeduplication(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UploadDeduplication.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	push := func(name, content string) digest.Digest {
+		named, _ := reference.ParseNamed(name)
+		dgst := digest.FromBytes([]byte(content))
+		uploadURLBase, _ := startPushLayer(t, env.builder, named)
+		pushLayer(t, env.builder, named, dgst, uploadURLBase, bytes.NewReader([]byte(content)))
+		return dgst
+	}
+	public := push("library/base", "public layer")
+	private := push("private/app", "private layer")
+
+	env.app.accessController = denyPrefixAccessController("private/")
+
+	named, _ := reference.ParseNamed("foo/app")
+	post := func(dgst digest.Digest) *http.Response {
+		u, err := env.builder.BuildBlobUploadURL(named, url.Values{"digest": {dgst.String()}})
+		checkErr(t, err, "building upload url")
+		resp, err := http.Post(u, "application/octet-stream", nil)
+		checkErr(t, err, "starting upload")
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post(public)
+	checkResponse(t, "starting upload of stored blob", resp, http.StatusCreated)
+	ref, _ := reference.WithDigest(named, public)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building blob url")
+	checkHeaders(t, resp, http.Header{
+		"Location":              []string{blobURL},
+		"Docker-Content-Digest": []string{public.String()},
+	})
+
+	resp, err = http.Head(blobURL)
+	checkErr(t, err, "checking mounted blob")
+	checkResponse(t, "checking mounted blob", resp, http.StatusOK)
+
+	// Blobs of repositories the client may not pull from, and unknown
+	// blobs, are uploaded.
+	resp = post(private)
+	checkResponse(t, "starting upload of blob of denied repository", resp, http.StatusAccepted)
+	resp = post(digest.FromBytes([]byte("new layer")))
+	checkResponse(t, "starting upload of unknown blob", resp, http.StatusAccepted)
+
+	env.app.Config.HTTP.UploadDeduplication.Enabled = false
+	named, _ = reference.ParseNamed("bar/app")
+	resp = post(public)
+	checkResponse(t, "starting upload with deduplication disabled", resp, http.StatusAccepted)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// DefaultBuildGroupAnnotation is the manifest annotation naming the build
+// group of an image unless another is configured.
+const DefaultBuildGroupAnnotation = "build-group"
+
+// buildGroupAttempts is the number of times a manifest list is updated when
+// other registry instances update it concurrently.
+const buildGroupAttempts = 3
+
+// buildGroupAnnotation returns the annotation naming the build group of image
+// manifests, or an empty string if build groups are not enabled.
+func (app *App) buildGroupAnnotation() string {
+	config := app.Config.HTTP.BuildGroups
+	if !config.Enabled {
+		return ""
+	}
+	if config.Annotation == "" {
+		return DefaultBuildGroupAnnotation
+	}
+	return config.Annotation
+}
+
+// assembleBuildGroup adds the image manifest described by desc to the
+// manifest list tagged with the name of its build group, replacing the
+// manifest of the same platform, and creating the list if the tag does not
+// exist. The digest of the list is returned, or an empty digest if the
+// manifest is not part of a build group. Errors are added to the context and
+// reported by returning false.
+func (imh *imageManifestHandler) assembleBuildGroup(manifest distribution.Manifest, desc distribution.Descriptor) (digest.Digest, bool) {
+	annotation := imh.App.buildGroupAnnotation()
+	m, ok := manifest.(*schema2.DeserializedManifest)
+	if annotation == "" || !ok {
+		return "", true
+	}
+
+	annotations, err := m.Annotations()
+	if err != nil {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return "", false
+	}
+	group := annotations[annotation]
+	if group == "" {
+		return "", true
+	}
+	if _, err := reference.WithTag(imh.Repository.Named(), group); err != nil {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(fmt.Sprintf("build group %q is not a valid tag", group)))
+		return "", false
+	}
+
+	platform, err := imh.imagePlatform(m.Config.Digest)
+	if err != nil {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		return "", false
+	}
+
+	entry := manifestlist.ManifestDescriptor{
+		Descriptor: distribution.Descriptor{
+			MediaType: desc.MediaType,
+			Size:      desc.Size,
+			Digest:    desc.Digest,
+		},
+		Platform: platform,
+	}
+
+	// Lists are updated one at a time by this instance. Updates by other
+	// instances are detected once the list is tagged, and retried.
+	imh.App.buildGroupMu.Lock()
+	defer imh.App.buildGroupMu.Unlock()
+
+	for attempt := 0; attempt < buildGroupAttempts; attempt++ {
+		dgst, err := imh.updateBuildGroup(group, entry)
+		if err != nil {
+			if err, ok := err.(errcode.Error); ok {
+				imh.Errors = append(imh.Errors, err)
+			} else {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return "", false
+		}
+
+		current, err := imh.Repository.Tags(imh).Get(imh, group)
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return "", false
+		}
+		if current.Digest == dgst {
+			ctxu.GetLogger(imh).Infof("added %s (%s/%s) to build group %s: %s", desc.Digest, platform.OS, platform.Architecture, group, dgst)
+			return dgst, true
+		}
+	}
+
+	imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(fmt.Sprintf("build group %s is being updated concurrently", group)))
+	return "", false
+}
+
+// updateBuildGroup puts the manifest list tagged group with entry added to
+// it, and tags it, returning its digest. Nothing is put if the list already
+// has the entry.
+func (imh *imageManifestHandler) updateBuildGroup(group string, entry manifestlist.ManifestDescriptor) (digest.Digest, error) {
+	manifests, err := imh.Repository.Manifests(imh)
+	if err != nil {
+		return "", err
+	}
+	tags := imh.Repository.Tags(imh)
+
+	var entries []manifestlist.ManifestDescriptor
+	current, err := tags.Get(imh, group)
+	switch err.(type) {
+	case nil:
+		manifest, err := manifests.Get(imh, current.Digest)
+		if err != nil {
+			return "", err
+		}
+		list, ok := manifest.(*manifestlist.DeserializedManifestList)
+		if !ok {
+			return "", v2.ErrorCodeManifestInvalid.WithDetail(fmt.Sprintf("tag %s of build group is not a manifest list", group))
+		}
+
+		for _, m := range list.Manifests {
+			if samePlatform(m.Platform, entry.Platform) {
+				if m.Digest == entry.Digest {
+					return current.Digest, nil
+				}
+				continue
+			}
+			entries = append(entries, m)
+		}
+	case distribution.ErrTagUnknown:
+	default:
+		return "", err
+	}
+
+	entries = append(entries, entry)
+	sort.Sort(byPlatform(entries))
+
+	list, err := manifestlist.FromDescriptors(entries)
+	if err != nil {
+		return "", err
+	}
+	dgst, err := manifests.Put(imh, list)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tags.Tag(imh, group, distribution.Descriptor{Digest: dgst, MediaType: manifestlist.MediaTypeManifestList}); err != nil {
+		return "", err
+	}
+	return dgst, nil
+}
+
+// imagePlatform returns the platform of an image, read from its
+// configuration.
+func (imh *imageManifestHandler) imagePlatform(config digest.Digest) (manifestlist.PlatformSpec, error) {
+	var platform manifestlist.PlatformSpec
+
+	content, err := imh.Repository.Blobs(imh).Get(imh, config)
+	if err != nil {
+		return platform, fmt.Errorf("error reading image configuration %s: %v", config, err)
+	}
+	if err := json.Unmarshal(content, &platform); err != nil {
+		return platform, fmt.Errorf("invalid image configuration %s: %v", config, err)
+	}
+	if platform.Architecture == "" || platform.OS == "" {
+		return platform, fmt.Errorf("image configuration %s has no architecture or os", config)
+	}
+
+	return platform, nil
+}
+
+// samePlatform returns true if images of platforms a and b cannot be told
+// apart by clients.
+func samePlatform(a, b manifestlist.PlatformSpec) bool {
+	return a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant
+}
+
+// byPlatform sorts the entries of a manifest list by platform, so that lists
+// of the same images have the same digest.
+type byPlatform []manifestlist.ManifestDescriptor
+
+func (a byPlatform) Len() int      { return len(a) }
+func (a byPlatform) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPlatform) Less(i, j int) bool {
+	pi, pj := a[i].Platform, a[j].Platform
+	if pi.OS != pj.OS {
+		return pi.OS < pj.OS
+	}
+	if pi.Architecture != pj.Architecture {
+		return pi.Architecture < pj.Architecture
+	}
+	return pi.Variant < pj.Variant
+}
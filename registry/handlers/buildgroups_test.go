@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestBuildGroups checks that the image manifests pushed with a build group
+// annotation are assembled into a manifest list tagged with the group.
+func TestBuildGroups(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.BuildGroups.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	layer, layerDigest, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+
+	push := func(tag, architecture, version string) (digest.Digest, digest.Digest) {
+		image := []byte(`{"architecture":"` + architecture + `","os":"linux","config":{"Labels":{"version":"` + version + `"}}}`)
+		imageDigest := digest.FromBytes(image)
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+
+		manifest := struct {
+			schema2.Manifest
+			Annotations map[string]string `json:"annotations"`
+		}{
+			Manifest: schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config: distribution.Descriptor{
+					Digest:    imageDigest,
+					Size:      int64(len(image)),
+					MediaType: schema2.MediaTypeConfig,
+				},
+				Layers: []distribution.Descriptor{
+					{
+						Digest:    layerDigest,
+						Size:      1,
+						MediaType: schema2.MediaTypeLayer,
+					},
+				},
+			},
+			Annotations: map[string]string{DefaultBuildGroupAnnotation: "latest"},
+		}
+
+		tagRef, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, manifest)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+		dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+		checkErr(t, err, "parsing manifest digest")
+		groupDigest, err := digest.ParseDigest(resp.Header.Get("Docker-Build-Group-Digest"))
+		checkErr(t, err, "parsing build group digest")
+		return dgst, groupDigest
+	}
+
+	getList := func() (digest.Digest, manifestlist.ManifestList) {
+		tagRef, _ := reference.WithTag(imageName, "latest")
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+
+		req, err := http.NewRequest("GET", manifestURL, nil)
+		checkErr(t, err, "building request")
+		req.Header.Set("Accept", manifestlist.MediaTypeManifestList)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "getting build group")
+		defer resp.Body.Close()
+		checkResponse(t, "getting build group", resp, http.StatusOK)
+
+		var list manifestlist.ManifestList
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatalf("error decoding manifest list: %v", err)
+		}
+		dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+		checkErr(t, err, "parsing manifest list digest")
+		return dgst, list
+	}
+
+	amd64, _ := push("amd64", "amd64", "1")
+	arm64, groupDigest := push("arm64", "arm64", "1")
+
+	listDigest, list := getList()
+	if listDigest != groupDigest {
+		t.Fatalf("build group digest %s does not match tagged list %s", groupDigest, listDigest)
+	}
+	if len(list.Manifests) != 2 ||
+		list.Manifests[0].Digest != amd64 || list.Manifests[0].Platform.Architecture != "amd64" ||
+		list.Manifests[1].Digest != arm64 || list.Manifests[1].Platform.Architecture != "arm64" {
+		t.Fatalf("unexpected manifest list: %+v", list.Manifests)
+	}
+
+	// Pushing the same manifest again leaves the list unchanged.
+	_, again := push("arm64", "arm64", "1")
+	if again != groupDigest {
+		t.Fatalf("build group changed on repeated push: %s != %s", again, groupDigest)
+	}
+
+	// A new manifest of a platform replaces the previous one.
+	arm64, groupDigest = push("arm64", "arm64", "2")
+	listDigest, list = getList()
+	if listDigest != groupDigest {
+		t.Fatalf("build group digest %s does not match tagged list %s", groupDigest, listDigest)
+	}
+	if len(list.Manifests) != 2 || list.Manifests[0].Digest != amd64 || list.Manifests[1].Digest != arm64 {
+		t.Fatalf("unexpected manifest list: %+v", list.Manifests)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 
 	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
 	"github.com/gorilla/handlers"
 )
 
@@ -57,7 +58,7 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	// Add a link header if there are more entries to retrieve
 	if moreEntries {
 		lastEntry = repos[len(repos)-1]
-		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
+		urlStr, err := createLinkEntry(ch.urlBuilder, maxEntries, lastEntry)
 		if err != nil {
 			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
@@ -74,22 +75,17 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Use the original URL from the request to create a new URL for
-// the link header
-func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
-	calledURL, err := url.Parse(origURL)
-	if err != nil {
-		return "", err
-	}
-
+// createLinkEntry creates the link header to the next page of the catalog.
+// The link is a path, including the prefix the API is served under.
+func createLinkEntry(ub *v2.URLBuilder, maxEntries int, lastEntry string) (string, error) {
 	v := url.Values{}
 	v.Add("n", strconv.Itoa(maxEntries))
 	v.Add("last", lastEntry)
 
-	calledURL.RawQuery = v.Encode()
-
-	calledURL.Fragment = ""
-	urlStr := fmt.Sprintf("<%s>; rel=\"next\"", calledURL.String())
+	nextURL, err := ub.Relative().BuildCatalogURL(v)
+	if err != nil {
+		return "", err
+	}
 
-	return urlStr, nil
+	return fmt.Sprintf("<%s>; rel=\"next\"", nextURL), nil
 }
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+)
+
+const (
+	// defaultCatalogIndexRepairInterval is the interval between rebuilds of
+	// the catalog index, if not configured.
+	defaultCatalogIndexRepairInterval = 24 * time.Hour
+
+	// catalogIndexCheckInterval is the interval between checks that the
+	// catalog index was built, so that an index just enabled is built
+	// without waiting for the repair interval.
+	catalogIndexCheckInterval = time.Minute
+)
+
+// configureCatalogIndex returns the catalog index of the registry's storage,
+// as configured by the catalogindex storage section, or nil if it is not
+// enabled. Its updates hold the locks of the lock manager, if any.
+func (app *App) configureCatalogIndex(config configuration.Parameters, locks *storage.LockManager) *storage.CatalogIndex {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return nil
+	}
+
+	ctxu.GetLogger(app).Infof("listing the catalog from the catalog index")
+	return storage.NewCatalogIndex(app.driver, locks)
+}
+
+// catalogIndexes returns the catalog indexes of the registry's storage and of
+// each namespace storage.
+func (app *App) catalogIndexes() []*storage.CatalogIndex {
+	if app.catalogIndex == nil {
+		return nil
+	}
+
+	indexes := []*storage.CatalogIndex{app.catalogIndex}
+	if app.namespaces != nil {
+		for _, ns := range app.namespaces.storages {
+			indexes = append(indexes, ns.catalog)
+		}
+	}
+	return indexes
+}
+
+// catalogIndexFor returns the catalog index of the storage of the named
+// repository, or nil if the catalog is not indexed.
+func (app *App) catalogIndexFor(name string) *storage.CatalogIndex {
+	if ns := app.namespaceStorageFor(name); ns != nil {
+		return ns.catalog
+	}
+	return app.catalogIndex
+}
+
+// startCatalogIndexRepairer schedules a goroutine which periodically rebuilds
+// the catalog indexes, repairing the updates they lost, as configured by the
+// catalogindex storage section. An index which was not built yet, such as
+// when just enabled, is built at once.
+func startCatalogIndexRepairer(app *App, config configuration.Parameters) {
+	indexes := app.catalogIndexes()
+	if len(indexes) == 0 {
+		return
+	}
+
+	interval := defaultCatalogIndexRepairInterval
+	if v, ok := config["repairinterval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("catalogindex's repairinterval config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("catalogindex's repairinterval config key is not a valid duration: %q", s))
+		}
+		interval = d
+	}
+
+	leading := app.maintenanceJob("catalogindex")
+	go func() {
+		repaired := make([]time.Time, len(indexes))
+		for i := range repaired {
+			repaired[i] = time.Now()
+		}
+
+		for {
+			time.Sleep(catalogIndexCheckInterval)
+
+			for i, ci := range indexes {
+				if time.Since(repaired[i]) < interval {
+					exists, err := ci.Exists(app)
+					if err != nil {
+						ctxu.GetLogger(app).Errorf("catalog index: %v", err)
+						continue
+					}
+					if exists {
+						continue
+					}
+				}
+
+				if !leading() {
+					continue
+				}
+
+				count, err := ci.Rebuild(app)
+				if err != nil {
+					ctxu.GetLogger(app).Errorf("catalog index: %v", err)
+					continue
+				}
+				repaired[i] = time.Now()
+				ctxu.GetLogger(app).Infof("catalog index: %d repositories indexed", count)
+			}
+		}
+	}()
+}
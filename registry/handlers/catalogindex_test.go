@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestCatalogIndex checks that pushed repositories are added to the catalog
+// index, and that deleted ones are removed from it.
+func TestCatalogIndex(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory":     configuration.Parameters{},
+			"delete":       configuration.Parameters{"enabled": true, "repositories": true},
+			"catalogindex": configuration.Parameters{"enabled": true, "repairinterval": "1h"},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	catalog := func() []string {
+		catalogURL, err := env.builder.BuildCatalogURL()
+		checkErr(t, err, "building catalog url")
+		resp, err := http.Get(catalogURL)
+		checkErr(t, err, "getting catalog")
+		defer resp.Body.Close()
+		checkResponse(t, "getting catalog", resp, http.StatusOK)
+
+		var ctlg catalogAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+			t.Fatalf("error decoding catalog: %v", err)
+		}
+		return ctlg.Repositories
+	}
+
+	createRepository(env, t, "foo/bar", "latest")
+	if count, err := env.app.catalogIndex.Rebuild(env.app); err != nil || count != 1 {
+		t.Fatalf("unexpected rebuild: %d, %v", count, err)
+	}
+
+	createRepository(env, t, "foo/baz", "latest")
+	if repos := catalog(); !reflect.DeepEqual(repos, []string{"foo/bar", "foo/baz"}) {
+		t.Fatalf("unexpected catalog: %v", repos)
+	}
+
+	name, _ := reference.ParseNamed("foo/bar")
+	repositoryURL, err := env.builder.BuildRepositoryURL(name)
+	checkErr(t, err, "building repository url")
+	req, err := http.NewRequest("DELETE", repositoryURL, nil)
+	checkErr(t, err, "building request")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "deleting repository")
+	resp.Body.Close()
+	checkResponse(t, "deleting repository", resp, http.StatusAccepted)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		repos := catalog()
+		if reflect.DeepEqual(repos, []string{"foo/baz"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deleted repository still in catalog: %v", repos)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+type compareAPIResponse struct {
+	Name        string                    `json:"name"`
+	From        comparedManifest          `json:"from"`
+	To          comparedManifest          `json:"to"`
+	Shared      []distribution.Descriptor `json:"shared"`
+	Added       []distribution.Descriptor `json:"added"`
+	Removed     []distribution.Descriptor `json:"removed"`
+	SharedSize  int64                     `json:"sharedSize"`
+	AddedSize   int64                     `json:"addedSize"`
+	RemovedSize int64                     `json:"removedSize"`
+}
+
+// comparedManifest identifies a manifest compared, with the size of all of
+// its layers.
+type comparedManifest struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// compareDispatcher constructs the handler of the manifest compare route.
+func compareDispatcher(ctx *Context, r *http.Request) http.Handler {
+	compareHandler := &compareHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(compareHandler.GetComparison),
+	}
+}
+
+// compareHandler compares the layers of two manifests of a repository.
+type compareHandler struct {
+	*Context
+}
+
+// GetComparison returns the layers shared by the manifests given by the from
+// and to parameters of the request, and the layers found in only one of them.
+func (ch *compareHandler) GetComparison(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" || to == "" {
+		ch.Errors = append(ch.Errors, v2.ErrorCodeTagInvalid.WithDetail("the from and to references are required"))
+		return
+	}
+
+	platform := manifestlist.PlatformSpec{OS: defaultOS, Architecture: defaultArch}
+	if p := q.Get("platform"); p != "" {
+		var err error
+		platform, err = parsePlatform(p)
+		if err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeTagInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
+	name := ch.Repository.Named().Name()
+	exists, err := storage.RepositoryExists(ch, ch.driverFor(name), name)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		ch.Errors = append(ch.Errors, v2.ErrorCodeNameUnknown.WithDetail(distribution.ErrRepositoryUnknown{Name: name}))
+		return
+	}
+
+	fromDigest, fromLayers, ok := ch.imageLayers(from, platform)
+	if !ok {
+		return
+	}
+	toDigest, toLayers, ok := ch.imageLayers(to, platform)
+	if !ok {
+		return
+	}
+
+	response := compareAPIResponse{
+		Name:    name,
+		From:    comparedManifest{Digest: fromDigest},
+		To:      comparedManifest{Digest: toDigest},
+		Shared:  []distribution.Descriptor{},
+		Added:   []distribution.Descriptor{},
+		Removed: []distribution.Descriptor{},
+	}
+
+	inFrom := make(map[digest.Digest]bool, len(fromLayers))
+	for _, layer := range fromLayers {
+		inFrom[layer.Digest] = true
+		response.From.Size += layer.Size
+	}
+	inTo := make(map[digest.Digest]bool, len(toLayers))
+	for _, layer := range toLayers {
+		inTo[layer.Digest] = true
+		response.To.Size += layer.Size
+
+		if inFrom[layer.Digest] {
+			response.Shared = append(response.Shared, layer)
+			response.SharedSize += layer.Size
+		} else {
+			response.Added = append(response.Added, layer)
+			response.AddedSize += layer.Size
+		}
+	}
+	for _, layer := range fromLayers {
+		if !inTo[layer.Digest] {
+			response.Removed = append(response.Removed, layer)
+			response.RemovedSize += layer.Size
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// imageLayers resolves the tag or digest ref to an image manifest, choosing
+// the manifest of platform from manifest lists, and returns its digest and
+// distinct layers, base layers first. Errors are added to the context and
+// reported by returning false.
+func (ch *compareHandler) imageLayers(ref string, platform manifestlist.PlatformSpec) (digest.Digest, []distribution.Descriptor, bool) {
+	manifests, err := ch.Repository.Manifests(ch)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return "", nil, false
+	}
+
+	dgst, err := digest.ParseDigest(ref)
+	if err != nil {
+		if _, err := reference.WithTag(ch.Repository.Named(), ref); err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeTagInvalid.WithDetail(fmt.Sprintf("%q is neither a tag nor a digest", ref)))
+			return "", nil, false
+		}
+
+		desc, err := ch.Repository.Tags(ch).Get(ch, ref)
+		if err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			return "", nil, false
+		}
+		dgst = desc.Digest
+	}
+
+	manifest, err := manifests.Get(ch, dgst)
+	if err != nil {
+		ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		return "", nil, false
+	}
+
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		dgst = ""
+		for _, m := range list.Manifests {
+			if samePlatform(m.Platform, platform) {
+				dgst = m.Digest
+				break
+			}
+		}
+		if dgst == "" {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(fmt.Sprintf("%s has no manifest for %s", ref, formatPlatform(platform))))
+			return "", nil, false
+		}
+
+		manifest, err = manifests.Get(ch, dgst)
+		if err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			return "", nil, false
+		}
+	}
+
+	var layers []distribution.Descriptor
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+		layers = m.Layers
+	case *schema1.SignedManifest:
+		// Schema1 manifests list their layers top first, without sizes.
+		references := m.References()
+		blobs := ch.Repository.Blobs(ch)
+		for i := len(references) - 1; i >= 0; i-- {
+			layer := references[i]
+			desc, err := blobs.Stat(ch, layer.Digest)
+			if err != nil {
+				ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return "", nil, false
+			}
+			layer.Size = desc.Size
+			layers = append(layers, layer)
+		}
+	default:
+		ch.Errors = append(ch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(fmt.Sprintf("%s is not an image manifest", ref)))
+		return "", nil, false
+	}
+
+	distinct := make([]distribution.Descriptor, 0, len(layers))
+	seen := make(map[digest.Digest]bool, len(layers))
+	for _, layer := range layers {
+		if !seen[layer.Digest] {
+			seen[layer.Digest] = true
+			distinct = append(distinct, layer)
+		}
+	}
+
+	return dgst, distinct, true
+}
+
+// parsePlatform parses a platform of the form <os>/<architecture>[/<variant>].
+func parsePlatform(s string) (manifestlist.PlatformSpec, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return manifestlist.PlatformSpec{}, fmt.Errorf("platform %q is not of the form <os>/<architecture>[/<variant>]", s)
+	}
+
+	platform := manifestlist.PlatformSpec{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// formatPlatform formats a platform as parsed by parsePlatform.
+func formatPlatform(platform manifestlist.PlatformSpec) string {
+	s := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		s += "/" + platform.Variant
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestManifestCompare checks that the layers of two manifests are reported as
+// shared, added or removed, with their sizes.
+func TestManifestCompare(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+	env := newTestEnv(t, false)
+	defer env.server.Close()
+
+	layers := make([]distribution.Descriptor, 3)
+	for i := range layers {
+		layer, layerDigest, err := testutil.CreateRandomTarFile()
+		checkErr(t, err, "creating random layer file")
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+		layers[i] = distribution.Descriptor{
+			Digest:    layerDigest,
+			Size:      int64(10 * (i + 1)),
+			MediaType: schema2.MediaTypeLayer,
+		}
+	}
+
+	image := []byte(`{"architecture":"amd64","os":"linux"}`)
+	imageDigest := digest.FromBytes(image)
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+
+	push := func(tag string, layers ...distribution.Descriptor) digest.Digest {
+		manifest := &schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config: distribution.Descriptor{
+				Digest:    imageDigest,
+				Size:      int64(len(image)),
+				MediaType: schema2.MediaTypeConfig,
+			},
+			Layers: layers,
+		}
+
+		tagRef, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, manifest)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+		dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+		checkErr(t, err, "parsing manifest digest")
+		return dgst
+	}
+
+	v1 := push("v1", layers[0], layers[1])
+	v2Digest := push("v2", layers[0], layers[2])
+
+	compare := func(values url.Values) *http.Response {
+		compareURL, err := env.builder.BuildManifestCompareURL(imageName, values)
+		checkErr(t, err, "building manifest compare url")
+		resp, err := http.Get(compareURL)
+		checkErr(t, err, "comparing manifests")
+		return resp
+	}
+
+	resp := compare(url.Values{"from": {"v1"}, "to": {v2Digest.String()}})
+	defer resp.Body.Close()
+	checkResponse(t, "comparing manifests", resp, http.StatusOK)
+
+	var result compareAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding comparison: %v", err)
+	}
+	if result.Name != imageName.Name() ||
+		result.From.Digest != v1 || result.From.Size != 30 ||
+		result.To.Digest != v2Digest || result.To.Size != 40 {
+		t.Fatalf("unexpected manifests compared: %+v", result)
+	}
+	if len(result.Shared) != 1 || result.Shared[0].Digest != layers[0].Digest || result.SharedSize != 10 {
+		t.Fatalf("unexpected shared layers: %+v", result.Shared)
+	}
+	if len(result.Added) != 1 || result.Added[0].Digest != layers[2].Digest || result.AddedSize != 30 {
+		t.Fatalf("unexpected added layers: %+v", result.Added)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Digest != layers[1].Digest || result.RemovedSize != 20 {
+		t.Fatalf("unexpected removed layers: %+v", result.Removed)
+	}
+
+	resp = compare(url.Values{"from": {"v1"}})
+	defer resp.Body.Close()
+	checkResponse(t, "comparing without reference", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "comparing without reference", resp, v2.ErrorCodeTagInvalid)
+
+	resp = compare(url.Values{"from": {"v1"}, "to": {"v3"}})
+	defer resp.Body.Close()
+	checkResponse(t, "comparing with unknown reference", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "comparing with unknown reference", resp, v2.ErrorCodeManifestUnknown)
+}
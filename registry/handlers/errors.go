@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// errorTemplateData is the data the error templates of the configuration are
+// executed with.
+type errorTemplateData struct {
+	Code             string
+	Message          string
+	Detail           interface{}
+	HTTPStatusCode   int
+	DocumentationURL string
+	RequestID        string
+	Repository       string
+}
+
+// configureErrors parses the templates customizing error responses.
+func (app *App) configureErrors(config *configuration.Configuration) {
+	parse := func(name, text string) *template.Template {
+		if text == "" {
+			return nil
+		}
+
+		t, err := template.New(name).Parse(text)
+		if err != nil {
+			panic(fmt.Sprintf("invalid http errors %s template: %v", name, err))
+		}
+		return t
+	}
+
+	app.errorDocumentationURL = parse("documentationurl", config.HTTP.Errors.DocumentationURL)
+	app.errorMessage = parse("message", config.HTTP.Errors.Message)
+}
+
+// serveErrors serves errs to the client, customized as configured.
+func (app *App) serveErrors(ctx *Context, w http.ResponseWriter, errs errcode.Errors) {
+	if err := errcode.ServeJSON(w, app.customizeErrors(ctx, errs)); err != nil {
+		ctxu.GetLogger(ctx).Errorf("error serving error json: %v (from %v)", err, errs)
+	}
+}
+
+// customizeErrors adds the documentation URL and request id to errs, and
+// rewrites their messages, as configured. Errors are returned unchanged if
+// responses are not customized.
+func (app *App) customizeErrors(ctx *Context, errs errcode.Errors) errcode.Errors {
+	config := app.Config.HTTP.Errors
+	if app.errorDocumentationURL == nil && app.errorMessage == nil && !config.RequestID {
+		return errs
+	}
+
+	customized := make(errcode.Errors, len(errs))
+	for i, e := range errs {
+		err := errcode.AsError(e)
+		if err.Message == "" {
+			err.Message = err.Code.Message()
+		}
+		if err.DocumentationURL == "" {
+			err.DocumentationURL = err.Code.Descriptor().DocumentationURL
+		}
+		if config.RequestID {
+			err.RequestID = ctxu.GetRequestID(ctx)
+		}
+
+		data := errorTemplateData{
+			Code:             err.Code.String(),
+			Message:          err.Message,
+			Detail:           err.Detail,
+			HTTPStatusCode:   err.Code.Descriptor().HTTPStatusCode,
+			DocumentationURL: err.DocumentationURL,
+			RequestID:        ctxu.GetRequestID(ctx),
+			Repository:       getName(ctx),
+		}
+
+		if err.DocumentationURL == "" && app.errorDocumentationURL != nil {
+			err.DocumentationURL = app.executeErrorTemplate(ctx, app.errorDocumentationURL, data)
+			data.DocumentationURL = err.DocumentationURL
+		}
+		if app.errorMessage != nil {
+			if message := app.executeErrorTemplate(ctx, app.errorMessage, data); message != "" {
+				err.Message = message
+			}
+		}
+
+		customized[i] = err
+	}
+	return customized
+}
+
+// executeErrorTemplate executes t with data, returning an empty string if it
+// fails.
+func (app *App) executeErrorTemplate(ctx *Context, t *template.Template, data errorTemplateData) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		ctxu.GetLogger(ctx).Errorf("error executing http errors %s template: %v", t.Name(), err)
+		return ""
+	}
+	return buf.String()
+}
+
+// backendUnavailable returns the error of the storage backend being
+// unavailable among errs, if any, whether returned as is or as the detail of
+// an error.
+func backendUnavailable(errs errcode.Errors) (storagedriver.UnavailableError, bool) {
+	for _, e := range errs {
+		if err, ok := e.(errcode.Error); ok {
+			e, _ = err.Detail.(error)
+		}
+		if unavailable, ok := e.(storagedriver.UnavailableError); ok {
+			return unavailable, true
+		}
+	}
+	return storagedriver.UnavailableError{}, false
+}
+
+// retryAfter formats d as the value of a Retry-After header, in whole
+// seconds and at least one.
+func retryAfter(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
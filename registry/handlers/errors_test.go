@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// TestCustomizedErrors checks that error responses include the configured
+// documentation URL, message and request id.
+func TestCustomizedErrors(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Errors = configuration.ErrorResponses{
+		DocumentationURL: "https://docs.example.com/errors/{{.Code}}",
+		Message:          "{{.Message}} ({{.Repository}}, see {{.DocumentationURL}})",
+		RequestID:        true,
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	tagRef, _ := reference.WithTag(name, "missing")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching missing manifest", resp, http.StatusNotFound)
+
+	var body struct {
+		Errors []errcode.Error `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding error response: %v", err)
+	}
+	if len(body.Errors) != 1 {
+		t.Fatalf("unexpected errors: %v", body.Errors)
+	}
+
+	e := body.Errors[0]
+	expectedURL := "https://docs.example.com/errors/MANIFEST_UNKNOWN"
+	if e.DocumentationURL != expectedURL {
+		t.Fatalf("unexpected documentation url: %q != %q", e.DocumentationURL, expectedURL)
+	}
+	expectedMessage := "manifest unknown (foo/bar, see " + expectedURL + ")"
+	if e.Message != expectedMessage {
+		t.Fatalf("unexpected message: %q != %q", e.Message, expectedMessage)
+	}
+	if e.RequestID == "" {
+		t.Fatalf("expected request id in error")
+	}
+}
+
+// TestBackendUnavailable checks that the storage backend failing fast is
+// found among the errors of a request, and when clients are told to retry.
+func TestBackendUnavailable(t *testing.T) {
+	unavailable := storagedriver.UnavailableError{DriverName: "kodo", RetryAfter: 1500 * time.Millisecond}
+
+	for _, errs := range []errcode.Errors{
+		{unavailable},
+		{errcode.ErrorCodeUnsupported, errcode.ErrorCodeUnknown.WithDetail(unavailable)},
+	} {
+		found, ok := backendUnavailable(errs)
+		if !ok || found != unavailable {
+			t.Fatalf("unavailable backend not found in %v", errs)
+		}
+	}
+	if _, ok := backendUnavailable(errcode.Errors{errcode.ErrorCodeUnknown.WithDetail("kodo: unavailable")}); ok {
+		t.Fatalf("unexpected unavailable backend")
+	}
+
+	for d, expected := range map[time.Duration]string{
+		0:                       "1",
+		1500 * time.Millisecond: "2",
+		30 * time.Second:        "30",
+	} {
+		if value := retryAfter(d); value != expected {
+			t.Fatalf("unexpected Retry-After for %s: %q != %q", d, value, expected)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gorilla/handlers"
+)
+
+const (
+	// eventStreamBuffer is the number of events buffered for a client of
+	// the event stream, beyond which events are dropped until it catches
+	// up.
+	eventStreamBuffer = 1000
+
+	// eventStreamHeartbeatInterval is the interval between the comments
+	// sent to idle clients of the event stream, so that proxies do not close
+	// their connections.
+	eventStreamHeartbeatInterval = 30 * time.Second
+)
+
+func adminEventsStreamDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.StreamEvents),
+	}
+}
+
+// StreamEvents streams the notification events as server-sent events, as
+// they are sent to the endpoints, until the client disconnects. Each event is
+// sent with its ID, its action as event type and its JSON envelope as data.
+// The "repository" parameter, which may be repeated, limits the stream to the
+// events of these repositories. The number of events dropped while the client
+// was not keeping up is sent as a "dropped" event.
+func (ah *adminHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("the response cannot be streamed"))
+		return
+	}
+
+	var filter func(event notifications.Event) bool
+	if names := r.URL.Query()["repository"]; len(names) > 0 {
+		repositories := make(map[string]struct{}, len(names))
+		for _, name := range names {
+			repositories[name] = struct{}{}
+		}
+		filter = func(event notifications.Event) bool {
+			_, ok := repositories[event.Target.Repository]
+			return ok
+		}
+	}
+
+	var clientClosed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		clientClosed = notifier.CloseNotify()
+	} else {
+		ctxu.GetLogger(ah).Warnf("the ResponseWriter does not implement CloseNotifier (type: %T)", w)
+	}
+
+	subscription := ah.events.subscribers.Subscribe(filter)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable the response buffering of nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var dropped int
+	for {
+		var err error
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			err = writeStreamedEvent(w, event)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-clientClosed:
+			return
+		}
+
+		if n := subscription.Dropped(); err == nil && n > dropped {
+			_, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", n-dropped)
+			dropped = n
+		}
+		if err != nil {
+			ctxu.GetLogger(ah).Debugf("error writing event stream: %v", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamedEvent writes an event of the event stream.
+func writeStreamedEvent(w http.ResponseWriter, event notifications.Event) error {
+	p, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Action, p)
+	return err
+}
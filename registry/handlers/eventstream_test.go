@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/api/admin"
+)
+
+// TestAdminEventsStream checks that the event stream sends the events of the
+// watched repositories as they happen, as server-sent events.
+func TestAdminEventsStream(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+	streamURL, err := ub.BuildEventsStreamURL(url.Values{"repository": {"foo/bar"}})
+	checkErr(t, err, "building events stream url")
+
+	resp, err := http.Get(streamURL)
+	checkErr(t, err, "watching events")
+	defer resp.Body.Close()
+	checkResponse(t, "watching events", resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("unexpected content type: %q", contentType)
+	}
+
+	type streamedEvent struct {
+		id, eventType string
+		event         notifications.Event
+	}
+	streamed := make(chan streamedEvent)
+	go func() {
+		defer close(streamed)
+
+		var current streamedEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				streamed <- current
+				current = streamedEvent{}
+			case strings.HasPrefix(line, "id: "):
+				current.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				current.eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.event); err != nil {
+					t.Errorf("error decoding streamed event: %v", err)
+				}
+			}
+		}
+	}()
+
+	createRepository(env, t, "other/repo", "latest")
+	createRepository(env, t, "foo/bar", "latest")
+
+	// The pushes of foo/bar are streamed, those of other/repo are not.
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s, ok := <-streamed:
+			if !ok {
+				t.Fatalf("event stream ended")
+			}
+			if s.event.Target.Repository != "foo/bar" {
+				t.Fatalf("unexpected event of repository %q", s.event.Target.Repository)
+			}
+			if s.id != s.event.ID || s.eventType != s.event.Action {
+				t.Fatalf("unexpected event fields: %q, %q for event %s", s.id, s.eventType, s.event.ID)
+			}
+			if s.event.Action == notifications.EventActionPush && s.event.Target.MediaType != "application/octet-stream" {
+				// The manifest, pushed last.
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for the manifest push to be streamed")
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gorilla/handlers"
+)
+
+// Extension describes an extension of the registry API provided by the
+// registry, beyond the endpoints of the specification.
+type Extension struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Endpoints lists the path templates of the endpoints of the
+	// extension, relative to the registry host.
+	Endpoints []string `json:"endpoints"`
+}
+
+type extensionsAPIResponse struct {
+	Extensions []Extension `json:"extensions"`
+}
+
+// extensionsDispatcher constructs the handler listing the extensions.
+func extensionsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	extensionsHandler := &extensionsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(extensionsHandler.GetExtensions),
+	}
+}
+
+type extensionsHandler struct {
+	*Context
+}
+
+// GetExtensions lists the extensions enabled in the registry.
+func (eh *extensionsHandler) GetExtensions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(extensionsAPIResponse{Extensions: eh.App.extensions()}); err != nil {
+		eh.Errors = append(eh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// extensions returns the extensions of the API enabled in the registry.
+func (app *App) extensions() []Extension {
+	config := app.Config.HTTP
+	prefix := strings.TrimSuffix(config.Prefix, "/")
+
+	endpoints := func(paths ...string) []string {
+		for i, path := range paths {
+			paths[i] = prefix + path
+		}
+		return paths
+	}
+
+	extensions := []Extension{
+		{
+			Name:        "blob-toc",
+			Description: "Table of contents of eStargz layers, for lazy pulling.",
+			Endpoints:   endpoints("/v2/<name>/blobs/<digest>/toc"),
+		},
+		{
+			Name:        "manifest-compare",
+			Description: "Comparison of the layers of two image manifests of a repository.",
+			Endpoints:   endpoints("/v2/<name>/_compare"),
+		},
+		{
+			Name:        "manifest-graph",
+			Description: "Graph of the manifests and blobs of an image, with their sizes and media types.",
+			Endpoints:   endpoints("/v2/<name>/manifests/<reference>/graph"),
+		},
+		{
+			Name:        "repository-checksum",
+			Description: "Checksum of the tags and manifests of a repository, for replicas to compare.",
+			Endpoints:   endpoints("/v2/<name>/_checksum"),
+		},
+		{
+			Name:        "sbom",
+			Description: "Software bills of materials of images, stored as artifacts referring to the images.",
+			Endpoints:   endpoints("/v2/<name>/manifests/<reference>/sbom"),
+		},
+	}
+
+	if app.tagSnapshotKey != nil {
+		extensions = append(extensions, Extension{
+			Name:        "tags-snapshot",
+			Description: "Signed snapshots of the tags of a repository.",
+			Endpoints:   endpoints("/v2/<name>/tags/snapshot"),
+		})
+	}
+
+	if app.manifestIndexEnabled {
+		extensions = append(extensions, Extension{
+			Name:        "manifest-search",
+			Description: "Search of the manifests of a repository by annotations and configuration labels.",
+			Endpoints:   endpoints("/v2/<name>/_manifests"),
+		})
+		extensions = append(extensions, Extension{
+			Name:        "manifest-metadata",
+			Description: "Details of image manifests and of their image configuration.",
+			Endpoints:   endpoints("/v2/<name>/manifests/<reference>/metadata"),
+		})
+	}
+
+	if annotation := app.buildGroupAnnotation(); annotation != "" {
+		extensions = append(extensions, Extension{
+			Name:        "build-groups",
+			Description: "Assembly of manifest lists from the image manifests pushed with the " + annotation + " annotation.",
+			Endpoints:   endpoints("/v2/<name>/manifests/<reference>"),
+		})
+	}
+
+	if config.Deltas.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "blob-delta",
+			Description: "Binary deltas between the blobs of a repository, to rebuild a layer from a layer of a previous build.",
+			Endpoints:   endpoints("/v2/<name>/blobs/<digest>/delta"),
+		})
+	}
+
+	if config.LayerIndex.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "layer-index",
+			Description: "Index of the files of the layers of a repository, to browse or search them without downloading the layers.",
+			Endpoints:   endpoints("/v2/<name>/blobs/<digest>/files"),
+		})
+	}
+
+	if config.Imports.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "repository-import",
+			Description: "Import of the images of docker save archives and OCI image layouts into a repository.",
+			Endpoints:   endpoints("/v2/<name>/_import"),
+		})
+	}
+
+	if config.Trust.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "trust",
+			Description: "Storage of the TUF trust metadata of repositories.",
+			Endpoints:   endpoints("/v2/<name>/_trust/tuf/<role>.json"),
+		})
+	}
+
+	if config.Admin.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "admin",
+			Description: "Administrative API, used by registryctl.",
+			Endpoints:   endpoints("/admin/v1/"),
+		})
+	}
+
+	if config.UI.Enabled {
+		extensions = append(extensions, Extension{
+			Name:        "ui",
+			Description: "Web interface for browsing repositories.",
+			Endpoints:   endpoints("/ui/"),
+		})
+	}
+
+	return extensions
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/proxy"
+)
+
+// TestFederation checks that manifests and blobs not found locally are served
+// from a sibling registry.
+func TestFederation(t *testing.T) {
+	sibling := newTestEnv(t, false)
+	defer sibling.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	manifestDigest := createRepository(sibling, t, name.Name(), "latest")
+
+	content := []byte("some layer content")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, sibling.builder, name)
+	pushLayer(t, sibling.builder, name, dgst, uploadURLBase, bytes.NewReader(content))
+
+	for _, redirect := range []bool{false, true} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+			},
+			Federation: configuration.Federation{
+				Registries: []configuration.FederatedRegistry{
+					{URL: sibling.server.URL, Redirect: redirect},
+				},
+			},
+		}
+		config.HTTP.Headers = headerConfig
+		env := newTestEnvWithConfig(t, &config)
+
+		tagRef, _ := reference.WithTag(name, "latest")
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp, err := http.Get(manifestURL)
+		checkErr(t, err, "fetching manifest")
+		resp.Body.Close()
+		checkResponse(t, "fetching manifest of sibling", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Docker-Content-Digest": []string{manifestDigest.String()},
+		})
+
+		blobURL, err := env.builder.BuildBlobURL(mustCanonical(t, name, dgst))
+		checkErr(t, err, "building blob url")
+
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err = client.Get(blobURL)
+		checkErr(t, err, "fetching blob")
+		p, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		checkErr(t, err, "reading blob")
+
+		if redirect {
+			checkResponse(t, "fetching blob of sibling", resp, http.StatusTemporaryRedirect)
+			if location := resp.Header.Get("Location"); !strings.HasPrefix(location, sibling.server.URL) {
+				t.Fatalf("unexpected redirect location: %q", location)
+			}
+		} else {
+			checkResponse(t, "fetching blob of sibling", resp, http.StatusOK)
+			if !bytes.Equal(p, content) {
+				t.Fatalf("unexpected blob content: %q", p)
+			}
+		}
+
+		// Requests of siblings are served from local content only.
+		req, err := http.NewRequest("GET", manifestURL, nil)
+		checkErr(t, err, "building request")
+		req.Header.Set(proxy.FederationHeader, "true")
+		resp, err = http.DefaultClient.Do(req)
+		checkErr(t, err, "fetching manifest as sibling")
+		resp.Body.Close()
+		checkResponse(t, "fetching manifest as sibling", resp, http.StatusNotFound)
+
+		env.server.Close()
+	}
+}
+
+// TestFederationPush checks that blobs stored at a sibling only are reported
+// unknown to the checks of a push, so that a client pushes them along with a
+// manifest referencing them.
+func TestFederationPush(t *testing.T) {
+	sibling := newTestEnv(t, false)
+	defer sibling.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	layer := []byte("some layer content")
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	for _, blob := range [][]byte{layer, config} {
+		uploadURLBase, _ := startPushLayer(t, sibling.builder, name)
+		pushLayer(t, sibling.builder, name, digest.FromBytes(blob), uploadURLBase, bytes.NewReader(blob))
+	}
+
+	envConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Federation: configuration.Federation{
+			Registries: []configuration.FederatedRegistry{
+				{URL: sibling.server.URL},
+			},
+		},
+	}
+	envConfig.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &envConfig)
+	defer env.server.Close()
+
+	// Blobs are pulled from the sibling, but pushed as a client would.
+	layerURL, err := env.builder.BuildBlobURL(mustCanonical(t, name, digest.FromBytes(layer)))
+	checkErr(t, err, "building blob url")
+	resp, err := http.Get(layerURL)
+	checkErr(t, err, "fetching blob")
+	resp.Body.Close()
+	checkResponse(t, "fetching blob of sibling", resp, http.StatusOK)
+
+	for _, blob := range [][]byte{layer, config} {
+		dgst := digest.FromBytes(blob)
+		blobURL, err := env.builder.BuildBlobURL(mustCanonical(t, name, dgst))
+		checkErr(t, err, "building blob url")
+		resp, err := http.Head(blobURL)
+		checkErr(t, err, "checking blob")
+		resp.Body.Close()
+		checkResponse(t, "checking blob of sibling before push", resp, http.StatusNotFound)
+
+		uploadURLBase, _ := startPushLayer(t, env.builder, name)
+		pushLayer(t, env.builder, name, dgst, uploadURLBase, bytes.NewReader(blob))
+	}
+
+	manifest := &schema2.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     schema2.MediaTypeManifest,
+		},
+		Config: distribution.Descriptor{
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+			MediaType: schema2.MediaTypeConfig,
+		},
+		Layers: []distribution.Descriptor{
+			{
+				Digest:    digest.FromBytes(layer),
+				Size:      int64(len(layer)),
+				MediaType: schema2.MediaTypeLayer,
+			},
+		},
+	}
+	tagRef, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp = putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, manifest)
+	resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+}
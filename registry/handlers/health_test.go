@@ -12,6 +12,8 @@ import (
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/health"
+	"github.com/docker/distribution/notifications"
+	_ "github.com/docker/distribution/registry/auth/htpasswd"
 )
 
 func TestFileHealthCheck(t *testing.T) {
@@ -62,6 +64,107 @@ func TestFileHealthCheck(t *testing.T) {
 	}
 }
 
+func TestAuthHealthCheck(t *testing.T) {
+	interval := time.Second
+
+	tmpfile, err := ioutil.TempFile(os.TempDir(), "htpasswd")
+	if err != nil {
+		t.Fatalf("could not create temporary file: %v", err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm": "test-realm",
+				"path":  tmpfile.Name(),
+			},
+		},
+	}
+	config.Health.Auth.Enabled = true
+	config.Health.Auth.Interval = interval
+
+	ctx := context.Background()
+
+	app := NewApp(ctx, config)
+	healthRegistry := health.NewRegistry()
+	app.RegisterHealthChecks(healthRegistry)
+
+	// Wait for health check to happen
+	<-time.After(2 * interval)
+
+	if len(healthRegistry.CheckStatus()) != 0 {
+		t.Fatal("expected 0 items in health check results")
+	}
+
+	os.Remove(tmpfile.Name())
+
+	<-time.After(2 * interval)
+	status := healthRegistry.CheckStatus()
+	if len(status) != 1 {
+		t.Fatal("expected 1 item in health check results")
+	}
+	if _, ok := status["auth_htpasswd"]; !ok {
+		t.Fatalf("expected a failed auth_htpasswd check, got %v", status)
+	}
+}
+
+func TestNotificationsHealthCheck(t *testing.T) {
+	interval := time.Second
+
+	// The endpoint never answers, so that events remain pending.
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Notifications: configuration.Notifications{
+			Endpoints: []configuration.Endpoint{
+				{
+					Name:    "blocked",
+					URL:     server.URL,
+					Timeout: time.Minute,
+				},
+			},
+		},
+	}
+	config.Health.Notifications.Enabled = true
+	config.Health.Notifications.Interval = interval
+	config.Health.Notifications.MaxPending = 2
+
+	ctx := context.Background()
+
+	app := NewApp(ctx, config)
+	healthRegistry := health.NewRegistry()
+	app.RegisterHealthChecks(healthRegistry)
+
+	<-time.After(2 * interval)
+	if len(healthRegistry.CheckStatus()) != 0 {
+		t.Fatal("expected 0 items in health check results")
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := app.events.sink.Write(notifications.Event{Action: notifications.EventActionPush}); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+	}
+
+	<-time.After(2 * interval)
+	if _, ok := healthRegistry.CheckStatus()["notifications"]; !ok {
+		t.Fatal("expected a failed notifications check")
+	}
+}
+
 func TestTCPHealthCheck(t *testing.T) {
 	interval := time.Second
 
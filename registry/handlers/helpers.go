@@ -20,6 +20,32 @@ func closeResources(handler http.Handler, closers ...io.Closer) http.Handler {
 	})
 }
 
+// cancelOnClientClose calls cancel if the client disconnects while handler is
+// serving its request.
+func cancelOnClientClose(handler http.Handler, cancel func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifier, ok := w.(http.CloseNotifier)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+
+		clientClosed := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-clientClosed:
+				cancel()
+			case <-done:
+			}
+		}()
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
 // copyFullPayload copies the payload of a HTTP request to destWriter. If it
 // receives less content than expected, and the client disconnected during the
 // upload, it avoids sending a 400 error to keep the logs cleaner.
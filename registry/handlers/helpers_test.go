@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCancelOnClientClose checks that the cancel function is called when the
+// client disconnects in the middle of a request.
+func TestCancelOnClientClose(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	handler := cancelOnClientClose(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-cancelled:
+		case <-time.After(10 * time.Second):
+		}
+	}), func() { close(cancelled) })
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	checkErr(t, err, "connecting to server")
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: registry\r\n\r\n"))
+	checkErr(t, err, "writing request")
+
+	<-started
+	conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled after the client disconnected")
+	}
+}
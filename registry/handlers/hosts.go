@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+)
+
+// configureHosts parses the addresses of the registry for requests to the
+// hostnames of the http.hosts parameter.
+func (app *App) configureHosts(config *configuration.Configuration) {
+	if len(config.HTTP.Hosts) == 0 {
+		return
+	}
+
+	app.httpHosts = make(map[string]*url.URL)
+	for i, host := range config.HTTP.Hosts {
+		u, err := url.Parse(host.Host)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			panic(fmt.Sprintf("http hosts entry %d must have a fully qualified host URL: %q", i, host.Host))
+		}
+		if len(host.Names) == 0 {
+			panic(fmt.Sprintf("http hosts entry %d must list hostnames", i))
+		}
+
+		for _, name := range host.Names {
+			name = strings.ToLower(name)
+			if _, ok := app.httpHosts[name]; ok {
+				panic(fmt.Sprintf("hostname %q is listed by several http hosts entries", name))
+			}
+			app.httpHosts[name] = app.withPrefix(u)
+		}
+	}
+
+	ctxu.GetLogger(app).Infof("building URLs for %d additional hostnames", len(app.httpHosts))
+}
+
+// hostFor returns the address of the registry configured for the hostname
+// requested by r, and false if none is.
+func (app *App) hostFor(r *http.Request) (*url.URL, bool) {
+	if app.httpHosts == nil {
+		return nil, false
+	}
+
+	host := strings.ToLower(ctxu.RequestHost(r))
+	if u, ok := app.httpHosts[host]; ok {
+		return u, true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if u, ok := app.httpHosts[hostname]; ok {
+			return u, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestHTTPHosts checks that Location headers are built with the address
+// configured for the hostname a request was sent to.
+func TestHTTPHosts(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Host = "https://registry.example.com"
+	config.HTTP.Hosts = []configuration.HTTPHost{
+		{Names: []string{"registry.internal"}, Host: "http://registry.internal:5000"},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	u, err := env.builder.BuildBlobUploadURL(name)
+	checkErr(t, err, "building upload url")
+
+	for _, tc := range []struct {
+		host, forwardedHost, expected string
+	}{
+		{"", "", "https://registry.example.com/"},
+		{"registry.internal", "", "http://registry.internal:5000/"},
+		{"REGISTRY.internal:443", "", "http://registry.internal:5000/"},
+		{"10.0.0.1", "registry.internal", "http://registry.internal:5000/"},
+		{"registry.internal", "registry.example.com", "https://registry.example.com/"},
+	} {
+		req, err := http.NewRequest("POST", u, nil)
+		checkErr(t, err, "building request")
+		if tc.host != "" {
+			req.Host = tc.host
+		}
+		if tc.forwardedHost != "" {
+			req.Header.Set("X-Forwarded-Host", tc.forwardedHost)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "starting upload")
+		resp.Body.Close()
+		checkResponse(t, "starting upload", resp, http.StatusAccepted)
+
+		if location := resp.Header.Get("Location"); !strings.HasPrefix(location, tc.expected) {
+			t.Errorf("unexpected location for host %q, %q: %q", tc.host, tc.forwardedHost, location)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// TestManifestPutIfMatch checks that a manifest put with an If-Match header
+// only moves the tag if it points at an expected manifest.
+func TestManifestPutIfMatch(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"locks":    configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	dgstA := createRepository(env, t, "foo/bar", "latest")
+	dgstB := createRepository(env, t, "foo/bar", "other")
+
+	named, _ := reference.ParseNamed("foo/bar")
+	putTag := func(tag string, dgst digest.Digest, ifMatch string) *http.Response {
+		list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+			Descriptor: distribution.Descriptor{MediaType: schema1.MediaTypeSignedManifest, Digest: dgst},
+		}})
+		if err != nil {
+			t.Fatalf("error creating manifest list: %v", err)
+		}
+		_, payload, err := list.Payload()
+		if err != nil {
+			t.Fatalf("error getting payload: %v", err)
+		}
+
+		tagged, _ := reference.WithTag(named, tag)
+		u, err := env.builder.BuildManifestURL(tagged)
+		checkErr(t, err, "building manifest url")
+
+		req, err := http.NewRequest("PUT", u, bytes.NewReader(payload))
+		checkErr(t, err, "creating manifest put")
+		req.Header.Set("Content-Type", manifestlist.MediaTypeManifestList)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "putting manifest")
+		return resp
+	}
+
+	resp := putTag("latest", dgstB, fmt.Sprintf(`"%s"`, dgstB))
+	checkResponse(t, "putting manifest with a stale If-Match", resp, http.StatusPreconditionFailed)
+	errs, _, _ := checkBodyHasErrorCodes(t, "putting manifest with a stale If-Match", resp, v2.ErrorCodeTagPreconditionFailed)
+	if detail := fmt.Sprint(errs[0].(errcode.Error).Detail); detail != fmt.Sprintf("map[digest:%s tag:latest]", dgstA) {
+		t.Fatalf("unexpected error detail: %s", detail)
+	}
+
+	resp = putTag("latest", dgstB, fmt.Sprintf(`"%s", "%s"`, dgstB, dgstA))
+	checkResponse(t, "putting manifest with a matching If-Match", resp, http.StatusCreated)
+
+	// The tag moved: a second update expecting the previous manifest fails.
+	resp = putTag("latest", dgstA, dgstA.String())
+	checkResponse(t, "putting manifest with a moved tag", resp, http.StatusPreconditionFailed)
+
+	resp = putTag("latest", dgstA, "*")
+	checkResponse(t, "putting manifest with If-Match: *", resp, http.StatusCreated)
+
+	resp = putTag("new", dgstA, "*")
+	checkResponse(t, "putting manifest under a missing tag with If-Match: *", resp, http.StatusPreconditionFailed)
+
+	resp = putTag("latest", dgstA, "latest")
+	checkResponse(t, "putting manifest with an invalid If-Match", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting manifest with an invalid If-Match", resp, v2.ErrorCodeDigestInvalid)
+}
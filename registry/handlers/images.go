@@ -3,7 +3,11 @@ package handlers
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/docker/distribution"
 	ctxu "github.com/docker/distribution/context"
@@ -14,6 +18,7 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 )
 
@@ -24,6 +29,10 @@ const (
 	defaultOS   = "linux"
 )
 
+// defaultManifestLimit is the size of the largest manifest accepted for
+// media types without a configured limit.
+const defaultManifestLimit = 4 << 20
+
 // imageManifestDispatcher takes the request context and builds the
 // appropriate handler for handling image manifest requests.
 func imageManifestDispatcher(ctx *Context, r *http.Request) http.Handler {
@@ -44,7 +53,7 @@ func imageManifestDispatcher(ctx *Context, r *http.Request) http.Handler {
 		"HEAD": http.HandlerFunc(imageManifestHandler.GetImageManifest),
 	}
 
-	if !ctx.readOnly {
+	if !ctx.isReadOnly() {
 		mhandler["PUT"] = http.HandlerFunc(imageManifestHandler.PutImageManifest)
 		mhandler["DELETE"] = http.HandlerFunc(imageManifestHandler.DeleteImageManifest)
 	}
@@ -112,6 +121,11 @@ func (imh *imageManifestHandler) GetImageManifest(w http.ResponseWriter, r *http
 	// If they are being fetched by digest, we can't return something not
 	// matching the digest.
 	if imh.Tag != "" && isSchema2 && !supportsSchema2 {
+		if !imh.App.Config.Compatibility.Schema1.Enabled {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("schema2 manifest not supported by client"))
+			return
+		}
+
 		// Rewrite manifest in schema1 format
 		ctxu.GetLogger(imh).Infof("rewriting manifest %s in schema1 format to support old client", imh.Digest.String())
 
@@ -146,6 +160,11 @@ func (imh *imageManifestHandler) GetImageManifest(w http.ResponseWriter, r *http
 
 		// If necessary, convert the image manifest
 		if schema2Manifest, isSchema2 := manifest.(*schema2.DeserializedManifest); isSchema2 && !supportsSchema2 {
+			if !imh.App.Config.Compatibility.Schema1.Enabled {
+				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("schema2 manifest not supported by client"))
+				return
+			}
+
 			manifest, err = imh.convertSchema2Manifest(schema2Manifest)
 			if err != nil {
 				return
@@ -153,6 +172,10 @@ func (imh *imageManifestHandler) GetImageManifest(w http.ResponseWriter, r *http
 		}
 	}
 
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && !imh.checkSchema1(w, false) {
+		return
+	}
+
 	ct, p, err := manifest.Payload()
 	if err != nil {
 		return
@@ -209,42 +232,119 @@ func etagMatch(r *http.Request, etag string) bool {
 	return false
 }
 
+// ifMatch returns the condition set by the If-Match header of a manifest put
+// on the digest its tag currently points at, or nil if the header is not set.
+// The header lists digests, quoted or not, or "*" for any existing tag.
+func ifMatch(r *http.Request) (func(current digest.Digest) bool, error) {
+	var (
+		exists  bool
+		digests []digest.Digest
+	)
+	for _, headerVal := range r.Header["If-Match"] {
+		for _, val := range strings.Split(headerVal, ",") {
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			if val == "*" {
+				exists = true
+				continue
+			}
+			dgst, err := digest.ParseDigest(val)
+			if err != nil {
+				return nil, err
+			}
+			digests = append(digests, dgst)
+		}
+	}
+
+	if !exists && len(digests) == 0 {
+		return nil, nil
+	}
+	return func(current digest.Digest) bool {
+		if current == "" {
+			return false
+		}
+		if exists {
+			return true
+		}
+		for _, dgst := range digests {
+			if dgst == current {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
 // PutImageManifest validates and stores an image in the registry.
 func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http.Request) {
 	ctxu.GetLogger(imh).Debug("PutImageManifest")
+	if err := imh.App.checkResidency(imh.Repository.Named().Name()); err != nil {
+		residencyDenied(imh.Context, err)
+		return
+	}
+
 	manifests, err := imh.Repository.Manifests(imh)
 	if err != nil {
 		imh.Errors = append(imh.Errors, err)
 		return
 	}
 
+	mediaType := r.Header.Get("Content-Type")
+	limit := imh.manifestLimit(mediaType)
+	if r.ContentLength > limit {
+		imh.manifestTooLarge(mediaType, limit)
+		return
+	}
+
+	// The payload is read up to one byte past the limit, so that larger
+	// manifests sent without a length are detected without being buffered.
+	r.Body = ioutil.NopCloser(io.LimitReader(r.Body, limit+1))
 	var jsonBuf bytes.Buffer
 	if err := copyFullPayload(w, r, &jsonBuf, imh, "image manifest PUT", &imh.Errors); err != nil {
 		// copyFullPayload reports the error if necessary
 		return
 	}
+	if int64(jsonBuf.Len()) > limit {
+		imh.manifestTooLarge(mediaType, limit)
+		return
+	}
 
-	mediaType := r.Header.Get("Content-Type")
 	manifest, desc, err := distribution.UnmarshalManifest(mediaType, jsonBuf.Bytes())
 	if err != nil {
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
 		return
 	}
 
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && !imh.checkSchema1(w, true) {
+		return
+	}
+
+	var (
+		options []distribution.ManifestServiceOption
+		match   func(current digest.Digest) bool
+	)
 	if imh.Digest != "" {
-		if desc.Digest != imh.Digest {
+		if imh.Digest.Algorithm() != desc.Digest.Algorithm() {
+			// The client addressed the manifest using another digest
+			// algorithm. The storage layer verifies the digest and links it
+			// as an alias of the canonical revision.
+			options = append(options, storage.WithDigestAlias(imh.Digest))
+		} else if desc.Digest != imh.Digest {
 			ctxu.GetLogger(imh).Errorf("payload digest does match: %q != %q", desc.Digest, imh.Digest)
 			imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
 			return
 		}
 	} else if imh.Tag != "" {
 		imh.Digest = desc.Digest
+		if match, err = ifMatch(r); err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+			return
+		}
 	} else {
 		imh.Errors = append(imh.Errors, v2.ErrorCodeTagInvalid.WithDetail("no tag or digest specified"))
 		return
 	}
 
-	_, err = manifests.Put(imh, manifest)
+	_, err = manifests.Put(imh, manifest, options...)
 	if err != nil {
 		// TODO(stevvooe): These error handling switches really need to be
 		// handled by an app global mapper.
@@ -262,6 +362,10 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
 				case distribution.ErrManifestUnverified:
 					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
+				case distribution.ErrManifestBlobInvalid:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(verificationError.Error()))
+				case distribution.ErrBlobInvalidDigest:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(verificationError.Error()))
 				default:
 					if verificationError == digest.ErrDigestInvalidFormat {
 						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
@@ -280,14 +384,41 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 	// Tag this manifest
 	if imh.Tag != "" {
 		tags := imh.Repository.Tags(imh)
-		err = tags.Tag(imh, imh.Tag, desc)
+		if match != nil {
+			err = storage.TagIf(imh, tags, imh.Tag, desc, match)
+		} else {
+			err = tags.Tag(imh, imh.Tag, desc)
+		}
 		if err != nil {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			switch err := err.(type) {
+			case storage.TagPreconditionError:
+				imh.Errors = append(imh.Errors, v2.ErrorCodeTagPreconditionFailed.WithDetail(map[string]interface{}{
+					"tag":    err.Tag,
+					"digest": err.Current,
+				}))
+			case storage.LockTimeoutError:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnavailable.WithDetail(err))
+			case distribution.ErrManifestUnknownRevision:
+				// The manifest was deleted concurrently.
+				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			default:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
 			return
 		}
 
 	}
 
+	groupDigest, ok := imh.assembleBuildGroup(manifest, desc)
+	if !ok {
+		return
+	}
+	if groupDigest != "" {
+		w.Header().Set("Docker-Build-Group-Digest", groupDigest.String())
+	}
+
+	imh.requestSBOM(r, manifest, desc)
+
 	// Construct a canonical url for the uploaded manifest.
 	ref, err := reference.WithDigest(imh.Repository.Named(), imh.Digest)
 	if err != nil {
@@ -308,6 +439,29 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 	w.WriteHeader(http.StatusCreated)
 }
 
+// manifestLimit returns the size of the largest manifest of the media type
+// accepted.
+func (imh *imageManifestHandler) manifestLimit(contentType string) int64 {
+	limits := imh.App.Config.HTTP.ManifestLimits
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	if limit, ok := limits.MediaTypes[contentType]; ok && limit > 0 {
+		return limit
+	}
+	if limits.Default > 0 {
+		return limits.Default
+	}
+	return defaultManifestLimit
+}
+
+func (imh *imageManifestHandler) manifestTooLarge(mediaType string, limit int64) {
+	imh.Errors = append(imh.Errors, v2.ErrorCodeManifestTooLarge.WithDetail(map[string]interface{}{
+		"mediaType": mediaType,
+		"limit":     limit,
+	}))
+}
+
 // DeleteImageManifest removes the manifest with the given digest from the registry.
 func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *http.Request) {
 	ctxu.GetLogger(imh).Debug("DeleteImageManifest")
@@ -319,6 +473,10 @@ func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *h
 	}
 
 	err = manifests.Delete(imh, imh.Digest)
+	if lockErr, ok := err.(storage.LockTimeoutError); ok {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnavailable.WithDetail(lockErr))
+		return
+	}
 	if err != nil {
 		switch err {
 		case digest.ErrDigestUnsupported:
@@ -337,19 +495,10 @@ func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *h
 		}
 	}
 
-	tagService := imh.Repository.Tags(imh)
-	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
-	if err != nil {
+	if _, err := storage.RemoveTags(imh, imh.Repository.Tags(imh), imh.Digest); err != nil {
 		imh.Errors = append(imh.Errors, err)
 		return
 	}
 
-	for _, tag := range referencedTags {
-		if err := tagService.Untag(imh, tag); err != nil {
-			imh.Errors = append(imh.Errors, err)
-			return
-		}
-	}
-
 	w.WriteHeader(http.StatusAccepted)
 }
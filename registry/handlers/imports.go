@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/imagearchive"
+	"github.com/gorilla/handlers"
+)
+
+// defaultImportMaxSize is the size of the largest archive imported unless
+// another size is configured.
+const defaultImportMaxSize = 10 << 30
+
+type repositoryImportAPIResponse struct {
+	Name   string               `json:"name"`
+	Images []imagearchive.Image `json:"images"`
+}
+
+// repositoryImportDispatcher constructs the handler of the repository import
+// route.
+func repositoryImportDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryImportHandler := &repositoryImportHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.isReadOnly() {
+		mhandler["POST"] = http.HandlerFunc(repositoryImportHandler.ImportRepository)
+	}
+	return mhandler
+}
+
+// repositoryImportHandler imports image archives into repositories.
+type repositoryImportHandler struct {
+	*Context
+}
+
+// ImportRepository imports the images of the archive uploaded as the request
+// body into the repository, tagging them with the tag parameter if given.
+func (ih *repositoryImportHandler) ImportRepository(w http.ResponseWriter, r *http.Request) {
+	config := ih.App.Config.HTTP.Imports
+	if !config.Enabled || ih.isCache {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnsupported.WithDetail("repository imports are not enabled"))
+		return
+	}
+
+	maxSize := config.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultImportMaxSize
+	}
+	if r.ContentLength > maxSize {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeArchiveInvalid.WithDetail(fmt.Sprintf("archive exceeds %d bytes", maxSize)))
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxSize)
+	images, err := imagearchive.Import(ih, ih.Repository, body, r.URL.Query().Get("tag"))
+	if err != nil {
+		switch err := err.(type) {
+		case imagearchive.InvalidArchiveError:
+			ih.Errors = append(ih.Errors, v2.ErrorCodeArchiveInvalid.WithDetail(err.Reason))
+		case distribution.ErrManifestVerification:
+			ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		case storage.LockTimeoutError:
+			ih.Errors = append(ih.Errors, errcode.ErrorCodeUnavailable.WithDetail(err))
+		default:
+			ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(repositoryImportAPIResponse{
+		Name:   ih.Repository.Named().Name(),
+		Images: images,
+	}); err != nil {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// makeDockerArchive returns a docker save archive of an image with a single
+// layer, named foo:v1.
+func makeDockerArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name    string
+		content string
+	}{
+		{"0123/layer.tar", "layer"},
+		{"4567.json", `{"architecture":"amd64","os":"linux"}`},
+		{"manifest.json", `[{"Config":"4567.json","RepoTags":["foo:v1"],"Layers":["0123/layer.tar"]}]`},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestRepositoryImport checks that the images of an uploaded archive are
+// stored and tagged in the repository.
+func TestRepositoryImport(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Imports.Enabled = true
+	config.HTTP.Imports.MaxSize = 1 << 20
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	importURL, err := env.builder.BuildRepositoryImportURL(imageName)
+	checkErr(t, err, "building repository import url")
+
+	resp, err := http.Post(importURL, "application/x-tar", bytes.NewReader(makeDockerArchive(t)))
+	checkErr(t, err, "importing archive")
+	defer resp.Body.Close()
+	checkResponse(t, "importing archive", resp, http.StatusCreated)
+
+	var body repositoryImportAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding import response: %v", err)
+	}
+	if body.Name != "foo/bar" || len(body.Images) != 1 || len(body.Images[0].Tags) != 1 || body.Images[0].Tags[0] != "v1" {
+		t.Fatalf("unexpected import response: %#v", body)
+	}
+
+	ref, _ := reference.WithTag(imageName, "v1")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, _ := http.NewRequest("GET", manifestURL, nil)
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching imported manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching imported manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{body.Images[0].Digest.String()},
+	})
+
+	layerRef, _ := reference.WithDigest(imageName, digest.FromBytes([]byte("layer")))
+	layerURL, err := env.builder.BuildBlobURL(layerRef)
+	checkErr(t, err, "building blob url")
+	resp, err = http.Head(layerURL)
+	checkErr(t, err, "checking imported layer")
+	defer resp.Body.Close()
+	checkResponse(t, "checking imported layer", resp, http.StatusOK)
+
+	// invalid tags and archives larger than the maximum size are refused
+	importURL, err = env.builder.BuildRepositoryImportURL(imageName, url.Values{"tag": {"-invalid"}})
+	checkErr(t, err, "building repository import url")
+	resp, err = http.Post(importURL, "application/x-tar", bytes.NewReader(makeDockerArchive(t)))
+	checkErr(t, err, "importing archive with an invalid tag")
+	defer resp.Body.Close()
+	checkResponse(t, "importing archive with an invalid tag", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "importing archive with an invalid tag", resp, v2.ErrorCodeArchiveInvalid)
+
+	resp, err = http.Post(importURL, "application/x-tar", bytes.NewReader(make([]byte, 1<<20+1)))
+	checkErr(t, err, "importing large archive")
+	defer resp.Body.Close()
+	checkResponse(t, "importing large archive", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "importing large archive", resp, v2.ErrorCodeArchiveInvalid)
+}
+
+// TestRepositoryImportDisabled checks that archives are not imported unless
+// imports are enabled.
+func TestRepositoryImportDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	importURL, err := env.builder.BuildRepositoryImportURL(imageName)
+	checkErr(t, err, "building repository import url")
+
+	resp, err := http.Post(importURL, "application/x-tar", bytes.NewReader(makeDockerArchive(t)))
+	checkErr(t, err, "importing archive")
+	defer resp.Body.Close()
+	checkResponse(t, "importing archive", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "importing archive", resp, errcode.ErrorCodeUnsupported)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/uuid"
+	"github.com/gorilla/handlers"
+	"golang.org/x/net/context"
+)
+
+// maxJobs is the number of jobs whose status is retained.
+const maxJobs = 100
+
+// jobFunc runs a job, reporting its progress to j. Its result is returned as
+// the result of the job once it completes. It must return once ctx is
+// canceled.
+type jobFunc func(ctx ctxu.Context, j *job) (interface{}, error)
+
+// job is a long-running operation run in the background, so that clients
+// poll its status rather than holding a connection until it ends.
+type job struct {
+	mu       sync.Mutex
+	status   admin.Job
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// Status returns a copy of the status of the job.
+func (j *job) Status() admin.Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	if j.status.Progress != nil {
+		status.Progress = make(map[string]int64, len(j.status.Progress))
+		for counter, n := range j.status.Progress {
+			status.Progress[counter] = n
+		}
+	}
+	return status
+}
+
+// setProgress sets a progress counter of the job.
+func (j *job) setProgress(counter string, n int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.Progress == nil {
+		j.status.Progress = make(map[string]int64)
+	}
+	j.status.Progress[counter] = n
+}
+
+// Cancel asks the job to stop. It has no effect on a job which ended.
+func (j *job) Cancel() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.Finished == nil {
+		j.canceled = true
+		j.cancel()
+	}
+}
+
+// finish records the end of the job, with the result or error returned by
+// its function.
+func (j *job) finish(result interface{}, err error) {
+	var p []byte
+	if err == nil && result != nil {
+		p, err = json.Marshal(result)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	finished := time.Now().UTC()
+	j.status.Finished = &finished
+	switch {
+	case err == nil:
+		j.status.State = admin.JobStateCompleted
+		j.status.Result = p
+	case j.canceled:
+		j.status.State = admin.JobStateCanceled
+		j.status.Error = err.Error()
+	default:
+		j.status.State = admin.JobStateFailed
+		j.status.Error = err.Error()
+	}
+
+	// Release the resources of the context of the job.
+	j.cancel()
+}
+
+// jobs runs jobs and retains the most recent ones, so that their status can
+// be polled.
+type jobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+// start runs fn in the background as a job of the given type and target.
+// The job is bound to ctx rather than to the request which started it.
+func (js *jobs) start(ctx ctxu.Context, jobType, target string, fn jobFunc) *job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.add(ctx, jobType, target, fn)
+}
+
+// startExclusive is like start, but returns the running job of the same type
+// and target instead of starting another, if there is one. The returned
+// boolean is true if the job was started.
+func (js *jobs) startExclusive(ctx ctxu.Context, jobType, target string, fn jobFunc) (*job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	for _, id := range js.order {
+		j := js.jobs[id]
+		if status := j.Status(); status.Type == jobType && status.Target == target && status.State == admin.JobStateRunning {
+			return j, false
+		}
+	}
+	return js.add(ctx, jobType, target, fn), true
+}
+
+// add starts a job, retaining it. js.mu must be held.
+func (js *jobs) add(ctx ctxu.Context, jobType, target string, fn jobFunc) *job {
+	jobCtx, cancel := context.WithCancel(ctx)
+	j := &job{
+		status: admin.Job{
+			ID:      uuid.Generate().String(),
+			Type:    jobType,
+			Target:  target,
+			State:   admin.JobStateRunning,
+			Started: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	if js.jobs == nil {
+		js.jobs = make(map[string]*job)
+	}
+	js.jobs[j.status.ID] = j
+	js.order = append(js.order, j.status.ID)
+	for len(js.order) > maxJobs {
+		delete(js.jobs, js.order[0])
+		js.order = js.order[1:]
+	}
+
+	ctxu.GetLogger(ctx).Infof("started %s job %s %s", jobType, j.status.ID, target)
+	go func() {
+		result, err := fn(jobCtx, j)
+		j.finish(result, err)
+
+		status := j.Status()
+		if status.Error != "" {
+			ctxu.GetLogger(ctx).Errorf("%s job %s %s %s: %s", jobType, status.ID, target, status.State, status.Error)
+			return
+		}
+		ctxu.GetLogger(ctx).Infof("%s job %s %s %s", jobType, status.ID, target, status.State)
+	}()
+
+	return j
+}
+
+func (js *jobs) get(id string) (*job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	j, ok := js.jobs[id]
+	return j, ok
+}
+
+// list returns the status of the retained jobs, oldest first.
+func (js *jobs) list() []admin.Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	statuses := make([]admin.Job, 0, len(js.order))
+	for _, id := range js.order {
+		statuses = append(statuses, js.jobs[id].Status())
+	}
+	return statuses
+}
+
+// isAsync returns true if the request asks for its operation to run as a
+// job.
+func isAsync(r *http.Request) bool {
+	return r.URL.Query().Get("async") == "true"
+}
+
+// spoolRequestBody copies the body of r to a temporary file, positioned at its
+// start, so that a job can read it once the request is done.
+func spoolRequestBody(r *http.Request) (*os.File, error) {
+	f, err := ioutil.TempFile("", "registry-job-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r.Body); err != nil {
+		removeSpooled(f)
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		removeSpooled(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+// removeSpooled closes and removes a file returned by spoolRequestBody.
+func removeSpooled(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// startJob starts a job bound to the context of the registry, logging with
+// the logger of the request and carrying its storage scope, and serves its
+// status.
+func (ah *adminHandler) startJob(w http.ResponseWriter, jobType, target string, fn jobFunc) {
+	ctx := detachedContext(ah.App, ah)
+	ah.serveJob(w, ah.App.jobs.start(ctx, jobType, target, fn))
+}
+
+// serveJob serves the status of a job which was started, with the URL it can
+// be polled at.
+func (ah *adminHandler) serveJob(w http.ResponseWriter, j *job) {
+	ub := admin.NewURLBuilder(&url.URL{Path: "/" + strings.TrimPrefix(ah.App.Config.HTTP.Prefix, "/")})
+	location, err := ub.BuildJobURL(j.Status().ID)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(j.Status()); err != nil {
+		ctxu.GetLogger(ah).Errorf("error writing job status: %v", err)
+	}
+}
+
+func adminJobsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetJobs),
+	}
+}
+
+// GetJobs lists the jobs retained by the registry, oldest first.
+func (ah *adminHandler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	ah.serveJSON(w, admin.JobList{Jobs: ah.App.jobs.list()})
+}
+
+func adminJobDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(ah.GetJob),
+		"DELETE": http.HandlerFunc(ah.CancelJob),
+	}
+}
+
+// GetJob returns the status of a job.
+func (ah *adminHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := ah.job()
+	if !ok {
+		return
+	}
+
+	ah.serveJSON(w, j.Status())
+}
+
+// CancelJob asks a job to stop, returning its status. The job is canceled
+// once its state is no longer running.
+func (ah *adminHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := ah.job()
+	if !ok {
+		return
+	}
+
+	j.Cancel()
+	ctxu.GetLogger(ah).Infof("admin: canceled job %s", j.Status().ID)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(j.Status()); err != nil {
+		ctxu.GetLogger(ah).Errorf("error writing job status: %v", err)
+	}
+}
+
+// job returns the job of the request, adding an error if it is unknown.
+func (ah *adminHandler) job() (*job, bool) {
+	id := ctxu.GetStringValue(ah, "vars.id")
+
+	j, ok := ah.App.jobs.get(id)
+	if !ok {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeJobUnknown.WithDetail(id))
+	}
+	return j, ok
+}
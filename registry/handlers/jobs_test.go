@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestAdminJobs checks that operations started with the async parameter run
+// as jobs which can be listed, polled and canceled.
+func TestAdminJobs(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	orphanFile, orphanDigest, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, orphanDigest, uploadURLBase, orphanFile)
+
+	gcURL, err := ub.BuildGCURL(url.Values{"dryrun": {"true"}, "async": {"true"}})
+	checkErr(t, err, "building gc url")
+	resp, err := http.Post(gcURL, "", nil)
+	checkErr(t, err, "starting gc job")
+	checkResponse(t, "starting gc job", resp, http.StatusAccepted)
+
+	var status admin.Job
+	decodeAdminResponse(t, resp, &status)
+	if status.Type != admin.JobTypeGC || status.ID == "" {
+		t.Fatalf("unexpected job: %+v", status)
+	}
+	jobURL, err := ub.BuildJobURL(status.ID)
+	checkErr(t, err, "building job url")
+	if location := resp.Header.Get("Location"); !strings.HasSuffix(jobURL, location) {
+		t.Fatalf("unexpected job location: %q", location)
+	}
+
+	status = waitJob(t, jobURL)
+	if status.State != admin.JobStateCompleted {
+		t.Fatalf("unexpected gc job state: %+v", status)
+	}
+	var gcResult admin.GCResult
+	if err := json.Unmarshal(status.Result, &gcResult); err != nil {
+		t.Fatalf("error decoding gc result: %v", err)
+	}
+	if !gcResult.DryRun || len(gcResult.Deleted) != 1 || gcResult.Deleted[0] != orphanDigest {
+		t.Fatalf("unexpected gc job result: %#v", gcResult)
+	}
+
+	layoutURL, err := ub.BuildLayoutURL(url.Values{"dryrun": {"true"}, "async": {"true"}})
+	checkErr(t, err, "building layout url")
+	resp, err = http.Post(layoutURL, "", nil)
+	checkErr(t, err, "starting layout migration job")
+	checkResponse(t, "starting layout migration job", resp, http.StatusAccepted)
+	decodeAdminResponse(t, resp, &status)
+	layoutJobURL, err := ub.BuildJobURL(status.ID)
+	checkErr(t, err, "building job url")
+	if status = waitJob(t, layoutJobURL); status.State != admin.JobStateCompleted {
+		t.Fatalf("unexpected layout migration job state: %+v", status)
+	}
+
+	jobsURL, err := ub.BuildJobsURL()
+	checkErr(t, err, "building jobs url")
+	resp, err = http.Get(jobsURL)
+	checkErr(t, err, "listing jobs")
+	checkResponse(t, "listing jobs", resp, http.StatusOK)
+	var jobs admin.JobList
+	decodeAdminResponse(t, resp, &jobs)
+	if len(jobs.Jobs) != 2 || jobs.Jobs[0].Type != admin.JobTypeGC || jobs.Jobs[1].Type != admin.JobTypeLayoutMigration {
+		t.Fatalf("unexpected jobs: %+v", jobs.Jobs)
+	}
+
+	// A running job stops once canceled.
+	blocked := env.app.jobs.start(context.Background(), "test", "", func(ctx context.Context, j *job) (interface{}, error) {
+		<-ctx.Done()
+		return nil, errors.New("stopped")
+	})
+	blockedURL, err := ub.BuildJobURL(blocked.Status().ID)
+	checkErr(t, err, "building job url")
+	req, err := http.NewRequest("DELETE", blockedURL, nil)
+	checkErr(t, err, "building request")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "canceling job")
+	checkResponse(t, "canceling job", resp, http.StatusAccepted)
+	resp.Body.Close()
+	if status = waitJob(t, blockedURL); status.State != admin.JobStateCanceled || status.Error != "stopped" {
+		t.Fatalf("unexpected canceled job: %+v", status)
+	}
+
+	unknownURL, err := ub.BuildJobURL("unknown")
+	checkErr(t, err, "building job url")
+	resp, err = http.Get(unknownURL)
+	checkErr(t, err, "polling unknown job")
+	checkResponse(t, "polling unknown job", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "polling unknown job", resp, admin.ErrorCodeJobUnknown)
+}
+
+// waitJob polls the job at jobURL until it ends.
+func waitJob(t *testing.T, jobURL string) admin.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(jobURL)
+		checkErr(t, err, "polling job")
+		checkResponse(t, "polling job", resp, http.StatusOK)
+
+		var job admin.Job
+		decodeAdminResponse(t, resp, &job)
+		if job.State != admin.JobStateRunning {
+			return job
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not end", job.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/garyburd/redigo/redis"
+	"github.com/gorilla/handlers"
+)
+
+const (
+	// defaultLeaseTTL is how long the lease of the leader lasts unless
+	// renewed, if not configured.
+	defaultLeaseTTL = 30 * time.Second
+
+	// maintenanceLease names the lease held by the instance running the
+	// background maintenance jobs.
+	maintenanceLease = "maintenance"
+)
+
+// leaseStore acquires the lease electing the leader among the registry
+// instances sharing a storage backend.
+type leaseStore interface {
+	// acquire acquires or renews the lease for owner for ttl, unless another
+	// instance holds it, and returns the lease as held after the attempt.
+	acquire(ctx ctxu.Context, owner string, ttl time.Duration) (storage.Lease, error)
+}
+
+// storageLeaseStore keeps the lease in the storage backend. Writes racing to
+// acquire an expired lease are only resolved by the last one winning.
+type storageLeaseStore struct {
+	driver storagedriver.StorageDriver
+}
+
+func (s storageLeaseStore) acquire(ctx ctxu.Context, owner string, ttl time.Duration) (storage.Lease, error) {
+	return storage.AcquireLease(ctx, s.driver, maintenanceLease, owner, ttl)
+}
+
+// acquireLeaseScript sets the lease key to the owner passed as argument if it
+// is unset or already set to it, and returns the owner of the lease with the
+// number of milliseconds it has left.
+var acquireLeaseScript = redis.NewScript(1, `
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return {ARGV[1], tonumber(ARGV[2])}
+end
+return {owner, redis.call("PTTL", KEYS[1])}
+`)
+
+// redisLeaseStore keeps the lease in redis, acquiring it atomically.
+type redisLeaseStore struct {
+	pool *redis.Pool
+}
+
+func (s redisLeaseStore) acquire(ctx ctxu.Context, owner string, ttl time.Duration) (storage.Lease, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	start := time.Now()
+	reply, err := redis.Values(acquireLeaseScript.Do(conn, "leases::"+maintenanceLease, owner, int64(ttl/time.Millisecond)))
+	if err != nil {
+		return storage.Lease{}, err
+	}
+
+	var lease storage.Lease
+	var remaining int64
+	if _, err := redis.Scan(reply, &lease.Owner, &remaining); err != nil {
+		return storage.Lease{}, err
+	}
+	lease.Expires = start.Add(time.Duration(remaining) * time.Millisecond)
+	return lease, nil
+}
+
+// leaderElector elects the registry instance running the background
+// maintenance jobs, among those sharing a storage backend, by holding a lease
+// it renews periodically.
+type leaderElector struct {
+	instance string
+	backend  string
+	ttl      time.Duration
+	store    leaseStore
+
+	mu    sync.Mutex
+	lease storage.Lease
+	// acquired counts the consecutive attempts which found the lease held
+	// by this instance.
+	acquired int
+}
+
+// renew acquires or renews the lease, logging when the instance starts or
+// stops leading.
+func (le *leaderElector) renew(ctx ctxu.Context) {
+	lease, err := le.store.acquire(ctx, le.instance, le.ttl)
+
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	wasLeading := le.leadingLocked(time.Now())
+	if err != nil {
+		// The lease may still be held until it expires.
+		ctxu.GetLogger(ctx).Errorf("leader election: error acquiring lease: %v", err)
+	} else {
+		le.lease = lease
+		if lease.Owner == le.instance {
+			le.acquired++
+		} else {
+			le.acquired = 0
+		}
+	}
+
+	switch leading := le.leadingLocked(time.Now()); {
+	case leading && !wasLeading:
+		ctxu.GetLogger(ctx).Infof("leader election: instance %s is now the leader", le.instance)
+	case !leading && wasLeading:
+		ctxu.GetLogger(ctx).Warnf("leader election: instance %s is no longer the leader, the lease is held by %q", le.instance, le.lease.Owner)
+	}
+}
+
+// leading reports whether the instance holds the lease.
+func (le *leaderElector) leading() bool {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.leadingLocked(time.Now())
+}
+
+// leadingLocked reports whether the instance held the lease at now. An
+// instance only leads once it found the lease held by itself on two
+// consecutive attempts, so that one which lost a race to acquire the lease
+// finds out before running any job.
+func (le *leaderElector) leadingLocked(now time.Time) bool {
+	return le.acquired >= 2 && le.lease.Owner == le.instance && le.lease.Held(now)
+}
+
+// run renews the lease three times per ttl, so that it is kept through a
+// failed renewal.
+func (le *leaderElector) run(ctx ctxu.Context) {
+	for {
+		le.renew(ctx)
+		time.Sleep(le.ttl / 3)
+	}
+}
+
+// configureLeaderElection sets the identity of the instance and starts the
+// election of the leader running the maintenance jobs, as configured by the
+// leaderelection maintenance section.
+func (app *App) configureLeaderElection(config map[interface{}]interface{}) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "registry"
+	}
+	app.instance = hostname + "-" + ctxu.GetStringValue(app, "instance.id")
+	if v, ok := config["instance"]; ok {
+		instance, ok := v.(string)
+		if !ok || instance == "" {
+			panic("leaderelection's instance config key must be a non-empty string")
+		}
+		app.instance = instance
+	}
+
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+	registry.(*expvar.Map).Set("leader", expvar.Func(func() interface{} {
+		leadership := app.leadership()
+		return map[string]interface{}{
+			"Instance": leadership.Instance,
+			"Leader":   leadership.Leader,
+			"Leading":  leadership.Leading,
+		}
+	}))
+
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return
+	}
+
+	le := &leaderElector{
+		instance: app.instance,
+		backend:  "storage",
+		ttl:      defaultLeaseTTL,
+	}
+	if v, ok := config["backend"]; ok {
+		le.backend, ok = v.(string)
+		if !ok {
+			panic("leaderelection's backend config key must be a string")
+		}
+	}
+	switch le.backend {
+	case "storage":
+		le.store = storageLeaseStore{driver: app.driver}
+	case "redis":
+		if app.redis == nil {
+			panic("redis configuration required to use for leader election")
+		}
+		le.store = redisLeaseStore{pool: app.redis}
+	default:
+		panic(fmt.Sprintf("unknown leader election backend %q", le.backend))
+	}
+
+	if v, ok := config["ttl"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("leaderelection's ttl config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Second {
+			panic(fmt.Sprintf("leaderelection's ttl config key is not a valid duration of at least a second: %q", s))
+		}
+		le.ttl = d
+	}
+
+	app.leader = le
+	go le.run(app)
+	ctxu.GetLogger(app).Infof("leader election: instance %s runs the maintenance jobs while holding the %s lease", app.instance, le.backend)
+}
+
+// maintenanceJob registers a background maintenance job of the instance, and
+// returns a function reporting whether it may run: always, unless leader
+// election is enabled and another instance leads.
+func (app *App) maintenanceJob(name string) func() bool {
+	found := false
+	for _, job := range app.maintenanceJobs {
+		found = found || job == name
+	}
+	if !found {
+		app.maintenanceJobs = append(app.maintenanceJobs, name)
+	}
+
+	return func() bool {
+		if app.leader == nil || app.leader.leading() {
+			return true
+		}
+		ctxu.GetLogger(app).Infof("%s: skipped, instance %s is not the leader", name, app.instance)
+		return false
+	}
+}
+
+// leadership describes the instance and the leader running the maintenance
+// jobs.
+func (app *App) leadership() admin.Leadership {
+	leadership := admin.Leadership{
+		Instance: app.instance,
+		Leading:  true,
+		Jobs:     append([]string{}, app.maintenanceJobs...),
+	}
+	if app.leader == nil {
+		return leadership
+	}
+
+	app.leader.mu.Lock()
+	defer app.leader.mu.Unlock()
+
+	now := time.Now()
+	leadership.Election = app.leader.backend
+	leadership.Leading = app.leader.leadingLocked(now)
+	if app.leader.lease.Held(now) {
+		expires := app.leader.lease.Expires
+		leadership.Leader = app.leader.lease.Owner
+		leadership.Expires = &expires
+	}
+	return leadership
+}
+
+// adminLeaderDispatcher reports which instance runs the maintenance jobs.
+func adminLeaderDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetLeader),
+	}
+}
+
+// GetLeader returns the identity of the instance serving the request and the
+// leader running the maintenance jobs.
+func (ah *adminHandler) GetLeader(w http.ResponseWriter, r *http.Request) {
+	ah.serveJSON(w, ah.App.leadership())
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// TestLeaderElection checks that a single instance leads, once it acquired
+// the lease twice, and that another takes over when it stops renewing it.
+func TestLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	store := storageLeaseStore{driver: inmemory.New()}
+	ttl := 100 * time.Millisecond
+	a := &leaderElector{instance: "a", ttl: ttl, store: store}
+	b := &leaderElector{instance: "b", ttl: ttl, store: store}
+
+	a.renew(ctx)
+	b.renew(ctx)
+	if a.leading() || b.leading() {
+		t.Fatalf("instance leading after acquiring the lease once")
+	}
+
+	a.renew(ctx)
+	b.renew(ctx)
+	if !a.leading() || b.leading() {
+		t.Fatalf("unexpected leadership: a %v, b %v", a.leading(), b.leading())
+	}
+
+	time.Sleep(ttl)
+	if a.leading() {
+		t.Fatalf("instance leading with an expired lease")
+	}
+
+	b.renew(ctx)
+	b.renew(ctx)
+	a.renew(ctx)
+	if a.leading() || !b.leading() {
+		t.Fatalf("lease not taken over: a %v, b %v", a.leading(), b.leading())
+	}
+}
+
+// TestAdminLeader checks that the leader route reports the identity of the
+// instance and the maintenance jobs it runs while leading.
+func TestAdminLeader(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{
+				"leaderelection": map[interface{}]interface{}{
+					"enabled":  true,
+					"instance": "registry-1",
+					"ttl":      "1s",
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	if err != nil {
+		t.Fatalf("error creating admin url builder: %v", err)
+	}
+	leaderURL, err := ub.BuildLeaderURL()
+	checkErr(t, err, "building leader url")
+
+	var leadership admin.Leadership
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		resp, err := http.Get(leaderURL)
+		checkErr(t, err, "getting leader")
+		checkResponse(t, "getting leader", resp, http.StatusOK)
+		decodeAdminResponse(t, resp, &leadership)
+		if leadership.Leading {
+			break
+		}
+	}
+
+	if !leadership.Leading || leadership.Instance != "registry-1" || leadership.Leader != "registry-1" || leadership.Election != "storage" || leadership.Expires == nil {
+		t.Fatalf("unexpected leadership: %+v", leadership)
+	}
+	if len(leadership.Jobs) != 1 || leadership.Jobs[0] != "uploadpurging" {
+		t.Fatalf("unexpected maintenance jobs: %v", leadership.Jobs)
+	}
+
+	// Without leader election, every instance runs its maintenance jobs.
+	env = newTestEnv(t, false)
+	defer env.server.Close()
+	if leadership := env.app.leadership(); !leadership.Leading || leadership.Election != "" || leadership.Instance == "" {
+		t.Fatalf("unexpected leadership without election: %+v", leadership)
+	}
+}
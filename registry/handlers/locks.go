@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// defaultLockTTL is how long a lock not released lasts, if not
+	// configured.
+	defaultLockTTL = 30 * time.Second
+
+	// defaultLockTimeout is how long a request waits for a lock held by
+	// another, if not configured.
+	defaultLockTimeout = 10 * time.Second
+)
+
+// unlockScript deletes the lock key if it is set to the token passed as
+// argument.
+var unlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redisLockBackend keeps locks in redis, acquiring them atomically.
+type redisLockBackend struct {
+	pool *redis.Pool
+}
+
+func (b redisLockBackend) TryLock(ctx ctxu.Context, name, token string, ttl time.Duration) (bool, error) {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	reply, err := conn.Do("SET", "locks::"+name, token, "NX", "PX", int64(ttl/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (b redisLockBackend) Unlock(ctx ctxu.Context, name, token string) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	_, err := unlockScript.Do(conn, "locks::"+name, token)
+	return err
+}
+
+// configureLocks returns the lock manager serializing tag updates and
+// manifest deletions, as configured by the locks storage section, or nil if
+// locks are not enabled.
+func (app *App) configureLocks(config configuration.Parameters) *storage.LockManager {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return nil
+	}
+
+	var backend storage.LockBackend
+	name := "storage"
+	if v, ok := config["backend"]; ok {
+		name, ok = v.(string)
+		if !ok {
+			panic("locks' backend config key must be a string")
+		}
+	}
+	switch name {
+	case "storage":
+		backend = storage.NewStorageLockBackend(app.driver)
+	case "redis":
+		if app.redis == nil {
+			panic("redis configuration required to use for locks")
+		}
+		backend = redisLockBackend{pool: app.redis}
+	default:
+		panic(fmt.Sprintf("unknown lock backend %q", name))
+	}
+
+	durations := map[string]time.Duration{
+		"ttl":     defaultLockTTL,
+		"timeout": defaultLockTimeout,
+	}
+	for key := range durations {
+		v, ok := config[key]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			panic(fmt.Sprintf("locks' %s config key must be a string", key))
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("locks' %s config key is not a valid duration: %q", key, s))
+		}
+		durations[key] = d
+	}
+
+	ctxu.GetLogger(app).Infof("locking tag updates and manifest deletions with the %s backend", name)
+	return storage.NewLockManager(backend, durations["ttl"], durations["timeout"])
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestLockedManifestDeletion checks that manifests are tagged and deleted,
+// along with their tags, with locks kept in the storage backend.
+func TestLockedManifestDeletion(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"locks":    configuration.Parameters{"enabled": true, "ttl": "1m", "timeout": "5s"},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	dgst := createRepository(env, t, "foo/bar", "latest")
+
+	named, _ := reference.ParseNamed("foo/bar")
+	ref, _ := reference.WithDigest(named, dgst)
+	u, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := httpDelete(u)
+	checkErr(t, err, "deleting manifest")
+	checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+	tagged, _ := reference.WithTag(named, "latest")
+	u, err = env.builder.BuildManifestURL(tagged)
+	checkErr(t, err, "building manifest url")
+
+	resp, err = http.Get(u)
+	checkErr(t, err, "fetching manifest by tag")
+	checkResponse(t, "fetching manifest by tag", resp, http.StatusNotFound)
+}
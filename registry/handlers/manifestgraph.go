@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// The roles of the nodes of a manifest graph.
+const (
+	graphRoleManifest = "manifest"
+	graphRoleConfig   = "config"
+	graphRoleLayer    = "layer"
+)
+
+type manifestGraphAPIResponse struct {
+	Name      string    `json:"name"`
+	Reference string    `json:"reference"`
+	Root      graphNode `json:"root"`
+
+	// TotalSize is the size of the distinct manifests and blobs of the
+	// graph.
+	TotalSize int64 `json:"totalSize"`
+}
+
+// graphNode is a manifest or blob of a manifest graph.
+type graphNode struct {
+	distribution.Descriptor
+
+	Role string `json:"role"`
+
+	// Platform is the platform of the manifests of a manifest list.
+	Platform *manifestlist.PlatformSpec `json:"platform,omitempty"`
+
+	// Missing is set for the manifests of a manifest list which are not
+	// stored in the repository.
+	Missing bool `json:"missing,omitempty"`
+
+	// Children are the manifests of a manifest list, or the configuration
+	// and layers of a manifest, base layers first.
+	Children []graphNode `json:"children,omitempty"`
+}
+
+// manifestGraphDispatcher constructs the handler of the manifest graph
+// route.
+func manifestGraphDispatcher(ctx *Context, r *http.Request) http.Handler {
+	manifestGraphHandler := &manifestGraphHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.ParseDigest(reference)
+	if err != nil {
+		manifestGraphHandler.Tag = reference
+	} else {
+		manifestGraphHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(manifestGraphHandler.GetManifestGraph),
+	}
+}
+
+// manifestGraphHandler serves the graph of the manifests and blobs of
+// images.
+type manifestGraphHandler struct {
+	*Context
+
+	// One of tag or digest gets set, depending on what is present in context.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetManifestGraph returns the graph of the manifest, down to the blobs of
+// each of the manifests it refers to.
+func (mgh *manifestGraphHandler) GetManifestGraph(w http.ResponseWriter, r *http.Request) {
+	response := manifestGraphAPIResponse{
+		Name:      mgh.Repository.Named().Name(),
+		Reference: mgh.Tag,
+	}
+
+	if mgh.Tag != "" {
+		desc, err := mgh.Repository.Tags(mgh).Get(mgh, mgh.Tag)
+		if err != nil {
+			mgh.Errors = append(mgh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			return
+		}
+		mgh.Digest = desc.Digest
+	} else {
+		response.Reference = mgh.Digest.String()
+	}
+
+	manifests, err := mgh.Repository.Manifests(mgh)
+	if err != nil {
+		mgh.Errors = append(mgh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	response.Root, err = mgh.manifestNode(manifests, distribution.Descriptor{Digest: mgh.Digest})
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			mgh.Errors = append(mgh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			mgh.Errors = append(mgh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	seen := make(map[digest.Digest]bool)
+	var count func(node graphNode)
+	count = func(node graphNode) {
+		if !node.Missing && !seen[node.Digest] {
+			seen[node.Digest] = true
+			response.TotalSize += node.Size
+		}
+		for _, child := range node.Children {
+			count(child)
+		}
+	}
+	count(response.Root)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		mgh.Errors = append(mgh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// manifestNode returns the node of the manifest described by desc and of
+// its children. The media type and size of the manifest are read from its
+// payload when desc does not carry them.
+func (mgh *manifestGraphHandler) manifestNode(manifests distribution.ManifestService, desc distribution.Descriptor) (graphNode, error) {
+	node := graphNode{Descriptor: desc, Role: graphRoleManifest}
+
+	manifest, err := manifests.Get(mgh, desc.Digest)
+	if err != nil {
+		return node, err
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return node, err
+	}
+	if node.MediaType == "" {
+		node.MediaType = mediaType
+	}
+	if node.Size == 0 {
+		node.Size = int64(len(payload))
+	}
+
+	switch m := manifest.(type) {
+	case *manifestlist.DeserializedManifestList:
+		for _, md := range m.Manifests {
+			child, err := mgh.manifestNode(manifests, md.Descriptor)
+			if err != nil {
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+					return node, err
+				}
+				child.Missing = true
+			}
+			platform := md.Platform
+			child.Platform = &platform
+			node.Children = append(node.Children, child)
+		}
+	case *schema2.DeserializedManifest:
+		node.Children = append(node.Children, graphNode{Descriptor: m.Config, Role: graphRoleConfig})
+		for _, layer := range m.Layers {
+			node.Children = append(node.Children, graphNode{Descriptor: layer, Role: graphRoleLayer})
+		}
+	case *schema1.SignedManifest:
+		// Schema1 manifests list their layers top first, without sizes.
+		references := m.References()
+		blobs := mgh.Repository.Blobs(mgh)
+		for i := len(references) - 1; i >= 0; i-- {
+			layer := references[i]
+			desc, err := blobs.Stat(mgh, layer.Digest)
+			if err != nil {
+				return node, err
+			}
+			layer.Size = desc.Size
+			node.Children = append(node.Children, graphNode{Descriptor: layer, Role: graphRoleLayer})
+		}
+	default:
+		for _, ref := range manifest.References() {
+			node.Children = append(node.Children, graphNode{Descriptor: ref, Role: graphRoleLayer})
+		}
+	}
+
+	return node, nil
+}
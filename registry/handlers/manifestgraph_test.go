@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestManifestGraph checks that the graph of a manifest list describes the
+// manifests of each platform, with their configuration and layers.
+func TestManifestGraph(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+	env := newTestEnv(t, false)
+	defer env.server.Close()
+
+	layers := make([]distribution.Descriptor, 3)
+	for i := range layers {
+		layer, layerDigest, err := testutil.CreateRandomTarFile()
+		checkErr(t, err, "creating random layer file")
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+		layers[i] = distribution.Descriptor{
+			Digest:    layerDigest,
+			Size:      int64(10 * (i + 1)),
+			MediaType: schema2.MediaTypeLayer,
+		}
+	}
+
+	image := []byte(`{"architecture":"amd64","os":"linux"}`)
+	imageDigest := digest.FromBytes(image)
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+	config := distribution.Descriptor{
+		Digest:    imageDigest,
+		Size:      int64(len(image)),
+		MediaType: schema2.MediaTypeConfig,
+	}
+
+	put := func(tag, mediaType string, manifest distribution.Manifest) distribution.Descriptor {
+		tagRef, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting manifest", manifestURL, mediaType, manifest)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+		_, payload, err := manifest.Payload()
+		checkErr(t, err, "getting manifest payload")
+		return distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Digest:    digest.FromBytes(payload),
+		}
+	}
+
+	var images []manifestlist.ManifestDescriptor
+	for _, platform := range []struct {
+		architecture string
+		layers       []distribution.Descriptor
+	}{
+		{"amd64", []distribution.Descriptor{layers[0], layers[1]}},
+		{"arm64", []distribution.Descriptor{layers[0], layers[2]}},
+	} {
+		manifest, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    config,
+			Layers:    platform.layers,
+		})
+		checkErr(t, err, "creating manifest")
+		images = append(images, manifestlist.ManifestDescriptor{
+			Descriptor: put(platform.architecture, schema2.MediaTypeManifest, manifest),
+			Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: platform.architecture},
+		})
+	}
+	list, err := manifestlist.FromDescriptors(images)
+	checkErr(t, err, "creating manifest list")
+	listDesc := put("multi", manifestlist.MediaTypeManifestList, list)
+
+	tagRef, _ := reference.WithTag(imageName, "multi")
+	graphURL, err := env.builder.BuildManifestGraphURL(tagRef)
+	checkErr(t, err, "building manifest graph url")
+	resp, err := http.Get(graphURL)
+	checkErr(t, err, "fetching manifest graph")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest graph", resp, http.StatusOK)
+
+	var graph manifestGraphAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&graph); err != nil {
+		t.Fatalf("error decoding manifest graph: %v", err)
+	}
+
+	if graph.Name != imageName.Name() || graph.Reference != "multi" {
+		t.Fatalf("unexpected manifest graph reference: %s:%s", graph.Name, graph.Reference)
+	}
+	root := graph.Root
+	if root.Descriptor != listDesc || root.Role != graphRoleManifest || len(root.Children) != 2 {
+		t.Fatalf("unexpected root of manifest graph: %+v", root)
+	}
+	for i, child := range root.Children {
+		if child.Descriptor != images[i].Descriptor || child.Platform == nil || !reflect.DeepEqual(*child.Platform, images[i].Platform) {
+			t.Fatalf("unexpected manifest of manifest list: %+v", child)
+		}
+		if len(child.Children) != 3 || child.Children[0].Descriptor != config || child.Children[0].Role != graphRoleConfig {
+			t.Fatalf("unexpected children of manifest: %+v", child.Children)
+		}
+		for _, layer := range child.Children[1:] {
+			if layer.Role != graphRoleLayer || layer.Children != nil {
+				t.Fatalf("unexpected layer: %+v", layer)
+			}
+		}
+	}
+
+	expectedSize := listDesc.Size + images[0].Size + images[1].Size + config.Size + 10 + 20 + 30
+	if graph.TotalSize != expectedSize {
+		t.Fatalf("unexpected total size: %d != %d", graph.TotalSize, expectedSize)
+	}
+
+	// the graph of an image manifest, by digest
+	digestRef, _ := reference.WithDigest(imageName, images[1].Digest)
+	graphURL, err = env.builder.BuildManifestGraphURL(digestRef)
+	checkErr(t, err, "building manifest graph url")
+	resp, err = http.Get(graphURL)
+	checkErr(t, err, "fetching manifest graph")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest graph", resp, http.StatusOK)
+
+	graph = manifestGraphAPIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&graph); err != nil {
+		t.Fatalf("error decoding manifest graph: %v", err)
+	}
+	if graph.Reference != images[1].Digest.String() || graph.Root.Digest != images[1].Digest || graph.Root.Platform != nil ||
+		graph.TotalSize != images[1].Size+config.Size+10+30 {
+		t.Fatalf("unexpected manifest graph: %+v", graph)
+	}
+
+	unknownRef, _ := reference.WithTag(imageName, "unknown")
+	graphURL, err = env.builder.BuildManifestGraphURL(unknownRef)
+	checkErr(t, err, "building manifest graph url")
+	resp, err = http.Get(graphURL)
+	checkErr(t, err, "fetching manifest graph")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching graph of unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching graph of unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// TestManifestLimits checks that manifests larger than the limit of their
+// media type are rejected, whether or not their length is sent.
+func TestManifestLimits(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.ManifestLimits.Default = 64
+	config.HTTP.ManifestLimits.MediaTypes = map[string]int64{
+		schema2.MediaTypeManifest: 4096,
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	manifest, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			Digest:    digest.FromBytes([]byte("config")),
+			Size:      6,
+			MediaType: schema2.MediaTypeConfig,
+		},
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, err := manifest.Payload()
+	checkErr(t, err, "getting manifest payload")
+
+	put := func(contentType string, chunked bool) *http.Response {
+		body := ioutil.NopCloser(bytes.NewReader(payload))
+		req, err := http.NewRequest("PUT", manifestURL, body)
+		checkErr(t, err, "creating manifest request")
+		if !chunked {
+			req.ContentLength = int64(len(payload))
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "putting manifest")
+		return resp
+	}
+
+	// the manifest is within the limit of its media type, and is rejected
+	// for its missing config instead
+	resp := put(schema2.MediaTypeManifest+"; charset=utf-8", false)
+	checkResponse(t, "putting manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting manifest", resp, v2.ErrorCodeManifestBlobUnknown)
+	resp.Body.Close()
+
+	for _, chunked := range []bool{false, true} {
+		resp := put("application/vnd.docker.distribution.manifest.v1+json", chunked)
+		checkResponse(t, "putting large manifest", resp, http.StatusRequestEntityTooLarge)
+		checkBodyHasErrorCodes(t, "putting large manifest", resp, v2.ErrorCodeManifestTooLarge)
+		resp.Body.Close()
+	}
+}
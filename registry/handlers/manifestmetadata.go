@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// manifestMetadataDispatcher constructs the handler of the manifest metadata
+// route.
+func manifestMetadataDispatcher(ctx *Context, r *http.Request) http.Handler {
+	manifestMetadataHandler := &manifestMetadataHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.ParseDigest(reference)
+	if err != nil {
+		manifestMetadataHandler.Tag = reference
+	} else {
+		manifestMetadataHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(manifestMetadataHandler.GetManifestMetadata),
+	}
+}
+
+// manifestMetadataHandler serves the metadata indexed for manifests.
+type manifestMetadataHandler struct {
+	*Context
+
+	// One of tag or digest gets set, depending on what is present in context.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetManifestMetadata returns the metadata of the manifest, including the
+// details of its image configuration.
+func (mmh *manifestMetadataHandler) GetManifestMetadata(w http.ResponseWriter, r *http.Request) {
+	if !mmh.manifestIndexEnabled {
+		mmh.Errors = append(mmh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the manifest index is not enabled"))
+		return
+	}
+
+	if mmh.Tag != "" {
+		desc, err := mmh.Repository.Tags(mmh).Get(mmh, mmh.Tag)
+		if err != nil {
+			mmh.Errors = append(mmh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			return
+		}
+		mmh.Digest = desc.Digest
+	}
+
+	manifests, err := mmh.Repository.Manifests(mmh)
+	if err != nil {
+		mmh.Errors = append(mmh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if exists, err := manifests.Exists(mmh, mmh.Digest); err != nil {
+		mmh.Errors = append(mmh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	} else if !exists {
+		mmh.Errors = append(mmh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(mmh.Digest))
+		return
+	}
+
+	name := mmh.Repository.Named().Name()
+	metadata, err := storage.GetManifestMetadata(mmh, mmh.driverFor(name), name, mmh.Digest)
+	if err != nil {
+		if err == storage.ErrManifestMetadataUnknown {
+			mmh.Errors = append(mmh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(fmt.Sprintf("manifest %s has no metadata", mmh.Digest)))
+		} else {
+			mmh.Errors = append(mmh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(metadata); err != nil {
+		mmh.Errors = append(mmh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
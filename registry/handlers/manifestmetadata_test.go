@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestManifestMetadata checks that the details of the image configuration of
+// a manifest are returned by the metadata endpoint.
+func TestManifestMetadata(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory":      configuration.Parameters{},
+			"manifestindex": configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	layer, layerDigest, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+
+	image := []byte(`{"architecture":"arm64","os":"linux","config":{"Entrypoint":["/bin/app"],"Cmd":["serve"],"ExposedPorts":{"8080/tcp":{}},"Labels":{"stage":"prod"}}}`)
+	imageDigest := digest.FromBytes(image)
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+
+	manifest := &schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			Digest:    imageDigest,
+			Size:      int64(len(image)),
+			MediaType: schema2.MediaTypeConfig,
+		},
+		Layers: []distribution.Descriptor{
+			{
+				Digest:    layerDigest,
+				Size:      1,
+				MediaType: schema2.MediaTypeLayer,
+			},
+		},
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, manifest)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+	dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+	checkErr(t, err, "parsing manifest digest")
+
+	metadataURL, err := env.builder.BuildManifestMetadataURL(tagRef)
+	checkErr(t, err, "building manifest metadata url")
+	resp, err = http.Get(metadataURL)
+	checkErr(t, err, "getting manifest metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "getting manifest metadata", resp, http.StatusOK)
+
+	var metadata storage.ManifestMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		t.Fatalf("error decoding manifest metadata: %v", err)
+	}
+	if metadata.Digest != dgst || metadata.Labels["stage"] != "prod" || metadata.Image == nil {
+		t.Fatalf("unexpected manifest metadata: %+v", metadata)
+	}
+	expected := storage.ImageMetadata{
+		Architecture: "arm64",
+		OS:           "linux",
+		Entrypoint:   []string{"/bin/app"},
+		Cmd:          []string{"serve"},
+		ExposedPorts: []string{"8080/tcp"},
+	}
+	if !reflect.DeepEqual(*metadata.Image, expected) {
+		t.Fatalf("unexpected image metadata: %+v", metadata.Image)
+	}
+
+	unknownRef, _ := reference.WithTag(imageName, "unknown")
+	metadataURL, err = env.builder.BuildManifestMetadataURL(unknownRef)
+	checkErr(t, err, "building manifest metadata url")
+	resp, err = http.Get(metadataURL)
+	checkErr(t, err, "getting manifest metadata")
+	defer resp.Body.Close()
+	checkResponse(t, "getting metadata of unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting metadata of unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
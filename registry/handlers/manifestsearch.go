@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+type manifestSearchAPIResponse struct {
+	Name      string                     `json:"name"`
+	Manifests []storage.ManifestMetadata `json:"manifests"`
+}
+
+// manifestSearchDispatcher constructs the handler of the manifest search
+// route.
+func manifestSearchDispatcher(ctx *Context, r *http.Request) http.Handler {
+	manifestSearchHandler := &manifestSearchHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(manifestSearchHandler.GetManifests),
+	}
+}
+
+// manifestSearchHandler finds the manifests of a repository by their
+// metadata.
+type manifestSearchHandler struct {
+	*Context
+}
+
+// GetManifests returns the metadata of the manifests of the repository
+// selected by the annotation and label parameters of the request.
+func (msh *manifestSearchHandler) GetManifests(w http.ResponseWriter, r *http.Request) {
+	if !msh.manifestIndexEnabled {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the manifest index is not enabled"))
+		return
+	}
+
+	q := r.URL.Query()
+	annotations, err := parseSelectors(q["annotation"])
+	if err != nil {
+		msh.Errors = append(msh.Errors, v2.ErrorCodeSelectorInvalid.WithDetail(err.Error()))
+		return
+	}
+	labels, err := parseSelectors(q["label"])
+	if err != nil {
+		msh.Errors = append(msh.Errors, v2.ErrorCodeSelectorInvalid.WithDetail(err.Error()))
+		return
+	}
+
+	name := msh.Repository.Named().Name()
+	storageDriver := msh.driverFor(name)
+
+	exists, err := storage.RepositoryExists(msh, storageDriver, name)
+	if err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		msh.Errors = append(msh.Errors, v2.ErrorCodeNameUnknown.WithDetail(distribution.ErrRepositoryUnknown{Name: name}))
+		return
+	}
+
+	manifests, err := storage.SelectManifests(msh, storageDriver, name, storage.ManifestSelector{
+		Annotations: annotations,
+		Labels:      labels,
+	})
+	if err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if manifests == nil {
+		manifests = []storage.ManifestMetadata{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(manifestSearchAPIResponse{
+		Name:      name,
+		Manifests: manifests,
+	}); err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// parseSelectors parses selectors of the form <key>=<pattern> into a map of
+// patterns by key.
+func parseSelectors(selectors []string) (map[string]string, error) {
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	patterns := make(map[string]string, len(selectors))
+	for _, selector := range selectors {
+		i := strings.Index(selector, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("selector %q is not of the form <key>=<pattern>", selector)
+		}
+		patterns[selector[:i]] = selector[i+1:]
+	}
+	return patterns, nil
+}
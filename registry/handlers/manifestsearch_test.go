@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestManifestSearch checks that the manifests of a repository can be found
+// by their annotations and configuration labels once the index is enabled.
+func TestManifestSearch(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	env := newTestEnv(t, false)
+	searchURL, err := env.builder.BuildManifestSearchURL(imageName)
+	checkErr(t, err, "building manifest search url")
+	resp, err := http.Get(searchURL)
+	checkErr(t, err, "searching manifests")
+	defer resp.Body.Close()
+	checkResponse(t, "searching manifests without index", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "searching manifests without index", resp, errcode.ErrorCodeUnsupported)
+	env.server.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory":      configuration.Parameters{},
+			"manifestindex": configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env = newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	searchURL, err = env.builder.BuildManifestSearchURL(imageName)
+	checkErr(t, err, "building manifest search url")
+	resp, err = http.Get(searchURL)
+	checkErr(t, err, "searching manifests")
+	defer resp.Body.Close()
+	checkResponse(t, "searching manifests of unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "searching manifests of unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	layer, layerDigest, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+
+	push := func(tag, version, stage string) digest.Digest {
+		image := []byte(`{"config":{"Labels":{"stage":"` + stage + `"}}}`)
+		imageDigest := digest.FromBytes(image)
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+
+		manifest := struct {
+			schema2.Manifest
+			Annotations map[string]string `json:"annotations"`
+		}{
+			Manifest: schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config: distribution.Descriptor{
+					Digest:    imageDigest,
+					Size:      int64(len(image)),
+					MediaType: schema2.MediaTypeConfig,
+				},
+				Layers: []distribution.Descriptor{
+					{
+						Digest:    layerDigest,
+						Size:      1,
+						MediaType: schema2.MediaTypeLayer,
+					},
+				},
+			},
+			Annotations: map[string]string{"org.opencontainers.image.version": version},
+		}
+
+		tagRef, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, manifest)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+		dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+		checkErr(t, err, "parsing manifest digest")
+		return dgst
+	}
+
+	prod := push("v1.2.0", "1.2.0", "prod")
+	push("v1.3.0", "1.3.0", "prod")
+	push("v1.2.1-rc1", "1.2.1-rc1", "dev")
+
+	searchURL, err = env.builder.BuildManifestSearchURL(imageName, url.Values{
+		"annotation": {"org.opencontainers.image.version=1.2.*"},
+		"label":      {"stage=prod"},
+	})
+	checkErr(t, err, "building manifest search url")
+	resp, err = http.Get(searchURL)
+	checkErr(t, err, "searching manifests")
+	defer resp.Body.Close()
+	checkResponse(t, "searching manifests", resp, http.StatusOK)
+
+	var result manifestSearchAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding search result: %v", err)
+	}
+	if result.Name != imageName.Name() || len(result.Manifests) != 1 {
+		t.Fatalf("unexpected search result: %+v", result)
+	}
+	if m := result.Manifests[0]; m.Digest != prod || m.MediaType != schema2.MediaTypeManifest || m.Annotations["org.opencontainers.image.version"] != "1.2.0" || m.Labels["stage"] != "prod" {
+		t.Fatalf("unexpected manifest found: %+v", m)
+	}
+
+	searchURL, err = env.builder.BuildManifestSearchURL(imageName, url.Values{"label": {"stage"}})
+	checkErr(t, err, "building manifest search url")
+	resp, err = http.Get(searchURL)
+	checkErr(t, err, "searching manifests")
+	defer resp.Body.Close()
+	checkResponse(t, "searching manifests with invalid selector", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "searching manifests with invalid selector", resp, v2.ErrorCodeSelectorInvalid)
+}
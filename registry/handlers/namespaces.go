@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	memorycache "github.com/docker/distribution/registry/storage/cache/memory"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/version"
+)
+
+// namespaceStorage is the storage of the repositories of top-level
+// namespaces, configured apart from the registry's storage.
+type namespaceStorage struct {
+	names    []string
+	region   string
+	driver   storagedriver.StorageDriver
+	registry distribution.Namespace
+
+	// catalog lists the repositories of the namespaces, or is nil if the
+	// catalog is not indexed.
+	catalog *storage.CatalogIndex
+}
+
+// configureNamespaces creates a storage driver and registry for each
+// namespace storage configuration and routes repositories to them by their
+// top-level namespace. The registries are created with the given options,
+// those of the registry's storage.
+func (app *App) configureNamespaces(config *configuration.Configuration, options []storage.RegistryOption) {
+	if len(config.Namespaces) == 0 {
+		return
+	}
+	if app.isCache {
+		panic("namespace storage is not supported by a pull through cache")
+	}
+
+	// Blob descriptors are cached by digest, so that a cache may not be
+	// shared by registries with distinct storage. Namespaces get their own
+	// in-memory cache if caching is configured.
+	_, cached := config.Storage["cache"]
+
+	purgeConfig := uploadPurgeDefaultConfig()
+	if mc, ok := config.Storage["maintenance"]; ok {
+		if v, ok := mc["uploadpurging"]; ok {
+			purgeConfig = v.(map[interface{}]interface{})
+		}
+	}
+
+	router := &namespaceRouter{
+		defaultNamespace: app.registry,
+		namespaces:       make(map[string]*namespaceStorage),
+	}
+
+	for i, nc := range config.Namespaces {
+		if len(nc.Names) == 0 {
+			panic(fmt.Sprintf("namespace storage %d lists no namespaces", i))
+		}
+
+		storageType := nc.Storage.Type()
+		if storageType == "" {
+			panic(fmt.Sprintf("namespace storage %d configures no storage driver", i))
+		}
+
+		params := nc.Storage.Parameters()
+		if params == nil {
+			params = make(configuration.Parameters)
+		}
+		params["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
+
+		driver, err := factory.Create(storageType, params)
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure storage of namespaces %v: %v", nc.Names, err))
+		}
+
+		startUploadPurger(app, driver, ctxu.GetLogger(app), purgeConfig)
+
+		localOptions := options
+		if cached {
+			localOptions = append(localOptions[:len(localOptions):len(localOptions)], storage.BlobDescriptorCacheProvider(memorycache.NewInMemoryBlobDescriptorCacheProvider()))
+		}
+
+		// The catalog of the namespaces is indexed in their own storage.
+		var catalog *storage.CatalogIndex
+		if app.catalogIndex != nil {
+			catalog = storage.NewCatalogIndex(driver, app.locks)
+			localOptions = append(localOptions[:len(localOptions):len(localOptions)], storage.IndexCatalog(catalog))
+		}
+
+		registry, err := storage.NewRegistry(app, driver, localOptions...)
+		if err != nil {
+			panic("could not create registry: " + err.Error())
+		}
+
+		registry, err = applyRegistryMiddleware(app, registry, config.Middleware["registry"])
+		if err != nil {
+			panic(err)
+		}
+
+		ns := &namespaceStorage{
+			names:    nc.Names,
+			region:   nc.Region,
+			driver:   driver,
+			registry: registry,
+			catalog:  catalog,
+		}
+		for _, name := range nc.Names {
+			if name == "" || strings.Contains(name, "/") {
+				panic(fmt.Sprintf("invalid top-level namespace %q", name))
+			}
+			if _, ok := router.namespaces[name]; ok {
+				panic(fmt.Sprintf("storage of namespace %q configured more than once", name))
+			}
+			router.namespaces[name] = ns
+		}
+		router.storages = append(router.storages, ns)
+
+		ctxu.GetLogger(app).Infof("storing namespaces %v with the %s storage driver", nc.Names, storageType)
+	}
+
+	app.namespaces = router
+	app.registry = router
+}
+
+// namespaceStorageFor returns the storage of the top-level namespace of the
+// named repository, or nil if it is stored with the registry's storage.
+func (app *App) namespaceStorageFor(name string) *namespaceStorage {
+	if app.namespaces == nil {
+		return nil
+	}
+	return app.namespaces.namespaces[topLevelNamespace(name)]
+}
+
+// driverFor returns the storage driver of the named repository.
+func (app *App) driverFor(name string) storagedriver.StorageDriver {
+	if ns := app.namespaceStorageFor(name); ns != nil {
+		return ns.driver
+	}
+	return app.driver
+}
+
+// topLevelNamespace returns the first component of a repository name.
+func topLevelNamespace(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// namespaceRouter is a distribution.Namespace resolving each repository, at
+// request time, with the registry of its top-level namespace.
+type namespaceRouter struct {
+	defaultNamespace distribution.Namespace
+	namespaces       map[string]*namespaceStorage
+	storages         []*namespaceStorage
+}
+
+var _ distribution.Namespace = &namespaceRouter{}
+
+func (nr *namespaceRouter) Scope() distribution.Scope {
+	return distribution.GlobalScope
+}
+
+func (nr *namespaceRouter) Repository(ctx ctxu.Context, name reference.Named) (distribution.Repository, error) {
+	if ns, ok := nr.namespaces[topLevelNamespace(name.Name())]; ok {
+		return ns.registry.Repository(ctx, name)
+	}
+	return nr.defaultNamespace.Repository(ctx, name)
+}
+
+// Repositories merges the catalogs of the registry's storage and of each
+// namespace storage. Repositories found in a storage other than the one
+// their namespace is routed to are left out, as they cannot be accessed.
+func (nr *namespaceRouter) Repositories(ctx ctxu.Context, repos []string, last string) (int, error) {
+	var (
+		merged []string
+		done   = true
+	)
+
+	names, eof, err := listRepositories(ctx, nr.defaultNamespace, len(repos), last, func(name string) bool {
+		_, ok := nr.namespaces[topLevelNamespace(name)]
+		return !ok
+	})
+	if err != nil {
+		return 0, err
+	}
+	merged = append(merged, names...)
+	done = done && eof
+
+	for _, ns := range nr.storages {
+		ns := ns
+		names, eof, err := listRepositories(ctx, ns.registry, len(repos), last, func(name string) bool {
+			return nr.namespaces[topLevelNamespace(name)] == ns
+		})
+		if err != nil {
+			return 0, err
+		}
+		merged = append(merged, names...)
+		done = done && eof
+	}
+
+	sort.Strings(merged)
+	n := copy(repos, merged)
+	if done && len(merged) <= len(repos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// listRepositories returns up to n repositories of the namespace, after last,
+// for which keep returns true, and whether the catalog was exhausted.
+func listRepositories(ctx ctxu.Context, namespace distribution.Namespace, n int, last string, keep func(string) bool) ([]string, bool, error) {
+	var names []string
+	page := make([]string, n)
+
+	for len(names) < n {
+		filled, err := namespace.Repositories(ctx, page, last)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			// No repository was stored yet.
+			return names, true, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, false, err
+		}
+
+		for _, name := range page[:filled] {
+			if keep(name) && len(names) < n {
+				names = append(names, name)
+			}
+		}
+
+		if err == io.EOF || filled == 0 {
+			return names, true, nil
+		}
+		last = page[filled-1]
+	}
+	return names, false, nil
+}
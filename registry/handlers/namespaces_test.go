@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// TestNamespaceStorage checks that the repositories of a namespace are stored
+// with the storage configured for it, and listed along with the others.
+func TestNamespaceStorage(t *testing.T) {
+	root, err := ioutil.TempDir("", "namespaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defaultRoot := filepath.Join(root, "default")
+	tenantRoot := filepath.Join(root, "tenant")
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"filesystem": configuration.Parameters{"rootdirectory": defaultRoot},
+		},
+		Namespaces: []configuration.NamespaceStorage{
+			{
+				Names: []string{"acme", "globex"},
+				Storage: configuration.Storage{
+					"filesystem": configuration.Parameters{"rootdirectory": tenantRoot},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+
+	createRepository(env, t, "acme/app", "latest")
+	createRepository(env, t, "globex/app", "latest")
+	createRepository(env, t, "library/app", "latest")
+
+	repositories := filepath.Join("docker", "registry", "v2", "repositories")
+	for _, tc := range []struct {
+		root, name string
+		exists     bool
+	}{
+		{tenantRoot, "acme/app", true},
+		{tenantRoot, "globex/app", true},
+		{tenantRoot, "library/app", false},
+		{defaultRoot, "acme/app", false},
+		{defaultRoot, "library/app", true},
+	} {
+		_, err := os.Stat(filepath.Join(tc.root, repositories, tc.name))
+		if exists := err == nil; exists != tc.exists {
+			t.Errorf("repository %s stored in %s: %v, expected %v", tc.name, tc.root, exists, tc.exists)
+		}
+	}
+
+	catalog := func(values url.Values) ([]string, bool) {
+		u, err := env.builder.BuildCatalogURL(values)
+		checkErr(t, err, "building catalog url")
+		resp, err := http.Get(u)
+		checkErr(t, err, "fetching catalog")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching catalog", resp, http.StatusOK)
+
+		var body catalogAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding catalog: %v", err)
+		}
+		return body.Repositories, resp.Header.Get("Link") != ""
+	}
+
+	expected := []string{"acme/app", "globex/app", "library/app"}
+	if repos, more := catalog(nil); !reflect.DeepEqual(repos, expected) || more {
+		t.Fatalf("unexpected catalog: %v, more: %v", repos, more)
+	}
+
+	var paged []string
+	last := ""
+	for {
+		repos, more := catalog(url.Values{"n": {"2"}, "last": {last}})
+		paged = append(paged, repos...)
+		if !more {
+			break
+		}
+		last = repos[len(repos)-1]
+	}
+	if !reflect.DeepEqual(paged, expected) {
+		t.Fatalf("unexpected paginated catalog: %v", paged)
+	}
+}
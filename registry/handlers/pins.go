@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+func adminGCPinsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(ah.GetPins),
+		"POST":   http.HandlerFunc(ah.PostPin),
+		"DELETE": http.HandlerFunc(ah.DeletePin),
+	}
+}
+
+// GetPins lists the pins protecting content from garbage collection, those of
+// the configuration first.
+func (ah *adminHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	pins, err := storage.Pins(ah, ah.driver)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	list := admin.PinList{Pins: []admin.Pin{}}
+	for _, pin := range ah.gcPins {
+		list.Pins = append(list.Pins, admin.Pin{
+			Digest:     pin.Digest,
+			Repository: pin.Repository,
+			Configured: true,
+		})
+	}
+	for _, pin := range pins {
+		list.Pins = append(list.Pins, admin.Pin{
+			Digest:     pin.Digest,
+			Repository: pin.Repository,
+			Comment:    pin.Comment,
+			Created:    pin.Created,
+		})
+	}
+
+	ah.serveJSON(w, list)
+}
+
+// PostPin stores a pin, replacing any pin of the same digest or repository.
+func (ah *adminHandler) PostPin(w http.ResponseWriter, r *http.Request) {
+	var body admin.Pin
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+
+	pin := storage.Pin{
+		Digest:     body.Digest,
+		Repository: body.Repository,
+		Comment:    body.Comment,
+		Created:    time.Now().UTC(),
+	}
+	if err := pin.Validate(); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+
+	if err := storage.AddPin(ah, ah.driver, pin); err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: pinned %s%s", pin.Digest, pin.Repository)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(admin.Pin{
+		Digest:     pin.Digest,
+		Repository: pin.Repository,
+		Comment:    pin.Comment,
+		Created:    pin.Created,
+	}); err != nil {
+		ctxu.GetLogger(ah).Errorf("error writing pin: %v", err)
+	}
+}
+
+// DeletePin removes the stored pin of the digest or repository set by the
+// query parameters.
+func (ah *adminHandler) DeletePin(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pin := storage.Pin{Repository: q.Get("repository")}
+	if d := q.Get("digest"); d != "" {
+		dgst, err := digest.ParseDigest(d)
+		if err != nil {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid digest %q", d)))
+			return
+		}
+		pin.Digest = dgst
+	}
+	if err := pin.Validate(); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+
+	if err := storage.RemovePin(ah, ah.driver, pin); err != nil {
+		if err == storage.ErrPinUnknown {
+			ah.Errors = append(ah.Errors, admin.ErrorCodePinUnknown.WithDetail(map[string]string{"digest": pin.Digest.String(), "repository": pin.Repository}))
+		} else {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: unpinned %s%s", pin.Digest, pin.Repository)
+	w.WriteHeader(http.StatusAccepted)
+}
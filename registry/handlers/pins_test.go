@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestGCPins checks that the pins of the configuration and those added
+// through the admin API keep content from being garbage collected.
+func TestGCPins(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"gc":       configuration.Parameters{"pins": []interface{}{"releases/*"}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+
+	// Push layers which no manifest references.
+	pushOrphan := func(name string) digest.Digest {
+		named, _ := reference.ParseNamed(name)
+		layer, dgst, err := testutil.CreateRandomTarFile()
+		checkErr(t, err, "creating random layer file")
+		uploadURLBase, _ := startPushLayer(t, env.builder, named)
+		pushLayer(t, env.builder, named, dgst, uploadURLBase, layer)
+		return dgst
+	}
+	pushOrphan("releases/v1")
+	pinned := pushOrphan("foo/bar")
+
+	pinsURL, err := ub.BuildGCPinsURL()
+	checkErr(t, err, "building gc pins url")
+
+	resp, err := http.Post(pinsURL, "application/json", strings.NewReader(`{"digest":"`+pinned.String()+`","comment":"base image"}`))
+	checkErr(t, err, "adding pin")
+	checkResponse(t, "adding pin", resp, http.StatusCreated)
+
+	resp, err = http.Post(pinsURL, "application/json", strings.NewReader(`{"digest":"sha256:invalid"}`))
+	checkErr(t, err, "adding invalid pin")
+	checkResponse(t, "adding invalid pin", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "adding invalid pin", resp, admin.ErrorCodeRequestInvalid)
+
+	resp, err = http.Get(pinsURL)
+	checkErr(t, err, "listing pins")
+	checkResponse(t, "listing pins", resp, http.StatusOK)
+
+	var pins admin.PinList
+	decodeAdminResponse(t, resp, &pins)
+	if len(pins.Pins) != 2 || !pins.Pins[0].Configured || pins.Pins[0].Repository != "releases/*" ||
+		pins.Pins[1].Configured || pins.Pins[1].Digest != pinned || pins.Pins[1].Comment != "base image" {
+		t.Fatalf("unexpected pins: %+v", pins.Pins)
+	}
+
+	// Pins of the configuration cannot be removed.
+	configuredURL, err := ub.BuildGCPinsURL(url.Values{"repository": {"releases/*"}})
+	checkErr(t, err, "building gc pins url")
+
+	resp, err = httpDelete(configuredURL)
+	checkErr(t, err, "removing configured pin")
+	checkResponse(t, "removing configured pin", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "removing configured pin", resp, admin.ErrorCodePinUnknown)
+
+	dryRunURL, err := ub.BuildGCURL(url.Values{"dryrun": {"true"}})
+	checkErr(t, err, "building gc url")
+
+	resp, err = http.Post(dryRunURL, "", nil)
+	checkErr(t, err, "running gc dry run")
+	checkResponse(t, "running gc dry run", resp, http.StatusOK)
+
+	var gcResult admin.GCResult
+	decodeAdminResponse(t, resp, &gcResult)
+	if len(gcResult.Deleted) != 0 {
+		t.Fatalf("pinned blobs would be deleted: %v", gcResult.Deleted)
+	}
+
+	pinnedURL, err := ub.BuildGCPinsURL(url.Values{"digest": {pinned.String()}})
+	checkErr(t, err, "building gc pins url")
+
+	resp, err = httpDelete(pinnedURL)
+	checkErr(t, err, "removing pin")
+	checkResponse(t, "removing pin", resp, http.StatusAccepted)
+
+	resp, err = http.Post(dryRunURL, "", nil)
+	checkErr(t, err, "running gc dry run")
+	checkResponse(t, "running gc dry run", resp, http.StatusOK)
+
+	decodeAdminResponse(t, resp, &gcResult)
+	if len(gcResult.Deleted) != 1 || gcResult.Deleted[0] != pinned {
+		t.Fatalf("unexpected dry run result: %v", gcResult.Deleted)
+	}
+}
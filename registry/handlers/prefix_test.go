@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestPrefixGeneratedURLs checks that the URLs generated by a registry served
+// under a prefix include it, whether or not the configured host does.
+func TestPrefixGeneratedURLs(t *testing.T) {
+	for _, tc := range []struct {
+		host     string
+		expected string
+	}{
+		{"", "/registry/v2/foo/bar/blobs/uploads/"},
+		{"https://registry.example.com", "https://registry.example.com/registry/v2/foo/bar/blobs/uploads/"},
+		{"https://registry.example.com/other/", "https://registry.example.com/other/v2/foo/bar/blobs/uploads/"},
+	} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+			},
+		}
+		config.HTTP.Prefix = "registry"
+		config.HTTP.Host = tc.host
+		config.HTTP.Headers = headerConfig
+		env := newTestEnvWithConfig(t, &config)
+
+		if env.config.HTTP.Prefix != "/registry/" {
+			t.Fatalf("unexpected prefix: %q", env.config.HTTP.Prefix)
+		}
+
+		name, _ := reference.ParseNamed("foo/bar")
+		u, err := env.builder.BuildBlobUploadURL(name)
+		checkErr(t, err, "building upload url")
+		resp, err := http.Post(u, "", nil)
+		checkErr(t, err, "starting upload")
+		resp.Body.Close()
+		checkResponse(t, "starting upload", resp, http.StatusAccepted)
+
+		expected := tc.expected
+		if tc.host == "" {
+			expected = env.server.URL + expected
+		}
+		if location := resp.Header.Get("Location"); !strings.HasPrefix(location, expected) {
+			t.Errorf("unexpected location for host %q: %q", tc.host, location)
+		}
+
+		env.server.Close()
+	}
+}
+
+// TestPrefixCatalogLink checks that the catalog pagination links of a
+// registry served under a prefix include it.
+func TestPrefixCatalogLink(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Prefix = "/registry/"
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	createRepository(env, t, "foo/aaa", "latest")
+	createRepository(env, t, "foo/bbb", "latest")
+
+	u, err := env.builder.BuildCatalogURL(url.Values{"n": {"1"}})
+	checkErr(t, err, "building catalog url")
+	resp, err := http.Get(u)
+	checkErr(t, err, "fetching catalog")
+	resp.Body.Close()
+	checkResponse(t, "fetching catalog", resp, http.StatusOK)
+
+	if link := resp.Header.Get("Link"); link != `</registry/v2/_catalog?last=foo%2Faaa&n=1>; rel="next"` {
+		t.Fatalf("unexpected link: %q", link)
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/proxy"
+	"github.com/gorilla/handlers"
+)
+
+// maxPrewarmJobs is the number of prewarm jobs whose status is retained.
+const maxPrewarmJobs = 100
+
+// prewarmConcurrency is the number of blobs a prewarm job fetches at once.
+const prewarmConcurrency = 4
+
+// prewarmJob fetches manifests and their blobs into the pull through cache
+// in the background, tracking its progress.
+type prewarmJob struct {
+	mu     sync.Mutex
+	status admin.PrewarmStatus
+
+	// job runs the prewarm job, tracking its progress among the other
+	// jobs of the registry.
+	job *job
+}
+
+// Status returns a copy of the status of the job.
+func (job *prewarmJob) Status() admin.PrewarmStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	status := job.status
+	status.Errors = append([]string(nil), job.status.Errors...)
+	return status
+}
+
+func (job *prewarmJob) update(f func(status *admin.PrewarmStatus)) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	f(&job.status)
+
+	if job.job != nil {
+		job.job.setProgress("blobs", int64(job.status.Blobs))
+		job.job.setProgress("completed", int64(job.status.Completed))
+		job.job.setProgress("fetched", int64(job.status.Fetched))
+		job.job.setProgress("bytes", job.status.Bytes)
+	}
+}
+
+func (job *prewarmJob) fail(format string, args ...interface{}) {
+	job.update(func(status *admin.PrewarmStatus) {
+		status.Errors = append(status.Errors, fmt.Sprintf(format, args...))
+	})
+}
+
+// run resolves the references of the job to the blobs of their manifests, and
+// fetches the blobs into the cache. It returns an error if the job failed or
+// was canceled.
+func (job *prewarmJob) run(ctx ctxu.Context, repo distribution.Repository, references []string) error {
+	var blobs []distribution.Descriptor
+	seen := make(map[digest.Digest]struct{})
+	for _, ref := range references {
+		if ctx.Err() != nil {
+			break
+		}
+		descs, err := proxy.ResolveBlobs(ctx, repo, ref)
+		if err != nil {
+			job.fail("%s: %v", ref, err)
+			continue
+		}
+
+		for _, desc := range descs {
+			if _, ok := seen[desc.Digest]; ok {
+				continue
+			}
+			seen[desc.Digest] = struct{}{}
+			blobs = append(blobs, desc)
+		}
+		job.update(func(status *admin.PrewarmStatus) {
+			status.Blobs = len(blobs)
+		})
+	}
+
+	queue := make(chan distribution.Descriptor)
+	var wg sync.WaitGroup
+	for i := 0; i < prewarmConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for desc := range queue {
+				fetched, err := proxy.PrefetchBlob(ctx, repo, desc.Digest)
+				if err != nil {
+					job.fail("%s: %v", desc.Digest, err)
+					continue
+				}
+
+				job.update(func(status *admin.PrewarmStatus) {
+					status.Completed++
+					if fetched {
+						status.Fetched++
+						status.Bytes += desc.Size
+					}
+				})
+			}
+		}()
+	}
+queue:
+	for _, desc := range blobs {
+		select {
+		case queue <- desc:
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	job.update(func(status *admin.PrewarmStatus) {
+		finished := time.Now().UTC()
+		status.Finished = &finished
+		status.State = admin.PrewarmStateCompleted
+		if ctx.Err() != nil {
+			status.State = admin.PrewarmStateCanceled
+		} else if len(status.Errors) > 0 {
+			status.State = admin.PrewarmStateFailed
+		}
+	})
+
+	status := job.Status()
+	ctxu.GetLogger(ctx).Infof("admin: prewarm %s of %s %s: %d of %d blobs cached, %d fetched (%d bytes)", status.ID, status.Name, status.State, status.Completed, status.Blobs, status.Fetched, status.Bytes)
+
+	switch status.State {
+	case admin.PrewarmStateCanceled:
+		return ctx.Err()
+	case admin.PrewarmStateFailed:
+		return fmt.Errorf("%d references or blobs could not be fetched", len(status.Errors))
+	}
+	return nil
+}
+
+// prewarmJobs retains the most recent prewarm jobs, so that their status can
+// be polled.
+type prewarmJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*prewarmJob
+	order []string
+}
+
+func (pj *prewarmJobs) add(job *prewarmJob) {
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+
+	if pj.jobs == nil {
+		pj.jobs = make(map[string]*prewarmJob)
+	}
+
+	id := job.Status().ID
+	pj.jobs[id] = job
+	pj.order = append(pj.order, id)
+	for len(pj.order) > maxPrewarmJobs {
+		delete(pj.jobs, pj.order[0])
+		pj.order = pj.order[1:]
+	}
+}
+
+func (pj *prewarmJobs) get(id string) (*prewarmJob, bool) {
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+
+	job, ok := pj.jobs[id]
+	return job, ok
+}
+
+func adminPrewarmDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(ah.Prewarm),
+	}
+}
+
+// Prewarm starts a job fetching the manifests referenced by the request body,
+// and their blobs, into the pull through cache. It returns the status of the
+// job, whose progress can be polled with the prewarm status route.
+func (ah *adminHandler) Prewarm(w http.ResponseWriter, r *http.Request) {
+	if !ah.isCache {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("prewarming is only supported by a pull through cache"))
+		return
+	}
+
+	var req admin.PrewarmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+	if len(req.References) == 0 {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail("no references to prewarm"))
+		return
+	}
+
+	name := ah.Repository.Named()
+
+	// The job outlives the request, so it uses a repository of its own,
+	// bound to the context of the registry.
+	ctx := detachedContext(ah.App, ah)
+	repo, err := ah.App.registry.Repository(ctx, name)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	pj := &prewarmJob{
+		status: admin.PrewarmStatus{
+			Name:       name.Name(),
+			References: req.References,
+			State:      admin.PrewarmStateRunning,
+			Started:    time.Now().UTC(),
+		},
+	}
+	// The prewarm job only runs once it is tracked under the id of the job
+	// running it.
+	started := make(chan struct{})
+	j := ah.App.jobs.start(ctx, admin.JobTypePrewarm, name.Name(), func(ctx ctxu.Context, j *job) (interface{}, error) {
+		<-started
+		return nil, pj.run(ctx, repo, req.References)
+	})
+	pj.update(func(status *admin.PrewarmStatus) {
+		status.ID = j.Status().ID
+	})
+	pj.job = j
+	ah.App.prewarmJobs.add(pj)
+	close(started)
+
+	ctxu.GetLogger(ah).Infof("admin: started prewarm %s of %s: %v", j.Status().ID, name.Name(), req.References)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(pj.Status()); err != nil {
+		ctxu.GetLogger(ah).Errorf("error writing prewarm status: %v", err)
+	}
+}
+
+func adminPrewarmStatusDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetPrewarmStatus),
+	}
+}
+
+// GetPrewarmStatus returns the status of a prewarm job.
+func (ah *adminHandler) GetPrewarmStatus(w http.ResponseWriter, r *http.Request) {
+	id := ctxu.GetStringValue(ah, "vars.id")
+
+	job, ok := ah.App.prewarmJobs.get(id)
+	if !ok {
+		ah.Errors = append(ah.Errors, admin.ErrorCodePrewarmUnknown.WithDetail(id))
+		return
+	}
+
+	ah.serveJSON(w, job.Status())
+}
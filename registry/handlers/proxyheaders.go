@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+)
+
+// proxyHeaders are the headers proxies report the request of the client
+// with, which clients could otherwise forge.
+var proxyHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// configureTrustedProxies parses the addresses of the proxies whose headers
+// are trusted.
+func (app *App) configureTrustedProxies(config *configuration.Configuration) {
+	for _, proxy := range config.HTTP.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				panic(fmt.Sprintf("invalid trusted proxy address %q", proxy))
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			app.trustedProxies = append(app.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy range %q: %v", proxy, err))
+		}
+		app.trustedProxies = append(app.trustedProxies, network)
+	}
+
+	if len(app.trustedProxies) > 0 {
+		ctxu.GetLogger(app).Infof("trusting proxy headers of requests from %v", config.HTTP.TrustedProxies)
+	}
+}
+
+// trustsProxyHeaders returns true if the proxy headers of r are trusted,
+// because r was sent by a trusted proxy or no proxies are configured.
+func (app *App) trustsProxyHeaders(r *http.Request) bool {
+	if len(app.trustedProxies) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range app.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeProxyHeaders removes the proxy headers of a request which is not
+// trusted to carry them.
+func removeProxyHeaders(r *http.Request) {
+	for _, header := range proxyHeaders {
+		r.Header.Del(header)
+	}
+}
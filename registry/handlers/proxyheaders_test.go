@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestProxyHeaders checks that Location headers are relative if configured,
+// and that proxy headers are only trusted from trusted proxies.
+func TestProxyHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		relative       bool
+		trustedProxies []string
+		expected       string
+	}{
+		{false, nil, "https://registry.example.com:8443/v2/foo/bar/blobs/uploads/"},
+		{false, []string{"127.0.0.1"}, "https://registry.example.com:8443/v2/foo/bar/blobs/uploads/"},
+		{false, []string{"10.0.0.0/8"}, "http://127.0.0.1"},
+		{true, nil, "/v2/foo/bar/blobs/uploads/"},
+	} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"inmemory": configuration.Parameters{},
+			},
+		}
+		config.HTTP.RelativeURLs = tc.relative
+		config.HTTP.TrustedProxies = tc.trustedProxies
+		config.HTTP.Headers = headerConfig
+		env := newTestEnvWithConfig(t, &config)
+
+		name, _ := reference.ParseNamed("foo/bar")
+		u, err := env.builder.BuildBlobUploadURL(name)
+		checkErr(t, err, "building upload url")
+
+		req, err := http.NewRequest("POST", u, nil)
+		checkErr(t, err, "building request")
+		req.Header.Set("Forwarded", "proto=https;host=registry.example.com")
+		req.Header.Set("X-Forwarded-Port", "8443")
+
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "starting upload")
+		resp.Body.Close()
+		checkResponse(t, "starting upload", resp, http.StatusAccepted)
+
+		if location := resp.Header.Get("Location"); !strings.HasPrefix(location, tc.expected) {
+			t.Errorf("unexpected location with relative urls %v, trusted proxies %v: %q", tc.relative, tc.trustedProxies, location)
+		}
+
+		env.server.Close()
+	}
+}
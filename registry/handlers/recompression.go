@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// defaultRecompressionInterval is the interval between runs of the
+	// recompression maintenance job, if not configured.
+	defaultRecompressionInterval = time.Hour
+
+	// defaultRecompressionMinPulls is the number of pulls between two runs
+	// making a blob popular enough to be recompressed, if not configured.
+	defaultRecompressionMinPulls = 10
+
+	// defaultRecompressionMaxSize is the size of the largest blob
+	// recompressed, if not configured.
+	defaultRecompressionMaxSize = 1 << 30
+
+	// defaultRecompressionThroughput is the number of bytes of gzip
+	// compressed blobs read per second by the recompression maintenance job,
+	// if not configured.
+	defaultRecompressionThroughput = 16 << 20
+
+	// recompressionMaxBlobs is the number of blobs whose pulls are counted
+	// between two runs, and of blobs remembered as not recompressible.
+	// Further blobs are ignored, bounding the memory used.
+	recompressionMaxBlobs = 10000
+)
+
+// recompressor counts the pulls of the blobs of each repository, and
+// recompresses the popular gzip layers to zstd variants at a throttled pace.
+// Variants are served by their own endpoint.
+type recompressor struct {
+	minPulls   uint64
+	maxSize    int64
+	throughput int64
+	level      zstd.EncoderLevel
+
+	mu    sync.Mutex
+	pulls map[string]uint64
+	// skipped holds the blobs which cannot be recompressed, as they are not
+	// gzip compressed or too large, so that they are not read again.
+	skipped map[string]struct{}
+}
+
+// pulled counts a pull of the blob dgst of the named repository.
+func (rc *recompressor) pulled(name string, dgst digest.Digest) {
+	key := name + "@" + dgst.String()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if _, ok := rc.skipped[key]; ok {
+		return
+	}
+	if _, ok := rc.pulls[key]; !ok && len(rc.pulls) >= recompressionMaxBlobs {
+		return
+	}
+	rc.pulls[key]++
+}
+
+// skip remembers that the blob of key cannot be recompressed.
+func (rc *recompressor) skip(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.skipped) < recompressionMaxBlobs {
+		rc.skipped[key] = struct{}{}
+	}
+}
+
+// popular returns the blobs pulled at least minPulls times since the last
+// call, most pulled first, and resets the counts.
+func (rc *recompressor) popular() []recompressionCandidate {
+	rc.mu.Lock()
+	pulls := rc.pulls
+	rc.pulls = make(map[string]uint64)
+	rc.mu.Unlock()
+
+	var candidates recompressionCandidates
+	for key, count := range pulls {
+		if count >= rc.minPulls {
+			candidates = append(candidates, recompressionCandidate{key: key, pulls: count})
+		}
+	}
+	sort.Sort(candidates)
+	return candidates
+}
+
+// recompressionCandidate is a blob of a repository, named by key as
+// <name>@<digest>, and its number of pulls.
+type recompressionCandidate struct {
+	key   string
+	pulls uint64
+}
+
+// recompressionCandidates sorts candidates by decreasing pulls, then by key.
+type recompressionCandidates []recompressionCandidate
+
+func (c recompressionCandidates) Len() int { return len(c) }
+func (c recompressionCandidates) Less(i, j int) bool {
+	if c[i].pulls != c[j].pulls {
+		return c[i].pulls > c[j].pulls
+	}
+	return c[i].key < c[j].key
+}
+func (c recompressionCandidates) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+// recompressPopular recompresses the gzip layers pulled often enough since
+// its last run to zstd variants, and returns the number of variants stored.
+func (app *App) recompressPopular(ctx ctxu.Context) (int, error) {
+	rc := app.recompressor
+	if rc == nil || app.isReadOnly() || app.isCache {
+		return 0, nil
+	}
+
+	count := 0
+	for _, candidate := range rc.popular() {
+		i := strings.LastIndex(candidate.key, "@")
+		name, dgst := candidate.key[:i], digest.Digest(candidate.key[i+1:])
+
+		recompressed, err := app.recompress(ctx, name, dgst)
+		switch err {
+		case nil:
+			if recompressed {
+				count++
+			}
+		case storage.ErrNotGzip:
+			rc.skip(candidate.key)
+		default:
+			return count, fmt.Errorf("failed to recompress %s: %v", candidate.key, err)
+		}
+	}
+	return count, nil
+}
+
+// recompress stores the zstd variant of the blob dgst of the named
+// repository, unless it is already stored, too large or no longer exists.
+func (app *App) recompress(ctx ctxu.Context, name string, dgst digest.Digest) (bool, error) {
+	rc := app.recompressor
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return false, err
+	}
+	variants := storage.NewVariantStore(app.driverFor(name), named)
+	if _, err := variants.Stat(ctx, dgst); err != storage.ErrVariantUnknown {
+		return false, err
+	}
+
+	repository, err := app.registry.Repository(ctx, named)
+	if err != nil {
+		return false, err
+	}
+	blobs := repository.Blobs(ctx)
+	desc, err := blobs.Stat(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return false, nil
+		}
+		return false, err
+	}
+	if desc.Size > rc.maxSize {
+		rc.skip(name + "@" + dgst.String())
+		return false, nil
+	}
+
+	blob, err := blobs.Open(ctx, dgst)
+	if err != nil {
+		return false, err
+	}
+	defer blob.Close()
+
+	start := time.Now()
+	variant, err := variants.Recompress(ctx, dgst, &throttledReader{Reader: blob, rate: rc.throughput}, rc.level)
+	if err != nil {
+		return false, err
+	}
+	ctxu.GetLogger(ctx).Infof("recompression: stored zstd variant %s of %s@%s: %d bytes instead of %d, in %s", variant.Digest, name, dgst, variant.Size, desc.Size, time.Since(start))
+	return true, nil
+}
+
+// throttledReader reads no more than rate bytes per second on average.
+type throttledReader struct {
+	io.Reader
+	rate int64
+
+	start time.Time
+	n     int64
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if tr.start.IsZero() {
+		tr.start = time.Now()
+	}
+	n, err := tr.Reader.Read(p)
+	tr.n += int64(n)
+
+	due := time.Duration(float64(tr.n) / float64(tr.rate) * float64(time.Second))
+	if wait := due - time.Since(tr.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// blobVariantDispatcher uses the request context to build a
+// blobVariantHandler.
+func blobVariantDispatcher(ctx *Context, r *http.Request) http.Handler {
+	if ctx.App.recompressor == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail("layer recompression is not enabled"))
+		})
+	}
+
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	blobVariantHandler := &blobVariantHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(blobVariantHandler.GetBlobVariant),
+		"HEAD": http.HandlerFunc(blobVariantHandler.GetBlobVariant),
+	}
+}
+
+// blobVariantHandler serves the zstd variants of the blobs of a repository.
+type blobVariantHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetBlobVariant serves the zstd variant of a blob, under its own digest. The
+// blob itself is always served as pushed, since clients verify its content
+// against the digest they requested.
+func (vh *blobVariantHandler) GetBlobVariant(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(vh).Debug("GetBlobVariant")
+	desc, err := vh.Repository.Blobs(vh).Stat(vh, vh.Digest)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			vh.Errors = append(vh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(vh.Digest))
+		} else {
+			vh.Errors = append(vh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	variants := storage.NewVariantStore(vh.App.driverFor(vh.Repository.Named().Name()), vh.Repository.Named())
+	variant, err := variants.Stat(vh, desc.Digest)
+	if err != nil {
+		if err == storage.ErrVariantUnknown {
+			vh.Errors = append(vh.Errors, v2.ErrorCodeBlobVariantUnknown.WithDetail(vh.Digest))
+		} else {
+			vh.Errors = append(vh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Docker-Variant-Source", desc.Digest.String())
+	if err := variants.ServeVariant(vh, w, r, desc.Digest, variant); err != nil {
+		vh.Errors = append(vh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if r.Method == "GET" {
+		blobMetrics.Variant(desc.Size - variant.Size)
+	}
+}
+
+// startRecompressor schedules a goroutine which periodically recompresses the
+// popular gzip layers to zstd, as configured by the recompression maintenance
+// section. Pulls are counted from then on.
+func startRecompressor(app *App, config map[interface{}]interface{}) {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return
+	}
+	if app.isCache {
+		panic("recompression is not supported by a pull through cache")
+	}
+
+	rc := &recompressor{
+		minPulls:   defaultRecompressionMinPulls,
+		maxSize:    defaultRecompressionMaxSize,
+		throughput: defaultRecompressionThroughput,
+		level:      zstd.SpeedDefault,
+		pulls:      make(map[string]uint64),
+		skipped:    make(map[string]struct{}),
+	}
+
+	interval := defaultRecompressionInterval
+	if v, ok := config["interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("recompression's interval config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("recompression's interval config key is not a valid duration: %q", s))
+		}
+		interval = d
+	}
+
+	if v, ok := config["minpulls"]; ok {
+		minPulls, ok := v.(int)
+		if !ok || minPulls < 1 {
+			panic("recompression's minpulls config key must be a positive integer")
+		}
+		rc.minPulls = uint64(minPulls)
+	}
+
+	if v, ok := config["maxsize"]; ok {
+		maxSize, ok := v.(int)
+		if !ok || maxSize < 1 {
+			panic("recompression's maxsize config key must be a positive integer")
+		}
+		rc.maxSize = int64(maxSize)
+	}
+
+	if v, ok := config["throughput"]; ok {
+		throughput, ok := v.(int)
+		if !ok || throughput < 1 {
+			panic("recompression's throughput config key must be a positive integer")
+		}
+		rc.throughput = int64(throughput)
+	}
+
+	if v, ok := config["level"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("recompression's level config key must be a string")
+		}
+		if ok, rc.level = zstd.EncoderLevelFromString(s); !ok {
+			panic(fmt.Sprintf("recompression's level config key must be one of fastest, default, better or best: %q", s))
+		}
+	}
+
+	app.recompressor = rc
+	leading := app.maintenanceJob("recompression")
+	go func() {
+		for {
+			ctxu.GetLogger(app).Infof("Starting recompression of popular layers in %s", interval)
+			time.Sleep(interval)
+
+			if !leading() {
+				// The pulls counted by this instance are not needed.
+				rc.popular()
+				continue
+			}
+
+			count, err := app.recompressPopular(app)
+			if err != nil {
+				ctxu.GetLogger(app).Errorf("recompression: %v", err)
+			}
+			ctxu.GetLogger(app).Infof("recompression: %d zstd variants stored", count)
+		}
+	}()
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestRecompression checks that a gzip layer pulled often enough is
+// recompressed to zstd, that the variant is served by its own endpoint, and
+// that the layer is always served as pushed.
+func TestRecompression(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{
+				"recompression": map[interface{}]interface{}{
+					"enabled":  true,
+					"interval": "24h",
+					"minpulls": 2,
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	content := bytes.Repeat([]byte("popular layer "), 64<<10)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(content)
+	gz.Close()
+	layer := buf.Bytes()
+	layerDigest := digest.FromBytes(layer)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	ref, _ := reference.WithDigest(imageName, layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building blob url")
+	variantURL, err := env.builder.BuildBlobVariantURL(ref)
+	checkErr(t, err, "building blob variant url")
+
+	// The layer is served as pushed, whatever the client accepts.
+	getLayer := func(msg string) {
+		req, _ := http.NewRequest("GET", layerURL, nil)
+		req.Header.Set("Accept", schema2.MediaTypeOCILayerZstd)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, msg)
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+		if vary := resp.Header.Get("Vary"); vary != "" {
+			t.Fatalf("unexpected Vary header of layer: %q", vary)
+		}
+		p, err := ioutil.ReadAll(resp.Body)
+		checkErr(t, err, msg)
+		if digest.FromBytes(p) != layerDigest || resp.Header.Get("Docker-Content-Digest") != layerDigest.String() {
+			t.Fatalf("%s: layer content differs", msg)
+		}
+	}
+
+	getLayer("fetching layer")
+	resp, err := http.Get(variantURL)
+	checkErr(t, err, "fetching unknown variant")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unknown variant", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching unknown variant", resp, v2.ErrorCodeBlobVariantUnknown)
+
+	// A single pull does not make the layer popular.
+	count, err := env.app.recompressPopular(env.ctx)
+	if err != nil || count != 0 {
+		t.Fatalf("unexpected layers recompressed: %d, %v", count, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		getLayer("fetching layer")
+	}
+	count, err = env.app.recompressPopular(env.ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("unexpected layers recompressed: %d, %v", count, err)
+	}
+
+	getLayer("fetching layer after recompression")
+
+	resp, err = http.Get(variantURL)
+	checkErr(t, err, "fetching zstd variant")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching zstd variant", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeOCILayerZstd},
+		"Docker-Variant-Source": []string{layerDigest.String()},
+	})
+	p, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading zstd variant")
+	if len(p) >= len(layer) {
+		t.Fatalf("variant not smaller than its layer: %d bytes", len(p))
+	}
+	if dgst := digest.FromBytes(p); resp.Header.Get("Docker-Content-Digest") != dgst.String() {
+		t.Fatalf("unexpected variant digest %q, content digest %s", resp.Header.Get("Docker-Content-Digest"), dgst)
+	}
+	dec, err := zstd.NewReader(bytes.NewReader(p))
+	checkErr(t, err, "decompressing zstd variant")
+	defer dec.Close()
+	decompressed, err := ioutil.ReadAll(dec)
+	checkErr(t, err, "decompressing zstd variant")
+	if !bytes.Equal(decompressed, content) {
+		t.Fatalf("variant content differs from the layer content")
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// States of a repository deletion.
+const (
+	RepositoryDeletionRunning   = admin.JobStateRunning
+	RepositoryDeletionCompleted = admin.JobStateCompleted
+	RepositoryDeletionFailed    = admin.JobStateFailed
+	RepositoryDeletionCanceled  = admin.JobStateCanceled
+)
+
+// RepositoryDeletionStatus is the response body of the repository and
+// repository deletion routes, describing the progress of the deletion of a
+// repository.
+type RepositoryDeletionStatus struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// State is RepositoryDeletionRunning until the deletion ends, then
+	// RepositoryDeletionFailed with Error set if the repository could not
+	// be fully deleted, RepositoryDeletionCanceled if the deletion was
+	// canceled through the admin API, and RepositoryDeletionCompleted
+	// otherwise.
+	State string `json:"state"`
+
+	// Tags and Manifests are the number of tags and manifests removed so
+	// far.
+	Tags      int `json:"tags"`
+	Manifests int `json:"manifests"`
+
+	Error string `json:"error,omitempty"`
+
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// repositoryDeletionStatus returns the status of the deletion run by a
+// repository deletion job.
+func repositoryDeletionStatus(j *job) RepositoryDeletionStatus {
+	status := j.Status()
+	return RepositoryDeletionStatus{
+		ID:        status.ID,
+		Name:      status.Target,
+		State:     status.State,
+		Tags:      int(status.Progress["tags"]),
+		Manifests: int(status.Progress["manifests"]),
+		Error:     status.Error,
+		Started:   status.Started,
+		Finished:  status.Finished,
+	}
+}
+
+// repositoryDispatcher constructs the handler of the repository route.
+func repositoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.isReadOnly() {
+		mhandler["DELETE"] = http.HandlerFunc(repositoryHandler.DeleteRepository)
+	}
+	return mhandler
+}
+
+// repositoryDeletionDispatcher constructs the handler of the repository
+// deletion route.
+func repositoryDeletionDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(repositoryHandler.GetRepositoryDeletion),
+	}
+}
+
+// repositoryHandler handles requests for repositories as a whole.
+type repositoryHandler struct {
+	*Context
+}
+
+// DeleteRepository starts deleting the repository in the background, and
+// returns the status of the deletion, whose progress can be polled at the
+// returned location.
+func (rh *repositoryHandler) DeleteRepository(w http.ResponseWriter, r *http.Request) {
+	if !rh.repositoryDeletionEnabled || rh.isCache {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported.WithDetail("repository deletion is not enabled"))
+		return
+	}
+
+	name := rh.Repository.Named()
+
+	// The deletion outlives the request, so it is bound to the context of
+	// the registry, and notifies the deletions on behalf of the requesting
+	// user.
+	ctx := detachedContext(rh.App, rh)
+	j, err := rh.App.startRepositoryDeletion(ctx, name, rh.App.eventBridge(rh.Context, r))
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			rh.Errors = append(rh.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		} else {
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	status := repositoryDeletionStatus(j)
+
+	location, err := rh.urlBuilder.BuildRepositoryDeletionURL(name, status.ID)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		ctxu.GetLogger(rh).Errorf("error writing repository deletion status: %v", err)
+	}
+}
+
+// startRepositoryDeletion starts deleting the named repository in the
+// background with a repository of its own, bound to ctx, whose deletions are
+// notified to listener. It returns the job running the deletion, which is the
+// one already running if the repository is being deleted, or an
+// ErrRepositoryUnknown if the repository does not exist.
+func (app *App) startRepositoryDeletion(ctx ctxu.Context, name reference.Named, listener notifications.Listener) (*job, error) {
+	storageDriver := app.driverFor(name.Name())
+
+	exists, err := storage.RepositoryExists(ctx, storageDriver, name.Name())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, distribution.ErrRepositoryUnknown{Name: name.Name()}
+	}
+
+	repo, err := app.registry.Repository(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	repo = notifications.Listen(repo, listener)
+	repo, err = applyRepoMiddleware(ctx, repo, app.Config.Middleware["repository"])
+	if err != nil {
+		return nil, err
+	}
+
+	j, _ := app.jobs.startExclusive(ctx, admin.JobTypeRepositoryDeletion, name.Name(), func(ctx ctxu.Context, j *job) (interface{}, error) {
+		_, err := storage.DeleteRepository(ctx, storageDriver, repo, func(deletion storage.RepositoryDeletion) {
+			j.setProgress("tags", int64(deletion.Tags))
+			j.setProgress("manifests", int64(deletion.Manifests))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The repository is deleted regardless of the catalog index, which
+		// is repaired by its next rebuild if it still lists it.
+		if err := app.catalogIndexFor(name.Name()).Remove(ctx, name.Name()); err != nil {
+			ctxu.GetLogger(ctx).Errorf("error removing %s from the catalog index: %v", name.Name(), err)
+		}
+		return nil, nil
+	})
+	return j, nil
+}
+
+// repositoryDeletion returns the job of the deletion of the named repository
+// with the given ID, if retained.
+func (app *App) repositoryDeletion(name, id string) (*job, bool) {
+	j, ok := app.jobs.get(id)
+	if !ok || j.Status().Type != admin.JobTypeRepositoryDeletion || j.Status().Target != name {
+		return nil, false
+	}
+	return j, true
+}
+
+// GetRepositoryDeletion returns the status of a repository deletion.
+func (rh *repositoryHandler) GetRepositoryDeletion(w http.ResponseWriter, r *http.Request) {
+	id := ctxu.GetStringValue(rh, "vars.id")
+
+	j, ok := rh.App.repositoryDeletion(rh.Repository.Named().Name(), id)
+	if !ok {
+		rh.Errors = append(rh.Errors, v2.ErrorCodeRepositoryDeletionUnknown.WithDetail(id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(repositoryDeletionStatus(j)); err != nil {
+		ctxu.GetLogger(rh).Errorf("error writing repository deletion status: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// TestDeleteRepository checks that repositories are only deleted if enabled,
+// and that the deletion can be polled until it completes.
+func TestDeleteRepository(t *testing.T) {
+	deleteRepository := func(env *testEnv, name reference.Named) *http.Response {
+		repositoryURL, err := env.builder.BuildRepositoryURL(name)
+		checkErr(t, err, "building repository url")
+		req, err := http.NewRequest("DELETE", repositoryURL, nil)
+		checkErr(t, err, "building request")
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "deleting repository")
+		return resp
+	}
+
+	name, _ := reference.ParseNamed("foo/bar")
+
+	// Deleting manifests does not allow deleting repositories.
+	env := newTestEnv(t, true)
+	createRepository(env, t, name.Name(), "latest")
+	resp := deleteRepository(env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "deleting repository without repository deletion", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "deleting repository without repository deletion", resp, errcode.ErrorCodeUnsupported)
+	env.server.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true, "repositories": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env = newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	missing, _ := reference.ParseNamed("foo/missing")
+	resp = deleteRepository(env, missing)
+	defer resp.Body.Close()
+	checkResponse(t, "deleting missing repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting missing repository", resp, v2.ErrorCodeNameUnknown)
+
+	createRepository(env, t, name.Name(), "latest")
+	createRepository(env, t, name.Name(), "stable")
+
+	resp = deleteRepository(env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "deleting repository", resp, http.StatusAccepted)
+
+	var status RepositoryDeletionStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("error decoding deletion status: %v", err)
+	}
+	statusURL, err := env.builder.BuildRepositoryDeletionURL(name, status.ID)
+	checkErr(t, err, "building repository deletion url")
+	if location := resp.Header.Get("Location"); location != statusURL {
+		t.Fatalf("unexpected location: %q != %q", location, statusURL)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status.State == RepositoryDeletionRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("repository deletion did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := http.Get(statusURL)
+		checkErr(t, err, "polling repository deletion")
+		checkResponse(t, "polling repository deletion", resp, http.StatusOK)
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		checkErr(t, err, "decoding deletion status")
+	}
+
+	if status.State != RepositoryDeletionCompleted || status.Tags != 2 || status.Manifests != 2 || status.Finished == nil {
+		t.Fatalf("unexpected deletion status: %+v", status)
+	}
+
+	tagsURL, err := env.builder.BuildTagsURL(name)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "listing tags")
+	defer resp.Body.Close()
+	checkResponse(t, "listing tags of deleted repository", resp, http.StatusNotFound)
+
+	// Deletions are only known to the repository they deleted.
+	otherURL, err := env.builder.BuildRepositoryDeletionURL(missing, status.ID)
+	checkErr(t, err, "building repository deletion url")
+	resp, err = http.Get(otherURL)
+	checkErr(t, err, "polling repository deletion")
+	defer resp.Body.Close()
+	checkResponse(t, "polling deletion of other repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "polling deletion of other repository", resp, v2.ErrorCodeRepositoryDeletionUnknown)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+type repositoryChecksumAPIResponse struct {
+	Name      string               `json:"name"`
+	Digest    digest.Digest        `json:"digest"`
+	Tags      storage.ChecksumTree `json:"tags"`
+	Manifests storage.ChecksumTree `json:"manifests"`
+}
+
+// repositoryChecksumDispatcher constructs the handler of the repository
+// checksum route.
+func repositoryChecksumDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryChecksumHandler := &repositoryChecksumHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(repositoryChecksumHandler.GetRepositoryChecksum),
+		"HEAD": http.HandlerFunc(repositoryChecksumHandler.GetRepositoryChecksum),
+	}
+}
+
+// repositoryChecksumHandler serves the checksums of repositories.
+type repositoryChecksumHandler struct {
+	*Context
+}
+
+// GetRepositoryChecksum returns the checksum of the tags and manifests of the
+// repository, or only its digest in the headers of HEAD requests and of
+// requests whose If-None-Match header matches it.
+func (ch *repositoryChecksumHandler) GetRepositoryChecksum(w http.ResponseWriter, r *http.Request) {
+	name := ch.Repository.Named().Name()
+	checksum, err := storage.ComputeRepositoryChecksum(ch, ch.driverFor(name), ch.Repository)
+	if err != nil {
+		switch err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			ch.Errors = append(ch.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name}))
+		default:
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	p, err := json.Marshal(repositoryChecksumAPIResponse{
+		Name:      name,
+		Digest:    checksum.Digest,
+		Tags:      checksum.Tags,
+		Manifests: checksum.Manifests,
+	})
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", checksum.Digest.String())
+	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, checksum.Digest))
+	if etagMatch(r, checksum.Digest.String()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(p)
+}
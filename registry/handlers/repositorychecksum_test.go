@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+)
+
+// TestRepositoryChecksum checks that the checksum of a repository summarizes
+// its tags and manifests, and changes with them.
+func TestRepositoryChecksum(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.server.Close()
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	checksumURL, err := env.builder.BuildRepositoryChecksumURL(imageName)
+	checkErr(t, err, "building repository checksum url")
+
+	resp, err := http.Get(checksumURL)
+	checkErr(t, err, "fetching checksum of unknown repository")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching checksum of unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching checksum of unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	dgst := createRepository(env, t, imageName.Name(), "latest")
+
+	resp, err = http.Get(checksumURL)
+	checkErr(t, err, "fetching repository checksum")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching repository checksum", resp, http.StatusOK)
+
+	var body repositoryChecksumAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding repository checksum: %v", err)
+	}
+	expected := storage.ChecksumOf(map[string]digest.Digest{"latest": dgst}, []digest.Digest{dgst})
+	if body.Name != "foo/bar" || body.Digest != expected.Digest || body.Tags != expected.Tags || body.Manifests != expected.Manifests {
+		t.Fatalf("unexpected repository checksum %#v, expected %#v", body, expected)
+	}
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{expected.Digest.String()},
+		"Etag":                  []string{`"` + expected.Digest.String() + `"`},
+	})
+
+	req, _ := http.NewRequest("GET", checksumURL, nil)
+	req.Header.Set("If-None-Match", `"`+expected.Digest.String()+`"`)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching unchanged repository checksum")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unchanged repository checksum", resp, http.StatusNotModified)
+
+	// the checksum changes with the tags of the repository
+	createRepository(env, t, imageName.Name(), "v2")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching changed repository checksum")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching changed repository checksum", resp, http.StatusOK)
+	if resp.Header.Get("Docker-Content-Digest") == expected.Digest.String() {
+		t.Fatalf("expected the checksum to change")
+	}
+}
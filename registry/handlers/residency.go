@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// configureResidency validates the residency policies of the registry.
+func (app *App) configureResidency(config *configuration.Configuration) {
+	for i, policy := range config.Residency.Policies {
+		if len(policy.Repositories) == 0 || len(policy.Regions) == 0 {
+			panic(fmt.Sprintf("residency policy %d must list repositories and regions", i))
+		}
+		for _, pattern := range policy.Repositories {
+			if _, err := path.Match(pattern, ""); err != nil {
+				panic(fmt.Sprintf("invalid repository pattern %q in residency policy %d: %v", pattern, i, err))
+			}
+		}
+	}
+
+	if len(config.Residency.Policies) > 0 {
+		ctxu.GetLogger(app).Infof("enforcing %d residency policies, registry storage in region %q", len(config.Residency.Policies), config.Residency.Region)
+	}
+}
+
+// regionFor returns the region of the storage of the named repository.
+func (app *App) regionFor(name string) string {
+	if ns := app.namespaceStorageFor(name); ns != nil {
+		return ns.region
+	}
+	return app.Config.Residency.Region
+}
+
+// allowedRegions returns the regions the data of the named repository may be
+// stored in, and false if no policy restricts them.
+func (app *App) allowedRegions(name string) ([]string, bool) {
+	for _, policy := range app.Config.Residency.Policies {
+		for _, pattern := range policy.Repositories {
+			if matchesRepository(pattern, name) {
+				return policy.Regions, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// matchesRepository returns true if pattern matches the named repository or
+// one of the repositories it is nested in, so that the repositories nested in
+// a restricted repository are restricted as well.
+func matchesRepository(pattern, name string) bool {
+	for {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// checkResidency returns an error if the residency policy of the named
+// repository does not allow storing its content in the region of its
+// storage.
+func (app *App) checkResidency(name string) error {
+	regions, ok := app.allowedRegions(name)
+	if !ok {
+		return nil
+	}
+
+	region := app.regionFor(name)
+	if !containsRegion(regions, region) {
+		return v2.ErrorCodeResidencyDenied.WithDetail(fmt.Sprintf("repository %s may only be stored in regions %v, its storage is in region %q", name, regions, region))
+	}
+	return nil
+}
+
+// checkMountResidency returns an error if the residency policy of the
+// repository blobs are mounted from does not allow storing them in the region
+// of the target repository.
+func (app *App) checkMountResidency(from, name string) error {
+	regions, ok := app.allowedRegions(from)
+	if !ok {
+		return nil
+	}
+
+	region := app.regionFor(name)
+	if !containsRegion(regions, region) {
+		return v2.ErrorCodeResidencyDenied.WithDetail(fmt.Sprintf("content of repository %s may only be stored in regions %v, repository %s is stored in region %q", from, regions, name, region))
+	}
+	return nil
+}
+
+func containsRegion(regions []string, region string) bool {
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// residencyDenied reports a residency policy violation on the context.
+func residencyDenied(ctx *Context, err error) {
+	ctxu.GetLogger(ctx).Warnf("residency: %v", err)
+	ctx.Errors = append(ctx.Errors, err)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// TestResidencyPolicy checks that pushes and mounts storing content outside
+// of the regions allowed for a repository are rejected.
+func TestResidencyPolicy(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Namespaces: []configuration.NamespaceStorage{
+			{
+				Names:   []string{"eu"},
+				Storage: configuration.Storage{"inmemory": configuration.Parameters{}},
+				Region:  "eu-west",
+			},
+		},
+		Residency: configuration.Residency{
+			Region: "us-east",
+			Policies: []configuration.ResidencyPolicy{
+				{Repositories: []string{"eu/*", "gdpr/*"}, Regions: []string{"eu-west", "eu-central"}},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+
+	// Content of a pinned repository may be pushed to storage in an
+	// allowed region.
+	euName, _ := reference.ParseNamed("eu/app")
+	content := []byte("some layer content")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env.builder, euName)
+	pushLayer(t, env.builder, euName, dgst, uploadURLBase, bytes.NewReader(content))
+
+	// Unpinned repositories are not restricted.
+	libraryName, _ := reference.ParseNamed("library/app")
+	startPushLayer(t, env.builder, libraryName)
+
+	post := func(name reference.Named, values url.Values) *http.Response {
+		u, err := env.builder.BuildBlobUploadURL(name, values)
+		checkErr(t, err, "building upload url")
+		resp, err := http.Post(u, "", nil)
+		checkErr(t, err, "starting upload")
+		return resp
+	}
+
+	// gdpr/app is pinned to eu regions but stored in us-east.
+	gdprName, _ := reference.ParseNamed("gdpr/app")
+	resp := post(gdprName, nil)
+	defer resp.Body.Close()
+	checkResponse(t, "starting upload to repository outside of its regions", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "starting upload to repository outside of its regions", resp, v2.ErrorCodeResidencyDenied)
+
+	// Repositories nested in a pinned repository are pinned as well.
+	for _, name := range []string{"gdpr/team/app", "gdpr/team/sub/app"} {
+		nestedName, _ := reference.ParseNamed(name)
+		resp := post(nestedName, nil)
+		defer resp.Body.Close()
+		checkResponse(t, "starting upload to nested repository outside of its regions", resp, http.StatusForbidden)
+		checkBodyHasErrorCodes(t, "starting upload to nested repository outside of its regions", resp, v2.ErrorCodeResidencyDenied)
+	}
+
+	resp = post(libraryName, url.Values{"mount": {dgst.String()}, "from": {euName.Name()}})
+	defer resp.Body.Close()
+	checkResponse(t, "mounting blob outside of its regions", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "mounting blob outside of its regions", resp, v2.ErrorCodeResidencyDenied)
+
+	tagRef, _ := reference.WithTag(gdprName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest("PUT", manifestURL, bytes.NewReader([]byte("{}")))
+	checkErr(t, err, "building manifest request")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "putting manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest to repository outside of its regions", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "putting manifest to repository outside of its regions", resp, v2.ErrorCodeResidencyDenied)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// Groups of routes, whose responses are configured by http.routegroups.
+const (
+	routeGroupV2    = "v2"
+	routeGroupAdmin = "admin"
+	routeGroupUI    = "ui"
+)
+
+var (
+	defaultCORSAllowedMethods = []string{"GET", "HEAD"}
+	defaultCORSAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "Range"}
+	defaultCORSExposedHeaders = []string{
+		"Docker-Content-Digest",
+		"Docker-Distribution-API-Version",
+		"Docker-Upload-UUID",
+		"Link",
+		"Location",
+		"Range",
+		"WWW-Authenticate",
+	}
+)
+
+// checkRouteGroups panics if the configuration names an unknown route group.
+func checkRouteGroups(groups map[string]configuration.RouteGroup) {
+	for name := range groups {
+		switch name {
+		case routeGroupV2, routeGroupAdmin, routeGroupUI:
+		default:
+			panic(fmt.Sprintf("unknown route group %q in http.routegroups", name))
+		}
+	}
+}
+
+// routeGroup returns the group of the route of the request.
+func routeGroup(r *http.Request) string {
+	switch {
+	case isAdminRequest(r):
+		return routeGroupAdmin
+	case isUIRequest(r):
+		return routeGroupUI
+	default:
+		return routeGroupV2
+	}
+}
+
+// setRouteGroupHeaders adds the headers configured for the group of the
+// route of the request to the response, including the CORS headers of
+// cross-origin requests. It returns true if the request is a CORS preflight
+// request, which has then been answered.
+func (app *App) setRouteGroupHeaders(w http.ResponseWriter, r *http.Request) bool {
+	group, ok := app.Config.HTTP.RouteGroups[routeGroup(r)]
+	if !ok {
+		return false
+	}
+
+	for headerName, headerValues := range group.Headers {
+		for _, value := range headerValues {
+			w.Header().Add(headerName, value)
+		}
+	}
+
+	return setCORSHeaders(w, r, group.CORS)
+}
+
+// setCORSHeaders adds the headers allowing a cross-origin request under the
+// policy, if it allows the origin of the request, and answers the request if
+// it is a preflight request.
+func setCORSHeaders(w http.ResponseWriter, r *http.Request, cors configuration.CORS) bool {
+	if len(cors.AllowedOrigins) == 0 {
+		return false
+	}
+
+	anyOrigin := false
+	for _, allowed := range cors.AllowedOrigins {
+		if allowed == "*" {
+			anyOrigin = true
+		}
+	}
+	if !anyOrigin || cors.AllowCredentials {
+		// The response depends on the origin of the request.
+		w.Header().Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !originAllowed(origin, cors.AllowedOrigins) {
+		return false
+	}
+
+	// Credentials are not sent to a wildcard origin.
+	if anyOrigin && !cors.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if cors.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method != "OPTIONS" || r.Header.Get("Access-Control-Request-Method") == "" {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(withDefault(cors.ExposedHeaders, defaultCORSExposedHeaders), ", "))
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(withDefault(cors.AllowedMethods, defaultCORSAllowedMethods), ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(withDefault(cors.AllowedHeaders, defaultCORSAllowedHeaders), ", "))
+	if cors.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func withDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+)
+
+// TestRouteGroups checks the headers and the CORS policy configured for the
+// registry API.
+func TestRouteGroups(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.RouteGroups = map[string]configuration.RouteGroup{
+		"v2": {
+			Headers: http.Header{"Cache-Control": []string{"no-store"}},
+			CORS: configuration.CORS{
+				AllowedOrigins: []string{"https://ui.example.com"},
+				AllowedMethods: []string{"GET", "HEAD", "DELETE"},
+				MaxAge:         10 * time.Minute,
+			},
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+
+	req, err := http.NewRequest("GET", baseURL, nil)
+	checkErr(t, err, "building request")
+	req.Header.Set("Origin", "https://ui.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "requesting base url")
+	checkResponse(t, "requesting base url cross-origin", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Cache-Control":                 []string{"no-store"},
+		"X-Content-Type-Options":        []string{"nosniff"},
+		"Access-Control-Allow-Origin":   []string{"https://ui.example.com"},
+		"Access-Control-Expose-Headers": []string{"Docker-Content-Digest, Docker-Distribution-API-Version, Docker-Upload-UUID, Link, Location, Range, WWW-Authenticate"},
+		"Vary":                          []string{"Origin"},
+	})
+
+	// Preflight requests are answered without reaching the handlers.
+	req, err = http.NewRequest("OPTIONS", baseURL, nil)
+	checkErr(t, err, "building request")
+	req.Header.Set("Origin", "https://ui.example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "sending preflight request")
+	checkResponse(t, "sending preflight request", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Access-Control-Allow-Origin":  []string{"https://ui.example.com"},
+		"Access-Control-Allow-Methods": []string{"GET, HEAD, DELETE"},
+		"Access-Control-Allow-Headers": []string{"Accept, Authorization, Content-Type, Range"},
+		"Access-Control-Max-Age":       []string{"600"},
+	})
+
+	// Other origins are not allowed.
+	req, err = http.NewRequest("GET", baseURL, nil)
+	checkErr(t, err, "building request")
+	req.Header.Set("Origin", "https://attacker.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "requesting base url")
+	checkResponse(t, "requesting base url from another origin", resp, http.StatusOK)
+	if origin := resp.Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Fatalf("unexpected allowed origin: %q", origin)
+	}
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// defaultSBOMTimeout bounds the generation of an SBOM unless another timeout
+// is configured.
+const defaultSBOMTimeout = 5 * time.Minute
+
+// maxSBOMSize is the size of the largest SBOM stored from the generator.
+const maxSBOMSize = 32 << 20
+
+// sbomMediaTypes are the artifact types of the SBOMs served by the registry.
+var sbomMediaTypes = map[string]bool{
+	"application/spdx+json":          true,
+	"text/spdx":                      true,
+	"application/vnd.cyclonedx+json": true,
+	"application/vnd.cyclonedx+xml":  true,
+}
+
+// sbomRequest is the body of the requests to the SBOM generator, describing
+// the image it generates the SBOM of. The generator pulls the image from the
+// registry.
+type sbomRequest struct {
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag,omitempty"`
+	Digest     digest.Digest `json:"digest"`
+	MediaType  string        `json:"mediaType"`
+	Size       int64         `json:"size"`
+}
+
+// sbomResult is the result of SBOM jobs.
+type sbomResult struct {
+	// Digest is the digest of the artifact manifest of the SBOM.
+	Digest digest.Digest `json:"digest"`
+}
+
+// requestSBOM starts a job generating the SBOM of the image manifest put by
+// the request, if an SBOM generator is configured. Artifacts, such as SBOMs
+// themselves, are not submitted.
+func (imh *imageManifestHandler) requestSBOM(r *http.Request, manifest distribution.Manifest, desc distribution.Descriptor) {
+	if imh.App.Config.HTTP.SBOM.URL == "" {
+		return
+	}
+	if m, ok := manifest.(*schema2.DeserializedManifest); !ok || m.Config.MediaType != schema2.MediaTypeConfig {
+		return
+	}
+
+	// The SBOM is stored once the request is done, so it uses a repository
+	// of its own, bound to the context of the registry, which notifies the
+	// push on behalf of the requesting user.
+	name := imh.Repository.Named()
+	ctx := detachedContext(imh.App, imh)
+	repo, err := imh.App.registry.Repository(ctx, name)
+	if err != nil {
+		ctxu.GetLogger(imh).Errorf("error requesting SBOM of %s: %v", desc.Digest, err)
+		return
+	}
+	repo = notifications.Listen(repo, imh.App.eventBridge(imh.Context, r))
+	repo, err = applyRepoMiddleware(ctx, repo, imh.App.Config.Middleware["repository"])
+	if err != nil {
+		ctxu.GetLogger(imh).Errorf("error requesting SBOM of %s: %v", desc.Digest, err)
+		return
+	}
+
+	image := sbomRequest{
+		Repository: name.Name(),
+		Tag:        imh.Tag,
+		Digest:     desc.Digest,
+		MediaType:  desc.MediaType,
+		Size:       desc.Size,
+	}
+	imh.App.jobs.start(ctx, admin.JobTypeSBOM, name.Name()+"@"+desc.Digest.String(), func(ctx ctxu.Context, j *job) (interface{}, error) {
+		dgst, err := imh.App.generateSBOM(ctx, repo, image)
+		if err != nil {
+			return nil, err
+		}
+		return sbomResult{Digest: dgst}, nil
+	})
+}
+
+// generateSBOM submits an image to the SBOM generator and stores the SBOM it
+// returns as an artifact manifest referring to the image, returning the
+// digest of the artifact manifest.
+func (app *App) generateSBOM(ctx ctxu.Context, repo distribution.Repository, image sbomRequest) (digest.Digest, error) {
+	config := app.Config.HTTP.SBOM
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultSBOMTimeout
+	}
+
+	body, err := json.Marshal(image)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", config.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range config.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ctxhttp.Do(ctx, &http.Client{Timeout: timeout}, req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting SBOM: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("SBOM generator returned %s", resp.Status)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !sbomMediaTypes[mediaType] {
+		return "", fmt.Errorf("SBOM generator returned unsupported content type %q", resp.Header.Get("Content-Type"))
+	}
+	sbom, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSBOMSize+1))
+	if err != nil {
+		return "", fmt.Errorf("error reading SBOM: %v", err)
+	}
+	if len(sbom) > maxSBOMSize {
+		return "", fmt.Errorf("SBOM exceeds %d bytes", maxSBOMSize)
+	}
+
+	blobs := repo.Blobs(ctx)
+	sbomDesc, err := blobs.Put(ctx, mediaType, sbom)
+	if err != nil {
+		return "", err
+	}
+	sbomDesc.MediaType = mediaType
+	configDesc, err := blobs.Put(ctx, schema2.MediaTypeEmptyConfig, schema2.EmptyConfig)
+	if err != nil {
+		return "", err
+	}
+	configDesc.MediaType = schema2.MediaTypeEmptyConfig
+
+	content, err := json.MarshalIndent(struct {
+		schema2.Manifest
+		ArtifactType string                  `json:"artifactType"`
+		Subject      distribution.Descriptor `json:"subject"`
+		Annotations  map[string]string       `json:"annotations"`
+	}{
+		Manifest: schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    configDesc,
+			Layers:    []distribution.Descriptor{sbomDesc},
+		},
+		ArtifactType: mediaType,
+		Subject: distribution.Descriptor{
+			MediaType: image.MediaType,
+			Size:      image.Size,
+			Digest:    image.Digest,
+		},
+		Annotations: map[string]string{
+			"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339),
+		},
+	}, "", "   ")
+	if err != nil {
+		return "", err
+	}
+	var artifact schema2.DeserializedManifest
+	if err := artifact.UnmarshalJSON(content); err != nil {
+		return "", err
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return "", err
+	}
+	return manifests.Put(ctx, &artifact)
+}
+
+// manifestSBOMDispatcher constructs the handler of the manifest SBOM route.
+func manifestSBOMDispatcher(ctx *Context, r *http.Request) http.Handler {
+	manifestSBOMHandler := &manifestSBOMHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.ParseDigest(reference)
+	if err != nil {
+		manifestSBOMHandler.Tag = reference
+	} else {
+		manifestSBOMHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(manifestSBOMHandler.GetManifestSBOM),
+	}
+}
+
+// manifestSBOMHandler serves the SBOMs referring to manifests.
+type manifestSBOMHandler struct {
+	*Context
+
+	// One of tag or digest gets set, depending on what is present in context.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetManifestSBOM returns the most recently stored SBOM of the manifest.
+func (msh *manifestSBOMHandler) GetManifestSBOM(w http.ResponseWriter, r *http.Request) {
+	if msh.Tag != "" {
+		desc, err := msh.Repository.Tags(msh).Get(msh, msh.Tag)
+		if err != nil {
+			msh.Errors = append(msh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			return
+		}
+		msh.Digest = desc.Digest
+	}
+
+	manifests, err := msh.Repository.Manifests(msh)
+	if err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if exists, err := manifests.Exists(msh, msh.Digest); err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	} else if !exists {
+		msh.Errors = append(msh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(msh.Digest))
+		return
+	}
+
+	name := msh.Repository.Named().Name()
+	referrers, err := storage.Referrers(msh, msh.driverFor(name), name, msh.Digest)
+	if err != nil {
+		msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	for _, referrer := range referrers {
+		manifest, err := manifests.Get(msh, referrer.Digest)
+		if err != nil {
+			msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		artifact, ok := manifest.(*schema2.DeserializedManifest)
+		if !ok || len(artifact.Layers) == 0 {
+			continue
+		}
+		artifactType, err := artifact.ArtifactType()
+		if err != nil || !sbomMediaTypes[artifactType] {
+			continue
+		}
+
+		sbom := artifact.Layers[0]
+		content, err := msh.Repository.Blobs(msh).Get(msh, sbom.Digest)
+		if err != nil {
+			msh.Errors = append(msh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", artifactType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Docker-Content-Digest", sbom.Digest.String())
+		w.Header().Set("Docker-Artifact-Digest", referrer.Digest.String())
+		w.Write(content)
+		return
+	}
+
+	msh.Errors = append(msh.Errors, v2.ErrorCodeSBOMUnknown.WithDetail(msh.Digest))
+}
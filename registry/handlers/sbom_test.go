@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/testutil"
+)
+
+// TestSBOM checks that the images pushed are submitted to the SBOM generator,
+// and that the SBOM it returns is served for the tag of the image.
+func TestSBOM(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+	sbom := []byte(`{"spdxVersion":"SPDX-2.3","name":"foo/bar"}`)
+
+	var mu sync.Mutex
+	var requests []sbomRequest
+	generator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var image sbomRequest
+		if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, image)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/spdx+json")
+		w.Write(sbom)
+	}))
+	defer generator.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.SBOM.URL = generator.URL
+	config.HTTP.SBOM.Headers = http.Header{"Authorization": {"Bearer secret"}}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	layer, layerDigest, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layer)
+
+	image := []byte(`{"architecture":"amd64","os":"linux"}`)
+	imageDigest := digest.FromBytes(image)
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, imageDigest, uploadURLBase, bytes.NewReader(image))
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	sbomURL, err := env.builder.BuildManifestSBOMURL(tagRef)
+	checkErr(t, err, "building manifest sbom url")
+
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting manifest", manifestURL, schema2.MediaTypeManifest, &schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			Digest:    imageDigest,
+			Size:      int64(len(image)),
+			MediaType: schema2.MediaTypeConfig,
+		},
+		Layers: []distribution.Descriptor{
+			{
+				Digest:    layerDigest,
+				Size:      1,
+				MediaType: schema2.MediaTypeLayer,
+			},
+		},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+	dgst, err := digest.ParseDigest(resp.Header.Get("Docker-Content-Digest"))
+	checkErr(t, err, "parsing manifest digest")
+
+	// The SBOM is generated in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err = http.Get(sbomURL)
+		checkErr(t, err, "getting sbom")
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK || time.Now().After(deadline) {
+			break
+		}
+		checkBodyHasErrorCodes(t, "getting sbom before it is generated", resp, v2.ErrorCodeSBOMUnknown)
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkResponse(t, "getting sbom", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{"application/spdx+json"},
+		"Docker-Content-Digest": []string{digest.FromBytes(sbom).String()},
+	})
+	content, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading sbom")
+	if !bytes.Equal(content, sbom) {
+		t.Fatalf("unexpected sbom: %s", content)
+	}
+
+	// The SBOM artifact itself is not submitted to the generator.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 || requests[0].Repository != imageName.Name() || requests[0].Tag != "latest" || requests[0].Digest != dgst || requests[0].MediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected requests to the generator: %+v", requests)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// schema1Warning is sent in the Warning header of responses to schema1
+// manifest requests while schema1 is deprecated.
+const schema1Warning = `299 - "Docker schema1 manifests are deprecated and will be rejected by this registry in the future; push the image again with a client supporting schema2"`
+
+// Schema1Metrics counts the schema1 manifests pushed and pulled, so operators
+// can tell whether clients still depend on them before rejecting them.
+type Schema1Metrics struct {
+	Pushes   uint64
+	Pulls    uint64
+	Rejected uint64
+}
+
+type schema1MetricsCollector struct {
+	metrics Schema1Metrics
+}
+
+// Push tracks a schema1 manifest push, noting whether it was rejected.
+func (smc *schema1MetricsCollector) Push(rejected bool) {
+	atomic.AddUint64(&smc.metrics.Pushes, 1)
+	if rejected {
+		atomic.AddUint64(&smc.metrics.Rejected, 1)
+	}
+}
+
+// Pull tracks a schema1 manifest pull, noting whether it was rejected.
+func (smc *schema1MetricsCollector) Pull(rejected bool) {
+	atomic.AddUint64(&smc.metrics.Pulls, 1)
+	if rejected {
+		atomic.AddUint64(&smc.metrics.Rejected, 1)
+	}
+}
+
+// Snapshot returns a consistent copy of the counters.
+func (smc *schema1MetricsCollector) Snapshot() Schema1Metrics {
+	return Schema1Metrics{
+		Pushes:   atomic.LoadUint64(&smc.metrics.Pushes),
+		Pulls:    atomic.LoadUint64(&smc.metrics.Pulls),
+		Rejected: atomic.LoadUint64(&smc.metrics.Rejected),
+	}
+}
+
+// schema1Metrics tracks schema1 manifest requests. This is kept globally and
+// made available via expvar.
+var schema1Metrics = &schema1MetricsCollector{}
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("schema1", expvar.Func(func() interface{} {
+		return schema1Metrics.Snapshot()
+	}))
+}
+
+// checkSchema1 applies the configured deprecation mode to a request pushing
+// or pulling a schema1 manifest. It returns false, after appending an error,
+// if the request must be rejected.
+func (imh *imageManifestHandler) checkSchema1(w http.ResponseWriter, push bool) bool {
+	mode := imh.App.Config.Compatibility.Schema1.Deprecation
+	rejected := mode == configuration.Schema1Reject
+
+	if push {
+		schema1Metrics.Push(rejected)
+	} else {
+		schema1Metrics.Pull(rejected)
+	}
+
+	switch mode {
+	case configuration.Schema1Warn:
+		ctxu.GetLogger(imh).Warnf("deprecated schema1 manifest requested for %s", imh.Repository.Named().Name())
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Warning", schema1Warning)
+	case configuration.Schema1Reject:
+		ctxu.GetLogger(imh).Infof("rejected schema1 manifest request for %s", imh.Repository.Named().Name())
+		if push {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithMessage("schema1 manifests are no longer accepted"))
+		} else {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("schema1 manifests are no longer served"))
+		}
+		return false
+	}
+
+	return true
+}
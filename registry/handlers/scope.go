@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// configureScope configures how the tenant of the storage scope of requests
+// is set, as configured by the scope storage section: from the top-level
+// namespace of the repository, or from a request header.
+func (app *App) configureScope(config configuration.Parameters) {
+	v, ok := config["tenant"]
+	if !ok {
+		return
+	}
+	tenant, ok := v.(string)
+	if !ok {
+		panic("scope's tenant config key must be a string")
+	}
+
+	switch tenant {
+	case "namespace":
+	case "header":
+		v, ok := config["header"]
+		if !ok {
+			panic("scope's header config key is required to set the tenant from a header")
+		}
+		header, ok := v.(string)
+		if !ok || header == "" {
+			panic("scope's header config key must be a non-empty string")
+		}
+		app.scopeTenantHeader = http.CanonicalHeaderKey(header)
+	default:
+		panic(fmt.Sprintf("unknown scope tenant %q", tenant))
+	}
+
+	app.scopeTenant = tenant
+	ctxu.GetLogger(app).Infof("setting the tenant of the storage scope from the %s", tenant)
+}
+
+// withStorageScope sets the storage scope of the request ctx serves, for
+// storage middleware to read from the context of driver calls.
+func (app *App) withStorageScope(ctx *Context, r *http.Request) error {
+	scope := make(storagemiddleware.Scope)
+
+	name := getName(ctx)
+	if name != "" {
+		scope[storagemiddleware.ScopeRepository] = name
+	}
+	if user := ctxu.GetStringValue(ctx, auth.UserNameKey); user != "" {
+		scope[storagemiddleware.ScopeUser] = user
+	}
+
+	switch app.scopeTenant {
+	case "namespace":
+		if name != "" {
+			scope[storagemiddleware.ScopeTenant] = topLevelNamespace(name)
+		}
+	case "header":
+		if tenant := r.Header.Get(app.scopeTenantHeader); tenant != "" {
+			scope[storagemiddleware.ScopeTenant] = tenant
+		}
+	}
+
+	if err := storagemiddleware.ApplyScopeFuncs(ctx, r, scope); err != nil {
+		return err
+	}
+
+	ctx.Context = storagemiddleware.WithScope(ctx.Context, scope)
+	return nil
+}
+
+// detachedContext returns a context bound to the registry rather than to the
+// request ctx serves, for work outliving the request. It logs with the logger
+// of the request and carries its storage scope.
+func detachedContext(app *App, ctx ctxu.Context) ctxu.Context {
+	detached := ctxu.WithLogger(app, ctxu.GetLogger(ctx))
+	return storagemiddleware.WithScope(detached, storagemiddleware.GetScope(ctx))
+}
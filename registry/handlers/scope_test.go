@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// scopeRecorder is a storage middleware recording the scope of the contents
+// put, by path.
+type scopeRecorder struct {
+	storagedriver.StorageDriver
+}
+
+var recordedScopes struct {
+	sync.Mutex
+	m map[string]storagemiddleware.Scope
+}
+
+func (d scopeRecorder) PutContent(ctx context.Context, path string, content []byte) error {
+	recordedScopes.Lock()
+	recordedScopes.m[path] = storagemiddleware.GetScope(ctx)
+	recordedScopes.Unlock()
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func init() {
+	recordedScopes.m = make(map[string]storagemiddleware.Scope)
+	storagemiddleware.Register("scoperecorder", func(d storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+		return scopeRecorder{StorageDriver: d}, nil
+	})
+	storagemiddleware.RegisterScopeFunc("scopetest", func(ctx context.Context, r *http.Request, scope storagemiddleware.Scope) error {
+		if r.Header.Get("X-Scope-Test") == "deny" {
+			return errcode.ErrorCodeDenied.WithDetail("tenant unknown")
+		}
+		return nil
+	})
+}
+
+// TestStorageScope checks that storage middleware reads the scope of the
+// request from the context of driver calls, and that scope funcs may deny
+// requests.
+func TestStorageScope(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"scope":    configuration.Parameters{"tenant": "namespace"},
+		},
+		Middleware: map[string][]configuration.Middleware{
+			"storage": {{Name: "scoperecorder"}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	createRepository(env, t, "acme/app", "latest")
+
+	recordedScopes.Lock()
+	var found bool
+	for path, scope := range recordedScopes.m {
+		if !strings.Contains(path, "/repositories/acme/app/_manifests/tags/latest/") {
+			continue
+		}
+		found = true
+		if scope[storagemiddleware.ScopeRepository] != "acme/app" || scope[storagemiddleware.ScopeTenant] != "acme" {
+			t.Errorf("unexpected scope of %s: %v", path, scope)
+		}
+	}
+	recordedScopes.Unlock()
+	if !found {
+		t.Fatalf("tag not put through the storage middleware")
+	}
+
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+	req, err := http.NewRequest("GET", catalogURL, nil)
+	checkErr(t, err, "building request")
+	req.Header.Set("X-Scope-Test", "deny")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "getting catalog")
+	defer resp.Body.Close()
+	checkResponse(t, "getting catalog with a denied scope", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "getting catalog with a denied scope", resp, errcode.ErrorCodeDenied)
+}
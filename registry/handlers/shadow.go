@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultShadowTimeout bounds a mirrored request unless another
+	// timeout is configured.
+	defaultShadowTimeout = 10 * time.Second
+
+	// maxShadowRequests is the number of mirrored requests in flight,
+	// beyond which the sampled requests are dropped rather than queued.
+	maxShadowRequests = 64
+)
+
+// shadowRoutes are the read routes whose requests are mirrored.
+var shadowRoutes = map[string]struct{}{
+	v2.RouteNameManifest: {},
+	v2.RouteNameBlob:     {},
+	v2.RouteNameTags:     {},
+	v2.RouteNameCatalog:  {},
+}
+
+// ShadowMetrics holds counters related to the requests mirrored to the
+// shadow deployment.
+type ShadowMetrics struct {
+	Requests   uint64
+	Matches    uint64
+	Mismatches uint64
+	Errors     uint64
+	Dropped    uint64
+}
+
+type shadowMetricsCollector struct {
+	metrics ShadowMetrics
+}
+
+// Snapshot returns a consistent copy of the counters.
+func (smc *shadowMetricsCollector) Snapshot() ShadowMetrics {
+	return ShadowMetrics{
+		Requests:   atomic.LoadUint64(&smc.metrics.Requests),
+		Matches:    atomic.LoadUint64(&smc.metrics.Matches),
+		Mismatches: atomic.LoadUint64(&smc.metrics.Mismatches),
+		Errors:     atomic.LoadUint64(&smc.metrics.Errors),
+		Dropped:    atomic.LoadUint64(&smc.metrics.Dropped),
+	}
+}
+
+// shadowMetrics tracks metrics about mirrored requests. This is kept
+// globally and made available via expvar.
+var shadowMetrics = &shadowMetricsCollector{}
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("shadow", expvar.Func(func() interface{} {
+		return shadowMetrics.Snapshot()
+	}))
+}
+
+// shadower mirrors read requests to a shadow deployment and compares its
+// responses with those of the registry.
+type shadower struct {
+	url        *url.URL
+	percentage float64
+	headers    http.Header
+	client     *http.Client
+
+	// inflight holds a token for each mirrored request in flight.
+	inflight chan struct{}
+}
+
+// shadowResponse is the part of a response compared between the registry
+// and the shadow deployment.
+type shadowResponse struct {
+	status int
+	digest string
+}
+
+// configureShadow sets up the mirroring of read requests to the shadow
+// deployment, if configured.
+func (app *App) configureShadow(configuration *configuration.Configuration) {
+	config := configuration.HTTP.Shadow
+	if config.URL == "" {
+		return
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		panic(fmt.Sprintf("invalid shadow url %q", config.URL))
+	}
+	if config.Percentage < 0 || config.Percentage > 100 {
+		panic(fmt.Sprintf("invalid shadow percentage %v, must be between 0 and 100", config.Percentage))
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	app.shadow = &shadower{
+		url:        u,
+		percentage: config.Percentage,
+		headers:    config.Headers,
+		client: &http.Client{
+			Timeout: timeout,
+			// The redirects are compared, not followed.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		inflight: make(chan struct{}, maxShadowRequests),
+	}
+	ctxu.GetLogger(app).Infof("mirroring %v%% of read requests to %s", config.Percentage, u)
+}
+
+// sampled reports whether r, served by the registry, is mirrored.
+func (s *shadower) sampled(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	if _, ok := shadowRoutes[route.GetName()]; !ok {
+		return false
+	}
+
+	return rand.Float64()*100 < s.percentage
+}
+
+// mirror sends a copy of r to the shadow deployment, once the registry has
+// responded through w, and logs the differences between the responses. The
+// shadow request is sent in the background, or dropped if too many are in
+// flight, so that it never delays the client.
+func (s *shadower) mirror(ctx *Context, w http.ResponseWriter, r *http.Request) {
+	if !s.sampled(r) {
+		return
+	}
+
+	primary := shadowResponse{
+		digest: w.Header().Get("Docker-Content-Digest"),
+	}
+	primary.status, _ = ctx.Value("http.response.status").(int)
+
+	req, err := s.request(r)
+	if err != nil {
+		ctxu.GetLogger(ctx).Errorf("error creating shadow request: %v", err)
+		return
+	}
+	if req.Method != r.Method && primary.status == http.StatusPartialContent {
+		// The whole blob is checked in place of the range fetched.
+		primary.status = http.StatusOK
+	}
+
+	select {
+	case s.inflight <- struct{}{}:
+	default:
+		atomic.AddUint64(&shadowMetrics.metrics.Dropped, 1)
+		return
+	}
+	atomic.AddUint64(&shadowMetrics.metrics.Requests, 1)
+
+	// The context of the request is released once it is served, only its
+	// logger is kept.
+	logger := ctxu.GetLogger(ctx)
+	go func() {
+		defer func() { <-s.inflight }()
+
+		shadow, err := s.do(req)
+		if err != nil {
+			atomic.AddUint64(&shadowMetrics.metrics.Errors, 1)
+			logger.Errorf("error mirroring %s %s to shadow: %v", req.Method, r.URL.RequestURI(), err)
+			return
+		}
+
+		if shadow != primary {
+			atomic.AddUint64(&shadowMetrics.metrics.Mismatches, 1)
+			logger.Warnf("shadow response mismatch for %s %s: status %d != %d, digest %q != %q",
+				r.Method, r.URL.RequestURI(), shadow.status, primary.status, shadow.digest, primary.digest)
+			return
+		}
+		atomic.AddUint64(&shadowMetrics.metrics.Matches, 1)
+	}()
+}
+
+// request returns the copy of r sent to the shadow deployment. Blob
+// fetches are sent as HEAD requests, so that their content is not
+// transferred twice.
+func (s *shadower) request(r *http.Request) (*http.Request, error) {
+	u := *s.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+
+	method := r.Method
+	if route := mux.CurrentRoute(r); route != nil && route.GetName() == v2.RouteNameBlob {
+		method = "HEAD"
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range r.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if method != r.Method {
+		req.Header.Del("Range")
+	}
+	for name, values := range s.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req, nil
+}
+
+// do sends req to the shadow deployment and returns its response.
+func (s *shadower) do(req *http.Request) (shadowResponse, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return shadowResponse{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return shadowResponse{
+		status: resp.StatusCode,
+		digest: resp.Header.Get("Docker-Content-Digest"),
+	}, nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestShadow checks that read requests are mirrored to the shadow
+// deployment, and that the responses which differ are counted as
+// mismatches.
+func TestShadow(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		mirrored []*http.Request
+	)
+	// The shadow deployment stores no repository.
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		mirrored = append(mirrored, r)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer shadow.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Shadow.URL = shadow.URL + "/shadow"
+	config.HTTP.Shadow.Percentage = 100
+	config.HTTP.Shadow.Headers = http.Header{"X-Shadow": []string{"true"}}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	dgst := createRepository(env, t, name.Name(), "latest")
+	before := shadowMetrics.Snapshot()
+
+	// pushes are not mirrored, nor are the routes other than reads
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+	resp, err := http.Get(baseURL)
+	checkErr(t, err, "getting base url")
+	resp.Body.Close()
+
+	// foo/bar differs on the shadow deployment, foo/missing does not
+	ref, _ := reference.WithDigest(name, dgst)
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, _ := http.NewRequest("GET", manifestURL, nil)
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	missing, _ := reference.ParseNamed("foo/missing")
+	tagsURL, err := env.builder.BuildTagsURL(missing)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "listing tags")
+	resp.Body.Close()
+	checkResponse(t, "listing tags", resp, http.StatusNotFound)
+
+	deadline := time.Now().Add(5 * time.Second)
+	var after ShadowMetrics
+	for {
+		after = shadowMetrics.Snapshot()
+		if after.Matches+after.Mismatches+after.Errors >= before.Matches+before.Mismatches+before.Errors+2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mirrored requests did not complete: %+v", after)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if after.Requests-before.Requests != 2 || after.Matches-before.Matches != 1 || after.Mismatches-before.Mismatches != 1 || after.Errors != before.Errors {
+		t.Fatalf("unexpected shadow metrics: %+v, before %+v", after, before)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mirrored) != 2 {
+		t.Fatalf("unexpected number of mirrored requests: %d", len(mirrored))
+	}
+	for _, r := range mirrored {
+		if !strings.HasPrefix(r.URL.Path, "/shadow/v2/") {
+			t.Fatalf("unexpected mirrored request path: %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Shadow") != "true" {
+			t.Fatalf("configured header not sent with the mirrored request")
+		}
+	}
+	for _, r := range mirrored {
+		if r.URL.Path == "/shadow/v2/foo/bar/manifests/"+dgst.String() {
+			if r.Header.Get("Accept") != "application/vnd.docker.distribution.manifest.v2+json" {
+				t.Fatalf("request headers not sent with the mirrored request: %v", r.Header)
+			}
+			return
+		}
+	}
+	t.Fatalf("manifest fetch not mirrored: %v", mirrored)
+}
+
+// TestShadowBlobFetch checks that blob fetches are mirrored as HEAD
+// requests.
+func TestShadowBlobFetch(t *testing.T) {
+	methods := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method
+		if r.Header.Get("Range") != "" {
+			t.Errorf("range sent with mirrored HEAD request")
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer shadow.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Shadow.URL = shadow.URL
+	config.HTTP.Shadow.Percentage = 100
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	name, _ := reference.ParseNamed("foo/bar")
+	ref, _ := reference.WithDigest(name, "sha256:4d2ec7e2d9a9ad4ac2bbc2d5ffcd08e3b2e6dff0219e4bf0e1edad1f0b83b21b")
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building blob url")
+	req, _ := http.NewRequest("GET", blobURL, nil)
+	req.Header.Set("Range", "bytes=0-1")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching blob")
+	resp.Body.Close()
+
+	select {
+	case method := <-methods:
+		if method != "HEAD" {
+			t.Fatalf("unexpected method of mirrored blob fetch: %s", method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blob fetch not mirrored")
+	}
+}
@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	_ "github.com/docker/distribution/registry/storage/driver/filesystem"
+)
+
+// specWorkflowDrivers returns the parameters of the storage drivers the
+// workflows are checked against.
+func specWorkflowDrivers(t *testing.T) (map[string]configuration.Parameters, func()) {
+	root, err := ioutil.TempDir("", "specworkflows-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+
+	return map[string]configuration.Parameters{
+		"inmemory":   {},
+		"filesystem": {"rootdirectory": root},
+	}, func() {
+		os.RemoveAll(root)
+	}
+}
+
+// TestSpecWorkflows checks the workflows of the OCI distribution-spec (pull,
+// push, content discovery and content management) against an in-process
+// registry with each storage driver which doesn't require external services.
+// The checks are modeled on the workflows of the spec's conformance suite but
+// are not the suite itself, which is run against a running registry.
+// Manifests are pushed as schema2 manifests, since the registry does not
+// accept OCI image manifests.
+func TestSpecWorkflows(t *testing.T) {
+	drivers, cleanup := specWorkflowDrivers(t)
+	defer cleanup()
+
+	for name, parameters := range drivers {
+		t.Run(name, func(t *testing.T) {
+			config := configuration.Configuration{
+				Storage: configuration.Storage{
+					name:     parameters,
+					"delete": configuration.Parameters{"enabled": true},
+				},
+			}
+			config.HTTP.Headers = headerConfig
+
+			env := newTestEnvWithConfig(t, &config)
+			defer env.server.Close()
+
+			runSpecWorkflows(t, env)
+		})
+	}
+}
+
+// specWorkflows holds the state shared by the workflows.
+type specWorkflows struct {
+	env  *testEnv
+	name reference.Named
+
+	config         []byte
+	layer          []byte
+	manifest       []byte
+	manifestDigest digest.Digest
+}
+
+func runSpecWorkflows(t *testing.T, env *testEnv) {
+	name, _ := reference.ParseNamed("workflows/test")
+	c := &specWorkflows{
+		env:    env,
+		name:   name,
+		config: []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`),
+		layer:  bytes.Repeat([]byte("workflow layer "), 1024),
+	}
+
+	// The workflows depend on each other, in the order of the spec.
+	for _, w := range []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"Push", c.push},
+		{"Pull", c.pull},
+		{"ContentDiscovery", c.contentDiscovery},
+		{"ContentManagement", c.contentManagement},
+	} {
+		if !t.Run(w.name, w.run) {
+			return
+		}
+	}
+}
+
+// do sends a request and returns its response and body.
+func (c *specWorkflows) do(t *testing.T, method, u string, header http.Header, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error sending %s %s: %v", method, u, err)
+	}
+	defer resp.Body.Close()
+
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading response: %v", err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(p))
+
+	return resp, p
+}
+
+// expectStatus fails the test unless resp has the given status code.
+func expectStatus(t *testing.T, msg string, resp *http.Response, body []byte, status int) {
+	if resp.StatusCode != status {
+		t.Fatalf("%s: unexpected status %d != %d: %s", msg, resp.StatusCode, status, body)
+	}
+}
+
+// expectErrorCode fails the test unless resp has the given status code and
+// its body reports code.
+func expectErrorCode(t *testing.T, msg string, resp *http.Response, body []byte, status int, code errcode.ErrorCode) {
+	expectStatus(t, msg, resp, body, status)
+	checkBodyHasErrorCodes(t, msg, resp, code)
+}
+
+// location resolves the Location header of resp.
+func (c *specWorkflows) location(t *testing.T, resp *http.Response) string {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		t.Fatalf("response to %s %s has no Location", resp.Request.Method, resp.Request.URL)
+	}
+	u, err := resp.Request.URL.Parse(location)
+	if err != nil {
+		t.Fatalf("unexpected error parsing location %q: %v", location, err)
+	}
+	return u.String()
+}
+
+// withQuery returns u with the given query parameters added.
+func withQuery(t *testing.T, u string, values url.Values) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("unexpected error parsing url %q: %v", u, err)
+	}
+	q := parsed.Query()
+	for k, vs := range values {
+		q[k] = vs
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// startUpload opens an upload session in repository name.
+func (c *specWorkflows) startUpload(t *testing.T, name reference.Named) string {
+	uploadURL, err := c.env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building upload url: %v", err)
+	}
+
+	resp, body := c.do(t, "POST", uploadURL, nil, nil)
+	expectStatus(t, "starting upload", resp, body, http.StatusAccepted)
+	return c.location(t, resp)
+}
+
+func (c *specWorkflows) blobURL(t *testing.T, name reference.Named, dgst digest.Digest) string {
+	ref, _ := reference.WithDigest(name, dgst)
+	u, err := c.env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	return u
+}
+
+func (c *specWorkflows) manifestURL(t *testing.T, reference string) string {
+	ref, err := c.referenceFor(reference)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest reference: %v", err)
+	}
+	u, err := c.env.builder.BuildManifestURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	return u
+}
+
+func (c *specWorkflows) referenceFor(ref string) (reference.Named, error) {
+	if dgst, err := digest.ParseDigest(ref); err == nil {
+		return reference.WithDigest(c.name, dgst)
+	}
+	return reference.WithTag(c.name, ref)
+}
+
+var octetStream = http.Header{"Content-Type": []string{"application/octet-stream"}}
+
+func (c *specWorkflows) push(t *testing.T) {
+	configDigest := digest.FromBytes(c.config)
+	layerDigest := digest.FromBytes(c.layer)
+
+	t.Run("APIVersion", func(t *testing.T) {
+		baseURL, err := c.env.builder.BuildBaseURL()
+		if err != nil {
+			t.Fatalf("unexpected error building base url: %v", err)
+		}
+		resp, body := c.do(t, "GET", baseURL, nil, nil)
+		expectStatus(t, "checking api version", resp, body, http.StatusOK)
+	})
+
+	t.Run("MonolithicUpload", func(t *testing.T) {
+		location := c.startUpload(t, c.name)
+		resp, body := c.do(t, "PUT", withQuery(t, location, url.Values{"digest": {configDigest.String()}}), octetStream, c.config)
+		expectStatus(t, "finishing monolithic upload", resp, body, http.StatusCreated)
+		if got := resp.Header.Get("Docker-Content-Digest"); got != configDigest.String() {
+			t.Fatalf("unexpected digest of uploaded blob: %s != %s", got, configDigest)
+		}
+		c.location(t, resp)
+	})
+
+	t.Run("ChunkedUpload", func(t *testing.T) {
+		location := c.startUpload(t, c.name)
+		half := len(c.layer) / 2
+
+		resp, body := c.do(t, "PATCH", location, octetStream, c.layer[:half])
+		expectStatus(t, "uploading first chunk", resp, body, http.StatusAccepted)
+		if got, want := resp.Header.Get("Range"), fmt.Sprintf("0-%d", half-1); got != want {
+			t.Fatalf("unexpected range after first chunk: %q != %q", got, want)
+		}
+		location = c.location(t, resp)
+
+		// The upload is resumed from the location of its status.
+		resp, body = c.do(t, "GET", location, nil, nil)
+		expectStatus(t, "getting upload status", resp, body, http.StatusNoContent)
+		if got, want := resp.Header.Get("Range"), fmt.Sprintf("0-%d", half-1); got != want {
+			t.Fatalf("unexpected range of upload status: %q != %q", got, want)
+		}
+		location = c.location(t, resp)
+
+		resp, body = c.do(t, "PATCH", location, octetStream, c.layer[half:])
+		expectStatus(t, "uploading second chunk", resp, body, http.StatusAccepted)
+		location = c.location(t, resp)
+
+		resp, body = c.do(t, "PUT", withQuery(t, location, url.Values{"digest": {layerDigest.String()}}), octetStream, nil)
+		expectStatus(t, "finishing chunked upload", resp, body, http.StatusCreated)
+		if got := resp.Header.Get("Docker-Content-Digest"); got != layerDigest.String() {
+			t.Fatalf("unexpected digest of uploaded blob: %s != %s", got, layerDigest)
+		}
+	})
+
+	t.Run("OutOfOrderChunk", func(t *testing.T) {
+		t.Skip("the registry does not support Content-Range on chunk uploads")
+	})
+
+	t.Run("InvalidDigest", func(t *testing.T) {
+		location := c.startUpload(t, c.name)
+		resp, body := c.do(t, "PUT", withQuery(t, location, url.Values{"digest": {digest.FromBytes([]byte("other")).String()}}), octetStream, c.config)
+		expectErrorCode(t, "finishing upload with a wrong digest", resp, body, http.StatusBadRequest, v2.ErrorCodeDigestInvalid)
+	})
+
+	t.Run("CrossRepositoryMount", func(t *testing.T) {
+		other, _ := reference.ParseNamed("workflows/other")
+		uploadURL, err := c.env.builder.BuildBlobUploadURL(other, url.Values{
+			"mount": {layerDigest.String()},
+			"from":  {c.name.Name()},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error building upload url: %v", err)
+		}
+		resp, body := c.do(t, "POST", uploadURL, nil, nil)
+		expectStatus(t, "mounting blob", resp, body, http.StatusCreated)
+
+		resp, body = c.do(t, "HEAD", c.blobURL(t, other, layerDigest), nil, nil)
+		expectStatus(t, "checking mounted blob", resp, body, http.StatusOK)
+	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: schema2.MediaTypeConfig,
+				Size:      int64(len(c.config)),
+				Digest:    configDigest,
+			},
+			Layers: []distribution.Descriptor{{
+				MediaType: schema2.MediaTypeLayer,
+				Size:      int64(len(c.layer)),
+				Digest:    layerDigest,
+			}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error building manifest: %v", err)
+		}
+		_, c.manifest, _ = m.Payload()
+		c.manifestDigest = digest.FromBytes(c.manifest)
+
+		header := http.Header{"Content-Type": {schema2.MediaTypeManifest}}
+		resp, body := c.do(t, "PUT", c.manifestURL(t, "latest"), header, c.manifest)
+		expectStatus(t, "pushing manifest", resp, body, http.StatusCreated)
+		if got := resp.Header.Get("Docker-Content-Digest"); got != c.manifestDigest.String() {
+			t.Fatalf("unexpected digest of pushed manifest: %s != %s", got, c.manifestDigest)
+		}
+		c.location(t, resp)
+	})
+
+	t.Run("ManifestBlobUnknown", func(t *testing.T) {
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: schema2.MediaTypeConfig,
+				Size:      5,
+				Digest:    digest.FromBytes([]byte("other")),
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error building manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+
+		header := http.Header{"Content-Type": {schema2.MediaTypeManifest}}
+		resp, body := c.do(t, "PUT", c.manifestURL(t, "broken"), header, payload)
+		expectErrorCode(t, "pushing manifest referencing an unknown blob", resp, body, http.StatusBadRequest, v2.ErrorCodeManifestBlobUnknown)
+	})
+}
+
+func (c *specWorkflows) pull(t *testing.T) {
+	accept := http.Header{"Accept": {schema2.MediaTypeManifest}}
+
+	t.Run("ManifestByTag", func(t *testing.T) {
+		resp, body := c.do(t, "HEAD", c.manifestURL(t, "latest"), accept, nil)
+		expectStatus(t, "checking manifest", resp, body, http.StatusOK)
+		if got := resp.Header.Get("Docker-Content-Digest"); got != c.manifestDigest.String() {
+			t.Fatalf("unexpected manifest digest: %s != %s", got, c.manifestDigest)
+		}
+		if got, want := resp.Header.Get("Content-Length"), fmt.Sprint(len(c.manifest)); got != want {
+			t.Fatalf("unexpected manifest length: %s != %s", got, want)
+		}
+
+		resp, body = c.do(t, "GET", c.manifestURL(t, "latest"), accept, nil)
+		expectStatus(t, "pulling manifest", resp, body, http.StatusOK)
+		if !bytes.Equal(body, c.manifest) {
+			t.Fatalf("unexpected manifest: %s", body)
+		}
+	})
+
+	t.Run("ManifestByDigest", func(t *testing.T) {
+		resp, body := c.do(t, "GET", c.manifestURL(t, c.manifestDigest.String()), accept, nil)
+		expectStatus(t, "pulling manifest by digest", resp, body, http.StatusOK)
+		if !bytes.Equal(body, c.manifest) {
+			t.Fatalf("unexpected manifest: %s", body)
+		}
+	})
+
+	t.Run("Blob", func(t *testing.T) {
+		layerURL := c.blobURL(t, c.name, digest.FromBytes(c.layer))
+
+		resp, body := c.do(t, "HEAD", layerURL, nil, nil)
+		expectStatus(t, "checking blob", resp, body, http.StatusOK)
+		if got, want := resp.Header.Get("Content-Length"), fmt.Sprint(len(c.layer)); got != want {
+			t.Fatalf("unexpected blob length: %s != %s", got, want)
+		}
+
+		resp, body = c.do(t, "GET", layerURL, nil, nil)
+		expectStatus(t, "pulling blob", resp, body, http.StatusOK)
+		if !bytes.Equal(body, c.layer) {
+			t.Fatalf("unexpected blob content")
+		}
+	})
+
+	t.Run("ManifestUnknown", func(t *testing.T) {
+		resp, body := c.do(t, "GET", c.manifestURL(t, "unknown"), accept, nil)
+		expectErrorCode(t, "pulling unknown manifest", resp, body, http.StatusNotFound, v2.ErrorCodeManifestUnknown)
+	})
+
+	t.Run("BlobUnknown", func(t *testing.T) {
+		resp, body := c.do(t, "GET", c.blobURL(t, c.name, digest.FromBytes([]byte("unknown"))), nil, nil)
+		expectErrorCode(t, "pulling unknown blob", resp, body, http.StatusNotFound, v2.ErrorCodeBlobUnknown)
+	})
+}
+
+func (c *specWorkflows) contentDiscovery(t *testing.T) {
+	header := http.Header{"Content-Type": {schema2.MediaTypeManifest}}
+	tags := []string{"latest", "v1", "v2", "v3"}
+	for _, tag := range tags[1:] {
+		resp, body := c.do(t, "PUT", c.manifestURL(t, tag), header, c.manifest)
+		expectStatus(t, "tagging manifest", resp, body, http.StatusCreated)
+	}
+
+	t.Run("TagsList", func(t *testing.T) {
+		tagsURL, err := c.env.builder.BuildTagsURL(c.name)
+		if err != nil {
+			t.Fatalf("unexpected error building tags url: %v", err)
+		}
+		resp, body := c.do(t, "GET", tagsURL, nil, nil)
+		expectStatus(t, "listing tags", resp, body, http.StatusOK)
+		var list tagsAPIResponse
+		if err := json.Unmarshal(body, &list); err != nil {
+			t.Fatalf("unexpected error decoding tags: %v", err)
+		}
+		if list.Name != c.name.Name() || !reflect.DeepEqual(list.Tags, tags) {
+			t.Fatalf("unexpected tags of %s: %v != %v", list.Name, list.Tags, tags)
+		}
+	})
+
+	t.Run("TagsListPagination", func(t *testing.T) {
+		t.Skip("the registry does not paginate tag lists")
+	})
+
+	t.Run("NameUnknown", func(t *testing.T) {
+		unknown, _ := reference.ParseNamed("workflows/unknown")
+		tagsURL, err := c.env.builder.BuildTagsURL(unknown)
+		if err != nil {
+			t.Fatalf("unexpected error building tags url: %v", err)
+		}
+		resp, body := c.do(t, "GET", tagsURL, nil, nil)
+		expectErrorCode(t, "listing tags of an unknown repository", resp, body, http.StatusNotFound, v2.ErrorCodeNameUnknown)
+	})
+}
+
+func (c *specWorkflows) contentManagement(t *testing.T) {
+	accept := http.Header{"Accept": {schema2.MediaTypeManifest}}
+
+	t.Run("DeleteManifest", func(t *testing.T) {
+		resp, body := c.do(t, "DELETE", c.manifestURL(t, c.manifestDigest.String()), nil, nil)
+		expectStatus(t, "deleting manifest", resp, body, http.StatusAccepted)
+
+		resp, body = c.do(t, "GET", c.manifestURL(t, c.manifestDigest.String()), accept, nil)
+		expectErrorCode(t, "pulling deleted manifest", resp, body, http.StatusNotFound, v2.ErrorCodeManifestUnknown)
+	})
+
+	t.Run("DeleteBlob", func(t *testing.T) {
+		layerURL := c.blobURL(t, c.name, digest.FromBytes(c.layer))
+		resp, body := c.do(t, "DELETE", layerURL, nil, nil)
+		expectStatus(t, "deleting blob", resp, body, http.StatusAccepted)
+
+		resp, body = c.do(t, "GET", layerURL, nil, nil)
+		expectErrorCode(t, "pulling deleted blob", resp, body, http.StatusNotFound, v2.ErrorCodeBlobUnknown)
+	})
+}
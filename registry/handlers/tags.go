@@ -7,6 +7,7 @@ import (
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 )
 
@@ -31,13 +32,37 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// GetTags returns a json list of tags for a specific image name.
+// tagsOrderLastUpdate is the order parameter listing tags most recently
+// updated first.
+const tagsOrderLastUpdate = "lastupdate"
+
+// GetTags returns a json list of tags for a specific image name. With an
+// order=lastupdate query parameter, the most recently updated tags are listed
+// first.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+
+	var (
+		tags []string
+		err  error
+	)
+	switch order := r.URL.Query().Get("order"); order {
+	case "":
+		tags, err = tagService.All(th)
+	case tagsOrderLastUpdate:
+		tags, err = storage.TagsByLastUpdate(th, tagService)
+	default:
+		th.Errors = append(th.Errors, v2.ErrorCodeOrderInvalid.WithDetail(map[string]string{"order": order}))
+		return
+	}
 	if err != nil {
+		if err == distribution.ErrUnsupported {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithDetail("ordering tags by last update is not supported by a pull through cache"))
+			return
+		}
+
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
 			th.Errors = append(th.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": th.Repository.Named().Name()}))
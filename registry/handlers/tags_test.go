@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// TestTagsListOrder checks that tags are listed most recently pushed first
+// with order=lastupdate, and that unknown orders are rejected.
+func TestTagsListOrder(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	name := "foo/ordered"
+	createRepository(env, t, name, "first")
+	createRepository(env, t, name, "second")
+
+	imageName, _ := reference.ParseNamed(name)
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	checkErr(t, err, "building tags url")
+
+	listTags := func(msg string) []string {
+		resp, err := http.Get(tagsURL + "?order=lastupdate")
+		checkErr(t, err, msg)
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+
+		var body tagsAPIResponse
+		checkErr(t, json.NewDecoder(resp.Body).Decode(&body), "decoding tags")
+		return body.Tags
+	}
+
+	if tags := listTags("listing tags by last update"); !reflect.DeepEqual(tags, []string{"second", "first"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	createRepository(env, t, name, "first")
+	if tags := listTags("listing tags by last update after pushing again"); !reflect.DeepEqual(tags, []string{"first", "second"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	resp, err := http.Get(tagsURL + "?order=size")
+	checkErr(t, err, "listing tags in an unknown order")
+	defer resp.Body.Close()
+	checkResponse(t, "listing tags in an unknown order", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "listing tags in an unknown order", resp, v2.ErrorCodeOrderInvalid)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/libtrust"
+	"github.com/gorilla/handlers"
+)
+
+// TagsSnapshotMediaType is the content type of signed tag snapshots.
+const TagsSnapshotMediaType = "application/vnd.docker.distribution.tags.snapshot.v1+prettyjws"
+
+// TagsSnapshot is the payload of a signed tag snapshot, recording the digest
+// each tag of a repository pointed to when the snapshot was taken.
+type TagsSnapshot struct {
+	Name      string                   `json:"name"`
+	Timestamp time.Time                `json:"timestamp"`
+	Tags      map[string]digest.Digest `json:"tags"`
+}
+
+// tagsSnapshotDispatcher constructs the tags snapshot handler api endpoint.
+func tagsSnapshotDispatcher(ctx *Context, r *http.Request) http.Handler {
+	tagsSnapshotHandler := &tagsSnapshotHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(tagsSnapshotHandler.GetTagsSnapshot),
+	}
+}
+
+// tagsSnapshotHandler handles requests for signed snapshots of the tags
+// under a repository name.
+type tagsSnapshotHandler struct {
+	*Context
+}
+
+// GetTagsSnapshot returns the tags of a repository and their digests, signed
+// with the registry's tag snapshot key.
+func (tsh *tagsSnapshotHandler) GetTagsSnapshot(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	key := tsh.App.tagSnapshotKey
+	if key == nil {
+		tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnsupported.WithDetail("tag snapshots are not enabled"))
+		return
+	}
+
+	snapshot := TagsSnapshot{
+		Name:      tsh.Repository.Named().Name(),
+		Timestamp: time.Now().UTC(),
+		Tags:      make(map[string]digest.Digest),
+	}
+
+	tagService := tsh.Repository.Tags(tsh)
+	tags, err := tagService.All(tsh)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			tsh.Errors = append(tsh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": snapshot.Name}))
+		default:
+			tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	for _, tag := range tags {
+		desc, err := tagService.Get(tsh, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				// Untagged since it was listed.
+				continue
+			}
+			tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		snapshot.Tags[tag] = desc.Digest
+	}
+
+	payload, err := json.MarshalIndent(snapshot, "", "   ")
+	if err != nil {
+		tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	js, err := libtrust.NewJSONSignature(payload)
+	if err != nil {
+		tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if err := js.Sign(key); err != nil {
+		tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	signed, err := js.PrettySignature("signatures")
+	if err != nil {
+		tsh.Errors = append(tsh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", TagsSnapshotMediaType)
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(signed).String())
+	w.Write(signed)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+)
+
+const (
+	// defaultTieringAge is how long a blob must have been unread to be moved
+	// to the cold storage class, if not configured.
+	defaultTieringAge = 90 * 24 * time.Hour
+
+	// defaultTieringInterval is the interval between runs of the tiering
+	// maintenance job, if not configured.
+	defaultTieringInterval = 24 * time.Hour
+
+	// defaultTieringMinSize is the size of the smallest blob moved to the
+	// cold storage class, if not configured.
+	defaultTieringMinSize = 1 << 20
+
+	// defaultTieringRetryAfter is the time clients are told to wait for the
+	// restore of an archived blob, if not configured.
+	defaultTieringRetryAfter = 10 * time.Minute
+
+	// tieringAccessResolution is the interval at which the reads of a blob
+	// are recorded by an instance: more frequent reads are not recorded.
+	tieringAccessResolution = time.Hour
+
+	// tieringMaxAccesses is the number of blobs whose last recorded read is
+	// remembered by an instance, bounding the memory used.
+	tieringMaxAccesses = 100000
+)
+
+// tiering holds the tiering policy of the registry, and the reads of blobs
+// recently recorded by the instance.
+type tiering struct {
+	opts       storage.TieringOpts
+	recall     storage.RecallOpts
+	interval   time.Duration
+	retryAfter time.Duration
+
+	mu       sync.Mutex
+	recorded map[digest.Digest]time.Time
+}
+
+// due returns whether a read of dgst at now must be recorded, and remembers
+// it if so.
+func (t *tiering) due(dgst digest.Digest, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.recorded[dgst]; ok && now.Sub(last) < tieringAccessResolution {
+		return false
+	}
+	if len(t.recorded) >= tieringMaxAccesses {
+		t.recorded = make(map[digest.Digest]time.Time)
+	}
+	t.recorded[dgst] = now
+	return true
+}
+
+// recallBlob records the read of the blob and recalls it from the cold
+// storage class if needed, returning whether it can be served. While an
+// archived blob is restored, the client is told to retry later.
+func (bh *blobHandler) recallBlob(w http.ResponseWriter, dgst digest.Digest) bool {
+	t := bh.App.tiering
+	name := bh.Repository.Named().Name()
+	driver := bh.App.driverFor(name)
+
+	registry := bh.App.storageRegistry
+	if ns := bh.App.namespaceStorageFor(name); ns != nil {
+		registry = ns.registry
+	}
+
+	if now := time.Now(); !bh.isReadOnly() && t.due(dgst, now) {
+		if err := storage.RecordBlobAccess(bh, driver, dgst, now); err != nil {
+			ctxu.GetLogger(bh).Errorf("tiering: error recording read of blob %s: %v", dgst, err)
+		}
+	}
+
+	readable, err := storage.RecallBlob(bh, driver, registry, dgst, t.recall)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(dgst))
+		} else {
+			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return false
+	}
+	if !readable {
+		w.Header().Set("Retry-After", retryAfter(t.retryAfter))
+		bh.Errors = append(bh.Errors, v2.ErrorCodeBlobRestoring.WithDetail(dgst))
+		return false
+	}
+	return true
+}
+
+// tierBlobs moves the blobs unread for long to the cold storage class, and
+// returns the number of blobs moved, or which would be moved on a dry run.
+func (app *App) tierBlobs(ctx ctxu.Context, opts storage.TieringOpts) (int, error) {
+	if app.isReadOnly() || app.isCache {
+		return 0, nil
+	}
+
+	tiered, err := storage.TierBlobs(ctx, app.driver, opts)
+	for _, blob := range tiered {
+		if opts.DryRun {
+			ctxu.GetLogger(ctx).Infof("tiering: would move blob %s of %d bytes to storage class %q, unread since %s", blob.Digest, blob.Size, opts.ColdClass, blob.AccessedAt)
+			continue
+		}
+		ctxu.GetLogger(ctx).Infof("tiering: moved blob %s of %d bytes to storage class %q, unread since %s", blob.Digest, blob.Size, opts.ColdClass, blob.AccessedAt)
+	}
+	return len(tiered), err
+}
+
+// configureTiering configures the tiering policy of the blobs of the
+// registry, as set by the tiering maintenance section, and schedules a
+// goroutine which periodically moves the blobs unread for long to the cold
+// storage class.
+func (app *App) configureTiering(config map[interface{}]interface{}) {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return
+	}
+	if app.isCache {
+		panic("tiering is not supported by a pull through cache")
+	}
+
+	t := &tiering{
+		opts: storage.TieringOpts{
+			Age:       defaultTieringAge,
+			MinSize:   defaultTieringMinSize,
+			ColdClass: "archive",
+		},
+		recall: storage.RecallOpts{
+			HotClass:    "standard",
+			RestoreDays: 1,
+		},
+		interval:   defaultTieringInterval,
+		retryAfter: defaultTieringRetryAfter,
+		recorded:   make(map[digest.Digest]time.Time),
+	}
+
+	durations := []struct {
+		key string
+		d   *time.Duration
+	}{
+		{"age", &t.opts.Age},
+		{"interval", &t.interval},
+		{"retryafter", &t.retryAfter},
+	}
+	for _, duration := range durations {
+		v, ok := config[duration.key]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			panic(fmt.Sprintf("tiering's %s config key must be a string", duration.key))
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("tiering's %s config key is not a valid duration: %q", duration.key, s))
+		}
+		*duration.d = d
+	}
+
+	if v, ok := config["minsize"]; ok {
+		minSize, ok := v.(int)
+		if !ok || minSize < 0 {
+			panic("tiering's minsize config key must be a non-negative integer")
+		}
+		t.opts.MinSize = int64(minSize)
+	}
+
+	if v, ok := config["restoredays"]; ok {
+		days, ok := v.(int)
+		if !ok || days < 1 {
+			panic("tiering's restoredays config key must be a positive integer")
+		}
+		t.recall.RestoreDays = days
+	}
+
+	for key, class := range map[string]*string{"coldclass": &t.opts.ColdClass, "hotclass": &t.recall.HotClass} {
+		if v, ok := config[key]; ok {
+			s, ok := v.(string)
+			if !ok || s == "" {
+				panic(fmt.Sprintf("tiering's %s config key must be a non-empty string", key))
+			}
+			*class = s
+		}
+	}
+
+	if v, ok := config["dryrun"]; ok {
+		dryRun, ok := v.(bool)
+		if !ok {
+			panic("tiering's dryrun config key must have a boolean value")
+		}
+		t.opts.DryRun = dryRun
+	}
+
+	app.tiering = t
+	leading := app.maintenanceJob("tiering")
+	go func() {
+		for {
+			ctxu.GetLogger(app).Infof("Starting blob tiering in %s", t.interval)
+			time.Sleep(t.interval)
+
+			if !leading() {
+				continue
+			}
+
+			count, err := app.tierBlobs(app, t.opts)
+			if err != nil {
+				ctxu.GetLogger(app).Errorf("tiering: %v", err)
+			}
+			ctxu.GetLogger(app).Infof("tiering: %d blobs unread for more than %s", count, t.opts.Age)
+		}
+	}()
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// archivingDriver is an in-memory driver with an archive storage class. Its
+// archived objects cannot be read, and are restored on the second call to
+// Restore.
+type archivingDriver struct {
+	storagedriver.StorageDriver
+
+	mu       sync.Mutex
+	archived map[string]bool
+	restored map[string]bool
+}
+
+type archivingDriverFactory struct{}
+
+func (archivingDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return &archivingDriver{
+		StorageDriver: inmemory.New(),
+		archived:      make(map[string]bool),
+		restored:      make(map[string]bool),
+	}, nil
+}
+
+func init() {
+	factory.Register("archivinginmemory", archivingDriverFactory{})
+}
+
+func (d *archivingDriver) SetStorageClass(ctx context.Context, path string, class string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.archived[path] = class == "archive"
+	d.restored[path] = false
+	return nil
+}
+
+func (d *archivingDriver) Restore(ctx context.Context, path string, days int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.archived[path] || d.restored[path] {
+		return true, nil
+	}
+	d.restored[path] = true
+	return false, nil
+}
+
+func (d *archivingDriver) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.archived[path] && !d.restored[path] {
+		return nil, fmt.Errorf("%s is archived", path)
+	}
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+// TestBlobTiering checks that a blob unread for long is archived, and that
+// reading it again starts its restore, clients being told to retry until it
+// is restored.
+func TestBlobTiering(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"archivinginmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{
+				"tiering": map[interface{}]interface{}{
+					"enabled":    true,
+					"retryafter": "90s",
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	layer := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(layer)
+	layerDigest := digest.FromBytes(layer)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	ref, _ := reference.WithDigest(imageName, layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building blob url")
+
+	resp, err := http.Get(layerURL)
+	checkErr(t, err, "fetching layer")
+	resp.Body.Close()
+	checkResponse(t, "fetching layer", resp, http.StatusOK)
+
+	opts := storage.TieringOpts{Age: time.Hour, ColdClass: "archive"}
+	count, err := env.app.tierBlobs(env.ctx, opts)
+	if err != nil || count != 0 {
+		t.Fatalf("unexpected blobs tiered: %d, %v", count, err)
+	}
+
+	opts.Age = time.Nanosecond
+	count, err = env.app.tierBlobs(env.ctx, opts)
+	if err != nil || count != 1 {
+		t.Fatalf("unexpected blobs tiered: %d, %v", count, err)
+	}
+
+	// The archived blob is still described.
+	resp, err = http.Head(layerURL)
+	checkErr(t, err, "checking archived layer")
+	checkResponse(t, "checking archived layer", resp, http.StatusOK)
+
+	resp, err = http.Get(layerURL)
+	checkErr(t, err, "fetching archived layer")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching archived layer", resp, http.StatusAccepted)
+	checkHeaders(t, resp, http.Header{"Retry-After": []string{"90"}})
+	checkBodyHasErrorCodes(t, "fetching archived layer", resp, v2.ErrorCodeBlobRestoring)
+
+	resp, err = http.Get(layerURL)
+	checkErr(t, err, "fetching restored layer")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching restored layer", resp, http.StatusOK)
+	p, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading restored layer")
+	if !bytes.Equal(p, layer) {
+		t.Fatalf("restored layer content differs")
+	}
+
+	if class, err := storage.BlobColdClass(env.ctx, env.app.driver, layerDigest); err != nil || class != "" {
+		t.Fatalf("expected the restored layer to be hot: %q, %v", class, err)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// maxTrustMetadataSize is the largest trust metadata document accepted. TUF
+// metadata, even the targets of large repositories, stays well below it.
+const maxTrustMetadataSize = 4 << 20
+
+// trustDispatcher constructs the trust metadata handler api endpoint.
+func trustDispatcher(ctx *Context, r *http.Request) http.Handler {
+	if !ctx.App.Config.HTTP.Trust.Enabled {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail("trust metadata storage is not enabled"))
+		})
+	}
+
+	trustHandler := &trustHandler{
+		Context: ctx,
+		Role:    ctxu.GetStringValue(ctx, "vars.role"),
+		Store:   storage.NewTrustStore(ctx.App.driverFor(ctx.Repository.Named().Name()), ctx.Repository.Named()),
+	}
+
+	if checksum := strings.TrimPrefix(ctxu.GetStringValue(ctx, "vars.checksum"), "."); checksum != "" {
+		trustHandler.Digest = digest.NewDigestFromHex(string(digest.SHA256), checksum)
+	}
+
+	mhandler := handlers.MethodHandler{
+		"GET":  http.HandlerFunc(trustHandler.GetTrustMetadata),
+		"HEAD": http.HandlerFunc(trustHandler.GetTrustMetadata),
+	}
+
+	if !ctx.isReadOnly() && trustHandler.Digest == "" {
+		mhandler["PUT"] = http.HandlerFunc(trustHandler.PutTrustMetadata)
+		mhandler["DELETE"] = http.HandlerFunc(trustHandler.DeleteTrustMetadata)
+	}
+
+	return mhandler
+}
+
+// trustHandler handles requests for the trust metadata of a role in a
+// repository.
+type trustHandler struct {
+	*Context
+
+	Role string
+
+	// Digest addresses a revision of the metadata. The current revision is
+	// used if it is empty.
+	Digest digest.Digest
+
+	Store *storage.TrustStore
+}
+
+// GetTrustMetadata returns the current or requested revision of the trust
+// metadata of the role.
+func (th *trustHandler) GetTrustMetadata(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(th).Debug("GetTrustMetadata")
+
+	var (
+		content []byte
+		dgst    = th.Digest
+		err     error
+	)
+	if dgst == "" {
+		content, dgst, err = th.Store.Get(th, th.Role)
+	} else {
+		content, err = th.Store.GetRevision(th, th.Role, dgst)
+	}
+	if err != nil {
+		if err == storage.ErrTrustMetadataUnknown {
+			th.Errors = append(th.Errors, v2.ErrorCodeTrustMetadataUnknown.WithDetail(map[string]string{"role": th.Role}))
+		} else {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, dgst))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(content)
+}
+
+// PutTrustMetadata stores the request body as the current revision of the
+// trust metadata of the role.
+func (th *trustHandler) PutTrustMetadata(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(th).Debug("PutTrustMetadata")
+
+	if th.App.isCache {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithDetail("trust metadata cannot be stored in a pull through cache"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(r.Body, maxTrustMetadataSize+1)); err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if buf.Len() > maxTrustMetadataSize {
+		th.Errors = append(th.Errors, v2.ErrorCodeTrustMetadataInvalid.WithDetail("trust metadata too large"))
+		return
+	}
+	if !json.Valid(buf.Bytes()) {
+		th.Errors = append(th.Errors, v2.ErrorCodeTrustMetadataInvalid.WithDetail("trust metadata is not a JSON document"))
+		return
+	}
+
+	dgst, err := th.Store.Put(th, th.Role, buf.Bytes())
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	location, err := th.urlBuilder.BuildTrustMetadataURL(th.Repository.Named(), th.Role, dgst)
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Length", "0")
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DeleteTrustMetadata removes all revisions of the trust metadata of the
+// role.
+func (th *trustHandler) DeleteTrustMetadata(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(th).Debug("DeleteTrustMetadata")
+
+	if th.App.isCache {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithDetail("trust metadata cannot be deleted from a pull through cache"))
+		return
+	}
+
+	if err := th.Store.Delete(th, th.Role); err != nil {
+		if err == storage.ErrTrustMetadataUnknown {
+			th.Errors = append(th.Errors, v2.ErrorCodeTrustMetadataUnknown.WithDetail(map[string]string{"role": th.Role}))
+		} else {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// The following are the names of the routes serving the web UI.
+const (
+	routeNameUIIndex      = "ui-index"
+	routeNameUIRepository = "ui-repository"
+	routeNameUIManifest   = "ui-manifest"
+)
+
+var uiRoutePaths = map[string]string{
+	routeNameUIIndex:      "/ui/",
+	routeNameUIRepository: "/ui/repositories/{name:" + reference.NameRegexp.String() + "}/tags",
+	routeNameUIManifest:   "/ui/repositories/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+}
+
+// uiPageSize is the number of repositories listed on each page of the
+// catalog.
+const uiPageSize = 100
+
+// registerUI registers the routes and dispatchers of the web UI.
+func (app *App) registerUI() {
+	router := app.router
+	if app.Config.HTTP.Prefix != "" {
+		router = router.PathPrefix(app.Config.HTTP.Prefix).Subrouter()
+	}
+
+	for name, path := range uiRoutePaths {
+		router.Path(path).Name(name)
+	}
+
+	app.register(routeNameUIIndex, uiIndexDispatcher)
+	app.register(routeNameUIRepository, uiRepositoryDispatcher)
+	app.register(routeNameUIManifest, uiManifestDispatcher)
+
+	if app.accessController == nil {
+		ctxu.GetLogger(app).Warn("web UI enabled without an access controller, anyone may browse the registry")
+	}
+}
+
+// isUIRequest returns true if the request is routed to the web UI.
+func isUIRequest(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	_, ok := uiRoutePaths[route.GetName()]
+	return ok
+}
+
+// uiHandler renders the pages of the web UI.
+type uiHandler struct {
+	*Context
+}
+
+func uiIndexDispatcher(ctx *Context, r *http.Request) http.Handler {
+	uh := &uiHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(uh.GetIndex),
+	}
+}
+
+// GetIndex renders a page of the repository catalog.
+func (uh *uiHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
+	last := r.URL.Query().Get("last")
+
+	repos := make([]string, uiPageSize)
+	n, err := uh.App.registry.Repositories(uh, repos, last)
+	if err != nil && err != io.EOF {
+		uh.renderError(w, err)
+		return
+	}
+
+	page := uiIndexPage{uiLayout: uh.layout("Repositories")}
+	for _, name := range repos[:n] {
+		page.Repositories = append(page.Repositories, uiLink{
+			Text: name,
+			URL:  uh.uiURL(routeNameUIRepository, "name", name),
+		})
+	}
+
+	if err == nil && n > 0 {
+		page.Next = uh.uiURL(routeNameUIIndex) + "?" + url.Values{"last": {repos[n-1]}}.Encode()
+	}
+
+	uh.render(w, http.StatusOK, "index", page)
+}
+
+func uiRepositoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	uh := &uiHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(uh.GetRepository),
+	}
+}
+
+// GetRepository renders the tags of a repository.
+func (uh *uiHandler) GetRepository(w http.ResponseWriter, r *http.Request) {
+	name := uh.Repository.Named().Name()
+
+	tags, err := uh.Repository.Tags(uh).All(uh)
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+	sort.Strings(tags)
+
+	page := uiRepositoryPage{
+		uiLayout: uh.layout(name),
+		Name:     name,
+	}
+	for _, tag := range tags {
+		page.Tags = append(page.Tags, uiLink{
+			Text: tag,
+			URL:  uh.uiURL(routeNameUIManifest, "name", name, "reference", tag),
+		})
+	}
+
+	uh.render(w, http.StatusOK, "repository", page)
+}
+
+func uiManifestDispatcher(ctx *Context, r *http.Request) http.Handler {
+	uh := &uiHandler{Context: ctx}
+
+	mhandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(uh.GetManifest),
+	}
+
+	if !ctx.isReadOnly() {
+		mhandler["POST"] = http.HandlerFunc(uh.DeleteManifest)
+	}
+
+	return mhandler
+}
+
+// GetManifest renders the content and references of a manifest.
+func (uh *uiHandler) GetManifest(w http.ResponseWriter, r *http.Request) {
+	name := uh.Repository.Named().Name()
+	ref := getReference(uh)
+
+	dgst, err := uh.resolveManifest()
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	manifests, err := uh.Repository.Manifests(uh)
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	m, err := manifests.Get(uh, dgst)
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	var content bytes.Buffer
+	if err := json.Indent(&content, payload, "", "   "); err != nil {
+		content.Reset()
+		content.Write(payload)
+	}
+
+	page := uiManifestPage{
+		uiLayout: uh.layout(name + ":" + ref),
+		Repository: uiLink{
+			Text: name,
+			URL:  uh.uiURL(routeNameUIRepository, "name", name),
+		},
+		Reference: ref,
+		Digest:    dgst,
+		MediaType: mediaType,
+		Size:      len(payload),
+		Content:   content.String(),
+		CanDelete: uh.canDelete(),
+	}
+
+	if sm, ok := m.(*schema2.DeserializedManifest); ok {
+		page.Config = &sm.Config
+	}
+
+	// The references of a manifest list are manifests of the same
+	// repository, which can be browsed in turn.
+	isList := mediaType == manifestlist.MediaTypeManifestList
+	for _, descriptor := range m.References() {
+		item := uiReference{Descriptor: descriptor}
+		if isList {
+			item.URL = uh.uiURL(routeNameUIManifest, "name", name, "reference", descriptor.Digest.String())
+		}
+		page.References = append(page.References, item)
+	}
+
+	uh.render(w, http.StatusOK, "manifest", page)
+}
+
+// DeleteManifest deletes a manifest and removes the tags referring to it, as
+// a DELETE request to the manifest endpoint of the V2 API would.
+func (uh *uiHandler) DeleteManifest(w http.ResponseWriter, r *http.Request) {
+	name := uh.Repository.Named().Name()
+
+	if !uh.sameOrigin(r) {
+		uh.render(w, http.StatusForbidden, "error", uh.errorPage(http.StatusForbidden, "cross-origin requests may not delete manifests"))
+		return
+	}
+
+	dgst, err := uh.resolveManifest()
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	manifests, err := uh.Repository.Manifests(uh)
+	if err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	if err := manifests.Delete(uh, dgst); err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	if _, err := storage.RemoveTags(uh, uh.Repository.Tags(uh), dgst); err != nil {
+		uh.renderError(w, err)
+		return
+	}
+
+	ctxu.GetLogger(uh).Infof("ui: deleted manifest %s@%s", name, dgst)
+	http.Redirect(w, r, uh.uiURL(routeNameUIRepository, "name", name), http.StatusSeeOther)
+}
+
+// resolveManifest returns the digest of the manifest the request refers to,
+// looking up the tag if the reference is not a digest.
+func (uh *uiHandler) resolveManifest() (digest.Digest, error) {
+	ref := getReference(uh)
+	if dgst, err := digest.ParseDigest(ref); err == nil {
+		return dgst, nil
+	}
+
+	desc, err := uh.Repository.Tags(uh).Get(uh, ref)
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest, nil
+}
+
+// canDelete returns true if the manifest page should offer deletion. The
+// storage must allow deletes, the registry must be writable and the request
+// must be authorized to delete from the repository.
+func (uh *uiHandler) canDelete() bool {
+	if !uh.deleteEnabled || uh.isReadOnly() {
+		return false
+	}
+
+	if uh.accessController == nil {
+		return true
+	}
+
+	_, err := uh.accessController.Authorized(uh, appendAccessRecords(nil, "DELETE", uh.Repository.Named().Name())...)
+	return err == nil
+}
+
+// sameOrigin returns false unless the request was sent from a page of the
+// registry. Browsers attach credentials to cross-site form posts, so these
+// must not be able to delete content. Requests carrying neither Origin nor
+// Referer, which browsers send with form posts, are rejected too, since their
+// origin cannot be checked.
+func (uh *uiHandler) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if h, ok := uh.hostFor(r); ok && u.Host == h.Host {
+		return true
+	}
+	return u.Host == r.Host || (uh.httpHost.Host != "" && u.Host == uh.httpHost.Host)
+}
+
+// uiURL returns the path of the named UI route.
+func (uh *uiHandler) uiURL(routeName string, pairs ...string) string {
+	u, err := uh.router.Get(routeName).URL(pairs...)
+	if err != nil {
+		ctxu.GetLogger(uh).Errorf("error building url for %s: %v", routeName, err)
+		return ""
+	}
+	return u.String()
+}
+
+func (uh *uiHandler) layout(title string) uiLayout {
+	return uiLayout{
+		Title: title,
+		Home:  uh.uiURL(routeNameUIIndex),
+	}
+}
+
+func (uh *uiHandler) errorPage(status int, message string) uiErrorPage {
+	return uiErrorPage{
+		uiLayout: uh.layout(http.StatusText(status)),
+		Status:   status,
+		Message:  message,
+	}
+}
+
+// renderError renders an error page with a status matching err.
+func (uh *uiHandler) renderError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch err.(type) {
+	case distribution.ErrRepositoryUnknown, distribution.ErrTagUnknown,
+		distribution.ErrManifestUnknown, distribution.ErrManifestUnknownRevision:
+		status = http.StatusNotFound
+	case storage.LockTimeoutError:
+		status = http.StatusServiceUnavailable
+	default:
+		switch err {
+		case distribution.ErrBlobUnknown:
+			status = http.StatusNotFound
+		case distribution.ErrUnsupported:
+			status = http.StatusMethodNotAllowed
+		default:
+			ctxu.GetLogger(uh).Errorf("ui: %v", err)
+		}
+	}
+
+	uh.render(w, status, "error", uh.errorPage(status, err.Error()))
+}
+
+// render executes the named page template and writes it with status.
+func (uh *uiHandler) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := uiTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		ctxu.GetLogger(uh).Errorf("error rendering %s page: %v", name, err)
+		http.Error(w, fmt.Sprintf("error rendering page: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		ctxu.GetLogger(uh).Errorf("error writing %s page: %v", name, err)
+	}
+}
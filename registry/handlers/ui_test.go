@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/reference"
+)
+
+// TestWebUI browses a repository through the web UI and deletes its
+// manifest.
+func TestWebUI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UI.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	dgst := createRepository(env, t, imageName.Name(), "latest")
+
+	page := getUIPage(t, env.server.URL+"/ui/", http.StatusOK)
+	if !strings.Contains(page, `href="/ui/repositories/foo/bar/tags"`) {
+		t.Fatalf("repository missing from index page:\n%s", page)
+	}
+
+	page = getUIPage(t, env.server.URL+"/ui/repositories/foo/bar/tags", http.StatusOK)
+	if !strings.Contains(page, `href="/ui/repositories/foo/bar/manifests/latest"`) {
+		t.Fatalf("tag missing from repository page:\n%s", page)
+	}
+
+	manifestURL := env.server.URL + "/ui/repositories/foo/bar/manifests/latest"
+	page = getUIPage(t, manifestURL, http.StatusOK)
+	for _, expected := range []string{dgst.String(), "Delete manifest"} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("%q missing from manifest page:\n%s", expected, page)
+		}
+	}
+
+	getUIPage(t, env.server.URL+"/ui/repositories/foo/bar/manifests/unknown", http.StatusNotFound)
+
+	// A form post from another site must not delete the manifest.
+	req, err := http.NewRequest("POST", manifestURL, nil)
+	checkErr(t, err, "building delete request")
+	req.Header.Set("Origin", "http://attacker.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "deleting manifest cross-origin")
+	checkResponse(t, "deleting manifest cross-origin", resp, http.StatusForbidden)
+
+	// A post whose origin cannot be checked must not either.
+	req, err = http.NewRequest("POST", manifestURL, nil)
+	checkErr(t, err, "building delete request")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "deleting manifest without origin")
+	checkResponse(t, "deleting manifest without origin", resp, http.StatusForbidden)
+
+	req, err = http.NewRequest("POST", manifestURL, nil)
+	checkErr(t, err, "building delete request")
+	req.Header.Set("Origin", env.server.URL)
+	resp, err = http.DefaultTransport.RoundTrip(req)
+	checkErr(t, err, "deleting manifest")
+	checkResponse(t, "deleting manifest", resp, http.StatusSeeOther)
+
+	if location := resp.Header.Get("Location"); location != "/ui/repositories/foo/bar/tags" {
+		t.Fatalf("unexpected redirect after delete: %q", location)
+	}
+
+	getUIPage(t, manifestURL, http.StatusNotFound)
+
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	apiURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err = http.Get(apiURL)
+	checkErr(t, err, "fetching deleted manifest")
+	checkResponse(t, "fetching deleted manifest", resp, http.StatusNotFound)
+}
+
+// TestWebUIReadOnly checks that deletion is neither offered nor possible
+// while the registry is read-only.
+func TestWebUIReadOnly(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.UI.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+
+	createRepository(env, t, "foo/bar", "latest")
+	env.app.setReadOnly(true)
+
+	manifestURL := env.server.URL + "/ui/repositories/foo/bar/manifests/latest"
+	if page := getUIPage(t, manifestURL, http.StatusOK); strings.Contains(page, "Delete manifest") {
+		t.Fatalf("read-only manifest page offers deletion:\n%s", page)
+	}
+
+	resp, err := http.Post(manifestURL, "", nil)
+	checkErr(t, err, "deleting manifest")
+	checkResponse(t, "deleting manifest", resp, http.StatusMethodNotAllowed)
+}
+
+// TestWebUIDisabled checks that the web UI is not served by default.
+func TestWebUIDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	resp, err := http.Get(env.server.URL + "/ui/")
+	checkErr(t, err, "fetching index page")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status fetching index page: %v != %v", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func getUIPage(t *testing.T, u string, status int) string {
+	resp, err := http.Get(u)
+	checkErr(t, err, "fetching "+u)
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching "+u, resp, status)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected content type for %s: %q", u, ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading "+u)
+	return string(body)
+}
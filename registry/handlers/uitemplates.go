@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"html/template"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+)
+
+// uiLayout holds the fields common to all pages of the web UI.
+type uiLayout struct {
+	Title string
+	Home  string
+}
+
+// uiLink is a link to another page of the web UI.
+type uiLink struct {
+	Text string
+	URL  string
+}
+
+type uiIndexPage struct {
+	uiLayout
+	Repositories []uiLink
+
+	// Next links to the following page of the catalog, if any.
+	Next string
+}
+
+type uiRepositoryPage struct {
+	uiLayout
+	Name string
+	Tags []uiLink
+}
+
+// uiReference is content referenced by a manifest. URL is set if the content
+// is a manifest which can be browsed.
+type uiReference struct {
+	distribution.Descriptor
+	URL string
+}
+
+type uiManifestPage struct {
+	uiLayout
+	Repository uiLink
+	Reference  string
+	Digest     digest.Digest
+	MediaType  string
+	Size       int
+	Config     *distribution.Descriptor
+	References []uiReference
+	Content    string
+	CanDelete  bool
+}
+
+type uiErrorPage struct {
+	uiLayout
+	Status  int
+	Message string
+}
+
+var uiTemplates = template.Must(template.New("ui").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - Docker Registry</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+a { color: #0366d6; text-decoration: none; }
+a:hover { text-decoration: underline; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+code, pre { font-family: monospace; font-size: .9em; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+.empty { color: #888; }
+button.delete { color: #fff; background: #cb2431; border: 0; padding: .4em 1em; cursor: pointer; }
+</style>
+</head>
+<body>
+<p><a href="{{.Home}}">Repositories</a></p>
+<h1>{{.Title}}</h1>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" .}}
+{{if .Repositories}}<ul>
+{{range .Repositories}}<li><a href="{{.URL}}">{{.Text}}</a></li>
+{{end}}</ul>
+{{else}}<p class="empty">No repositories.</p>
+{{end}}{{if .Next}}<p><a href="{{.Next}}">Next page</a></p>
+{{end}}{{template "footer" .}}{{end}}
+
+{{define "repository"}}{{template "header" .}}
+<h2>Tags</h2>
+{{if .Tags}}<ul>
+{{range .Tags}}<li><a href="{{.URL}}">{{.Text}}</a></li>
+{{end}}</ul>
+{{else}}<p class="empty">No tags.</p>
+{{end}}{{template "footer" .}}{{end}}
+
+{{define "manifest"}}{{template "header" .}}
+<table>
+<tr><th>Repository</th><td><a href="{{.Repository.URL}}">{{.Repository.Text}}</a></td></tr>
+<tr><th>Digest</th><td><code>{{.Digest}}</code></td></tr>
+<tr><th>Media type</th><td><code>{{.MediaType}}</code></td></tr>
+<tr><th>Size</th><td>{{.Size}} bytes</td></tr>
+{{with .Config}}<tr><th>Config</th><td><code>{{.Digest}}</code> ({{.Size}} bytes)</td></tr>
+{{end}}</table>
+<h2>References</h2>
+{{if .References}}<table>
+<tr><th>Digest</th><th>Media type</th><th>Size</th></tr>
+{{range .References}}<tr>
+<td>{{if .URL}}<a href="{{.URL}}"><code>{{.Digest}}</code></a>{{else}}<code>{{.Digest}}</code>{{end}}</td>
+<td><code>{{.MediaType}}</code></td>
+<td>{{.Size}}</td>
+</tr>
+{{end}}</table>
+{{else}}<p class="empty">No references.</p>
+{{end}}
+<h2>Content</h2>
+<pre>{{.Content}}</pre>
+{{if .CanDelete}}<form method="post" onsubmit="return confirm('Delete {{.Digest}} and all tags referring to it?');">
+<button class="delete" type="submit">Delete manifest</button>
+</form>
+{{end}}{{template "footer" .}}{{end}}
+
+{{define "error"}}{{template "header" .}}
+<p>{{.Message}}</p>
+{{template "footer" .}}{{end}}
+`))
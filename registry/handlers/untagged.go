@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+)
+
+const (
+	// defaultUntaggedManifestAge is how long a manifest must have had no tag
+	// to be deleted by the untaggedmanifests maintenance job, if not
+	// configured.
+	defaultUntaggedManifestAge = 30 * 24 * time.Hour
+
+	// defaultUntaggedManifestInterval is the interval between runs of the
+	// untaggedmanifests maintenance job, if not configured.
+	defaultUntaggedManifestInterval = 24 * time.Hour
+
+	// untaggedManifestPageSize is the number of repositories listed at once
+	// by the untaggedmanifests maintenance job.
+	untaggedManifestPageSize = 100
+)
+
+// deleteUntaggedManifests deletes the manifests of every repository which
+// have had no tag for longer than opts.Age, and notifies their deletion. It
+// returns the number of manifests deleted, or which would be deleted on a
+// dry run.
+func (app *App) deleteUntaggedManifests(ctx ctxu.Context, opts storage.UntaggedManifestOpts) (int, error) {
+	if app.isReadOnly() || app.isCache {
+		return 0, nil
+	}
+
+	pins, err := storage.Pins(ctx, app.driver)
+	if err != nil {
+		return 0, err
+	}
+	opts.Pins = append(pins, app.gcPins...)
+
+	bridge := app.maintenanceBridge()
+	count := 0
+	last := ""
+	for {
+		names, done, err := listRepositories(ctx, app.registry, untaggedManifestPageSize, last, func(string) bool { return true })
+		if err != nil {
+			return count, err
+		}
+
+		for _, name := range names {
+			named, err := reference.ParseNamed(name)
+			if err != nil {
+				return count, err
+			}
+			repository, err := app.registry.Repository(ctx, named)
+			if err != nil {
+				return count, err
+			}
+
+			deleted, err := storage.DeleteUntaggedManifests(ctx, app.driverFor(name), repository, opts)
+			count += len(deleted)
+			for _, m := range deleted {
+				if opts.DryRun {
+					ctxu.GetLogger(ctx).Infof("untagged manifests: would delete %s@%s, untagged since %s", name, m.Digest, m.Untagged)
+					continue
+				}
+				ctxu.GetLogger(ctx).Infof("untagged manifests: deleted %s@%s, untagged since %s", name, m.Digest, m.Untagged)
+				if err := bridge.ManifestDeleted(named, m.Manifest); err != nil {
+					ctxu.GetLogger(ctx).Errorf("untagged manifests: error dispatching manifest delete to listener: %v", err)
+				}
+			}
+			if err != nil {
+				return count, fmt.Errorf("failed to delete untagged manifests of %s: %v", name, err)
+			}
+		}
+
+		if done || len(names) == 0 {
+			return count, nil
+		}
+		last = names[len(names)-1]
+	}
+}
+
+// maintenanceBridge returns a listener notifying the events of maintenance
+// jobs, which are not initiated by any request.
+func (app *App) maintenanceBridge() notifications.Listener {
+	ub := v2.NewURLBuilder(app.withPrefix(&url.URL{Scheme: "http", Host: app.Config.HTTP.Addr}))
+	if app.httpHost.Scheme != "" && app.httpHost.Host != "" {
+		ub = v2.NewURLBuilder(&app.httpHost)
+	}
+	return notifications.NewBridge(ub, app.events.source, notifications.ActorRecord{}, notifications.RequestRecord{}, app.events.sink)
+}
+
+// startUntaggedManifestCleaner schedules a goroutine which periodically
+// deletes manifests left untagged, as configured by the untaggedmanifests
+// maintenance section.
+func startUntaggedManifestCleaner(app *App, config map[interface{}]interface{}) {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return
+	}
+	if !app.deleteEnabled {
+		panic("untaggedmanifests requires deletion to be enabled in the storage configuration")
+	}
+
+	opts := storage.UntaggedManifestOpts{Age: defaultUntaggedManifestAge}
+	if v, ok := config["age"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("untaggedmanifests's age config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("untaggedmanifests's age config key is not a valid duration: %q", s))
+		}
+		opts.Age = d
+	}
+
+	interval := defaultUntaggedManifestInterval
+	if v, ok := config["interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("untaggedmanifests's interval config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("untaggedmanifests's interval config key is not a valid duration: %q", s))
+		}
+		interval = d
+	}
+
+	if v, ok := config["dryrun"]; ok {
+		dryRun, ok := v.(bool)
+		if !ok {
+			panic("untaggedmanifests's dryrun config key must have a boolean value")
+		}
+		opts.DryRun = dryRun
+	}
+
+	leading := app.maintenanceJob("untaggedmanifests")
+	go func() {
+		for {
+			ctxu.GetLogger(app).Infof("Starting untagged manifest cleanup in %s", interval)
+			time.Sleep(interval)
+
+			if !leading() {
+				continue
+			}
+
+			count, err := app.deleteUntaggedManifests(app, opts)
+			if err != nil {
+				ctxu.GetLogger(app).Errorf("untagged manifests: %v", err)
+			}
+			ctxu.GetLogger(app).Infof("untagged manifests: %d manifests untagged for more than %s", count, opts.Age)
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+)
+
+// TestDeleteUntaggedManifests checks that a manifest whose tag was moved is
+// deleted by the untagged manifest cleanup, and that its deletion is notified.
+func TestDeleteUntaggedManifests(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	previous := createRepository(env, t, "foo/bar", "latest")
+	current := createRepository(env, t, "foo/bar", "latest")
+	start := time.Now()
+
+	count, err := env.app.deleteUntaggedManifests(env.ctx, storage.UntaggedManifestOpts{Age: time.Hour})
+	if err != nil || count != 0 {
+		t.Fatalf("unexpected untagged manifests deleted: %d, %v", count, err)
+	}
+
+	count, err = env.app.deleteUntaggedManifests(env.ctx, storage.UntaggedManifestOpts{DryRun: true})
+	if err != nil || count != 1 {
+		t.Fatalf("unexpected untagged manifests to delete: %d, %v", count, err)
+	}
+
+	count, err = env.app.deleteUntaggedManifests(env.ctx, storage.UntaggedManifestOpts{})
+	if err != nil || count != 1 {
+		t.Fatalf("unexpected untagged manifests deleted: %d, %v", count, err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	for _, expected := range []struct {
+		dgst   digest.Digest
+		status int
+	}{
+		{previous, http.StatusNotFound},
+		{current, http.StatusOK},
+	} {
+		ref, _ := reference.WithDigest(named, expected.dgst)
+		u, err := env.builder.BuildManifestURL(ref)
+		checkErr(t, err, "building manifest url")
+
+		resp, err := http.Get(u)
+		checkErr(t, err, "fetching manifest")
+		checkResponse(t, "fetching manifest", resp, expected.status)
+	}
+
+	var deletes []notifications.Event
+	for _, event := range env.app.events.history.Since(start) {
+		if event.Action == notifications.EventActionDelete {
+			deletes = append(deletes, event)
+		}
+	}
+	if len(deletes) != 1 || deletes[0].Target.Digest != previous || deletes[0].Target.Repository != "foo/bar" {
+		t.Fatalf("unexpected delete events: %+v", deletes)
+	}
+}
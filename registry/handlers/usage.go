@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/gorilla/handlers"
+)
+
+// defaultUsageReportInterval is the interval between storage usage reports
+// computed by the usagereport maintenance job, if not configured.
+const defaultUsageReportInterval = 24 * time.Hour
+
+// usageMetrics holds the totals of the last storage usage report computed or
+// served by this instance. This is kept globally and made available via
+// expvar.
+var usageMetrics struct {
+	sync.Mutex
+	Blobs        int
+	Bytes        int64
+	SharedBytes  int64
+	Repositories int
+	Computed     time.Time
+}
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("usage", expvar.Func(func() interface{} {
+		usageMetrics.Lock()
+		defer usageMetrics.Unlock()
+		return map[string]interface{}{
+			"Blobs":        usageMetrics.Blobs,
+			"Bytes":        usageMetrics.Bytes,
+			"SharedBytes":  usageMetrics.SharedBytes,
+			"Repositories": usageMetrics.Repositories,
+			"Computed":     usageMetrics.Computed,
+		}
+	}))
+}
+
+// updateUsageMetrics publishes the totals of the report, unless a more
+// recent report was published.
+func updateUsageMetrics(report storage.UsageReport) {
+	usageMetrics.Lock()
+	defer usageMetrics.Unlock()
+
+	if report.Computed.Before(usageMetrics.Computed) {
+		return
+	}
+	usageMetrics.Blobs = report.Blobs
+	usageMetrics.Bytes = report.Bytes
+	usageMetrics.SharedBytes = report.SharedBytes
+	usageMetrics.Repositories = len(report.Repositories)
+	usageMetrics.Computed = report.Computed
+}
+
+// computeUsageReport computes and stores a storage usage report.
+func (app *App) computeUsageReport(ctx ctxu.Context, opts storage.UsageOpts) (storage.UsageReport, error) {
+	report, err := storage.ComputeUsage(ctx, app.driver, app.storageRegistry, opts)
+	if err != nil {
+		return report, err
+	}
+
+	if err := storage.SaveUsageReport(ctx, app.driver, report); err != nil {
+		return report, fmt.Errorf("failed to save usage report: %v", err)
+	}
+	updateUsageMetrics(report)
+
+	ctxu.GetLogger(ctx).Infof("usage: %d repositories reference %d blobs of %d bytes, %d bytes shared, computed in %s", len(report.Repositories), report.Blobs, report.Bytes, report.SharedBytes, report.Duration)
+	return report, nil
+}
+
+// startUsageReporter schedules a goroutine which periodically computes a
+// storage usage report, as configured by the usagereport maintenance section.
+func startUsageReporter(app *App, config map[interface{}]interface{}) {
+	if enabled, ok := config["enabled"]; !ok || enabled != true {
+		return
+	}
+
+	interval := defaultUsageReportInterval
+	if v, ok := config["interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			panic("usagereport's interval config key must be a string")
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("usagereport's interval config key is not a valid duration: %q", s))
+		}
+		interval = d
+	}
+
+	var opts storage.UsageOpts
+	if v, ok := config["workers"]; ok {
+		workers, ok := v.(int)
+		if !ok || workers < 1 {
+			panic("usagereport's workers config key must be a positive integer")
+		}
+		opts.Workers = workers
+	}
+
+	leading := app.maintenanceJob("usagereport")
+	go func() {
+		for {
+			ctxu.GetLogger(app).Infof("Starting usage report in %s", interval)
+			time.Sleep(interval)
+
+			if !leading() {
+				continue
+			}
+			if _, err := app.computeUsageReport(app, opts); err != nil {
+				ctxu.GetLogger(app).Errorf("usage: %v", err)
+			}
+		}
+	}()
+}
+
+// adminUsageDispatcher serves the last storage usage report, or computes a
+// new one.
+func adminUsageDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(ah.GetUsage),
+		"POST": http.HandlerFunc(ah.ComputeUsage),
+	}
+}
+
+// GetUsage returns the last storage usage report, computed by any registry
+// instance sharing the storage.
+func (ah *adminHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	report, err := storage.LoadUsageReport(ah, ah.driver)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeUsageUnknown)
+		} else {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	updateUsageMetrics(report)
+
+	ah.serveUsageReport(w, report)
+}
+
+// ComputeUsage computes a storage usage report and returns it. The number of
+// workers and the rate limit are set with query parameters, as for garbage
+// collection.
+func (ah *adminHandler) ComputeUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var opts storage.UsageOpts
+
+	if workers := q.Get("workers"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil || n < 1 {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid number of workers %q", workers)))
+			return
+		}
+		opts.Workers = n
+	}
+
+	if rateLimit := q.Get("ratelimit"); rateLimit != "" {
+		rate, err := strconv.ParseFloat(rateLimit, 64)
+		if err != nil || rate < 0 {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(fmt.Sprintf("invalid rate limit %q", rateLimit)))
+			return
+		}
+		opts.RateLimit = rate
+	}
+
+	report, err := ah.App.computeUsageReport(ah, opts)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ah.serveUsageReport(w, report)
+}
+
+func (ah *adminHandler) serveUsageReport(w http.ResponseWriter, report storage.UsageReport) {
+	response := admin.UsageReport{
+		Computed:     report.Computed,
+		Duration:     report.Duration,
+		Blobs:        report.Blobs,
+		Bytes:        report.Bytes,
+		SharedBytes:  report.SharedBytes,
+		Repositories: make([]admin.RepositoryUsage, 0, len(report.Repositories)),
+	}
+	for _, usage := range report.Repositories {
+		response.Repositories = append(response.Repositories, admin.RepositoryUsage{
+			Name:        usage.Name,
+			Blobs:       usage.Blobs,
+			Bytes:       usage.Bytes,
+			UniqueBytes: usage.UniqueBytes,
+			SharedBytes: usage.SharedBytes,
+		})
+	}
+
+	ah.serveJSON(w, response)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/gorilla/handlers"
+)
+
+func adminUsersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(ah.GetUsers),
+	}
+}
+
+func adminUserDispatcher(ctx *Context, r *http.Request) http.Handler {
+	ah := &adminHandler{Context: ctx}
+
+	return handlers.MethodHandler{
+		"PUT":    http.HandlerFunc(ah.PutUser),
+		"DELETE": http.HandlerFunc(ah.DeleteUser),
+	}
+}
+
+// requireUserManager returns the user manager of the registry, reporting an error
+// if its access controller does not support managing users.
+func (ah *adminHandler) requireUserManager() (auth.UserManager, bool) {
+	if ah.userManager == nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnsupported.WithDetail("the access controller of the registry does not support managing users"))
+		return nil, false
+	}
+	return ah.userManager, true
+}
+
+// GetUsers lists the users of the registry.
+func (ah *adminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	um, ok := ah.requireUserManager()
+	if !ok {
+		return
+	}
+
+	users, err := um.Users(ah)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ah.serveJSON(w, admin.UserList{Users: users})
+}
+
+// PutUser creates a user, or changes the password of an existing one.
+func (ah *adminHandler) PutUser(w http.ResponseWriter, r *http.Request) {
+	um, ok := ah.requireUserManager()
+	if !ok {
+		return
+	}
+
+	var body admin.UserPassword
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail(err))
+		return
+	}
+	if body.Password == "" {
+		ah.Errors = append(ah.Errors, admin.ErrorCodeRequestInvalid.WithDetail("password must not be empty"))
+		return
+	}
+
+	username := ctxu.GetStringValue(ah, "vars.username")
+	if err := um.SetPassword(ah, username, body.Password); err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: set password of user %s", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser removes a user.
+func (ah *adminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	um, ok := ah.requireUserManager()
+	if !ok {
+		return
+	}
+
+	username := ctxu.GetStringValue(ah, "vars.username")
+	if err := um.RemoveUser(ah, username); err != nil {
+		if err == auth.ErrUserUnknown {
+			ah.Errors = append(ah.Errors, admin.ErrorCodeUserUnknown.WithDetail(map[string]string{"username": username}))
+		} else {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	ctxu.GetLogger(ah).Infof("admin: removed user %s", username)
+	w.WriteHeader(http.StatusAccepted)
+}
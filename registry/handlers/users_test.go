@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/api/admin"
+	"github.com/docker/distribution/registry/api/errcode"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestAdminUsers checks that the users of a writable htpasswd file are
+// managed through the admin API.
+func TestAdminUsers(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	f, err := ioutil.TempFile("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("admin:" + string(hash) + "\n")
+	f.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Auth: configuration.Auth{
+			"htpasswd": configuration.Parameters{
+				"realm":      "test-realm",
+				"path":       f.Name(),
+				"writable":   true,
+				"bcryptcost": bcrypt.MinCost,
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+
+	do := func(method, u, username, password string, body interface{}) *http.Response {
+		var p []byte
+		if body != nil {
+			p, _ = json.Marshal(body)
+		}
+		req, err := http.NewRequest(method, u, bytes.NewReader(p))
+		checkErr(t, err, "building request")
+		req.SetBasicAuth(username, password)
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "sending request")
+		return resp
+	}
+
+	userURL, err := ub.BuildUserURL("frodo")
+	checkErr(t, err, "building user url")
+	resp := do("PUT", userURL, "admin", "secret", admin.UserPassword{Password: "baggins"})
+	resp.Body.Close()
+	checkResponse(t, "adding user", resp, http.StatusNoContent)
+
+	// The added user is authenticated without restarting the registry.
+	usersURL, err := ub.BuildUsersURL()
+	checkErr(t, err, "building users url")
+	resp = do("GET", usersURL, "frodo", "baggins", nil)
+	checkResponse(t, "listing users", resp, http.StatusOK)
+
+	var list admin.UserList
+	decodeAdminResponse(t, resp, &list)
+	if !reflect.DeepEqual(list.Users, []string{"admin", "frodo"}) {
+		t.Fatalf("unexpected users: %v", list.Users)
+	}
+
+	resp = do("DELETE", userURL, "admin", "secret", nil)
+	resp.Body.Close()
+	checkResponse(t, "removing user", resp, http.StatusAccepted)
+
+	resp = do("DELETE", userURL, "admin", "secret", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "removing unknown user", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "removing unknown user", resp, admin.ErrorCodeUserUnknown)
+
+	resp = do("GET", usersURL, "frodo", "baggins", nil)
+	resp.Body.Close()
+	checkResponse(t, "listing users as removed user", resp, http.StatusUnauthorized)
+}
+
+// TestAdminUsersUnsupported checks that managing users fails with access
+// controllers which do not support it.
+func TestAdminUsersUnsupported(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Admin.Enabled = true
+	config.HTTP.Admin.Insecure = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.server.Close()
+
+	ub, err := admin.NewURLBuilderFromString(env.server.URL)
+	checkErr(t, err, "creating admin url builder")
+	usersURL, err := ub.BuildUsersURL()
+	checkErr(t, err, "building users url")
+
+	resp, err := http.Get(usersURL)
+	checkErr(t, err, "listing users")
+	defer resp.Body.Close()
+	checkResponse(t, "listing users", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "listing users", resp, errcode.ErrorCodeUnsupported)
+}
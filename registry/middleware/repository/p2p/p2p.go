@@ -0,0 +1,400 @@
+// Package p2p provides a repository middleware integrating the registry with
+// a peer-to-peer distributor, such as a Dragonfly or Kraken tracker. Blobs are
+// announced to the distributor as they become available, and clients which
+// opt in are redirected to a peer for blob pulls, offloading the registry
+// when many nodes pull the same image at once.
+package p2p
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	repositorymiddleware "github.com/docker/distribution/registry/middleware/repository"
+)
+
+const (
+	// defaultHeader is the request header with which clients opt in to
+	// being redirected to the distributor.
+	defaultHeader = "Docker-Distribution-P2P"
+
+	defaultTimeout = 5 * time.Second
+
+	// maxAnnounced is the number of announced blobs remembered, which are
+	// not announced again when redirecting pulls of them. The least recently
+	// used blobs are forgotten first.
+	maxAnnounced = 10000
+)
+
+// Announcement is the body posted to the announce url of the distributor
+// when a blob becomes available.
+type Announcement struct {
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	Size       int64         `json:"size"`
+	MediaType  string        `json:"mediaType,omitempty"`
+
+	// URL is the url of the blob on the registry, from which the
+	// distributor seeds the content.
+	URL string `json:"url"`
+}
+
+// redirect is the data the redirect url template is executed with.
+type redirect struct {
+	Repository string
+	Digest     digest.Digest
+	URL        string
+}
+
+// options configures the middleware. The options are parsed for each request
+// wrapping a repository, and cached by their source.
+type options struct {
+	announceURL string
+	redirectURL *template.Template
+	header      string
+	client      *http.Client
+}
+
+var (
+	optionsMu sync.Mutex
+	parsed    = make(map[string]*options)
+	announced = newAnnouncedSet(maxAnnounced)
+)
+
+func init() {
+	repositorymiddleware.Register("p2p", repositorymiddleware.InitFunc(newRepository))
+}
+
+// newRepository wraps repository with the p2p middleware.
+// Options: announceurl, redirecturl, header, timeout. At least one of
+// announceurl and redirecturl is required.
+func newRepository(ctx context.Context, repository distribution.Repository, opts map[string]interface{}) (distribution.Repository, error) {
+	o, err := parseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p2pRepository{Repository: repository, options: o}, nil
+}
+
+func parseOptions(opts map[string]interface{}) (*options, error) {
+	key := fmt.Sprint(opts)
+
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+
+	if o, ok := parsed[key]; ok {
+		return o, nil
+	}
+
+	o := &options{header: defaultHeader}
+	timeout := defaultTimeout
+
+	if v, ok := opts["announceurl"]; ok {
+		if o.announceURL, ok = v.(string); !ok {
+			return nil, fmt.Errorf("announceurl must be a string")
+		}
+	}
+
+	if v, ok := opts["redirecturl"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("redirecturl must be a string")
+		}
+		t, err := template.New("redirecturl").Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirecturl: %v", err)
+		}
+		o.redirectURL = t
+	}
+
+	if o.announceURL == "" && o.redirectURL == nil {
+		return nil, fmt.Errorf("No announceurl or redirecturl provided")
+	}
+
+	if v, ok := opts["header"]; ok {
+		if o.header, ok = v.(string); !ok || o.header == "" {
+			return nil, fmt.Errorf("header must be a non-empty string")
+		}
+	}
+
+	if v, ok := opts["timeout"]; ok {
+		switch v := v.(type) {
+		case time.Duration:
+			timeout = v
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout: %v", err)
+			}
+			timeout = d
+		default:
+			return nil, fmt.Errorf("timeout must be a duration")
+		}
+	}
+
+	o.client = &http.Client{Timeout: timeout}
+
+	parsed[key] = o
+	return o, nil
+}
+
+type p2pRepository struct {
+	distribution.Repository
+	options *options
+}
+
+func (r *p2pRepository) Blobs(ctx context.Context) distribution.BlobStore {
+	return &p2pBlobStore{
+		BlobStore: r.Repository.Blobs(ctx),
+		name:      r.Named(),
+		options:   r.options,
+	}
+}
+
+type p2pBlobStore struct {
+	distribution.BlobStore
+	name    reference.Named
+	options *options
+}
+
+// ServeBlob redirects the clients which opted in to the distributor, and
+// serves the others from the registry.
+func (bs *p2pBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	if bs.options.redirectURL == nil || r.Method != "GET" || !optedIn(r.Header.Get(bs.options.header)) {
+		return bs.BlobStore.ServeBlob(ctx, w, r, dgst)
+	}
+
+	desc, err := bs.Stat(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	origin, err := originURL(r, bs.name, dgst)
+	if err != nil {
+		return err
+	}
+
+	// Blobs which became available before the middleware was enabled, or
+	// were cached by a pull through cache, are announced along with the
+	// first redirect. The distributor fetches from the registry until it is
+	// seeded, so the pull does not wait for the announcement.
+	if !announced.contains(announcedKey(bs.name, dgst)) {
+		bs.announce(ctx, origin, desc)
+	}
+
+	var location bytes.Buffer
+	if err := bs.options.redirectURL.Execute(&location, redirect{
+		Repository: bs.name.Name(),
+		Digest:     dgst,
+		URL:        origin,
+	}); err != nil {
+		return err
+	}
+
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	http.Redirect(w, r, location.String(), http.StatusTemporaryRedirect)
+	return nil
+}
+
+func (bs *p2pBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	bw, err := bs.BlobStore.Create(ctx, options...)
+	if ebm, ok := err.(distribution.ErrBlobMounted); ok {
+		bs.announceFromRequest(ctx, ebm.Descriptor)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p2pBlobWriter{BlobWriter: bw, bs: bs}, nil
+}
+
+func (bs *p2pBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
+	bw, err := bs.BlobStore.Resume(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &p2pBlobWriter{BlobWriter: bw, bs: bs}, nil
+}
+
+// announceFromRequest announces a blob in the background, with its url on
+// the registry derived from the request of ctx.
+func (bs *p2pBlobStore) announceFromRequest(ctx context.Context, desc distribution.Descriptor) {
+	if bs.options.announceURL == "" {
+		return
+	}
+
+	r, err := context.GetRequest(ctx)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("p2p: cannot announce %s without a request: %v", desc.Digest, err)
+		return
+	}
+
+	origin, err := originURL(r, bs.name, desc.Digest)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("p2p: error building url of %s: %v", desc.Digest, err)
+		return
+	}
+
+	bs.announce(ctx, origin, desc)
+}
+
+// announce posts an announcement of the blob to the distributor in the
+// background. Failures are logged: clients are still served by the registry,
+// or by the distributor fetching from the registry.
+func (bs *p2pBlobStore) announce(ctx context.Context, origin string, desc distribution.Descriptor) {
+	if bs.options.announceURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(Announcement{
+		Repository: bs.name.Name(),
+		Digest:     desc.Digest,
+		Size:       desc.Size,
+		MediaType:  desc.MediaType,
+		URL:        origin,
+	})
+	if err != nil {
+		context.GetLogger(ctx).Errorf("p2p: error encoding announcement of %s: %v", desc.Digest, err)
+		return
+	}
+
+	logger := context.GetLogger(ctx)
+	// The blob is marked announced while the announcement is in flight,
+	// so that pulls arriving meanwhile do not announce it again.
+	key := announcedKey(bs.name, desc.Digest)
+	announced.add(key)
+	go func() {
+		if err := bs.post(body); err != nil {
+			logger.Errorf("p2p: error announcing %s to %s: %v", desc.Digest, bs.options.announceURL, err)
+			announced.remove(key)
+		}
+	}()
+}
+
+func (bs *p2pBlobStore) post(body []byte) error {
+	req, err := http.NewRequest("POST", bs.options.announceURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := bs.options.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+type p2pBlobWriter struct {
+	distribution.BlobWriter
+	bs *p2pBlobStore
+}
+
+// Commit announces the blob once it is available in the registry.
+func (bw *p2pBlobWriter) Commit(ctx context.Context, provisional distribution.Descriptor) (distribution.Descriptor, error) {
+	desc, err := bw.BlobWriter.Commit(ctx, provisional)
+	if err != nil {
+		return desc, err
+	}
+
+	bw.bs.announceFromRequest(ctx, desc)
+	return desc, nil
+}
+
+// optedIn returns true if the value of the opt-in header enables redirects.
+func optedIn(value string) bool {
+	enabled, err := strconv.ParseBool(value)
+	return err == nil && enabled
+}
+
+// originURL returns the absolute url of the blob on the registry serving r.
+func originURL(r *http.Request, name reference.Named, dgst digest.Digest) (string, error) {
+	ref, err := reference.WithDigest(name, dgst)
+	if err != nil {
+		return "", err
+	}
+	return v2.NewURLBuilderFromRequest(r).BuildBlobURL(ref)
+}
+
+func announcedKey(name reference.Named, dgst digest.Digest) string {
+	return name.Name() + "@" + dgst.String()
+}
+
+// announcedSet remembers up to size announced blobs, forgetting the least
+// recently used ones first. Forgotten blobs are only announced again.
+type announcedSet struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newAnnouncedSet(size int) *announcedSet {
+	return &announcedSet{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (s *announcedSet) contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok {
+		s.order.MoveToFront(e)
+	}
+	return ok
+}
+
+func (s *announcedSet) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.order.MoveToFront(e)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(key)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(string))
+	}
+}
+
+func (s *announcedSet) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.order.Remove(e)
+		delete(s.entries, key)
+	}
+}
+
+func (s *announcedSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
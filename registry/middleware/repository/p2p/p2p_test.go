@@ -0,0 +1,155 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestP2P(t *testing.T) {
+	announced = newAnnouncedSet(maxAnnounced)
+
+	announcements := make(chan Announcement, 10)
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Announcement
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("error decoding announcement: %v", err)
+		}
+		announcements <- a
+	}))
+	defer tracker.Close()
+
+	ctx := context.Background()
+	reg, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _ := reference.ParseNamed("foo/bar")
+	repo, err := reg.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = newRepository(ctx, repo, map[string]interface{}{
+		"announceurl": tracker.URL,
+		"redirecturl": "http://peer.example.com/blobs/{{.Digest}}?origin={{urlquery .URL}}",
+		"timeout":     "1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push a blob, which is announced once committed.
+	r, _ := http.NewRequest("PUT", "http://registry.example.com/v2/foo/bar/blobs/uploads/", nil)
+	pushCtx := context.WithRequest(ctx, r)
+	blobs := repo.Blobs(pushCtx)
+	desc, err := blobs.Put(pushCtx, "application/octet-stream", []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw, err := blobs.Create(pushCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("another layer")
+	if _, err := bw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := bw.Commit(pushCtx, distribution.Descriptor{Digest: digest.FromBytes(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case a := <-announcements:
+		if a.Repository != "foo/bar" || a.Digest != committed.Digest || a.Size != int64(len(content)) {
+			t.Fatalf("unexpected announcement: %#v", a)
+		}
+		if expected := "http://registry.example.com/v2/foo/bar/blobs/" + committed.Digest.String(); a.URL != expected {
+			t.Fatalf("expected origin %s, got %s", expected, a.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blob was not announced")
+	}
+
+	// Clients which do not opt in are served by the registry.
+	r, _ = http.NewRequest("GET", "http://registry.example.com/v2/foo/bar/blobs/"+committed.Digest.String(), nil)
+	w := httptest.NewRecorder()
+	if err := blobs.ServeBlob(ctx, w, r, committed.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.Bytes())
+	}
+
+	// Clients which opt in are redirected to the distributor.
+	r.Header.Set(defaultHeader, "true")
+	w = httptest.NewRecorder()
+	if err := blobs.ServeBlob(ctx, w, r, committed.Digest); err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://peer.example.com/blobs/" + committed.Digest.String() + "?origin=" + url.QueryEscape("http://registry.example.com/v2/foo/bar/blobs/"+committed.Digest.String())
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != expected {
+		t.Fatalf("unexpected redirect: %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// A blob available before, here the one put directly, is announced
+	// along with the first redirect to it.
+	w = httptest.NewRecorder()
+	if err := blobs.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("unexpected response: %d", w.Code)
+	}
+	select {
+	case a := <-announcements:
+		if a.Digest != desc.Digest {
+			t.Fatalf("unexpected announcement: %#v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blob was not announced")
+	}
+
+	if _, err := newRepository(ctx, repo, map[string]interface{}{}); err == nil {
+		t.Fatalf("expected an error without announceurl or redirecturl")
+	}
+}
+
+// TestAnnouncedSet checks that the announced blobs are bounded, forgetting
+// the least recently used first.
+func TestAnnouncedSet(t *testing.T) {
+	s := newAnnouncedSet(2)
+	s.add("a")
+	s.add("b")
+	if !s.contains("a") {
+		t.Fatalf("expected a to be remembered")
+	}
+
+	s.add("c")
+	if s.len() != 2 {
+		t.Fatalf("expected 2 blobs remembered, got %d", s.len())
+	}
+	if s.contains("b") {
+		t.Fatalf("expected the least recently used blob to be forgotten")
+	}
+	if !s.contains("a") || !s.contains("c") {
+		t.Fatalf("expected a and c to be remembered")
+	}
+
+	s.remove("a")
+	if s.contains("a") || s.len() != 1 {
+		t.Fatalf("expected a to be forgotten")
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+)
+
+// blobFetch is a fetch of a blob from the remote, shared by the requests for
+// the blob made while it is in progress, so that the blob is downloaded once
+// however many clients pull it at the same time. The content is spooled to a
+// temporary file, which each reader follows at its own pace.
+type blobFetch struct {
+	desc distribution.Descriptor
+	file *os.File
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written int64
+	done    bool
+	err     error
+
+	// refs counts the readers of the fetch. The spool is removed once
+	// there are none left and the fetch is no longer inflight.
+	refs     int
+	detached bool
+
+	// stored is closed once storing the blob locally has completed or
+	// failed.
+	stored chan struct{}
+}
+
+// inflight tracks the blobs being fetched from the remote.
+var inflight = make(map[digest.Digest]*blobFetch)
+
+// mu protects inflight and the reference counts of fetches.
+var mu sync.Mutex
+
+// newBlobFetch returns a fetch of the blob described by desc, spooled to a
+// new temporary file.
+func newBlobFetch(desc distribution.Descriptor) (*blobFetch, error) {
+	file, err := ioutil.TempFile("", "registry-proxy-")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &blobFetch{
+		desc:   desc,
+		file:   file,
+		stored: make(chan struct{}),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f, nil
+}
+
+// Write appends p to the spool and wakes up the readers waiting for it. It is
+// only called by the goroutine fetching the blob.
+func (f *blobFetch) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	offset := f.written
+	f.mu.Unlock()
+
+	n, err := f.file.WriteAt(p, offset)
+
+	f.mu.Lock()
+	f.written += int64(n)
+	f.mu.Unlock()
+	f.cond.Broadcast()
+
+	return n, err
+}
+
+// finish marks the fetch as complete, failed if err is not nil.
+func (f *blobFetch) finish(err error) {
+	f.mu.Lock()
+	f.done = true
+	f.err = err
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// newReader returns a reader of the content of the blob from its start. The
+// reader blocks until the content it reads has been fetched, and fails if
+// the fetch does.
+func (f *blobFetch) newReader() io.Reader {
+	return &blobFetchReader{f: f}
+}
+
+type blobFetchReader struct {
+	f      *blobFetch
+	offset int64
+}
+
+func (r *blobFetchReader) Read(p []byte) (int, error) {
+	f := r.f
+
+	f.mu.Lock()
+	for r.offset >= f.written && !f.done {
+		f.cond.Wait()
+	}
+	available, err := f.written-r.offset, f.err
+	f.mu.Unlock()
+
+	if available <= 0 {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+	n, err := f.file.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// release drops a reference to the fetch.
+func (f *blobFetch) release() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f.refs--
+	f.cleanup()
+}
+
+// detach removes the fetch from inflight, so that later requests for the
+// blob are not served from it.
+func (f *blobFetch) detach(dgst digest.Digest) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if inflight[dgst] == f {
+		delete(inflight, dgst)
+	}
+	f.detached = true
+	f.cleanup()
+}
+
+// cleanup removes the spool once the fetch has no readers and cannot gain
+// any. It is called with mu held.
+func (f *blobFetch) cleanup() {
+	if f.refs > 0 || !f.detached || f.file == nil {
+		return
+	}
+
+	f.file.Close()
+	os.Remove(f.file.Name())
+	f.file = nil
+}
+
+// fetch downloads the blob from the remote into the spool of f, and stores it
+// in the local store at the same time. The fetch is detached once the blob
+// has been committed locally, so that requests for it arriving until then
+// still share the download.
+func (pbs *proxyBlobStore) fetch(ctx context.Context, f *blobFetch, dgst digest.Digest) {
+	go func() {
+		defer close(f.stored)
+		defer f.detach(dgst)
+		defer f.release()
+
+		pbs.store(ctx, f, dgst)
+	}()
+
+	remoteReader, err := pbs.remoteStore.Open(ctx, dgst)
+	if err == nil {
+		var n int64
+		n, err = io.CopyN(f, remoteReader, f.desc.Size)
+		remoteReader.Close()
+		if err == io.EOF {
+			err = fmt.Errorf("blob %s truncated by the remote after %d of %d bytes", dgst, n, f.desc.Size)
+		}
+	}
+	if err != nil {
+		context.GetLogger(ctx).Errorf("Error fetching blob %s from the remote: %v", dgst, err)
+		f.finish(err)
+		// Later requests fetch the blob again.
+		f.detach(dgst)
+		return
+	}
+
+	proxyMetrics.BlobPull(uint64(f.desc.Size))
+	f.finish(nil)
+}
+
+// store writes the blob being fetched to the local store, and schedules it
+// for expiry once committed.
+func (pbs *proxyBlobStore) store(ctx context.Context, f *blobFetch, dgst digest.Digest) {
+	r := f.newReader()
+
+	bw, err := pbs.localStore.Create(ctx)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("Error creating local blob writer: %s", err.Error())
+		// Keep the fetch inflight until it completes.
+		io.Copy(ioutil.Discard, r)
+		return
+	}
+
+	if _, err := io.Copy(bw, r); err != nil {
+		if cancelErr := bw.Cancel(ctx); cancelErr != nil {
+			context.GetLogger(ctx).Errorf("Error cancelling local blob writer: %s", cancelErr.Error())
+		}
+		return
+	}
+
+	if _, err := bw.Commit(ctx, f.desc); err != nil {
+		context.GetLogger(ctx).Errorf("Error committing to storage: %s", err.Error())
+		return
+	}
+
+	blobRef, err := reference.WithDigest(pbs.repositoryName, dgst)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("Error creating reference: %s", err)
+		return
+	}
+
+	pbs.scheduler.AddBlob(blobRef, repositoryTTL)
+}
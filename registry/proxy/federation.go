@@ -0,0 +1,398 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/transport"
+)
+
+// FederationHeader is set on the requests a registry makes to its siblings.
+// Requests carrying it are served from local content only, so that siblings
+// querying each other do not loop.
+const FederationHeader = "Docker-Distribution-Federated"
+
+// federatedRegistry serves the content of its embedded registry, falling
+// through to sibling registries for the manifests, tags and blobs not found
+// locally when pulled. Unlike a pull through cache, content found at a
+// sibling is not stored locally, and pushes are served by the embedded
+// registry.
+type federatedRegistry struct {
+	embedded distribution.Namespace
+	siblings []*sibling
+}
+
+// NewFederatedRegistry returns a registry serving the content of registry and
+// of the sibling registries configured, in order.
+func NewFederatedRegistry(ctx context.Context, registry distribution.Namespace, config configuration.Federation) (distribution.Namespace, error) {
+	fr := &federatedRegistry{embedded: registry}
+
+	for _, rc := range config.Registries {
+		u, err := url.Parse(rc.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url of federated registry %q: %v", rc.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid url of federated registry %q: scheme must be http or https", rc.URL)
+		}
+
+		fr.siblings = append(fr.siblings, &sibling{
+			url:              strings.TrimSuffix(rc.URL, "/"),
+			redirect:         rc.Redirect,
+			credentials:      siblingCredentials{username: rc.Username, password: rc.Password},
+			challengeManager: &syncChallengeManager{ChallengeManager: auth.NewSimpleChallengeManager()},
+		})
+	}
+
+	return fr, nil
+}
+
+func (fr *federatedRegistry) Scope() distribution.Scope {
+	return distribution.GlobalScope
+}
+
+func (fr *federatedRegistry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	return fr.embedded.Repositories(ctx, repos, last)
+}
+
+func (fr *federatedRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	localRepo, err := fr.embedded.Repository(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pullOnly(ctx) {
+		return localRepo, nil
+	}
+
+	return &federatedRepository{
+		Repository: localRepo,
+		siblings:   fr.siblings,
+	}, nil
+}
+
+// pullOnly returns true if the request of ctx only pulls content, which is
+// the only kind of request siblings are queried for. Clients check whether a
+// blob needs to be pushed with a HEAD request, and pushed manifests must only
+// reference local blobs, so content found at a sibling is never reported to
+// them. Requests of siblings are served from local content only.
+func pullOnly(ctx context.Context) bool {
+	r, err := context.GetRequest(ctx)
+	if err != nil || r.Header.Get(FederationHeader) != "" {
+		return false
+	}
+	return r.Method == "GET" && context.GetStringValue(ctx, "vars.uuid") == ""
+}
+
+// sibling is a registry queried for content not found locally.
+type sibling struct {
+	url              string
+	redirect         bool
+	credentials      siblingCredentials
+	challengeManager auth.ChallengeManager
+
+	mu     sync.Mutex
+	pinged time.Time
+}
+
+// siblingPingInterval is the interval at which the authentication
+// challenges of a sibling are refreshed.
+const siblingPingInterval = 10 * time.Minute
+
+// repository returns a client of the named repository of the sibling. The
+// sibling is pinged outside of the lock, so that a slow sibling does not
+// hold up the requests served with the challenges already known.
+func (s *sibling) repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	s.mu.Lock()
+	due := time.Since(s.pinged) > siblingPingInterval
+	s.mu.Unlock()
+
+	if due {
+		if err := ping(s.challengeManager, s.url+"/v2/", "Docker-Distribution-Api-Version"); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.pinged = time.Now()
+		s.mu.Unlock()
+	}
+
+	tr := transport.NewTransport(http.DefaultTransport,
+		transport.NewHeaderRequestModifier(http.Header{FederationHeader: []string{"true"}}),
+		auth.NewAuthorizer(s.challengeManager,
+			auth.NewTokenHandler(http.DefaultTransport, s.credentials, name.Name(), "pull"),
+			auth.NewBasicHandler(s.credentials)))
+
+	return client.NewRepository(ctx, name, s.url, tr)
+}
+
+// syncChallengeManager guards a challenge manager updated by the pings of a
+// sibling while requests are authorized with it.
+type syncChallengeManager struct {
+	mu sync.RWMutex
+	auth.ChallengeManager
+}
+
+func (m *syncChallengeManager) GetChallenges(endpoint string) ([]auth.Challenge, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ChallengeManager.GetChallenges(endpoint)
+}
+
+func (m *syncChallengeManager) AddResponse(resp *http.Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ChallengeManager.AddResponse(resp)
+}
+
+// siblingCredentials authenticates with any realm of a sibling.
+type siblingCredentials struct {
+	username string
+	password string
+}
+
+func (c siblingCredentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+// federatedRepository falls through to the repository of the same name of
+// each sibling for content not found locally.
+type federatedRepository struct {
+	distribution.Repository
+
+	siblings []*sibling
+
+	once    sync.Once
+	remotes []remoteRepository
+}
+
+// remoteRepository is a repository of a sibling.
+type remoteRepository struct {
+	sibling *sibling
+	distribution.Repository
+}
+
+// remoteRepositories returns the repositories of the siblings which could be
+// reached, in order.
+func (fr *federatedRepository) remoteRepositories(ctx context.Context) []remoteRepository {
+	fr.once.Do(func() {
+		for _, s := range fr.siblings {
+			repo, err := s.repository(ctx, fr.Named())
+			if err != nil {
+				context.GetLogger(ctx).Warnf("federation: error reaching %s: %v", s.url, err)
+				continue
+			}
+			fr.remotes = append(fr.remotes, remoteRepository{sibling: s, Repository: repo})
+		}
+	})
+	return fr.remotes
+}
+
+func (fr *federatedRepository) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+	local, err := fr.Repository.Manifests(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &federatedManifestService{ManifestService: local, repo: fr}, nil
+}
+
+func (fr *federatedRepository) Blobs(ctx context.Context) distribution.BlobStore {
+	return &federatedBlobStore{BlobStore: fr.Repository.Blobs(ctx), repo: fr}
+}
+
+func (fr *federatedRepository) Tags(ctx context.Context) distribution.TagService {
+	return &federatedTagService{TagService: fr.Repository.Tags(ctx), repo: fr}
+}
+
+// notFound returns true if err reports content unknown to a registry, which
+// the siblings are queried for.
+func notFound(err error) bool {
+	switch err.(type) {
+	case distribution.ErrManifestUnknownRevision, distribution.ErrManifestUnknown, distribution.ErrTagUnknown:
+		return true
+	}
+	return err == distribution.ErrBlobUnknown
+}
+
+// federatedManifestService serves manifests found locally or at a sibling.
+type federatedManifestService struct {
+	distribution.ManifestService
+	repo *federatedRepository
+}
+
+func (fms *federatedManifestService) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	exists, err := fms.ManifestService.Exists(ctx, dgst)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	for _, remote := range fms.repo.remoteRepositories(ctx) {
+		manifests, err := remote.Manifests(ctx)
+		if err != nil {
+			continue
+		}
+		if exists, err := manifests.Exists(ctx, dgst); err == nil && exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (fms *federatedManifestService) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	manifest, err := fms.ManifestService.Get(ctx, dgst, options...)
+	if err == nil || !notFound(err) {
+		return manifest, err
+	}
+
+	for _, remote := range fms.repo.remoteRepositories(ctx) {
+		manifests, rerr := remote.Manifests(ctx)
+		if rerr != nil {
+			continue
+		}
+		manifest, rerr := manifests.Get(ctx, dgst)
+		if rerr == nil {
+			context.GetLogger(ctx).Infof("federation: serving manifest %s@%s from %s", fms.repo.Named().Name(), dgst, remote.sibling.url)
+			return manifest, nil
+		}
+		context.GetLogger(ctx).Debugf("federation: manifest %s@%s not served by %s: %v", fms.repo.Named().Name(), dgst, remote.sibling.url, rerr)
+	}
+	return nil, err
+}
+
+// federatedTagService resolves tags locally or at a sibling. Tags are listed
+// and changed locally only.
+type federatedTagService struct {
+	distribution.TagService
+	repo *federatedRepository
+}
+
+func (fts *federatedTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	desc, err := fts.TagService.Get(ctx, tag)
+	if err == nil || !notFound(err) {
+		return desc, err
+	}
+
+	for _, remote := range fts.repo.remoteRepositories(ctx) {
+		rdesc, rerr := remote.Tags(ctx).Get(ctx, tag)
+		if rerr == nil {
+			return rdesc, nil
+		}
+		context.GetLogger(ctx).Debugf("federation: tag %s:%s not served by %s: %v", fts.repo.Named().Name(), tag, remote.sibling.url, rerr)
+	}
+	return desc, err
+}
+
+// federatedBlobStore serves blobs found locally or at a sibling, by proxying
+// them or redirecting clients to the sibling.
+type federatedBlobStore struct {
+	distribution.BlobStore
+	repo *federatedRepository
+}
+
+// statRemote returns the first sibling storing the blob.
+func (fbs *federatedBlobStore) statRemote(ctx context.Context, dgst digest.Digest) (remoteRepository, distribution.Descriptor, error) {
+	for _, remote := range fbs.repo.remoteRepositories(ctx) {
+		desc, err := remote.Blobs(ctx).Stat(ctx, dgst)
+		if err == nil {
+			return remote, desc, nil
+		}
+		context.GetLogger(ctx).Debugf("federation: blob %s@%s not served by %s: %v", fbs.repo.Named().Name(), dgst, remote.sibling.url, err)
+	}
+	return remoteRepository{}, distribution.Descriptor{}, distribution.ErrBlobUnknown
+}
+
+func (fbs *federatedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	desc, err := fbs.BlobStore.Stat(ctx, dgst)
+	if err == nil || !notFound(err) {
+		return desc, err
+	}
+
+	_, desc, err = fbs.statRemote(ctx, dgst)
+	return desc, err
+}
+
+func (fbs *federatedBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	p, err := fbs.BlobStore.Get(ctx, dgst)
+	if err == nil || !notFound(err) {
+		return p, err
+	}
+
+	remote, _, err := fbs.statRemote(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Blobs(ctx).Get(ctx, dgst)
+}
+
+func (fbs *federatedBlobStore) Open(ctx context.Context, dgst digest.Digest) (distribution.ReadSeekCloser, error) {
+	rsc, err := fbs.BlobStore.Open(ctx, dgst)
+	if err == nil || !notFound(err) {
+		return rsc, err
+	}
+
+	remote, _, err := fbs.statRemote(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Blobs(ctx).Open(ctx, dgst)
+}
+
+func (fbs *federatedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	if _, err := fbs.BlobStore.Stat(ctx, dgst); err == nil {
+		return fbs.BlobStore.ServeBlob(ctx, w, r, dgst)
+	} else if !notFound(err) {
+		return err
+	}
+
+	remote, desc, err := fbs.statRemote(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	if remote.sibling.redirect {
+		ub, err := v2.NewURLBuilderFromString(remote.sibling.url)
+		if err != nil {
+			return err
+		}
+		ref, err := reference.WithDigest(fbs.repo.Named(), dgst)
+		if err != nil {
+			return err
+		}
+		blobURL, err := ub.BuildBlobURL(ref)
+		if err != nil {
+			return err
+		}
+
+		context.GetLogger(ctx).Infof("federation: redirecting to blob %s@%s at %s", fbs.repo.Named().Name(), dgst, remote.sibling.url)
+		http.Redirect(w, r, blobURL, http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	rsc, err := remote.Blobs(ctx).Open(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	defer rsc.Close()
+
+	context.GetLogger(ctx).Infof("federation: proxying blob %s@%s from %s", fbs.repo.Named().Name(), dgst, remote.sibling.url)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, dgst))
+	if w.Header().Get("Docker-Content-Digest") == "" {
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", desc.MediaType)
+	}
+	http.ServeContent(w, r, dgst.String(), time.Time{}, rsc)
+	return nil
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+)
+
+// negativeKey returns the key of the content of a repository, a tag, a
+// manifest or a blob, in the negative cache of the remote.
+func negativeKey(kind string, repo reference.Named, id string) string {
+	return kind + " " + repo.Name() + " " + id
+}
+
+// isRemoteMiss reports whether err is the remote reporting the content, or
+// its repository, missing.
+func isRemoteMiss(err error) bool {
+	switch err := err.(type) {
+	case distribution.ErrTagUnknown, distribution.ErrManifestUnknownRevision:
+		return true
+	case errcode.Errors:
+		return len(err) == 1 && isRemoteMiss(err[0])
+	case errcode.Error:
+		switch err.Code {
+		case v2.ErrorCodeManifestUnknown, v2.ErrorCodeBlobUnknown, v2.ErrorCodeNameUnknown:
+			return true
+		}
+	}
+	return err == distribution.ErrBlobUnknown
+}
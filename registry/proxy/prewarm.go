@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+)
+
+// ResolveBlobs fetches the manifest of a repository of a pull through cache
+// referenced by ref, a tag or a digest, into the cache, along with the
+// manifests it lists, and returns the blobs they reference. It returns
+// distribution.ErrUnsupported if repo does not belong to a pull through cache.
+func ResolveBlobs(ctx context.Context, repo distribution.Repository, ref string) ([]distribution.Descriptor, error) {
+	pr, ok := repo.(*proxiedRepository)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+
+	dgst, err := digest.ParseDigest(ref)
+	if err != nil {
+		if !reference.TagRegexp.MatchString(ref) {
+			return nil, distribution.ErrManifestUnknownRevision{Name: repo.Named().Name(), Revision: digest.Digest(ref)}
+		}
+
+		desc, err := pr.tags.Get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		dgst = desc.Digest
+	}
+
+	var blobs []distribution.Descriptor
+	if err := pr.resolveManifest(ctx, dgst, &blobs); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func (pr *proxiedRepository) resolveManifest(ctx context.Context, dgst digest.Digest, blobs *[]distribution.Descriptor) error {
+	manifest, err := pr.manifests.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	_, isList := manifest.(*manifestlist.DeserializedManifestList)
+	for _, desc := range manifest.References() {
+		if isList {
+			if err := pr.resolveManifest(ctx, desc.Digest, blobs); err != nil {
+				return err
+			}
+			continue
+		}
+		*blobs = append(*blobs, desc)
+	}
+	return nil
+}
+
+// PrefetchBlob fetches a blob of a repository of a pull through cache into
+// the cache, unless it is cached already, and waits until it is stored. It
+// returns true if the blob was fetched from the remote, or joined a fetch in
+// progress. It returns distribution.ErrUnsupported if repo does not belong to
+// a pull through cache.
+func PrefetchBlob(ctx context.Context, repo distribution.Repository, dgst digest.Digest) (bool, error) {
+	pr, ok := repo.(*proxiedRepository)
+	if !ok {
+		return false, distribution.ErrUnsupported
+	}
+	pbs := pr.blobStore.(*proxyBlobStore)
+
+	if _, err := pbs.localStore.Stat(ctx, dgst); err == nil {
+		return false, nil
+	}
+
+	f, err := pbs.startFetch(ctx, dgst)
+	if err != nil {
+		return false, err
+	}
+	defer f.release()
+
+	if _, err := io.Copy(ioutil.Discard, f.newReader()); err != nil {
+		return true, err
+	}
+
+	select {
+	case <-f.stored:
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+
+	if _, err := pbs.localStore.Stat(ctx, dgst); err != nil {
+		return true, err
+	}
+	return true, nil
+}
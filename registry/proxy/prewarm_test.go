@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"io"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/docker/libtrust"
+)
+
+func TestPrewarm(t *testing.T) {
+	ctx := context.Background()
+	name, _ := reference.ParseNamed("foo/bar")
+
+	truthRegistry, err := storage.NewRegistry(ctx, inmemory.New(), storage.BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	truthRepo, err := truthRegistry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	m := schema1.Manifest{
+		Versioned: manifest.Versioned{SchemaVersion: 1},
+		Name:      name.Name(),
+		Tag:       "latest",
+	}
+	for i := 0; i < 2; i++ {
+		rs, ts, err := testutil.CreateRandomTarFile()
+		if err != nil {
+			t.Fatalf("unexpected error generating test layer file: %v", err)
+		}
+		wr, err := truthRepo.Blobs(ctx).Create(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error creating test upload: %v", err)
+		}
+		if _, err := io.Copy(wr, rs); err != nil {
+			t.Fatalf("unexpected error copying to upload: %v", err)
+		}
+		if _, err := wr.Commit(ctx, distribution.Descriptor{Digest: digest.Digest(ts)}); err != nil {
+			t.Fatalf("unexpected error finishing upload: %v", err)
+		}
+		m.FSLayers = append(m.FSLayers, schema1.FSLayer{BlobSum: digest.Digest(ts)})
+		m.History = append(m.History, schema1.History{V1Compatibility: "{}"})
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+	sm, err := schema1.Sign(&m, pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+	truthManifests, err := truthRepo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := truthManifests.Put(ctx, sm)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	if err := truthRepo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+
+	localRegistry, err := storage.NewRegistry(ctx, inmemory.New(), storage.BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	localRepo, err := localRegistry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	localManifests, err := localRepo.Manifests(ctx, storage.SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := scheduler.New(ctx, inmemory.New(), "/scheduler-state.json")
+	repo := &proxiedRepository{
+		blobStore: &proxyBlobStore{
+			localStore:     localRepo.Blobs(ctx),
+			remoteStore:    truthRepo.Blobs(ctx),
+			scheduler:      s,
+			repositoryName: name,
+		},
+		manifests: &proxyManifestStore{
+			repositoryName:  name,
+			localManifests:  localManifests,
+			remoteManifests: truthManifests,
+			ctx:             ctx,
+			scheduler:       s,
+		},
+		name: name,
+		tags: &proxyTagService{
+			localTags:  localRepo.Tags(ctx),
+			remoteTags: truthRepo.Tags(ctx),
+		},
+	}
+
+	blobs, err := ResolveBlobs(ctx, repo, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error resolving blobs: %v", err)
+	}
+	if len(blobs) != 2 {
+		t.Fatalf("expected the 2 layers of the manifest, got %v", blobs)
+	}
+	if _, err := localManifests.Get(ctx, dgst); err != nil {
+		t.Fatalf("expected the manifest to be cached: %v", err)
+	}
+
+	for _, desc := range blobs {
+		fetched, err := PrefetchBlob(ctx, repo, desc.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error prefetching %s: %v", desc.Digest, err)
+		}
+		if !fetched {
+			t.Fatalf("expected %s to be fetched from the remote", desc.Digest)
+		}
+		if _, err := localRepo.Blobs(ctx).Stat(ctx, desc.Digest); err != nil {
+			t.Fatalf("expected %s to be cached: %v", desc.Digest, err)
+		}
+
+		fetched, err = PrefetchBlob(ctx, repo, desc.Digest)
+		if err != nil || fetched {
+			t.Fatalf("expected cached %s not to be fetched again: %v, %v", desc.Digest, fetched, err)
+		}
+	}
+
+	if _, err := ResolveBlobs(ctx, truthRepo, "latest"); err != distribution.ErrUnsupported {
+		t.Fatalf("expected prewarming a repository outside a cache to be unsupported, got %v", err)
+	}
+}
@@ -1,14 +1,40 @@
 package proxy
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/client/auth"
 )
 
 const tokenURL = "https://auth.docker.io/token"
 
+const (
+	// defaultRefreshInterval is how long credentials without an expiry
+	// are used before being requested again.
+	defaultRefreshInterval = 30 * time.Minute
+
+	// refreshMargin is how long before their expiry credentials are
+	// requested again, so that they do not expire in flight.
+	refreshMargin = time.Minute
+
+	// retryInterval is how long after a failure credentials are requested
+	// again, so that a failing command or token provider is not run for
+	// every request.
+	retryInterval = 10 * time.Second
+)
+
 type userpass struct {
 	username string
 	password string
@@ -25,20 +51,191 @@ func (c credentials) Basic(u *url.URL) (string, string) {
 }
 
 // ConfigureAuth authorizes with the upstream registry
-func ConfigureAuth(remoteURL, username, password string, cm auth.ChallengeManager) (auth.CredentialStore, error) {
-	if err := ping(cm, remoteURL+"/v2/", "Docker-Distribution-Api-Version"); err != nil {
+func ConfigureAuth(config configuration.Proxy, cm auth.ChallengeManager) (auth.CredentialStore, error) {
+	if err := ping(cm, config.RemoteURL+"/v2/", "Docker-Distribution-Api-Version"); err != nil {
 		return nil, err
 	}
 
+	if config.CredentialHelper != "" || config.Exec.Command != "" || config.TokenProvider.Name != "" {
+		return configureRefreshingAuth(config)
+	}
+
 	creds := map[string]userpass{
 		tokenURL: {
-			username: username,
-			password: password,
+			username: config.Username,
+			password: config.Password,
 		},
 	}
 	return credentials{creds: creds}, nil
 }
 
+// configureRefreshingAuth returns the credentials provided by the credential
+// helper, command or token provider configured, checking that they can be
+// obtained.
+func configureRefreshingAuth(config configuration.Proxy) (auth.CredentialStore, error) {
+	sources := 0
+	for _, name := range []string{config.CredentialHelper, config.Exec.Command, config.TokenProvider.Name} {
+		if name != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, errors.New("proxy credentialhelper, exec and tokenprovider are mutually exclusive")
+	}
+	if config.Username != "" || config.Password != "" {
+		return nil, errors.New("proxy username and password cannot be set with a credentialhelper, exec or tokenprovider")
+	}
+
+	rc := &refreshingCredentials{
+		refreshInterval: config.RefreshInterval,
+	}
+	if rc.refreshInterval <= 0 {
+		rc.refreshInterval = defaultRefreshInterval
+	}
+	switch {
+	case config.CredentialHelper != "":
+		u, err := url.Parse(config.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
+		rc.fetch = func() (userpass, time.Time, error) {
+			return credentialHelperGet(config.CredentialHelper, u.Host)
+		}
+	case config.Exec.Command != "":
+		rc.fetch = func() (userpass, time.Time, error) {
+			return execGet(config.Exec, config.RemoteURL)
+		}
+	default:
+		fetch, err := newTokenProvider(config.RemoteURL, config.TokenProvider)
+		if err != nil {
+			return nil, err
+		}
+		rc.fetch = fetch
+	}
+
+	if err := rc.refresh(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// refreshingCredentials are the credentials of the remote registry provided
+// by a command or token provider, requested again when they expire. They
+// are presented to the remote registry and to its token server alike, as
+// the short-lived tokens of cloud registries are accepted by either.
+type refreshingCredentials struct {
+	fetch           func() (userpass, time.Time, error)
+	refreshInterval time.Duration
+
+	mu      sync.Mutex
+	creds   userpass
+	expires time.Time
+}
+
+// Basic implements auth.CredentialStore.
+func (rc *refreshingCredentials) Basic(*url.URL) (string, string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if !time.Now().Before(rc.expires) {
+		if err := rc.refreshLocked(); err != nil {
+			// Stale credentials are kept, in case they are still accepted.
+			context.GetLogger(context.Background()).Errorf("error refreshing proxy credentials: %v", err)
+		}
+	}
+	return rc.creds.username, rc.creds.password
+}
+
+func (rc *refreshingCredentials) refresh() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.refreshLocked()
+}
+
+func (rc *refreshingCredentials) refreshLocked() error {
+	creds, expires, err := rc.fetch()
+	if err != nil {
+		rc.expires = time.Now().Add(retryInterval)
+		return err
+	}
+
+	now := time.Now()
+	switch {
+	case expires.IsZero():
+		expires = now.Add(rc.refreshInterval)
+	case expires.Sub(now) > 2*refreshMargin:
+		expires = expires.Add(-refreshMargin)
+	}
+	rc.creds, rc.expires = creds, expires
+	return nil
+}
+
+// credentialHelperGet gets the credentials of the server from the docker
+// credential helper of the given name.
+func credentialHelperGet(helper, serverURL string) (userpass, time.Time, error) {
+	name := "docker-credential-" + helper
+	cmd := exec.Command(name, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+
+	out, err := runCommand(cmd)
+	if err != nil {
+		return userpass{}, time.Time{}, fmt.Errorf("error getting credentials from %s: %v", name, err)
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return userpass{}, time.Time{}, fmt.Errorf("invalid credentials from %s: %v", name, err)
+	}
+	if creds.Username == "<token>" {
+		return userpass{}, time.Time{}, fmt.Errorf("%s returned an identity token, which is not supported", name)
+	}
+	return userpass{username: creds.Username, password: creds.Secret}, time.Time{}, nil
+}
+
+// execCredentials are the credentials printed by an exec command.
+type execCredentials struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// execGet gets the credentials of the remote registry from the command
+// configured. The URL of the remote registry is passed to the command in
+// the REGISTRY_PROXY_REMOTEURL environment variable.
+func execGet(config configuration.ProxyExec, remoteURL string) (userpass, time.Time, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = append(os.Environ(), "REGISTRY_PROXY_REMOTEURL="+remoteURL)
+
+	out, err := runCommand(cmd)
+	if err != nil {
+		return userpass{}, time.Time{}, fmt.Errorf("error getting credentials from %s: %v", config.Command, err)
+	}
+
+	var creds execCredentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return userpass{}, time.Time{}, fmt.Errorf("invalid credentials from %s: %v", config.Command, err)
+	}
+	return userpass{username: creds.Username, password: creds.Password}, creds.ExpiresAt, nil
+}
+
+// runCommand runs the command, returning its output. The error output of
+// the command is reported when it fails.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String() + stdout.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
 func ping(manager auth.ChallengeManager, endpoint, versionHeader string) error {
 	resp, err := http.Get(endpoint)
 	if err != nil {
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/registry/client/auth"
+)
+
+// writeScript writes an executable shell script to dir.
+func writeScript(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentialHelperAuth(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "proxyauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeScript(t, dir, "docker-credential-test", `
+[ "$1" = get ] || exit 1
+read server
+echo "{\"ServerURL\":\"$server\",\"Username\":\"$server\",\"Secret\":\"s3cr3t\"}"
+`)
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	cs, err := ConfigureAuth(configuration.Proxy{
+		RemoteURL:        server.URL,
+		CredentialHelper: "test",
+	}, auth.NewSimpleChallengeManager())
+	if err != nil {
+		t.Fatalf("unexpected error configuring credential helper: %v", err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	username, password := cs.Basic(u)
+	if username != u.Host || password != "s3cr3t" {
+		t.Fatalf("unexpected credentials: %q %q", username, password)
+	}
+	if cs.(*refreshingCredentials).expires.Sub(time.Now()) <= defaultRefreshInterval-time.Minute {
+		t.Fatalf("credentials without expiry should be kept for the refresh interval")
+	}
+}
+
+func TestExecAuth(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "proxyauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	counter := filepath.Join(dir, "counter")
+	command := writeScript(t, dir, "credentials", `
+n=$(($(cat "$1" 2>/dev/null || echo 0) + 1))
+echo $n > "$1"
+echo "{\"username\":\"$REGISTRY_PROXY_REMOTEURL\",\"password\":\"p$n\",\"expiresAt\":\"2100-01-01T00:00:00Z\"}"
+`)
+
+	cs, err := ConfigureAuth(configuration.Proxy{
+		RemoteURL: server.URL,
+		Exec: configuration.ProxyExec{
+			Command: command,
+			Args:    []string{counter},
+		},
+	}, auth.NewSimpleChallengeManager())
+	if err != nil {
+		t.Fatalf("unexpected error configuring exec credentials: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		username, password := cs.Basic(nil)
+		if username != server.URL || password != "p1" {
+			t.Fatalf("unexpected credentials: %q %q", username, password)
+		}
+	}
+
+	// expired credentials are requested again
+	cs.(*refreshingCredentials).expires = time.Now()
+	if _, password := cs.Basic(nil); password != "p2" {
+		t.Fatalf("expected refreshed credentials, got %q", password)
+	}
+
+	// stale credentials are used while the command fails
+	os.Remove(command)
+	cs.(*refreshingCredentials).expires = time.Now()
+	if _, password := cs.Basic(nil); password != "p2" {
+		t.Fatalf("expected stale credentials, got %q", password)
+	}
+	if cs.(*refreshingCredentials).expires.Sub(time.Now()) > retryInterval {
+		t.Fatalf("failed refresh should be retried")
+	}
+
+	failing := writeScript(t, dir, "failing", "echo 'no credentials' >&2; exit 1\n")
+	for _, config := range []configuration.Proxy{
+		{RemoteURL: server.URL, Exec: configuration.ProxyExec{Command: failing}},
+		{RemoteURL: server.URL, Exec: configuration.ProxyExec{Command: failing}, CredentialHelper: "test"},
+		{RemoteURL: server.URL, Exec: configuration.ProxyExec{Command: failing}, Username: "user"},
+	} {
+		if _, err := ConfigureAuth(config, auth.NewSimpleChallengeManager()); err == nil {
+			t.Fatalf("expected an error configuring %+v", config)
+		}
+	}
+	_, err = ConfigureAuth(configuration.Proxy{RemoteURL: server.URL, Exec: configuration.ProxyExec{Command: failing}}, auth.NewSimpleChallengeManager())
+	if err == nil || !strings.Contains(err.Error(), "no credentials") {
+		t.Fatalf("expected the error output of the command, got %v", err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"io"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/docker/distribution"
@@ -12,6 +11,8 @@ import (
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage/cache"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
 )
 
 // todo(richardscothern): from cache control header or config file
@@ -22,16 +23,14 @@ type proxyBlobStore struct {
 	remoteStore    distribution.BlobService
 	scheduler      *scheduler.TTLExpirationScheduler
 	repositoryName reference.Named
+
+	// negativeCache, if set, remembers the blobs found missing from the
+	// remote.
+	negativeCache *cache.NegativeCache
 }
 
 var _ distribution.BlobStore = &proxyBlobStore{}
 
-// inflight tracks currently downloading blobs
-var inflight = make(map[digest.Digest]struct{})
-
-// mu protects inflight
-var mu sync.Mutex
-
 func setResponseHeaders(w http.ResponseWriter, length int64, mediaType string, digest digest.Digest) {
 	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
 	w.Header().Set("Content-Type", mediaType)
@@ -39,31 +38,6 @@ func setResponseHeaders(w http.ResponseWriter, length int64, mediaType string, d
 	w.Header().Set("Etag", digest.String())
 }
 
-func (pbs *proxyBlobStore) copyContent(ctx context.Context, dgst digest.Digest, writer io.Writer) (distribution.Descriptor, error) {
-	desc, err := pbs.remoteStore.Stat(ctx, dgst)
-	if err != nil {
-		return distribution.Descriptor{}, err
-	}
-
-	if w, ok := writer.(http.ResponseWriter); ok {
-		setResponseHeaders(w, desc.Size, desc.MediaType, dgst)
-	}
-
-	remoteReader, err := pbs.remoteStore.Open(ctx, dgst)
-	if err != nil {
-		return distribution.Descriptor{}, err
-	}
-
-	_, err = io.CopyN(writer, remoteReader, desc.Size)
-	if err != nil {
-		return distribution.Descriptor{}, err
-	}
-
-	proxyMetrics.BlobPush(uint64(desc.Size))
-
-	return desc, nil
-}
-
 func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) (bool, error) {
 	localDesc, err := pbs.localStore.Stat(ctx, dgst)
 	if err != nil {
@@ -81,33 +55,44 @@ func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter
 
 }
 
-func (pbs *proxyBlobStore) storeLocal(ctx context.Context, dgst digest.Digest) error {
-	defer func() {
-		mu.Lock()
-		delete(inflight, dgst)
-		mu.Unlock()
-	}()
-
-	var desc distribution.Descriptor
-	var err error
-	var bw distribution.BlobWriter
-
-	bw, err = pbs.localStore.Create(ctx)
+// startFetch returns the inflight fetch of the blob from the remote, starting
+// one if there is none, with a reference to it held.
+func (pbs *proxyBlobStore) startFetch(ctx context.Context, dgst digest.Digest) (*blobFetch, error) {
+	desc, err := pbs.statRemote(ctx, dgst)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	desc, err = pbs.copyContent(ctx, dgst, bw)
-	if err != nil {
-		return err
+	mu.Lock()
+	defer mu.Unlock()
+
+	if f, ok := inflight[dgst]; ok {
+		f.refs++
+		return f, nil
 	}
 
-	_, err = bw.Commit(ctx, desc)
+	f, err := newBlobFetch(desc)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// One reference is held by the client, the other by the goroutine
+	// storing the blob locally.
+	f.refs = 2
+	inflight[dgst] = f
 
-	return nil
+	// The fetch outlives the request which started it, whose context is
+	// done once the response has been sent.
+	go pbs.fetch(detachedContext(ctx), f, dgst)
+
+	return f, nil
+}
+
+// detachedContext returns a context for work outliving the request ctx
+// serves. It logs with the logger of the request and carries its storage
+// scope.
+func detachedContext(ctx context.Context) context.Context {
+	detached := context.WithLogger(context.Background(), context.GetLogger(ctx))
+	return storagemiddleware.WithScope(detached, storagemiddleware.GetScope(ctx))
 }
 
 func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
@@ -121,34 +106,18 @@ func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter,
 		return nil
 	}
 
-	mu.Lock()
-	_, ok := inflight[dgst]
-	if ok {
-		mu.Unlock()
-		_, err := pbs.copyContent(ctx, dgst, w)
+	f, err := pbs.startFetch(ctx, dgst)
+	if err != nil {
 		return err
 	}
-	inflight[dgst] = struct{}{}
-	mu.Unlock()
-
-	go func(dgst digest.Digest) {
-		if err := pbs.storeLocal(ctx, dgst); err != nil {
-			context.GetLogger(ctx).Errorf("Error committing to storage: %s", err.Error())
-		}
+	defer f.release()
 
-		blobRef, err := reference.WithDigest(pbs.repositoryName, dgst)
-		if err != nil {
-			context.GetLogger(ctx).Errorf("Error creating reference: %s", err)
-			return
-		}
-
-		pbs.scheduler.AddBlob(blobRef, repositoryTTL)
-	}(dgst)
-
-	_, err = pbs.copyContent(ctx, dgst, w)
-	if err != nil {
+	setResponseHeaders(w, f.desc.Size, f.desc.MediaType, dgst)
+	if _, err := io.Copy(w, f.newReader()); err != nil {
 		return err
 	}
+
+	proxyMetrics.BlobPush(uint64(f.desc.Size))
 	return nil
 }
 
@@ -162,7 +131,26 @@ func (pbs *proxyBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distri
 		return distribution.Descriptor{}, err
 	}
 
-	return pbs.remoteStore.Stat(ctx, dgst)
+	return pbs.statRemote(ctx, dgst)
+}
+
+// statRemote stats the blob on the remote, unless it was recently found
+// missing from it.
+func (pbs *proxyBlobStore) statRemote(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	if pbs.negativeCache == nil {
+		return pbs.remoteStore.Stat(ctx, dgst)
+	}
+
+	key := negativeKey("blob", pbs.repositoryName, dgst.String())
+	if pbs.negativeCache.Contains(key) {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+
+	desc, err := pbs.remoteStore.Stat(ctx, dgst)
+	if isRemoteMiss(err) {
+		pbs.negativeCache.Add(key)
+	}
+	return desc, err
 }
 
 // Unsupported functions
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"errors"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/docker/distribution/registry/storage/cache/memory"
 	"github.com/docker/distribution/registry/storage/driver/filesystem"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
 )
 
 var sbsMu sync.Mutex
@@ -244,6 +246,180 @@ func TestProxyStoreStat(t *testing.T) {
 	}
 }
 
+// TestProxyStoreServeTee checks that a blob is fetched from the remote once,
+// to serve the client and populate the local store, even if the client goes
+// away.
+func TestProxyStoreServeTee(t *testing.T) {
+	te := makeTestEnv(t, "foo/bar")
+	populate(t, te, 2, 1024*1024, 2)
+
+	for i, remoteBlob := range te.inRemote {
+		var w http.ResponseWriter = httptest.NewRecorder()
+		if i == 1 {
+			w = failingResponseWriter{httptest.NewRecorder()}
+		}
+
+		r, err := http.NewRequest("GET", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = te.store.ServeBlob(te.ctx, w, r, remoteBlob.Digest)
+		if i == 0 {
+			if err != nil {
+				t.Fatalf("unexpected error serving blob: %v", err)
+			}
+			if dgst := digest.FromBytes(w.(*httptest.ResponseRecorder).Body.Bytes()); dgst != remoteBlob.Digest {
+				t.Fatalf("mismatching blob fetch from proxy")
+			}
+		} else if err == nil {
+			t.Fatalf("expected error serving blob to failing client")
+		}
+	}
+
+	if opened := (*te.RemoteStats())["open"]; opened != len(te.inRemote) {
+		t.Fatalf("unexpected number of remote fetches: %d != %d", opened, len(te.inRemote))
+	}
+
+	// The blobs are committed to the local store in the background.
+	for _, remoteBlob := range te.inRemote {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := te.store.localStore.Stat(te.ctx, remoteBlob.Digest); err == nil {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("blob %s was not stored locally: %v", remoteBlob.Digest, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// failingResponseWriter fails writes as if the client went away.
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingResponseWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+// gatedBlobService holds opening blobs until its gate is closed.
+type gatedBlobService struct {
+	distribution.BlobService
+	gate chan struct{}
+}
+
+func (gbs gatedBlobService) Open(ctx context.Context, dgst digest.Digest) (distribution.ReadSeekCloser, error) {
+	<-gbs.gate
+	return gbs.BlobService.Open(ctx, dgst)
+}
+
+// TestProxyStoreServeCoalesced checks that concurrent requests for a blob
+// share a single fetch from the remote.
+func TestProxyStoreServeCoalesced(t *testing.T) {
+	te := makeTestEnv(t, "foo/bar")
+	populate(t, te, 1, 1024*1024, 1)
+	dgst := te.inRemote[0].Digest
+
+	remote := te.store.remoteStore.(statsBlobStore)
+	gate := make(chan struct{})
+	te.store.remoteStore = gatedBlobService{BlobService: remote, gate: gate}
+
+	numClients := 8
+	recorders := make([]*httptest.ResponseRecorder, numClients)
+	errs := make(chan error, numClients)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		go func(w http.ResponseWriter) {
+			r, err := http.NewRequest("GET", "", nil)
+			if err == nil {
+				err = te.store.ServeBlob(te.ctx, w, r, dgst)
+			}
+			errs <- err
+		}(recorders[i])
+	}
+
+	// Let the fetch proceed once every client has joined it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		f := inflight[dgst]
+		joined := f != nil && f.refs == numClients+1
+		mu.Unlock()
+
+		if joined {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("clients did not join the fetch")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+
+	for i := 0; i < numClients; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+	}
+	for _, w := range recorders {
+		if digest.FromBytes(w.Body.Bytes()) != dgst {
+			t.Fatalf("mismatching blob fetch from proxy")
+		}
+	}
+
+	sbsMu.Lock()
+	opened := remote.stats["open"]
+	sbsMu.Unlock()
+	if opened != 1 {
+		t.Fatalf("expected a single remote fetch, got %d", opened)
+	}
+}
+
+// scopeBlobStore records the storage scope of the contexts local blobs are
+// created with.
+type scopeBlobStore struct {
+	distribution.BlobStore
+	scopes chan storagemiddleware.Scope
+}
+
+func (sbs scopeBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	sbs.scopes <- storagemiddleware.GetScope(ctx)
+	return sbs.BlobStore.Create(ctx, options...)
+}
+
+// TestProxyStoreFetchScope checks that a blob fetched in the background is
+// stored with the storage scope of the request which started the fetch.
+func TestProxyStoreFetchScope(t *testing.T) {
+	te := makeTestEnv(t, "foo/bar")
+	populate(t, te, 1, 1024, 1)
+
+	scopes := make(chan storagemiddleware.Scope, 1)
+	te.store.localStore = scopeBlobStore{BlobStore: te.store.localStore, scopes: scopes}
+
+	ctx := storagemiddleware.WithScope(te.ctx, storagemiddleware.Scope{
+		storagemiddleware.ScopeRepository: "foo/bar",
+		storagemiddleware.ScopeTenant:     "foo",
+	})
+	r, err := http.NewRequest("GET", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := te.store.ServeBlob(ctx, httptest.NewRecorder(), r, te.inRemote[0].Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+
+	select {
+	case scope := <-scopes:
+		if scope[storagemiddleware.ScopeRepository] != "foo/bar" || scope[storagemiddleware.ScopeTenant] != "foo" {
+			t.Fatalf("unexpected scope of the local blob: %v", scope)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blob was not stored locally")
+	}
+}
+
 func TestProxyStoreServeHighConcurrency(t *testing.T) {
 	te := makeTestEnv(t, "foo/bar")
 	blobSize := 200
@@ -316,15 +492,19 @@ func testProxyStoreServe(t *testing.T, te *testEnv, numClients int) {
 	wg.Wait()
 
 	remoteBlobCount := len(te.inRemote)
-	if (*localStats)["stat"] != remoteBlobCount*numClients && (*localStats)["create"] != te.numUnique {
-		t.Fatal("Expected: stat:", remoteBlobCount*numClients, "create:", remoteBlobCount)
-	}
 
 	// Wait for any async storage goroutines to finish
 	time.Sleep(3 * time.Second)
 
+	sbsMu.Lock()
+	localStatCount, localCreateCount := (*localStats)["stat"], (*localStats)["create"]
 	remoteStatCount := (*remoteStats)["stat"]
 	remoteOpenCount := (*remoteStats)["open"]
+	sbsMu.Unlock()
+
+	if localStatCount != remoteBlobCount*numClients && localCreateCount != te.numUnique {
+		t.Fatal("Expected: stat:", remoteBlobCount*numClients, "create:", remoteBlobCount)
+	}
 
 	// Serveblob - blobs come from local
 	for _, dr := range te.inRemote {
@@ -349,6 +529,8 @@ func testProxyStoreServe(t *testing.T, te *testEnv, numClients int) {
 	remoteStats = te.RemoteStats()
 
 	// Ensure remote unchanged
+	sbsMu.Lock()
+	defer sbsMu.Unlock()
 	if (*remoteStats)["stat"] != remoteStatCount && (*remoteStats)["open"] != remoteOpenCount {
 		t.Fatalf("unexpected remote stats: %#v", remoteStats)
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage/cache"
 )
 
 // todo(richardscothern): from cache control header or config
@@ -19,6 +20,10 @@ type proxyManifestStore struct {
 	remoteManifests distribution.ManifestService
 	repositoryName  reference.Named
 	scheduler       *scheduler.TTLExpirationScheduler
+
+	// negativeCache, if set, remembers the manifests found missing from
+	// the remote.
+	negativeCache *cache.NegativeCache
 }
 
 var _ distribution.ManifestService = &proxyManifestStore{}
@@ -32,7 +37,16 @@ func (pms proxyManifestStore) Exists(ctx context.Context, dgst digest.Digest) (b
 		return true, nil
 	}
 
-	return pms.remoteManifests.Exists(ctx, dgst)
+	key := negativeKey("manifest", pms.repositoryName, dgst.String())
+	if pms.negativeCache != nil && pms.negativeCache.Contains(key) {
+		return false, nil
+	}
+
+	exists, err = pms.remoteManifests.Exists(ctx, dgst)
+	if err == nil && !exists && pms.negativeCache != nil {
+		pms.negativeCache.Add(key)
+	}
+	return exists, err
 }
 
 func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
@@ -41,7 +55,7 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 	var fromRemote bool
 	manifest, err := pms.localManifests.Get(ctx, dgst, options...)
 	if err != nil {
-		manifest, err = pms.remoteManifests.Get(ctx, dgst, options...)
+		manifest, err = pms.getRemote(ctx, dgst, options...)
 		if err != nil {
 			return nil, err
 		}
@@ -78,6 +92,25 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 	return manifest, err
 }
 
+// getRemote gets the manifest from the remote, unless it was recently found
+// missing from it.
+func (pms proxyManifestStore) getRemote(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	if pms.negativeCache == nil {
+		return pms.remoteManifests.Get(ctx, dgst, options...)
+	}
+
+	key := negativeKey("manifest", pms.repositoryName, dgst.String())
+	if pms.negativeCache.Contains(key) {
+		return nil, distribution.ErrManifestUnknownRevision{Name: pms.repositoryName.Name(), Revision: dgst}
+	}
+
+	manifest, err := pms.remoteManifests.Get(ctx, dgst, options...)
+	if isRemoteMiss(err) {
+		pms.negativeCache.Add(key)
+	}
+	return manifest, err
+}
+
 func (pms proxyManifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	var d digest.Digest
 	return d, distribution.ErrUnsupported
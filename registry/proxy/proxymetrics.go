@@ -71,4 +71,8 @@ func init() {
 		return proxyMetrics.manifestMetrics
 	}))
 
+	pm.(*expvar.Map).Set("upstream", expvar.Func(func() interface{} {
+		return upstreamStatus.get()
+	}))
+
 }
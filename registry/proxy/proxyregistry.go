@@ -14,6 +14,7 @@ import (
 	"github.com/docker/distribution/registry/client/transport"
 	"github.com/docker/distribution/registry/proxy/scheduler"
 	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/cache"
 	"github.com/docker/distribution/registry/storage/driver"
 )
 
@@ -24,12 +25,23 @@ type proxyingRegistry struct {
 	scheduler *scheduler.TTLExpirationScheduler
 
 	remoteURL        string
+	remoteTransport  http.RoundTripper
 	credentialStore  auth.CredentialStore
 	challengeManager auth.ChallengeManager
+
+	// revalidator is set when cached tags are revalidated in the
+	// background.
+	revalidator *tagRevalidator
+
+	// negativeCache is set when the content found missing from the remote
+	// is remembered.
+	negativeCache *cache.NegativeCache
 }
 
-// NewRegistryPullThroughCache creates a registry acting as a pull through cache
-func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy) (distribution.Namespace, error) {
+// NewRegistryPullThroughCache creates a registry acting as a pull through cache.
+// If the cached tags are revalidated in the background, onTagMoved is called
+// for the tags found moved on the remote.
+func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy, onTagMoved TagMovedFunc) (distribution.Namespace, error) {
 	_, err := url.Parse(config.RemoteURL)
 	if err != nil {
 		return nil, err
@@ -94,18 +106,29 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 	}
 
 	challengeManager := auth.NewSimpleChallengeManager()
-	cs, err := ConfigureAuth(config.RemoteURL, config.Username, config.Password, challengeManager)
+	cs, err := ConfigureAuth(config, challengeManager)
 	if err != nil {
 		return nil, err
 	}
 
-	return &proxyingRegistry{
+	pr := &proxyingRegistry{
 		embedded:         registry,
 		scheduler:        s,
 		challengeManager: challengeManager,
 		credentialStore:  cs,
 		remoteURL:        config.RemoteURL,
-	}, nil
+		remoteTransport:  http.DefaultTransport,
+	}
+	if config.MaxRetries > 0 {
+		pr.remoteTransport = transport.NewRetryTransport(http.DefaultTransport, config.MaxRetries, nil)
+	}
+	if config.RevalidateAfter > 0 {
+		pr.revalidator = newTagRevalidator(config.RevalidateAfter, onTagMoved)
+	}
+	if config.NegativeTTL > 0 {
+		pr.negativeCache = cache.NewNegativeCache(config.NegativeTTL, 0)
+	}
+	return pr, nil
 }
 
 func (pr *proxyingRegistry) Scope() distribution.Scope {
@@ -117,8 +140,10 @@ func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, la
 }
 
 func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
-	tr := transport.NewTransport(http.DefaultTransport,
-		auth.NewAuthorizer(pr.challengeManager, auth.NewTokenHandler(http.DefaultTransport, pr.credentialStore, name.Name(), "pull")))
+	tr := transport.NewTransport(pr.remoteTransport,
+		auth.NewAuthorizer(pr.challengeManager,
+			auth.NewTokenHandler(pr.remoteTransport, pr.credentialStore, name.Name(), "pull"),
+			auth.NewBasicHandler(pr.credentialStore)))
 
 	localRepo, err := pr.embedded.Repository(ctx, name)
 	if err != nil {
@@ -139,24 +164,32 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		return nil, err
 	}
 
+	manifests := &proxyManifestStore{
+		repositoryName:  name,
+		localManifests:  localManifests, // Options?
+		remoteManifests: remoteManifests,
+		ctx:             ctx,
+		scheduler:       pr.scheduler,
+		negativeCache:   pr.negativeCache,
+	}
+
 	return &proxiedRepository{
 		blobStore: &proxyBlobStore{
 			localStore:     localRepo.Blobs(ctx),
 			remoteStore:    remoteRepo.Blobs(ctx),
 			scheduler:      pr.scheduler,
 			repositoryName: name,
+			negativeCache:  pr.negativeCache,
 		},
-		manifests: &proxyManifestStore{
-			repositoryName:  name,
-			localManifests:  localManifests, // Options?
-			remoteManifests: remoteManifests,
-			ctx:             ctx,
-			scheduler:       pr.scheduler,
-		},
-		name: name,
+		manifests: manifests,
+		name:      name,
 		tags: &proxyTagService{
-			localTags:  localRepo.Tags(ctx),
-			remoteTags: remoteRepo.Tags(ctx),
+			localTags:      localRepo.Tags(ctx),
+			remoteTags:     remoteRepo.Tags(ctx),
+			revalidator:    pr.revalidator,
+			repositoryName: name,
+			manifests:      manifests,
+			negativeCache:  pr.negativeCache,
 		},
 	}, nil
 }
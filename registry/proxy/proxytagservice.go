@@ -3,26 +3,50 @@ package proxy
 import (
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache"
 )
 
 // proxyTagService supports local and remote lookup of tags.
 type proxyTagService struct {
 	localTags  distribution.TagService
 	remoteTags distribution.TagService
+
+	// revalidator, if set, serves cached tags without querying the
+	// remote first, revalidating them in the background. The manifests
+	// of moved tags are cached through manifests.
+	revalidator    *tagRevalidator
+	repositoryName reference.Named
+	manifests      distribution.ManifestService
+
+	// negativeCache, if set, remembers the tags found missing from the
+	// remote, which are then looked up locally only.
+	negativeCache *cache.NegativeCache
 }
 
 var _ distribution.TagService = proxyTagService{}
 
 // Get attempts to get the most recent digest for the tag by checking the remote
 // tag service first and then caching it locally.  If the remote is unavailable
-// the local association is returned
+// the local association is returned. When revalidation is enabled, the local
+// association is returned first if there is one.
 func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
-	desc, err := pt.remoteTags.Get(ctx, tag)
+	if pt.revalidator != nil {
+		if desc, err := pt.localTags.Get(ctx, tag); err == nil {
+			pt.revalidator.revalidate(ctx, &pt, tag, desc)
+			return desc, nil
+		}
+	}
+
+	desc, err := pt.getRemote(ctx, tag)
 	if err == nil {
 		err := pt.localTags.Tag(ctx, tag, desc)
 		if err != nil {
 			return distribution.Descriptor{}, err
 		}
+		if pt.revalidator != nil {
+			pt.revalidator.markValidated(pt.repositoryName, tag)
+		}
 		return desc, nil
 	}
 
@@ -33,6 +57,25 @@ func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Des
 	return desc, nil
 }
 
+// getRemote gets the tag from the remote, unless it was recently found
+// missing from it.
+func (pt proxyTagService) getRemote(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	if pt.negativeCache == nil {
+		return pt.remoteTags.Get(ctx, tag)
+	}
+
+	key := negativeKey("tag", pt.repositoryName, tag)
+	if pt.negativeCache.Contains(key) {
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	}
+
+	desc, err := pt.remoteTags.Get(ctx, tag)
+	if isRemoteMiss(err) {
+		pt.negativeCache.Add(key)
+	}
+	return desc, err
+}
+
 func (pt proxyTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
 	return distribution.ErrUnsupported
 }
@@ -4,9 +4,15 @@ import (
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
 )
 
 type mockTagStore struct {
@@ -162,3 +168,189 @@ func TestGet(t *testing.T) {
 		t.Fatalf("Unexpected tags returned from All() : %v ", all)
 	}
 }
+
+// mockManifests records the manifests fetched through the manifest service
+// of a repository of the cache.
+type mockManifests struct {
+	distribution.ManifestService
+
+	sync.Mutex
+	fetched []digest.Digest
+}
+
+func (m *mockManifests) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.fetched = append(m.fetched, dgst)
+	return &schema2.DeserializedManifest{}, nil
+}
+
+func TestGetRevalidate(t *testing.T) {
+	cached := distribution.Descriptor{Digest: digest.FromBytes([]byte("cached"))}
+	moved := distribution.Descriptor{Digest: digest.FromBytes([]byte("moved"))}
+	proxyTags := testProxyTagService(
+		map[string]distribution.Descriptor{"latest": cached},
+		map[string]distribution.Descriptor{"latest": moved, "remote": moved})
+
+	movedTags := make(chan string, 1)
+	proxyTags.repositoryName, _ = reference.ParseNamed("foo/bar")
+	proxyTags.revalidator = newTagRevalidator(time.Hour, func(repo reference.Named, tag string, manifest distribution.Manifest) {
+		movedTags <- repo.Name() + ":" + tag
+	})
+	manifests := &mockManifests{}
+	proxyTags.manifests = manifests
+
+	ctx := context.Background()
+
+	// the cached tag is served, and revalidated in the background
+	d, err := proxyTags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != cached {
+		t.Fatalf("expected the cached tag to be served, got %v", d.Digest)
+	}
+
+	select {
+	case tag := <-movedTags:
+		if tag != "foo/bar:latest" {
+			t.Fatalf("unexpected moved tag: %s", tag)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tag move not notified")
+	}
+	if len(manifests.fetched) != 1 || manifests.fetched[0] != moved.Digest {
+		t.Fatalf("the manifest of the moved tag should be cached, fetched %v", manifests.fetched)
+	}
+	if d, _ := proxyTags.localTags.Get(ctx, "latest"); d != moved {
+		t.Fatalf("cached tag not moved: %v", d.Digest)
+	}
+
+	inProgress := func() int {
+		proxyTags.revalidator.mu.Lock()
+		defer proxyTags.revalidator.mu.Unlock()
+		return len(proxyTags.revalidator.inProgress)
+	}
+	for deadline := time.Now().Add(5 * time.Second); inProgress() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("revalidation did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// once validated, the tag is served from the cache until it gets old
+	proxyTags.remoteTags.Tag(ctx, "latest", distribution.Descriptor{Digest: digest.FromBytes([]byte("again"))})
+	for i := 0; i < 10; i++ {
+		if d, _ := proxyTags.Get(ctx, "latest"); d != moved {
+			t.Fatalf("expected the revalidated tag to be served, got %v", d.Digest)
+		}
+	}
+	if inProgress() != 0 {
+		t.Fatalf("fresh tag should not be revalidated")
+	}
+
+	// tags missing from the cache are looked up on the remote
+	if d, err := proxyTags.Get(ctx, "remote"); err != nil || d != moved {
+		t.Fatalf("unexpected tag from remote: %v, %v", d.Digest, err)
+	}
+	proxyTags.revalidator.mu.Lock()
+	_, validated := proxyTags.revalidator.validated["foo/bar:remote"]
+	proxyTags.revalidator.mu.Unlock()
+	if !validated {
+		t.Fatalf("tag from remote should be marked validated")
+	}
+}
+
+// scopeTagStore records the storage scope of the contexts tags are moved
+// with.
+type scopeTagStore struct {
+	distribution.TagService
+	scopes chan storagemiddleware.Scope
+}
+
+func (s scopeTagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	s.scopes <- storagemiddleware.GetScope(ctx)
+	return s.TagService.Tag(ctx, tag, desc)
+}
+
+// TestGetRevalidateScope checks that a tag revalidated in the background is
+// moved with the storage scope of the request it was served for.
+func TestGetRevalidateScope(t *testing.T) {
+	cached := distribution.Descriptor{Digest: digest.FromBytes([]byte("cached"))}
+	moved := distribution.Descriptor{Digest: digest.FromBytes([]byte("moved"))}
+	proxyTags := testProxyTagService(
+		map[string]distribution.Descriptor{"latest": cached},
+		map[string]distribution.Descriptor{"latest": moved})
+
+	scopes := make(chan storagemiddleware.Scope, 1)
+	proxyTags.localTags = scopeTagStore{TagService: proxyTags.localTags, scopes: scopes}
+	proxyTags.repositoryName, _ = reference.ParseNamed("foo/bar")
+	proxyTags.revalidator = newTagRevalidator(time.Hour, func(repo reference.Named, tag string, manifest distribution.Manifest) {})
+	proxyTags.manifests = &mockManifests{}
+
+	ctx := storagemiddleware.WithScope(context.Background(), storagemiddleware.Scope{
+		storagemiddleware.ScopeRepository: "foo/bar",
+		storagemiddleware.ScopeTenant:     "foo",
+	})
+	if _, err := proxyTags.Get(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case scope := <-scopes:
+		if scope[storagemiddleware.ScopeRepository] != "foo/bar" || scope[storagemiddleware.ScopeTenant] != "foo" {
+			t.Fatalf("unexpected scope of the moved tag: %v", scope)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tag not moved")
+	}
+}
+
+// countingTagStore counts the Get calls made to a tag service.
+type countingTagStore struct {
+	distribution.TagService
+	gets int
+}
+
+func (c *countingTagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	c.gets++
+	return c.TagService.Get(ctx, tag)
+}
+
+func TestGetNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	remote := &countingTagStore{TagService: &mockTagStore{mapping: make(map[string]distribution.Descriptor)}}
+	name, _ := reference.ParseNamed("foo/bar")
+	proxyTags := &proxyTagService{
+		localTags:      &mockTagStore{mapping: make(map[string]distribution.Descriptor)},
+		remoteTags:     remote,
+		repositoryName: name,
+		negativeCache:  cache.NewNegativeCache(50*time.Millisecond, 0),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := proxyTags.Get(ctx, "missing"); err == nil {
+			t.Fatalf("expected the tag to be unknown")
+		}
+	}
+	if remote.gets != 1 {
+		t.Fatalf("expected the remote to be queried once, got %d queries", remote.gets)
+	}
+
+	// the tag pushed to the remote is found once the miss expires
+	desc := distribution.Descriptor{Digest: digest.FromBytes([]byte("manifest"))}
+	remote.Tag(ctx, "missing", desc)
+	if _, err := proxyTags.Get(ctx, "missing"); err == nil {
+		t.Fatalf("expected the tag to be unknown until the miss expires")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	got, err := proxyTags.Get(ctx, "missing")
+	if err != nil || got.Digest != desc.Digest {
+		t.Fatalf("unexpected tag %v: %v", got, err)
+	}
+	if remote.gets != 2 {
+		t.Fatalf("expected the remote to be queried twice, got %d queries", remote.gets)
+	}
+}
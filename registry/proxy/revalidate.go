@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+)
+
+// TagMovedFunc is called when the revalidation of a tag of a pull through
+// cache finds it pointing at another manifest on the remote, once the
+// manifest is cached.
+type TagMovedFunc func(repo reference.Named, tag string, manifest distribution.Manifest)
+
+// tagRevalidator tracks when the cached tags were last validated against
+// the remote, so that they are served from the cache and revalidated in the
+// background once older than the configured age. Validation times are kept
+// in memory: after a restart, cached tags are served and revalidated on
+// their first request.
+type tagRevalidator struct {
+	age     time.Duration
+	onMoved TagMovedFunc
+
+	mu         sync.Mutex
+	validated  map[string]time.Time
+	inProgress map[string]bool
+}
+
+func newTagRevalidator(age time.Duration, onMoved TagMovedFunc) *tagRevalidator {
+	return &tagRevalidator{
+		age:        age,
+		onMoved:    onMoved,
+		validated:  make(map[string]time.Time),
+		inProgress: make(map[string]bool),
+	}
+}
+
+// markValidated records that the tag was just looked up on the remote.
+func (tr *tagRevalidator) markValidated(repo reference.Named, tag string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.validated[repo.Name()+":"+tag] = time.Now()
+}
+
+// revalidate starts the revalidation of the cached tag in the background,
+// unless it was validated within the configured age or is being
+// revalidated already. The revalidation carries the storage scope of the
+// request ctx serves.
+func (tr *tagRevalidator) revalidate(ctx context.Context, pt *proxyTagService, tag string, cached distribution.Descriptor) {
+	key := pt.repositoryName.Name() + ":" + tag
+
+	tr.mu.Lock()
+	if time.Since(tr.validated[key]) < tr.age || tr.inProgress[key] {
+		tr.mu.Unlock()
+		return
+	}
+	tr.inProgress[key] = true
+	tr.mu.Unlock()
+
+	// The request the tag is served for completes without waiting.
+	ctx = detachedContext(ctx)
+	go func() {
+		tr.revalidateTag(ctx, pt, tag, cached)
+
+		tr.mu.Lock()
+		// Failures are retried once the age elapses again, rather than on
+		// every request while the remote is unavailable.
+		tr.validated[key] = time.Now()
+		delete(tr.inProgress, key)
+		tr.mu.Unlock()
+	}()
+}
+
+func (tr *tagRevalidator) revalidateTag(ctx context.Context, pt *proxyTagService, tag string, cached distribution.Descriptor) {
+	name := pt.repositoryName.Name()
+
+	desc, err := pt.remoteTags.Get(ctx, tag)
+	if err != nil {
+		context.GetLogger(ctx).Warnf("error revalidating tag %s:%s: %v", name, tag, err)
+		return
+	}
+	if desc.Digest == cached.Digest {
+		return
+	}
+
+	// The manifest is cached before the tag is moved, so that the tag
+	// never points at a manifest missing from the cache.
+	manifest, err := pt.manifests.Get(ctx, desc.Digest)
+	if err != nil {
+		context.GetLogger(ctx).Errorf("error caching manifest %s@%s of moved tag %s: %v", name, desc.Digest, tag, err)
+		return
+	}
+	if err := pt.localTags.Tag(ctx, tag, desc); err != nil {
+		context.GetLogger(ctx).Errorf("error moving tag %s:%s to %s: %v", name, tag, desc.Digest, err)
+		return
+	}
+	context.GetLogger(ctx).Infof("tag %s:%s moved from %s to %s", name, tag, cached.Digest, desc.Digest)
+
+	if tr.onMoved != nil {
+		tr.onMoved(pt.repositoryName, tag, manifest)
+	}
+}
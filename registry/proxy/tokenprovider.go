@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/goamz/aws"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// tokenProviderTimeout bounds the requests token providers make to cloud
+// APIs.
+const tokenProviderTimeout = 30 * time.Second
+
+// tokenProviderFunc returns the credentials of the remote registry and when
+// they expire.
+type tokenProviderFunc func() (userpass, time.Time, error)
+
+// tokenProviders are the built-in token providers, by name. Each exchanges
+// the cloud credentials of its options for short-lived credentials of the
+// remote registry.
+var tokenProviders = map[string]func(remote *url.URL, options configuration.Parameters) (tokenProviderFunc, error){
+	"ecr": newECRTokenProvider,
+	"gcr": newGCRTokenProvider,
+	"acr": newACRTokenProvider,
+}
+
+// newTokenProvider returns the token provider configured for the remote
+// registry.
+func newTokenProvider(remoteURL string, config configuration.ProxyTokenProvider) (tokenProviderFunc, error) {
+	newProvider, ok := tokenProviders[config.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown proxy token provider %q", config.Name)
+	}
+
+	remote, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	return newProvider(remote, config.Options)
+}
+
+// option returns the string value of an option, or the empty string if it
+// is not set.
+func option(options configuration.Parameters, name string) string {
+	if v, ok := options[name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// ecrHostPattern matches the hosts of ECR registries, capturing the account
+// which is the registry ID, the region and the domain suffix of the region.
+var ecrHostPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// newECRTokenProvider returns a provider of the authorization tokens of an
+// ECR registry, obtained with GetAuthorizationToken. The region and
+// registry ID default to those of the remote URL. AWS credentials are read
+// from the accesskey and secretkey options or else, as for the s3 storage
+// driver, from the environment or the instance role.
+func newECRTokenProvider(remote *url.URL, options configuration.Parameters) (tokenProviderFunc, error) {
+	region := option(options, "region")
+	registryID := option(options, "registryid")
+	endpoint := option(options, "endpoint")
+	accessKey := option(options, "accesskey")
+	secretKey := option(options, "secretkey")
+
+	suffix := ""
+	if m := ecrHostPattern.FindStringSubmatch(remote.Host); m != nil {
+		if registryID == "" {
+			registryID = m[1]
+		}
+		if region == "" {
+			region = m[2]
+		}
+		suffix = m[3]
+	}
+	if region == "" {
+		return nil, fmt.Errorf("ecr token provider: region is required for remote %s", remote.Host)
+	}
+	if endpoint == "" {
+		endpoint = "https://api.ecr." + region + ".amazonaws.com" + suffix
+	}
+
+	body := []byte("{}")
+	if registryID != "" {
+		body, _ = json.Marshal(map[string][]string{"registryIds": {registryID}})
+	}
+	client := &http.Client{Timeout: tokenProviderTimeout}
+
+	return func() (userpass, time.Time, error) {
+		awsAuth, err := aws.GetAuth(accessKey, secretKey, "", time.Time{})
+		if err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("ecr token provider: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+		if err != nil {
+			return userpass{}, time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+		if token := awsAuth.Token(); token != "" {
+			req.Header.Set("X-Amz-Security-Token", token)
+		}
+		aws.NewV4Signer(awsAuth, "ecr", aws.Region{Name: region}).Sign(req)
+
+		var out struct {
+			AuthorizationData []struct {
+				AuthorizationToken string  `json:"authorizationToken"`
+				ExpiresAt          float64 `json:"expiresAt"`
+			} `json:"authorizationData"`
+		}
+		if err := doTokenRequest(client, req, &out); err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("ecr token provider: %v", err)
+		}
+		if len(out.AuthorizationData) == 0 {
+			return userpass{}, time.Time{}, fmt.Errorf("ecr token provider: no authorization data returned")
+		}
+
+		data := out.AuthorizationData[0]
+		token, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+		if err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("ecr token provider: invalid authorization token: %v", err)
+		}
+		parts := strings.SplitN(string(token), ":", 2)
+		if len(parts) != 2 {
+			return userpass{}, time.Time{}, fmt.Errorf("ecr token provider: invalid authorization token")
+		}
+
+		var expires time.Time
+		if data.ExpiresAt > 0 {
+			expires = time.Unix(int64(data.ExpiresAt), 0)
+		}
+		return userpass{username: parts[0], password: parts[1]}, expires, nil
+	}, nil
+}
+
+// gcrScope is the OAuth scope of the access tokens of GCR registries.
+const gcrScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// newGCRTokenProvider returns a provider of the access tokens of a GCR
+// registry. Tokens are obtained for the service account of the keyfile
+// option, as for the gcs storage driver, or else from the application
+// default credentials.
+func newGCRTokenProvider(remote *url.URL, options configuration.Parameters) (tokenProviderFunc, error) {
+	var ts oauth2.TokenSource
+	if keyfile := option(options, "keyfile"); keyfile != "" {
+		jsonKey, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			return nil, fmt.Errorf("gcr token provider: %v", err)
+		}
+		jwtConf, err := google.JWTConfigFromJSON(jsonKey, gcrScope)
+		if err != nil {
+			return nil, fmt.Errorf("gcr token provider: %v", err)
+		}
+		ts = jwtConf.TokenSource(context.Background())
+	} else {
+		var err error
+		ts, err = google.DefaultTokenSource(context.Background(), gcrScope)
+		if err != nil {
+			return nil, fmt.Errorf("gcr token provider: %v", err)
+		}
+	}
+	return gcrTokenProvider(ts), nil
+}
+
+// gcrTokenProvider returns the access tokens of ts as the credentials of a
+// GCR registry.
+func gcrTokenProvider(ts oauth2.TokenSource) tokenProviderFunc {
+	return func() (userpass, time.Time, error) {
+		token, err := ts.Token()
+		if err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("gcr token provider: %v", err)
+		}
+		return userpass{username: "oauth2accesstoken", password: token.AccessToken}, token.Expiry, nil
+	}
+}
+
+const (
+	// acrUsername is the username ACR registries accept refresh tokens
+	// with.
+	acrUsername = "00000000-0000-0000-0000-000000000000"
+
+	// acrResource is the resource of the Azure AD tokens exchanged for ACR
+	// refresh tokens.
+	acrResource = "https://management.azure.com/"
+
+	defaultACRAuthorityHost = "https://login.microsoftonline.com"
+)
+
+// newACRTokenProvider returns a provider of the refresh tokens of an ACR
+// registry. An Azure AD token of the service principal given by the
+// tenant, clientid and clientsecret options is exchanged for a refresh
+// token with the registry.
+func newACRTokenProvider(remote *url.URL, options configuration.Parameters) (tokenProviderFunc, error) {
+	tenant := option(options, "tenant")
+	clientID := option(options, "clientid")
+	clientSecret := option(options, "clientsecret")
+	authorityHost := option(options, "authorityhost")
+	if tenant == "" || clientID == "" || clientSecret == "" {
+		return nil, fmt.Errorf("acr token provider: tenant, clientid and clientsecret are required")
+	}
+	if authorityHost == "" {
+		authorityHost = defaultACRAuthorityHost
+	}
+	tokenURL := strings.TrimSuffix(authorityHost, "/") + "/" + url.QueryEscape(tenant) + "/oauth2/token"
+	exchangeURL := remote.Scheme + "://" + remote.Host + "/oauth2/exchange"
+	client := &http.Client{Timeout: tokenProviderTimeout}
+
+	return func() (userpass, time.Time, error) {
+		var aad struct {
+			AccessToken string `json:"access_token"`
+		}
+		err := postTokenForm(client, tokenURL, url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"resource":      {acrResource},
+		}, &aad)
+		if err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("acr token provider: error getting azure ad token: %v", err)
+		}
+
+		var exchange struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		err = postTokenForm(client, exchangeURL, url.Values{
+			"grant_type":   {"access_token"},
+			"service":      {remote.Host},
+			"tenant":       {tenant},
+			"access_token": {aad.AccessToken},
+		}, &exchange)
+		if err != nil {
+			return userpass{}, time.Time{}, fmt.Errorf("acr token provider: error exchanging azure ad token: %v", err)
+		}
+		if exchange.RefreshToken == "" {
+			return userpass{}, time.Time{}, fmt.Errorf("acr token provider: no refresh token returned")
+		}
+
+		return userpass{username: acrUsername, password: exchange.RefreshToken}, jwtExpiry(exchange.RefreshToken), nil
+	}, nil
+}
+
+// jwtExpiry returns the expiry of a JSON web token, read without verifying
+// the token, or the zero time if it has none.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiry == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Expiry, 0)
+}
+
+// postTokenForm posts the form to u, decoding the JSON response into v.
+func postTokenForm(client *http.Client, u string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doTokenRequest(client, req, v)
+}
+
+// doTokenRequest sends the request, decoding the JSON response into v. The
+// body of unsuccessful responses is reported in the error.
+func doTokenRequest(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	"golang.org/x/oauth2"
+)
+
+func TestECRTokenProvider(t *testing.T) {
+	expires := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" ||
+			!strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-west-2/ecr/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"__type":"AccessDeniedException"}`)
+			return
+		}
+
+		var in struct {
+			RegistryIDs []string `json:"registryIds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || len(in.RegistryIDs) != 1 || in.RegistryIDs[0] != "123456789012" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d.5}]}`,
+			base64.StdEncoding.EncodeToString([]byte("AWS:p4ssw0rd")), expires.Unix())
+	}))
+	defer server.Close()
+
+	options := configuration.Parameters{
+		"endpoint":  server.URL,
+		"accesskey": "AKID",
+		"secretkey": "secret",
+	}
+	fetch, err := newTokenProvider("https://123456789012.dkr.ecr.us-west-2.amazonaws.com", configuration.ProxyTokenProvider{Name: "ecr", Options: options})
+	if err != nil {
+		t.Fatalf("unexpected error creating token provider: %v", err)
+	}
+	creds, exp, err := fetch()
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	if creds.username != "AWS" || creds.password != "p4ssw0rd" || !exp.Equal(expires) {
+		t.Fatalf("unexpected credentials: %+v expiring at %v", creds, exp)
+	}
+
+	// the region cannot be derived from other remotes
+	if _, err := newTokenProvider("https://registry.example.com", configuration.ProxyTokenProvider{Name: "ecr", Options: options}); err == nil {
+		t.Fatalf("expected an error without a region")
+	}
+	options["region"] = "eu-west-1"
+	fetch, err = newTokenProvider("https://registry.example.com", configuration.ProxyTokenProvider{Name: "ecr", Options: options})
+	if err != nil {
+		t.Fatalf("unexpected error creating token provider: %v", err)
+	}
+	if _, _, err := fetch(); err == nil || !strings.Contains(err.Error(), "AccessDeniedException") {
+		t.Fatalf("expected the error of the ecr api, got %v", err)
+	}
+}
+
+func TestGCRTokenProvider(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	fetch := gcrTokenProvider(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ya29.t0k3n", Expiry: expires}))
+	creds, exp, err := fetch()
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	if creds.username != "oauth2accesstoken" || creds.password != "ya29.t0k3n" || !exp.Equal(expires) {
+		t.Fatalf("unexpected credentials: %+v expiring at %v", creds, exp)
+	}
+}
+
+func TestACRTokenProvider(t *testing.T) {
+	expires := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expires.Unix())))
+	refreshToken := "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/tenant/oauth2/token":
+			if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "client" ||
+				r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("resource") != acrResource {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"aad"}`)
+		case "/oauth2/exchange":
+			u, _ := url.Parse(server.URL)
+			if r.PostForm.Get("grant_type") != "access_token" || r.PostForm.Get("access_token") != "aad" ||
+				r.PostForm.Get("service") != u.Host || r.PostForm.Get("tenant") != "tenant" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"refresh_token":%q}`, refreshToken)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	options := configuration.Parameters{
+		"tenant":        "tenant",
+		"clientid":      "client",
+		"clientsecret":  "secret",
+		"authorityhost": server.URL,
+	}
+	fetch, err := newTokenProvider(server.URL, configuration.ProxyTokenProvider{Name: "acr", Options: options})
+	if err != nil {
+		t.Fatalf("unexpected error creating token provider: %v", err)
+	}
+	creds, exp, err := fetch()
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	if creds.username != acrUsername || creds.password != refreshToken || !exp.Equal(expires) {
+		t.Fatalf("unexpected credentials: %+v expiring at %v", creds, exp)
+	}
+
+	options["clientsecret"] = "wrong"
+	fetch, err = newTokenProvider(server.URL, configuration.ProxyTokenProvider{Name: "acr", Options: options})
+	if err != nil {
+		t.Fatalf("unexpected error creating token provider: %v", err)
+	}
+	if _, _, err := fetch(); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("expected the error of azure ad, got %v", err)
+	}
+
+	delete(options, "clientsecret")
+	if _, err := newTokenProvider(server.URL, configuration.ProxyTokenProvider{Name: "acr", Options: options}); err == nil {
+		t.Fatalf("expected an error without a client secret")
+	}
+	if _, err := newTokenProvider(server.URL, configuration.ProxyTokenProvider{Name: "quay"}); err == nil {
+		t.Fatalf("expected an error for an unknown token provider")
+	}
+}
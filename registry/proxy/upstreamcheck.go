@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/transport"
+)
+
+// upstreamCheckTimeout bounds each request of the upstream health check.
+const upstreamCheckTimeout = 10 * time.Second
+
+// UpstreamStatus is the result of the last health check of the remote
+// registry of a pull through cache.
+type UpstreamStatus struct {
+	// Reachable is true if the remote registry answered the last check.
+	Reachable bool
+
+	// Authorized is true if the remote registry accepted the configured
+	// credentials, or the anonymous token, at the last check.
+	Authorized bool
+
+	LastCheck time.Time
+	LastError string `json:",omitempty"`
+
+	// Failures counts the failed checks since the registry started.
+	Failures uint64
+}
+
+type upstreamStatusCollector struct {
+	sync.Mutex
+	status UpstreamStatus
+}
+
+func (usc *upstreamStatusCollector) update(reachable, authorized bool, err error) {
+	usc.Lock()
+	defer usc.Unlock()
+
+	usc.status.Reachable = reachable
+	usc.status.Authorized = authorized
+	usc.status.LastCheck = time.Now()
+	usc.status.LastError = ""
+	if err != nil {
+		usc.status.LastError = err.Error()
+		usc.status.Failures++
+	}
+}
+
+func (usc *upstreamStatusCollector) get() UpstreamStatus {
+	usc.Lock()
+	defer usc.Unlock()
+	return usc.status
+}
+
+// upstreamStatus holds the result of the last upstream health check. This is
+// kept globally and made available via expvar.
+var upstreamStatus = &upstreamStatusCollector{}
+
+// Check implements health.Checker. It fails if the remote registry cannot be
+// reached, or if a token cannot be obtained from it with the configured
+// credentials, so that the degraded state of the cache is reported before
+// pulls of uncached content start failing.
+func (pr *proxyingRegistry) Check() error {
+	client := &http.Client{Timeout: upstreamCheckTimeout}
+
+	// The unauthenticated ping also refreshes the challenges, in case the
+	// remote registry moved its token server.
+	resp, err := client.Get(pr.remoteURL + "/v2/")
+	if err != nil {
+		err = fmt.Errorf("upstream %s unreachable: %v", pr.remoteURL, err)
+		upstreamStatus.update(false, false, err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		err = fmt.Errorf("upstream %s returned %s", pr.remoteURL, resp.Status)
+		upstreamStatus.update(false, false, err)
+		return err
+	}
+	if err := pr.challengeManager.AddResponse(resp); err != nil {
+		upstreamStatus.update(true, false, err)
+		return err
+	}
+
+	client.Transport = transport.NewTransport(http.DefaultTransport,
+		auth.NewAuthorizer(pr.challengeManager,
+			auth.NewRegistryTokenHandler(http.DefaultTransport, pr.credentialStore, "catalog", "*"),
+			auth.NewBasicHandler(pr.credentialStore)))
+
+	resp, err = client.Get(pr.remoteURL + "/v2/")
+	if err != nil {
+		err = fmt.Errorf("error authorizing with upstream %s: %v", pr.remoteURL, err)
+		upstreamStatus.update(true, false, err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("upstream %s rejected the credentials: %s", pr.remoteURL, resp.Status)
+		upstreamStatus.update(true, false, err)
+		return err
+	}
+
+	upstreamStatus.update(true, true, nil)
+	return nil
+}
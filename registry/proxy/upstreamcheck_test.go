@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/client/auth"
+)
+
+func TestUpstreamCheck(t *testing.T) {
+	upstreamStatus = &upstreamStatusCollector{}
+
+	tokenValid := true
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if !tokenValid {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token": "t0k3n"}`)
+		case "/v2/":
+			if r.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	pr := &proxyingRegistry{
+		remoteURL:        server.URL,
+		credentialStore:  credentials{},
+		challengeManager: auth.NewSimpleChallengeManager(),
+	}
+
+	if err := pr.Check(); err != nil {
+		t.Fatalf("unexpected error checking upstream: %v", err)
+	}
+	if status := upstreamStatus.get(); !status.Reachable || !status.Authorized || status.LastError != "" {
+		t.Fatalf("unexpected status: %#v", status)
+	}
+
+	tokenValid = false
+	if err := pr.Check(); err == nil {
+		t.Fatalf("expected an error when no token is issued")
+	}
+	if status := upstreamStatus.get(); !status.Reachable || status.Authorized || status.Failures != 1 {
+		t.Fatalf("unexpected status: %#v", status)
+	}
+
+	server.Close()
+	if err := pr.Check(); err == nil {
+		t.Fatalf("expected an error when the upstream is down")
+	}
+	if status := upstreamStatus.get(); status.Reachable || status.Failures != 2 {
+		t.Fatalf("unexpected status: %#v", status)
+	}
+}
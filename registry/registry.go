@@ -28,13 +28,19 @@ import (
 var Cmd = &cobra.Command{
 	Use:   "registry <config>",
 	Short: "registry stores and distributes Docker images",
-	Long:  "registry stores and distributes Docker images.",
+	Long: "registry stores and distributes Docker images.\n\n" +
+		"registry config validate <config> checks a configuration, and\n" +
+		"registry drivers [driver...] lists the storage drivers and their parameters.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if showVersion {
 			version.PrintVersion()
 			return
 		}
 
+		if runCommand(args) {
+			return
+		}
+
 		// setup context
 		ctx := context.WithVersion(context.Background(), version.Version)
 
@@ -100,9 +106,11 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	handler = health.Handler(handler)
 	handler = panicHandler(handler)
 	handler = gorhandlers.CombinedLoggingHandler(os.Stdout, handler)
+	handler = handlers.WithResponseController(handler)
 
 	server := &http.Server{
-		Handler: handler,
+		Handler:           handler,
+		ReadHeaderTimeout: config.HTTP.Timeouts.ReadHeader,
 	}
 
 	return &Registry{
@@ -112,10 +120,19 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	}, nil
 }
 
-// ListenAndServe runs the registry's HTTP server.
+// ListenAndServe runs the registry's HTTP server, and the admin gRPC service
+// if configured.
 func (registry *Registry) ListenAndServe() error {
 	config := registry.config
 
+	if config.HTTP.Admin.GRPC.Addr != "" {
+		go func() {
+			if err := registry.app.ListenAndServeAdminRPC(); err != nil {
+				log.Fatalf("error serving the admin gRPC service: %v", err)
+			}
+		}()
+	}
+
 	ln, err := listener.NewListener(config.HTTP.Net, config.HTTP.Addr)
 	if err != nil {
 		return err
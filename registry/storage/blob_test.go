@@ -14,6 +14,7 @@ import (
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache/memory"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 )
@@ -502,6 +503,71 @@ func TestBlobMount(t *testing.T) {
 	}
 }
 
+// TestBlobUploadDigestAlgorithms ensures that uploads committed with a
+// non-canonical digest are only accepted when the algorithm is configured and
+// that the blob is then available under both digests.
+func TestBlobUploadDigestAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.ParseNamed("foo/bar")
+	content := []byte("digest algorithm agility")
+	canonical := digest.FromBytes(content)
+	alias := digest.SHA512.FromBytes(content)
+
+	for _, testcase := range []struct {
+		options  []RegistryOption
+		accepted bool
+	}{
+		{
+			// all available algorithms are accepted by default
+			accepted: true,
+		},
+		{
+			options:  []RegistryOption{DigestAlgorithms(digest.SHA512)},
+			accepted: true,
+		},
+		{
+			options:  []RegistryOption{DigestAlgorithms(digest.SHA384)},
+			accepted: false,
+		},
+	} {
+		registry, err := NewRegistry(ctx, inmemory.New(), testcase.options...)
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		repository, err := registry.Repository(ctx, imageName)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+		bs := repository.Blobs(ctx)
+
+		_, err = addBlob(ctx, bs, distribution.Descriptor{Digest: alias, Size: int64(len(content))}, bytes.NewReader(content))
+		if !testcase.accepted {
+			if _, ok := err.(distribution.ErrBlobInvalidDigest); !ok {
+				t.Fatalf("expected invalid digest error, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error committing upload with %v: %v", alias, err)
+		}
+
+		for _, dgst := range []digest.Digest{canonical, alias} {
+			desc, err := bs.Stat(ctx, dgst)
+			if err != nil {
+				t.Fatalf("unexpected error stating %v: %v", dgst, err)
+			}
+
+			if desc.Digest != canonical {
+				t.Fatalf("unexpected digest for %v: %v != %v", dgst, desc.Digest, canonical)
+			}
+		}
+	}
+
+	if _, err := NewRegistry(ctx, inmemory.New(), DigestAlgorithms(digest.Algorithm("blake3"))); err == nil {
+		t.Fatalf("expected error configuring unavailable digest algorithm")
+	}
+}
+
 // TestLayerUploadZeroLength uploads zero-length
 func TestLayerUploadZeroLength(t *testing.T) {
 	ctx := context.Background()
@@ -520,6 +586,84 @@ func TestLayerUploadZeroLength(t *testing.T) {
 	simpleUpload(t, bs, []byte{}, digest.DigestSha256EmptyTar)
 }
 
+// batchStatDriver counts the Stat and StatMany calls made to a driver.
+type batchStatDriver struct {
+	storagedriver.StorageDriver
+	stats, batches int
+}
+
+func (d *batchStatDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	d.stats++
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+func (d *batchStatDriver) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	d.batches++
+	return storagedriver.StatMany(ctx, d.StorageDriver, paths)
+}
+
+// TestBlobStatMany checks that describing many blobs of a repository at once
+// matches describing them one by one, with a single call to the driver.
+func TestBlobStatMany(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.ParseNamed("foo/bar")
+	otherName, _ := reference.ParseNamed("foo/other")
+	driver := &batchStatDriver{StorageDriver: inmemory.New()}
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	other, err := registry.Repository(ctx, otherName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	var dgsts []digest.Digest
+	for i := 0; i < 3; i++ {
+		// The last blob is only linked in another repository.
+		target := bs
+		if i == 2 {
+			target = other.Blobs(ctx)
+		}
+		desc, err := target.Put(ctx, "application/octet-stream", []byte(fmt.Sprintf("blob %d", i)))
+		if err != nil {
+			t.Fatalf("error adding blob %d: %v", i, err)
+		}
+		dgsts = append(dgsts, desc.Digest)
+	}
+	dgsts = append(dgsts, digest.FromBytes([]byte("unknown")))
+
+	batchStatter, ok := bs.(distribution.BlobBatchStatter)
+	if !ok {
+		t.Fatalf("blob store does not implement BlobBatchStatter")
+	}
+
+	driver.stats, driver.batches = 0, 0
+	descs, errs := batchStatter.StatMany(ctx, dgsts)
+	if driver.stats != 0 || driver.batches != 1 {
+		t.Fatalf("unexpected driver calls: %d stats, %d batches", driver.stats, driver.batches)
+	}
+
+	for i, dgst := range dgsts {
+		desc, err := bs.Stat(ctx, dgst)
+		if err != errs[i] {
+			t.Fatalf("unexpected error describing %s: %v != %v", dgst, errs[i], err)
+		}
+		if desc != descs[i] {
+			t.Fatalf("unexpected descriptor for %s: %v != %v", dgst, descs[i], desc)
+		}
+	}
+
+	if errs[0] != nil || errs[1] != nil || errs[2] != distribution.ErrBlobUnknown || errs[3] != distribution.ErrBlobUnknown {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
 func simpleUpload(t *testing.T, bs distribution.BlobIngester, blob []byte, expectedDigest digest.Digest) {
 	ctx := context.Background()
 	wr, err := bs.Create(ctx)
@@ -19,7 +19,7 @@ const blobCacheControlMaxAge = 365 * 24 * time.Hour
 type blobServer struct {
 	driver   driver.StorageDriver
 	statter  distribution.BlobStatter
-	pathFn   func(dgst digest.Digest) (string, error)
+	pathFn   func(ctx context.Context, dgst digest.Digest) (string, error)
 	redirect bool // allows disabling URLFor redirects
 }
 
@@ -29,13 +29,16 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		return err
 	}
 
-	path, err := bs.pathFn(desc.Digest)
+	path, err := bs.pathFn(ctx, desc.Digest)
 	if err != nil {
 		return err
 	}
 
 	if bs.redirect {
-		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{"method": r.Method})
+		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{
+			"method": r.Method,
+			"host":   context.RequestHost(r),
+		})
 		switch err.(type) {
 		case nil:
 			// Redirect to storage URL.
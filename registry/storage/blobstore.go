@@ -14,13 +14,15 @@ import (
 type blobStore struct {
 	driver  driver.StorageDriver
 	statter distribution.BlobStatter
+	layout  blobPathLayout
+	journal *journal
 }
 
 var _ distribution.BlobProvider = &blobStore{}
 
 // Get implements the BlobReadService.Get call.
 func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
-	bp, err := bs.path(dgst)
+	bp, err := bs.locate(ctx, dgst)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +46,7 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (distribution
 		return nil, err
 	}
 
-	path, err := bs.path(desc.Digest)
+	path, err := bs.locate(ctx, desc.Digest)
 	if err != nil {
 		return nil, err
 	}
@@ -88,10 +90,7 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 // path returns the canonical path for the blob identified by digest. The blob
 // may or may not exist.
 func (bs *blobStore) path(dgst digest.Digest) (string, error) {
-	bp, err := pathFor(blobDataPathSpec{
-		digest: dgst,
-	})
-
+	bp, err := bs.layout.path(dgst)
 	if err != nil {
 		return "", err
 	}
@@ -99,12 +98,32 @@ func (bs *blobStore) path(dgst digest.Digest) (string, error) {
 	return bp, nil
 }
 
+// locate returns the path the blob identified by digest is read from. Unless
+// the blob store is being migrated between layouts, it is the canonical path.
+// Otherwise, it is the path in the first layout holding the blob, or the
+// canonical path if none does.
+func (bs *blobStore) locate(ctx context.Context, dgst digest.Digest) (string, error) {
+	if len(bs.layout.compatible) == 0 {
+		return bs.path(dgst)
+	}
+
+	bp, _, err := bs.layout.stat(ctx, bs.driver, dgst)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return bp, nil
+	}
+	return bp, err
+}
+
 // link links the path to the provided digest by writing the digest into the
 // target file. Caller must ensure that the blob actually exists.
 func (bs *blobStore) link(ctx context.Context, path string, dgst digest.Digest) error {
 	// The contents of the "link" file are the exact string contents of the
 	// digest, which is specified in that package.
-	return bs.driver.PutContent(ctx, path, []byte(dgst))
+	if err := bs.driver.PutContent(ctx, path, []byte(dgst)); err != nil {
+		return err
+	}
+
+	return bs.journal.record(ctx, JournalActionLink, path, dgst)
 }
 
 // readlink returns the linked digest at path.
@@ -129,11 +148,12 @@ func (bs *blobStore) resolve(ctx context.Context, path string) (string, error) {
 		return "", err
 	}
 
-	return bs.path(dgst)
+	return bs.locate(ctx, dgst)
 }
 
 type blobStatter struct {
 	driver driver.StorageDriver
+	layout blobPathLayout
 }
 
 var _ distribution.BlobDescriptorService = &blobStatter{}
@@ -142,15 +162,45 @@ var _ distribution.BlobDescriptorService = &blobStatter{}
 // in the main blob store. If this method returns successfully, there is
 // strong guarantee that the blob exists and is available.
 func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
-	path, err := pathFor(blobDataPathSpec{
-		digest: dgst,
-	})
-
-	if err != nil {
+	path, fi, err := bs.layout.stat(ctx, bs.driver, dgst)
+	if path == "" {
 		return distribution.Descriptor{}, err
 	}
 
-	fi, err := bs.driver.Stat(ctx, path)
+	return bs.describe(ctx, dgst, path, fi, err)
+}
+
+// StatMany implements BlobBatchStatter.StatMany, retrieving the data of all
+// blobs with a single call to the storage driver.
+func (bs *blobStatter) StatMany(ctx context.Context, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	descs := make([]distribution.Descriptor, len(dgsts))
+	errs := make([]error, len(dgsts))
+
+	paths := make([]string, len(dgsts))
+	for i, dgst := range dgsts {
+		paths[i], errs[i] = bs.layout.path(dgst)
+	}
+
+	fis, statErrs := driver.StatMany(ctx, bs.driver, paths)
+	for i, dgst := range dgsts {
+		if errs[i] != nil {
+			continue
+		}
+		descs[i], errs[i] = bs.describe(ctx, dgst, paths[i], fis[i], statErrs[i])
+
+		// Blobs not yet migrated to the current layout are looked up in
+		// the compatible layouts one by one.
+		if errs[i] == distribution.ErrBlobUnknown && len(bs.layout.compatible) > 0 {
+			descs[i], errs[i] = bs.Stat(ctx, dgst)
+		}
+	}
+
+	return descs, errs
+}
+
+// describe returns the descriptor for the blob dgst from the result of
+// statting its data at path.
+func (bs *blobStatter) describe(ctx context.Context, dgst digest.Digest, path string, fi driver.FileInfo, err error) (distribution.Descriptor, error) {
 	if err != nil {
 		switch err := err.(type) {
 		case driver.PathNotFoundError:
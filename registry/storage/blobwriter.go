@@ -148,6 +148,20 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 		}
 	}
 
+	if err := desc.Digest.Validate(); err != nil {
+		return distribution.Descriptor{}, distribution.ErrBlobInvalidDigest{
+			Digest: desc.Digest,
+			Reason: err,
+		}
+	}
+
+	if !bw.blobStore.registry.acceptsAlgorithm(desc.Digest.Algorithm()) {
+		return distribution.Descriptor{}, distribution.ErrBlobInvalidDigest{
+			Digest: desc.Digest,
+			Reason: fmt.Errorf("digest algorithm %q not accepted", desc.Digest.Algorithm()),
+		}
+	}
+
 	// Stat the on disk file
 	if fi, err := bw.fileWriter.driver.Stat(ctx, bw.path); err != nil {
 		switch err := err.(type) {
@@ -267,10 +281,7 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 // identified by dgst. The layer should be validated before commencing the
 // move.
 func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor) error {
-	blobPath, err := pathFor(blobDataPathSpec{
-		digest: desc.Digest,
-	})
-
+	blobPath, err := bw.blobStore.path(desc.Digest)
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 )
 
 // BlobDescriptorCacheProvider provides repository scoped
@@ -16,6 +18,14 @@ type BlobDescriptorCacheProvider interface {
 	RepositoryScoped(repo string) (distribution.BlobDescriptorService, error)
 }
 
+// RepositoryMediaTypeSetter is implemented by the repository scoped
+// BlobDescriptorService caches able to override the media type of a blob
+// within their repository only, leaving the descriptor of the global cache
+// untouched. ErrBlobUnknown is returned if the blob is not cached.
+type RepositoryMediaTypeSetter interface {
+	SetRepositoryMediaType(ctx context.Context, dgst digest.Digest, mediaType string) error
+}
+
 // ValidateDescriptor provides a helper function to ensure that caches have
 // common criteria for admitting descriptors.
 func ValidateDescriptor(desc distribution.Descriptor) error {
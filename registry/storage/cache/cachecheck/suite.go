@@ -18,6 +18,7 @@ func CheckBlobDescriptorCache(t *testing.T, provider cache.BlobDescriptorCachePr
 	checkBlobDescriptorCacheEmptyRepository(t, ctx, provider)
 	checkBlobDescriptorCacheSetAndRead(t, ctx, provider)
 	checkBlobDescriptorCacheClear(t, ctx, provider)
+	checkBlobDescriptorCacheRepositoryMediaType(t, ctx, provider)
 }
 
 func checkBlobDescriptorCacheEmptyRepository(t *testing.T, ctx context.Context, provider cache.BlobDescriptorCacheProvider) {
@@ -177,3 +178,62 @@ func checkBlobDescriptorCacheClear(t *testing.T, ctx context.Context, provider c
 		t.Fatalf("expected error statting deleted blob: %v", err)
 	}
 }
+
+func checkBlobDescriptorCacheRepositoryMediaType(t *testing.T, ctx context.Context, provider cache.BlobDescriptorCacheProvider) {
+	expected := distribution.Descriptor{
+		Digest:    "sha256:fed1111111111111111111111111111111111111111111111111111111111111",
+		Size:      10,
+		MediaType: "application/octet-stream"}
+
+	scoped, err := provider.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	setter, ok := scoped.(cache.RepositoryMediaTypeSetter)
+	if !ok {
+		return
+	}
+
+	if err := setter.SetRepositoryMediaType(ctx, expected.Digest, "application/json"); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error setting the media type of an unknown blob: %v", err)
+	}
+
+	if err := provider.SetDescriptor(ctx, expected.Digest, expected); err != nil {
+		t.Fatalf("error setting descriptor: %v", err)
+	}
+	if err := setter.SetRepositoryMediaType(ctx, expected.Digest, "application/json"); err != nil {
+		t.Fatalf("unexpected error setting repository media type: %v", err)
+	}
+
+	desc, err := scoped.Stat(ctx, expected.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting descriptor: %v", err)
+	}
+	if desc.MediaType != "application/json" {
+		t.Fatalf("unexpected media type in repository: %v", desc.MediaType)
+	}
+
+	// neither the global cache nor other repositories see the media type.
+	desc, err = provider.Stat(ctx, expected.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting global descriptor: %v", err)
+	}
+	if desc != expected {
+		t.Fatalf("unexpected descriptor: %#v != %#v", desc, expected)
+	}
+
+	other, err := provider.RepositoryScoped("foo/other")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if err := other.SetDescriptor(ctx, expected.Digest, expected); err != nil {
+		t.Fatalf("error setting descriptor: %v", err)
+	}
+	desc, err = other.Stat(ctx, expected.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting descriptor: %v", err)
+	}
+	if desc != expected {
+		t.Fatalf("unexpected descriptor: %#v != %#v", desc, expected)
+	}
+}
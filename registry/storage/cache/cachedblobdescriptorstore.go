@@ -80,6 +80,66 @@ fallback:
 
 }
 
+// StatMany implements BlobBatchStatter.StatMany, describing the blobs missing
+// from the cache with a single call to the backend if it supports it.
+func (cbds *cachedBlobStatter) StatMany(ctx context.Context, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	descs := make([]distribution.Descriptor, len(dgsts))
+	errs := make([]error, len(dgsts))
+
+	// Cache misses are passed on to the backend, remembering their index in
+	// dgsts.
+	var misses []digest.Digest
+	var indexes []int
+	for i, dgst := range dgsts {
+		desc, err := cbds.cache.Stat(ctx, dgst)
+		if err == nil {
+			if cbds.tracker != nil {
+				cbds.tracker.Hit()
+			}
+			descs[i] = desc
+			continue
+		}
+
+		if err != distribution.ErrBlobUnknown {
+			context.GetLogger(ctx).Errorf("error retrieving descriptor from cache: %v", err)
+		}
+		if cbds.tracker != nil {
+			cbds.tracker.Miss()
+		}
+		misses = append(misses, dgst)
+		indexes = append(indexes, i)
+	}
+
+	if len(misses) == 0 {
+		return descs, errs
+	}
+
+	var missDescs []distribution.Descriptor
+	var missErrs []error
+	if bs, ok := cbds.backend.(distribution.BlobBatchStatter); ok {
+		missDescs, missErrs = bs.StatMany(ctx, misses)
+	} else {
+		missDescs = make([]distribution.Descriptor, len(misses))
+		missErrs = make([]error, len(misses))
+		for j, dgst := range misses {
+			missDescs[j], missErrs[j] = cbds.backend.Stat(ctx, dgst)
+		}
+	}
+
+	for j, i := range indexes {
+		descs[i], errs[i] = missDescs[j], missErrs[j]
+		if errs[i] != nil {
+			continue
+		}
+
+		if err := cbds.cache.SetDescriptor(ctx, dgsts[i], descs[i]); err != nil {
+			context.GetLogger(ctx).Errorf("error adding descriptor %v to cache: %v", descs[i].Digest, err)
+		}
+	}
+
+	return descs, errs
+}
+
 func (cbds *cachedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
 	err := cbds.cache.Clear(ctx, dgst)
 	if err != nil {
@@ -68,50 +68,73 @@ func (imbdcp *inMemoryBlobDescriptorCacheProvider) SetDescriptor(ctx context.Con
 }
 
 // repositoryScopedInMemoryBlobDescriptorCache provides the request scoped
-// repository cache. Instances are not thread-safe but the delegated
-// operations are.
+// repository cache. The repository map is allocated lazily, under the lock of
+// the parent, so that instances may be used by concurrent goroutines, such as
+// those storing blobs fetched by a pull through cache.
 type repositoryScopedInMemoryBlobDescriptorCache struct {
 	repo       string
 	parent     *inMemoryBlobDescriptorCacheProvider // allows lazy allocation of repo's map
 	repository *mapBlobDescriptorCache
 }
 
-func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+// repositoryCache returns the map of the repository, allocating it if create
+// is true, and nil otherwise if it does not exist.
+func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) repositoryCache(create bool) *mapBlobDescriptorCache {
+	rsimbdcp.parent.mu.Lock()
+	defer rsimbdcp.parent.mu.Unlock()
+
 	if rsimbdcp.repository == nil {
+		// have to read back value since we may have allocated elsewhere.
+		rsimbdcp.repository = rsimbdcp.parent.repositories[rsimbdcp.repo]
+		if rsimbdcp.repository == nil && create {
+			rsimbdcp.repository = newMapBlobDescriptorCache()
+			rsimbdcp.parent.repositories[rsimbdcp.repo] = rsimbdcp.repository
+		}
+	}
+
+	return rsimbdcp.repository
+}
+
+func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	repository := rsimbdcp.repositoryCache(false)
+	if repository == nil {
 		return distribution.Descriptor{}, distribution.ErrBlobUnknown
 	}
 
-	return rsimbdcp.repository.Stat(ctx, dgst)
+	return repository.Stat(ctx, dgst)
 }
 
 func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) Clear(ctx context.Context, dgst digest.Digest) error {
-	if rsimbdcp.repository == nil {
+	repository := rsimbdcp.repositoryCache(false)
+	if repository == nil {
 		return distribution.ErrBlobUnknown
 	}
 
-	return rsimbdcp.repository.Clear(ctx, dgst)
+	return repository.Clear(ctx, dgst)
 }
 
 func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
-	if rsimbdcp.repository == nil {
-		// allocate map since we are setting it now.
-		rsimbdcp.parent.mu.Lock()
-		var ok bool
-		// have to read back value since we may have allocated elsewhere.
-		rsimbdcp.repository, ok = rsimbdcp.parent.repositories[rsimbdcp.repo]
-		if !ok {
-			rsimbdcp.repository = newMapBlobDescriptorCache()
-			rsimbdcp.parent.repositories[rsimbdcp.repo] = rsimbdcp.repository
-		}
-
-		rsimbdcp.parent.mu.Unlock()
+	// allocate map since we are setting it now.
+	if err := rsimbdcp.repositoryCache(true).SetDescriptor(ctx, dgst, desc); err != nil {
+		return err
 	}
 
-	if err := rsimbdcp.repository.SetDescriptor(ctx, dgst, desc); err != nil {
+	return rsimbdcp.parent.SetDescriptor(ctx, dgst, desc)
+}
+
+// SetRepositoryMediaType overrides the media type of the blob in the map of
+// the repository only.
+func (rsimbdcp *repositoryScopedInMemoryBlobDescriptorCache) SetRepositoryMediaType(ctx context.Context, dgst digest.Digest, mediaType string) error {
+	desc, err := rsimbdcp.Stat(ctx, dgst)
+	if err == distribution.ErrBlobUnknown {
+		desc, err = rsimbdcp.parent.Stat(ctx, dgst)
+	}
+	if err != nil {
 		return err
 	}
 
-	return rsimbdcp.parent.SetDescriptor(ctx, dgst, desc)
+	desc.MediaType = mediaType
+	return rsimbdcp.repositoryCache(true).SetDescriptor(ctx, dgst, desc)
 }
 
 // mapBlobDescriptorCache provides a simple map-based implementation of the
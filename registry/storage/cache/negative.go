@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+)
+
+// DefaultNegativeCacheSize is the number of misses remembered by a
+// NegativeCache if no size is given.
+const DefaultNegativeCacheSize = 10000
+
+// NegativeCache remembers the keys found missing from a backend for a limited
+// time, so that repeated lookups of missing content, such as of the tags a
+// misconfigured deployment keeps pulling, do not reach the backend every
+// time. Keys are removed once the content is added through this instance;
+// content added through other instances is only found once the miss expires.
+type NegativeCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// NewNegativeCache returns a NegativeCache remembering misses for ttl. At
+// most size misses are remembered.
+func NewNegativeCache(ttl time.Duration, size int) *NegativeCache {
+	if size <= 0 {
+		size = DefaultNegativeCacheSize
+	}
+
+	return &NegativeCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Contains reports whether key was found missing within the ttl.
+func (nc *NegativeCache) Contains(key string) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	expires, ok := nc.entries[key]
+	if !ok {
+		return false
+	}
+	if !time.Now().Before(expires) {
+		delete(nc.entries, key)
+		return false
+	}
+	return true
+}
+
+// Add records that key was found missing, evicting expired misses, or
+// arbitrary ones if none expired, if the cache is full.
+func (nc *NegativeCache) Add(key string) {
+	now := time.Now()
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if _, ok := nc.entries[key]; !ok && len(nc.entries) >= nc.size {
+		for k, expires := range nc.entries {
+			if !now.Before(expires) {
+				delete(nc.entries, k)
+			}
+		}
+		for k := range nc.entries {
+			if len(nc.entries) < nc.size {
+				break
+			}
+			delete(nc.entries, k)
+		}
+	}
+
+	nc.entries[key] = now.Add(nc.ttl)
+}
+
+// Remove forgets that key was found missing.
+func (nc *NegativeCache) Remove(key string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	delete(nc.entries, key)
+}
+
+type negativeBlobStatter struct {
+	cache   *NegativeCache
+	scope   string
+	backend distribution.BlobDescriptorService
+}
+
+// NewNegativeBlobStatter creates a new statter which reports the blobs the
+// backend recently did not know as unknown without statting them again.
+// Misses are keyed by scope, such as the name of a repository, and the
+// digest. Setting the descriptor of a blob forgets its miss.
+func NewNegativeBlobStatter(cache *NegativeCache, scope string, backend distribution.BlobDescriptorService) distribution.BlobDescriptorService {
+	return &negativeBlobStatter{
+		cache:   cache,
+		scope:   scope,
+		backend: backend,
+	}
+}
+
+func (nbs *negativeBlobStatter) key(dgst digest.Digest) string {
+	return nbs.scope + "@" + dgst.String()
+}
+
+func (nbs *negativeBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	key := nbs.key(dgst)
+	if nbs.cache.Contains(key) {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+
+	desc, err := nbs.backend.Stat(ctx, dgst)
+	if err == distribution.ErrBlobUnknown {
+		nbs.cache.Add(key)
+	}
+	return desc, err
+}
+
+// StatMany implements BlobBatchStatter.StatMany, statting the blobs not
+// recently found missing with the backend.
+func (nbs *negativeBlobStatter) StatMany(ctx context.Context, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	descs := make([]distribution.Descriptor, len(dgsts))
+	errs := make([]error, len(dgsts))
+
+	var lookups []digest.Digest
+	var indexes []int
+	for i, dgst := range dgsts {
+		if nbs.cache.Contains(nbs.key(dgst)) {
+			errs[i] = distribution.ErrBlobUnknown
+			continue
+		}
+		lookups = append(lookups, dgst)
+		indexes = append(indexes, i)
+	}
+
+	if len(lookups) == 0 {
+		return descs, errs
+	}
+
+	var backendDescs []distribution.Descriptor
+	var backendErrs []error
+	if batch, ok := nbs.backend.(distribution.BlobBatchStatter); ok {
+		backendDescs, backendErrs = batch.StatMany(ctx, lookups)
+	} else {
+		backendDescs = make([]distribution.Descriptor, len(lookups))
+		backendErrs = make([]error, len(lookups))
+		for j, dgst := range lookups {
+			backendDescs[j], backendErrs[j] = nbs.backend.Stat(ctx, dgst)
+		}
+	}
+
+	for j, i := range indexes {
+		descs[i], errs[i] = backendDescs[j], backendErrs[j]
+		if errs[i] == distribution.ErrBlobUnknown {
+			nbs.cache.Add(nbs.key(lookups[j]))
+		}
+	}
+
+	return descs, errs
+}
+
+func (nbs *negativeBlobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
+	nbs.cache.Remove(nbs.key(dgst))
+	return nbs.backend.Clear(ctx, dgst)
+}
+
+func (nbs *negativeBlobStatter) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	nbs.cache.Remove(nbs.key(dgst))
+	return nbs.backend.SetDescriptor(ctx, dgst, desc)
+}
@@ -259,6 +259,29 @@ func (rsrbds *repositoryScopedRedisBlobDescriptorService) setDescriptor(ctx cont
 	return nil
 }
 
+// SetRepositoryMediaType overrides the media type of the blob for the
+// repository only. The blob must be known to the global cache, which the
+// repository scoped descriptors are read from.
+func (rsrbds *repositoryScopedRedisBlobDescriptorService) SetRepositoryMediaType(ctx context.Context, dgst digest.Digest, mediaType string) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	conn := rsrbds.upstream.pool.Get()
+	defer conn.Close()
+
+	if _, err := rsrbds.upstream.stat(ctx, conn, dgst); err != nil {
+		return err
+	}
+
+	if _, err := conn.Do("SADD", rsrbds.repositoryBlobSetKey(rsrbds.repo), dgst); err != nil {
+		return err
+	}
+
+	_, err := conn.Do("HSET", rsrbds.blobDescriptorHashKey(dgst), "mediatype", mediaType)
+	return err
+}
+
 func (rsrbds *repositoryScopedRedisBlobDescriptorService) blobDescriptorHashKey(dgst digest.Digest) string {
 	return "repository::" + rsrbds.repo + "::blobs::" + dgst.String()
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/docker/distribution/context"
@@ -17,7 +18,8 @@ var ErrFinishedWalk = errors.New("finished walk")
 
 // Returns a list, or partial list, of repositories in the registry.
 // Because it's a quite expensive operation, it should only be used when building up
-// an initial set of repositories.
+// an initial set of repositories. With a catalog index, the repositories are
+// listed from the index instead, once it was built.
 func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, errVal error) {
 	var foundRepos []string
 
@@ -25,26 +27,21 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 		return 0, errors.New("no space in slice")
 	}
 
-	root, err := pathFor(repositoriesRootPathSpec{})
-	if err != nil {
-		return 0, err
+	if reg.catalog != nil {
+		names, err := reg.catalog.load(ctx)
+		switch err.(type) {
+		case nil:
+			return pageRepositories(names, repos, last)
+		case driver.PathNotFoundError:
+			// The index was not built yet.
+		default:
+			return 0, err
+		}
 	}
 
-	err = Walk(ctx, reg.blobStore.driver, root, func(fileInfo driver.FileInfo) error {
-		filePath := fileInfo.Path()
-
-		// lop the base path off
-		repoPath := filePath[len(root)+1:]
-
-		_, file := path.Split(repoPath)
-		if file == "_layers" {
-			repoPath = strings.TrimSuffix(repoPath, "/_layers")
-			if repoPath > last {
-				foundRepos = append(foundRepos, repoPath)
-			}
-			return ErrSkipDir
-		} else if strings.HasPrefix(file, "_") {
-			return ErrSkipDir
+	err := walkRepositories(ctx, reg.blobStore.driver, func(name string) error {
+		if name <= last {
+			return nil
 		}
 
 		// if we've filled our array, no need to walk any further
@@ -52,15 +49,68 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 			return ErrFinishedWalk
 		}
 
+		foundRepos = append(foundRepos, name)
 		return nil
 	})
+	switch err.(type) {
+	case nil, driver.PathNotFoundError:
+		// No repository was stored yet if the root is not found.
+	default:
+		if err != ErrFinishedWalk {
+			return 0, err
+		}
+	}
 
 	n = copy(repos, foundRepos)
 
 	// Signal that we have no more entries by setting EOF
-	if len(foundRepos) <= len(repos) && err != ErrFinishedWalk {
+	if err != ErrFinishedWalk {
 		errVal = io.EOF
 	}
 
 	return n, errVal
 }
+
+// pageRepositories copies the names, sorted, following last into repos, and
+// returns io.EOF if none is left.
+func pageRepositories(names []string, repos []string, last string) (int, error) {
+	i := sort.SearchStrings(names, last)
+	if i < len(names) && names[i] == last {
+		i++
+	}
+
+	n := copy(repos, names[i:])
+	if i+n == len(names) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// walkRepositories calls fn with the name of each repository stored by
+// storageDriver, walking its repositories directory. The walk stops at the
+// first error returned by fn.
+func walkRepositories(ctx context.Context, storageDriver driver.StorageDriver, fn func(name string) error) error {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	return Walk(ctx, storageDriver, root, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+
+		// lop the base path off
+		repoPath := filePath[len(root)+1:]
+
+		_, file := path.Split(repoPath)
+		if file == "_layers" {
+			if err := fn(strings.TrimSuffix(repoPath, "/_layers")); err != nil {
+				return err
+			}
+			return ErrSkipDir
+		} else if strings.HasPrefix(file, "_") {
+			return ErrSkipDir
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	// catalogIndexLockName is the name of the lock held while updating the
+	// catalog index.
+	catalogIndexLockName = "catalog"
+
+	// catalogIndexCacheTTL is how long the repositories read from the index
+	// are trusted to still be listed, so that pushes to known repositories
+	// do not read the index.
+	catalogIndexCacheTTL = time.Minute
+)
+
+// catalogIndexFile is the content of the catalog index object.
+type catalogIndexFile struct {
+	Repositories []string `json:"repositories"`
+}
+
+// CatalogIndex lists the repositories of a registry in a single object of the
+// storage backend, so that the catalog is listed without walking the
+// repositories directory. Repositories are added to the index when a manifest
+// is put to them, and are removed with Remove once deleted. Updates hold the
+// "catalog" lock of the lock manager, if any; without one, concurrent updates
+// may be lost until the index is rebuilt.
+type CatalogIndex struct {
+	driver driver.StorageDriver
+	locks  *LockManager
+
+	mu     sync.Mutex
+	known  map[string]struct{}
+	loaded time.Time
+}
+
+// NewCatalogIndex returns the catalog index of the registry stored by
+// storageDriver, whose updates are serialized by locks, which may be nil.
+func NewCatalogIndex(storageDriver driver.StorageDriver, locks *LockManager) *CatalogIndex {
+	return &CatalogIndex{
+		driver: storageDriver,
+		locks:  locks,
+	}
+}
+
+// IndexCatalog is a functional option for NewRegistry. The repositories of
+// the registry are recorded in the catalog index, from which they are listed
+// once the index was built with Rebuild.
+func IndexCatalog(ci *CatalogIndex) RegistryOption {
+	return func(registry *registry) error {
+		registry.catalog = ci
+		return nil
+	}
+}
+
+// Exists returns true if the index was built.
+func (ci *CatalogIndex) Exists(ctx context.Context) (bool, error) {
+	indexPath, err := pathFor(catalogIndexPathSpec{})
+	if err != nil {
+		return false, err
+	}
+	return exists(ctx, ci.driver, indexPath)
+}
+
+// Add records the named repository in the index, if missing. Nothing is
+// recorded by a nil CatalogIndex, or until the index was built.
+func (ci *CatalogIndex) Add(ctx context.Context, name string) error {
+	if ci == nil || ci.isKnown(name) {
+		return nil
+	}
+
+	return ci.update(ctx, false, func(names map[string]struct{}) error {
+		names[name] = struct{}{}
+		return nil
+	})
+}
+
+// Remove removes the named repository from the index. Nothing is removed by
+// a nil CatalogIndex, or until the index was built.
+func (ci *CatalogIndex) Remove(ctx context.Context, name string) error {
+	if ci == nil {
+		return nil
+	}
+
+	return ci.update(ctx, false, func(names map[string]struct{}) error {
+		delete(names, name)
+		return nil
+	})
+}
+
+// Rebuild lists the repositories by walking the repositories directory and
+// replaces the index with them, repairing updates lost or missed, such as
+// those of repositories pushed before the index was enabled. It returns the
+// number of repositories indexed. The repositories added or removed while
+// walking are checked to still exist before replacing the index, so that
+// their concurrent updates are kept.
+func (ci *CatalogIndex) Rebuild(ctx context.Context) (int, error) {
+	walked := make(map[string]struct{})
+	err := walkRepositories(ctx, ci.driver, func(name string) error {
+		walked[name] = struct{}{}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return 0, err
+	}
+
+	var count int
+	err = ci.update(ctx, true, func(names map[string]struct{}) error {
+		for name := range names {
+			if _, ok := walked[name]; ok {
+				continue
+			}
+			exists, err := RepositoryExists(ctx, ci.driver, name)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				delete(names, name)
+			}
+		}
+
+		for name := range walked {
+			if _, ok := names[name]; ok {
+				continue
+			}
+			exists, err := RepositoryExists(ctx, ci.driver, name)
+			if err != nil {
+				return err
+			}
+			if exists {
+				names[name] = struct{}{}
+			}
+		}
+
+		count = len(names)
+		return nil
+	})
+	return count, err
+}
+
+// isKnown returns true if the named repository was listed by the index when
+// recently read.
+func (ci *CatalogIndex) isKnown(name string) bool {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if time.Since(ci.loaded) > catalogIndexCacheTTL {
+		return false
+	}
+	_, ok := ci.known[name]
+	return ok
+}
+
+// update applies fn to the repositories of the index, while holding the lock
+// of the index, and stores them if changed. A missing index is only created
+// if create is true, since an index missing repositories would hide them from
+// the catalog.
+func (ci *CatalogIndex) update(ctx context.Context, create bool, fn func(names map[string]struct{}) error) error {
+	unlock, err := ci.locks.Lock(ctx, catalogIndexLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var missing bool
+	current, err := ci.load(ctx)
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		if !create {
+			return nil
+		}
+		missing = true
+	default:
+		return err
+	}
+
+	names := make(map[string]struct{}, len(current))
+	for _, name := range current {
+		names[name] = struct{}{}
+	}
+	if err := fn(names); err != nil {
+		return err
+	}
+
+	updated := make([]string, 0, len(names))
+	for name := range names {
+		updated = append(updated, name)
+	}
+	sort.Strings(updated)
+
+	if !missing && equalStrings(current, updated) {
+		return nil
+	}
+	return ci.save(ctx, updated)
+}
+
+// load returns the sorted repositories of the index. A PathNotFoundError is
+// returned if the index was not built yet.
+func (ci *CatalogIndex) load(ctx context.Context) ([]string, error) {
+	indexPath, err := pathFor(catalogIndexPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ci.driver.GetContent(ctx, indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var index catalogIndexFile
+	if err := json.Unmarshal(p, &index); err != nil {
+		return nil, fmt.Errorf("invalid catalog index: %v", err)
+	}
+
+	ci.remember(index.Repositories)
+	return index.Repositories, nil
+}
+
+// save replaces the repositories of the index.
+func (ci *CatalogIndex) save(ctx context.Context, names []string) error {
+	indexPath, err := pathFor(catalogIndexPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(catalogIndexFile{Repositories: names})
+	if err != nil {
+		return err
+	}
+
+	if err := ci.driver.PutContent(ctx, indexPath, p); err != nil {
+		return err
+	}
+
+	ci.remember(names)
+	return nil
+}
+
+// remember records the repositories last read from or written to the index.
+func (ci *CatalogIndex) remember(names []string) {
+	known := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		known[name] = struct{}{}
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.known = known
+	ci.loaded = time.Now()
+}
+
+// equalStrings returns true if a and b hold the same strings in the same
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// TestCatalogIndex checks that the catalog is listed from the index once
+// built, that updates are recorded in it, and that rebuilding it repairs the
+// updates it missed.
+func TestCatalogIndex(t *testing.T) {
+	env := setupFS(t)
+	ci := NewCatalogIndex(env.driver, nil)
+	registry, err := NewRegistry(env.ctx, env.driver, IndexCatalog(ci))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	list := func() []string {
+		var names []string
+		last := ""
+		for {
+			p := make([]string, 2)
+			n, err := registry.Repositories(env.ctx, p, last)
+			names = append(names, p[:n]...)
+			if err == io.EOF {
+				return names
+			}
+			if err != nil {
+				t.Fatalf("unexpected error listing repositories: %v", err)
+			}
+			last = p[n-1]
+		}
+	}
+
+	// Until the index is built, repositories are not recorded and the
+	// catalog is walked.
+	if err := ci.Add(env.ctx, "baz/e"); err != nil {
+		t.Fatalf("unexpected error adding repository: %v", err)
+	}
+	if exists, err := ci.Exists(env.ctx); err != nil || exists {
+		t.Fatalf("index created before being built: %v, %v", exists, err)
+	}
+	if names := list(); !reflect.DeepEqual(names, env.expected) {
+		t.Fatalf("unexpected walked catalog: %v", names)
+	}
+
+	count, err := ci.Rebuild(env.ctx)
+	if err != nil || count != len(env.expected) {
+		t.Fatalf("unexpected rebuild: %d, %v", count, err)
+	}
+	if names := list(); !reflect.DeepEqual(names, env.expected) {
+		t.Fatalf("unexpected indexed catalog: %v", names)
+	}
+
+	// The index is listed rather than the repositories directory.
+	if err := ci.Add(env.ctx, "baz/e"); err != nil {
+		t.Fatalf("unexpected error adding repository: %v", err)
+	}
+	if err := ci.Remove(env.ctx, "foo/a"); err != nil {
+		t.Fatalf("unexpected error removing repository: %v", err)
+	}
+	expected := []string{"bar/c", "bar/d", "baz/e", "foo/b", "foo/d/in"}
+	if names := list(); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected updated catalog: %v", names)
+	}
+
+	// Rebuilding drops baz/e, which is not stored, and restores foo/a.
+	if _, err := ci.Rebuild(env.ctx); err != nil {
+		t.Fatalf("unexpected error rebuilding index: %v", err)
+	}
+	if names := list(); !reflect.DeepEqual(names, env.expected) {
+		t.Fatalf("unexpected repaired catalog: %v", names)
+	}
+}
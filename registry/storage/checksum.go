@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"sort"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// RepositoryChecksum summarizes the tags and manifests of a repository, so
+// that replicas can tell whether they hold the same content by comparing a
+// single digest before enumerating it.
+//
+// The digests are the roots of Merkle trees. The leaves of the tags tree are
+// the SHA-256 hashes of "<tag> <digest>\n" for each tag, in the order of
+// the tags, and those of the manifests tree the hashes of "<digest>\n" for
+// each manifest, in the order of the digests. Each node hashes the
+// concatenation of its two children, an odd last node being carried to the
+// next level as is, and the tree of no leaves is the hash of no bytes.
+// Digest hashes the concatenation of the roots of the tags and manifests
+// trees.
+type RepositoryChecksum struct {
+	Digest    digest.Digest
+	Tags      ChecksumTree
+	Manifests ChecksumTree
+}
+
+// ChecksumTree is the root of a Merkle tree of a RepositoryChecksum, with the
+// number of its leaves.
+type ChecksumTree struct {
+	Digest digest.Digest `json:"digest"`
+	Count  int           `json:"count"`
+}
+
+// ComputeRepositoryChecksum returns the checksum of the tags and manifests of
+// the repository, whose manifest revisions are read from storageDriver.
+func ComputeRepositoryChecksum(ctx context.Context, storageDriver driver.StorageDriver, repository distribution.Repository) (RepositoryChecksum, error) {
+	tagService := repository.Tags(ctx)
+	all, err := tagService.All(ctx)
+	if err != nil {
+		return RepositoryChecksum{}, err
+	}
+
+	tags := make(map[string]digest.Digest, len(all))
+	for _, tag := range all {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				// Untagged since it was listed.
+				continue
+			}
+			return RepositoryChecksum{}, err
+		}
+		tags[tag] = desc.Digest
+	}
+
+	var manifests []digest.Digest
+	err = enumerateManifestRevisions(ctx, storageDriver, repository.Named().Name(), func(_, linked digest.Digest) error {
+		manifests = append(manifests, linked)
+		return nil
+	})
+	if err != nil {
+		return RepositoryChecksum{}, err
+	}
+
+	return ChecksumOf(tags, manifests), nil
+}
+
+// ChecksumOf returns the checksum of a repository holding the given tags and
+// manifests, for clients to compare with the checksum of a registry.
+func ChecksumOf(tags map[string]digest.Digest, manifests []digest.Digest) RepositoryChecksum {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+
+	tagLeaves := make([][]byte, len(names))
+	for i, tag := range names {
+		tagLeaves[i] = hashOf([]byte(tag + " " + tags[tag].String() + "\n"))
+	}
+
+	dgsts := make([]string, len(manifests))
+	for i, dgst := range manifests {
+		dgsts[i] = dgst.String()
+	}
+	sort.Strings(dgsts)
+
+	manifestLeaves := make([][]byte, len(dgsts))
+	for i, dgst := range dgsts {
+		manifestLeaves[i] = hashOf([]byte(dgst + "\n"))
+	}
+
+	tagsRoot, manifestsRoot := merkleRoot(tagLeaves), merkleRoot(manifestLeaves)
+	return RepositoryChecksum{
+		Digest:    digest.NewDigestFromBytes(digest.SHA256, hashOf(tagsRoot, manifestsRoot)),
+		Tags:      ChecksumTree{Digest: digest.NewDigestFromBytes(digest.SHA256, tagsRoot), Count: len(tagLeaves)},
+		Manifests: ChecksumTree{Digest: digest.NewDigestFromBytes(digest.SHA256, manifestsRoot), Count: len(manifestLeaves)},
+	}
+}
+
+// merkleRoot returns the root of the Merkle tree of the leaves.
+func merkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return hashOf()
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashOf(level[i], level[i+1]))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// hashOf returns the SHA-256 hash of the concatenation of ps.
+func hashOf(ps ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range ps {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
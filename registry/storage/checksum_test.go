@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestChecksumOf(t *testing.T) {
+	a, b, c := digest.FromBytes([]byte("a")), digest.FromBytes([]byte("b")), digest.FromBytes([]byte("c"))
+
+	empty := ChecksumOf(nil, nil)
+	if empty.Tags.Digest != digest.FromBytes(nil) || empty.Manifests.Digest != digest.FromBytes(nil) || empty.Tags.Count != 0 {
+		t.Fatalf("unexpected checksum of empty repository: %v", empty)
+	}
+
+	checksum := ChecksumOf(map[string]digest.Digest{"v1": a, "v2": b}, []digest.Digest{c, a, b})
+	if other := ChecksumOf(map[string]digest.Digest{"v2": b, "v1": a}, []digest.Digest{a, b, c}); other != checksum {
+		t.Fatalf("checksum depends on order: %v != %v", other, checksum)
+	}
+	if checksum.Tags.Count != 2 || checksum.Manifests.Count != 3 {
+		t.Fatalf("unexpected counts: %v", checksum)
+	}
+
+	// the manifests tree of a, b and c hashes the node of a and b with c
+	leaf := func(s string) []byte { return hashOf([]byte(s + "\n")) }
+	dgsts := []digest.Digest{a, b, c}
+	for i := range dgsts {
+		for j := i + 1; j < len(dgsts); j++ {
+			if dgsts[j] < dgsts[i] {
+				dgsts[i], dgsts[j] = dgsts[j], dgsts[i]
+			}
+		}
+	}
+	root := hashOf(hashOf(leaf(dgsts[0].String()), leaf(dgsts[1].String())), leaf(dgsts[2].String()))
+	if checksum.Manifests.Digest != digest.NewDigestFromBytes(digest.SHA256, root) {
+		t.Fatalf("unexpected manifests tree digest %s", checksum.Manifests.Digest)
+	}
+
+	moved := ChecksumOf(map[string]digest.Digest{"v1": a, "v2": a}, []digest.Digest{a, b, c})
+	if moved.Digest == checksum.Digest || moved.Tags.Digest == checksum.Tags.Digest || moved.Manifests.Digest != checksum.Manifests.Digest {
+		t.Fatalf("unexpected checksum after moving a tag: %v, was %v", moved, checksum)
+	}
+}
+
+func TestComputeRepositoryChecksum(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+
+	var manifests []digest.Digest
+	for _, config := range []string{`{"architecture":"amd64","os":"linux"}`, `{"architecture":"arm64","os":"linux"}`} {
+		configDesc, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte(config))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+		manifest, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    configDesc,
+			Layers:    []distribution.Descriptor{layer},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := ms.Put(ctx, manifest)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		manifests = append(manifests, dgst)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: manifests[1]}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+
+	checksum, err := ComputeRepositoryChecksum(ctx, d, repo)
+	if err != nil {
+		t.Fatalf("unexpected error computing checksum: %v", err)
+	}
+	if expected := ChecksumOf(map[string]digest.Digest{"latest": manifests[1]}, manifests); checksum != expected {
+		t.Fatalf("unexpected checksum %v, expected %v", checksum, expected)
+	}
+
+	// deleted manifests are not summarized
+	if err := ms.Delete(ctx, manifests[0]); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	checksum, err = ComputeRepositoryChecksum(ctx, d, repo)
+	if err != nil {
+		t.Fatalf("unexpected error computing checksum: %v", err)
+	}
+	if expected := ChecksumOf(map[string]digest.Digest{"latest": manifests[1]}, manifests[1:]); checksum != expected {
+		t.Fatalf("unexpected checksum after deletion %v, expected %v", checksum, expected)
+	}
+}
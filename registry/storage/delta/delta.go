@@ -0,0 +1,311 @@
+// Package delta encodes a blob as a binary delta from another blob, so that
+// a client holding the source blob can rebuild the target blob from the
+// delta instead of downloading it.
+//
+// The delta is computed by block matching: the source is split into blocks,
+// indexed by a rolling checksum and a strong hash, and the blocks found in
+// the target, at any offset, are copied from the source while the other
+// bytes of the target are stored in the delta. Uncompressed layers, and
+// layers compressed in an rsyncable way, share most of their blocks with the
+// previous build of the same image.
+//
+// A delta starts with Magic and is followed by a sequence of operations,
+// each starting with its type byte:
+//
+//	copy: 'C', uvarint source offset, uvarint length
+//	data: 'D', uvarint length, the bytes
+//	end:  'E'
+package delta
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// Magic starts every delta.
+	Magic = "DLTA\x01"
+
+	// BlockSize is the size of the blocks of the source matched in the
+	// target.
+	BlockSize = 4096
+
+	// maxData is the number of bytes of the target buffered before they
+	// are written to the delta as a data operation.
+	maxData = 1 << 20
+
+	opCopy = 'C'
+	opData = 'D'
+	opEnd  = 'E'
+)
+
+// ErrInvalidDelta is returned when applying a delta which is corrupted or
+// was not computed from the source it is applied to.
+var ErrInvalidDelta = errors.New("delta: invalid delta")
+
+// block is a block of the source.
+type block struct {
+	offset int64
+	strong [md5.Size]byte
+}
+
+// index returns the full blocks of source, by rolling checksum.
+func index(source io.Reader) (map[uint32][]block, error) {
+	blocks := make(map[uint32][]block)
+	buf := make([]byte, BlockSize)
+
+	for offset := int64(0); ; offset += BlockSize {
+		if _, err := io.ReadFull(source, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// The last partial block is not indexed.
+				return blocks, nil
+			}
+			return nil, err
+		}
+
+		var sum rollingSum
+		sum.init(buf)
+		weak := sum.digest()
+		blocks[weak] = append(blocks[weak], block{offset: offset, strong: md5.Sum(buf)})
+	}
+}
+
+// Encode writes to w the delta rebuilding target from source.
+func Encode(w io.Writer, source, target io.Reader) error {
+	blocks, err := index(source)
+	if err != nil {
+		return err
+	}
+
+	e := &encoder{w: bufio.NewWriter(w)}
+	if _, err := e.w.WriteString(Magic); err != nil {
+		return err
+	}
+
+	// data holds the bytes of the target read but not encoded yet, from
+	// the pending data bytes, starting at pending, to the window matched
+	// against the blocks, starting at i.
+	var (
+		data       = make([]byte, 0, 2*maxData)
+		pending, i int
+		sum        rollingSum
+		summed     bool
+		eof        bool
+	)
+	for {
+		if len(data)-i <= BlockSize && !eof {
+			// The window needs the byte following it to roll.
+			if i-pending >= maxData {
+				if err := e.data(data[pending:i]); err != nil {
+					return err
+				}
+				pending = i
+			}
+			data = data[:copy(data, data[pending:])]
+			i -= pending
+			pending = 0
+
+			n, err := io.ReadFull(target, data[len(data):cap(data)])
+			data = data[:len(data)+n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		if len(data)-i < BlockSize {
+			break
+		}
+
+		window := data[i : i+BlockSize]
+		if !summed {
+			sum.init(window)
+			summed = true
+		}
+		if candidates, ok := blocks[sum.digest()]; ok {
+			strong := md5.Sum(window)
+			matched := false
+			for _, b := range candidates {
+				if b.strong == strong {
+					if err := e.data(data[pending:i]); err != nil {
+						return err
+					}
+					if err := e.copy(b.offset, BlockSize); err != nil {
+						return err
+					}
+					matched = true
+					break
+				}
+			}
+			if matched {
+				i += BlockSize
+				pending = i
+				summed = false
+				continue
+			}
+		}
+
+		if len(data)-i == BlockSize {
+			// The window is the end of the target.
+			break
+		}
+		sum.roll(data[i], data[i+BlockSize])
+		i++
+	}
+
+	if err := e.data(data[pending:]); err != nil {
+		return err
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(opEnd); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// encoder writes the operations of a delta, merging the copies of
+// consecutive source blocks.
+type encoder struct {
+	w *bufio.Writer
+
+	copyOffset, copyLength int64
+}
+
+func (e *encoder) copy(offset, length int64) error {
+	if e.copyLength > 0 && e.copyOffset+e.copyLength == offset {
+		e.copyLength += length
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copyOffset, e.copyLength = offset, length
+	return nil
+}
+
+func (e *encoder) flushCopy() error {
+	if e.copyLength == 0 {
+		return nil
+	}
+	if err := e.w.WriteByte(opCopy); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(e.copyOffset)); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(e.copyLength)); err != nil {
+		return err
+	}
+	e.copyLength = 0
+	return nil
+}
+
+func (e *encoder) data(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(opData); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(len(p))); err != nil {
+		return err
+	}
+	_, err := e.w.Write(p)
+	return err
+}
+
+func (e *encoder) uvarint(v uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, err := e.w.Write(buf[:binary.PutUvarint(buf[:], v)])
+	return err
+}
+
+// Apply writes to w the target rebuilt from source and delta.
+func Apply(w io.Writer, source io.ReadSeeker, delta io.Reader) error {
+	r := bufio.NewReader(delta)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		return ErrInvalidDelta
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return ErrInvalidDelta
+		}
+
+		switch op {
+		case opCopy:
+			offset, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrInvalidDelta
+			}
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrInvalidDelta
+			}
+			if _, err := source.Seek(int64(offset), os.SEEK_SET); err != nil {
+				return err
+			}
+			if err := copyN(w, source, int64(length)); err != nil {
+				return err
+			}
+		case opData:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrInvalidDelta
+			}
+			if err := copyN(w, r, int64(length)); err != nil {
+				return err
+			}
+		case opEnd:
+			return nil
+		default:
+			return ErrInvalidDelta
+		}
+	}
+}
+
+// copyN copies n bytes from r to w, returning ErrInvalidDelta if r ends
+// before.
+func copyN(w io.Writer, r io.Reader, n int64) error {
+	_, err := io.CopyN(w, r, n)
+	if err == io.EOF {
+		return ErrInvalidDelta
+	}
+	return err
+}
+
+// rollingSum is the rsync rolling checksum of a window of BlockSize bytes.
+type rollingSum struct {
+	a, b uint32
+}
+
+func (s *rollingSum) init(window []byte) {
+	s.a, s.b = 0, 0
+	for i, c := range window {
+		s.a += uint32(c)
+		s.b += uint32(len(window)-i) * uint32(c)
+	}
+}
+
+// roll moves the window by one byte, from out to in.
+func (s *rollingSum) roll(out, in byte) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - BlockSize*uint32(out)
+}
+
+func (s *rollingSum) digest() uint32 {
+	return s.a&0xffff | s.b<<16
+}
@@ -0,0 +1,91 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	p := make([]byte, n)
+	r.Read(p)
+	return p
+}
+
+func encode(t *testing.T, source, target []byte) []byte {
+	var delta bytes.Buffer
+	if err := Encode(&delta, bytes.NewReader(source), bytes.NewReader(target)); err != nil {
+		t.Fatalf("error encoding delta: %v", err)
+	}
+	return delta.Bytes()
+}
+
+func apply(t *testing.T, source, delta []byte) []byte {
+	var target bytes.Buffer
+	if err := Apply(&target, bytes.NewReader(source), bytes.NewReader(delta)); err != nil {
+		t.Fatalf("error applying delta: %v", err)
+	}
+	return target.Bytes()
+}
+
+func TestEncodeApply(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	source := randomBytes(r, 3*maxData+123)
+
+	// The target shares most of the source, with bytes inserted,
+	// removed and replaced at offsets not aligned on blocks.
+	var target []byte
+	target = append(target, source[:100000]...)
+	target = append(target, randomBytes(r, 777)...)
+	target = append(target, source[100000:1500000]...)
+	target = append(target, source[1600001:2000000]...)
+	target = append(target, randomBytes(r, 50000)...)
+	target = append(target, source[2050000:]...)
+	target = append(target, randomBytes(r, 10)...)
+
+	delta := encode(t, source, target)
+	if !bytes.Equal(apply(t, source, delta), target) {
+		t.Fatalf("rebuilt target differs")
+	}
+	// The bytes which differ, and the blocks they overlap, are stored.
+	if len(delta) > 100000 {
+		t.Fatalf("delta too large: %d bytes", len(delta))
+	}
+
+	for _, test := range []struct {
+		name           string
+		source, target []byte
+	}{
+		{"unrelated", randomBytes(r, 100000), randomBytes(r, 2*maxData+1)},
+		{"empty source", nil, randomBytes(r, 5000)},
+		{"empty target", source, nil},
+		{"identical", source, source},
+		{"short", []byte("abc"), []byte("abcd")},
+	} {
+		delta := encode(t, test.source, test.target)
+		if !bytes.Equal(apply(t, test.source, delta), test.target) {
+			t.Fatalf("%s: rebuilt target differs", test.name)
+		}
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	source := randomBytes(rand.New(rand.NewSource(1)), 3*BlockSize)
+	delta := encode(t, source, source)
+
+	for _, invalid := range [][]byte{
+		nil,
+		[]byte("not a delta"),
+		delta[:len(delta)-1],
+		append([]byte(Magic), 'X'),
+	} {
+		if err := Apply(&bytes.Buffer{}, bytes.NewReader(source), bytes.NewReader(invalid)); err != ErrInvalidDelta {
+			t.Fatalf("unexpected error applying invalid delta %q: %v", invalid, err)
+		}
+	}
+
+	// A copy beyond the end of the source
+	if err := Apply(&bytes.Buffer{}, bytes.NewReader(source[:BlockSize]), bytes.NewReader(delta)); err != ErrInvalidDelta {
+		t.Fatalf("unexpected error applying delta to another source: %v", err)
+	}
+}
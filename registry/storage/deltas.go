@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/delta"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+)
+
+// ErrDeltaUnknown is returned when no delta is stored between two blobs.
+var ErrDeltaUnknown = errors.New("delta unknown")
+
+// DeltaStore caches the binary deltas between the blobs of a repository,
+// alongside the repository in the storage backend. A delta is derived from
+// its blobs, so it is computed once and kept until the repository is
+// deleted.
+type DeltaStore struct {
+	driver storagedriver.StorageDriver
+	name   string
+}
+
+// NewDeltaStore returns a DeltaStore for the deltas of the named repository.
+func NewDeltaStore(driver storagedriver.StorageDriver, name reference.Named) *DeltaStore {
+	return &DeltaStore{
+		driver: driver,
+		name:   name.Name(),
+	}
+}
+
+// Stat returns the size of the delta rebuilding the blob dgst from the blob
+// from.
+func (ds *DeltaStore) Stat(ctx context.Context, from, dgst digest.Digest) (int64, error) {
+	dataPath, err := pathFor(deltaPathSpec{name: ds.name, from: from, digest: dgst})
+	if err != nil {
+		return 0, err
+	}
+
+	fi, err := ds.driver.Stat(ctx, dataPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return 0, ErrDeltaUnknown
+		}
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Open returns a reader of the delta rebuilding the blob dgst from the blob
+// from.
+func (ds *DeltaStore) Open(ctx context.Context, from, dgst digest.Digest) (io.ReadCloser, error) {
+	dataPath, err := pathFor(deltaPathSpec{name: ds.name, from: from, digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := ds.driver.ReadStream(ctx, dataPath, 0)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, ErrDeltaUnknown
+		}
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Put computes and stores the delta rebuilding the blob dgst, whose content
+// is read from target, from the blob from, whose content is read from
+// source, and returns its size. The delta is written aside and moved in
+// place once complete, so that it is never read partially.
+func (ds *DeltaStore) Put(ctx context.Context, from, dgst digest.Digest, source, target io.Reader) (int64, error) {
+	dataPath, err := pathFor(deltaPathSpec{name: ds.name, from: from, digest: dgst})
+	if err != nil {
+		return 0, err
+	}
+	tempPath := dataPath + "." + uuid.Generate().String()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(delta.Encode(pw, source, target))
+	}()
+
+	size, err := ds.driver.WriteStream(ctx, tempPath, 0, pr)
+	pr.CloseWithError(err)
+	if err == nil {
+		err = ds.driver.Move(ctx, tempPath, dataPath)
+	}
+	if err != nil {
+		if err := ds.driver.Delete(ctx, tempPath); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				context.GetLogger(ctx).Errorf("error deleting partial delta %s: %v", tempPath, err)
+			}
+		}
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/delta"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestDeltaStore(t *testing.T) {
+	ctx := context.Background()
+	name, _ := reference.ParseNamed("a/b")
+	driver := inmemory.New()
+	ds := NewDeltaStore(driver, name)
+
+	source := bytes.Repeat([]byte("0123456789abcdef"), 4*delta.BlockSize)
+	target := append([]byte("prefix"), source...)
+	from, dgst := digest.FromBytes(source), digest.FromBytes(target)
+
+	if _, err := ds.Stat(ctx, from, dgst); err != ErrDeltaUnknown {
+		t.Fatalf("expected unknown delta, got %v", err)
+	}
+	if _, err := ds.Open(ctx, from, dgst); err != ErrDeltaUnknown {
+		t.Fatalf("expected unknown delta, got %v", err)
+	}
+
+	size, err := ds.Put(ctx, from, dgst, bytes.NewReader(source), bytes.NewReader(target))
+	if err != nil {
+		t.Fatalf("unexpected error storing delta: %v", err)
+	}
+	if size >= int64(len(target)) {
+		t.Fatalf("delta not smaller than its target: %d bytes", size)
+	}
+	if stat, err := ds.Stat(ctx, from, dgst); err != nil || stat != size {
+		t.Fatalf("unexpected delta size: %d, %v", stat, err)
+	}
+
+	rc, err := ds.Open(ctx, from, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error opening delta: %v", err)
+	}
+	defer rc.Close()
+
+	var rebuilt bytes.Buffer
+	if err := delta.Apply(&rebuilt, bytes.NewReader(source), rc); err != nil {
+		t.Fatalf("unexpected error applying delta: %v", err)
+	}
+	if !bytes.Equal(rebuilt.Bytes(), target) {
+		t.Fatalf("rebuilt target differs")
+	}
+
+	// Only the delta remains in the directory of the deltas of the source.
+	dataPath, _ := pathFor(deltaPathSpec{name: name.Name(), from: from, digest: dgst})
+	entries, err := driver.List(ctx, dataPath[:len(dataPath)-len("/data")])
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected delta directory entries: %v, %v", entries, err)
+	}
+
+	// A delta whose source fails is not stored.
+	other := digest.FromBytes([]byte("other"))
+	if _, err := ds.Put(ctx, other, dgst, errReader{}, bytes.NewReader(target)); err == nil {
+		t.Fatalf("expected error storing delta of a failing source")
+	}
+	if _, err := ds.Stat(ctx, other, dgst); err != ErrDeltaUnknown {
+		t.Fatalf("expected unknown delta, got %v", err)
+	}
+}
+
+// errReader fails every read.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
@@ -0,0 +1,226 @@
+// Package appendable emulates the writes at an offset of
+// StorageDriver.WriteStream on object stores, whose objects cannot be
+// modified once stored.
+//
+// The written content is staged aside first, then the object is replaced by
+// stitching the ranges of the stored object the write keeps, the zeros
+// filling the gap between the stored object and the offset, and the staged
+// content, in the order planned by Plan. Object stores combining parts on
+// their side, like KODO, take the planned parts as is, while those stitching
+// objects from the parts of multipart uploads, like OSS and COS, group them
+// with Segments into parts their uploads accept.
+package appendable
+
+import (
+	"fmt"
+	"io"
+)
+
+// Source identifies the content a Part is taken from.
+type Source int
+
+const (
+	// Stored is the object stored at the written path before the write.
+	Stored Source = iota
+
+	// Staged is the written content.
+	Staged
+
+	// Zeros are the zeros extending the stored object up to the offset of
+	// a write past its end.
+	Zeros
+)
+
+func (s Source) String() string {
+	switch s {
+	case Stored:
+		return "stored"
+	case Staged:
+		return "staged"
+	case Zeros:
+		return "zeros"
+	}
+	return fmt.Sprintf("Source(%d)", int(s))
+}
+
+// Part is the range [From, To) of the content of a Source. The parts of
+// Zeros always start at 0.
+type Part struct {
+	Source Source
+	From   int64
+	To     int64
+}
+
+// Size returns the number of bytes of the part.
+func (p Part) Size() int64 {
+	return p.To - p.From
+}
+
+func (p Part) String() string {
+	return fmt.Sprintf("%v[%d:%d]", p.Source, p.From, p.To)
+}
+
+// Plan returns the parts of the object resulting from writing written bytes
+// at offset to an object of size bytes, size being negative when no object
+// is stored at the path. The write overwrites the stored content from offset
+// on, keeps the stored content past offset+written and fills the gap
+// between the end of the stored object and offset with zeros. Empty parts
+// are left out, so that no parts are returned for an empty object.
+func Plan(size, offset, written int64) []Part {
+	if size < 0 {
+		size = 0
+	}
+
+	var parts []Part
+	add := func(p Part) {
+		if p.Size() > 0 {
+			parts = append(parts, p)
+		}
+	}
+
+	if offset <= size {
+		add(Part{Source: Stored, From: 0, To: offset})
+	} else {
+		add(Part{Source: Stored, From: 0, To: size})
+		add(Part{Source: Zeros, From: 0, To: offset - size})
+	}
+	add(Part{Source: Staged, From: 0, To: written})
+	if offset+written < size {
+		add(Part{Source: Stored, From: offset + written, To: size})
+	}
+
+	return parts
+}
+
+// Appends reports whether a write at offset to an object of size bytes only
+// extends the stored content, which object stores supporting appends to
+// their objects can do without stitching the object again. size is negative
+// when no object is stored at the path.
+func Appends(size, offset int64) bool {
+	return size >= 0 && offset == size
+}
+
+// Segment is a part of a multipart upload stitching an object. Its content
+// is either a range of the stored object copied by the object store, when
+// Copy is set, or the concatenation of Pieces, uploaded by the driver.
+type Segment struct {
+	Copy   *Part
+	Pieces []Part
+}
+
+// Size returns the number of bytes of the segment.
+func (s Segment) Size() int64 {
+	if s.Copy != nil {
+		return s.Copy.Size()
+	}
+
+	var size int64
+	for _, p := range s.Pieces {
+		size += p.Size()
+	}
+	return size
+}
+
+// Segments groups parts into the segments of a multipart upload, where every
+// segment but the last holds at least minSize bytes. The ranges of the stored
+// object of at least minSize bytes are copied, provided that no uploaded
+// content is pending before them, and the rest of the content is uploaded in
+// segments of chunkSize bytes. chunkSize must be no smaller than minSize.
+func Segments(parts []Part, minSize, chunkSize int64) []Segment {
+	var (
+		segments []Segment
+		pending  Segment
+		size     int64
+	)
+
+	flush := func() {
+		if len(pending.Pieces) > 0 {
+			segments = append(segments, pending)
+		}
+		pending = Segment{}
+		size = 0
+	}
+
+	for _, p := range parts {
+		for p.Size() > 0 {
+			if p.Source == Stored && size == 0 && p.Size() >= minSize {
+				copied := p
+				segments = append(segments, Segment{Copy: &copied})
+				break
+			}
+
+			n := p.Size()
+			if size+n > chunkSize {
+				n = chunkSize - size
+			}
+			pending.Pieces = append(pending.Pieces, Part{Source: p.Source, From: p.From, To: p.From + n})
+			size += n
+			p.From += n
+
+			if size == chunkSize {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return segments
+}
+
+// Sources opens the content of the parts of a write.
+type Sources struct {
+	// Stored opens the range [from, to) of the stored object.
+	Stored func(from, to int64) (io.ReadCloser, error)
+
+	// Staged is the staged content of the write.
+	Staged *StagedContent
+}
+
+// Open returns a reader of the content of p.
+func (s Sources) Open(p Part) (io.ReadCloser, error) {
+	switch p.Source {
+	case Stored:
+		return s.Stored(p.From, p.To)
+	case Staged:
+		return s.Staged.Open(p.From, p.To), nil
+	case Zeros:
+		return readCloser{io.LimitReader(zeros{}, p.Size())}, nil
+	}
+	return nil, fmt.Errorf("appendable: unknown source %v", p.Source)
+}
+
+// ReadSegment reads the content of the uploaded segment s into p, which must
+// hold s.Size() bytes.
+func (s Sources) ReadSegment(seg Segment, p []byte) error {
+	for _, piece := range seg.Pieces {
+		rc, err := s.Open(piece)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(rc, p[:piece.Size()])
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		p = p[piece.Size():]
+	}
+	return nil
+}
+
+// zeros reads an endless stream of zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type readCloser struct {
+	io.Reader
+}
+
+func (readCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package appendable
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	netcontext "golang.org/x/net/context"
+)
+
+// write returns the content of stored after writing content at offset the
+// way a file would, stored being nil when there is no file.
+func write(stored []byte, offset int64, content []byte) []byte {
+	result := append([]byte(nil), stored...)
+	for int64(len(result)) < offset {
+		result = append(result, 0)
+	}
+	for i, b := range content {
+		if offset+int64(i) < int64(len(result)) {
+			result[offset+int64(i)] = b
+		} else {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// sources returns the sources of a write of content to stored.
+func sources(t *testing.T, stored, content []byte) Sources {
+	staged, err := Stage(context.Background(), "", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error staging content: %v", err)
+	}
+	return Sources{
+		Stored: func(from, to int64) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(stored[from:to])), nil
+		},
+		Staged: staged,
+	}
+}
+
+func TestPlan(t *testing.T) {
+	for _, tc := range []struct {
+		size, offset, written int64
+		expected              []Part
+	}{
+		{-1, 0, 5, []Part{{Staged, 0, 5}}},
+		{-1, 3, 5, []Part{{Zeros, 0, 3}, {Staged, 0, 5}}},
+		{0, 0, 0, nil},
+		{10, 0, 4, []Part{{Staged, 0, 4}, {Stored, 4, 10}}},
+		{10, 0, 10, []Part{{Staged, 0, 10}}},
+		{10, 3, 4, []Part{{Stored, 0, 3}, {Staged, 0, 4}, {Stored, 7, 10}}},
+		{10, 8, 4, []Part{{Stored, 0, 8}, {Staged, 0, 4}}},
+		{10, 10, 4, []Part{{Stored, 0, 10}, {Staged, 0, 4}}},
+		{10, 10, 0, []Part{{Stored, 0, 10}}},
+		{10, 13, 4, []Part{{Stored, 0, 10}, {Zeros, 0, 3}, {Staged, 0, 4}}},
+		{10, 13, 0, []Part{{Stored, 0, 10}, {Zeros, 0, 3}}},
+	} {
+		if parts := Plan(tc.size, tc.offset, tc.written); !reflect.DeepEqual(parts, tc.expected) {
+			t.Errorf("Plan(%d, %d, %d) = %v, expected %v", tc.size, tc.offset, tc.written, parts, tc.expected)
+		}
+	}
+}
+
+func TestAppends(t *testing.T) {
+	for _, tc := range []struct {
+		size, offset int64
+		expected     bool
+	}{
+		{-1, 0, false},
+		{0, 0, true},
+		{10, 10, true},
+		{10, 3, false},
+		{10, 13, false},
+	} {
+		if appends := Appends(tc.size, tc.offset); appends != tc.expected {
+			t.Errorf("Appends(%d, %d) = %v, expected %v", tc.size, tc.offset, appends, tc.expected)
+		}
+	}
+}
+
+// TestSegments checks that the segments stitched from the plans of writes
+// around the boundaries of a stored object hold the written object, and
+// that every segment but the last holds at least the minimum size.
+func TestSegments(t *testing.T) {
+	const minSize, chunkSize = 4, 6
+
+	stored := []byte("0123456789abcdefghij")
+	content := []byte("ABCDEFG")
+	for _, written := range []int64{0, 1, 3, int64(len(content))} {
+		for offset := int64(0); offset <= int64(len(stored))+minSize+1; offset++ {
+			for _, size := range []int64{-1, 0, 2, 5, int64(len(stored))} {
+				var current []byte
+				if size >= 0 {
+					current = stored[:size]
+				}
+				srcs := sources(t, current, content[:written])
+
+				segments := Segments(Plan(size, offset, written), minSize, chunkSize)
+				var result []byte
+				for i, seg := range segments {
+					if i < len(segments)-1 && seg.Size() < minSize {
+						t.Fatalf("segment %d of %v holds %d bytes, less than %d", i, segments, seg.Size(), minSize)
+					}
+					if seg.Copy != nil {
+						if seg.Copy.Source != Stored {
+							t.Fatalf("unexpected copy of %v", seg.Copy)
+						}
+						result = append(result, current[seg.Copy.From:seg.Copy.To]...)
+						continue
+					}
+					if seg.Size() > chunkSize {
+						t.Fatalf("segment %d of %v holds %d bytes, more than %d", i, segments, seg.Size(), chunkSize)
+					}
+					p := make([]byte, seg.Size())
+					if err := srcs.ReadSegment(seg, p); err != nil {
+						t.Fatalf("unexpected error reading segment: %v", err)
+					}
+					result = append(result, p...)
+				}
+				srcs.Staged.Close()
+
+				if expected := write(current, offset, content[:written]); !bytes.Equal(result, expected) {
+					t.Fatalf("writing %d bytes at %d to %d bytes: got %q, expected %q", written, offset, size, result, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestStage(t *testing.T) {
+	content := []byte("hello world")
+	staged, err := Stage(context.Background(), "", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error staging content: %v", err)
+	}
+	defer staged.Close()
+
+	sum := sha256.Sum256(content)
+	if staged.Size != int64(len(content)) || staged.Digest != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected staged content %d %s", staged.Size, staged.Digest)
+	}
+
+	p, err := ioutil.ReadAll(staged.Open(6, 11))
+	if err != nil || string(p) != "world" {
+		t.Fatalf("unexpected staged range %q: %v", p, err)
+	}
+
+	ctx, cancel := netcontext.WithCancel(context.Background())
+	cancel()
+	if _, err := Stage(ctx, "", bytes.NewReader(content)); err == nil {
+		t.Fatalf("expected staging to stop once the context is done")
+	}
+}
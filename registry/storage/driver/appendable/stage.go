@@ -0,0 +1,87 @@
+package appendable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/docker/distribution/context"
+)
+
+// StagedContent is the content of a write spooled to a temporary file, so
+// that its size and digest are known before it is uploaded, and so that its
+// upload can be retried.
+type StagedContent struct {
+	file *os.File
+
+	// Size is the number of bytes of the content.
+	Size int64
+
+	// Digest is the hex encoded SHA-256 digest of the content.
+	Digest string
+}
+
+// Stage spools the content of r to a temporary file in dir, or in the
+// default directory for temporary files if dir is empty. The spooling stops
+// once ctx is done, so that the content of an aborted request is not spooled
+// any further. The staged content must be closed to remove the file.
+func Stage(ctx context.Context, dir string, r io.Reader) (*StagedContent, error) {
+	f, err := ioutil.TempFile(dir, "staged-")
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), &contextReader{ctx: ctx, r: r})
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &StagedContent{
+		file:   f,
+		Size:   n,
+		Digest: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// File returns the file holding the content. Reads and seeks of the file
+// are not coordinated with those of the readers returned by Open.
+func (s *StagedContent) File() *os.File {
+	return s.file
+}
+
+// Open returns a reader of the range [from, to) of the content.
+func (s *StagedContent) Open(from, to int64) io.ReadCloser {
+	return readCloser{io.NewSectionReader(s.file, from, to-from)}
+}
+
+// Close removes the staged content.
+func (s *StagedContent) Close() error {
+	err := s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	select {
+	case <-cr.ctx.Done():
+		return 0, cr.ctx.Err()
+	default:
+	}
+	return cr.r.Read(p)
+}
@@ -49,6 +49,19 @@ func (factory *azureDriverFactory) Create(parameters map[string]interface{}) (st
 	return FromParameters(parameters)
 }
 
+func (*azureDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the storage account and container the driver
+// connects to; realm only changes for sovereign clouds, such as Azure China.
+var describedParameters = []factory.Parameter{
+	{Name: paramAccountName, Type: factory.TypeString, Required: true, Description: "name of the storage account"},
+	{Name: paramAccountKey, Type: factory.TypeString, Required: true, Description: "key of the storage account"},
+	{Name: paramContainer, Type: factory.TypeString, Required: true, Description: "container storing the blobs"},
+	{Name: paramRealm, Type: factory.TypeString, Default: azure.DefaultBaseURL, Description: "domain of the storage service"},
+}
+
 // FromParameters constructs a new Driver with a given parameters map.
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	accountName, ok := parameters[paramAccountName]
@@ -50,8 +50,10 @@ type Base struct {
 	storagedriver.StorageDriver
 }
 
-// Format errors received from the storage driver
-func (base *Base) setDriverName(e error) error {
+// formatError formats errors received from the storage driver for the
+// named operation on path. Errors of no storagedriver type are enclosed in
+// a storagedriver.Error.
+func (base *Base) formatError(operation, path string, e error) error {
 	switch actual := e.(type) {
 	case nil:
 		return nil
@@ -67,9 +69,22 @@ func (base *Base) setDriverName(e error) error {
 	case storagedriver.InvalidOffsetError:
 		actual.DriverName = base.StorageDriver.Name()
 		return actual
+	case storagedriver.UnavailableError:
+		actual.DriverName = base.StorageDriver.Name()
+		return actual
+	case storagedriver.Error:
+		// Drivers may return the details of errors of their storage
+		// provider, which are kept.
+		actual.DriverName = base.StorageDriver.Name()
+		if actual.Operation == "" {
+			actual.Operation, actual.Path = operation, path
+		}
+		return actual
 	default:
 		storageError := storagedriver.Error{
 			DriverName: base.StorageDriver.Name(),
+			Operation:  operation,
+			Path:       path,
 			Enclosed:   e,
 		}
 
@@ -87,7 +102,7 @@ func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
 	}
 
 	b, e := base.StorageDriver.GetContent(ctx, path)
-	return b, base.setDriverName(e)
+	return b, base.formatError("GetContent", path, e)
 }
 
 // PutContent wraps PutContent of underlying storage driver.
@@ -99,7 +114,7 @@ func (base *Base) PutContent(ctx context.Context, path string, content []byte) e
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
-	return base.setDriverName(base.StorageDriver.PutContent(ctx, path, content))
+	return base.formatError("PutContent", path, base.StorageDriver.PutContent(ctx, path, content))
 }
 
 // ReadStream wraps ReadStream of underlying storage driver.
@@ -116,7 +131,7 @@ func (base *Base) ReadStream(ctx context.Context, path string, offset int64) (io
 	}
 
 	rc, e := base.StorageDriver.ReadStream(ctx, path, offset)
-	return rc, base.setDriverName(e)
+	return rc, base.formatError("ReadStream", path, e)
 }
 
 // WriteStream wraps WriteStream of underlying storage driver.
@@ -133,7 +148,7 @@ func (base *Base) WriteStream(ctx context.Context, path string, offset int64, re
 	}
 
 	i64, e := base.StorageDriver.WriteStream(ctx, path, offset, reader)
-	return i64, base.setDriverName(e)
+	return i64, base.formatError("WriteStream", path, e)
 }
 
 // Stat wraps Stat of underlying storage driver.
@@ -146,7 +161,39 @@ func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo
 	}
 
 	fi, e := base.StorageDriver.Stat(ctx, path)
-	return fi, base.setDriverName(e)
+	return fi, base.formatError("Stat", path, e)
+}
+
+// StatMany wraps StatMany of underlying storage driver, falling back to a
+// Stat call per path if the driver does not implement BatchStatter.
+func (base *Base) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.StatMany(%d paths)", base.Name(), len(paths))
+
+	infos := make([]storagedriver.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+
+	// Only valid paths are passed on, remembering their index in paths.
+	var valid []string
+	var indexes []int
+	for i, path := range paths {
+		if !storagedriver.PathRegexp.MatchString(path) {
+			errs[i] = storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+			continue
+		}
+		valid = append(valid, path)
+		indexes = append(indexes, i)
+	}
+
+	if len(valid) == 0 {
+		return infos, errs
+	}
+
+	fis, es := storagedriver.StatMany(ctx, base.StorageDriver, valid)
+	for j, i := range indexes {
+		infos[i], errs[i] = fis[j], base.formatError("StatMany", paths[i], es[j])
+	}
+	return infos, errs
 }
 
 // List wraps List of underlying storage driver.
@@ -159,7 +206,7 @@ func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 	}
 
 	str, e := base.StorageDriver.List(ctx, path)
-	return str, base.setDriverName(e)
+	return str, base.formatError("List", path, e)
 }
 
 // Move wraps Move of underlying storage driver.
@@ -173,7 +220,50 @@ func (base *Base) Move(ctx context.Context, sourcePath string, destPath string)
 		return storagedriver.InvalidPathError{Path: destPath, DriverName: base.StorageDriver.Name()}
 	}
 
-	return base.setDriverName(base.StorageDriver.Move(ctx, sourcePath, destPath))
+	return base.formatError("Move", sourcePath, base.StorageDriver.Move(ctx, sourcePath, destPath))
+}
+
+// Copy wraps Copy of underlying storage driver, falling back to reading and
+// writing the object if the driver does not implement Copier.
+func (base *Base) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.Copy(%q, %q)", base.Name(), sourcePath, destPath)
+
+	if !storagedriver.PathRegexp.MatchString(sourcePath) {
+		return storagedriver.InvalidPathError{Path: sourcePath, DriverName: base.StorageDriver.Name()}
+	} else if !storagedriver.PathRegexp.MatchString(destPath) {
+		return storagedriver.InvalidPathError{Path: destPath, DriverName: base.StorageDriver.Name()}
+	}
+
+	return base.formatError("Copy", sourcePath, storagedriver.Copy(ctx, base.StorageDriver, sourcePath, destPath))
+}
+
+// SetStorageClass wraps SetStorageClass of underlying storage driver,
+// returning ErrUnsupportedMethod if the driver does not implement
+// StorageClasser.
+func (base *Base) SetStorageClass(ctx context.Context, path string, class string) error {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.SetStorageClass(%q, %q)", base.Name(), path, class)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	return base.formatError("SetStorageClass", path, storagedriver.SetStorageClass(ctx, base.StorageDriver, path, class))
+}
+
+// Restore wraps Restore of underlying storage driver, reporting objects as
+// readable if the driver does not implement Restorer.
+func (base *Base) Restore(ctx context.Context, path string, days int) (bool, error) {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.Restore(%q, %d)", base.Name(), path, days)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return false, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	readable, err := storagedriver.Restore(ctx, base.StorageDriver, path, days)
+	return readable, base.formatError("Restore", path, err)
 }
 
 // Delete wraps Delete of underlying storage driver.
@@ -185,7 +275,7 @@ func (base *Base) Delete(ctx context.Context, path string) error {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
-	return base.setDriverName(base.StorageDriver.Delete(ctx, path))
+	return base.formatError("Delete", path, base.StorageDriver.Delete(ctx, path))
 }
 
 // URLFor wraps URLFor of underlying storage driver.
@@ -198,5 +288,5 @@ func (base *Base) URLFor(ctx context.Context, path string, options map[string]in
 	}
 
 	str, e := base.StorageDriver.URLFor(ctx, path, options)
-	return str, base.setDriverName(e)
+	return str, base.formatError("URLFor", path, e)
 }
@@ -0,0 +1,513 @@
+// Code generated by protoc-gen-go.
+// source: driver.proto
+// DO NOT EDIT!
+
+package external
+
+import proto "github.com/golang/protobuf/proto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+
+type Empty struct {
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+
+type PathRequest struct {
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+}
+
+func (m *PathRequest) Reset()         { *m = PathRequest{} }
+func (m *PathRequest) String() string { return proto.CompactTextString(m) }
+func (*PathRequest) ProtoMessage()    {}
+
+type ContentResponse struct {
+	Content []byte `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (m *ContentResponse) Reset()         { *m = ContentResponse{} }
+func (m *ContentResponse) String() string { return proto.CompactTextString(m) }
+func (*ContentResponse) ProtoMessage()    {}
+
+type PutContentRequest struct {
+	Path    string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Content []byte `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+}
+
+func (m *PutContentRequest) Reset()         { *m = PutContentRequest{} }
+func (m *PutContentRequest) String() string { return proto.CompactTextString(m) }
+func (*PutContentRequest) ProtoMessage()    {}
+
+type ReadStreamRequest struct {
+	Path   string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Offset int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *ReadStreamRequest) Reset()         { *m = ReadStreamRequest{} }
+func (m *ReadStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadStreamRequest) ProtoMessage()    {}
+
+type Chunk struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *Chunk) Reset()         { *m = Chunk{} }
+func (m *Chunk) String() string { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()    {}
+
+type WriteStreamRequest struct {
+	Path   string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Offset int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Data   []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *WriteStreamRequest) Reset()         { *m = WriteStreamRequest{} }
+func (m *WriteStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteStreamRequest) ProtoMessage()    {}
+
+type WriteStreamResponse struct {
+	Written int64 `protobuf:"varint,1,opt,name=written" json:"written,omitempty"`
+}
+
+func (m *WriteStreamResponse) Reset()         { *m = WriteStreamResponse{} }
+func (m *WriteStreamResponse) String() string { return proto.CompactTextString(m) }
+func (*WriteStreamResponse) ProtoMessage()    {}
+
+type FileInfo struct {
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Size int64  `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	// mod_time is the modification time, in nanoseconds since the epoch.
+	ModTime int64 `protobuf:"varint,3,opt,name=mod_time" json:"mod_time,omitempty"`
+	IsDir   bool  `protobuf:"varint,4,opt,name=is_dir" json:"is_dir,omitempty"`
+}
+
+func (m *FileInfo) Reset()         { *m = FileInfo{} }
+func (m *FileInfo) String() string { return proto.CompactTextString(m) }
+func (*FileInfo) ProtoMessage()    {}
+
+type ListResponse struct {
+	Paths []string `protobuf:"bytes,1,rep,name=paths" json:"paths,omitempty"`
+}
+
+func (m *ListResponse) Reset()         { *m = ListResponse{} }
+func (m *ListResponse) String() string { return proto.CompactTextString(m) }
+func (*ListResponse) ProtoMessage()    {}
+
+type MoveRequest struct {
+	SourcePath string `protobuf:"bytes,1,opt,name=source_path" json:"source_path,omitempty"`
+	DestPath   string `protobuf:"bytes,2,opt,name=dest_path" json:"dest_path,omitempty"`
+}
+
+func (m *MoveRequest) Reset()         { *m = MoveRequest{} }
+func (m *MoveRequest) String() string { return proto.CompactTextString(m) }
+func (*MoveRequest) ProtoMessage()    {}
+
+type URLForRequest struct {
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// options holds the options of the request. The "expiry" option is an
+	// RFC 3339 timestamp.
+	Options map[string]string `protobuf:"bytes,2,rep,name=options" json:"options,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *URLForRequest) Reset()         { *m = URLForRequest{} }
+func (m *URLForRequest) String() string { return proto.CompactTextString(m) }
+func (*URLForRequest) ProtoMessage()    {}
+
+func (m *URLForRequest) GetOptions() map[string]string {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+type URLForResponse struct {
+	Url string `protobuf:"bytes,1,opt,name=url" json:"url,omitempty"`
+}
+
+func (m *URLForResponse) Reset()         { *m = URLForResponse{} }
+func (m *URLForResponse) String() string { return proto.CompactTextString(m) }
+func (*URLForResponse) ProtoMessage()    {}
+
+func init() {
+}
+
+// Client API for StorageDriver service
+
+type StorageDriverClient interface {
+	// GetContent retrieves the content stored at a path.
+	GetContent(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*ContentResponse, error)
+	// PutContent stores content at a path.
+	PutContent(ctx context.Context, in *PutContentRequest, opts ...grpc.CallOption) (*Empty, error)
+	// ReadStream streams the content stored at a path, from an offset.
+	ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (StorageDriver_ReadStreamClient, error)
+	// WriteStream stores the streamed content at a path, from an offset.
+	// Only the first message carries the path and offset.
+	WriteStream(ctx context.Context, opts ...grpc.CallOption) (StorageDriver_WriteStreamClient, error)
+	// Stat retrieves the FileInfo of a path.
+	Stat(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	// List returns the direct descendants of a path.
+	List(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Move moves the object stored at a path to another.
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Delete recursively deletes a path.
+	Delete(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*Empty, error)
+	// URLFor returns a URL the content stored at a path may be retrieved
+	// from.
+	URLFor(ctx context.Context, in *URLForRequest, opts ...grpc.CallOption) (*URLForResponse, error)
+}
+
+type storageDriverClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewStorageDriverClient(cc *grpc.ClientConn) StorageDriverClient {
+	return &storageDriverClient{cc}
+}
+
+func (c *storageDriverClient) GetContent(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*ContentResponse, error) {
+	out := new(ContentResponse)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/GetContent", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) PutContent(ctx context.Context, in *PutContentRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/PutContent", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (StorageDriver_ReadStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_StorageDriver_serviceDesc.Streams[0], c.cc, "/storagedriver.StorageDriver/ReadStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storageDriverReadStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type StorageDriver_ReadStreamClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type storageDriverReadStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *storageDriverReadStreamClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *storageDriverClient) WriteStream(ctx context.Context, opts ...grpc.CallOption) (StorageDriver_WriteStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_StorageDriver_serviceDesc.Streams[1], c.cc, "/storagedriver.StorageDriver/WriteStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storageDriverWriteStreamClient{stream}
+	return x, nil
+}
+
+type StorageDriver_WriteStreamClient interface {
+	Send(*WriteStreamRequest) error
+	CloseAndRecv() (*WriteStreamResponse, error)
+	grpc.ClientStream
+}
+
+type storageDriverWriteStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *storageDriverWriteStreamClient) Send(m *WriteStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *storageDriverWriteStreamClient) CloseAndRecv() (*WriteStreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *storageDriverClient) Stat(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	out := new(FileInfo)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/Stat", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) List(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/List", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/Move", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) Delete(ctx context.Context, in *PathRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/Delete", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storageDriverClient) URLFor(ctx context.Context, in *URLForRequest, opts ...grpc.CallOption) (*URLForResponse, error) {
+	out := new(URLForResponse)
+	err := grpc.Invoke(ctx, "/storagedriver.StorageDriver/URLFor", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for StorageDriver service
+
+type StorageDriverServer interface {
+	// GetContent retrieves the content stored at a path.
+	GetContent(context.Context, *PathRequest) (*ContentResponse, error)
+	// PutContent stores content at a path.
+	PutContent(context.Context, *PutContentRequest) (*Empty, error)
+	// ReadStream streams the content stored at a path, from an offset.
+	ReadStream(*ReadStreamRequest, StorageDriver_ReadStreamServer) error
+	// WriteStream stores the streamed content at a path, from an offset.
+	// Only the first message carries the path and offset.
+	WriteStream(StorageDriver_WriteStreamServer) error
+	// Stat retrieves the FileInfo of a path.
+	Stat(context.Context, *PathRequest) (*FileInfo, error)
+	// List returns the direct descendants of a path.
+	List(context.Context, *PathRequest) (*ListResponse, error)
+	// Move moves the object stored at a path to another.
+	Move(context.Context, *MoveRequest) (*Empty, error)
+	// Delete recursively deletes a path.
+	Delete(context.Context, *PathRequest) (*Empty, error)
+	// URLFor returns a URL the content stored at a path may be retrieved
+	// from.
+	URLFor(context.Context, *URLForRequest) (*URLForResponse, error)
+}
+
+func RegisterStorageDriverServer(s *grpc.Server, srv StorageDriverServer) {
+	s.RegisterService(&_StorageDriver_serviceDesc, srv)
+}
+
+func _StorageDriver_GetContent_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PathRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).GetContent(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_PutContent_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PutContentRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).PutContent(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_ReadStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StorageDriverServer).ReadStream(m, &storageDriverReadStreamServer{stream})
+}
+
+type StorageDriver_ReadStreamServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type storageDriverReadStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *storageDriverReadStreamServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _StorageDriver_WriteStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StorageDriverServer).WriteStream(&storageDriverWriteStreamServer{stream})
+}
+
+type StorageDriver_WriteStreamServer interface {
+	SendAndClose(*WriteStreamResponse) error
+	Recv() (*WriteStreamRequest, error)
+	grpc.ServerStream
+}
+
+type storageDriverWriteStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *storageDriverWriteStreamServer) SendAndClose(m *WriteStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *storageDriverWriteStreamServer) Recv() (*WriteStreamRequest, error) {
+	m := new(WriteStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _StorageDriver_Stat_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PathRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).Stat(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_List_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PathRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).List(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_Move_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).Move(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_Delete_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PathRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).Delete(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _StorageDriver_URLFor_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(URLForRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(StorageDriverServer).URLFor(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _StorageDriver_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "storagedriver.StorageDriver",
+	HandlerType: (*StorageDriverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetContent",
+			Handler:    _StorageDriver_GetContent_Handler,
+		},
+		{
+			MethodName: "PutContent",
+			Handler:    _StorageDriver_PutContent_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _StorageDriver_Stat_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _StorageDriver_List_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _StorageDriver_Move_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _StorageDriver_Delete_Handler,
+		},
+		{
+			MethodName: "URLFor",
+			Handler:    _StorageDriver_URLFor_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReadStream",
+			Handler:       _StorageDriver_ReadStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WriteStream",
+			Handler:       _StorageDriver_WriteStream_Handler,
+			ClientStreams: true,
+		},
+	},
+}
@@ -0,0 +1,354 @@
+// Package external provides a storagedriver.StorageDriver implementation
+// which forwards every operation to a storage driver running in an external
+// process, over the gRPC protocol defined in driver.proto. This allows storage
+// drivers to be provided out-of-tree, without recompiling the registry.
+//
+// An external driver is served by a process calling Serve with a storage
+// driver, and used by the registry with the following configuration:
+//
+//	storage:
+//	  external:
+//	    address: unix:///run/registry/driver.sock
+package external
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/base"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const driverName = "external"
+
+const defaultDialTimeout = 10 * time.Second
+
+// chunkSize is the size of the chunks streamed content is sent in.
+const chunkSize = 64 << 10
+
+// DriverParameters is a struct that encapsulates all of the driver parameters
+// after all values have been set
+type DriverParameters struct {
+	// Address is the address the external driver listens on, either
+	// "host:port" or "unix:///path/to/socket".
+	Address     string
+	DialTimeout time.Duration
+}
+
+func init() {
+	factory.Register(driverName, &externalDriverFactory{})
+}
+
+// externalDriverFactory implements the factory.StorageDriverFactory interface
+type externalDriverFactory struct{}
+
+func (factory *externalDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return FromParameters(parameters)
+}
+
+func (*externalDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the parameters of the client side of the
+// external driver; the driver service is configured on its own.
+var describedParameters = []factory.Parameter{
+	{Name: "address", Type: factory.TypeString, Required: true, Description: "address of the gRPC service of the driver"},
+	{Name: "dialtimeout", Type: factory.TypeDuration, Default: defaultDialTimeout.String(), Description: "timeout of connecting to the driver"},
+}
+
+type driver struct {
+	conn   *grpc.ClientConn
+	client StorageDriverClient
+}
+
+type baseEmbed struct {
+	base.Base
+}
+
+// Driver is a storagedriver.StorageDriver implementation backed by a storage
+// driver running in an external process.
+type Driver struct {
+	baseEmbed
+}
+
+var _ storagedriver.StorageDriver = &Driver{}
+
+// FromParameters constructs a new Driver with a given parameters map
+// Required parameters:
+// - address
+// Optional parameters:
+// - dialtimeout
+func FromParameters(parameters map[string]interface{}) (*Driver, error) {
+	params := DriverParameters{
+		DialTimeout: defaultDialTimeout,
+	}
+
+	address, ok := parameters["address"]
+	if !ok || fmt.Sprint(address) == "" {
+		return nil, fmt.Errorf("No address parameter provided")
+	}
+	params.Address = fmt.Sprint(address)
+
+	if dialTimeout, ok := parameters["dialtimeout"]; ok {
+		switch v := dialTimeout.(type) {
+		case time.Duration:
+			params.DialTimeout = v
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("dialtimeout parameter must be a duration: %v", err)
+			}
+			params.DialTimeout = d
+		default:
+			return nil, fmt.Errorf("dialtimeout parameter must be a duration: %v", v)
+		}
+	}
+
+	return New(params)
+}
+
+// New constructs a new Driver connected to the external driver at
+// params.Address. The connection is established in the background and
+// re-established when it fails.
+func New(params DriverParameters) (*Driver, error) {
+	network, address := splitAddress(params.Address)
+	conn, err := grpc.Dial(address,
+		grpc.WithTimeout(params.DialTimeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout(network, addr, timeout)
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		baseEmbed: baseEmbed{
+			Base: base.Base{
+				StorageDriver: &driver{
+					conn:   conn,
+					client: NewStorageDriverClient(conn),
+				},
+			},
+		},
+	}, nil
+}
+
+// splitAddress returns the network and address of an address of the form
+// "host:port" or "unix:///path/to/socket".
+func splitAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix://") {
+		return "unix", strings.TrimPrefix(address, "unix://")
+	}
+	return "tcp", address
+}
+
+// Implement the storagedriver.StorageDriver interface
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	resp, err := d.client.GetContent(ctx, &PathRequest{Path: path})
+	if err != nil {
+		return nil, fromRPCError(err, path, 0)
+	}
+	return resp.Content, nil
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *driver) PutContent(ctx context.Context, path string, contents []byte) error {
+	_, err := d.client.PutContent(ctx, &PutContentRequest{Path: path, Content: contents})
+	return fromRPCError(err, path, 0)
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *driver) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	ctx, cancel := netcontext.WithCancel(ctx)
+	stream, err := d.client.ReadStream(ctx, &ReadStreamRequest{Path: path, Offset: offset})
+	if err != nil {
+		cancel()
+		return nil, fromRPCError(err, path, offset)
+	}
+
+	// Receive the first chunk, so that errors opening the content are
+	// returned here rather than by the first read.
+	r := &streamReader{recv: stream.Recv, cancel: cancel}
+	chunk, err := stream.Recv()
+	switch err {
+	case nil:
+		r.buf = chunk.Data
+	case io.EOF:
+		r.err = io.EOF
+	default:
+		cancel()
+		return nil, fromRPCError(err, path, offset)
+	}
+	return r, nil
+}
+
+// WriteStream stores the contents of the provided io.Reader at a
+// location designated by the given path.
+func (d *driver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	stream, err := d.client.WriteStream(ctx)
+	if err != nil {
+		return 0, fromRPCError(err, path, offset)
+	}
+
+	var readErr error
+	buf := make([]byte, chunkSize)
+	req := &WriteStreamRequest{Path: path, Offset: offset}
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if n > 0 || req.Path != "" {
+			req.Data = buf[:n]
+			if stream.Send(req) != nil {
+				// The external driver failed, the error is returned by
+				// CloseAndRecv.
+				break
+			}
+			req = &WriteStreamRequest{}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, fromRPCError(err, path, offset)
+	}
+	return resp.Written, readErr
+}
+
+// Stat retrieves the FileInfo for the given path, including the current size
+// in bytes and the creation time.
+func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	resp, err := d.client.Stat(ctx, &PathRequest{Path: path})
+	if err != nil {
+		return nil, fromRPCError(err, path, 0)
+	}
+
+	return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+		Path:    resp.Path,
+		Size:    resp.Size,
+		ModTime: time.Unix(0, resp.ModTime),
+		IsDir:   resp.IsDir,
+	}}, nil
+}
+
+// List returns a list of the objects that are direct descendants of the given
+// path.
+func (d *driver) List(ctx context.Context, path string) ([]string, error) {
+	resp, err := d.client.List(ctx, &PathRequest{Path: path})
+	if err != nil {
+		return nil, fromRPCError(err, path, 0)
+	}
+	if resp.Paths == nil {
+		return []string{}, nil
+	}
+	return resp.Paths, nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object.
+func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	_, err := d.client.Move(ctx, &MoveRequest{SourcePath: sourcePath, DestPath: destPath})
+	return fromRPCError(err, sourcePath, 0)
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *driver) Delete(ctx context.Context, path string) error {
+	_, err := d.client.Delete(ctx, &PathRequest{Path: path})
+	return fromRPCError(err, path, 0)
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the
+// given path.
+func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	req := &URLForRequest{Path: path, Options: make(map[string]string, len(options))}
+	for k, v := range options {
+		if t, ok := v.(time.Time); ok {
+			req.Options[k] = t.Format(time.RFC3339Nano)
+			continue
+		}
+		req.Options[k] = fmt.Sprint(v)
+	}
+
+	resp, err := d.client.URLFor(ctx, req)
+	if err != nil {
+		return "", fromRPCError(err, path, 0)
+	}
+	return resp.Url, nil
+}
+
+// fromRPCError converts the error of an operation on path to the
+// corresponding storage driver error.
+func fromRPCError(err error, path string, offset int64) error {
+	switch grpc.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return storagedriver.PathNotFoundError{Path: path}
+	case codes.InvalidArgument:
+		return storagedriver.InvalidPathError{Path: path}
+	case codes.OutOfRange:
+		return storagedriver.InvalidOffsetError{Path: path, Offset: offset}
+	case codes.Unimplemented:
+		return storagedriver.ErrUnsupportedMethod{}
+	}
+	return err
+}
+
+// streamReader reads the chunks of a stream.
+type streamReader struct {
+	recv   func() (*Chunk, error)
+	cancel netcontext.CancelFunc
+	buf    []byte
+	err    error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		chunk, err := r.recv()
+		if err != nil {
+			r.err = err
+			if err != io.EOF {
+				r.err = fromRPCError(err, "", 0)
+			}
+			continue
+		}
+		r.buf = chunk.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *streamReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,94 @@
+package external
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+
+	// Serve a filesystem driver from the test process, over a unix socket.
+	address := "unix://" + filepath.Join(root, "driver.sock")
+	l, err := Listen(address)
+	if err != nil {
+		panic(err)
+	}
+	go NewServer(filesystem.New(filepath.Join(root, "data"))).Serve(l)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return FromParameters(map[string]interface{}{"address": address})
+	}, testsuites.NeverSkip)
+}
+
+func TestFromParameters(t *testing.T) {
+	for _, parameters := range []map[string]interface{}{
+		{},
+		{"address": ""},
+		{"address": "localhost:5001", "dialtimeout": "soon"},
+	} {
+		if _, err := FromParameters(parameters); err == nil {
+			t.Errorf("expected parameters %v to be rejected", parameters)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	address := "unix://" + filepath.Join(root, "driver.sock")
+	l, err := Listen(address)
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	s := NewServer(filesystem.New(filepath.Join(root, "data")))
+	defer s.Stop()
+	go s.Serve(l)
+
+	d, err := New(DriverParameters{Address: address, DialTimeout: defaultDialTimeout})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.GetContent(ctx, "/missing"); err != (storagedriver.PathNotFoundError{Path: "/missing", DriverName: driverName}) {
+		t.Fatalf("expected a PathNotFoundError, got %#v", err)
+	}
+	if err := d.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+	if _, err := d.URLFor(ctx, "/a", nil); err != (storagedriver.ErrUnsupportedMethod{DriverName: driverName}) {
+		t.Fatalf("expected an ErrUnsupportedMethod, got %#v", err)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	for _, err := range []error{
+		storagedriver.PathNotFoundError{Path: "/a"},
+		storagedriver.InvalidPathError{Path: "/a"},
+		storagedriver.InvalidOffsetError{Path: "/a", Offset: 8},
+		storagedriver.ErrUnsupportedMethod{},
+	} {
+		if converted := fromRPCError(toRPCError(err), "/a", 8); converted != err {
+			t.Errorf("expected %#v to be preserved, got %#v", err, converted)
+		}
+	}
+}
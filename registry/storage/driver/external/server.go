@@ -0,0 +1,200 @@
+package external
+
+import (
+	"io"
+	"net"
+	"os"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	netcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// NewServer returns a gRPC server serving the operations of driver to the
+// registry.
+func NewServer(driver storagedriver.StorageDriver) *grpc.Server {
+	s := grpc.NewServer()
+	RegisterStorageDriverServer(s, &driverServer{driver: driver})
+	return s
+}
+
+// Listen listens on an address of the form "host:port" or
+// "unix:///path/to/socket". A stale socket file is removed first.
+func Listen(address string) (net.Listener, error) {
+	network, address := splitAddress(address)
+	if network == "unix" {
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// Serve serves the operations of driver on address, until it fails. A
+// storage driver provided out-of-tree is run as an external process calling
+// Serve, for example
+//
+//	func main() {
+//		log.Fatal(external.Serve("unix:///run/registry/driver.sock", bos.New()))
+//	}
+func Serve(address string, driver storagedriver.StorageDriver) error {
+	l, err := Listen(address)
+	if err != nil {
+		return err
+	}
+	return NewServer(driver).Serve(l)
+}
+
+// driverServer implements the StorageDriverServer interface on top of a
+// storage driver.
+type driverServer struct {
+	driver storagedriver.StorageDriver
+}
+
+var _ StorageDriverServer = &driverServer{}
+
+func (s *driverServer) GetContent(ctx netcontext.Context, req *PathRequest) (*ContentResponse, error) {
+	content, err := s.driver.GetContent(ctx, req.Path)
+	if err != nil {
+		return nil, toRPCError(err)
+	}
+	return &ContentResponse{Content: content}, nil
+}
+
+func (s *driverServer) PutContent(ctx netcontext.Context, req *PutContentRequest) (*Empty, error) {
+	if err := s.driver.PutContent(ctx, req.Path, req.Content); err != nil {
+		return nil, toRPCError(err)
+	}
+	return &Empty{}, nil
+}
+
+func (s *driverServer) ReadStream(req *ReadStreamRequest, stream StorageDriver_ReadStreamServer) error {
+	rc, err := s.driver.ReadStream(stream.Context(), req.Path, req.Offset)
+	if err != nil {
+		return toRPCError(err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&Chunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return toRPCError(err)
+		}
+	}
+}
+
+func (s *driverServer) WriteStream(stream StorageDriver_WriteStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	r := &requestReader{recv: stream.Recv, buf: req.Data}
+	written, err := s.driver.WriteStream(stream.Context(), req.Path, req.Offset, r)
+	if err != nil {
+		return toRPCError(err)
+	}
+	return stream.SendAndClose(&WriteStreamResponse{Written: written})
+}
+
+func (s *driverServer) Stat(ctx netcontext.Context, req *PathRequest) (*FileInfo, error) {
+	fi, err := s.driver.Stat(ctx, req.Path)
+	if err != nil {
+		return nil, toRPCError(err)
+	}
+	return &FileInfo{
+		Path:    fi.Path(),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime().UnixNano(),
+		IsDir:   fi.IsDir(),
+	}, nil
+}
+
+func (s *driverServer) List(ctx netcontext.Context, req *PathRequest) (*ListResponse, error) {
+	paths, err := s.driver.List(ctx, req.Path)
+	if err != nil {
+		return nil, toRPCError(err)
+	}
+	return &ListResponse{Paths: paths}, nil
+}
+
+func (s *driverServer) Move(ctx netcontext.Context, req *MoveRequest) (*Empty, error) {
+	if err := s.driver.Move(ctx, req.SourcePath, req.DestPath); err != nil {
+		return nil, toRPCError(err)
+	}
+	return &Empty{}, nil
+}
+
+func (s *driverServer) Delete(ctx netcontext.Context, req *PathRequest) (*Empty, error) {
+	if err := s.driver.Delete(ctx, req.Path); err != nil {
+		return nil, toRPCError(err)
+	}
+	return &Empty{}, nil
+}
+
+func (s *driverServer) URLFor(ctx netcontext.Context, req *URLForRequest) (*URLForResponse, error) {
+	options := make(map[string]interface{}, len(req.Options))
+	for k, v := range req.Options {
+		options[k] = v
+	}
+	if expiry, ok := req.Options["expiry"]; ok {
+		t, err := time.Parse(time.RFC3339Nano, expiry)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid expiry: %v", err)
+		}
+		options["expiry"] = t
+	}
+
+	url, err := s.driver.URLFor(ctx, req.Path, options)
+	if err != nil {
+		return nil, toRPCError(err)
+	}
+	return &URLForResponse{Url: url}, nil
+}
+
+// toRPCError converts a storage driver error to the error reported to the
+// registry.
+func toRPCError(err error) error {
+	switch err := err.(type) {
+	case storagedriver.PathNotFoundError:
+		return grpc.Errorf(codes.NotFound, "%v", err)
+	case storagedriver.InvalidPathError:
+		return grpc.Errorf(codes.InvalidArgument, "%v", err)
+	case storagedriver.InvalidOffsetError:
+		return grpc.Errorf(codes.OutOfRange, "%v", err)
+	case storagedriver.ErrUnsupportedMethod:
+		return grpc.Errorf(codes.Unimplemented, "%v", err)
+	}
+	return grpc.Errorf(codes.Unknown, "%v", err)
+}
+
+// requestReader reads the data of the requests of a stream.
+type requestReader struct {
+	recv func() (*WriteStreamRequest, error)
+	buf  []byte
+}
+
+func (r *requestReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
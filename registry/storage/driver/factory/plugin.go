@@ -0,0 +1,18 @@
+package factory
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugin opens the Go plugin at path, making the storage drivers it
+// provides available by name. A plugin registers its drivers by calling
+// Register from an init function, exactly as the in-tree drivers do, so that
+// drivers can be provided out-of-tree without recompiling the registry.
+// Loading the same plugin more than once has no effect.
+func LoadPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("unable to load storage driver plugin %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package factory
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParameterType is the type of the value of a storage driver parameter.
+type ParameterType string
+
+const (
+	// TypeString parameters take a string.
+	TypeString ParameterType = "string"
+
+	// TypeBool parameters take a boolean.
+	TypeBool ParameterType = "bool"
+
+	// TypeInt parameters take an integer, or a string parsing as one.
+	TypeInt ParameterType = "int"
+
+	// TypeDuration parameters take a string parsing as a duration, such as
+	// "30s".
+	TypeDuration ParameterType = "duration"
+
+	// TypeList parameters take a list.
+	TypeList ParameterType = "list"
+
+	// TypeMap parameters take a map.
+	TypeMap ParameterType = "map"
+)
+
+// Parameter describes a parameter accepted by a storage driver.
+type Parameter struct {
+	Name     string
+	Type     ParameterType
+	Required bool
+
+	// Default is the value the driver uses when the parameter is not set,
+	// empty when there is none.
+	Default string
+
+	Description string
+}
+
+// ParameterDescriber is implemented by the StorageDriverFactory of drivers
+// describing the parameters they accept, so that configurations can be
+// checked against them and the parameters listed to operators. The
+// description must match the parameters read by the factory, as Validate
+// reports any other parameter as unknown; checks it cannot express, such as
+// the allowed values of a string, are left to the factory.
+type ParameterDescriber interface {
+	// Parameters returns the parameters accepted by the driver.
+	Parameters() []Parameter
+}
+
+// Drivers returns the names of the registered storage drivers, sorted.
+func Drivers() []string {
+	names := make([]string, 0, len(driverFactories))
+	for name := range driverFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parameters returns the parameters accepted by the named storage driver,
+// and false if its factory does not describe them. If no driver is
+// registered with the name, an InvalidStorageDriverError is returned.
+func Parameters(name string) ([]Parameter, bool, error) {
+	driverFactory, ok := driverFactories[name]
+	if !ok {
+		return nil, false, InvalidStorageDriverError{name}
+	}
+	describer, ok := driverFactory.(ParameterDescriber)
+	if !ok {
+		return nil, false, nil
+	}
+	return describer.Parameters(), true, nil
+}
+
+// ParameterErrors lists the problems found validating the parameters of a
+// storage driver.
+type ParameterErrors []error
+
+func (errs ParameterErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks parameters against the parameters described by the named
+// storage driver, reporting missing required parameters, unknown parameters
+// and values of the wrong type as ParameterErrors. The parameters of drivers
+// not describing them are not checked. If no driver is registered with the
+// name, an InvalidStorageDriverError is returned.
+func Validate(name string, parameters map[string]interface{}) error {
+	described, ok, err := Parameters(name)
+	if err != nil || !ok {
+		return err
+	}
+
+	known := make(map[string]Parameter, len(described))
+	var errs ParameterErrors
+	for _, p := range described {
+		known[p.Name] = p
+		if v, ok := parameters[p.Name]; p.Required && (!ok || v == nil || v == "") {
+			errs = append(errs, fmt.Errorf("%s: missing required %s parameter", name, p.Name))
+		}
+	}
+
+	names := make([]string, 0, len(parameters))
+	for k := range parameters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		p, ok := known[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown parameter %s", name, k))
+			continue
+		}
+		if v := parameters[k]; v != nil && !p.Type.accepts(v) {
+			errs = append(errs, fmt.Errorf("%s: %s parameter must be of type %s, %#v invalid", name, k, p.Type, v))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// accepts reports whether v is a valid value of the type.
+func (t ParameterType) accepts(v interface{}) bool {
+	switch t {
+	case TypeString:
+		_, ok := v.(string)
+		return ok
+	case TypeBool:
+		_, ok := v.(bool)
+		return ok
+	case TypeInt:
+		switch v := v.(type) {
+		case int, int64:
+			return true
+		case string:
+			_, err := strconv.Atoi(v)
+			return err == nil
+		}
+	case TypeDuration:
+		switch v := v.(type) {
+		case time.Duration:
+			return true
+		case string:
+			_, err := time.ParseDuration(v)
+			return err == nil
+		}
+	case TypeList:
+		switch v.(type) {
+		case []interface{}, []string:
+			return true
+		}
+	case TypeMap:
+		switch v.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package factory
+
+import (
+	"reflect"
+	"testing"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+type describedDriverFactory struct{}
+
+func (describedDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return nil, nil
+}
+
+func (describedDriverFactory) Parameters() []Parameter {
+	return []Parameter{
+		{Name: "bucket", Type: TypeString, Required: true},
+		{Name: "secure", Type: TypeBool, Default: "true"},
+		{Name: "chunksize", Type: TypeInt},
+		{Name: "timeout", Type: TypeDuration},
+		{Name: "hosts", Type: TypeList},
+		{Name: "mapping", Type: TypeMap},
+	}
+}
+
+type undescribedDriverFactory struct{}
+
+func (undescribedDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return nil, nil
+}
+
+func TestValidate(t *testing.T) {
+	Register("schematest-described", describedDriverFactory{})
+	Register("schematest-undescribed", undescribedDriverFactory{})
+
+	if err := Validate("schematest-described", map[string]interface{}{
+		"bucket":    "registry",
+		"secure":    false,
+		"chunksize": "1024",
+		"timeout":   "30s",
+		"hosts":     []interface{}{"a", "b"},
+		"mapping":   map[interface{}]interface{}{"a": "b"},
+	}); err != nil {
+		t.Fatalf("unexpected error validating parameters: %v", err)
+	}
+
+	err := Validate("schematest-described", map[string]interface{}{
+		"secure":    "yes",
+		"chunksize": "big",
+		"timeout":   30,
+		"buckte":    "registry",
+	})
+	errs, ok := err.(ParameterErrors)
+	if !ok {
+		t.Fatalf("expected parameter errors, got %v", err)
+	}
+	expected := []string{
+		"schematest-described: missing required bucket parameter",
+		"schematest-described: unknown parameter buckte",
+		`schematest-described: chunksize parameter must be of type int, "big" invalid`,
+		`schematest-described: secure parameter must be of type bool, "yes" invalid`,
+		"schematest-described: timeout parameter must be of type duration, 30 invalid",
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("unexpected errors %q, expected %q", msgs, expected)
+	}
+
+	if err := Validate("schematest-undescribed", map[string]interface{}{"anything": 1}); err != nil {
+		t.Fatalf("unexpected error validating parameters of an undescribed driver: %v", err)
+	}
+	if _, ok := Validate("schematest-missing", nil).(InvalidStorageDriverError); !ok {
+		t.Fatalf("expected an error validating the parameters of an unregistered driver")
+	}
+
+	if _, described, _ := Parameters("schematest-undescribed"); described {
+		t.Fatalf("expected the parameters of the driver not to be described")
+	}
+	var found bool
+	for _, name := range Drivers() {
+		found = found || name == "schematest-described"
+	}
+	if !found {
+		t.Fatalf("expected the driver to be listed in %v", Drivers())
+	}
+}
@@ -29,6 +29,16 @@ func (factory *filesystemDriverFactory) Create(parameters map[string]interface{}
 	return FromParameters(parameters), nil
 }
 
+func (*filesystemDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists rootdirectory, the only parameter of the
+// filesystem driver.
+var describedParameters = []factory.Parameter{
+	{Name: "rootdirectory", Type: factory.TypeString, Default: defaultRootDirectory, Description: "directory storing the files"},
+}
+
 type driver struct {
 	rootDirectory string
 }
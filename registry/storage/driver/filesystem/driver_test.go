@@ -13,6 +13,8 @@ import (
 // Hook up gocheck into the "go test" runner.
 func Test(t *testing.T) { TestingT(t) }
 
+var filesystemDriverConstructor testsuites.DriverConstructor
+
 func init() {
 	root, err := ioutil.TempDir("", "driver-")
 	if err != nil {
@@ -20,7 +22,12 @@ func init() {
 	}
 	defer os.Remove(root)
 
-	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+	filesystemDriverConstructor = func() (storagedriver.StorageDriver, error) {
 		return New(root), nil
-	}, testsuites.NeverSkip)
+	}
+	testsuites.RegisterSuite(filesystemDriverConstructor, testsuites.NeverSkip)
+}
+
+func BenchmarkDriver(b *testing.B) {
+	testsuites.BenchmarkDriver(b, filesystemDriverConstructor, testsuites.NeverSkip)
 }
@@ -69,6 +69,19 @@ func (factory *gcsDriverFactory) Create(parameters map[string]interface{}) (stor
 	return FromParameters(parameters)
 }
 
+func (*gcsDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the bucket and credentials of the GCS driver.
+// Without keyfile, the credentials are looked up by the Google client as
+// application default credentials.
+var describedParameters = []factory.Parameter{
+	{Name: "bucket", Type: factory.TypeString, Required: true, Description: "bucket storing the objects"},
+	{Name: "keyfile", Type: factory.TypeString, Description: "JSON key file of a service account, defaulting to the application default credentials"},
+	{Name: "rootdirectory", Type: factory.TypeString, Description: "prefix of the names of the objects"},
+}
+
 // driver is a storagedriver.StorageDriver implementation backed by GCS
 // Objects are stored at absolute keys in the provided bucket.
 type driver struct {
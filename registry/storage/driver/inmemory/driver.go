@@ -27,6 +27,11 @@ func (factory *inMemoryDriverFactory) Create(parameters map[string]interface{})
 	return New(), nil
 }
 
+// Parameters returns no parameters, the driver taking none.
+func (*inMemoryDriverFactory) Parameters() []factory.Parameter {
+	return nil
+}
+
 type driver struct {
 	root  *dir
 	mutex sync.RWMutex
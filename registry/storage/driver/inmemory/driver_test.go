@@ -11,9 +11,14 @@ import (
 // Hook up gocheck into the "go test" runner.
 func Test(t *testing.T) { check.TestingT(t) }
 
+func inmemoryDriverConstructor() (storagedriver.StorageDriver, error) {
+	return New(), nil
+}
+
 func init() {
-	inmemoryDriverConstructor := func() (storagedriver.StorageDriver, error) {
-		return New(), nil
-	}
 	testsuites.RegisterSuite(inmemoryDriverConstructor, testsuites.NeverSkip)
 }
+
+func BenchmarkDriver(b *testing.B) {
+	testsuites.BenchmarkDriver(b, inmemoryDriverConstructor, testsuites.NeverSkip)
+}
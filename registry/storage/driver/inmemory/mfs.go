@@ -305,7 +305,14 @@ func (f *file) WriteAt(p []byte, offset int64) (n int, err error) {
 	}
 
 	f.mod = time.Now()
-	f.data = f.data[:off+len(p)]
+	if end := len(f.data); end < off+len(p) {
+		// Writes never truncate, but extend the file, zeroing any gap left
+		// before offset by a previous truncate.
+		f.data = f.data[:off+len(p)]
+		for i := end; i < off; i++ {
+			f.data[i] = 0
+		}
+	}
 
 	return copy(f.data[off:off+len(p)], p), nil
 }
@@ -10,13 +10,15 @@ package kodo
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"qiniupkg.com/api.v7/kodo"
@@ -27,13 +29,26 @@ import (
 
 	"github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/appendable"
 	"github.com/docker/distribution/registry/storage/driver/base"
 	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/version"
 )
 
 const driverName = "kodo"
 const listMax = 1000
 const defaultExpiry = 3600
+const defaultSessionTTL = 24 * time.Hour
+const defaultConnectTimeout = 30 * time.Second
+const defaultReadTimeout = 5 * time.Minute
+const defaultWriteTimeout = 5 * time.Minute
+const defaultMaxIdleConns = 100
+const defaultMaxIdleConnsPerHost = 100
+const defaultIdleConnTimeout = 90 * time.Second
+
+// putParts combines parts into the object at a key. It is a variable so that
+// tests against a fake KODO server can replace it.
+var putParts = qiniurs.PutParts
 
 // DriverParameters A struct that encapsulates all of the driver parameters after all values have been set
 type DriverParameters struct {
@@ -41,6 +56,59 @@ type DriverParameters struct {
 	Bucket        string
 	BaseURL       string
 	RootDirectory string
+	SessionTTL    time.Duration
+
+	// ConnectTimeout, ReadTimeout and WriteTimeout bound connecting to KODO
+	// and each read and write on a connection. They do not apply if
+	// Config.Transport is set.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout limit the
+	// connections to KODO kept open for reuse. They do not apply if
+	// Config.Transport is set.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// Replicas are buckets holding copies of the objects of the bucket,
+	// which ReadStream and URLFor read from as chosen by ReplicaRouting,
+	// static or latency. Writes always go to the bucket. Reads missing
+	// from a replica, which may lag behind, fall back to the bucket.
+	Replicas             []ReplicaParameters
+	ReplicaRouting       string
+	ReplicaProbeInterval time.Duration
+
+	// HostBaseURLs maps the hostnames clients reach the registry by to the
+	// base URLs of the bucket URLFor signs URLs with for them, so that
+	// clients on another network, such as an internal one, are redirected
+	// to a domain of the bucket they can reach. URLs of replicas are not
+	// rewritten.
+	HostBaseURLs map[string]string
+
+	// ListMax is the number of keys listed per request, at most 1000.
+	// ListPagination is the pagination strategy of listings failing
+	// partway, restart or resume.
+	ListMax        int
+	ListPagination string
+
+	// DeleteAfterDays, if positive, has Delete of paths holding more keys
+	// than ListMax set the lifecycle of their keys to be deleted by KODO
+	// after that many days, instead of deleting them one by one.
+	DeleteAfterDays int
+
+	// UserAgent is sent along with the requests to KODO, which also carry
+	// the id of the registry request they serve, if any.
+	UserAgent string
+
+	// MaxUploads, MaxDownloads and MaxLists, if positive, limit the uploads,
+	// downloads and listing requests made to KODO concurrently. Operations
+	// beyond the limits wait for others to complete.
+	MaxUploads   int
+	MaxDownloads int
+	MaxLists     int
+
 	kodo.Config
 }
 
@@ -55,6 +123,44 @@ func (factory *kodoDriverFactory) Create(parameters map[string]interface{}) (sto
 	return FromParameters(parameters)
 }
 
+func (*kodoDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the parameters of the KODO driver. Each of the
+// replicas is a map with the keys of the parameters of the primary bucket,
+// checked by parseReplicas rather than described here.
+var describedParameters = []factory.Parameter{
+	{Name: "bucket", Type: factory.TypeString, Required: true, Description: "bucket storing the objects"},
+	{Name: "baseurl", Type: factory.TypeString, Required: true, Description: "base URL of the domain of the bucket, objects are read from"},
+	{Name: "accesskey", Type: factory.TypeString, Required: true, Description: "access key of the account"},
+	{Name: "secretkey", Type: factory.TypeString, Required: true, Description: "secret key of the account"},
+	{Name: "zone", Type: factory.TypeInt, Default: "0", Description: "zone of the bucket"},
+	{Name: "rootdirectory", Type: factory.TypeString, Description: "prefix of the keys of the objects"},
+	{Name: "rshost", Type: factory.TypeString, Description: "host of the resource management API"},
+	{Name: "rsfhost", Type: factory.TypeString, Description: "host of the listing API"},
+	{Name: "iohost", Type: factory.TypeString, Description: "host of the download API"},
+	{Name: "uphosts", Type: factory.TypeList, Description: "hosts of the upload API"},
+	{Name: "sessionttl", Type: factory.TypeDuration, Default: defaultSessionTTL.String(), Description: "time the progress of failed uploads is kept for a retry"},
+	{Name: "connecttimeout", Type: factory.TypeDuration, Default: defaultConnectTimeout.String(), Description: "timeout of connecting to KODO"},
+	{Name: "readtimeout", Type: factory.TypeDuration, Default: defaultReadTimeout.String(), Description: "timeout of each read on a connection"},
+	{Name: "writetimeout", Type: factory.TypeDuration, Default: defaultWriteTimeout.String(), Description: "timeout of each write on a connection"},
+	{Name: "maxidleconns", Type: factory.TypeInt, Default: strconv.Itoa(defaultMaxIdleConns), Description: "idle connections kept open"},
+	{Name: "maxidleconnsperhost", Type: factory.TypeInt, Default: strconv.Itoa(defaultMaxIdleConnsPerHost), Description: "idle connections kept open per host"},
+	{Name: "idleconntimeout", Type: factory.TypeDuration, Default: defaultIdleConnTimeout.String(), Description: "time idle connections are kept open"},
+	{Name: "replicas", Type: factory.TypeList, Description: "buckets holding copies of the objects, read from instead of the bucket"},
+	{Name: "replicarouting", Type: factory.TypeString, Default: routingStatic, Description: "how reads are routed to replicas, " + routingStatic + " or " + routingLatency},
+	{Name: "replicaprobeinterval", Type: factory.TypeDuration, Default: defaultReplicaProbeInterval.String(), Description: "interval of the latency probes of replicas"},
+	{Name: "hostbaseurls", Type: factory.TypeMap, Description: "base URLs of redirects by hostname of the registry"},
+	{Name: "listmax", Type: factory.TypeInt, Default: strconv.Itoa(listMax), Description: "keys listed per request, at most " + strconv.Itoa(listMax)},
+	{Name: "listpagination", Type: factory.TypeString, Default: paginationRestart, Description: "pagination of listings failing partway, " + paginationRestart + " or " + paginationResume},
+	{Name: "deleteafterdays", Type: factory.TypeInt, Default: "0", Description: "days after which KODO deletes the keys of large deleted paths, 0 to delete them one by one"},
+	{Name: "useragent", Type: factory.TypeString, Default: "distribution/<version>", Description: "User-Agent of the requests to KODO"},
+	{Name: "maxuploads", Type: factory.TypeInt, Default: "0", Description: "concurrent uploads, 0 for no limit"},
+	{Name: "maxdownloads", Type: factory.TypeInt, Default: "0", Description: "concurrent downloads, 0 for no limit"},
+	{Name: "maxlists", Type: factory.TypeInt, Default: "0", Description: "concurrent listing requests, 0 for no limit"},
+}
+
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 
 	var ok bool
@@ -85,14 +191,103 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 
 	params.RootDirectory, _ = parameters["rootdirectory"].(string)
 
+	durations := map[string]*time.Duration{
+		"sessionttl":      &params.SessionTTL,
+		"connecttimeout":  &params.ConnectTimeout,
+		"readtimeout":     &params.ReadTimeout,
+		"writetimeout":    &params.WriteTimeout,
+		"idleconntimeout": &params.IdleConnTimeout,
+
+		"replicaprobeinterval": &params.ReplicaProbeInterval,
+	}
+	for name, value := range durations {
+		if s, ok := parameters[name].(string); ok && s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s parameter %q: %v", name, s, err)
+			}
+			*value = d
+		}
+	}
+
+	ints := map[string]*int{
+		"maxidleconns":        &params.MaxIdleConns,
+		"maxidleconnsperhost": &params.MaxIdleConnsPerHost,
+		"listmax":             &params.ListMax,
+		"deleteafterdays":     &params.DeleteAfterDays,
+		"maxuploads":          &params.MaxUploads,
+		"maxdownloads":        &params.MaxDownloads,
+		"maxlists":            &params.MaxLists,
+	}
+	for name, value := range ints {
+		switch v := parameters[name].(type) {
+		case nil:
+		case string:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s parameter must be an integer, %v invalid", name, v)
+			}
+			*value = i
+		case int:
+			*value = v
+		default:
+			return nil, fmt.Errorf("invalid value for %s: %#v", name, v)
+		}
+	}
+
 	params.Config.RSHost, _ = parameters["rshost"].(string)
 	params.Config.RSFHost, _ = parameters["rsfhost"].(string)
 	params.Config.IoHost, _ = parameters["iohost"].(string)
 	params.Config.UpHosts, _ = parameters["uphosts"].([]string)
 
+	if replicas, ok := parameters["replicas"]; ok && replicas != nil {
+		var err error
+		params.Replicas, err = parseReplicas(replicas)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params.ReplicaRouting, _ = parameters["replicarouting"].(string)
+	params.ListPagination, _ = parameters["listpagination"].(string)
+	params.UserAgent, _ = parameters["useragent"].(string)
+
+	if hostBaseURLs, ok := parameters["hostbaseurls"]; ok && hostBaseURLs != nil {
+		var err error
+		params.HostBaseURLs, err = parseHostBaseURLs(hostBaseURLs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return New(params)
 }
 
+// parseHostBaseURLs parses the hostbaseurls parameter, a map of hostnames to
+// base URLs.
+func parseHostBaseURLs(value interface{}) (map[string]string, error) {
+	entries := make(map[string]interface{})
+	switch value := value.(type) {
+	case map[string]interface{}:
+		entries = value
+	case map[interface{}]interface{}:
+		for k, v := range value {
+			entries[fmt.Sprint(k)] = v
+		}
+	default:
+		return nil, fmt.Errorf("hostbaseurls parameter must be a map: %#v", value)
+	}
+
+	hostBaseURLs := make(map[string]string, len(entries))
+	for host, v := range entries {
+		baseURL, ok := v.(string)
+		if !ok || baseURL == "" {
+			return nil, fmt.Errorf("Invalid base URL for host %q: %#v", host, v)
+		}
+		hostBaseURLs[host] = baseURL
+	}
+	return hostBaseURLs, nil
+}
+
 type baseEmbed struct {
 	base.Base
 }
@@ -103,8 +298,86 @@ type Driver struct {
 
 func New(params DriverParameters) (*Driver, error) {
 
-	client := kodo.New(params.Zone, &params.Config)
-	bucket := client.Bucket(params.Bucket)
+	if params.ConnectTimeout == 0 {
+		params.ConnectTimeout = defaultConnectTimeout
+	}
+	if params.ReadTimeout == 0 {
+		params.ReadTimeout = defaultReadTimeout
+	}
+	if params.WriteTimeout == 0 {
+		params.WriteTimeout = defaultWriteTimeout
+	}
+	if params.MaxIdleConns == 0 {
+		params.MaxIdleConns = defaultMaxIdleConns
+	}
+	if params.MaxIdleConnsPerHost == 0 {
+		params.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if params.IdleConnTimeout == 0 {
+		params.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if params.Config.Transport == nil {
+		params.Config.Transport = newTransport(params)
+	}
+	if params.UserAgent == "" {
+		params.UserAgent = "distribution/" + version.Version
+	}
+	params.Config.Transport = &taggingTransport{RoundTripper: params.Config.Transport, userAgent: params.UserAgent}
+
+	switch params.ReplicaRouting {
+	case "":
+		params.ReplicaRouting = routingStatic
+	case routingStatic, routingLatency:
+	default:
+		return nil, fmt.Errorf("Invalid replicarouting parameter %q, must be %s or %s", params.ReplicaRouting, routingStatic, routingLatency)
+	}
+	if params.ReplicaProbeInterval <= 0 {
+		params.ReplicaProbeInterval = defaultReplicaProbeInterval
+	}
+
+	if params.ListMax == 0 {
+		params.ListMax = listMax
+	}
+	if params.ListMax < 0 || params.ListMax > listMax {
+		return nil, fmt.Errorf("Invalid listmax parameter %d, must be between 1 and %d", params.ListMax, listMax)
+	}
+	if params.DeleteAfterDays < 0 {
+		return nil, fmt.Errorf("Invalid deleteafterdays parameter %d, must not be negative", params.DeleteAfterDays)
+	}
+	limits := map[string]int{
+		"maxuploads":   params.MaxUploads,
+		"maxdownloads": params.MaxDownloads,
+		"maxlists":     params.MaxLists,
+	}
+	for name, limit := range limits {
+		if limit < 0 {
+			return nil, fmt.Errorf("Invalid %s parameter %d, must not be negative", name, limit)
+		}
+	}
+	switch params.ListPagination {
+	case "":
+		params.ListPagination = paginationRestart
+	case paginationRestart, paginationResume:
+	default:
+		return nil, fmt.Errorf("Invalid listpagination parameter %q, must be %s or %s", params.ListPagination, paginationRestart, paginationResume)
+	}
+
+	primary := newReadEndpoint(params.Zone, params.Bucket, params.BaseURL, &params.Config)
+
+	replicas := make([]*readEndpoint, len(params.Replicas))
+	for i := range params.Replicas {
+		replica := &params.Replicas[i]
+		if replica.Config.AccessKey == "" {
+			replica.Config.AccessKey = params.Config.AccessKey
+			replica.Config.SecretKey = params.Config.SecretKey
+		}
+		if replica.Config.Transport == nil {
+			replica.Config.Transport = params.Config.Transport
+		} else {
+			replica.Config.Transport = &taggingTransport{RoundTripper: replica.Config.Transport, userAgent: params.UserAgent}
+		}
+		replicas[i] = newReadEndpoint(replica.Zone, replica.Bucket, replica.BaseURL, &replica.Config)
+	}
 
 	params.RootDirectory = strings.TrimRight(params.RootDirectory, "/")
 
@@ -112,10 +385,37 @@ func New(params DriverParameters) (*Driver, error) {
 		params.BaseURL += "/"
 	}
 
+	hostBaseURLs := make(map[string]string, len(params.HostBaseURLs))
+	for host, baseURL := range params.HostBaseURLs {
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		hostBaseURLs[strings.ToLower(host)] = baseURL
+	}
+	params.HostBaseURLs = hostBaseURLs
+
+	if params.SessionTTL <= 0 {
+		params.SessionTTL = defaultSessionTTL
+	}
+
 	d := &driver{
-		params: params,
-		client: client,
-		bucket: &bucket,
+		params:   params,
+		client:   primary.client,
+		bucket:   primary.bucket,
+		primary:  primary,
+		replicas: replicas,
+		sessions: make(map[string]*uploadSession),
+		listings: make(map[string]*listing),
+		closed:   make(chan struct{}),
+
+		uploads:   newLimiter(params.MaxUploads),
+		downloads: newLimiter(params.MaxDownloads),
+		lists:     newLimiter(params.MaxLists),
+	}
+
+	go d.purgeSessions()
+	if len(replicas) > 0 {
+		go d.probeReplicas()
 	}
 
 	return &Driver{
@@ -131,6 +431,39 @@ type driver struct {
 	params DriverParameters
 	bucket *kodo.Bucket
 	client *kodo.Client
+
+	// primary reads from bucket, replicas from the configured replicas.
+	primary  *readEndpoint
+	replicas []*readEndpoint
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*uploadSession
+
+	listingsMu sync.Mutex
+	listings   map[string]*listing
+
+	// uploads, downloads and lists limit the concurrent operations of each
+	// kind.
+	uploads   limiter
+	downloads limiter
+	lists     limiter
+
+	// closed is closed along with the driver, stopping its background work.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Close stops purging the upload sessions and probing the replicas of the
+// driver. The driver must not be used once closed.
+func (d *Driver) Close() error {
+	d.StorageDriver.(*driver).close()
+	return nil
+}
+
+func (d *driver) close() {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+	})
 }
 
 // Name returns the human-readable "name" of the driver, useful in error
@@ -143,6 +476,7 @@ func (d *driver) Name() string {
 // GetContent retrieves the content stored at "path" as a []byte.
 // This should primarily be used for small objects.
 func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	ctx = withRequestID(ctx)
 
 	rc, err := d.ReadStream(ctx, path, 0)
 	if err != nil {
@@ -160,28 +494,64 @@ func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
 // PutContent stores the []byte content at a location designated by "path".
 // This should primarily be used for small objects.
 func (d *driver) PutContent(ctx context.Context, path string, content []byte) error {
+	ctx = withRequestID(ctx)
+
+	if err := d.uploads.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.uploads.release()
 
 	err := d.bucket.Put(ctx, nil, d.getKey(path), bytes.NewBuffer(content), int64(len(content)), nil)
-	return err
+	return providerError(err)
 }
 
 // ReadStream retrieves an io.ReadCloser for the content stored at "path"
 // with a given byte offset.
 // May be used to resume reading a stream by providing a nonzero offset.
 func (d *driver) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	ctx = withRequestID(ctx)
+
+	if e := d.routeRead(); e != d.primary {
+		rc, err := d.readStream(ctx, e, path, offset)
+		if err == nil {
+			return rc, nil
+		}
+		// The object may not be replicated yet.
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			e.fail(ctx, err)
+		}
+	}
 
-	stat, err := d.bucket.Stat(ctx, d.getKey(path))
+	rc, err := d.readStream(ctx, d.primary, path, offset)
+	return rc, providerError(err)
+}
+
+// readStream reads the content stored at path from the bucket of e, as one
+// of the concurrent downloads until the returned content is closed.
+func (d *driver) readStream(ctx context.Context, e *readEndpoint, path string, offset int64) (rc io.ReadCloser, err error) {
+
+	if err := d.downloads.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			d.downloads.release()
+		}
+	}()
+
+	stat, err := e.bucket.Stat(ctx, d.getKey(path))
 	if err != nil {
 		return nil, parseError(path, err)
 	}
 
 	if offset >= stat.Fsize {
+		d.downloads.release()
 		return ioutil.NopCloser(bytes.NewReader(nil)), nil
 	}
 
 	policy := kodo.GetPolicy{Expires: defaultExpiry}
-	baseURL := d.params.BaseURL + d.getKey(path)
-	url := d.client.MakePrivateUrl(baseURL, &policy)
+	baseURL := e.baseURL + d.getKey(path)
+	url := e.client.MakePrivateUrl(baseURL, &policy)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -193,16 +563,25 @@ func (d *driver) ReadStream(ctx context.Context, path string, offset int64) (io.
 
 	// time.Sleep(15e9)
 
-	resp, err := d.client.Do(ctx, req)
+	resp, err := e.client.Do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
 		return nil, storagedriver.PathNotFoundError{Path: path}
 	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		er := rpc.ResponseError(resp).(*rpc.ErrorInfo)
+		if er.Err == "" {
+			er.Err = resp.Status
+		}
+		return nil, er
+	}
 
-	return resp.Body, nil
+	return &limitedReadCloser{ReadCloser: resp.Body, limiter: d.downloads}, nil
 }
 
 // WriteStream stores the contents of the provided io.ReadCloser at a
@@ -210,6 +589,11 @@ func (d *driver) ReadStream(ctx context.Context, path string, offset int64) (io.
 // May be used to resume writing a stream by providing a nonzero offset.
 // The offset must be no larger than the CurrentSize for this path.
 func (d *driver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (nn int64, err error) {
+	ctx = withRequestID(ctx)
+
+	defer func() {
+		err = providerError(err)
+	}()
 
 	uptoken := qiniuup.MakeAuthTokenString(d.client.AccessKey, d.client.SecretKey, &qiniuup.AuthPolicy{
 		Scope:    d.bucket.Name + ":" + d.getKey(path),
@@ -217,138 +601,101 @@ func (d *driver) WriteStream(ctx context.Context, path string, offset int64, rea
 		Accesses: []string{d.getKey(path)},
 	})
 
-	writeWholeFile := false
-
 	pathNotFoundErr := storagedriver.PathNotFoundError{Path: path}
 
+	size := int64(-1)
 	stat, err := d.Stat(ctx, path)
 	if err != nil {
-		if err.Error() == pathNotFoundErr.Error() {
-			writeWholeFile = true
-		} else {
+		if err.Error() != pathNotFoundErr.Error() {
 			return 0, err
 		}
+	} else {
+		size = stat.Size()
 	}
 
+	// Writes past the start of a missing file still go through the parts
+	// API, which fills the gap with zeros.
+	writeWholeFile := size < 0 && offset == 0
+
 	path = d.getKey(path)
 
-	//write reader to local temp file
-	tmpF, err := ioutil.TempFile("/tmp", "qiniu_driver")
+	staged, err := appendable.Stage(ctx, "", reader)
 	if err != nil {
 		return 0, err
 	}
-
-	defer os.Remove(tmpF.Name())
-	defer tmpF.Close()
-
-	written, err := io.Copy(tmpF, reader)
-	if err != nil {
-		return 0, err
+	defer staged.Close()
+	written := staged.Size
+
+	// The content is uploaded in resumable blocks, straight to the key when
+	// the whole file is written, and to a staging key otherwise, from which
+	// it is combined with the stored content. Should either step fail, the
+	// session records the progress for a retry writing the same content.
+	uploadKey := path
+	if !writeWholeFile {
+		uploadKey = d.sessionKey(path)
 	}
-	tmpF.Sync()
-	_, err = tmpF.Seek(0, os.SEEK_SET)
-	if err != nil {
+	session := d.startSession(ctx, path, uploadKey, staged.Digest, written)
+
+	// The content is spooled before waiting for an upload, so that clients
+	// sending it slowly do not hold uploads.
+	if err := d.uploads.acquire(ctx); err != nil {
 		return 0, err
 	}
+	defer d.uploads.release()
 
-	//------------------------
+	if writeWholeFile || written > 0 {
+		if err := checkContext(ctx); err != nil {
+			return 0, err
+		}
+		if err := d.upload(ctx, session, staged.File()); err != nil {
+			d.saveSession(ctx, path, session)
+			return 0, err
+		}
+	}
 
 	if writeWholeFile == false {
-		parts := make([]qiniurs.Part, 0)
-
-		if offset == 0 {
-			part_Reader := qiniurs.Part{
-				FileName: "",
-				R:        tmpF,
-			}
-			parts = append(parts, part_Reader)
-
-			if written < stat.Size() {
-				part_OriginFile2 := qiniurs.Part{
-					Key:  path,
-					From: written,
-					To:   -1,
-				}
-				parts = append(parts, part_OriginFile2)
-			}
-
-		} else if offset == stat.Size() { //因为parts_api有闭区间写错了，故这里先特殊判断offset == stat.Size()
-			part_OriginFile1 := qiniurs.Part{
-				Key:  path,
-				From: 0,
-				To:   -1,
-			}
-			parts = append(parts, part_OriginFile1)
-
-			part_Reader := qiniurs.Part{
-				FileName: "",
-				R:        tmpF,
-			}
-			parts = append(parts, part_Reader)
-		} else if offset < stat.Size() {
-			part_OriginFile1 := qiniurs.Part{
-				Key:  path,
-				From: 0,
-				To:   offset,
-			}
-			parts = append(parts, part_OriginFile1)
-
-			appendSize := written + offset
-			part_Reader := qiniurs.Part{
-				FileName: "",
-				R:        tmpF,
-			}
-			parts = append(parts, part_Reader)
-
-			if appendSize < stat.Size() {
-				part_OriginFile2 := qiniurs.Part{
-					Key:  path,
-					From: appendSize,
-					To:   -1,
+		var parts []qiniurs.Part
+		for _, p := range appendable.Plan(size, offset, written) {
+			switch p.Source {
+			case appendable.Stored:
+				// Ranges up to the end of the stored object are passed as
+				// open ranges, the parts API mishandling closed ones there.
+				to := p.To
+				if to == size {
+					to = -1
 				}
-				parts = append(parts, part_OriginFile2)
-			}
-		} else if offset > stat.Size() {
-			part_OriginFile1 := qiniurs.Part{
-				Key:  path,
-				From: 0,
-				To:   -1,
-			}
-			parts = append(parts, part_OriginFile1)
-
-			zeroBytes := make([]byte, offset-stat.Size())
-			part_ZeroPart := qiniurs.Part{
-				R: bytes.NewReader(zeroBytes),
-			}
-			parts = append(parts, part_ZeroPart)
-
-			part_Reader := qiniurs.Part{
-				R: tmpF,
+				parts = append(parts, qiniurs.Part{Key: path, From: p.From, To: to})
+			case appendable.Staged:
+				parts = append(parts, qiniurs.Part{Key: uploadKey, From: 0, To: -1})
+			case appendable.Zeros:
+				parts = append(parts, qiniurs.Part{R: bytes.NewReader(make([]byte, p.Size()))})
 			}
-			parts = append(parts, part_Reader)
 		}
-		err = qiniurs.PutParts(nil, nil, uptoken, path, true, parts, nil)
-		if err != nil {
+		if err := checkContext(ctx); err != nil {
 			return 0, err
 		}
-	} else {
-		err := d.bucket.PutFile(ctx, nil, path, tmpF.Name(), nil)
+
+		err = putParts(ctx, nil, uptoken, path, true, parts, nil)
 		if err != nil {
+			d.saveSession(ctx, path, session)
 			return 0, err
 		}
 	}
 
+	d.endSession(ctx, path)
+
 	return written, nil
 }
 
 // Stat retrieves the FileInfo for the given path, including the current
 // size in bytes and the creation time.
 func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	ctx = withRequestID(ctx)
 
-	items, _, _, err := d.bucket.List(ctx, d.getKey(path), "", "", 1)
+	items, _, _, err := d.list(ctx, d.getKey(path), "", "", 1)
 	if err != nil {
 		if err != io.EOF {
-			return nil, err
+			return nil, providerError(err)
 		}
 		err = nil
 	}
@@ -375,10 +722,69 @@ func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo,
 	return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
 }
 
+// StatMany retrieves the FileInfo for each of the given paths with the batch
+// stat API, in requests of up to listMax paths. The batch API only stats
+// objects, so paths which are not found are retried with Stat in case they
+// are directories.
+func (d *driver) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	ctx = withRequestID(ctx)
+
+	infos := make([]storagedriver.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+
+	for start := 0; start < len(paths); start += listMax {
+		if err := checkContext(ctx); err != nil {
+			for i := start; i < len(paths); i++ {
+				errs[i] = err
+			}
+			break
+		}
+
+		end := start + listMax
+		if end > len(paths) {
+			end = len(paths)
+		}
+
+		keys := make([]string, end-start)
+		for i, path := range paths[start:end] {
+			keys[i] = d.getKey(path)
+		}
+
+		rets, err := d.bucket.BatchStat(ctx, keys...)
+		if err != nil && len(rets) != len(keys) {
+			for i := start; i < end; i++ {
+				errs[i] = providerError(err)
+			}
+			continue
+		}
+
+		for i, ret := range rets {
+			path := paths[start+i]
+
+			switch ret.Code {
+			case http.StatusOK:
+				infos[start+i] = storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+					Path:    path,
+					Size:    ret.Data.Fsize,
+					ModTime: time.Unix(0, ret.Data.PutTime*100),
+				}}
+			case 612:
+				infos[start+i], errs[start+i] = d.Stat(ctx, path)
+			default:
+				errs[start+i] = providerError(&rpc.ErrorInfo{Err: ret.Error, Code: ret.Code})
+			}
+		}
+	}
+
+	return infos, errs
+}
+
 // List returns a list of the objects that are direct descendants of the
 // given path.
-func (d *driver) List(ctx context.Context, path string) ([]string, error) {
+func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
+	ctx = withRequestID(ctx)
 
+	path := opath
 	if path != "/" && path[len(path)-1] != '/' {
 		path += "/"
 	}
@@ -393,35 +799,50 @@ func (d *driver) List(ctx context.Context, path string) ([]string, error) {
 
 	var (
 		items    []kodo.ListItem
-		marker   string
 		prefixes []string
 		err      error
-
-		files       []string
-		directories []string
 	)
 
+	id := "list:" + d.getKey(path)
+	l := d.startListing(id)
 	for {
-		items, prefixes, marker, err = d.bucket.List(ctx, d.getKey(path), "/", marker, listMax)
+		if err := checkContext(ctx); err != nil {
+			d.suspendListing(id, l)
+			return nil, err
+		}
+
+		var marker string
+		items, prefixes, marker, err = d.list(ctx, d.getKey(path), "/", l.marker, d.params.ListMax)
 		if err != nil {
 			if err != io.EOF {
-				return nil, err
+				d.suspendListing(id, l)
+				return nil, providerError(err)
 			}
 			err = nil
 		}
 
 		for _, item := range items {
-			files = append(files, strings.Replace(item.Key, d.getKey(""), rootPrefix, 1))
+			l.files = append(l.files, strings.Replace(item.Key, d.getKey(""), rootPrefix, 1))
 		}
 
 		for _, prefix := range prefixes {
-			directories = append(directories, strings.Replace(strings.TrimSuffix(prefix, "/"), d.getKey(""), rootPrefix, 1))
+			l.directories = append(l.directories, strings.Replace(strings.TrimSuffix(prefix, "/"), d.getKey(""), rootPrefix, 1))
 		}
 
+		l.marker = marker
 		if marker == "" {
 			break
 		}
 	}
+	files, directories := l.files, l.directories
+
+	if opath != "/" {
+		if len(files) == 0 && len(directories) == 0 {
+			// Treat empty response as missing directory, since we don't actually
+			// have directories in KODO.
+			return nil, storagedriver.PathNotFoundError{Path: opath}
+		}
+	}
 
 	return append(files, directories...), nil
 }
@@ -431,6 +852,7 @@ func (d *driver) List(ctx context.Context, path string) ([]string, error) {
 // Note: This may be no more efficient than a copy followed by a delete for
 // many implementations.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	ctx = withRequestID(ctx)
 
 	_, err := d.bucket.Stat(ctx, d.getKey(sourcePath))
 	if err != nil {
@@ -440,7 +862,7 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	err = d.bucket.Delete(ctx, d.getKey(destPath))
 	if err != nil {
 		if !isKeyNotExists(err) {
-			return err
+			return providerError(err)
 		}
 	}
 
@@ -448,41 +870,143 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return parseError(sourcePath, err)
 }
 
+// Copy copies the object stored at sourcePath to destPath with the copy API,
+// without downloading it. The copy is forced, so that it replaces an existing
+// object at destPath, which is left untouched if the copy fails.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	ctx = withRequestID(ctx)
+
+	uri := kodo.URICopy(d.bucket.Name, d.getKey(sourcePath), d.bucket.Name, d.getKey(destPath)) + "/force/true"
+	err := d.bucket.Conn.Call(ctx, nil, "POST", d.bucket.Conn.RSHost+uri)
+	return parseError(sourcePath, err)
+}
+
+// storageClasses maps the storage classes of SetStorageClass to KODO file
+// types.
+var storageClasses = map[string]int{
+	"standard":   0,
+	"infrequent": 1,
+	"archive":    2,
+}
+
+// SetStorageClass changes the file type of the object stored at path to the
+// named storage class, standard, infrequent or archive. Archived objects
+// must be restored, see Restore, before they can be read again.
+func (d *driver) SetStorageClass(ctx context.Context, path string, class string) error {
+	ctx = withRequestID(ctx)
+
+	fileType, ok := storageClasses[class]
+	if !ok {
+		return fmt.Errorf("unknown storage class %q, must be standard, infrequent or archive", class)
+	}
+
+	entry := base64.URLEncoding.EncodeToString([]byte(d.bucket.Name + ":" + d.getKey(path)))
+	err := d.bucket.Conn.Call(ctx, nil, "POST", d.bucket.Conn.RSHost+"/chtype/"+entry+"/type/"+strconv.Itoa(fileType))
+	return parseError(path, err)
+}
+
+// Restore statuses of archived KODO objects.
+const (
+	restoreStatusRestoring = 1
+	restoreStatusRestored  = 2
+)
+
+// Restore returns whether the object stored at path can be read. Archived
+// objects can only be read once restored: their restore, keeping them
+// readable for the given number of days, is requested unless in progress.
+func (d *driver) Restore(ctx context.Context, path string, days int) (bool, error) {
+	ctx = withRequestID(ctx)
+
+	entry := base64.URLEncoding.EncodeToString([]byte(d.bucket.Name + ":" + d.getKey(path)))
+	var info struct {
+		Type          int `json:"type"`
+		RestoreStatus int `json:"restoreStatus"`
+	}
+	if err := d.bucket.Conn.Call(ctx, &info, "POST", d.bucket.Conn.RSHost+"/stat/"+entry); err != nil {
+		return false, parseError(path, err)
+	}
+
+	switch {
+	case info.Type != storageClasses["archive"], info.RestoreStatus == restoreStatusRestored:
+		return true, nil
+	case info.RestoreStatus == restoreStatusRestoring:
+		return false, nil
+	}
+
+	err := d.bucket.Conn.Call(ctx, nil, "POST", d.bucket.Conn.RSHost+"/restoreAr/"+entry+"/freezeAfterDays/"+strconv.Itoa(days))
+	return false, parseError(path, err)
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
+// With DeleteAfterDays set, the objects of paths spanning more than one
+// listing page are left for KODO to delete by their lifecycle.
 func (d *driver) Delete(ctx context.Context, path string) error {
+	ctx = withRequestID(ctx)
 
 	var (
-		items  []kodo.ListItem
-		marker string
-		err    error
-
-		cnt int
+		items []kodo.ListItem
+		err   error
 	)
 
+	// Keys of a page are deleted before listing the next one, so a resumed
+	// Delete only misses keys added behind its marker, like a restarted
+	// one would miss keys added behind its progress.
+	id := "delete:" + d.getKey(path)
+	l := d.startListing(id)
 	for {
-		items, _, marker, err = d.bucket.List(ctx, d.getKey(path), "", marker, listMax)
+		if err := checkContext(ctx); err != nil {
+			d.suspendListing(id, l)
+			return err
+		}
+
+		var marker string
+		items, _, marker, err = d.list(ctx, d.getKey(path), "", l.marker, d.params.ListMax)
 		if err != nil {
 			if err != io.EOF {
-				return err
+				d.suspendListing(id, l)
+				return providerError(err)
 			}
 			err = nil
 		}
 
-		cnt += len(items)
-		if cnt == 0 {
+		l.count += len(items)
+		if l.count == 0 {
 			return storagedriver.PathNotFoundError{Path: path}
 		}
 
-		for _, item := range items {
-			err = d.bucket.Delete(ctx, item.Key)
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+
+		if l.marker == "" && marker != "" && d.params.DeleteAfterDays > 0 {
+			l.expire = true
+		}
+		if l.expire {
+			keys, err = d.expireKeys(ctx, keys)
+			if err != nil {
+				d.suspendListing(id, l)
+				return err
+			}
+		}
+
+		for _, key := range keys {
+			if err := checkContext(ctx); err != nil {
+				d.suspendListing(id, l)
+				return err
+			}
+
+			err = d.bucket.Delete(ctx, key)
 			if err != nil {
 				if isKeyNotExists(err) {
 					continue
 				}
-				return err
+				d.suspendListing(id, l)
+				return providerError(err)
 			}
 		}
 
+		l.marker = marker
 		if marker == "" {
 			break
 		}
@@ -495,7 +1019,19 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 // the given path, possibly using the given options.
 // May return an ErrUnsupportedMethod in certain StorageDriver
 // implementations.
+// The URL is for a replica if routed to one which holds the object already.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	ctx = withRequestID(ctx)
+
+	e := d.routeRead()
+	if e != d.primary {
+		if _, err := e.bucket.Stat(ctx, d.getKey(path)); err != nil {
+			if !isKeyNotExists(err) {
+				e.fail(ctx, err)
+			}
+			e = d.primary
+		}
+	}
 
 	policy := kodo.GetPolicy{Expires: defaultExpiry}
 
@@ -505,15 +1041,47 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 		}
 	}
 
-	baseURL := d.params.BaseURL + d.getKey(path)
-	url := d.client.MakePrivateUrl(baseURL, &policy)
+	baseURL := e.baseURL
+	if e == d.primary {
+		if host, ok := options["host"].(string); ok {
+			baseURL = d.hostBaseURL(host)
+		}
+	}
+
+	url := e.client.MakePrivateUrl(baseURL+d.getKey(path), &policy)
 	return url, nil
 }
 
+// hostBaseURL returns the base URL of the bucket for clients reaching the
+// registry by host, which may include a port.
+func (d *driver) hostBaseURL(host string) string {
+	host = strings.ToLower(host)
+	if baseURL, ok := d.params.HostBaseURLs[host]; ok {
+		return baseURL
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if baseURL, ok := d.params.HostBaseURLs[hostname]; ok {
+			return baseURL
+		}
+	}
+	return d.primary.baseURL
+}
+
 func (d *driver) getKey(path string) string {
 	return strings.TrimLeft(d.params.RootDirectory+path, "/")
 }
 
+// checkContext returns the error of ctx if it is done, so that loops making
+// many requests stop once the request they serve is aborted.
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
 func isKeyNotExists(err error) bool {
 	if er, ok := err.(*rpc.ErrorInfo); ok && er.Code == 612 {
 		return true
@@ -525,5 +1093,26 @@ func parseError(path string, err error) error {
 	if er, ok := err.(*rpc.ErrorInfo); ok && er.Code == 612 {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
-	return err
+	return providerError(err)
+}
+
+// providerError returns a KODO error as a storagedriver.Error carrying its
+// HTTP status, error number and request ID, so that they are shown in logs
+// and API errors. Other errors are returned as is.
+func providerError(err error) error {
+	er, ok := err.(*rpc.ErrorInfo)
+	if !ok {
+		return err
+	}
+
+	e := storagedriver.Error{
+		DriverName: driverName,
+		StatusCode: er.Code,
+		RequestID:  er.Reqid,
+		Enclosed:   er,
+	}
+	if er.Errno != 0 {
+		e.Code = strconv.Itoa(er.Errno)
+	}
+	return e
 }
@@ -3,17 +3,33 @@
 package kodo
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"qiniupkg.com/api.v7/kodo"
+	"qiniupkg.com/x/rpc.v7"
+
+	qiniurs "qbox.us/api/rs.v3"
 
 	"github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/kodo/kodotest"
 	"github.com/docker/distribution/registry/storage/driver/testsuites"
 
+	netcontext "golang.org/x/net/context"
 	"gopkg.in/check.v1"
 )
 
@@ -30,6 +46,22 @@ func init() {
 	bucket := os.Getenv("KODO_BUCKET")
 	baseURL := os.Getenv("KODO_BASE_URL")
 
+	// Without credentials for a live bucket, the driver is tested against
+	// a fake KODO server.
+	var hosts kodo.Config
+	if accessKey == "" || secretKey == "" || bucket == "" || baseURL == "" {
+		fake := kodotest.NewServer("registry")
+		putParts = fakePutParts(fake)
+
+		accessKey, secretKey, bucket, baseURL = "access", "secret", "registry", fake.URL
+		hosts = kodo.Config{
+			RSHost:  fake.URL,
+			RSFHost: fake.URL,
+			IoHost:  fake.URL,
+			UpHosts: []string{fake.URL},
+		}
+	}
+
 	root, err := ioutil.TempDir("", "driver-")
 	if err != nil {
 		panic(err)
@@ -45,24 +77,22 @@ func init() {
 			}
 		}
 
+		config := hosts
+		config.AccessKey = accessKey
+		config.SecretKey = secretKey
+
 		parameters := DriverParameters{
-			int(zoneValue),
-			bucket,
-			baseURL,
-			rootDirectory,
-			kodo.Config{
-				AccessKey: accessKey,
-				SecretKey: secretKey,
-			},
+			Zone:          int(zoneValue),
+			Bucket:        bucket,
+			BaseURL:       baseURL,
+			RootDirectory: rootDirectory,
+			Config:        config,
 		}
 
 		return New(parameters)
 	}
 
 	skipkodo = func() string {
-		if accessKey == "" || secretKey == "" || bucket == "" || baseURL == "" {
-			return "Must set KODO_ACCESS_KEY, KODO_SECRET_KEY, KODO_BUCKET, KODO_BASE_URL to run kodo tests"
-		}
 		return ""
 	}
 
@@ -71,6 +101,50 @@ func init() {
 	}, skipkodo)
 }
 
+func BenchmarkDriver(b *testing.B) {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		b.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.Remove(root)
+
+	testsuites.BenchmarkDriver(b, func() (storagedriver.StorageDriver, error) {
+		return kodoDriverConstructor(root)
+	}, skipkodo)
+}
+
+// fakePutParts returns an implementation of putParts combining parts on the
+// fake server.
+func fakePutParts(fake *kodotest.Server) func(ctx interface{}, ret interface{}, uptoken, key string, hasKey bool, parts []qiniurs.Part, extra interface{}) error {
+	return func(ctx interface{}, ret interface{}, uptoken, key string, hasKey bool, parts []qiniurs.Part, extra interface{}) error {
+		var content bytes.Buffer
+		for _, part := range parts {
+			if part.R != nil {
+				if _, err := io.Copy(&content, part.R); err != nil {
+					return err
+				}
+				continue
+			}
+
+			stored, ok := fake.Get(part.Key)
+			if !ok {
+				return &rpc.ErrorInfo{Err: "no such file or directory", Code: 612}
+			}
+			to := part.To
+			if to < 0 || to > int64(len(stored)) {
+				to = int64(len(stored))
+			}
+			if part.From > to {
+				return &rpc.ErrorInfo{Err: "invalid range", Code: http.StatusBadRequest}
+			}
+			content.Write(stored[part.From:to])
+		}
+
+		fake.Put(key, content.Bytes())
+		return nil
+	}
+}
+
 func TestEmptyRootList(t *testing.T) {
 	if skipkodo() != "" {
 		t.Skip(skipkodo())
@@ -120,3 +194,912 @@ func TestEmptyRootList(t *testing.T) {
 		}
 	}
 }
+
+// TestCancelledContext checks that operations of an aborted request fail
+// before any request is sent to KODO.
+func TestCancelledContext(t *testing.T) {
+	d, err := New(DriverParameters{
+		Bucket:  "bucket",
+		BaseURL: "http://127.0.0.1:1",
+		Config: kodo.Config{
+			AccessKey: "access",
+			SecretKey: "secret",
+			RSHost:    "http://127.0.0.1:1",
+			RSFHost:   "http://127.0.0.1:1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx, cancel := netcontext.WithCancel(context.Background())
+	cancel()
+
+	if _, err := d.List(ctx, "/"); !isCanceled(err) {
+		t.Errorf("unexpected error listing with cancelled context: %v", err)
+	}
+
+	if err := d.Delete(ctx, "/test"); !isCanceled(err) {
+		t.Errorf("unexpected error deleting with cancelled context: %v", err)
+	}
+
+	if _, err := d.WriteStream(ctx, "/test", 0, bytes.NewReader([]byte("contents"))); !isCanceled(err) {
+		t.Errorf("unexpected error writing with cancelled context: %v", err)
+	}
+}
+
+// TestUploadSessions checks that a retried write of the same content resumes
+// the upload session of the failed write, and that abandoned sessions
+// expire.
+func TestUploadSessions(t *testing.T) {
+	d, err := New(DriverParameters{
+		Bucket:        "bucket",
+		BaseURL:       "http://127.0.0.1:1",
+		RootDirectory: "/root",
+		Config: kodo.Config{
+			AccessKey: "access",
+			SecretKey: "secret",
+			RSHost:    "http://127.0.0.1:1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	defer d.Close()
+	kd := d.StorageDriver.(*driver)
+
+	ctx := context.Background()
+	key := kd.getKey("/test")
+	stagingKey := kd.sessionKey(key)
+	if !strings.HasPrefix(stagingKey, "root/_sessions/") {
+		t.Fatalf("unexpected staging key: %s", stagingKey)
+	}
+
+	s := kd.startSession(ctx, key, stagingKey, "digest", 10)
+	if !s.staging {
+		t.Fatalf("expected a staging session")
+	}
+	s.done = true
+
+	if resumed := kd.startSession(ctx, key, stagingKey, "digest", 10); resumed != s {
+		t.Fatalf("expected a retried write to resume the session")
+	}
+	if other := kd.startSession(ctx, key, stagingKey, "other", 10); other == s || other.done {
+		t.Fatalf("expected a write of other content to start a new session")
+	}
+
+	if expired := kd.expireSessions(time.Now().Add(-time.Hour)); len(expired) != 0 {
+		t.Fatalf("unexpected expired sessions: %v", expired)
+	}
+	if expired := kd.expireSessions(time.Now().Add(time.Hour)); len(expired) != 1 {
+		t.Fatalf("expected the session to expire, got %v", expired)
+	}
+	if len(kd.sessions) != 0 {
+		t.Fatalf("expected expired sessions to be forgotten")
+	}
+
+	// Closing the driver stops its background work, and may be repeated.
+	d.Close()
+	select {
+	case <-kd.closed:
+	default:
+		t.Fatalf("expected the driver to be closed")
+	}
+	d.Close()
+}
+
+// TestReadTimeout checks that an operation fails once KODO stops responding
+// for longer than the read timeout.
+func TestReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	defer l.Close()
+
+	// Accept connections, but never respond.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host := "http://" + l.Addr().String()
+	d, err := New(DriverParameters{
+		Bucket:      "bucket",
+		BaseURL:     host,
+		ReadTimeout: 100 * time.Millisecond,
+		Config: kodo.Config{
+			AccessKey: "access",
+			SecretKey: "secret",
+			RSHost:    host,
+			RSFHost:   host,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.Stat(context.Background(), "/test")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected stat to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stat did not time out")
+	}
+}
+
+func TestTransportParameters(t *testing.T) {
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":              "bucket",
+		"baseurl":             "http://127.0.0.1:1",
+		"accesskey":           "access",
+		"secretkey":           "secret",
+		"maxidleconns":        "512",
+		"maxidleconnsperhost": 256,
+		"idleconntimeout":     "2m",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	transport := d.StorageDriver.(*driver).params.Config.Transport.(*taggingTransport).RoundTripper.(*http.Transport)
+	if transport.MaxIdleConns != 512 || transport.MaxIdleConnsPerHost != 256 || transport.IdleConnTimeout != 2*time.Minute {
+		t.Fatalf("unexpected transport limits: %d, %d, %v", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	if _, err := FromParameters(map[string]interface{}{
+		"bucket":       "bucket",
+		"baseurl":      "http://127.0.0.1:1",
+		"accesskey":    "access",
+		"secretkey":    "secret",
+		"maxidleconns": "many",
+	}); err == nil {
+		t.Fatalf("expected an invalid maxidleconns parameter to fail")
+	}
+}
+
+// TestDescribedParameters checks that the described parameters are accepted
+// by FromParameters with their defaults.
+func TestDescribedParameters(t *testing.T) {
+	parameters := map[string]interface{}{
+		"bucket":    "bucket",
+		"baseurl":   "http://127.0.0.1:1",
+		"accesskey": "access",
+		"secretkey": "secret",
+	}
+	for _, p := range describedParameters {
+		if _, ok := parameters[p.Name]; !ok && p.Default != "" {
+			parameters[p.Name] = p.Default
+		}
+	}
+
+	if err := factory.Validate(driverName, parameters); err != nil {
+		t.Fatalf("unexpected error validating parameters: %v", err)
+	}
+	if _, err := FromParameters(parameters); err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	parameters["acesskey"] = "access"
+	if err := factory.Validate(driverName, parameters); err == nil {
+		t.Fatalf("expected an unknown parameter to be reported")
+	}
+}
+
+// TestResumeWrite checks that a write failing after its content was uploaded
+// is completed by a retry without uploading the content again, even through
+// another instance of the driver, and that the staging object and the record
+// of the session are removed once it succeeds.
+func TestResumeWrite(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+
+	defer func(original func(ctx interface{}, ret interface{}, uptoken, key string, hasKey bool, parts []qiniurs.Part, extra interface{}) error) {
+		putParts = original
+	}(putParts)
+	combine := fakePutParts(fake)
+	failures := 1
+	putParts = func(ctx interface{}, ret interface{}, uptoken, key string, hasKey bool, parts []qiniurs.Part, extra interface{}) error {
+		if failures > 0 {
+			failures--
+			return &rpc.ErrorInfo{Err: "service unavailable", Code: http.StatusServiceUnavailable}
+		}
+		return combine(ctx, ret, uptoken, key, hasKey, parts, extra)
+	}
+
+	newDriver := func() *Driver {
+		d, err := New(DriverParameters{
+			Bucket:  "registry",
+			BaseURL: fake.URL,
+			Config: kodo.Config{
+				AccessKey: "access",
+				SecretKey: "secret",
+				RSHost:    fake.URL,
+				RSFHost:   fake.URL,
+				IoHost:    fake.URL,
+				UpHosts:   []string{fake.URL},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating driver: %v", err)
+		}
+		return d
+	}
+	d := newDriver()
+	defer d.Close()
+	kd := d.StorageDriver.(*driver)
+
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/test", []byte("hello")); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+
+	stagingKey := kd.sessionKey(kd.getKey("/test"))
+	recordKey := stagingKey + recordSuffix
+	if _, err := d.WriteStream(ctx, "/test", 5, bytes.NewReader([]byte(" world"))); err == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	if staged, ok := fake.Get(stagingKey); !ok || string(staged) != " world" {
+		t.Fatalf("expected the content to be staged, got %q", staged)
+	}
+	if _, ok := fake.Get(recordKey); !ok {
+		t.Fatalf("expected the upload session to be recorded")
+	}
+
+	// Replace the staged content, so that a retry uploading it again would
+	// be noticed. The retry goes through another instance, which only knows
+	// of the session from its record.
+	fake.Put(stagingKey, []byte(" again"))
+	retry := newDriver()
+	defer retry.Close()
+	if _, err := retry.WriteStream(ctx, "/test", 5, bytes.NewReader([]byte(" world"))); err != nil {
+		t.Fatalf("unexpected error retrying the write: %v", err)
+	}
+	if stored, _ := fake.Get("test"); string(stored) != "hello again" {
+		t.Fatalf("expected the staged content to be resumed, got %q", stored)
+	}
+	if _, ok := fake.Get(stagingKey); ok {
+		t.Fatalf("expected the staging object to be removed")
+	}
+	if _, ok := fake.Get(recordKey); ok {
+		t.Fatalf("expected the record of the session to be removed")
+	}
+}
+
+// TestReplicaReads checks that reads are served by a replica holding the
+// object, and by the primary otherwise, while writes go to the primary.
+func TestReplicaReads(t *testing.T) {
+	primary := kodotest.NewServer("registry")
+	defer primary.Close()
+	replica := kodotest.NewServer("replica")
+	defer replica.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   primary.URL,
+		"accesskey": "access",
+		"secretkey": "secret",
+		"rshost":    primary.URL,
+		"rsfhost":   primary.URL,
+		"iohost":    primary.URL,
+		"uphosts":   []string{primary.URL},
+		"replicas": []interface{}{
+			map[interface{}]interface{}{
+				"bucket":  "replica",
+				"baseurl": replica.URL,
+				"rshost":  replica.URL,
+				"rsfhost": replica.URL,
+				"iohost":  replica.URL,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/replicated", []byte("primary")); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+	if _, ok := replica.Get("replicated"); ok {
+		t.Fatalf("expected the write to go to the primary only")
+	}
+
+	// Not replicated yet, the object is read from the primary.
+	content, err := d.GetContent(ctx, "/replicated")
+	if err != nil || string(content) != "primary" {
+		t.Fatalf("expected to read from the primary, got %q, %v", content, err)
+	}
+	url, err := d.URLFor(ctx, "/replicated", nil)
+	if err != nil || !strings.HasPrefix(url, primary.URL) {
+		t.Fatalf("expected a url of the primary, got %q, %v", url, err)
+	}
+
+	replica.Put("replicated", []byte("replica"))
+	content, err = d.GetContent(ctx, "/replicated")
+	if err != nil || string(content) != "replica" {
+		t.Fatalf("expected to read from the replica, got %q, %v", content, err)
+	}
+	url, err = d.URLFor(ctx, "/replicated", nil)
+	if err != nil || !strings.HasPrefix(url, replica.URL) {
+		t.Fatalf("expected a url of the replica, got %q, %v", url, err)
+	}
+
+	// Once the replica fails, reads fall back to the primary.
+	replica.Close()
+	content, err = d.GetContent(ctx, "/replicated")
+	if err != nil || string(content) != "primary" {
+		t.Fatalf("expected to fall back to the primary, got %q, %v", content, err)
+	}
+	if kd := d.StorageDriver.(*driver); kd.routeRead() != kd.primary {
+		t.Fatalf("expected the failed replica not to be routed to")
+	}
+}
+
+func TestReplicaLatencyRouting(t *testing.T) {
+	d := &driver{
+		params:   DriverParameters{ReplicaRouting: routingLatency},
+		primary:  &readEndpoint{name: "primary", healthy: true},
+		replicas: []*readEndpoint{{name: "far", healthy: true}, {name: "near", healthy: true}},
+	}
+
+	// Until probed, reads go to the primary.
+	if e := d.routeRead(); e != d.primary {
+		t.Fatalf("expected the primary, got %s", e.name)
+	}
+
+	d.primary.latency = 50 * time.Millisecond
+	d.replicas[0].latency = 200 * time.Millisecond
+	d.replicas[1].latency = 10 * time.Millisecond
+	if e := d.routeRead(); e != d.replicas[1] {
+		t.Fatalf("expected the nearest replica, got %s", e.name)
+	}
+
+	d.replicas[1].healthy = false
+	if e := d.routeRead(); e != d.primary {
+		t.Fatalf("expected the primary, got %s", e.name)
+	}
+
+	d.params.ReplicaRouting = routingStatic
+	if e := d.routeRead(); e != d.replicas[0] {
+		t.Fatalf("expected the first healthy replica, got %s", e.name)
+	}
+}
+
+func isCanceled(err error) bool {
+	if e, ok := err.(storagedriver.Error); ok {
+		err = e.Enclosed
+	}
+	return err == netcontext.Canceled
+}
+
+// TestSetStorageClass checks that storage classes are mapped to the file types
+// of KODO objects.
+func TestSetStorageClass(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   fake.URL,
+		"accesskey": "access",
+		"secretkey": "secret",
+		"rshost":    fake.URL,
+		"rsfhost":   fake.URL,
+		"iohost":    fake.URL,
+		"uphosts":   []string{fake.URL},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/layer", []byte("layer")); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+
+	if err := d.SetStorageClass(ctx, "/layer", "archive"); err != nil {
+		t.Fatalf("unexpected error setting storage class: %v", err)
+	}
+	if fileType, _ := fake.FileType("layer"); fileType != 2 {
+		t.Fatalf("expected the object to be archived, got file type %d", fileType)
+	}
+
+	if err := d.SetStorageClass(ctx, "/layer", "cold"); err == nil {
+		t.Fatalf("expected an error setting an unknown storage class")
+	}
+
+	err = d.SetStorageClass(ctx, "/missing", "infrequent")
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("expected a PathNotFoundError, got %v", err)
+	}
+}
+
+// TestRestore checks that the restore of archived objects is requested once,
+// and that they are reported readable once restored.
+func TestRestore(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   fake.URL,
+		"accesskey": "access",
+		"secretkey": "secret",
+		"rshost":    fake.URL,
+		"rsfhost":   fake.URL,
+		"iohost":    fake.URL,
+		"uphosts":   []string{fake.URL},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/layer", []byte("layer")); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+	if readable, err := d.Restore(ctx, "/layer", 1); err != nil || !readable {
+		t.Fatalf("expected a standard object to be readable: %v, %v", readable, err)
+	}
+
+	if err := d.SetStorageClass(ctx, "/layer", "archive"); err != nil {
+		t.Fatalf("unexpected error setting storage class: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if readable, err := d.Restore(ctx, "/layer", 1); err != nil || readable {
+			t.Fatalf("expected an archived object to be restored: %v, %v", readable, err)
+		}
+	}
+	if !fake.CompleteRestore("layer") {
+		t.Fatalf("expected the restore of the object to be requested")
+	}
+	if readable, err := d.Restore(ctx, "/layer", 1); err != nil || !readable {
+		t.Fatalf("expected a restored object to be readable: %v, %v", readable, err)
+	}
+	if content, err := d.GetContent(ctx, "/layer"); err != nil || string(content) != "layer" {
+		t.Fatalf("unexpected content of the restored object: %q, %v", content, err)
+	}
+
+	_, err = d.Restore(ctx, "/missing", 1)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("expected a PathNotFoundError, got %v", err)
+	}
+}
+
+// TestHostBaseURLs checks that URLs are signed with the base URL configured
+// for the host the registry was reached by.
+func TestHostBaseURLs(t *testing.T) {
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   "https://registry.example.com",
+		"accesskey": "access",
+		"secretkey": "secret",
+		"hostbaseurls": map[interface{}]interface{}{
+			"registry.internal": "http://kodo.internal",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		host, expected string
+	}{
+		{"", "https://registry.example.com/blob?"},
+		{"registry.example.com", "https://registry.example.com/blob?"},
+		{"registry.internal", "http://kodo.internal/blob?"},
+		{"registry.internal:5000", "http://kodo.internal/blob?"},
+	} {
+		url, err := d.URLFor(ctx, "/blob", map[string]interface{}{"host": tc.host})
+		if err != nil {
+			t.Fatalf("unexpected error getting url: %v", err)
+		}
+		if !strings.HasPrefix(url, tc.expected) {
+			t.Errorf("unexpected url for host %q: %q", tc.host, url)
+		}
+	}
+}
+
+// TestListPagination checks that with the resume pagination strategy, a
+// List or Delete retried after failing partway continues from the page it
+// failed at, while with the restart strategy it lists from the first page.
+func TestListPagination(t *testing.T) {
+	for _, pagination := range []string{paginationRestart, paginationResume} {
+		fake := kodotest.NewServer("registry")
+		defer fake.Close()
+
+		// Fail the third list request, as if rate limited, and count the
+		// requests listing a first page.
+		var lists, firstPages int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/list") {
+				lists++
+				if lists == 3 {
+					w.WriteHeader(573)
+					w.Write([]byte(`{"error":"too many requests"}`))
+					return
+				}
+				if r.URL.Query().Get("marker") == "" {
+					firstPages++
+				}
+			}
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		d, err := FromParameters(map[string]interface{}{
+			"bucket":         "registry",
+			"baseurl":        server.URL,
+			"accesskey":      "access",
+			"secretkey":      "secret",
+			"rshost":         server.URL,
+			"rsfhost":        server.URL,
+			"listmax":        "2",
+			"listpagination": pagination,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating driver: %v", err)
+		}
+
+		var expected []string
+		for i := 0; i < 7; i++ {
+			p := "/dir/file" + strconv.Itoa(i)
+			fake.Put(strings.TrimPrefix(p, "/"), []byte("content"))
+			expected = append(expected, p)
+		}
+
+		ctx := context.Background()
+		if _, err := d.List(ctx, "/dir"); err == nil {
+			t.Fatalf("%s: expected the listing to fail", pagination)
+		}
+		files, err := d.List(ctx, "/dir")
+		if err != nil {
+			t.Fatalf("%s: unexpected error listing: %v", pagination, err)
+		}
+		sort.Strings(files)
+		if strings.Join(files, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s: unexpected files listed: %v", pagination, files)
+		}
+		if pagination == paginationResume && firstPages != 1 {
+			t.Fatalf("%s: expected the listing to be resumed, got %d first pages", pagination, firstPages)
+		}
+		if pagination == paginationRestart && firstPages != 2 {
+			t.Fatalf("%s: expected the listing to be restarted, got %d first pages", pagination, firstPages)
+		}
+
+		lists, firstPages = 0, 0
+		if err := d.Delete(ctx, "/dir"); err == nil {
+			t.Fatalf("%s: expected the deletion to fail", pagination)
+		}
+		if err := d.Delete(ctx, "/dir"); err != nil {
+			t.Fatalf("%s: unexpected error deleting: %v", pagination, err)
+		}
+		for _, p := range expected {
+			if _, ok := fake.Get(strings.TrimPrefix(p, "/")); ok {
+				t.Fatalf("%s: %s was not deleted", pagination, p)
+			}
+		}
+		if pagination == paginationResume && firstPages != 1 {
+			t.Fatalf("%s: expected the deletion to be resumed, got %d first pages", pagination, firstPages)
+		}
+	}
+
+	for _, parameters := range []map[string]interface{}{
+		{"listmax": 1001},
+		{"listmax": -1},
+		{"listpagination": "random"},
+	} {
+		parameters["bucket"] = "registry"
+		parameters["baseurl"] = "http://127.0.0.1:1"
+		parameters["accesskey"] = "access"
+		parameters["secretkey"] = "secret"
+		if _, err := FromParameters(parameters); err == nil {
+			t.Errorf("expected invalid parameters to fail: %v", parameters)
+		}
+	}
+}
+
+// TestDeleteAfterDays checks that Delete of a path spanning more than one
+// listing page sets the lifecycle of its keys instead of deleting them, and
+// deletes them one by one if the bucket does not permit it.
+func TestDeleteAfterDays(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+
+	// Refuse batches setting lifecycles once permitted is unset.
+	permitted := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/batch" && !permitted {
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(string(body), "deleteAfterDays") {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":"permission denied"}`))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":          "registry",
+		"baseurl":         server.URL,
+		"accesskey":       "access",
+		"secretkey":       "secret",
+		"rshost":          server.URL,
+		"rsfhost":         server.URL,
+		"listmax":         2,
+		"deleteafterdays": "1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	put := func(keys ...string) {
+		for _, key := range keys {
+			fake.Put(key, []byte("content"))
+		}
+	}
+	put("huge/a", "huge/b", "huge/c", "huge/d", "huge/e", "small/a", "small/b")
+
+	ctx := context.Background()
+	if err := d.Delete(ctx, "/huge"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	for _, key := range []string{"huge/a", "huge/b", "huge/c", "huge/d", "huge/e"} {
+		if days, ok := fake.DeleteAfterDays(key); !ok || days != 1 {
+			t.Fatalf("expected the lifecycle of %s to be set, got %d, %v", key, days, ok)
+		}
+	}
+
+	if err := d.Delete(ctx, "/small"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	for _, key := range []string{"small/a", "small/b"} {
+		if _, ok := fake.Get(key); ok {
+			t.Fatalf("expected %s to be deleted", key)
+		}
+	}
+
+	permitted = false
+	put("denied/a", "denied/b", "denied/c")
+	if err := d.Delete(ctx, "/denied"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	for _, key := range []string{"denied/a", "denied/b", "denied/c"} {
+		if _, ok := fake.Get(key); ok {
+			t.Fatalf("expected %s to be deleted", key)
+		}
+	}
+}
+
+// TestProviderErrors checks that errors answered by KODO carry the
+// operation, path, HTTP status and request ID they were answered for.
+func TestProviderErrors(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+	fake.Put("blob", []byte("content"))
+
+	// Fail downloads and lists as if KODO was unavailable.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || strings.HasPrefix(r.URL.Path, "/list") {
+			w.Header().Set("X-Reqid", "reqid")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"service unavailable"}`))
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   server.URL,
+		"accesskey": "access",
+		"secretkey": "secret",
+		"rshost":    server.URL,
+		"rsfhost":   server.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	_, err = d.GetContent(ctx, "/blob")
+	e, ok := err.(storagedriver.Error)
+	if !ok {
+		t.Fatalf("expected a storagedriver.Error reading, got %#v", err)
+	}
+	if e.DriverName != driverName || e.Operation != "GetContent" || e.Path != "/blob" || e.StatusCode != http.StatusServiceUnavailable || e.RequestID != "reqid" {
+		t.Fatalf("unexpected error details: %#v", e)
+	}
+	if msg := e.Error(); msg != "kodo: GetContent /blob: service unavailable (status 503, request id reqid)" {
+		t.Fatalf("unexpected error message: %s", msg)
+	}
+
+	_, err = d.List(ctx, "/repositories")
+	if e, ok := err.(storagedriver.Error); !ok || e.Operation != "List" || e.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected error listing: %#v", err)
+	}
+	payload, err := json.Marshal(err)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling: %v", err)
+	}
+	if expected := `{"driver":"kodo","operation":"List","path":"/repositories","status":503,"requestid":"reqid","message":"service unavailable"}`; string(payload) != expected {
+		t.Fatalf("unexpected error payload: %s", payload)
+	}
+}
+
+// TestConcurrencyLimits checks that downloads hold their slot until their
+// content is closed, and that no more listing requests than permitted are
+// made concurrently.
+func TestConcurrencyLimits(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+	fake.Put("blob", []byte("content"))
+	for i := 0; i < 8; i++ {
+		fake.Put("repositories/"+strconv.Itoa(i), []byte("content"))
+	}
+
+	var (
+		mu               sync.Mutex
+		lists, maxLists int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/list") {
+			mu.Lock()
+			lists++
+			if lists > maxLists {
+				maxLists = lists
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			lists--
+			mu.Unlock()
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":       "registry",
+		"baseurl":      server.URL,
+		"accesskey":    "access",
+		"secretkey":    "secret",
+		"rshost":       server.URL,
+		"rsfhost":      server.URL,
+		"maxdownloads": 1,
+		"maxlists":     "2",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	rc, err := d.ReadStream(ctx, "/blob", 0)
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+
+	waitCtx, cancel := netcontext.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := d.GetContent(waitCtx, "/blob"); err == nil || err.(storagedriver.Error).Enclosed != netcontext.DeadlineExceeded {
+		t.Fatalf("expected the download to wait for the open one, got %v", err)
+	}
+
+	rc.Close()
+	if content, err := d.GetContent(ctx, "/blob"); err != nil || string(content) != "content" {
+		t.Fatalf("unexpected content once the download was closed: %q, %v", content, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := d.Stat(ctx, "/repositories/"+strconv.Itoa(i)); err != nil {
+				t.Errorf("unexpected error stating: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if maxLists != 2 {
+		t.Fatalf("unexpected concurrent listing requests: %d", maxLists)
+	}
+
+	if _, err := FromParameters(map[string]interface{}{
+		"bucket":     "registry",
+		"baseurl":    server.URL,
+		"accesskey":  "access",
+		"secretkey":  "secret",
+		"maxuploads": -1,
+	}); err == nil {
+		t.Fatalf("expected an error with a negative maxuploads")
+	}
+}
+
+// TestRequestTagging checks that the requests to KODO carry the configured
+// User-Agent and the id of the registry request they serve.
+func TestRequestTagging(t *testing.T) {
+	fake := kodotest.NewServer("registry")
+	defer fake.Close()
+	fake.Put("blob", []byte("content"))
+
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header)
+		mu.Unlock()
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"bucket":    "registry",
+		"baseurl":   server.URL,
+		"accesskey": "access",
+		"secretkey": "secret",
+		"rshost":    server.URL,
+		"rsfhost":   server.URL,
+		"uphosts":   []string{server.URL},
+		"useragent": "registry-test/1.0",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), "http.request.id", "request-id")
+	if _, err := d.GetContent(ctx, "/blob"); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if err := d.PutContent(ctx, "/other", []byte("content")); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if _, err := d.Stat(context.Background(), "/blob"); err != nil {
+		t.Fatalf("unexpected error stating: %v", err)
+	}
+
+	if len(headers) < 4 {
+		t.Fatalf("unexpected requests: %d", len(headers))
+	}
+	last := len(headers) - 1
+	for i, header := range headers {
+		if ua := header.Get("User-Agent"); ua != "registry-test/1.0" {
+			t.Errorf("unexpected User-Agent of request %d: %q", i, ua)
+		}
+		if header.Get("X-Reqid") != "" {
+			t.Errorf("unexpected X-Reqid of request %d: %q", i, header.Get("X-Reqid"))
+		}
+
+		expected := "request-id"
+		if i == last {
+			expected = ""
+		}
+		if id := header.Get("X-Registry-Request-Id"); id != expected {
+			t.Errorf("unexpected X-Registry-Request-Id of request %d: %q != %q", i, id, expected)
+		}
+	}
+}
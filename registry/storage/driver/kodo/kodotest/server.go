@@ -0,0 +1,590 @@
+// Package kodotest provides an in-process fake of the Qiniu KODO services
+// used by the kodo storage driver, so that the driver can be tested without
+// credentials or a live bucket.
+//
+// The fake serves the RS (stat, delete, move, copy, chtype, deleteAfterDays,
+// restoreAr, batch), RSF (list), UP
+// (form and resumable uploads) and IO (download) APIs of a single bucket from
+// one HTTP server: downloads are GET requests for the key, and every other
+// API is a POST. Requests are not authenticated.
+package kodotest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes returned by KODO.
+const (
+	codeNoSuchFile   = 612
+	codeFileExists   = 614
+	codeNoSuchBucket = 631
+	codeInvalidCtx   = 701
+)
+
+// blockSize is the size of the blocks of resumable uploads.
+const blockSize = 1 << 22
+
+// Server is a fake KODO server storing the objects of a bucket in memory.
+type Server struct {
+	*httptest.Server
+
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string]*object
+	blocks  map[string][]byte
+	nextCtx int
+}
+
+type object struct {
+	content  []byte
+	putTime  time.Time
+	fileType int
+
+	// deleteAfterDays is the lifecycle of the object, 0 if it is kept
+	// forever. The fake never deletes objects by their lifecycle.
+	deleteAfterDays int
+
+	// restoreStatus is 1 while an archived object is restored, and 2 once
+	// it is, see CompleteRestore.
+	restoreStatus int
+}
+
+// NewServer starts a fake KODO server for the named bucket. Its URL serves
+// as RS, RSF, UP and IO host, and as base URL of the bucket.
+func NewServer(bucket string) *Server {
+	s := &Server{
+		bucket:  bucket,
+		objects: make(map[string]*object),
+		blocks:  make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Get returns the content of the object stored at key.
+func (s *Server) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return o.content, true
+}
+
+// Put stores content as the object at key.
+func (s *Server) Put(key string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = &object{content: content, putTime: time.Now()}
+}
+
+// FileType returns the file type, the storage class, of the object stored
+// at key.
+func (s *Server) FileType(key string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[key]
+	if !ok {
+		return 0, false
+	}
+	return o.fileType, true
+}
+
+// CompleteRestore completes the restore of the archived object stored at key,
+// returning false if no restore of the object is in progress.
+func (s *Server) CompleteRestore(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[key]
+	if !ok || o.restoreStatus != 1 {
+		return false
+	}
+	o.restoreStatus = 2
+	return true
+}
+
+// DeleteAfterDays returns the number of days after which the object stored
+// at key is deleted by its lifecycle, 0 if it is kept forever.
+func (s *Server) DeleteAfterDays(key string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[key]
+	if !ok {
+		return 0, false
+	}
+	return o.deleteAfterDays, true
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		s.download(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "":
+		s.formUpload(w, r)
+	case "stat", "delete", "move", "copy", "chtype", "deleteAfterDays", "restoreAr":
+		ret, code, err := s.operation(parts)
+		if err != "" {
+			writeError(w, code, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ret)
+	case "batch":
+		s.batch(w, r)
+	case "list":
+		s.list(w, r)
+	case "mkblk":
+		s.mkblk(w, r, parts)
+	case "bput":
+		s.bput(w, r, parts)
+	case "mkfile":
+		s.mkfile(w, r, parts)
+	default:
+		writeError(w, http.StatusNotFound, "no such api")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, code int, err string) {
+	writeJSON(w, code, map[string]string{"error": err})
+}
+
+// entry decodes an encoded "bucket:key" entry and returns the key.
+func (s *Server) entry(encoded string) (string, int, string) {
+	decoded, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", http.StatusBadRequest, "invalid entry"
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", http.StatusBadRequest, "invalid entry"
+	}
+	if parts[0] != s.bucket {
+		return "", codeNoSuchBucket, "no such bucket"
+	}
+	return parts[1], 0, ""
+}
+
+// entryInfo is the result of a stat operation.
+type entryInfo struct {
+	Hash     string `json:"hash"`
+	Fsize    int64  `json:"fsize"`
+	PutTime  int64  `json:"putTime"`
+	MimeType string `json:"mimeType"`
+	Type     int    `json:"type"`
+
+	RestoreStatus int `json:"restoreStatus,omitempty"`
+}
+
+func (o *object) info() entryInfo {
+	return entryInfo{
+		Hash:     fmt.Sprintf("%x", sha1.Sum(o.content)),
+		Fsize:    int64(len(o.content)),
+		PutTime:  o.putTime.UnixNano() / 100,
+		MimeType: "application/octet-stream",
+		Type:     o.fileType,
+
+		RestoreStatus: o.restoreStatus,
+	}
+}
+
+// operation performs the RS operation described by the path segments of its
+// URI, returning its result or an error code and message.
+func (s *Server) operation(parts []string) (interface{}, int, string) {
+	if len(parts) < 2 {
+		return nil, http.StatusBadRequest, "invalid operation"
+	}
+	key, code, err := s.entry(parts[1])
+	if err != "" {
+		return nil, code, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, codeNoSuchFile, "no such file or directory"
+	}
+
+	switch parts[0] {
+	case "stat":
+		return o.info(), 0, ""
+	case "delete":
+		delete(s.objects, key)
+		return nil, 0, ""
+	case "move", "copy":
+		if len(parts) < 3 {
+			return nil, http.StatusBadRequest, "invalid operation"
+		}
+		dest, code, err := s.entry(parts[2])
+		if err != "" {
+			return nil, code, err
+		}
+		if _, exists := s.objects[dest]; exists {
+			return nil, codeFileExists, "file exists"
+		}
+		s.objects[dest] = &object{content: o.content, putTime: time.Now()}
+		if parts[0] == "move" {
+			delete(s.objects, key)
+		}
+		return nil, 0, ""
+	case "chtype":
+		if len(parts) < 4 || parts[2] != "type" {
+			return nil, http.StatusBadRequest, "invalid operation"
+		}
+		fileType, err := strconv.Atoi(parts[3])
+		if err != nil || fileType < 0 || fileType > 3 {
+			return nil, http.StatusBadRequest, "invalid file type"
+		}
+		o.fileType = fileType
+		o.restoreStatus = 0
+		return nil, 0, ""
+	case "deleteAfterDays":
+		if len(parts) < 3 {
+			return nil, http.StatusBadRequest, "invalid operation"
+		}
+		days, err := strconv.Atoi(parts[2])
+		if err != nil || days < 0 {
+			return nil, http.StatusBadRequest, "invalid days"
+		}
+		o.deleteAfterDays = days
+		return nil, 0, ""
+	case "restoreAr":
+		if len(parts) < 4 || parts[2] != "freezeAfterDays" {
+			return nil, http.StatusBadRequest, "invalid operation"
+		}
+		if days, err := strconv.Atoi(parts[3]); err != nil || days < 1 || days > 7 {
+			return nil, http.StatusBadRequest, "invalid freezeAfterDays"
+		}
+		if o.fileType != 2 {
+			return nil, http.StatusBadRequest, "file is not archived"
+		}
+		if o.restoreStatus == 0 {
+			o.restoreStatus = 1
+		}
+		return nil, 0, ""
+	}
+
+	return nil, http.StatusBadRequest, "invalid operation"
+}
+
+// batchItem is the result of one operation of a batch.
+type batchItem struct {
+	Code  int         `json:"code"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	var items []batchItem
+	for _, op := range r.PostForm["op"] {
+		ret, code, err := s.operation(strings.Split(strings.TrimPrefix(op, "/"), "/"))
+		if err != "" {
+			// Batches which partially fail are answered with status 298.
+			status = 298
+			items = append(items, batchItem{Code: code, Error: err})
+			continue
+		}
+		items = append(items, batchItem{Code: http.StatusOK, Data: ret})
+	}
+
+	writeJSON(w, status, items)
+}
+
+// listItem is an object in the result of a list.
+type listItem struct {
+	Key string `json:"key"`
+	entryInfo
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("bucket") != s.bucket {
+		writeError(w, codeNoSuchBucket, "no such bucket")
+		return
+	}
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	marker := query.Get("marker")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type listRet struct {
+		Marker   string     `json:"marker,omitempty"`
+		Items    []listItem `json:"items"`
+		Prefixes []string   `json:"commonPrefixes,omitempty"`
+	}
+	var ret listRet
+
+	// last is the greatest key covered by the result, from which the next
+	// page continues.
+	var last string
+	count := 0
+	for _, key := range keys {
+		if key <= last {
+			continue
+		}
+		if count == limit {
+			ret.Marker = last
+			break
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := key[:len(prefix)+i+len(delimiter)]
+				ret.Prefixes = append(ret.Prefixes, commonPrefix)
+				// Skip the other keys sharing the prefix.
+				last = commonPrefix + "\xff"
+				count++
+				continue
+			}
+		}
+
+		ret.Items = append(ret.Items, listItem{Key: key, entryInfo: s.objects[key].info()})
+		last = key
+		count++
+	}
+
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (s *Server) formUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	key := r.FormValue("key")
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer f.Close()
+
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.Put(key, content)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"hash": fmt.Sprintf("%x", sha1.Sum(content)),
+		"key":  key,
+	})
+}
+
+// blockResult is the result of a mkblk or bput call.
+type blockResult struct {
+	Ctx      string `json:"ctx"`
+	Checksum string `json:"checksum"`
+	Crc32    uint32 `json:"crc32"`
+	Offset   uint32 `json:"offset"`
+	Host     string `json:"host"`
+}
+
+func (s *Server) mkblk(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 2 {
+		writeError(w, http.StatusBadRequest, "invalid mkblk")
+		return
+	}
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size <= 0 || size > blockSize {
+		writeError(w, http.StatusBadRequest, "invalid block size")
+		return
+	}
+
+	chunk, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.nextCtx++
+	ctx := strconv.Itoa(s.nextCtx)
+	s.blocks[ctx] = chunk
+	s.mu.Unlock()
+
+	s.writeBlockResult(w, ctx, chunk, len(chunk))
+}
+
+func (s *Server) bput(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 3 {
+		writeError(w, http.StatusBadRequest, "invalid bput")
+		return
+	}
+	ctx := parts[1]
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	chunk, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	block, ok := s.blocks[ctx]
+	if !ok || len(block) != offset {
+		s.mu.Unlock()
+		writeError(w, codeInvalidCtx, "invalid context")
+		return
+	}
+	block = append(block, chunk...)
+	s.blocks[ctx] = block
+	s.mu.Unlock()
+
+	s.writeBlockResult(w, ctx, chunk, len(block))
+}
+
+func (s *Server) writeBlockResult(w http.ResponseWriter, ctx string, chunk []byte, offset int) {
+	writeJSON(w, http.StatusOK, blockResult{
+		Ctx:      ctx,
+		Checksum: fmt.Sprintf("%x", sha1.Sum(chunk)),
+		Crc32:    crc32.ChecksumIEEE(chunk),
+		Offset:   uint32(offset),
+		Host:     s.URL,
+	})
+}
+
+func (s *Server) mkfile(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 2 {
+		writeError(w, http.StatusBadRequest, "invalid mkfile")
+		return
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid file size")
+		return
+	}
+
+	var key string
+	for i := 2; i+1 < len(parts); i += 2 {
+		if parts[i] == "key" {
+			decoded, err := base64.URLEncoding.DecodeString(parts[i+1])
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid key")
+				return
+			}
+			key = string(decoded)
+		}
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var content bytes.Buffer
+	s.mu.Lock()
+	var ctxs []string
+	if len(body) > 0 {
+		ctxs = strings.Split(string(body), ",")
+	}
+	for _, ctx := range ctxs {
+		block, ok := s.blocks[ctx]
+		if !ok {
+			s.mu.Unlock()
+			writeError(w, codeInvalidCtx, "invalid context")
+			return
+		}
+		content.Write(block)
+	}
+	for _, ctx := range ctxs {
+		delete(s.blocks, ctx)
+	}
+	s.mu.Unlock()
+
+	if int64(content.Len()) != size {
+		writeError(w, http.StatusBadRequest, "file size does not match the blocks")
+		return
+	}
+
+	s.Put(key, content.Bytes())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"hash": fmt.Sprintf("%x", sha1.Sum(content.Bytes())),
+		"key":  key,
+	})
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mu.Lock()
+	o, ok := s.objects[key]
+	archived := ok && o.fileType == 2 && o.restoreStatus != 2
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such file or directory")
+		return
+	}
+	if archived {
+		writeError(w, http.StatusForbidden, "archived file is not restored")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", o.putTime, bytes.NewReader(o.content))
+}
@@ -0,0 +1,49 @@
+// +build include_kodo
+
+package kodo
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"qiniupkg.com/api.v7/kodo"
+
+	"github.com/docker/distribution/context"
+)
+
+// expireKeys sets the lifecycle of keys for KODO to delete them after
+// DeleteAfterDays, with one batch request instead of a request per key, and
+// returns the keys which must be deleted right away instead. Those are all
+// of the keys if the bucket does not permit setting their lifecycle.
+//
+// Lifecycles are set on the keys rather than as a lifecycle rule of the
+// bucket on the prefix, which would also delete the objects written under
+// the prefix later on, such as those of a repository pushed again.
+func (d *driver) expireKeys(ctx context.Context, keys []string) ([]string, error) {
+	days := strconv.Itoa(d.params.DeleteAfterDays)
+	ops := make([]string, len(keys))
+	for i, key := range keys {
+		ops[i] = "/deleteAfterDays/" + base64.URLEncoding.EncodeToString([]byte(d.bucket.Name+":"+key)) + "/" + days
+	}
+
+	var rets []kodo.BatchItemRet
+	err := d.bucket.Conn.Batch(ctx, &rets, ops)
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err != nil && len(rets) != len(keys) {
+		context.GetLogger(ctx).Warnf("kodo: error setting the lifecycle of keys, deleting them instead: %v", err)
+		return keys, nil
+	}
+
+	var remaining []string
+	for i, ret := range rets {
+		switch ret.Code {
+		case http.StatusOK, 612:
+		default:
+			remaining = append(remaining, keys[i])
+		}
+	}
+	return remaining, nil
+}
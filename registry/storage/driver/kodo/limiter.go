@@ -0,0 +1,73 @@
+// +build include_kodo
+
+package kodo
+
+import (
+	"io"
+	"sync"
+
+	"qiniupkg.com/api.v7/kodo"
+
+	"github.com/docker/distribution/context"
+)
+
+// limiter bounds the number of concurrent operations of a kind, so that
+// bursts, such as garbage collection running along with pulls, queue in the
+// registry instead of exceeding the rate limits of the bucket. A nil limiter
+// does not limit anything.
+type limiter chan struct{}
+
+// newLimiter returns a limiter admitting n concurrent operations, or nil if
+// n is not positive.
+func newLimiter(n int) limiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(limiter, n)
+}
+
+// acquire waits until an operation may start, or until ctx is done.
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release ends an operation started by acquire.
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// limitedReadCloser releases the operation of a download once its content is
+// closed.
+type limitedReadCloser struct {
+	io.ReadCloser
+	once    sync.Once
+	limiter limiter
+}
+
+func (rc *limitedReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	rc.once.Do(rc.limiter.release)
+	return err
+}
+
+// list lists a page of the keys under prefix as one of the concurrent list
+// operations.
+func (d *driver) list(ctx context.Context, prefix, delimiter, marker string, limit int) ([]kodo.ListItem, []string, string, error) {
+	if err := d.lists.acquire(ctx); err != nil {
+		return nil, nil, "", err
+	}
+	defer d.lists.release()
+
+	return d.bucket.List(ctx, prefix, delimiter, marker, limit)
+}
@@ -0,0 +1,82 @@
+// +build include_kodo
+
+package kodo
+
+import "time"
+
+// Pagination strategies of listings which fail partway, for example because
+// KODO rate limits the requests listing a very large prefix.
+const (
+	// paginationRestart lists from the first page again when a failed
+	// listing is retried.
+	paginationRestart = "restart"
+
+	// paginationResume keeps the progress of a failed listing, so that a
+	// retry continues from the page it failed at.
+	paginationResume = "resume"
+)
+
+// listingTTL is how long the progress of a failed listing is kept with the
+// resume pagination strategy. Keys added before the marker of a listing
+// after it failed are missed by its retry, so its progress is only kept for
+// a short while.
+const listingTTL = 10 * time.Minute
+
+// listing tracks the progress of a paginated listing of a prefix.
+type listing struct {
+	// marker is the marker of the next page to list, empty for the first
+	// page.
+	marker string
+
+	// files and directories are the paths listed by List so far, and count
+	// the number of keys deleted by Delete so far.
+	files       []string
+	directories []string
+	count       int
+
+	// expire is set once Delete found the prefix too large to delete its
+	// keys one by one.
+	expire bool
+
+	updated time.Time
+}
+
+// startListing returns the listing identified by id, resuming the progress
+// of an earlier failed one with the resume pagination strategy. The listing
+// belongs to the caller until it is suspended.
+func (d *driver) startListing(id string) *listing {
+	if d.params.ListPagination != paginationResume {
+		return &listing{}
+	}
+
+	d.listingsMu.Lock()
+	defer d.listingsMu.Unlock()
+
+	l, ok := d.listings[id]
+	delete(d.listings, id)
+	if !ok || time.Since(l.updated) > listingTTL {
+		return &listing{}
+	}
+	return l
+}
+
+// suspendListing keeps the progress of the listing identified by id, which
+// failed, for a retry to resume it with the resume pagination strategy.
+func (d *driver) suspendListing(id string, l *listing) {
+	if d.params.ListPagination != paginationResume || l.marker == "" {
+		return
+	}
+
+	d.listingsMu.Lock()
+	defer d.listingsMu.Unlock()
+
+	now := time.Now()
+	for id, other := range d.listings {
+		if now.Sub(other.updated) > listingTTL {
+			delete(d.listings, id)
+		}
+	}
+
+	l.updated = now
+	d.listings[id] = l
+}
@@ -0,0 +1,216 @@
+// +build include_kodo
+
+package kodo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"qiniupkg.com/api.v7/kodo"
+
+	"github.com/docker/distribution/context"
+)
+
+// Policies routing reads to replicas.
+const (
+	// routingStatic reads from the first healthy replica, in the order
+	// they are configured.
+	routingStatic = "static"
+
+	// routingLatency reads from the healthy bucket, the primary or a
+	// replica, which answered the latest probes fastest.
+	routingLatency = "latency"
+)
+
+const defaultReplicaProbeInterval = 30 * time.Second
+
+// ReplicaParameters describes a bucket, usually in another zone, holding a
+// copy of the objects of the primary bucket kept by KODO cross-region
+// replication.
+type ReplicaParameters struct {
+	Zone    int
+	Bucket  string
+	BaseURL string
+
+	// Config holds the hosts of the zone of the replica. The access and
+	// secret keys default to those of the primary bucket.
+	kodo.Config
+}
+
+// parseReplicas parses the replicas parameter, a list of maps with the same
+// keys as the parameters of the primary bucket.
+func parseReplicas(value interface{}) ([]ReplicaParameters, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("replicas parameter must be a list: %#v", value)
+	}
+
+	replicas := make([]ReplicaParameters, 0, len(list))
+	for i, item := range list {
+		parameters := make(map[string]interface{})
+		switch item := item.(type) {
+		case map[string]interface{}:
+			parameters = item
+		case map[interface{}]interface{}:
+			for k, v := range item {
+				parameters[fmt.Sprint(k)] = v
+			}
+		default:
+			return nil, fmt.Errorf("replica %d must be a map: %#v", i, item)
+		}
+
+		var replica ReplicaParameters
+		replica.Zone, _ = parameters["zone"].(int)
+		replica.Bucket, _ = parameters["bucket"].(string)
+		if replica.Bucket == "" {
+			return nil, fmt.Errorf("No bucket parameter provided for replica %d", i)
+		}
+		replica.BaseURL, _ = parameters["baseurl"].(string)
+		if replica.BaseURL == "" {
+			return nil, fmt.Errorf("No baseurl parameter provided for replica %d", i)
+		}
+
+		replica.Config.AccessKey, _ = parameters["accesskey"].(string)
+		replica.Config.SecretKey, _ = parameters["secretkey"].(string)
+		replica.Config.RSHost, _ = parameters["rshost"].(string)
+		replica.Config.RSFHost, _ = parameters["rsfhost"].(string)
+		replica.Config.IoHost, _ = parameters["iohost"].(string)
+
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+// readEndpoint is a bucket objects are read from, the primary or a replica.
+type readEndpoint struct {
+	name    string
+	baseURL string
+	client  *kodo.Client
+	bucket  *kodo.Bucket
+
+	mu      sync.Mutex
+	healthy bool
+	latency time.Duration
+}
+
+func newReadEndpoint(zone int, bucketName, baseURL string, config *kodo.Config) *readEndpoint {
+	client := kodo.New(zone, config)
+	bucket := client.Bucket(bucketName)
+
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	return &readEndpoint{
+		name:    bucketName,
+		baseURL: baseURL,
+		client:  client,
+		bucket:  &bucket,
+		healthy: true,
+	}
+}
+
+// measured returns the smoothed latency of the probes of the endpoint, and
+// false if it is unhealthy or was not probed yet.
+func (e *readEndpoint) measured() (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latency, e.healthy && e.latency > 0
+}
+
+func (e *readEndpoint) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+// fail marks the endpoint unhealthy after a failed read, until a probe
+// succeeds.
+func (e *readEndpoint) fail(ctx context.Context, err error) {
+	e.mu.Lock()
+	wasHealthy := e.healthy
+	e.healthy = false
+	e.mu.Unlock()
+
+	if wasHealthy {
+		context.GetLogger(ctx).Warnf("kodo: reading from bucket %s failed, falling back to the primary: %v", e.name, err)
+	}
+}
+
+// probe lists a single key under prefix, recording how long the request
+// took and whether it succeeded.
+func (e *readEndpoint) probe(ctx context.Context, prefix string) error {
+	start := time.Now()
+	_, _, _, err := e.bucket.List(ctx, prefix, "", "", 1)
+	if err == io.EOF {
+		err = nil
+	}
+	sample := time.Since(start)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		e.healthy = false
+		return err
+	}
+
+	e.healthy = true
+	if e.latency == 0 {
+		e.latency = sample
+	} else {
+		e.latency = (3*e.latency + sample) / 4
+	}
+	return nil
+}
+
+// routeRead returns the endpoint to read from under the routing policy.
+func (d *driver) routeRead() *readEndpoint {
+	if len(d.replicas) == 0 {
+		return d.primary
+	}
+
+	if d.params.ReplicaRouting == routingLatency {
+		best := d.primary
+		bestLatency, ok := d.primary.measured()
+		for _, replica := range d.replicas {
+			latency, measured := replica.measured()
+			if measured && (!ok || latency < bestLatency) {
+				best, bestLatency, ok = replica, latency, true
+			}
+		}
+		return best
+	}
+
+	for _, replica := range d.replicas {
+		if replica.isHealthy() {
+			return replica
+		}
+	}
+	return d.primary
+}
+
+// probeReplicas periodically probes the primary and the replicas, measuring
+// their latency for routing and restoring the replicas which failed once
+// they answer again, until the driver is closed.
+func (d *driver) probeReplicas() {
+	ctx := context.Background()
+	endpoints := append([]*readEndpoint{d.primary}, d.replicas...)
+
+	for {
+		for _, e := range endpoints {
+			if err := e.probe(ctx, d.getKey("/")); err != nil {
+				context.GetLogger(ctx).Warnf("kodo: probing bucket %s failed: %v", e.name, err)
+			}
+		}
+
+		select {
+		case <-d.closed:
+			return
+		case <-time.After(d.params.ReplicaProbeInterval):
+		}
+	}
+}
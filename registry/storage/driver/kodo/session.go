@@ -0,0 +1,328 @@
+// +build include_kodo
+
+package kodo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"qiniupkg.com/api.v7/kodo"
+	"qiniupkg.com/api.v7/kodocli"
+	"qiniupkg.com/x/rpc.v7"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// sessionsPrefix is the path under the root directory of the staging objects
+// and the records of upload sessions.
+const sessionsPrefix = "/_sessions/"
+
+// recordSuffix is appended to the staging path of an upload session to store
+// its record.
+const recordSuffix = ".session"
+
+// uploadSession tracks the upload of the content of a write to KODO, so that
+// a write of the same content retried after a failure resumes the blocks
+// already uploaded instead of starting over. The progress of a failed write
+// is recorded in the bucket, so that it is resumed by any instance of the
+// registry, or after a restart.
+type uploadSession struct {
+	// key is the key the content is uploaded to, which is the staging key
+	// of the session unless the whole file is written.
+	key     string
+	staging bool
+
+	digest string
+	size   int64
+
+	// mu serializes the uploads of the session, and guards extra, done and
+	// recorded.
+	mu sync.Mutex
+
+	// extra holds the progress of the blocks of the upload.
+	extra kodo.RputExtra
+
+	// done is set once the content is stored at key.
+	done bool
+
+	// recorded is set once the session may have a record in the bucket.
+	recorded bool
+
+	// updated is guarded by the sessions lock of the driver.
+	updated time.Time
+}
+
+// sessionRecord is the progress of an upload session stored in the bucket.
+type sessionRecord struct {
+	Key        string              `json:"key"`
+	Digest     string              `json:"digest"`
+	Size       int64               `json:"size"`
+	Done       bool                `json:"done"`
+	Progresses []kodocli.BlkputRet `json:"progresses,omitempty"`
+}
+
+// sessionPath returns the path of the staging object of the upload sessions
+// writing to key.
+func sessionPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return sessionsPrefix + hex.EncodeToString(sum[:])
+}
+
+// sessionKey returns the staging key of the upload sessions writing to key.
+func (d *driver) sessionKey(key string) string {
+	return d.getKey(sessionPath(key))
+}
+
+// matches returns true if the session uploads content with the given digest
+// and size to uploadKey.
+func (s *uploadSession) matches(uploadKey, digest string, size int64) bool {
+	return s.key == uploadKey && s.digest == digest && s.size == size
+}
+
+// startSession returns the upload session of a write to key uploading
+// content with the given digest and size to uploadKey. The session of an
+// earlier failed write is resumed if it uploaded the same content, from
+// its record in the bucket if this process does not know of it.
+func (d *driver) startSession(ctx context.Context, key, uploadKey, digest string, size int64) *uploadSession {
+	d.sessionsMu.Lock()
+	if s, ok := d.sessions[key]; ok && s.matches(uploadKey, digest, size) {
+		s.updated = time.Now()
+		d.sessionsMu.Unlock()
+		return s
+	}
+	d.sessionsMu.Unlock()
+
+	s := d.loadSession(ctx, key, uploadKey, digest, size)
+
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+	if current, ok := d.sessions[key]; ok && current.matches(uploadKey, digest, size) {
+		s = current
+	} else {
+		d.sessions[key] = s
+	}
+	s.updated = time.Now()
+
+	return s
+}
+
+// loadSession returns the upload session recorded in the bucket for a write
+// to key, if it uploads the same content, or a new session.
+func (d *driver) loadSession(ctx context.Context, key, uploadKey, digest string, size int64) *uploadSession {
+	s := &uploadSession{
+		key:     uploadKey,
+		staging: uploadKey != key,
+		digest:  digest,
+		size:    size,
+	}
+
+	p, err := d.GetContent(ctx, sessionPath(key)+recordSuffix)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			context.GetLogger(ctx).Warnf("kodo: error reading upload session of %s: %v", key, err)
+		}
+		return s
+	}
+
+	var record sessionRecord
+	if err := json.Unmarshal(p, &record); err != nil {
+		context.GetLogger(ctx).Warnf("kodo: invalid upload session of %s: %v", key, err)
+		return s
+	}
+
+	// The record is removed along with the session, even if it is of other
+	// content.
+	s.recorded = true
+	if record.Key == uploadKey && record.Digest == digest && record.Size == size {
+		s.done = record.Done
+		s.extra.Progresses = record.Progresses
+	}
+	return s
+}
+
+// saveSession records the progress of the upload session of a failed write
+// to key in the bucket. The record is stored even if the write failed as its
+// context was canceled.
+func (d *driver) saveSession(ctx context.Context, key string, s *uploadSession) {
+	ctx = context.WithLogger(context.Background(), context.GetLogger(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := json.Marshal(sessionRecord{
+		Key:        s.key,
+		Digest:     s.digest,
+		Size:       s.size,
+		Done:       s.done,
+		Progresses: s.extra.Progresses,
+	})
+	if err == nil {
+		err = d.bucket.Put(ctx, nil, d.getKey(sessionPath(key)+recordSuffix), bytes.NewReader(p), int64(len(p)), nil)
+	}
+	if err != nil {
+		context.GetLogger(ctx).Warnf("kodo: error recording upload session of %s: %v", key, err)
+		return
+	}
+	s.recorded = true
+}
+
+// endSession forgets the upload session of a completed write to key and
+// removes its staging object and record.
+func (d *driver) endSession(ctx context.Context, key string) {
+	d.sessionsMu.Lock()
+	s, ok := d.sessions[key]
+	delete(d.sessions, key)
+	d.sessionsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	var keys []string
+	if s.staging {
+		keys = append(keys, s.key)
+	}
+	s.mu.Lock()
+	if s.recorded {
+		keys = append(keys, d.getKey(sessionPath(key)+recordSuffix))
+	}
+	s.mu.Unlock()
+
+	for _, k := range keys {
+		if err := d.bucket.Delete(ctx, k); err != nil && !isKeyNotExists(err) {
+			context.GetLogger(ctx).Warnf("kodo: error removing upload session object %s: %v", k, err)
+		}
+	}
+}
+
+// upload uploads the content of f to the key of the session, skipping the
+// blocks uploaded by earlier attempts. Concurrent uploads of a session are
+// serialized, so that a write waits for another of the same content.
+func (d *driver) upload(ctx context.Context, s *uploadSession, f *os.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return nil
+	}
+
+	if s.size == 0 {
+		if err := d.bucket.Put(ctx, nil, s.key, bytes.NewReader(nil), 0, nil); err != nil {
+			return err
+		}
+		s.done = true
+		return nil
+	}
+
+	s.extra.NotifyErr = func(blkIdx int, blkSize int, err error) {
+		// KODO expires the context of blocks which are not used for a
+		// while, so those have to be uploaded again.
+		if er, ok := err.(*rpc.ErrorInfo); ok && er.Code == kodocli.InvalidCtx {
+			s.extra.Progresses[blkIdx] = kodocli.BlkputRet{}
+		}
+	}
+
+	if err := d.bucket.Rput(ctx, nil, s.key, f, s.size, &s.extra); err != nil {
+		return err
+	}
+	s.done = true
+
+	return nil
+}
+
+// expireSessions forgets the upload sessions which were not used since
+// before and returns them.
+func (d *driver) expireSessions(before time.Time) []*uploadSession {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	var expired []*uploadSession
+	for key, s := range d.sessions {
+		if s.updated.Before(before) {
+			expired = append(expired, s)
+			delete(d.sessions, key)
+		}
+	}
+
+	return expired
+}
+
+// purgeSessions periodically forgets abandoned upload sessions and removes
+// the staging objects and records older than the session TTL, including those
+// left behind by other instances or earlier runs of the registry, until the
+// driver is closed. Uploaded blocks which never became part of an object are
+// discarded by KODO itself.
+func (d *driver) purgeSessions() {
+	ctx := context.Background()
+
+	for {
+		select {
+		case <-d.closed:
+			return
+		case <-time.After(d.params.SessionTTL / 2):
+		}
+
+		before := time.Now().Add(-d.params.SessionTTL)
+		for _, s := range d.expireSessions(before) {
+			context.GetLogger(ctx).Infof("kodo: expired upload session of %s", s.key)
+		}
+
+		if err := d.purgeStagingObjects(ctx, before); err != nil {
+			context.GetLogger(ctx).Errorf("kodo: error purging staging objects: %v", err)
+		}
+	}
+}
+
+// purgeStagingObjects removes the staging objects and records stored before
+// the given time which belong to no upload session.
+func (d *driver) purgeStagingObjects(ctx context.Context, before time.Time) error {
+	active := make(map[string]bool)
+	d.sessionsMu.Lock()
+	for key, s := range d.sessions {
+		if s.staging {
+			active[s.key] = true
+		}
+		active[d.getKey(sessionPath(key)+recordSuffix)] = true
+	}
+	d.sessionsMu.Unlock()
+
+	var (
+		items  []kodo.ListItem
+		marker string
+		err    error
+	)
+
+	for {
+		items, _, marker, err = d.list(ctx, d.getKey(sessionsPrefix), "", marker, d.params.ListMax)
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			err = nil
+		}
+
+		for _, item := range items {
+			if active[item.Key] {
+				continue
+			}
+			if time.Unix(0, item.PutTime*100).After(before) {
+				continue
+			}
+			if err := d.bucket.Delete(ctx, item.Key); err != nil && !isKeyNotExists(err) {
+				return err
+			}
+		}
+
+		if marker == "" {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// +build include_kodo
+
+package kodo
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"qiniupkg.com/x/reqid.v7"
+
+	"github.com/docker/distribution/context"
+)
+
+// newTransport returns the transport of the KODO client. Connecting times out
+// after the connect timeout, and a connection fails once a read or write on it
+// makes no progress within the read or write timeout, so that a stuck
+// connection does not hold an operation until the request it serves ends.
+// Up to the configured number of idle connections are kept for reuse, since
+// concurrent pulls otherwise keep opening new ones.
+func newTransport(params DriverParameters) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   params.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: func(network, address string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &timeoutConn{
+				Conn:         conn,
+				readTimeout:  params.ReadTimeout,
+				writeTimeout: params.WriteTimeout,
+			}, nil
+		},
+		TLSHandshakeTimeout: params.ConnectTimeout,
+		MaxIdleConns:        params.MaxIdleConns,
+		MaxIdleConnsPerHost: params.MaxIdleConnsPerHost,
+		IdleConnTimeout:     params.IdleConnTimeout,
+	}
+}
+
+// timeoutConn sets a deadline on each read and write of a connection.
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(p)
+}
+
+// taggingTransport tags the requests of the KODO client with the User-Agent
+// of the registry and the id of the registry request they serve, so that
+// the logs of KODO can be correlated with those of the registry.
+//
+// The KODO client sends the request id carried by the context of a request,
+// see withRequestID, as its X-Reqid header, which is sent as the
+// X-Registry-Request-Id header instead, leaving KODO to assign its own
+// request ids. Requests are tagged in place, since the KODO client cancels
+// a request through the transport by the request it sent.
+type taggingTransport struct {
+	http.RoundTripper
+	userAgent string
+}
+
+func (t *taggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if id := req.Header.Get("X-Reqid"); id != "" {
+		req.Header.Del("X-Reqid")
+		req.Header.Set("X-Registry-Request-Id", id)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// NestedObject returns the wrapped transport, for the KODO client to cancel
+// requests through it.
+func (t *taggingTransport) NestedObject() interface{} {
+	return t.RoundTripper
+}
+
+// withRequestID returns ctx carrying the id of the registry request it
+// serves, if any, for the KODO client to send along with its requests.
+func withRequestID(ctx context.Context) context.Context {
+	if id := context.GetRequestID(ctx); id != "" {
+		return reqid.NewContext(ctx, id)
+	}
+	return ctx
+}
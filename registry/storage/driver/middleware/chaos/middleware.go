@@ -0,0 +1,321 @@
+// Package chaos provides a storage middleware which injects latency, errors
+// and truncated reads into the operations of the wrapped storage driver, so
+// that the resilience of the registry to a misbehaving backend can be
+// exercised in integration tests and staging environments.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// ErrInjected is the error enclosed in the errors injected by the
+// middleware.
+var ErrInjected = errors.New("injected fault")
+
+// operations are the names of the operations faults can be injected into.
+var operations = []string{"getcontent", "putcontent", "readstream", "writestream", "stat", "list", "move", "copy", "delete", "urlfor"}
+
+// chaosStorageMiddleware delays every operation of the wrapped driver and
+// fails a share of them. A failed write stores a part of its content before
+// failing, as an interrupted upload would, and a share of the streams read
+// end early.
+type chaosStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	latency      time.Duration
+	jitter       time.Duration
+	errorRate    float64
+	truncateRate float64
+	operations   map[string]bool
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ storagedriver.StorageDriver = &chaosStorageMiddleware{}
+
+// newChaosStorageMiddleware constructs a storage middleware injecting faults
+// into the operations of storageDriver.
+// Optional options: latency, jitter, errorrate, truncaterate, operations, seed
+func newChaosStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	latency, err := durationOption(options, "latency")
+	if err != nil {
+		return nil, err
+	}
+	jitter, err := durationOption(options, "jitter")
+	if err != nil {
+		return nil, err
+	}
+	errorRate, err := rateOption(options, "errorrate")
+	if err != nil {
+		return nil, err
+	}
+	truncateRate, err := rateOption(options, "truncaterate")
+	if err != nil {
+		return nil, err
+	}
+
+	seed := time.Now().UnixNano()
+	if s, ok := options["seed"]; ok {
+		seed, err = strconv.ParseInt(fmt.Sprint(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("seed must be an integer: %v", s)
+		}
+	}
+
+	ops := make(map[string]bool)
+	if o, ok := options["operations"]; ok {
+		list, ok := o.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operations must be a list: %v", o)
+		}
+		for _, op := range list {
+			name := fmt.Sprint(op)
+			if !knownOperation(name) {
+				return nil, fmt.Errorf("unknown operation: %s", name)
+			}
+			ops[name] = true
+		}
+	} else {
+		for _, op := range operations {
+			ops[op] = true
+		}
+	}
+
+	return &chaosStorageMiddleware{
+		StorageDriver: storageDriver,
+		latency:       latency,
+		jitter:        jitter,
+		errorRate:     errorRate,
+		truncateRate:  truncateRate,
+		operations:    ops,
+		rand:          rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+func knownOperation(name string) bool {
+	for _, op := range operations {
+		if op == name {
+			return true
+		}
+	}
+	return false
+}
+
+func durationOption(options map[string]interface{}, name string) (time.Duration, error) {
+	v, ok := options[name]
+	if !ok {
+		return 0, nil
+	}
+
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s: %s", name, err)
+		}
+		return dur, nil
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	}
+
+	return 0, fmt.Errorf("%s must be a duration: %v", name, v)
+}
+
+// rateOption parses the named option as the share of operations affected by
+// a fault, between 0 and 1.
+func rateOption(options map[string]interface{}, name string) (float64, error) {
+	v, ok := options[name]
+	if !ok {
+		return 0, nil
+	}
+
+	rate, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("%s must be a number between 0 and 1: %v", name, v)
+	}
+	return rate, nil
+}
+
+// chance returns true with the given probability.
+func (d *chaosStorageMiddleware) chance(rate float64) bool {
+	if rate == 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rand.Float64() < rate
+}
+
+// intn returns a random number in [0,n).
+func (d *chaosStorageMiddleware) intn(n int64) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rand.Int63n(n)
+}
+
+// inject delays the operation op on path and returns an error if it is to
+// fail.
+func (d *chaosStorageMiddleware) inject(ctx context.Context, op, path string) error {
+	if !d.operations[op] {
+		return nil
+	}
+
+	delay := d.latency
+	if d.jitter > 0 {
+		delay += time.Duration(d.intn(int64(d.jitter)))
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if d.chance(d.errorRate) {
+		context.GetLogger(ctx).Debugf("chaos: failing %s of %s", op, path)
+		return storagedriver.Error{DriverName: d.Name(), Enclosed: ErrInjected}
+	}
+	return nil
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *chaosStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := d.inject(ctx, "getcontent", path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *chaosStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := d.inject(ctx, "putcontent", path); err != nil {
+		return err
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset. A share of the streams fail part way through.
+func (d *chaosStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if err := d.inject(ctx, "readstream", path); err != nil {
+		return nil, err
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, path, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.operations["readstream"] && d.chance(d.truncateRate) {
+		fi, err := d.StorageDriver.Stat(ctx, path)
+		if err == nil && fi.Size() > offset {
+			n := d.intn(fi.Size() - offset)
+			context.GetLogger(ctx).Debugf("chaos: truncating read of %s after %d bytes", path, n)
+			return &truncatedReader{ReadCloser: rc, remaining: n}, nil
+		}
+	}
+
+	return rc, nil
+}
+
+// WriteStream stores the contents of the provided io.Reader at a location
+// designated by the given path. A failed write stores a part of the content
+// before failing.
+func (d *chaosStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if err := d.inject(ctx, "writestream", path); err != nil {
+		// Consume some of the content, as an interrupted upload would.
+		n, _ := d.StorageDriver.WriteStream(ctx, path, offset, io.LimitReader(reader, d.intn(1<<20)))
+		return n, err
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// Stat retrieves the FileInfo for the given path.
+func (d *chaosStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if err := d.inject(ctx, "stat", path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+// List returns a list of the objects that are direct descendants of the given
+// path.
+func (d *chaosStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	if err := d.inject(ctx, "list", path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.List(ctx, path)
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object.
+func (d *chaosStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.inject(ctx, "move", sourcePath); err != nil {
+		return err
+	}
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the wrapped driver supports it.
+func (d *chaosStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.inject(ctx, "copy", sourcePath); err != nil {
+		return err
+	}
+	return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *chaosStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := d.inject(ctx, "delete", path); err != nil {
+		return err
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the
+// given path.
+func (d *chaosStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if err := d.inject(ctx, "urlfor", path); err != nil {
+		return "", err
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+// truncatedReader fails with io.ErrUnexpectedEOF once the given number of
+// bytes has been read.
+type truncatedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (tr *truncatedReader) Read(p []byte) (int, error) {
+	if tr.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > tr.remaining {
+		p = p[:tr.remaining]
+	}
+	n, err := tr.ReadCloser.Read(p)
+	tr.remaining -= int64(n)
+	return n, err
+}
+
+func init() {
+	storagemiddleware.Register("chaos", storagemiddleware.InitFunc(newChaosStorageMiddleware))
+}
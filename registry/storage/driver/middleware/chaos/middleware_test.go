@@ -0,0 +1,133 @@
+package chaos
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	// Without faults, the middleware must behave like the wrapped driver.
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newChaosStorageMiddleware(filesystem.New(root), map[string]interface{}{})
+	}, testsuites.NeverSkip)
+}
+
+func isInjected(err error) bool {
+	if e, ok := err.(storagedriver.Error); ok {
+		return e.Enclosed == ErrInjected
+	}
+	return false
+}
+
+func TestChaosErrors(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d, err := newChaosStorageMiddleware(backend, map[string]interface{}{
+		"errorrate":  1,
+		"operations": []interface{}{"getcontent", "writestream"},
+		"seed":       1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("a"), 4<<20)
+	if err := d.PutContent(ctx, "/a", content); err != nil {
+		t.Fatalf("unexpected error from unaffected operation: %v", err)
+	}
+	if _, err := d.GetContent(ctx, "/a"); !isInjected(err) {
+		t.Fatalf("expected an injected error, got %v", err)
+	}
+
+	n, err := d.WriteStream(ctx, "/b", 0, bytes.NewReader(content))
+	if !isInjected(err) {
+		t.Fatalf("expected an injected error, got %v", err)
+	}
+	if n >= int64(len(content)) {
+		t.Fatalf("expected an interrupted write, wrote %d bytes", n)
+	}
+	if stored, err := backend.GetContent(ctx, "/b"); err != nil || int64(len(stored)) != n {
+		t.Fatalf("expected %d bytes to be stored, got %d, %v", n, len(stored), err)
+	}
+}
+
+func TestChaosTruncatedReads(t *testing.T) {
+	ctx := context.Background()
+	d, err := newChaosStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"truncaterate": "1",
+		"seed":         1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("a"), 1024)
+	if err := d.PutContent(ctx, "/a", content); err != nil {
+		t.Fatalf("unexpected error storing content: %v", err)
+	}
+
+	rc, err := d.ReadStream(ctx, "/a", 0)
+	if err != nil {
+		t.Fatalf("unexpected error reading content: %v", err)
+	}
+	defer rc.Close()
+
+	read, err := ioutil.ReadAll(rc)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected a truncated read, got %v", err)
+	}
+	if len(read) >= len(content) {
+		t.Fatalf("expected a truncated read, read %d bytes", len(read))
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	d, err := newChaosStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"latency": "50ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := d.List(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the operation to be delayed, took %v", elapsed)
+	}
+}
+
+func TestChaosOptions(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"errorrate": 2},
+		{"truncaterate": "often"},
+		{"latency": "soon"},
+		{"operations": []interface{}{"fsync"}},
+		{"seed": "random"},
+	} {
+		if _, err := newChaosStorageMiddleware(inmemory.New(), options); err == nil {
+			t.Errorf("expected options %v to be rejected", options)
+		}
+	}
+}
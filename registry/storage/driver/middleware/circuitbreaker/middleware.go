@@ -0,0 +1,434 @@
+// Package circuitbreaker provides a storage middleware which stops passing
+// operations on to the wrapped storage driver while the storage backend
+// fails most of them, so that requests fail fast during an outage instead of
+// piling up waiting on the backend.
+package circuitbreaker
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	netcontext "golang.org/x/net/context"
+)
+
+const (
+	defaultErrorRate    = 0.5
+	defaultMinRequests  = 20
+	defaultWindow       = 10 * time.Second
+	defaultOpenDuration = 30 * time.Second
+
+	// probeRetryAfter is how long clients are told to wait while a
+	// half-open breaker probes the backend.
+	probeRetryAfter = time.Second
+)
+
+// States of the breaker.
+const (
+	// stateClosed passes every operation on to the storage driver.
+	stateClosed = "closed"
+
+	// stateOpen fails every operation until openDuration has elapsed since
+	// the breaker tripped.
+	stateOpen = "open"
+
+	// stateHalfOpen passes a single operation on to the storage driver,
+	// closing the breaker if it succeeds and opening it again otherwise.
+	stateHalfOpen = "halfopen"
+)
+
+// circuitBreakerStorageMiddleware counts the operations of the wrapped driver
+// which fail in windows of the given duration, and trips once at least
+// minRequests were made in a window and errorRate of them failed. While open,
+// operations fail with a storagedriver.UnavailableError.
+type circuitBreakerStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	errorRate    float64
+	minRequests  int
+	window       time.Duration
+	openDuration time.Duration
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// retryAt is when an open breaker half-opens, and probeStart when the
+	// operation probing a half-open breaker started, if probing.
+	retryAt    time.Time
+	probing    bool
+	probeStart time.Time
+
+	trips    uint64
+	rejected uint64
+
+	now func() time.Time
+}
+
+var _ storagedriver.StorageDriver = &circuitBreakerStorageMiddleware{}
+
+// newCircuitBreakerStorageMiddleware constructs a storage middleware failing
+// fast while the storage backend fails most operations.
+// Optional options: errorrate, minrequests, window, openduration
+func newCircuitBreakerStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	errorRate := defaultErrorRate
+	if v, ok := options["errorrate"]; ok {
+		rate, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("errorrate must be a number greater than 0 and at most 1: %v", v)
+		}
+		errorRate = rate
+	}
+
+	minRequests := defaultMinRequests
+	if v, ok := options["minrequests"]; ok {
+		n, err := strconv.Atoi(fmt.Sprint(v))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("minrequests must be a positive integer: %v", v)
+		}
+		minRequests = n
+	}
+
+	window, err := durationOption(options, "window", defaultWindow)
+	if err != nil {
+		return nil, err
+	}
+	openDuration, err := durationOption(options, "openduration", defaultOpenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &circuitBreakerStorageMiddleware{
+		StorageDriver: storageDriver,
+		errorRate:     errorRate,
+		minRequests:   minRequests,
+		window:        window,
+		openDuration:  openDuration,
+		state:         stateClosed,
+		now:           time.Now,
+	}
+	d.windowStart = d.now()
+
+	breakersMu.Lock()
+	breakers = append(breakers, d)
+	breakersMu.Unlock()
+
+	return d, nil
+}
+
+func durationOption(options map[string]interface{}, name string, defaultValue time.Duration) (time.Duration, error) {
+	v, ok := options[name]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	var d time.Duration
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case string:
+		var err error
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s: %s", name, err)
+		}
+	default:
+		return 0, fmt.Errorf("%s must be a duration: %v", name, v)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive: %v", name, v)
+	}
+	return d, nil
+}
+
+// allow returns an error if an operation may not be passed on to the
+// storage driver, and whether the operation probes a half-open breaker.
+func (d *circuitBreakerStorageMiddleware) allow() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	switch d.state {
+	case stateOpen:
+		if now.Before(d.retryAt) {
+			d.rejected++
+			return false, storagedriver.UnavailableError{DriverName: d.Name(), RetryAfter: d.retryAt.Sub(now)}
+		}
+		d.state = stateHalfOpen
+		d.probing = false
+		fallthrough
+	case stateHalfOpen:
+		// A probe which never completes must not keep the breaker from
+		// closing again.
+		if d.probing && now.Sub(d.probeStart) < d.openDuration {
+			d.rejected++
+			return false, storagedriver.UnavailableError{DriverName: d.Name(), RetryAfter: probeRetryAfter}
+		}
+		d.probing = true
+		d.probeStart = now
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// record records whether an operation failed, tripping the breaker if the
+// backend fails too many operations, or if the operation probed it.
+func (d *circuitBreakerStorageMiddleware) record(ctx context.Context, probe, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if probe {
+		d.probing = false
+		if failed {
+			d.trip(ctx, now)
+			return
+		}
+		context.GetLogger(ctx).Infof("circuitbreaker: storage backend recovered, closing the breaker")
+		d.state = stateClosed
+		d.windowStart, d.requests, d.failures = now, 0, 0
+		return
+	}
+
+	// Operations passed on before the breaker tripped are not counted.
+	if d.state != stateClosed {
+		return
+	}
+
+	if now.Sub(d.windowStart) >= d.window {
+		d.windowStart, d.requests, d.failures = now, 0, 0
+	}
+	d.requests++
+	if failed {
+		d.failures++
+	}
+	if d.requests >= d.minRequests && float64(d.failures) >= d.errorRate*float64(d.requests) {
+		d.trip(ctx, now)
+	}
+}
+
+// trip opens the breaker. d.mu must be held.
+func (d *circuitBreakerStorageMiddleware) trip(ctx context.Context, now time.Time) {
+	context.GetLogger(ctx).Errorf("circuitbreaker: storage backend failing, opening the breaker for %s", d.openDuration)
+	d.state = stateOpen
+	d.retryAt = now.Add(d.openDuration)
+	d.trips++
+}
+
+// isFailure returns whether err is a failure of the storage backend, rather
+// than an error caused by the request, such as a missing path or the client
+// going away.
+func isFailure(ctx context.Context, err error) bool {
+	switch err.(type) {
+	case nil, storagedriver.PathNotFoundError, storagedriver.InvalidPathError, storagedriver.InvalidOffsetError, storagedriver.ErrUnsupportedMethod:
+		return false
+	}
+	return ctx.Err() != netcontext.Canceled
+}
+
+// do passes the operation op on to the storage driver, unless the breaker is
+// open, and records whether it failed.
+func (d *circuitBreakerStorageMiddleware) do(ctx context.Context, op func() error) error {
+	probe, err := d.allow()
+	if err != nil {
+		return err
+	}
+
+	err = op()
+	d.record(ctx, probe, isFailure(ctx, err))
+	return err
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *circuitBreakerStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	var content []byte
+	err := d.do(ctx, func() (err error) {
+		content, err = d.StorageDriver.GetContent(ctx, path)
+		return err
+	})
+	return content, err
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *circuitBreakerStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	return d.do(ctx, func() error {
+		return d.StorageDriver.PutContent(ctx, path, content)
+	})
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *circuitBreakerStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := d.do(ctx, func() (err error) {
+		rc, err = d.StorageDriver.ReadStream(ctx, path, offset)
+		return err
+	})
+	return rc, err
+}
+
+// WriteStream stores the contents of the provided io.Reader at a location
+// designated by the given path. Writes failing because their content could
+// not be read are not counted as failures of the backend.
+func (d *circuitBreakerStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	var nn int64
+	var writeErr error
+	source := &sourceReader{Reader: reader}
+	err := d.do(ctx, func() error {
+		nn, writeErr = d.StorageDriver.WriteStream(ctx, path, offset, source)
+		if source.err != nil {
+			return nil
+		}
+		return writeErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nn, writeErr
+}
+
+// Stat retrieves the FileInfo for the given path.
+func (d *circuitBreakerStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	var fi storagedriver.FileInfo
+	err := d.do(ctx, func() (err error) {
+		fi, err = d.StorageDriver.Stat(ctx, path)
+		return err
+	})
+	return fi, err
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, batching the
+// calls to the wrapped driver if it supports it. The batch counts as a single
+// operation, failed if any of the paths failed.
+func (d *circuitBreakerStorageMiddleware) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	var infos []storagedriver.FileInfo
+	var errs []error
+	err := d.do(ctx, func() error {
+		infos, errs = storagedriver.StatMany(ctx, d.StorageDriver, paths)
+		for _, err := range errs {
+			if isFailure(ctx, err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && errs == nil {
+		infos, errs = make([]storagedriver.FileInfo, len(paths)), make([]error, len(paths))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return infos, errs
+}
+
+// List returns a list of the objects that are direct descendants of the given
+// path.
+func (d *circuitBreakerStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	var entries []string
+	err := d.do(ctx, func() (err error) {
+		entries, err = d.StorageDriver.List(ctx, path)
+		return err
+	})
+	return entries, err
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object.
+func (d *circuitBreakerStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	return d.do(ctx, func() error {
+		return d.StorageDriver.Move(ctx, sourcePath, destPath)
+	})
+}
+
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the wrapped driver supports it.
+func (d *circuitBreakerStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	return d.do(ctx, func() error {
+		return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+	})
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *circuitBreakerStorageMiddleware) Delete(ctx context.Context, path string) error {
+	return d.do(ctx, func() error {
+		return d.StorageDriver.Delete(ctx, path)
+	})
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the
+// given path.
+func (d *circuitBreakerStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	var url string
+	err := d.do(ctx, func() (err error) {
+		url, err = d.StorageDriver.URLFor(ctx, path, options)
+		return err
+	})
+	return url, err
+}
+
+// sourceReader records the error reading the content of a write, other than
+// io.EOF.
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (sr *sourceReader) Read(p []byte) (int, error) {
+	n, err := sr.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
+
+// breakerMetrics are the metrics of a breaker made available via expvar.
+type breakerMetrics struct {
+	Driver   string
+	State    string
+	Trips    uint64
+	Rejected uint64
+}
+
+// breakers are the breakers constructed, whose metrics are made available
+// via expvar.
+var (
+	breakersMu sync.Mutex
+	breakers   []*circuitBreakerStorageMiddleware
+)
+
+func init() {
+	storagemiddleware.Register("circuitbreaker", storagemiddleware.InitFunc(newCircuitBreakerStorageMiddleware))
+
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	registry.(*expvar.Map).Set("circuitbreakers", expvar.Func(func() interface{} {
+		breakersMu.Lock()
+		defer breakersMu.Unlock()
+
+		metrics := make([]breakerMetrics, len(breakers))
+		for i, d := range breakers {
+			d.mu.Lock()
+			metrics[i] = breakerMetrics{
+				Driver:   d.Name(),
+				State:    d.state,
+				Trips:    d.trips,
+				Rejected: d.rejected,
+			}
+			d.mu.Unlock()
+		}
+		return metrics
+	}))
+}
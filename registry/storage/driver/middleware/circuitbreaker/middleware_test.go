@@ -0,0 +1,232 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newCircuitBreakerStorageMiddleware(filesystem.New(root), nil)
+	}, testsuites.NeverSkip)
+}
+
+var errBackend = errors.New("backend failure")
+
+// failingDriver fails every GetContent while failing is set.
+type failingDriver struct {
+	storagedriver.StorageDriver
+	failing bool
+	calls   int
+}
+
+func (d *failingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.calls++
+	if d.failing {
+		return nil, errBackend
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func newTestBreaker(t *testing.T, backend storagedriver.StorageDriver, now *time.Time) *circuitBreakerStorageMiddleware {
+	d, err := newCircuitBreakerStorageMiddleware(backend, map[string]interface{}{
+		"errorrate":    0.5,
+		"minrequests":  4,
+		"window":       "10s",
+		"openduration": "30s",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	cb := d.(*circuitBreakerStorageMiddleware)
+	cb.now = func() time.Time { return *now }
+	cb.windowStart = *now
+	return cb
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	backend := &failingDriver{StorageDriver: inmemory.New()}
+	d := newTestBreaker(t, backend, &now)
+
+	if err := d.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	// Missing paths are not failures of the backend.
+	for i := 0; i < 4; i++ {
+		if _, err := d.GetContent(ctx, "/missing"); err == nil {
+			t.Fatalf("expected an error reading a missing path")
+		}
+	}
+	if d.state != stateClosed {
+		t.Fatalf("breaker tripped on missing paths")
+	}
+
+	// Failures in a new window trip the breaker.
+	now = now.Add(d.window)
+	backend.failing = true
+	for i := 0; i < 4; i++ {
+		if _, err := d.GetContent(ctx, "/a"); err != errBackend {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if d.state != stateOpen || d.trips != 1 {
+		t.Fatalf("breaker did not trip: %s", d.state)
+	}
+
+	// An open breaker fails fast.
+	calls := backend.calls
+	now = now.Add(10 * time.Second)
+	_, err := d.GetContent(ctx, "/a")
+	unavailable, ok := err.(storagedriver.UnavailableError)
+	if !ok || unavailable.RetryAfter != 20*time.Second {
+		t.Fatalf("unexpected error from open breaker: %v", err)
+	}
+	if backend.calls != calls || d.rejected != 1 {
+		t.Fatalf("open breaker passed the operation on")
+	}
+
+	// A failed probe opens the breaker again.
+	now = now.Add(20 * time.Second)
+	if _, err := d.GetContent(ctx, "/a"); err != errBackend {
+		t.Fatalf("unexpected error probing: %v", err)
+	}
+	if d.state != stateOpen || d.trips != 2 {
+		t.Fatalf("breaker did not trip again after a failed probe: %s", d.state)
+	}
+
+	// A successful probe closes it.
+	backend.failing = false
+	now = now.Add(30 * time.Second)
+	if content, err := d.GetContent(ctx, "/a"); err != nil || string(content) != "content" {
+		t.Fatalf("unexpected result probing: %q, %v", content, err)
+	}
+	if d.state != stateClosed {
+		t.Fatalf("breaker did not close after a successful probe: %s", d.state)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := newTestBreaker(t, inmemory.New(), &now)
+
+	d.state = stateOpen
+	d.retryAt = now
+
+	probe, err := d.allow()
+	if !probe || err != nil {
+		t.Fatalf("expected a probe: %v", err)
+	}
+	if d.state != stateHalfOpen {
+		t.Fatalf("breaker did not half-open: %s", d.state)
+	}
+
+	// Operations are rejected while the probe is in flight.
+	if _, err := d.Stat(ctx, "/"); err == nil {
+		t.Fatalf("expected an error while probing")
+	}
+
+	// A probe which never completes is given up on.
+	now = now.Add(d.openDuration)
+	if probe, err := d.allow(); !probe || err != nil {
+		t.Fatalf("expected a new probe: %v", err)
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	backend := &failingDriver{StorageDriver: inmemory.New(), failing: true}
+	d := newTestBreaker(t, backend, &now)
+
+	// Failures spread over windows do not trip the breaker.
+	for i := 0; i < 6; i++ {
+		d.GetContent(ctx, "/a")
+		if i%3 == 2 {
+			now = now.Add(d.window)
+		}
+	}
+	if d.state != stateClosed {
+		t.Fatalf("breaker tripped on failures spread over windows")
+	}
+}
+
+func TestCircuitBreakerSourceErrors(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := newTestBreaker(t, inmemory.New(), &now)
+
+	for i := 0; i < 4; i++ {
+		if _, err := d.WriteStream(ctx, "/a", 0, &errorReader{}); err == nil {
+			t.Fatalf("expected an error writing from a failing reader")
+		}
+	}
+	if d.state != stateClosed {
+		t.Fatalf("breaker tripped on failures reading the content written")
+	}
+}
+
+type errorReader struct{}
+
+func (errorReader) Read(p []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestCircuitBreakerOptions(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"errorrate": 0},
+		{"errorrate": 1.5},
+		{"minrequests": 0},
+		{"window": "soon"},
+		{"openduration": "-1s"},
+	} {
+		if _, err := newCircuitBreakerStorageMiddleware(inmemory.New(), options); err == nil {
+			t.Fatalf("expected an error with options %v", options)
+		}
+	}
+}
+
+func TestCircuitBreakerStatMany(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := newTestBreaker(t, inmemory.New(), &now)
+
+	if err := d.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	infos, errs := d.StatMany(ctx, []string{"/a", "/missing"})
+	if errs[0] != nil || infos[0].Size() != 7 || errs[1] == nil {
+		t.Fatalf("unexpected stats: %v, %v", infos, errs)
+	}
+
+	d.state = stateOpen
+	d.retryAt = now.Add(time.Second)
+	_, errs = d.StatMany(ctx, []string{"/a", "/missing"})
+	for _, err := range errs {
+		if _, ok := err.(storagedriver.UnavailableError); !ok {
+			t.Fatalf("unexpected error from open breaker: %v", err)
+		}
+	}
+}
@@ -113,6 +113,12 @@ func (lh *cloudFrontStorageMiddleware) URLFor(ctx context.Context, path string,
 	return cfURL, nil
 }
 
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the wrapped driver supports it.
+func (lh *cloudFrontStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	return storagedriver.Copy(ctx, lh.StorageDriver, sourcePath, destPath)
+}
+
 // init registers the cloudfront layerHandler backend.
 func init() {
 	storagemiddleware.Register("cloudfront", storagemiddleware.InitFunc(newCloudFrontStorageMiddleware))
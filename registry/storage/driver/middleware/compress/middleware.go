@@ -0,0 +1,511 @@
+// Package compress provides a storage middleware which stores compressible
+// blobs, such as raw artifacts, compressed with zstd on the wrapped storage
+// driver and decompresses them as they are read.
+package compress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	compressible "github.com/klauspost/compress"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultMinSize = 4 << 10
+
+	// sampleSize is the size of the beginning of a blob from which its
+	// compressibility is estimated.
+	sampleSize = 64 << 10
+
+	// metadataName is the name of the object describing a compressed blob,
+	// stored next to its data.
+	metadataName = "compression"
+
+	algorithmZstd = "zstd"
+)
+
+// blobDataRegexp matches the path of the data of a blob, in any blob store
+// layout, capturing the algorithm and hex of its digest.
+var blobDataRegexp = regexp.MustCompile(`^/docker/registry/v2/blobs/([a-z0-9]+(?:[.+_-][a-z0-9]+)*)/(?:[0-9a-f]{2}/){1,3}([0-9a-f]+)/data$`)
+
+// compressedMagic are the leading bytes of the formats which are compressed
+// already.
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                         // gzip
+	{0x28, 0xb5, 0x2f, 0xfd},             // zstd
+	{0x42, 0x5a, 0x68},                   // bzip2
+	{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}, // xz
+	{0x04, 0x22, 0x4d, 0x18},             // lz4
+	{0x50, 0x4b, 0x03, 0x04},             // zip
+}
+
+// compressStorageMiddleware compresses the blobs committed from an upload or
+// put to the blob store, when they are at least minSize bytes and their
+// beginning looks compressible. The size and digest of the original content
+// of a compressed blob are stored in a metadata object next to its data, from
+// which its size is reported and its content verified as it is read in full.
+type compressStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	minSize int64
+	level   zstd.EncoderLevel
+}
+
+// metadata describes the original content of a compressed blob.
+type metadata struct {
+	Algorithm string        `json:"algorithm"`
+	Size      int64         `json:"size"`
+	Digest    digest.Digest `json:"digest"`
+}
+
+var _ storagedriver.StorageDriver = &compressStorageMiddleware{}
+
+// newCompressStorageMiddleware constructs a storage middleware compressing
+// the blobs stored through storageDriver.
+// Optional options: minsize, level
+func newCompressStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	minSize := int64(defaultMinSize)
+	if v, ok := options["minsize"]; ok {
+		n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("minsize must be a non-negative integer: %v", v)
+		}
+		minSize = n
+	}
+
+	level := zstd.SpeedDefault
+	if v, ok := options["level"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("level must be a string: %v", v)
+		}
+		if ok, level = zstd.EncoderLevelFromString(s); !ok {
+			return nil, fmt.Errorf("level must be one of fastest, default, better or best: %q", s)
+		}
+	}
+
+	return &compressStorageMiddleware{
+		StorageDriver: storageDriver,
+		minSize:       minSize,
+		level:         level,
+	}, nil
+}
+
+// blobDigest returns the digest of the blob whose data is stored at path, if
+// path is the data path of a blob.
+func blobDigest(path string) (digest.Digest, bool) {
+	m := blobDataRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return "", false
+	}
+	return digest.NewDigestFromHex(m[1], m[2]), true
+}
+
+func metadataPath(dataPath string) string {
+	return path.Join(path.Dir(dataPath), metadataName)
+}
+
+// isCompressible returns true if the sample, read from the beginning of a blob,
+// is neither in a compressed format nor unlikely to compress.
+func isCompressible(sample []byte) bool {
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(sample, magic) {
+			return false
+		}
+	}
+	return compressible.Estimate(sample) >= 0.1
+}
+
+// metadata returns the metadata of the blob whose data is stored at path, or
+// nil if path does not hold a compressed blob.
+func (d *compressStorageMiddleware) metadata(ctx context.Context, path string) (*metadata, error) {
+	if _, ok := blobDigest(path); !ok {
+		return nil, nil
+	}
+
+	p, err := d.StorageDriver.GetContent(ctx, metadataPath(path))
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var m metadata
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, fmt.Errorf("invalid compression metadata of %s: %v", path, err)
+	}
+	if m.Algorithm != algorithmZstd {
+		return nil, fmt.Errorf("unsupported compression algorithm of %s: %q", path, m.Algorithm)
+	}
+	return &m, nil
+}
+
+// removeMetadata removes the metadata left next to the data path of a blob
+// by an earlier compressed copy of it.
+func (d *compressStorageMiddleware) removeMetadata(ctx context.Context, path string) error {
+	err := d.StorageDriver.Delete(ctx, metadataPath(path))
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// GetContent retrieves the content stored at "path" as a []byte, decompressed.
+func (d *compressStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	m, err := d.metadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return d.StorageDriver.GetContent(ctx, path)
+	}
+
+	rc, err := d.ReadStream(ctx, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// PutContent stores the []byte content at a location designated by "path",
+// compressed if it is the data of a compressible blob.
+func (d *compressStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	dgst, ok := blobDigest(path)
+	if !ok {
+		return d.StorageDriver.PutContent(ctx, path, content)
+	}
+
+	sample := content
+	if len(sample) > sampleSize {
+		sample = sample[:sampleSize]
+	}
+	if int64(len(content)) >= d.minSize && isCompressible(sample) {
+		compressed, err := d.compress(ctx, path, dgst, int64(len(content)), bytes.NewReader(content))
+		if compressed || err != nil {
+			return err
+		}
+	}
+
+	if err := d.removeMetadata(ctx, path); err != nil {
+		return err
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset, decompressed. A compressed blob read from its beginning
+// is verified against its digest.
+func (d *compressStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	m, err := d.metadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return d.StorageDriver.ReadStream(ctx, path, offset)
+	}
+	if offset < 0 || offset > m.Size {
+		return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(rc, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	r := &decompressReader{
+		path:   path,
+		dec:    dec,
+		rc:     rc,
+		size:   m.Size,
+		offset: offset,
+		dgst:   m.Digest,
+	}
+	if offset == 0 {
+		r.digester = m.Digest.Algorithm().New()
+	}
+
+	if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, dec, offset); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Stat retrieves the FileInfo for the given path, with the size of the
+// original content of compressed blobs.
+func (d *compressStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return d.originalFileInfo(ctx, fi)
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, batching the
+// calls to the wrapped driver if it supports it.
+func (d *compressStorageMiddleware) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	infos, errs := storagedriver.StatMany(ctx, d.StorageDriver, paths)
+	for i := range paths {
+		if errs[i] == nil {
+			infos[i], errs[i] = d.originalFileInfo(ctx, infos[i])
+		}
+	}
+	return infos, errs
+}
+
+// originalFileInfo returns fi with the size of the original content if it
+// describes the data of a compressed blob.
+func (d *compressStorageMiddleware) originalFileInfo(ctx context.Context, fi storagedriver.FileInfo) (storagedriver.FileInfo, error) {
+	if fi.IsDir() {
+		return fi, nil
+	}
+	m, err := d.metadata(ctx, fi.Path())
+	if err != nil || m == nil {
+		return fi, err
+	}
+
+	return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+		Path:    fi.Path(),
+		Size:    m.Size,
+		ModTime: fi.ModTime(),
+	}}, nil
+}
+
+// Move moves an object stored at sourcePath to destPath. A completed upload
+// moved to the data path of a blob is compressed if it is compressible, and
+// the metadata of a compressed blob moved between blob store layouts is moved
+// along with it.
+func (d *compressStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	dgst, ok := blobDigest(destPath)
+	if !ok {
+		return d.StorageDriver.Move(ctx, sourcePath, destPath)
+	}
+
+	if _, ok := blobDigest(sourcePath); ok {
+		m, err := d.metadata(ctx, sourcePath)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			// The metadata is moved first: data without its metadata
+			// would be served compressed.
+			if err := d.StorageDriver.Move(ctx, metadataPath(sourcePath), metadataPath(destPath)); err != nil {
+				return err
+			}
+			return d.StorageDriver.Move(ctx, sourcePath, destPath)
+		}
+	} else {
+		compressed, err := d.compressUpload(ctx, sourcePath, destPath, dgst)
+		if err != nil {
+			return err
+		}
+		if compressed {
+			return d.StorageDriver.Delete(ctx, sourcePath)
+		}
+	}
+
+	if err := d.removeMetadata(ctx, destPath); err != nil {
+		return err
+	}
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the wrapped driver supports it. The metadata of a compressed
+// blob copied between blob store layouts is copied along with it.
+func (d *compressStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	m, err := d.metadata(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := blobDigest(destPath); !ok {
+		if m != nil {
+			return fmt.Errorf("compress: cannot copy compressed blob %s outside of the blob store", sourcePath)
+		}
+		return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+	}
+
+	if m != nil {
+		// The metadata is copied first: data without its metadata would
+		// be served compressed.
+		if err := storagedriver.Copy(ctx, d.StorageDriver, metadataPath(sourcePath), metadataPath(destPath)); err != nil {
+			return err
+		}
+	} else if err := d.removeMetadata(ctx, destPath); err != nil {
+		return err
+	}
+	return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+}
+
+// compressUpload stores the content at sourcePath compressed at the data path
+// of the blob identified by dgst, if it is compressible. It returns false if
+// the content was left in place.
+func (d *compressStorageMiddleware) compressUpload(ctx context.Context, sourcePath, destPath string, dgst digest.Digest) (bool, error) {
+	fi, err := d.StorageDriver.Stat(ctx, sourcePath)
+	if err != nil {
+		return false, err
+	}
+	if fi.IsDir() || fi.Size() < d.minSize {
+		return false, nil
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, sourcePath, 0)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	sample := make([]byte, sampleSize)
+	n, err := io.ReadFull(rc, sample)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	sample = sample[:n]
+	if !isCompressible(sample) {
+		return false, nil
+	}
+
+	return d.compress(ctx, destPath, dgst, fi.Size(), io.MultiReader(bytes.NewReader(sample), rc))
+}
+
+// compress stores the content read from r, of the given size, compressed at
+// the data path of the blob identified by dgst, after its metadata. It
+// returns false, leaving nothing stored, if the content did not shrink.
+func (d *compressStorageMiddleware) compress(ctx context.Context, path string, dgst digest.Digest, size int64, r io.Reader) (bool, error) {
+	if !dgst.Algorithm().Available() {
+		return false, nil
+	}
+
+	p, err := json.Marshal(metadata{
+		Algorithm: algorithmZstd,
+		Size:      size,
+		Digest:    dgst,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := d.StorageDriver.PutContent(ctx, metadataPath(path), p); err != nil {
+		return false, err
+	}
+
+	digester := dgst.Algorithm().New()
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc, err := zstd.NewWriter(pw, zstd.WithEncoderLevel(d.level))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(enc, io.TeeReader(r, digester.Hash()))
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	nn, err := d.StorageDriver.WriteStream(ctx, path, 0, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	if err == nil && digester.Digest() != dgst {
+		err = fmt.Errorf("content of %s does not match its digest %s", path, dgst)
+	}
+	if err != nil || nn >= size {
+		if derr := d.StorageDriver.Delete(ctx, path); derr != nil {
+			if _, ok := derr.(storagedriver.PathNotFoundError); !ok {
+				context.GetLogger(ctx).Errorf("error removing compressed data of %s: %v", path, derr)
+			}
+		}
+		if rerr := d.removeMetadata(ctx, path); rerr != nil {
+			context.GetLogger(ctx).Errorf("error removing compression metadata of %s: %v", path, rerr)
+		}
+		return false, err
+	}
+
+	context.GetLogger(ctx).Debugf("compressed %s from %d to %d bytes", path, size, nn)
+	return true, nil
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths,
+// along with the metadata of a compressed blob.
+func (d *compressStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if _, ok := blobDigest(path); ok {
+		if err := d.removeMetadata(ctx, path); err != nil {
+			return err
+		}
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// URLFor returns a URL for the content at path. Compressed blobs have no URL
+// and must be served by the registry.
+func (d *compressStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	m, err := d.metadata(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if m != nil {
+		return "", storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+// decompressReader reads the original content of a compressed blob. If read
+// from the beginning, the content is verified against the digest of the blob
+// when the end is reached.
+type decompressReader struct {
+	path     string
+	dec      *zstd.Decoder
+	rc       io.ReadCloser
+	size     int64
+	offset   int64
+	dgst     digest.Digest
+	digester digest.Digester
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	n, err := r.dec.Read(p)
+	r.offset += int64(n)
+	if r.digester != nil {
+		r.digester.Hash().Write(p[:n])
+	}
+	if err == io.EOF {
+		if r.offset != r.size {
+			return n, fmt.Errorf("compressed blob %s has %d bytes instead of %d", r.path, r.offset, r.size)
+		}
+		if r.digester != nil && r.digester.Digest() != r.dgst {
+			return n, fmt.Errorf("compressed blob %s does not match its digest %s", r.path, r.dgst)
+		}
+	}
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	r.dec.Close()
+	return r.rc.Close()
+}
+
+func init() {
+	storagemiddleware.Register("compress", storagemiddleware.InitFunc(newCompressStorageMiddleware))
+}
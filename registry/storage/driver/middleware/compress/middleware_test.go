@@ -0,0 +1,169 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newCompressStorageMiddleware(filesystem.New(root), nil)
+	}, testsuites.NeverSkip)
+}
+
+const uploadPath = "/docker/registry/v2/repositories/foo/_uploads/id/data"
+
+func blobPath(dgst digest.Digest) string {
+	return path.Join("/docker/registry/v2/blobs", dgst.Algorithm().String(), dgst.Hex()[:2], dgst.Hex(), "data")
+}
+
+func newTestMiddleware(t *testing.T, backend storagedriver.StorageDriver) storagedriver.StorageDriver {
+	d, err := newCompressStorageMiddleware(backend, map[string]interface{}{
+		"minsize": 1024,
+		"level":   "fastest",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return d
+}
+
+func TestCompress(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	content := []byte(strings.Repeat(`{"name":"artifact","kind":"raw"}`, 1024))
+	dgst := digest.FromBytes(content)
+	p := blobPath(dgst)
+
+	if _, err := d.WriteStream(ctx, uploadPath, 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if err := d.Move(ctx, uploadPath, p); err != nil {
+		t.Fatalf("unexpected error moving upload: %v", err)
+	}
+	if _, err := backend.Stat(ctx, uploadPath); err == nil {
+		t.Fatalf("upload was not removed")
+	}
+
+	stored, err := backend.GetContent(ctx, p)
+	if err != nil {
+		t.Fatalf("unexpected error reading stored blob: %v", err)
+	}
+	if len(stored) >= len(content) {
+		t.Fatalf("blob was not compressed: %d bytes stored", len(stored))
+	}
+
+	fi, err := d.Stat(ctx, p)
+	if err != nil || fi.Size() != int64(len(content)) {
+		t.Fatalf("unexpected blob info: %v, %v", fi, err)
+	}
+	infos, errs := d.(storagedriver.BatchStatter).StatMany(ctx, []string{p, uploadPath})
+	if errs[0] != nil || infos[0].Size() != int64(len(content)) || errs[1] == nil {
+		t.Fatalf("unexpected blob infos: %v, %v", infos, errs)
+	}
+
+	read, err := d.GetContent(ctx, p)
+	if err != nil || !bytes.Equal(read, content) {
+		t.Fatalf("unexpected blob content: %v", err)
+	}
+
+	rc, err := d.ReadStream(ctx, p, 100)
+	if err != nil {
+		t.Fatalf("unexpected error reading blob at offset: %v", err)
+	}
+	read, err = ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(read, content[100:]) {
+		t.Fatalf("unexpected blob content at offset: %v", err)
+	}
+
+	if _, err := d.URLFor(ctx, p, nil); err == nil {
+		t.Fatalf("expected compressed blob to have no URL")
+	}
+
+	// Blobs are moved along with their metadata between layouts.
+	moved := path.Join("/docker/registry/v2/blobs/sha256", dgst.Hex()[:2], dgst.Hex()[2:4], dgst.Hex(), "data")
+	if err := d.Move(ctx, p, moved); err != nil {
+		t.Fatalf("unexpected error moving blob: %v", err)
+	}
+	read, err = d.GetContent(ctx, moved)
+	if err != nil || !bytes.Equal(read, content) {
+		t.Fatalf("unexpected moved blob content: %v", err)
+	}
+
+	if err := d.Delete(ctx, moved); err != nil {
+		t.Fatalf("unexpected error deleting blob: %v", err)
+	}
+	if _, err := backend.Stat(ctx, metadataPath(moved)); err == nil {
+		t.Fatalf("metadata of deleted blob was not removed")
+	}
+}
+
+func TestCompressSkipsIncompressible(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(strings.Repeat("layer content ", 1024)))
+	gz.Close()
+	small := []byte("small blob")
+
+	for _, content := range [][]byte{buf.Bytes(), small} {
+		p := blobPath(digest.FromBytes(content))
+		if err := d.PutContent(ctx, p, content); err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+
+		stored, err := backend.GetContent(ctx, p)
+		if err != nil || !bytes.Equal(stored, content) {
+			t.Fatalf("blob was not stored as is: %v", err)
+		}
+		if _, err := backend.Stat(ctx, metadataPath(p)); err == nil {
+			t.Fatalf("metadata stored for uncompressed blob")
+		}
+	}
+}
+
+func TestCompressVerifiesDigest(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	content := []byte(strings.Repeat("artifact content ", 1024))
+	p := blobPath(digest.FromBytes([]byte("other content")))
+	if err := d.PutContent(ctx, p, content); err == nil {
+		t.Fatalf("expected an error storing content not matching its digest")
+	}
+	if _, err := backend.Stat(ctx, p); err == nil {
+		t.Fatalf("content not matching its digest was stored")
+	}
+	if _, err := backend.Stat(ctx, metadataPath(p)); err == nil {
+		t.Fatalf("metadata of content not matching its digest was stored")
+	}
+}
@@ -0,0 +1,811 @@
+// Package pack provides a storage middleware which stores small objects, such
+// as links, manifests and image configurations, in consolidated pack files
+// instead of an object each, reducing the number of objects kept by the
+// wrapped storage driver and the cost of listing them.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/uuid"
+)
+
+const (
+	defaultMaxSize       = 16 << 10
+	defaultPackSize      = 8 << 20
+	defaultPackDirectory = "/_packs"
+)
+
+// packStorageMiddleware appends the content of every PutContent call no
+// larger than maxSize to a pack file on the wrapped driver, and records its
+// location in the index file of the pack. Each process appends to packs of
+// its own, and keeps the index of all packs in memory: it is read when the
+// middleware is constructed and, if a refresh interval is set, reloaded
+// periodically to pick up the writes of other processes.
+//
+// Removing a packed object appends a tombstone to the index. Where the index
+// of several packs mention a path, the record with the highest generation
+// wins. Each record is given a generation higher than that of every record
+// known to the process appending it, so that a write supersedes those it
+// could have observed whatever the clocks of the processes. Records of equal
+// generation, appended concurrently by processes unaware of each other, are
+// ordered by pack name.
+//
+// Records are appended under the storage scope of the call which queued them,
+// to packs of that scope only.
+type packStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	maxSize       int64
+	packSize      int64
+	packDirectory string
+
+	writes chan *commitRequest
+
+	// current holds the pack appended to for each storage scope, by scope
+	// key. It is only accessed by the committer.
+	current map[string]*currentPack
+
+	loadMu sync.Mutex
+
+	mu         sync.RWMutex
+	entries    map[string]entry
+	children   map[string]map[string]int
+	loaded     map[string]int64
+	generation int64
+}
+
+// currentPack is the pack appended to for a storage scope.
+type currentPack struct {
+	name      string
+	dataSize  int64
+	indexSize int64
+}
+
+// entry locates the content of a packed path. Tombstones have a negative
+// size. Entries read from indexes written before generations were recorded
+// have a zero generation.
+type entry struct {
+	pack       string
+	offset     int64
+	size       int64
+	modTime    time.Time
+	generation int64
+}
+
+// supersedes returns true if e is a newer record of a path than old.
+func (e entry) supersedes(old entry) bool {
+	if e.generation != old.generation {
+		return e.generation > old.generation
+	}
+	if !e.modTime.Equal(old.modTime) {
+		return e.modTime.After(old.modTime)
+	}
+	return e.pack >= old.pack
+}
+
+// record is an object or a tombstone to be appended to the current pack.
+type record struct {
+	path      string
+	content   []byte
+	tombstone bool
+}
+
+type commitRequest struct {
+	scope   storagemiddleware.Scope
+	records []record
+	done    chan error
+}
+
+var _ storagedriver.StorageDriver = &packStorageMiddleware{}
+
+// newPackStorageMiddleware constructs a storage middleware packing small
+// objects stored through storageDriver.
+// Optional options: maxsize, packsize, packdirectory, refreshinterval
+func newPackStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	maxSize, err := sizeOption(options, "maxsize", defaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	packSize, err := sizeOption(options, "packsize", defaultPackSize)
+	if err != nil {
+		return nil, err
+	}
+
+	packDirectory := defaultPackDirectory
+	if p, ok := options["packdirectory"]; ok {
+		packDirectory, ok = p.(string)
+		if !ok || !storagedriver.PathRegexp.MatchString(packDirectory) {
+			return nil, fmt.Errorf("packdirectory must be an absolute path: %v", p)
+		}
+	}
+
+	var refreshInterval time.Duration
+	if r, ok := options["refreshinterval"]; ok {
+		switch r := r.(type) {
+		case time.Duration:
+			refreshInterval = r
+		case string:
+			refreshInterval, err = time.ParseDuration(r)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid refreshinterval: %s", err)
+			}
+		default:
+			return nil, fmt.Errorf("refreshinterval must be a duration: %v", r)
+		}
+	}
+
+	d := &packStorageMiddleware{
+		StorageDriver: storageDriver,
+		maxSize:       maxSize,
+		packSize:      packSize,
+		packDirectory: packDirectory,
+		writes:        make(chan *commitRequest, 64),
+		current:       make(map[string]*currentPack),
+		entries:       make(map[string]entry),
+		children:      make(map[string]map[string]int),
+		loaded:        make(map[string]int64),
+	}
+
+	if err := d.load(context.Background()); err != nil {
+		return nil, fmt.Errorf("unable to load pack indexes: %v", err)
+	}
+
+	go d.committer()
+	if refreshInterval > 0 {
+		go d.refresher(refreshInterval)
+	}
+
+	return d, nil
+}
+
+func sizeOption(options map[string]interface{}, name string, def int64) (int64, error) {
+	v, ok := options[name]
+	if !ok {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer: %v", name, v)
+	}
+	return n, nil
+}
+
+func (d *packStorageMiddleware) dataPath(pack string) string {
+	return path.Join(d.packDirectory, pack, "data")
+}
+
+func (d *packStorageMiddleware) indexPath(pack string) string {
+	return path.Join(d.packDirectory, pack, "index")
+}
+
+// lookup returns the entry of a packed path which has not been removed.
+func (d *packStorageMiddleware) lookup(path string) (entry, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e, ok := d.entries[path]
+	return e, ok && e.size >= 0
+}
+
+// isPackedDir returns true if packed paths exist under path.
+func (d *packStorageMiddleware) isPackedDir(path string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.children[path]) > 0
+}
+
+// packedUnder returns path, if it is packed, and the packed paths below it.
+func (d *packStorageMiddleware) packedUnder(p string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var paths []string
+	if e, ok := d.entries[p]; ok && e.size >= 0 {
+		paths = append(paths, p)
+	}
+
+	dirs := []string{p}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		for child := range d.children[dir] {
+			if e, ok := d.entries[child]; ok && e.size >= 0 {
+				paths = append(paths, child)
+			}
+			dirs = append(dirs, child)
+		}
+	}
+	return paths
+}
+
+// apply records e as the location of path, unless a newer record is already
+// known.
+func (d *packStorageMiddleware) apply(p string, e entry) {
+	old, ok := d.entries[p]
+	if ok && !e.supersedes(old) {
+		return
+	}
+	d.entries[p] = e
+
+	wasLive := ok && old.size >= 0
+	isLive := e.size >= 0
+	if wasLive == isLive {
+		return
+	}
+
+	for child := p; child != "/"; child = path.Dir(child) {
+		parent := path.Dir(child)
+		if isLive {
+			if d.children[parent] == nil {
+				d.children[parent] = make(map[string]int)
+			}
+			d.children[parent][child]++
+			continue
+		}
+
+		if d.children[parent][child]--; d.children[parent][child] == 0 {
+			delete(d.children[parent], child)
+			if len(d.children[parent]) == 0 {
+				delete(d.children, parent)
+			}
+		}
+	}
+}
+
+// commit appends records to the current pack of the storage scope of ctx,
+// returning once they are stored on the wrapped driver.
+func (d *packStorageMiddleware) commit(ctx context.Context, records ...record) error {
+	req := &commitRequest{
+		scope:   storagemiddleware.GetScope(ctx),
+		records: records,
+		done:    make(chan error, 1),
+	}
+	d.writes <- req
+	return <-req.done
+}
+
+// committer appends the records of queued requests to the current pack of
+// their storage scope. The requests of a scope queued while an append is in
+// progress are appended together.
+func (d *packStorageMiddleware) committer() {
+	for req := range d.writes {
+		reqs := []*commitRequest{req}
+	drain:
+		for {
+			select {
+			case req := <-d.writes:
+				reqs = append(reqs, req)
+			default:
+				break drain
+			}
+		}
+
+		var keys []string
+		batches := make(map[string][]*commitRequest)
+		for _, req := range reqs {
+			key := scopeKey(req.scope)
+			if _, ok := batches[key]; !ok {
+				keys = append(keys, key)
+			}
+			batches[key] = append(batches[key], req)
+		}
+
+		for _, key := range keys {
+			batch := batches[key]
+			var records []record
+			for _, req := range batch {
+				records = append(records, req.records...)
+			}
+
+			ctx := storagemiddleware.WithScope(context.Background(), batch[0].scope)
+			err := d.appendRecords(ctx, key, records)
+			for _, req := range batch {
+				req.done <- err
+			}
+		}
+	}
+}
+
+// scopeKey returns a key identifying scope.
+func scopeKey(scope storagemiddleware.Scope) string {
+	keys := make([]string, 0, len(scope))
+	for key := range scope {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%q=%q;", key, scope[key])
+	}
+	return b.String()
+}
+
+// appendRecords writes the content of records to the data file of the
+// current pack of the scope identified by key, then their entries to its
+// index. An object becomes visible once its index entry is stored. After a
+// failed write the pack is left behind, so that a partially written entry is
+// only ever the last line of an index.
+func (d *packStorageMiddleware) appendRecords(ctx context.Context, key string, records []record) error {
+	current := d.current[key]
+	if current == nil || current.dataSize >= d.packSize {
+		current = &currentPack{name: uuid.Generate().String()}
+		d.current[key] = current
+	}
+
+	d.mu.Lock()
+	generation := d.generation
+	d.generation += int64(len(records))
+	d.mu.Unlock()
+
+	now := time.Now()
+	var data, index bytes.Buffer
+	entries := make([]entry, len(records))
+	for i, r := range records {
+		generation++
+		e := entry{pack: current.name, offset: current.dataSize + int64(data.Len()), size: -1, modTime: now, generation: generation}
+		if !r.tombstone {
+			e.size = int64(len(r.content))
+			data.Write(r.content)
+		}
+		entries[i] = e
+		fmt.Fprintf(&index, "%d %d %d %s %d\n", e.modTime.UnixNano(), e.offset, e.size, r.path, e.generation)
+	}
+
+	if n := int64(data.Len()); n > 0 {
+		if _, err := d.StorageDriver.WriteStream(ctx, d.dataPath(current.name), current.dataSize, &data); err != nil {
+			delete(d.current, key)
+			return err
+		}
+		current.dataSize += n
+	}
+
+	n := int64(index.Len())
+	if _, err := d.StorageDriver.WriteStream(ctx, d.indexPath(current.name), current.indexSize, &index); err != nil {
+		delete(d.current, key)
+		return err
+	}
+	current.indexSize += n
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, r := range records {
+		d.apply(r.path, entries[i])
+	}
+	if d.loaded[current.name] < current.indexSize {
+		d.loaded[current.name] = current.indexSize
+	}
+	return nil
+}
+
+// load reads the index entries of every pack which have not been read yet.
+func (d *packStorageMiddleware) load(ctx context.Context) error {
+	d.loadMu.Lock()
+	defer d.loadMu.Unlock()
+
+	packs, err := d.StorageDriver.List(ctx, d.packDirectory)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, p := range packs {
+		pack := path.Base(p)
+		if err := d.loadIndex(ctx, pack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIndex reads the complete lines appended to the index of pack since it
+// was last read.
+func (d *packStorageMiddleware) loadIndex(ctx context.Context, pack string) error {
+	d.mu.RLock()
+	offset := d.loaded[pack]
+	d.mu.RUnlock()
+
+	fi, err := d.StorageDriver.Stat(ctx, d.indexPath(pack))
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	if fi.Size() <= offset {
+		return nil
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, d.indexPath(pack), offset)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r := bufio.NewReader(rc)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		e, p, ok := parseEntry(pack, line)
+		if !ok {
+			context.GetLogger(ctx).Warnf("pack: ignoring malformed index entry in %s: %q", pack, line)
+			continue
+		}
+		d.apply(p, e)
+		if d.generation < e.generation {
+			d.generation = e.generation
+		}
+	}
+	if d.loaded[pack] < offset {
+		d.loaded[pack] = offset
+	}
+	return nil
+}
+
+// parseEntry parses an index line of the form
+// "<unix nanoseconds> <offset> <size> <path> <generation>\n". The generation
+// is missing from the lines of indexes written before it was recorded.
+func parseEntry(pack, line string) (entry, string, bool) {
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	if len(fields) != 4 && len(fields) != 5 {
+		return entry{}, "", false
+	}
+	if !storagedriver.PathRegexp.MatchString(fields[3]) {
+		return entry{}, "", false
+	}
+	p := fields[3]
+	fields = append(fields[:3], fields[4:]...)
+
+	values := make([]int64, len(fields))
+	for i := range values {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || (i == 3 && v <= 0) {
+			return entry{}, "", false
+		}
+		values[i] = v
+	}
+
+	e := entry{
+		pack:    pack,
+		offset:  values[1],
+		size:    values[2],
+		modTime: time.Unix(0, values[0]),
+	}
+	if len(values) == 4 {
+		e.generation = values[3]
+	}
+	return e, p, true
+}
+
+// refresher reloads the pack indexes every interval until the process exits.
+func (d *packStorageMiddleware) refresher(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx := context.Background()
+		if err := d.load(ctx); err != nil {
+			context.GetLogger(ctx).Errorf("pack: error reloading pack indexes: %v", err)
+		}
+	}
+}
+
+// readPacked returns a reader for the packed content of e from offset.
+func (d *packStorageMiddleware) readPacked(ctx context.Context, e entry, offset int64) (io.ReadCloser, error) {
+	if e.size-offset == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, d.dataPath(e.pack), e.offset+offset)
+	if err != nil {
+		return nil, err
+	}
+	return limitedReadCloser{Reader: io.LimitReader(rc, e.size-offset), Closer: rc}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (d *packStorageMiddleware) fileInfo(path string, e entry) storagedriver.FileInfo {
+	return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+		Path:    path,
+		Size:    e.size,
+		ModTime: e.modTime,
+	}}
+}
+
+func (d *packStorageMiddleware) invalidPath(path string) error {
+	if storagedriver.PathRegexp.MatchString(path) {
+		return nil
+	}
+	return storagedriver.InvalidPathError{Path: path, DriverName: d.Name()}
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *packStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	e, ok := d.lookup(path)
+	if !ok {
+		return d.StorageDriver.GetContent(ctx, path)
+	}
+
+	rc, err := d.readPacked(ctx, e, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+// Content no larger than the configured maximum is appended to a pack.
+func (d *packStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := d.invalidPath(path); err != nil {
+		return err
+	}
+
+	if int64(len(content)) <= d.maxSize {
+		return d.commit(ctx, record{path: path, content: content})
+	}
+
+	if err := d.StorageDriver.PutContent(ctx, path, content); err != nil {
+		return err
+	}
+	if _, ok := d.lookup(path); ok {
+		return d.commit(ctx, record{path: path, tombstone: true})
+	}
+	return nil
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *packStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	e, ok := d.lookup(path)
+	if !ok {
+		return d.StorageDriver.ReadStream(ctx, path, offset)
+	}
+
+	if offset < 0 || offset > e.size {
+		return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+	}
+	return d.readPacked(ctx, e, offset)
+}
+
+// WriteStream stores the contents of the provided io.Reader at a location
+// designated by the given path. A packed object written to is first moved to
+// the wrapped driver.
+func (d *packStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if e, ok := d.lookup(path); ok {
+		if offset > 0 {
+			content, err := d.GetContent(ctx, path)
+			if err != nil {
+				return 0, err
+			}
+			if offset > e.size {
+				return 0, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+			}
+			if err := d.StorageDriver.PutContent(ctx, path, content); err != nil {
+				return 0, err
+			}
+		} else if err := d.deleteShadowed(ctx, path); err != nil {
+			return 0, err
+		}
+
+		if err := d.commit(ctx, record{path: path, tombstone: true}); err != nil {
+			return 0, err
+		}
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// deleteShadowed removes an object stored on the wrapped driver at a packed
+// path, which would otherwise reappear once the packed object is removed.
+func (d *packStorageMiddleware) deleteShadowed(ctx context.Context, path string) error {
+	err := d.StorageDriver.Delete(ctx, path)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// Stat retrieves the FileInfo for the given path. Directories which only
+// hold packed objects are reported as such.
+func (d *packStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if e, ok := d.lookup(path); ok {
+		return d.fileInfo(path, e), nil
+	}
+
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok && d.isPackedDir(path) {
+		return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+			Path:  path,
+			IsDir: true,
+		}}, nil
+	}
+	return fi, err
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, batching the
+// paths which are not packed if the wrapped driver supports it.
+func (d *packStorageMiddleware) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	infos := make([]storagedriver.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+
+	var backend []string
+	var indexes []int
+	for i, path := range paths {
+		if e, ok := d.lookup(path); ok {
+			infos[i] = d.fileInfo(path, e)
+			continue
+		}
+		backend = append(backend, path)
+		indexes = append(indexes, i)
+	}
+
+	binfos, berrs := storagedriver.StatMany(ctx, d.StorageDriver, backend)
+	for j, i := range indexes {
+		infos[i], errs[i] = binfos[j], berrs[j]
+		if _, ok := errs[i].(storagedriver.PathNotFoundError); ok && d.isPackedDir(paths[i]) {
+			infos[i] = storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:  paths[i],
+				IsDir: true,
+			}}
+			errs[i] = nil
+		}
+	}
+	return infos, errs
+}
+
+// List returns the objects that are direct descendants of the given path,
+// packed or not. The pack directory is left out.
+func (d *packStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	children, err := d.StorageDriver.List(ctx, path)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]struct{}, len(children))
+	filtered := children[:0]
+	for _, child := range children {
+		if child == d.packDirectory {
+			continue
+		}
+		seen[child] = struct{}{}
+		filtered = append(filtered, child)
+	}
+	children = filtered
+
+	d.mu.RLock()
+	packed := d.children[path]
+	var added []string
+	for child := range packed {
+		if _, ok := seen[child]; !ok {
+			added = append(added, child)
+		}
+	}
+	d.mu.RUnlock()
+
+	if err != nil && len(packed) == 0 {
+		return nil, err
+	}
+	sort.Strings(added)
+	return append(children, added...), nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the
+// original object. A packed object is moved within the packs.
+func (d *packStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if _, ok := d.lookup(sourcePath); !ok {
+		if err := d.StorageDriver.Move(ctx, sourcePath, destPath); err != nil {
+			return err
+		}
+		if _, ok := d.lookup(destPath); ok {
+			return d.commit(ctx, record{path: destPath, tombstone: true})
+		}
+		return nil
+	}
+
+	if err := d.invalidPath(destPath); err != nil {
+		return err
+	}
+
+	content, err := d.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if err := d.deleteShadowed(ctx, sourcePath); err != nil {
+		return err
+	}
+	if err := d.deleteShadowed(ctx, destPath); err != nil {
+		return err
+	}
+	return d.commit(ctx, record{path: destPath, content: content}, record{path: sourcePath, tombstone: true})
+}
+
+// Copy copies the object stored at sourcePath to destPath. A packed object is
+// copied within the packs, other objects on the wrapped driver, on the storage
+// provider if it supports it.
+func (d *packStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if _, ok := d.lookup(sourcePath); !ok {
+		if err := storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath); err != nil {
+			return err
+		}
+		if _, ok := d.lookup(destPath); ok {
+			return d.commit(ctx, record{path: destPath, tombstone: true})
+		}
+		return nil
+	}
+
+	if err := d.invalidPath(destPath); err != nil {
+		return err
+	}
+
+	content, err := d.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if err := d.deleteShadowed(ctx, destPath); err != nil {
+		return err
+	}
+	return d.commit(ctx, record{path: destPath, content: content})
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths,
+// packed or not.
+func (d *packStorageMiddleware) Delete(ctx context.Context, path string) error {
+	var tombstones []record
+	for _, p := range d.packedUnder(path) {
+		tombstones = append(tombstones, record{path: p, tombstone: true})
+	}
+
+	if len(tombstones) > 0 {
+		if err := d.commit(ctx, tombstones...); err != nil {
+			return err
+		}
+	}
+
+	err := d.StorageDriver.Delete(ctx, path)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok && len(tombstones) > 0 {
+		return nil
+	}
+	return err
+}
+
+// URLFor returns a URL for the content at path. Packed objects have no URL
+// and must be served by the registry.
+func (d *packStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if _, ok := d.lookup(path); ok {
+		return "", storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+// init registers the pack storage middleware.
+func init() {
+	storagemiddleware.Register("pack", storagemiddleware.InitFunc(newPackStorageMiddleware))
+}
@@ -0,0 +1,313 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newPackStorageMiddleware(filesystem.New(root), map[string]interface{}{
+			"maxsize":  1024,
+			"packsize": 4096,
+		})
+	}, testsuites.NeverSkip)
+}
+
+func newTestMiddleware(t *testing.T, backend storagedriver.StorageDriver) storagedriver.StorageDriver {
+	d, err := newPackStorageMiddleware(backend, map[string]interface{}{
+		"maxsize": 16,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return d
+}
+
+func TestSmallObjectsArePacked(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	for _, p := range []string{"/repo/a/link", "/repo/b/link", "/repo/c/link"} {
+		if err := d.PutContent(ctx, p, []byte("sha256:abc")); err != nil {
+			t.Fatalf("unexpected error putting %s: %v", p, err)
+		}
+	}
+	if err := d.PutContent(ctx, "/repo/d/data", bytes.Repeat([]byte("x"), 32)); err != nil {
+		t.Fatalf("unexpected error putting large object: %v", err)
+	}
+
+	if _, err := backend.Stat(ctx, "/repo/a/link"); err == nil {
+		t.Fatalf("expected small object not to be stored on the backend")
+	}
+	if _, err := backend.Stat(ctx, "/repo/d/data"); err != nil {
+		t.Fatalf("expected large object on the backend: %v", err)
+	}
+
+	children, err := d.List(ctx, "/repo")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(children) != 4 {
+		t.Fatalf("unexpected children: %v", children)
+	}
+
+	root, err := d.List(ctx, "/")
+	if err != nil {
+		t.Fatalf("unexpected error listing root: %v", err)
+	}
+	if len(root) != 1 || root[0] != "/repo" {
+		t.Fatalf("expected pack directory to be hidden: %v", root)
+	}
+}
+
+func TestIndexReloaded(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	if err := d.PutContent(ctx, "/repo/a/link", []byte("first")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := d.PutContent(ctx, "/repo/b/link", []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := d.Move(ctx, "/repo/b/link", "/repo/c/link"); err != nil {
+		t.Fatalf("unexpected error moving: %v", err)
+	}
+	if err := d.Delete(ctx, "/repo/a"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+
+	// A second process sees the same objects.
+	reloaded := newTestMiddleware(t, backend)
+
+	if _, err := reloaded.GetContent(ctx, "/repo/a/link"); err == nil {
+		t.Fatalf("expected deleted object to stay deleted")
+	}
+	if _, err := reloaded.GetContent(ctx, "/repo/b/link"); err == nil {
+		t.Fatalf("expected moved object to be gone from its source")
+	}
+	content, err := reloaded.GetContent(ctx, "/repo/c/link")
+	if err != nil {
+		t.Fatalf("unexpected error reading moved object: %v", err)
+	}
+	if string(content) != "second" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	children, err := reloaded.List(ctx, "/repo")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(children) != 1 || children[0] != "/repo/c" {
+		t.Fatalf("unexpected children: %v", children)
+	}
+}
+
+func TestWriteStreamUnpacks(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d := newTestMiddleware(t, backend)
+
+	if err := d.PutContent(ctx, "/repo/data", []byte("abc")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := d.WriteStream(ctx, "/repo/data", 3, bytes.NewReader([]byte("def"))); err != nil {
+		t.Fatalf("unexpected error appending: %v", err)
+	}
+
+	content, err := backend.GetContent(ctx, "/repo/data")
+	if err != nil {
+		t.Fatalf("expected object to be moved to the backend: %v", err)
+	}
+	if string(content) != "abcdef" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
+
+// copyingDriver counts the copies made on the storage provider.
+type copyingDriver struct {
+	storagedriver.StorageDriver
+	copies int
+}
+
+func (d *copyingDriver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	d.copies++
+	content, err := d.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, destPath, content)
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	backend := &copyingDriver{StorageDriver: inmemory.New()}
+	d := newTestMiddleware(t, backend)
+
+	if err := d.PutContent(ctx, "/repo/a/link", []byte("packed")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := d.PutContent(ctx, "/repo/a/data", bytes.Repeat([]byte("x"), 32)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Objects on the backend are copied by the backend.
+	if err := storagedriver.Copy(ctx, d, "/repo/a/data", "/repo/b/data"); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	if backend.copies != 1 {
+		t.Fatalf("expected the backend to copy the object, got %d copies", backend.copies)
+	}
+
+	// Packed objects are copied within the packs.
+	if err := storagedriver.Copy(ctx, d, "/repo/a/link", "/repo/b/link"); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	for _, p := range []string{"/repo/a/link", "/repo/b/link"} {
+		content, err := d.GetContent(ctx, p)
+		if err != nil || string(content) != "packed" {
+			t.Fatalf("unexpected content of %s: %q, %v", p, content, err)
+		}
+	}
+	if _, err := backend.Stat(ctx, "/repo/b/link"); err == nil {
+		t.Fatalf("expected the copy of a packed object not to be stored on the backend")
+	}
+}
+
+// TestWritesOrderedByGeneration checks that a write supersedes the records
+// its process knew of, even those written by a process whose clock is ahead.
+func TestWritesOrderedByGeneration(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	ahead := newTestMiddleware(t, backend)
+
+	if err := ahead.PutContent(ctx, "/repo/link", []byte("first")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The clock of the first process is an hour ahead.
+	packs, err := backend.List(ctx, defaultPackDirectory)
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("expected a single pack: %v, %v", packs, err)
+	}
+	index, err := backend.GetContent(ctx, packs[0]+"/index")
+	if err != nil {
+		t.Fatalf("unexpected error reading index: %v", err)
+	}
+	fields := strings.SplitN(string(index), " ", 2)
+	skewed := time.Now().Add(time.Hour).UnixNano()
+	if err := backend.PutContent(ctx, packs[0]+"/index", []byte(fmt.Sprintf("%d %s", skewed, fields[1]))); err != nil {
+		t.Fatalf("unexpected error writing index: %v", err)
+	}
+
+	behind := newTestMiddleware(t, backend)
+	if err := behind.PutContent(ctx, "/repo/link", []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := newTestMiddleware(t, backend).GetContent(ctx, "/repo/link")
+	if err != nil || string(content) != "second" {
+		t.Fatalf("expected the latest write to win: %q, %v", content, err)
+	}
+}
+
+// TestConcurrentWritesAgree checks that processes agree on the winner of
+// writes made concurrently by processes unaware of each other.
+func TestConcurrentWritesAgree(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	first := newTestMiddleware(t, backend)
+	second := newTestMiddleware(t, backend)
+
+	if err := first.PutContent(ctx, "/repo/link", []byte("first")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := second.PutContent(ctx, "/repo/link", []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, d := range []storagedriver.StorageDriver{first, second} {
+		if err := d.(*packStorageMiddleware).load(ctx); err != nil {
+			t.Fatalf("unexpected error reloading: %v", err)
+		}
+	}
+
+	var contents []string
+	for _, d := range []storagedriver.StorageDriver{first, second, newTestMiddleware(t, backend)} {
+		content, err := d.GetContent(ctx, "/repo/link")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		contents = append(contents, string(content))
+	}
+	if contents[0] != contents[1] || contents[1] != contents[2] {
+		t.Fatalf("processes disagree on the content: %v", contents)
+	}
+}
+
+// scopeRecordingDriver records the storage scope of the streams written.
+type scopeRecordingDriver struct {
+	storagedriver.StorageDriver
+	mu     sync.Mutex
+	scopes map[string]string
+}
+
+func (d *scopeRecordingDriver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	d.mu.Lock()
+	d.scopes[path] = storagemiddleware.GetScope(ctx)[storagemiddleware.ScopeTenant]
+	d.mu.Unlock()
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// TestCommitScope checks that records are appended under the storage scope
+// of their write, to packs of that scope.
+func TestCommitScope(t *testing.T) {
+	backend := &scopeRecordingDriver{StorageDriver: inmemory.New(), scopes: make(map[string]string)}
+	d := newTestMiddleware(t, backend)
+
+	for _, tenant := range []string{"a", "b", "a"} {
+		ctx := storagemiddleware.WithScope(context.Background(), storagemiddleware.Scope{storagemiddleware.ScopeTenant: tenant})
+		if err := d.PutContent(ctx, "/"+tenant+"/link", []byte(tenant)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	packs := make(map[string]string)
+	for p, tenant := range backend.scopes {
+		pack := path.Dir(p)
+		if other, ok := packs[pack]; ok && other != tenant {
+			t.Fatalf("pack %s written under scopes %q and %q", pack, other, tenant)
+		}
+		packs[pack] = tenant
+	}
+	if len(packs) != 2 {
+		t.Fatalf("expected a pack per scope: %v", backend.scopes)
+	}
+}
@@ -0,0 +1,255 @@
+// Package pathfirewall provides a storage middleware which rejects suspicious
+// paths, such as those with relative or over-long components, or with the
+// compatibility forms of characters some storage providers fold into their
+// ASCII counterparts, before the wrapped storage driver turns them into keys
+// or file names.
+package pathfirewall
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+const (
+	defaultMaxPathLength    = 1024
+	defaultMaxSegmentLength = 255
+)
+
+// pathFirewallStorageMiddleware rejects the operations of the wrapped driver
+// on suspicious paths with a storagedriver.InvalidPathError.
+type pathFirewallStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	maxPathLength    int
+	maxSegmentLength int
+}
+
+var _ storagedriver.StorageDriver = &pathFirewallStorageMiddleware{}
+
+// newPathFirewallStorageMiddleware constructs a storage middleware rejecting
+// suspicious paths.
+// Optional options: maxpathlength, maxsegmentlength
+func newPathFirewallStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	maxPathLength, err := lengthOption(options, "maxpathlength", defaultMaxPathLength)
+	if err != nil {
+		return nil, err
+	}
+	maxSegmentLength, err := lengthOption(options, "maxsegmentlength", defaultMaxSegmentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pathFirewallStorageMiddleware{
+		StorageDriver:    storageDriver,
+		maxPathLength:    maxPathLength,
+		maxSegmentLength: maxSegmentLength,
+	}, nil
+}
+
+func lengthOption(options map[string]interface{}, name string, defaultValue int) (int, error) {
+	v, ok := options[name]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer: %v", name, v)
+	}
+	return n, nil
+}
+
+// isCompatibilityForm returns true if r is a compatibility form of ASCII
+// characters, such as a fullwidth solidus or a two dot leader, which a
+// storage provider applying Unicode compatibility normalization would turn
+// into a separator or a relative path component.
+func isCompatibilityForm(r rune) bool {
+	switch r {
+	case '․', '‥', '…', '﹒', '﹣':
+		return true
+	}
+	// Fullwidth forms of the printable ASCII characters.
+	return r >= '！' && r <= '～'
+}
+
+// suspicious returns why path is rejected, or an empty string if it is not.
+func (d *pathFirewallStorageMiddleware) suspicious(path string) string {
+	if len(path) > d.maxPathLength {
+		return "path too long"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "relative path"
+	}
+	if path == "/" {
+		return ""
+	}
+
+	for _, segment := range strings.Split(path[1:], "/") {
+		switch segment {
+		case "":
+			return "empty path component"
+		case ".", "..":
+			return "relative path component"
+		}
+		if len(segment) > d.maxSegmentLength {
+			return "path component too long"
+		}
+
+		for i := 0; i < len(segment); i++ {
+			switch c := segment[i]; {
+			case c < 0x20 || c == 0x7f:
+				return "control character"
+			case c == '\\':
+				return "backslash"
+			case c == '%':
+				return "percent-encoded character"
+			case c >= utf8.RuneSelf:
+				if r, _ := utf8.DecodeRuneInString(segment[i:]); isCompatibilityForm(r) {
+					return "compatibility form of an ASCII character"
+				}
+				return "non-ASCII character"
+			}
+		}
+	}
+	return ""
+}
+
+// check returns an error if path is suspicious.
+func (d *pathFirewallStorageMiddleware) check(ctx context.Context, path string) error {
+	if reason := d.suspicious(path); reason != "" {
+		context.GetLogger(ctx).Warnf("pathfirewall: rejected path %q: %s", path, reason)
+		return storagedriver.InvalidPathError{Path: path, DriverName: d.Name()}
+	}
+	return nil
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *pathFirewallStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := d.check(ctx, path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *pathFirewallStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := d.check(ctx, path); err != nil {
+		return err
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *pathFirewallStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if err := d.check(ctx, path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+// WriteStream stores the contents of the provided io.Reader at a location
+// designated by the given path.
+func (d *pathFirewallStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if err := d.check(ctx, path); err != nil {
+		return 0, err
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// Stat retrieves the FileInfo for the given path.
+func (d *pathFirewallStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if err := d.check(ctx, path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, batching the
+// calls to the wrapped driver if it supports it.
+func (d *pathFirewallStorageMiddleware) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	infos := make([]storagedriver.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+
+	// Only the paths which are not rejected are passed on, remembering their
+	// index in paths.
+	var checked []string
+	var indexes []int
+	for i, path := range paths {
+		if err := d.check(ctx, path); err != nil {
+			errs[i] = err
+			continue
+		}
+		checked = append(checked, path)
+		indexes = append(indexes, i)
+	}
+
+	if len(checked) > 0 {
+		checkedInfos, checkedErrs := storagedriver.StatMany(ctx, d.StorageDriver, checked)
+		for j, i := range indexes {
+			infos[i], errs[i] = checkedInfos[j], checkedErrs[j]
+		}
+	}
+	return infos, errs
+}
+
+// List returns a list of the objects that are direct descendants of the given
+// path.
+func (d *pathFirewallStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	if err := d.check(ctx, path); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.List(ctx, path)
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object.
+func (d *pathFirewallStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.check(ctx, sourcePath); err != nil {
+		return err
+	}
+	if err := d.check(ctx, destPath); err != nil {
+		return err
+	}
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the wrapped driver supports it.
+func (d *pathFirewallStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.check(ctx, sourcePath); err != nil {
+		return err
+	}
+	if err := d.check(ctx, destPath); err != nil {
+		return err
+	}
+	return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *pathFirewallStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := d.check(ctx, path); err != nil {
+		return err
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the
+// given path.
+func (d *pathFirewallStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if err := d.check(ctx, path); err != nil {
+		return "", err
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+func init() {
+	storagemiddleware.Register("pathfirewall", storagemiddleware.InitFunc(newPathFirewallStorageMiddleware))
+}
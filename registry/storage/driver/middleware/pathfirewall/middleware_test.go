@@ -0,0 +1,116 @@
+package pathfirewall
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newPathFirewallStorageMiddleware(filesystem.New(root), nil)
+	}, testsuites.NeverSkip)
+}
+
+func TestSuspiciousPaths(t *testing.T) {
+	ctx := context.Background()
+	d, err := newPathFirewallStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"maxpathlength":    64,
+		"maxsegmentlength": "16",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	for _, path := range []string{
+		"docker/registry",
+		"/docker/../registry",
+		"/docker/./registry",
+		"/docker//registry",
+		"/docker/registry/",
+		"/docker/％２Ｅ％２Ｅ/registry",
+		"/docker/%2e%2e/registry",
+		"/docker%2Fregistry",
+		"/docker\\registry",
+		"/docker/\x00/registry",
+		"/docker/．．/registry",
+		"/docker/‥/registry",
+		"/docker/régistry",
+		"/docker/" + strings.Repeat("a", 17),
+		"/" + strings.Repeat("docker/", 10),
+	} {
+		if err := d.PutContent(ctx, path, []byte("content")); err == nil {
+			t.Errorf("expected an error putting %q", path)
+		} else if _, ok := err.(storagedriver.InvalidPathError); !ok {
+			t.Errorf("unexpected error putting %q: %v", path, err)
+		}
+	}
+
+	if err := d.Move(ctx, "/docker/registry", "/docker/../registry"); err == nil {
+		t.Errorf("expected an error moving to a relative path")
+	}
+
+	_, errs := d.(storagedriver.BatchStatter).StatMany(ctx, []string{"/docker/../registry", "/docker/registry"})
+	if _, ok := errs[0].(storagedriver.InvalidPathError); !ok {
+		t.Errorf("unexpected error stating a relative path: %v", errs[0])
+	}
+	if _, ok := errs[1].(storagedriver.PathNotFoundError); !ok {
+		t.Errorf("unexpected error stating a missing path: %v", errs[1])
+	}
+}
+
+// TestCompatibilityForms checks that paths with the compatibility forms of
+// ASCII characters are rejected rather than stored as such, which a storage
+// provider could fold into separators.
+func TestCompatibilityForms(t *testing.T) {
+	ctx := context.Background()
+	backend := inmemory.New()
+	d, err := newPathFirewallStorageMiddleware(backend, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	for _, path := range []string{
+		"/docker/registry／data",
+		"/docker/ｒｅｇｉｓｔｒｙ",
+		"/docker/registry﹒data",
+	} {
+		if err := d.PutContent(ctx, path, []byte("content")); err == nil {
+			t.Errorf("expected an error putting %q", path)
+		} else if _, ok := err.(storagedriver.InvalidPathError); !ok {
+			t.Errorf("unexpected error putting %q: %v", path, err)
+		}
+	}
+
+	if entries, _ := backend.List(ctx, "/"); len(entries) != 0 {
+		t.Fatalf("expected nothing stored, got %v", entries)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"maxpathlength": 0},
+		{"maxsegmentlength": "long"},
+	} {
+		if _, err := newPathFirewallStorageMiddleware(inmemory.New(), options); err == nil {
+			t.Fatalf("expected an error with options %v", options)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package storagemiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/docker/distribution/context"
+)
+
+// Scope holds values of the registry request a storage driver call is made
+// for, such as its tenant. Storage middleware reads it from the context of
+// the call with GetScope, to select encryption keys or storage roots per
+// request. Calls made outside of a request, such as by garbage collection or
+// maintenance jobs, have an empty scope.
+type Scope map[string]string
+
+// Keys of the scope values set by the registry.
+const (
+	// ScopeRepository is the name of the repository the request is for, if
+	// any.
+	ScopeRepository = "repository"
+
+	// ScopeUser is the name of the authenticated user, if any.
+	ScopeUser = "user"
+
+	// ScopeTenant is the tenant of the request, if configured.
+	ScopeTenant = "tenant"
+)
+
+type scopeKey struct{}
+
+// WithScope returns a context carrying the values of scope, in addition to
+// those of the scope ctx carries, which they replace.
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	merged := make(Scope)
+	for key, value := range GetScope(ctx) {
+		merged[key] = value
+	}
+	for key, value := range scope {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, scopeKey{}, merged)
+}
+
+// GetScope returns the scope ctx carries, or an empty scope if none. The
+// returned scope must not be modified.
+func GetScope(ctx context.Context) Scope {
+	if scope, ok := ctx.Value(scopeKey{}).(Scope); ok {
+		return scope
+	}
+	return Scope{}
+}
+
+// ScopeFunc sets values of the scope of a request, such as a tenant derived
+// from credentials the registry does not know of. An error fails the request:
+// an errcode.Error is returned to the client as is, any other error as an
+// unknown error.
+type ScopeFunc func(ctx context.Context, r *http.Request, scope Scope) error
+
+var scopeFuncs map[string]ScopeFunc
+
+// RegisterScopeFunc registers a ScopeFunc called, in the order of their
+// names, on every request once it is authorized and before its storage is
+// accessed, after the values set by the registry.
+func RegisterScopeFunc(name string, scopeFunc ScopeFunc) error {
+	if scopeFuncs == nil {
+		scopeFuncs = make(map[string]ScopeFunc)
+	}
+	if _, exists := scopeFuncs[name]; exists {
+		return fmt.Errorf("scope func already registered: %s", name)
+	}
+
+	scopeFuncs[name] = scopeFunc
+
+	return nil
+}
+
+// ApplyScopeFuncs calls the registered ScopeFuncs with the scope of a
+// request.
+func ApplyScopeFuncs(ctx context.Context, r *http.Request, scope Scope) error {
+	names := make([]string, 0, len(scopeFuncs))
+	for name := range scopeFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := scopeFuncs[name](ctx, r, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
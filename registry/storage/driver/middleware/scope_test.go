@@ -0,0 +1,23 @@
+package storagemiddleware
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/context"
+)
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	if scope := GetScope(ctx); len(scope) != 0 {
+		t.Fatalf("unexpected scope without request: %v", scope)
+	}
+
+	ctx = WithScope(ctx, Scope{ScopeRepository: "acme/app", ScopeTenant: "acme"})
+	ctx = WithScope(ctx, Scope{ScopeTenant: "other", ScopeUser: "alice"})
+
+	expected := Scope{ScopeRepository: "acme/app", ScopeTenant: "other", ScopeUser: "alice"}
+	if scope := GetScope(ctx); !reflect.DeepEqual(scope, expected) {
+		t.Fatalf("unexpected merged scope: %v", scope)
+	}
+}
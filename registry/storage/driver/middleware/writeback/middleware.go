@@ -0,0 +1,532 @@
+// Package writeback provides a storage middleware which keeps blob uploads on
+// fast local scratch storage and flushes completed blobs to the wrapped
+// storage driver in the background.
+package writeback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+const (
+	defaultFlushers      = 4
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+
+	// scopeDirectory is the directory on scratch keeping the storage scope
+	// of the pending blobs, by path.
+	scopeDirectory = "/_scopes"
+)
+
+// writeBackStorageMiddleware stores every path belonging to an upload on a
+// local filesystem driver. When a completed upload is moved to its blob path,
+// the blob is moved on the scratch driver instead, so the move returns as
+// soon as the upload has been verified, and is queued to be copied to the
+// wrapped driver. Until the copy has completed the blob is pending, and reads
+// of it are served from scratch. The blob is copied under the storage scope of
+// the move, which is kept on scratch along with the blob.
+type writeBackStorageMiddleware struct {
+	storagedriver.StorageDriver
+	scratch storagedriver.StorageDriver
+
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingBlob
+	queue   chan string
+}
+
+// pendingBlob is a blob which is stored on scratch and has not yet been
+// flushed to the wrapped driver. Its lock is held while it is copied, so that
+// a concurrent delete cannot be undone by a copy finishing after it.
+type pendingBlob struct {
+	sync.Mutex
+	deleted bool
+	scope   storagemiddleware.Scope
+}
+
+var _ storagedriver.StorageDriver = &writeBackStorageMiddleware{}
+
+// newWriteBackStorageMiddleware constructs a storage middleware keeping
+// uploads under the given scratch directory.
+// Required options: rootdirectory
+// Optional options: flushers, retrydelay, maxretrydelay
+func newWriteBackStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	root, ok := options["rootdirectory"]
+	if !ok {
+		return nil, fmt.Errorf("No rootdirectory provided")
+	}
+	rootDirectory, ok := root.(string)
+	if !ok || rootDirectory == "" {
+		return nil, fmt.Errorf("rootdirectory must be a non-empty string")
+	}
+
+	flushers := defaultFlushers
+	if f, ok := options["flushers"]; ok {
+		n, err := strconv.Atoi(fmt.Sprint(f))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("flushers must be a positive integer: %v", f)
+		}
+		flushers = n
+	}
+
+	retryDelay, err := durationOption(options, "retrydelay", defaultRetryDelay)
+	if err != nil {
+		return nil, err
+	}
+	maxRetryDelay, err := durationOption(options, "maxretrydelay", defaultMaxRetryDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &writeBackStorageMiddleware{
+		StorageDriver: storageDriver,
+		scratch:       filesystem.New(rootDirectory),
+		retryDelay:    retryDelay,
+		maxRetryDelay: maxRetryDelay,
+		pending:       make(map[string]*pendingBlob),
+		queue:         make(chan string, 1024),
+	}
+
+	// Blobs left on scratch by a previous run were never flushed.
+	pending, err := findPending(rootDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan rootdirectory: %v", err)
+	}
+	for _, path := range pending {
+		scope, err := d.readScope(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read storage scope of %s: %v", path, err)
+		}
+		d.pending[path] = &pendingBlob{scope: scope}
+	}
+
+	for i := 0; i < flushers; i++ {
+		go d.flusher()
+	}
+	go func() {
+		for _, path := range pending {
+			d.queue <- path
+		}
+	}()
+
+	return d, nil
+}
+
+func durationOption(options map[string]interface{}, name string, def time.Duration) (time.Duration, error) {
+	v, ok := options[name]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s: %s", name, err)
+		}
+		return dur, nil
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	}
+
+	return 0, fmt.Errorf("%s must be a duration: %v", name, v)
+}
+
+// findPending returns the paths of the files stored under the scratch
+// directory which do not belong to an upload, leaving out the storage scopes
+// kept for them.
+func findPending(root string) ([]string, error) {
+	var pending []string
+	err := filepath.Walk(root, func(fp string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		path := "/" + filepath.ToSlash(strings.TrimPrefix(fp, root+string(filepath.Separator)))
+		if !isUploadPath(path) && !strings.HasPrefix(path, scopeDirectory+"/") {
+			pending = append(pending, path)
+		}
+		return nil
+	})
+	return pending, err
+}
+
+// scopePath returns the path on scratch of the storage scope of the pending
+// blob at path.
+func scopePath(path string) string {
+	return scopeDirectory + path
+}
+
+// readScope returns the storage scope kept for the pending blob at path.
+func (d *writeBackStorageMiddleware) readScope(path string) (storagemiddleware.Scope, error) {
+	p, err := d.scratch.GetContent(context.Background(), scopePath(path))
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return storagemiddleware.Scope{}, nil
+		}
+		return nil, err
+	}
+
+	var scope storagemiddleware.Scope
+	if err := json.Unmarshal(p, &scope); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// queueFlush marks the blob at path as pending and queues it to be flushed
+// under the storage scope of ctx. It must be called with d.mu held.
+func (d *writeBackStorageMiddleware) queueFlush(ctx context.Context, path string) error {
+	if _, ok := d.pending[path]; ok {
+		return nil
+	}
+
+	scope := storagemiddleware.GetScope(ctx)
+	if len(scope) > 0 {
+		p, err := json.Marshal(scope)
+		if err != nil {
+			return err
+		}
+		if err := d.scratch.PutContent(ctx, scopePath(path), p); err != nil {
+			return err
+		}
+	}
+
+	d.pending[path] = &pendingBlob{scope: scope}
+	go func() { d.queue <- path }()
+	return nil
+}
+
+// isUploadPath returns true if path belongs to an in progress upload.
+func isUploadPath(path string) bool {
+	return strings.HasSuffix(path, "/_uploads") || strings.Contains(path, "/_uploads/")
+}
+
+// onScratch returns true if the content at path is currently served from
+// scratch.
+func (d *writeBackStorageMiddleware) onScratch(path string) bool {
+	if isUploadPath(path) {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.pending[path]
+	return ok
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *writeBackStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if d.onScratch(path) {
+		return d.scratch.GetContent(ctx, path)
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *writeBackStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if isUploadPath(path) {
+		return d.scratch.PutContent(ctx, path, content)
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *writeBackStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if d.onScratch(path) {
+		return d.scratch.ReadStream(ctx, path, offset)
+	}
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+// WriteStream stores the contents of the provided io.Reader at a location
+// designated by the given path.
+func (d *writeBackStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if isUploadPath(path) {
+		return d.scratch.WriteStream(ctx, path, offset, reader)
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// Stat retrieves the FileInfo for the given path. Directories which only
+// exist on scratch, such as those of pending blobs, are found there.
+func (d *writeBackStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if d.onScratch(path) {
+		return d.scratch.Stat(ctx, path)
+	}
+
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		if sfi, serr := d.scratch.Stat(ctx, path); serr == nil {
+			return sfi, nil
+		}
+	}
+	return fi, err
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, batching the
+// paths stored on the wrapped driver if it supports it.
+func (d *writeBackStorageMiddleware) StatMany(ctx context.Context, paths []string) ([]storagedriver.FileInfo, []error) {
+	infos := make([]storagedriver.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+
+	var backend []string
+	var indexes []int
+	for i, path := range paths {
+		if d.onScratch(path) {
+			infos[i], errs[i] = d.scratch.Stat(ctx, path)
+			continue
+		}
+		backend = append(backend, path)
+		indexes = append(indexes, i)
+	}
+
+	binfos, berrs := storagedriver.StatMany(ctx, d.StorageDriver, backend)
+	for j, i := range indexes {
+		infos[i], errs[i] = binfos[j], berrs[j]
+	}
+	return infos, errs
+}
+
+// List returns the objects that are direct descendants of the given path on
+// either the wrapped driver or scratch.
+func (d *writeBackStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	if isUploadPath(path) {
+		return d.scratch.List(ctx, path)
+	}
+
+	children, err := d.StorageDriver.List(ctx, path)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	scratchChildren, serr := d.scratch.List(ctx, path)
+	if serr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return children, nil
+	}
+
+	seen := make(map[string]struct{}, len(children))
+	for _, child := range children {
+		seen[child] = struct{}{}
+	}
+	for _, child := range scratchChildren {
+		if child == scopeDirectory {
+			continue
+		}
+		if _, ok := seen[child]; !ok {
+			children = append(children, child)
+		}
+	}
+	return children, nil
+}
+
+// Move moves an object stored at sourcePath to destPath. A completed upload
+// is moved on scratch and queued to be flushed to the wrapped driver.
+func (d *writeBackStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if !isUploadPath(sourcePath) {
+		return d.StorageDriver.Move(ctx, sourcePath, destPath)
+	}
+	if isUploadPath(destPath) {
+		return d.scratch.Move(ctx, sourcePath, destPath)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.scratch.Move(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+	return d.queueFlush(ctx, destPath)
+}
+
+// Copy copies the object stored at sourcePath to destPath. A pending blob is
+// copied on scratch and the copy queued to be flushed to the wrapped driver,
+// other objects are copied on the wrapped driver, on the storage provider if
+// it supports it.
+func (d *writeBackStorageMiddleware) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if isUploadPath(destPath) {
+		if !isUploadPath(sourcePath) {
+			return fmt.Errorf("writeback: cannot copy %s to upload path %s", sourcePath, destPath)
+		}
+		return storagedriver.Copy(ctx, d.scratch, sourcePath, destPath)
+	}
+
+	// The lock is held while copying, so that a pending source is not
+	// removed from scratch by its flush meanwhile.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pending[sourcePath]; !ok && !isUploadPath(sourcePath) {
+		return storagedriver.Copy(ctx, d.StorageDriver, sourcePath, destPath)
+	}
+
+	if err := storagedriver.Copy(ctx, d.scratch, sourcePath, destPath); err != nil {
+		return err
+	}
+	return d.queueFlush(ctx, destPath)
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths,
+// on scratch and on the wrapped driver. Pending blobs under path are not
+// flushed.
+func (d *writeBackStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if isUploadPath(path) {
+		return d.scratch.Delete(ctx, path)
+	}
+
+	d.mu.Lock()
+	var deleted []*pendingBlob
+	for p, blob := range d.pending {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(d.pending, p)
+			deleted = append(deleted, blob)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, blob := range deleted {
+		// Wait for an in progress flush, so it is deleted below.
+		blob.Lock()
+		blob.deleted = true
+		blob.Unlock()
+	}
+
+	serr := d.scratch.Delete(ctx, path)
+	if _, ok := serr.(storagedriver.PathNotFoundError); serr != nil && !ok {
+		return serr
+	}
+	if len(deleted) > 0 {
+		if err := d.scratch.Delete(ctx, scopePath(path)); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+
+	err := d.StorageDriver.Delete(ctx, path)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok && serr == nil {
+		return nil
+	}
+	return err
+}
+
+// URLFor returns a URL for the content at path. Pending blobs have no URL
+// and must be served by the registry.
+func (d *writeBackStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if d.onScratch(path) {
+		return "", storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+// flusher copies queued blobs to the wrapped driver until the process exits.
+func (d *writeBackStorageMiddleware) flusher() {
+	for path := range d.queue {
+		d.flush(path)
+	}
+}
+
+// flush copies the pending blob at path to the wrapped driver under the
+// storage scope it was queued with, retrying with an increasing delay until it
+// succeeds or the blob is deleted. The copy on scratch is removed once the
+// wrapped driver serves the blob.
+func (d *writeBackStorageMiddleware) flush(path string) {
+	d.mu.Lock()
+	blob, ok := d.pending[path]
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx := storagemiddleware.WithScope(context.Background(), blob.scope)
+	ctx = context.WithLogger(ctx, context.GetLoggerWithField(ctx, "writeback.path", path))
+
+	delay := d.retryDelay
+	for {
+		blob.Lock()
+		if blob.deleted {
+			blob.Unlock()
+			return
+		}
+		err := d.copy(ctx, path)
+		blob.Unlock()
+		if err == nil {
+			break
+		}
+
+		context.GetLogger(ctx).Errorf("error flushing blob, retrying in %v: %v", delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > d.maxRetryDelay {
+			delay = d.maxRetryDelay
+		}
+	}
+
+	d.mu.Lock()
+	if d.pending[path] == blob {
+		delete(d.pending, path)
+	}
+	d.mu.Unlock()
+
+	if err := d.scratch.Delete(ctx, path); err != nil {
+		context.GetLogger(ctx).Errorf("error removing flushed blob from scratch: %v", err)
+		return
+	}
+	if len(blob.scope) > 0 {
+		if err := d.scratch.Delete(ctx, scopePath(path)); err != nil {
+			context.GetLogger(ctx).Errorf("error removing storage scope of flushed blob from scratch: %v", err)
+		}
+	}
+	context.GetLogger(ctx).Debugf("flushed blob")
+}
+
+// copy writes the content of path on scratch to the wrapped driver.
+func (d *writeBackStorageMiddleware) copy(ctx context.Context, path string) error {
+	rc, err := d.scratch.ReadStream(ctx, path, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// A failed earlier attempt may have left a partial object behind.
+	if err := d.StorageDriver.Delete(ctx, path); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	_, err = d.StorageDriver.WriteStream(ctx, path, 0, rc)
+	return err
+}
+
+// init registers the writeback storage middleware.
+func init() {
+	storagemiddleware.Register("writeback", storagemiddleware.InitFunc(newWriteBackStorageMiddleware))
+}
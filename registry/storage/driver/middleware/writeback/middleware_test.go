@@ -0,0 +1,303 @@
+package writeback
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newWriteBackStorageMiddleware(filesystem.New(filepath.Join(root, "backend")), map[string]interface{}{
+			"rootdirectory": filepath.Join(root, "scratch"),
+		})
+	}, testsuites.NeverSkip)
+}
+
+const (
+	uploadPath = "/docker/registry/v2/repositories/foo/_uploads/id/data"
+	blobPath   = "/docker/registry/v2/blobs/sha256/ab/abcd/data"
+)
+
+// gatedDriver blocks writes to the blob path until released and fails the
+// first of them.
+type gatedDriver struct {
+	storagedriver.StorageDriver
+	release chan struct{}
+
+	mu     sync.Mutex
+	writes int
+}
+
+func (d *gatedDriver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if path == blobPath {
+		<-d.release
+
+		d.mu.Lock()
+		d.writes++
+		first := d.writes == 1
+		d.mu.Unlock()
+		if first {
+			return 0, storagedriver.Error{DriverName: "gated", Enclosed: io.ErrUnexpectedEOF}
+		}
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+func newTestMiddleware(t *testing.T, backend storagedriver.StorageDriver, scratch string) storagedriver.StorageDriver {
+	d, err := newWriteBackStorageMiddleware(backend, map[string]interface{}{
+		"rootdirectory": scratch,
+		"retrydelay":    "1ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return d
+}
+
+func waitFlushed(t *testing.T, backend storagedriver.StorageDriver, scratch string, content []byte) {
+	ctx := context.Background()
+	for i := 0; i < 500; i++ {
+		stored, err := backend.GetContent(ctx, blobPath)
+		if _, serr := os.Stat(filepath.Join(scratch, blobPath)); err == nil && os.IsNotExist(serr) {
+			if !bytes.Equal(stored, content) {
+				t.Fatalf("unexpected flushed content: %q != %q", stored, content)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("blob was not flushed")
+}
+
+func TestWriteBack(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "writeback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	scratch := filepath.Join(root, "scratch")
+	backend := &gatedDriver{
+		StorageDriver: filesystem.New(filepath.Join(root, "backend")),
+		release:       make(chan struct{}),
+	}
+	d := newTestMiddleware(t, backend, scratch)
+
+	content := []byte("blob content")
+	if _, err := d.WriteStream(ctx, uploadPath, 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if _, err := backend.Stat(ctx, uploadPath); err == nil {
+		t.Fatalf("upload was written to the backend")
+	}
+
+	if err := d.Move(ctx, uploadPath, blobPath); err != nil {
+		t.Fatalf("unexpected error moving upload: %v", err)
+	}
+
+	// The blob must be served from scratch until it is flushed.
+	stored, err := d.GetContent(ctx, blobPath)
+	if err != nil {
+		t.Fatalf("unexpected error reading pending blob: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatalf("unexpected pending content: %q != %q", stored, content)
+	}
+	if fi, err := d.Stat(ctx, filepath.Dir(blobPath)); err != nil || !fi.IsDir() {
+		t.Fatalf("expected pending blob directory, got %v, %v", fi, err)
+	}
+	if _, err := d.URLFor(ctx, blobPath, nil); err == nil {
+		t.Fatalf("expected pending blob to have no URL")
+	}
+	if _, err := backend.Stat(ctx, blobPath); err == nil {
+		t.Fatalf("blob was flushed before the backend was released")
+	}
+
+	close(backend.release)
+	waitFlushed(t, backend, scratch, content)
+
+	stored, err = d.GetContent(ctx, blobPath)
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Fatalf("unexpected content after flush: %q, %v", stored, err)
+	}
+}
+
+func TestWriteBackDeletePending(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "writeback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	backend := &gatedDriver{
+		StorageDriver: filesystem.New(filepath.Join(root, "backend")),
+		release:       make(chan struct{}),
+	}
+	d := newTestMiddleware(t, backend, filepath.Join(root, "scratch"))
+
+	if err := d.PutContent(ctx, uploadPath, []byte("blob content")); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if err := d.Move(ctx, uploadPath, blobPath); err != nil {
+		t.Fatalf("unexpected error moving upload: %v", err)
+	}
+	if err := d.Delete(ctx, filepath.Dir(blobPath)); err != nil {
+		t.Fatalf("unexpected error deleting pending blob: %v", err)
+	}
+	close(backend.release)
+
+	if _, err := d.Stat(ctx, blobPath); err == nil {
+		t.Fatalf("expected deleted blob to be gone")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := backend.Stat(ctx, blobPath); err == nil {
+		t.Fatalf("deleted blob was flushed")
+	}
+}
+
+func TestWriteBackRecovery(t *testing.T) {
+	root, err := ioutil.TempDir("", "writeback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A blob left on scratch by an earlier run, and an unfinished upload
+	// which must stay there.
+	scratch := filepath.Join(root, "scratch")
+	content := []byte("blob content")
+	for _, path := range []string{blobPath, uploadPath} {
+		fp := filepath.Join(scratch, path)
+		if err := os.MkdirAll(filepath.Dir(fp), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := filesystem.New(filepath.Join(root, "backend"))
+	d := newTestMiddleware(t, backend, scratch)
+	waitFlushed(t, backend, scratch, content)
+
+	if _, err := d.Stat(context.Background(), uploadPath); err != nil {
+		t.Fatalf("unexpected error reading upload: %v", err)
+	}
+	if _, err := backend.Stat(context.Background(), uploadPath); err == nil {
+		t.Fatalf("upload was flushed")
+	}
+}
+
+// scopeRecordingDriver records the tenant of the storage scope the blob path
+// is written under.
+type scopeRecordingDriver struct {
+	storagedriver.StorageDriver
+
+	mu     sync.Mutex
+	tenant string
+}
+
+func (d *scopeRecordingDriver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if path == blobPath {
+		d.mu.Lock()
+		d.tenant = storagemiddleware.GetScope(ctx)[storagemiddleware.ScopeTenant]
+		d.mu.Unlock()
+	}
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+func TestWriteBackScope(t *testing.T) {
+	root, err := ioutil.TempDir("", "writeback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	scratch := filepath.Join(root, "scratch")
+	backend := &scopeRecordingDriver{StorageDriver: filesystem.New(filepath.Join(root, "backend"))}
+	d := newTestMiddleware(t, backend, scratch)
+
+	ctx := storagemiddleware.WithScope(context.Background(), storagemiddleware.Scope{storagemiddleware.ScopeTenant: "acme"})
+	content := []byte("blob content")
+	if err := d.PutContent(ctx, uploadPath, content); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if err := d.Move(ctx, uploadPath, blobPath); err != nil {
+		t.Fatalf("unexpected error moving upload: %v", err)
+	}
+	waitFlushed(t, backend, scratch, content)
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.tenant != "acme" {
+		t.Fatalf("blob flushed under tenant %q", backend.tenant)
+	}
+}
+
+func TestWriteBackRecoveryScope(t *testing.T) {
+	root, err := ioutil.TempDir("", "writeback-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A blob left on scratch by an earlier run, with its storage scope.
+	scratch := filepath.Join(root, "scratch")
+	content := []byte("blob content")
+	for path, p := range map[string][]byte{
+		blobPath:            content,
+		scopePath(blobPath): []byte(`{"tenant":"acme"}`),
+	} {
+		fp := filepath.Join(scratch, path)
+		if err := os.MkdirAll(filepath.Dir(fp), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, p, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := &scopeRecordingDriver{StorageDriver: filesystem.New(filepath.Join(root, "backend"))}
+	d := newTestMiddleware(t, backend, scratch)
+	waitFlushed(t, backend, scratch, content)
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.tenant != "acme" {
+		t.Fatalf("blob flushed under tenant %q", backend.tenant)
+	}
+
+	children, err := d.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	for _, child := range children {
+		if child == scopeDirectory {
+			t.Fatalf("expected storage scopes to be hidden: %v", children)
+		}
+	}
+}
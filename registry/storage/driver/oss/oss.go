@@ -28,6 +28,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/denverdino/aliyungo/oss"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/appendable"
 	"github.com/docker/distribution/registry/storage/driver/base"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 )
@@ -69,6 +70,26 @@ func (factory *ossDriverFactory) Create(parameters map[string]interface{}) (stor
 	return FromParameters(parameters)
 }
 
+func (*ossDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the parameters of the OSS driver. The host of
+// the bucket is derived from its region unless endpoint is set, internal
+// selecting the endpoint reachable from within the region.
+var describedParameters = []factory.Parameter{
+	{Name: "accesskeyid", Type: factory.TypeString, Required: true, Description: "access key id of the account"},
+	{Name: "accesskeysecret", Type: factory.TypeString, Required: true, Description: "access key secret of the account"},
+	{Name: "region", Type: factory.TypeString, Required: true, Description: "region of the bucket"},
+	{Name: "bucket", Type: factory.TypeString, Required: true, Description: "bucket storing the objects"},
+	{Name: "endpoint", Type: factory.TypeString, Description: "endpoint of the bucket, overriding the one of the region"},
+	{Name: "internal", Type: factory.TypeBool, Default: "false", Description: "whether to use the internal endpoint of the region"},
+	{Name: "encrypt", Type: factory.TypeBool, Default: "false", Description: "whether objects are encrypted on the server side"},
+	{Name: "secure", Type: factory.TypeBool, Default: "true", Description: "whether to use HTTPS"},
+	{Name: "chunksize", Type: factory.TypeInt, Default: strconv.Itoa(defaultChunkSize), Description: "size of the parts of multipart uploads, at least " + strconv.Itoa(minChunkSize)},
+	{Name: "rootdirectory", Type: factory.TypeString, Description: "prefix of the keys of the objects"},
+}
+
 type driver struct {
 	Client        *oss.Client
 	Bucket        *oss.Bucket
@@ -287,307 +308,88 @@ func (d *driver) ReadStream(ctx context.Context, path string, offset int64) (io.
 // offset. Offsets past the current size will write from the position
 // beyond the end of the file.
 func (d *driver) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (totalRead int64, err error) {
-	partNumber := 1
-	bytesRead := 0
-	var putErrChan chan error
-	parts := []oss.Part{}
-	var part oss.Part
-	done := make(chan struct{}) // stopgap to free up waiting goroutines
+	size := int64(-1)
+	resp, err := d.Bucket.Head(d.ossPath(path), nil)
+	if err != nil {
+		if ossErr, ok := err.(*oss.Error); !ok || ossErr.StatusCode != http.StatusNotFound {
+			return 0, err
+		}
+	} else {
+		size = resp.ContentLength
+	}
 
-	multi, err := d.Bucket.InitMulti(d.ossPath(path), d.getContentType(), getPermissions(), d.getOptions())
+	// OSS objects cannot be modified, so the content is staged, then the
+	// object is stitched again from the ranges of the stored object the
+	// write keeps and the staged content, in a multipart upload.
+	staged, err := appendable.Stage(ctx, "", reader)
 	if err != nil {
 		return 0, err
 	}
+	defer staged.Close()
 
-	buf := d.getbuf()
-
-	// We never want to leave a dangling multipart upload, our only consistent state is
-	// when there is a whole object at path. This is in order to remain consistent with
-	// the stat call.
-	//
-	// Note that if the machine dies before executing the defer, we will be left with a dangling
-	// multipart upload, which will eventually be cleaned up, but we will lose all of the progress
-	// made prior to the machine crashing.
-	defer func() {
-		if putErrChan != nil {
-			if putErr := <-putErrChan; putErr != nil {
-				err = putErr
-			}
-		}
-
-		if len(parts) > 0 {
-			if multi == nil {
-				// Parts should be empty if the multi is not initialized
-				panic("Unreachable")
-			} else {
-				if multi.Complete(parts) != nil {
-					multi.Abort()
-				}
-			}
-		}
-
-		d.putbuf(buf) // needs to be here to pick up new buf value
-		close(done)   // free up any waiting goroutines
-	}()
-
-	// Fills from 0 to total from current
-	fromSmallCurrent := func(total int64) error {
-		current, err := d.ReadStream(ctx, path, 0)
-		if err != nil {
-			return err
+	segments := appendable.Segments(appendable.Plan(size, offset, staged.Size), minChunkSize, d.ChunkSize)
+	if len(segments) == 0 {
+		if err := d.PutContent(ctx, path, nil); err != nil {
+			return 0, err
 		}
+		return 0, nil
+	}
 
-		bytesRead = 0
-		for int64(bytesRead) < total {
-			//The loop should very rarely enter a second iteration
-			nn, err := current.Read(buf[bytesRead:total])
-			bytesRead += nn
+	sources := appendable.Sources{
+		Stored: func(from, to int64) (io.ReadCloser, error) {
+			rc, err := d.ReadStream(ctx, path, from)
 			if err != nil {
-				if err != io.EOF {
-					return err
-				}
-
-				break
+				return nil, err
 			}
-
-		}
-		return nil
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(rc, to-from), rc}, nil
+		},
+		Staged: staged,
 	}
 
-	// Fills from parameter to chunkSize from reader
-	fromReader := func(from int64) error {
-		bytesRead = 0
-		for from+int64(bytesRead) < d.ChunkSize {
-			nn, err := reader.Read(buf[from+int64(bytesRead):])
-			totalRead += int64(nn)
-			bytesRead += nn
-
-			if err != nil {
-				if err != io.EOF {
-					return err
-				}
-
-				break
-			}
-		}
+	multi, err := d.Bucket.InitMulti(d.ossPath(path), d.getContentType(), getPermissions(), d.getOptions())
+	if err != nil {
+		return 0, err
+	}
 
-		if putErrChan == nil {
-			putErrChan = make(chan error)
+	// We never want to leave a dangling multipart upload, our only consistent state is
+	// when there is a whole object at path. This is in order to remain consistent with
+	// the stat call.
+	//
+	// Note that if the machine dies before aborting, we will be left with a dangling
+	// multipart upload, which will eventually be cleaned up.
+	buf := d.getbuf()
+	defer d.putbuf(buf)
+
+	parts := make([]oss.Part, 0, len(segments))
+	for i, segment := range segments {
+		var part oss.Part
+		if segment.Copy != nil {
+			_, part, err = multi.PutPartCopy(i+1,
+				oss.CopyOptions{CopySourceOptions: "bytes=" + strconv.FormatInt(segment.Copy.From, 10) + "-" + strconv.FormatInt(segment.Copy.To-1, 10)},
+				d.Bucket.Path(d.ossPath(path)))
 		} else {
-			if putErr := <-putErrChan; putErr != nil {
-				putErrChan = nil
-				return putErr
+			p := buf[:segment.Size()]
+			if err = sources.ReadSegment(segment, p); err == nil {
+				part, err = multi.PutPartWithTimeout(i+1, bytes.NewReader(p), defaultTimeout)
 			}
 		}
-
-		go func(bytesRead int, from int64, buf []byte) {
-			defer d.putbuf(buf) // this buffer gets dropped after this call
-
-			// DRAGONS(stevvooe): There are few things one might want to know
-			// about this section. First, the putErrChan is expecting an error
-			// and a nil or just a nil to come through the channel. This is
-			// covered by the silly defer below. The other aspect is the OSS
-			// retry backoff to deal with RequestTimeout errors. Even though
-			// the underlying OSS library should handle it, it doesn't seem to
-			// be part of the shouldRetry function (see denverdino/aliyungo/oss).
-			defer func() {
-				select {
-				case putErrChan <- nil: // for some reason, we do this no matter what.
-				case <-done:
-					return // ensure we don't leak the goroutine
-				}
-			}()
-
-			if bytesRead <= 0 {
-				return
-			}
-
-			var err error
-			var part oss.Part
-
-			part, err = multi.PutPartWithTimeout(int(partNumber), bytes.NewReader(buf[0:int64(bytesRead)+from]), defaultTimeout)
-
-			if err != nil {
-				logrus.Errorf("error putting part, aborting: %v", err)
-				select {
-				case putErrChan <- err:
-				case <-done:
-					return // don't leak the goroutine
-				}
-			}
-
-			// parts and partNumber are safe, because this function is the
-			// only one modifying them and we force it to be executed
-			// serially.
-			parts = append(parts, part)
-			partNumber++
-		}(bytesRead, from, buf)
-
-		buf = d.getbuf() // use a new buffer for the next call
-		return nil
-	}
-
-	if offset > 0 {
-		resp, err := d.Bucket.Head(d.ossPath(path), nil)
 		if err != nil {
-			if ossErr, ok := err.(*oss.Error); !ok || ossErr.StatusCode != http.StatusNotFound {
-				return 0, err
-			}
-		}
-
-		currentLength := int64(0)
-		if err == nil {
-			currentLength = resp.ContentLength
-		}
-
-		if currentLength >= offset {
-			if offset < d.ChunkSize {
-				// chunkSize > currentLength >= offset
-				if err = fromSmallCurrent(offset); err != nil {
-					return totalRead, err
-				}
-
-				if err = fromReader(offset); err != nil {
-					return totalRead, err
-				}
-
-				if totalRead+offset < d.ChunkSize {
-					return totalRead, nil
-				}
-			} else {
-				// currentLength >= offset >= chunkSize
-				_, part, err = multi.PutPartCopy(partNumber,
-					oss.CopyOptions{CopySourceOptions: "bytes=0-" + strconv.FormatInt(offset-1, 10)},
-					d.Bucket.Path(d.ossPath(path)))
-				if err != nil {
-					return 0, err
-				}
-
-				parts = append(parts, part)
-				partNumber++
-			}
-		} else {
-			// Fills between parameters with 0s but only when to - from <= chunkSize
-			fromZeroFillSmall := func(from, to int64) error {
-				bytesRead = 0
-				for from+int64(bytesRead) < to {
-					nn, err := bytes.NewReader(d.zeros).Read(buf[from+int64(bytesRead) : to])
-					bytesRead += nn
-					if err != nil {
-						return err
-					}
-				}
-
-				return nil
-			}
-
-			// Fills between parameters with 0s, making new parts
-			fromZeroFillLarge := func(from, to int64) error {
-				bytesRead64 := int64(0)
-				for to-(from+bytesRead64) >= d.ChunkSize {
-					part, err := multi.PutPartWithTimeout(int(partNumber), bytes.NewReader(d.zeros), defaultTimeout)
-					if err != nil {
-						return err
-					}
-					bytesRead64 += d.ChunkSize
-
-					parts = append(parts, part)
-					partNumber++
-				}
-
-				return fromZeroFillSmall(0, (to-from)%d.ChunkSize)
-			}
-
-			// currentLength < offset
-			if currentLength < d.ChunkSize {
-				if offset < d.ChunkSize {
-					// chunkSize > offset > currentLength
-					if err = fromSmallCurrent(currentLength); err != nil {
-						return totalRead, err
-					}
-
-					if err = fromZeroFillSmall(currentLength, offset); err != nil {
-						return totalRead, err
-					}
-
-					if err = fromReader(offset); err != nil {
-						return totalRead, err
-					}
-
-					if totalRead+offset < d.ChunkSize {
-						return totalRead, nil
-					}
-				} else {
-					// offset >= chunkSize > currentLength
-					if err = fromSmallCurrent(currentLength); err != nil {
-						return totalRead, err
-					}
-
-					if err = fromZeroFillSmall(currentLength, d.ChunkSize); err != nil {
-						return totalRead, err
-					}
-
-					part, err = multi.PutPartWithTimeout(int(partNumber), bytes.NewReader(buf), defaultTimeout)
-					if err != nil {
-						return totalRead, err
-					}
-
-					parts = append(parts, part)
-					partNumber++
-
-					//Zero fill from chunkSize up to offset, then some reader
-					if err = fromZeroFillLarge(d.ChunkSize, offset); err != nil {
-						return totalRead, err
-					}
-
-					if err = fromReader(offset % d.ChunkSize); err != nil {
-						return totalRead, err
-					}
-
-					if totalRead+(offset%d.ChunkSize) < d.ChunkSize {
-						return totalRead, nil
-					}
-				}
-			} else {
-				// offset > currentLength >= chunkSize
-				_, part, err = multi.PutPartCopy(partNumber,
-					oss.CopyOptions{},
-					d.Bucket.Path(d.ossPath(path)))
-				if err != nil {
-					return 0, err
-				}
-
-				parts = append(parts, part)
-				partNumber++
-
-				//Zero fill from currentLength up to offset, then some reader
-				if err = fromZeroFillLarge(currentLength, offset); err != nil {
-					return totalRead, err
-				}
-
-				if err = fromReader((offset - currentLength) % d.ChunkSize); err != nil {
-					return totalRead, err
-				}
-
-				if totalRead+((offset-currentLength)%d.ChunkSize) < d.ChunkSize {
-					return totalRead, nil
-				}
-			}
-
+			logrus.Errorf("error putting part, aborting: %v", err)
+			multi.Abort()
+			return 0, err
 		}
+		parts = append(parts, part)
 	}
 
-	for {
-		if err = fromReader(0); err != nil {
-			return totalRead, err
-		}
-
-		if int64(bytesRead) < d.ChunkSize {
-			break
-		}
+	if err := multi.Complete(parts); err != nil {
+		multi.Abort()
+		return 0, err
 	}
 
-	return totalRead, nil
+	return staged.Size, nil
 }
 
 // Stat retrieves the FileInfo for the given path, including the current size
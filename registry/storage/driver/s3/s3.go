@@ -74,6 +74,27 @@ func (factory *s3DriverFactory) Create(parameters map[string]interface{}) (stora
 	return FromParameters(parameters)
 }
 
+func (*s3DriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the parameters of the S3 driver. A region
+// unknown to the AWS client is rejected by FromParameters, which a string
+// type cannot describe.
+var describedParameters = []factory.Parameter{
+	{Name: "accesskey", Type: factory.TypeString, Description: "access key of the account, defaulting to the credentials of the instance"},
+	{Name: "secretkey", Type: factory.TypeString, Description: "secret key of the account, defaulting to the credentials of the instance"},
+	{Name: "region", Type: factory.TypeString, Required: true, Description: "region of the bucket"},
+	{Name: "bucket", Type: factory.TypeString, Required: true, Description: "bucket storing the objects"},
+	{Name: "encrypt", Type: factory.TypeBool, Default: "false", Description: "whether objects are encrypted on the server side"},
+	{Name: "secure", Type: factory.TypeBool, Default: "true", Description: "whether to use HTTPS"},
+	{Name: "v4auth", Type: factory.TypeBool, Default: "false", Description: "whether to sign requests with AWS signature version 4"},
+	{Name: "chunksize", Type: factory.TypeInt, Default: strconv.Itoa(defaultChunkSize), Description: "size of the parts of multipart uploads, at least " + strconv.Itoa(minChunkSize)},
+	{Name: "rootdirectory", Type: factory.TypeString, Description: "prefix of the keys of the objects"},
+	{Name: "storageclass", Type: factory.TypeString, Default: string(s3.StandardStorage), Description: "storage class of the objects, " + string(s3.StandardStorage) + " or " + string(s3.ReducedRedundancy)},
+	{Name: "useragent", Type: factory.TypeString, Description: "User-Agent of the requests to S3"},
+}
+
 type driver struct {
 	S3            *s3.S3
 	Bucket        *s3.Bucket
@@ -90,6 +90,18 @@ func init() {
 	}, skipS3)
 }
 
+func BenchmarkDriver(b *testing.B) {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		b.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.Remove(root)
+
+	testsuites.BenchmarkDriver(b, func() (storagedriver.StorageDriver, error) {
+		return s3DriverConstructor(root, s3.StandardStorage)
+	}, skipS3)
+}
+
 func TestEmptyRootList(t *testing.T) {
 	if skipS3() != "" {
 		t.Skip(skipS3())
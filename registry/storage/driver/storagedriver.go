@@ -1,11 +1,13 @@
 package driver
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/distribution/context"
 )
@@ -84,6 +86,106 @@ type StorageDriver interface {
 	URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error)
 }
 
+// BatchStatter is an optional interface implemented by storage drivers which
+// can retrieve the FileInfo of many paths in fewer round trips to the storage
+// provider than a Stat call per path.
+type BatchStatter interface {
+	// StatMany retrieves the FileInfo for each of the given paths. Both
+	// returned slices are the length of paths; errs[i] is non-nil, as Stat
+	// would have returned it, if infos[i] could not be retrieved.
+	StatMany(ctx context.Context, paths []string) (infos []FileInfo, errs []error)
+}
+
+// StatMany retrieves the FileInfo for each of the given paths, in batches if
+// the driver implements BatchStatter and with a Stat call per path otherwise.
+func StatMany(ctx context.Context, driver StorageDriver, paths []string) ([]FileInfo, []error) {
+	if bs, ok := driver.(BatchStatter); ok {
+		return bs.StatMany(ctx, paths)
+	}
+
+	infos := make([]FileInfo, len(paths))
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		infos[i], errs[i] = driver.Stat(ctx, path)
+	}
+	return infos, errs
+}
+
+// Copier is an optional interface implemented by storage drivers which can
+// copy an object on the storage provider, without its content passing through
+// the registry.
+type Copier interface {
+	// Copy copies the object stored at sourcePath to destPath, replacing any
+	// object stored at destPath.
+	Copy(ctx context.Context, sourcePath string, destPath string) error
+}
+
+// Copy copies the object stored at sourcePath to destPath, on the storage
+// provider if the driver implements Copier and by reading and writing it
+// through the registry otherwise.
+func Copy(ctx context.Context, driver StorageDriver, sourcePath string, destPath string) error {
+	if c, ok := driver.(Copier); ok {
+		return c.Copy(ctx, sourcePath, destPath)
+	}
+
+	rc, err := driver.ReadStream(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// WriteStream does not truncate, so a longer object at destPath must be
+	// removed first.
+	if err := driver.Delete(ctx, destPath); err != nil {
+		if _, ok := err.(PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	_, err = driver.WriteStream(ctx, destPath, 0, rc)
+	return err
+}
+
+// StorageClasser is an optional interface implemented by storage drivers
+// which store objects in classes of storage of distinct cost and access
+// latency, such as the standard, infrequent access and archive storage of
+// KODO.
+type StorageClasser interface {
+	// SetStorageClass moves the object stored at path to the named
+	// storage class.
+	SetStorageClass(ctx context.Context, path string, class string) error
+}
+
+// SetStorageClass moves the object stored at path to the named storage class.
+// ErrUnsupportedMethod is returned if the driver does not implement
+// StorageClasser.
+func SetStorageClass(ctx context.Context, driver StorageDriver, path string, class string) error {
+	if sc, ok := driver.(StorageClasser); ok {
+		return sc.SetStorageClass(ctx, path, class)
+	}
+	return ErrUnsupportedMethod{DriverName: driver.Name()}
+}
+
+// Restorer is an optional interface implemented by storage drivers whose
+// archive storage classes hold objects which must be restored before they can
+// be read, such as the archive storage of KODO.
+type Restorer interface {
+	// Restore returns whether the object stored at path can be read. If it
+	// is archived and no restore is in progress, a restore keeping it
+	// readable for the given number of days is requested.
+	Restore(ctx context.Context, path string, days int) (bool, error)
+}
+
+// Restore returns whether the object stored at path can be read, requesting
+// its restore if it is archived. The objects of drivers not implementing
+// Restorer can always be read.
+func Restore(ctx context.Context, driver StorageDriver, path string, days int) (bool, error) {
+	if r, ok := driver.(Restorer); ok {
+		return r.Restore(ctx, path, days)
+	}
+	return true, nil
+}
+
 // PathRegexp is the regular expression which each file path must match. A
 // file path is absolute, beginning with a slash and containing a positive
 // number of path components separated by slashes, where each component is
@@ -132,13 +234,74 @@ func (err InvalidOffsetError) Error() string {
 	return fmt.Sprintf("%s: invalid offset: %d for path: %s", err.DriverName, err.Offset, err.Path)
 }
 
+// UnavailableError is returned when the storage backend is known to be
+// unavailable, such as while a circuit breaker is open, so that requests
+// fail fast instead of waiting on the backend. They may be retried after
+// RetryAfter.
+type UnavailableError struct {
+	DriverName string
+	RetryAfter time.Duration
+}
+
+func (err UnavailableError) Error() string {
+	return fmt.Sprintf("%s: storage backend unavailable, retry after %s", err.DriverName, err.RetryAfter)
+}
+
 // Error is a catch-all error type which captures an error string and
-// the driver type on which it occured.
+// the driver type on which it occured. The operation and path of the failed
+// call, and the HTTP status, error code and request ID answered by the
+// storage provider are filled in when known, to tell the cause of the error.
 type Error struct {
 	DriverName string
+	Operation  string
+	Path       string
+	StatusCode int
+	Code       string
+	RequestID  string
 	Enclosed   error
 }
 
 func (err Error) Error() string {
-	return fmt.Sprintf("%s: %s", err.DriverName, err.Enclosed)
+	msg := err.DriverName + ": "
+	if err.Operation != "" {
+		msg += fmt.Sprintf("%s %s: ", err.Operation, err.Path)
+	}
+	msg += fmt.Sprint(err.Enclosed)
+
+	var details []string
+	if err.StatusCode != 0 {
+		details = append(details, fmt.Sprintf("status %d", err.StatusCode))
+	}
+	if err.Code != "" {
+		details = append(details, "code "+err.Code)
+	}
+	if err.RequestID != "" {
+		details = append(details, "request id "+err.RequestID)
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	return msg
+}
+
+// MarshalJSON implements json.Marshaler, so that the details of the error
+// are shown in the payloads of API errors.
+func (err Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Driver     string `json:"driver"`
+		Operation  string `json:"operation,omitempty"`
+		Path       string `json:"path,omitempty"`
+		StatusCode int    `json:"status,omitempty"`
+		Code       string `json:"code,omitempty"`
+		RequestID  string `json:"requestid,omitempty"`
+		Message    string `json:"message"`
+	}{
+		Driver:     err.DriverName,
+		Operation:  err.Operation,
+		Path:       err.Path,
+		StatusCode: err.StatusCode,
+		Code:       err.Code,
+		RequestID:  err.RequestID,
+		Message:    fmt.Sprint(err.Enclosed),
+	})
 }
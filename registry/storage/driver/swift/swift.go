@@ -97,6 +97,33 @@ func (factory *swiftDriverFactory) Create(parameters map[string]interface{}) (st
 	return FromParameters(parameters)
 }
 
+func (*swiftDriverFactory) Parameters() []factory.Parameter {
+	return describedParameters
+}
+
+// describedParameters lists the parameters of the Swift driver. The domain
+// and trust parameters only apply to Keystone v3 authentication, and the
+// temporary URL ones to URLFor.
+var describedParameters = []factory.Parameter{
+	{Name: "username", Type: factory.TypeString, Required: true, Description: "user name of the account"},
+	{Name: "password", Type: factory.TypeString, Required: true, Description: "password of the account"},
+	{Name: "authurl", Type: factory.TypeString, Required: true, Description: "URL of the authentication service"},
+	{Name: "container", Type: factory.TypeString, Required: true, Description: "container storing the objects"},
+	{Name: "tenant", Type: factory.TypeString, Description: "name of the tenant"},
+	{Name: "tenantid", Type: factory.TypeString, Description: "id of the tenant"},
+	{Name: "domain", Type: factory.TypeString, Description: "name of the domain, with Keystone v3"},
+	{Name: "domainid", Type: factory.TypeString, Description: "id of the domain, with Keystone v3"},
+	{Name: "trustid", Type: factory.TypeString, Description: "id of the trust, with Keystone v3"},
+	{Name: "region", Type: factory.TypeString, Description: "region of the container"},
+	{Name: "prefix", Type: factory.TypeString, Description: "prefix of the names of the objects"},
+	{Name: "insecureskipverify", Type: factory.TypeBool, Default: "false", Description: "whether to skip the verification of TLS certificates"},
+	{Name: "chunksize", Type: factory.TypeInt, Default: strconv.Itoa(defaultChunkSize), Description: "size of the segments of large objects, at least " + strconv.Itoa(minChunkSize)},
+	{Name: "secretkey", Type: factory.TypeString, Description: "secret key of the temporary URLs"},
+	{Name: "accesskey", Type: factory.TypeString, Description: "access key of the temporary URLs"},
+	{Name: "tempurlcontainerkey", Type: factory.TypeBool, Default: "false", Description: "whether the secret key of the temporary URLs is the one of the container"},
+	{Name: "tempurlmethods", Type: factory.TypeList, Description: "methods temporary URLs are signed for"},
+}
+
 type driver struct {
 	Conn                swift.Connection
 	Container           string
@@ -430,6 +457,14 @@ func (d *driver) WriteStream(ctx context.Context, path string, offset int64, rea
 
 		n, err := io.Copy(writer, multi)
 		if err != nil {
+			// Close the segment, keeping the bytes copied, so that its
+			// request is not left open when the source fails.
+			if closeErr := currentSegment.Close(); closeErr != nil {
+				context.GetLogger(ctx).Errorf("error closing segment %s after failed write: %v", segment, closeErr)
+			}
+			if n > max(0, offset-cursor) {
+				bytesRead += n - max(0, offset-cursor)
+			}
 			return false, bytesRead, err
 		}
 
@@ -102,7 +102,11 @@ func init() {
 		return swiftDriverConstructor(prefix)
 	}
 
-	testsuites.RegisterSuite(driverConstructor, testsuites.NeverSkip)
+	// Writes to a file of the swift driver update the segments of its
+	// manifest in place, so they must not run concurrently.
+	testsuites.RegisterSuiteWithOptions(driverConstructor, testsuites.NeverSkip, testsuites.SuiteOptions{
+		NoConcurrentWritesSamePath: true,
+	})
 }
 
 func TestEmptyRootList(t *testing.T) {
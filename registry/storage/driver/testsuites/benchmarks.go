@@ -0,0 +1,237 @@
+package testsuites
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// benchmarkSizes are the object sizes the content benchmarks are run with.
+var benchmarkSizes = []int64{
+	1 << 10,
+	64 << 10,
+	1 << 20,
+	16 << 20,
+}
+
+// benchmarkListSizes are the numbers of objects the List benchmarks are run
+// with.
+var benchmarkListSizes = []int{10, 100, 1000}
+
+// BenchmarkDriver runs the storage driver benchmarks as sub-benchmarks of b,
+// against a driver returned by driverConstructor. The benchmarks measure the
+// throughput of PutContent, WriteStream, ReadStream, List and Delete at
+// multiple object sizes, and report the 50th, 90th and 99th percentile of
+// the latency of each operation. A driver package runs them with
+//
+//	func BenchmarkDriver(b *testing.B) {
+//		testsuites.BenchmarkDriver(b, constructor, skipCheck)
+//	}
+//
+// and "go test -bench .".
+func BenchmarkDriver(b *testing.B, driverConstructor DriverConstructor, skipCheck SkipCheck) {
+	if reason := skipCheck(); reason != "" {
+		b.Skip(reason)
+	}
+
+	driver, err := driverConstructor()
+	if err != nil {
+		b.Fatalf("unexpected error constructing driver: %v", err)
+	}
+
+	bench := &driverBenchmark{
+		ctx:    context.Background(),
+		driver: driver,
+	}
+
+	for _, size := range benchmarkSizes {
+		name := formatSize(size)
+		b.Run("PutContent/"+name, func(b *testing.B) { bench.putContent(b, size) })
+		b.Run("WriteStream/"+name, func(b *testing.B) { bench.writeStream(b, size) })
+		b.Run("ReadStream/"+name, func(b *testing.B) { bench.readStream(b, size) })
+		b.Run("Delete/"+name, func(b *testing.B) { bench.delete(b, size) })
+	}
+	for _, n := range benchmarkListSizes {
+		b.Run(fmt.Sprintf("List/%dObjects", n), func(b *testing.B) { bench.list(b, n) })
+	}
+}
+
+// driverBenchmark holds the driver the benchmarks are run against.
+type driverBenchmark struct {
+	ctx    context.Context
+	driver storagedriver.StorageDriver
+}
+
+// latencies records the latency of each operation of a benchmark.
+type latencies []time.Duration
+
+// time runs op, recording its latency, and fails the benchmark if it fails.
+func (l *latencies) time(b *testing.B, op func() error) {
+	start := time.Now()
+	err := op()
+	*l = append(*l, time.Since(start))
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// report reports the percentiles of the recorded latencies as metrics of b.
+func (l latencies) report(b *testing.B) {
+	if len(l) == 0 {
+		return
+	}
+
+	sort.Sort(durations(l))
+	for _, p := range []int{50, 90, 99} {
+		i := (len(l)*p+99)/100 - 1
+		b.ReportMetric(float64(l[i])/float64(time.Millisecond), fmt.Sprintf("p%d-ms", p))
+	}
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (bench *driverBenchmark) putContent(b *testing.B, size int64) {
+	parentDir := randomPath(8)
+	defer bench.driver.Delete(bench.ctx, firstPart(parentDir))
+
+	content := randomContents(size)
+	filename := path.Join(parentDir, randomFilename(32))
+
+	var l latencies
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.time(b, func() error {
+			return bench.driver.PutContent(bench.ctx, filename, content)
+		})
+	}
+	b.StopTimer()
+	l.report(b)
+}
+
+func (bench *driverBenchmark) writeStream(b *testing.B, size int64) {
+	parentDir := randomPath(8)
+	defer bench.driver.Delete(bench.ctx, firstPart(parentDir))
+
+	content := randomContents(size)
+	filename := path.Join(parentDir, randomFilename(32))
+
+	var l latencies
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.time(b, func() error {
+			written, err := bench.driver.WriteStream(bench.ctx, filename, 0, bytes.NewReader(content))
+			if err == nil && written != size {
+				err = fmt.Errorf("wrote %d bytes of %d", written, size)
+			}
+			return err
+		})
+	}
+	b.StopTimer()
+	l.report(b)
+}
+
+func (bench *driverBenchmark) readStream(b *testing.B, size int64) {
+	parentDir := randomPath(8)
+	defer bench.driver.Delete(bench.ctx, firstPart(parentDir))
+
+	filename := path.Join(parentDir, randomFilename(32))
+	if err := bench.driver.PutContent(bench.ctx, filename, randomContents(size)); err != nil {
+		b.Fatalf("unexpected error storing content: %v", err)
+	}
+
+	var l latencies
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.time(b, func() error {
+			rc, err := bench.driver.ReadStream(bench.ctx, filename, 0)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			read, err := io.Copy(ioutil.Discard, rc)
+			if err == nil && read != size {
+				err = fmt.Errorf("read %d bytes of %d", read, size)
+			}
+			return err
+		})
+	}
+	b.StopTimer()
+	l.report(b)
+}
+
+func (bench *driverBenchmark) delete(b *testing.B, size int64) {
+	parentDir := randomPath(8)
+	defer bench.driver.Delete(bench.ctx, firstPart(parentDir))
+
+	content := randomContents(size)
+
+	var l latencies
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		filename := path.Join(parentDir, randomFilename(32))
+		if err := bench.driver.PutContent(bench.ctx, filename, content); err != nil {
+			b.Fatalf("unexpected error storing content: %v", err)
+		}
+		b.StartTimer()
+
+		l.time(b, func() error {
+			return bench.driver.Delete(bench.ctx, filename)
+		})
+	}
+	b.StopTimer()
+	l.report(b)
+}
+
+func (bench *driverBenchmark) list(b *testing.B, n int) {
+	parentDir := randomPath(8)
+	defer bench.driver.Delete(bench.ctx, firstPart(parentDir))
+
+	for i := 0; i < n; i++ {
+		if err := bench.driver.PutContent(bench.ctx, path.Join(parentDir, randomFilename(32)), nil); err != nil {
+			b.Fatalf("unexpected error storing content: %v", err)
+		}
+	}
+
+	var l latencies
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.time(b, func() error {
+			keys, err := bench.driver.List(bench.ctx, parentDir)
+			if err == nil && len(keys) != n {
+				err = fmt.Errorf("listed %d objects of %d", len(keys), n)
+			}
+			return err
+		})
+	}
+	b.StopTimer()
+	l.report(b)
+}
+
+// formatSize returns a short name for a size in bytes.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", size>>10)
+	}
+	return fmt.Sprintf("%dB", size)
+}
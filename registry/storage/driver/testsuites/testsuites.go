@@ -3,6 +3,8 @@ package testsuites
 import (
 	"bytes"
 	"crypto/sha1"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -26,13 +28,29 @@ func Test(t *testing.T) { check.TestingT(t) }
 // RegisterSuite registers an in-process storage driver test suite with
 // the go test runner.
 func RegisterSuite(driverConstructor DriverConstructor, skipCheck SkipCheck) {
+	RegisterSuiteWithOptions(driverConstructor, skipCheck, SuiteOptions{})
+}
+
+// RegisterSuiteWithOptions registers a DriverSuite like RegisterSuite, not
+// checking the behaviours opts tells the driver does not provide.
+func RegisterSuiteWithOptions(driverConstructor DriverConstructor, skipCheck SkipCheck, opts SuiteOptions) {
 	check.Suite(&DriverSuite{
 		Constructor: driverConstructor,
 		SkipCheck:   skipCheck,
+		Options:     opts,
 		ctx:         context.Background(),
 	})
 }
 
+// SuiteOptions describes the behaviours a driver does not provide, whose
+// tests are skipped.
+type SuiteOptions struct {
+	// NoConcurrentWritesSamePath is set for drivers whose writes to a file
+	// must not run concurrently. The registry serializes the writes to an
+	// upload, so such drivers remain usable.
+	NoConcurrentWritesSamePath bool
+}
+
 // SkipCheck is a function used to determine if a test suite should be skipped.
 // If a SkipCheck returns a non-empty skip reason, the suite is skipped with
 // the given reason.
@@ -56,6 +74,7 @@ type DriverSuite struct {
 	Constructor DriverConstructor
 	Teardown    DriverTeardown
 	SkipCheck
+	Options SuiteOptions
 	storagedriver.StorageDriver
 	ctx context.Context
 }
@@ -469,6 +488,107 @@ func (suite *DriverSuite) testContinueStreamAppend(c *check.C, chunkSize int64)
 	c.Assert(strings.Contains(err.Error(), suite.Name()), check.Equals, true)
 }
 
+// TestWriteStreamOffsetStart checks that writing a large file from offset 0
+// only overwrites the beginning of its contents.
+func (suite *DriverSuite) TestWriteStreamOffsetStart(c *check.C) {
+	suite.testWriteStreamOffset(c, func(size, length int64) int64 { return 0 })
+}
+
+// TestWriteStreamOffsetMiddle checks that writing within a large file only
+// overwrites the written range of its contents.
+func (suite *DriverSuite) TestWriteStreamOffsetMiddle(c *check.C) {
+	suite.testWriteStreamOffset(c, func(size, length int64) int64 { return size/2 + 1 })
+}
+
+// TestWriteStreamOffsetOverlappingEnd checks that writing across the end of
+// a large file overwrites its end and extends it.
+func (suite *DriverSuite) TestWriteStreamOffsetOverlappingEnd(c *check.C) {
+	suite.testWriteStreamOffset(c, func(size, length int64) int64 { return size - length/2 })
+}
+
+// TestWriteStreamOffsetEnd checks that writing at the size of a large file
+// appends to it.
+func (suite *DriverSuite) TestWriteStreamOffsetEnd(c *check.C) {
+	suite.testWriteStreamOffset(c, func(size, length int64) int64 { return size })
+}
+
+// TestWriteStreamOffsetPastEnd checks that writing past the size of a large
+// file extends it with zeros up to the written contents.
+func (suite *DriverSuite) TestWriteStreamOffsetPastEnd(c *check.C) {
+	suite.testWriteStreamOffset(c, func(size, length int64) int64 { return size + length })
+}
+
+// testWriteStreamOffset writes a large file, then writes to it at the offset
+// returned for its size and the length of the write, and checks the
+// resulting contents by reading them back, resuming the read at each offset
+// around the boundaries of the write.
+func (suite *DriverSuite) testWriteStreamOffset(c *check.C, offsetFor func(size, length int64) int64) {
+	// The sizes are not multiples of any block or part size, so that every
+	// boundary falls within a block.
+	var size int64 = 256*1024*1024 + 17
+	var length int64 = 32*1024*1024 + 5
+
+	if testing.Short() {
+		size = 8*1024*1024 + 17
+		length = 1024*1024 + 5
+		c.Log("Reducing file size to 8MB for short mode")
+	}
+
+	filename := randomPath(32)
+	defer suite.deletePath(c, firstPart(filename))
+
+	original := segmentedContents{{seed: 0, length: size}}
+	nn, err := suite.StorageDriver.WriteStream(suite.ctx, filename, 0, io.NewSectionReader(original, 0, size))
+	c.Assert(err, check.IsNil)
+	c.Assert(nn, check.Equals, size)
+
+	offset := offsetFor(size, length)
+	var seed int64 = 12345
+	nn, err = suite.StorageDriver.WriteStream(suite.ctx, filename, offset, io.NewSectionReader(segmentedContents{{seed: seed, length: length}}, 0, length))
+	c.Assert(err, check.IsNil)
+	c.Assert(nn, check.Equals, length)
+
+	var expected segmentedContents
+	if offset <= size {
+		expected = append(expected, contentsSegment{seed: 0, length: offset})
+	} else {
+		expected = append(expected, contentsSegment{seed: 0, length: size}, contentsSegment{seed: -1, length: offset - size})
+	}
+	expected = append(expected, contentsSegment{seed: seed, length: length})
+	if offset+length < size {
+		expected = append(expected, contentsSegment{seed: offset + length, length: size - offset - length})
+	}
+	expectedSize := expected.Size()
+
+	fi, err := suite.StorageDriver.Stat(suite.ctx, filename)
+	c.Assert(err, check.IsNil)
+	c.Assert(fi.Size(), check.Equals, expectedSize)
+
+	var stops []int64
+	for _, stop := range []int64{1, offset - 1, offset, offset + 1, offset + length - 1, offset + length, offset + length + 1, expectedSize - 1, expectedSize} {
+		if stop > 0 && stop <= expectedSize && (len(stops) == 0 || stop > stops[len(stops)-1]) {
+			stops = append(stops, stop)
+		}
+	}
+
+	var readOffset int64
+	for _, stop := range stops {
+		reader, err := suite.StorageDriver.ReadStream(suite.ctx, filename, readOffset)
+		c.Assert(err, check.IsNil)
+		assertContents(c, reader, expected, readOffset, stop-readOffset)
+		reader.Close()
+		readOffset = stop
+	}
+
+	reader, err := suite.StorageDriver.ReadStream(suite.ctx, filename, expectedSize)
+	c.Assert(err, check.IsNil)
+	defer reader.Close()
+
+	n, err := reader.Read(make([]byte, 1))
+	c.Assert(n, check.Equals, 0)
+	c.Assert(err, check.Equals, io.EOF)
+}
+
 // TestReadNonexistentStream tests that reading a stream for a nonexistent path
 // fails.
 func (suite *DriverSuite) TestReadNonexistentStream(c *check.C) {
@@ -798,6 +918,93 @@ func (suite *DriverSuite) TestStatCall(c *check.C) {
 	c.Assert(fi.IsDir(), check.Equals, true)
 }
 
+// TestCopy checks that an object is copied, replacing the destination.
+func (suite *DriverSuite) TestCopy(c *check.C) {
+	contents := randomContents(32)
+	sourcePath := randomPath(32)
+	destPath := randomPath(32)
+
+	defer suite.deletePath(c, firstPart(sourcePath))
+	defer suite.deletePath(c, firstPart(destPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, sourcePath, contents)
+	c.Assert(err, check.IsNil)
+
+	// A longer destination must not leave trailing content behind.
+	err = suite.StorageDriver.PutContent(suite.ctx, destPath, randomContents(64))
+	c.Assert(err, check.IsNil)
+
+	err = storagedriver.Copy(suite.ctx, suite.StorageDriver, sourcePath, destPath)
+	c.Assert(err, check.IsNil)
+
+	received, err := suite.StorageDriver.GetContent(suite.ctx, destPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+
+	received, err = suite.StorageDriver.GetContent(suite.ctx, sourcePath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+}
+
+// TestCopyNonexistent checks that copying a nonexistent object fails without
+// touching the destination.
+func (suite *DriverSuite) TestCopyNonexistent(c *check.C) {
+	contents := randomContents(32)
+	sourcePath := randomPath(32)
+	destPath := randomPath(32)
+
+	defer suite.deletePath(c, firstPart(destPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, destPath, contents)
+	c.Assert(err, check.IsNil)
+
+	err = storagedriver.Copy(suite.ctx, suite.StorageDriver, sourcePath, destPath)
+	c.Assert(err, check.NotNil)
+	c.Assert(err, check.FitsTypeOf, storagedriver.PathNotFoundError{})
+
+	received, err := suite.StorageDriver.GetContent(suite.ctx, destPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+}
+
+// TestStatMany checks that the FileInfo of many paths retrieved at once
+// matches the result of Stat for each path.
+func (suite *DriverSuite) TestStatMany(c *check.C) {
+	content := randomContents(4096)
+	dirPath := randomPath(32)
+	filePath := path.Join(dirPath, randomFilename(32))
+	otherPath := path.Join(dirPath, randomFilename(32))
+	missingPath := path.Join(dirPath, randomFilename(32))
+
+	defer suite.deletePath(c, firstPart(dirPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, filePath, content)
+	c.Assert(err, check.IsNil)
+	err = suite.StorageDriver.PutContent(suite.ctx, otherPath, content[:1024])
+	c.Assert(err, check.IsNil)
+
+	paths := []string{filePath, missingPath, dirPath, otherPath}
+	infos, errs := storagedriver.StatMany(suite.ctx, suite.StorageDriver, paths)
+	c.Assert(infos, check.HasLen, len(paths))
+	c.Assert(errs, check.HasLen, len(paths))
+
+	c.Assert(errs[0], check.IsNil)
+	c.Assert(infos[0].Path(), check.Equals, filePath)
+	c.Assert(infos[0].Size(), check.Equals, int64(len(content)))
+	c.Assert(infos[0].IsDir(), check.Equals, false)
+
+	c.Assert(errs[1], check.FitsTypeOf, storagedriver.PathNotFoundError{})
+	c.Assert(infos[1], check.IsNil)
+
+	c.Assert(errs[2], check.IsNil)
+	c.Assert(infos[2].Path(), check.Equals, dirPath)
+	c.Assert(infos[2].IsDir(), check.Equals, true)
+
+	c.Assert(errs[3], check.IsNil)
+	c.Assert(infos[3].Path(), check.Equals, otherPath)
+	c.Assert(infos[3].Size(), check.Equals, int64(1024))
+}
+
 // TestPutContentMultipleTimes checks that if storage driver can overwrite the content
 // in the subsequent puts. Validates that PutContent does not have to work
 // with an offset like WriteStream does and overwrites the file entirely
@@ -930,6 +1137,259 @@ func (suite *DriverSuite) TestEventualConsistency(c *check.C) {
 	c.Assert(misswrites, check.Not(check.Equals), 1024)
 }
 
+// TestConcurrentWriteStreamsDistinctPaths checks that multiple clients can
+// append to distinct files simultaneously without affecting each other.
+func (suite *DriverSuite) TestConcurrentWriteStreamsDistinctPaths(c *check.C) {
+	numWriters := 16
+	numChunks := 8
+	var chunkSize int64 = 64 * 1024
+
+	if testing.Short() {
+		numWriters = 4
+		c.Log("Reducing number of writers to 4 for short mode")
+	}
+
+	rootDirectory := "/" + randomFilename(int64(8+rand.Intn(8)))
+	defer suite.deletePath(c, rootDirectory)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters)
+
+	writeChunks := func(i int) error {
+		filename := path.Join(rootDirectory, randomFilename(32))
+		contents := patternContents(byte(i), int64(numChunks)*chunkSize)
+
+		var offset int64
+		for offset < int64(len(contents)) {
+			nn, err := suite.StorageDriver.WriteStream(suite.ctx, filename, offset, bytes.NewReader(contents[offset:offset+chunkSize]))
+			if err != nil {
+				return err
+			}
+			if nn != chunkSize {
+				return fmt.Errorf("wrote %d bytes of %s at offset %d, expected %d", nn, filename, offset, chunkSize)
+			}
+			offset += nn
+		}
+
+		readContents, err := suite.StorageDriver.GetContent(suite.ctx, filename)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(readContents, contents) {
+			return fmt.Errorf("unexpected contents of %s", filename)
+		}
+		return nil
+	}
+
+	wg.Add(numWriters)
+	for i := 0; i < numWriters; i++ {
+		go func(i int) {
+			defer wg.Done()
+			errs <- writeChunks(i)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Assert(err, check.IsNil)
+	}
+}
+
+// TestConcurrentWriteStreamsSamePath checks that multiple clients writing the
+// same file simultaneously all succeed, and leave a file of the written size
+// made only of the bytes they wrote. The writes may be interleaved, but no
+// byte may come from elsewhere.
+func (suite *DriverSuite) TestConcurrentWriteStreamsSamePath(c *check.C) {
+	if suite.Options.NoConcurrentWritesSamePath {
+		c.Skip("Concurrent writes to the same path are not supported by the driver")
+	}
+
+	numWriters := 8
+	var filesize int64 = 1024 * 1024
+
+	if testing.Short() {
+		filesize = 64 * 1024
+		c.Log("Reducing file size to 64KB for short mode")
+	}
+
+	filename := randomPath(32)
+	defer suite.deletePath(c, firstPart(filename))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters)
+
+	writeContents := func(i int) error {
+		nn, err := suite.StorageDriver.WriteStream(suite.ctx, filename, 0, bytes.NewReader(patternContents(byte(i), filesize)))
+		if err != nil {
+			return err
+		}
+		if nn != filesize {
+			return fmt.Errorf("wrote %d bytes, expected %d", nn, filesize)
+		}
+		return nil
+	}
+
+	wg.Add(numWriters)
+	for i := 0; i < numWriters; i++ {
+		go func(i int) {
+			defer wg.Done()
+			errs <- writeContents(i)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Assert(err, check.IsNil)
+	}
+
+	fi, err := suite.StorageDriver.Stat(suite.ctx, filename)
+	c.Assert(err, check.IsNil)
+	c.Assert(fi.Size(), check.Equals, filesize)
+
+	readContents, err := suite.StorageDriver.GetContent(suite.ctx, filename)
+	c.Assert(err, check.IsNil)
+	c.Assert(int64(len(readContents)), check.Equals, filesize)
+	for offset, b := range readContents {
+		if int(b) >= numWriters {
+			c.Fatalf("unexpected byte %d at offset %d", b, offset)
+		}
+	}
+}
+
+// TestListDuringDelete checks that listing a directory while it is being
+// deleted only returns entries it contained, or a PathNotFoundError once it
+// is gone.
+func (suite *DriverSuite) TestListDuringDelete(c *check.C) {
+	rootDirectory := "/" + randomFilename(int64(8+rand.Intn(8)))
+	defer suite.deletePath(c, rootDirectory)
+
+	parentDirectory := path.Join(rootDirectory, randomFilename(int64(8+rand.Intn(8))))
+	childFiles := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		childFile := path.Join(parentDirectory, randomFilename(int64(8+rand.Intn(8))))
+		childFiles[childFile] = true
+		err := suite.StorageDriver.PutContent(suite.ctx, childFile, randomContents(32))
+		c.Assert(err, check.IsNil)
+	}
+
+	numListers := 4
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, numListers)
+
+	listContents := func() error {
+		for {
+			keys, err := suite.StorageDriver.List(suite.ctx, parentDirectory)
+			if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+				return err
+			}
+			for _, key := range keys {
+				if !childFiles[key] {
+					return fmt.Errorf("unexpected entry %q", key)
+				}
+			}
+
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+		}
+	}
+
+	wg.Add(numListers)
+	for i := 0; i < numListers; i++ {
+		go func() {
+			defer wg.Done()
+			errs <- listContents()
+		}()
+	}
+
+	for childFile := range childFiles {
+		err := suite.StorageDriver.Delete(suite.ctx, childFile)
+		c.Assert(err, check.IsNil)
+	}
+	err := suite.StorageDriver.Delete(suite.ctx, parentDirectory)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		c.Assert(err, check.IsNil)
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Assert(err, check.IsNil)
+	}
+
+	keys, err := suite.StorageDriver.List(suite.ctx, parentDirectory)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(keys, check.HasLen, 0)
+}
+
+// TestWriteStreamInterrupted checks that a write whose source fails partway
+// through, as when a client disconnects or the registry crashes, leaves a
+// file whose stat'd size only covers fully written contents, so that the
+// write can be resumed from there.
+func (suite *DriverSuite) TestWriteStreamInterrupted(c *check.C) {
+	suite.testInterruptedWrite(c, 0)
+}
+
+// TestWriteStreamInterruptedAppend checks that an interrupted write to the
+// end of an existing file neither loses nor corrupts its previous contents,
+// and can be resumed.
+func (suite *DriverSuite) TestWriteStreamInterruptedAppend(c *check.C) {
+	suite.testInterruptedWrite(c, 3*1024*1024)
+}
+
+func (suite *DriverSuite) testInterruptedWrite(c *check.C, existing int64) {
+	var filesize int64 = 8 * 1024 * 1024
+	interruptAt := existing + (filesize-existing)/2 + 123
+
+	filename := randomPath(32)
+	defer suite.deletePath(c, firstPart(filename))
+
+	contents := make([]byte, filesize)
+	copy(contents, randomContents(filesize))
+
+	if existing > 0 {
+		nn, err := suite.StorageDriver.WriteStream(suite.ctx, filename, 0, bytes.NewReader(contents[:existing]))
+		c.Assert(err, check.IsNil)
+		c.Assert(nn, check.Equals, existing)
+	}
+
+	reader := &interruptedReader{Reader: bytes.NewReader(contents[existing:]), remaining: interruptAt - existing}
+	nn, err := suite.StorageDriver.WriteStream(suite.ctx, filename, existing, reader)
+	c.Assert(err, check.NotNil)
+	c.Assert(nn <= interruptAt-existing, check.Equals, true, check.Commentf("reported %d bytes written", nn))
+
+	var offset int64
+	fi, err := suite.StorageDriver.Stat(suite.ctx, filename)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok || existing > 0 {
+		c.Assert(err, check.IsNil)
+		offset = fi.Size()
+	}
+	c.Assert(offset >= existing, check.Equals, true, check.Commentf("existing contents truncated to %d bytes", offset))
+	c.Assert(offset <= interruptAt, check.Equals, true, check.Commentf("stat'd size %d beyond written contents", offset))
+
+	if offset > 0 {
+		readContents, err := suite.StorageDriver.GetContent(suite.ctx, filename)
+		c.Assert(err, check.IsNil)
+		c.Assert(readContents, check.DeepEquals, contents[:offset])
+	}
+
+	nn, err = suite.StorageDriver.WriteStream(suite.ctx, filename, offset, bytes.NewReader(contents[offset:]))
+	c.Assert(err, check.IsNil)
+	c.Assert(nn, check.Equals, filesize-offset)
+
+	readContents, err := suite.StorageDriver.GetContent(suite.ctx, filename)
+	c.Assert(err, check.IsNil)
+	c.Assert(readContents, check.DeepEquals, contents)
+}
+
 // BenchmarkPutGetEmptyFiles benchmarks PutContent/GetContent for 0B files
 func (suite *DriverSuite) BenchmarkPutGetEmptyFiles(c *check.C) {
 	suite.benchmarkPutGetFiles(c, 0)
@@ -1202,6 +1662,100 @@ func newRandReader(n int64) *randReader {
 	return &randReader{r: n}
 }
 
+// contentsSegment is a part of the contents of a file, made of length bytes
+// of the random contents starting at seed, or of zeros if seed is negative.
+type contentsSegment struct {
+	seed   int64
+	length int64
+}
+
+// segmentedContents describes large contents by their segments, without
+// holding them in memory.
+type segmentedContents []contentsSegment
+
+// Size returns the total length of the contents.
+func (sc segmentedContents) Size() int64 {
+	var size int64
+	for _, s := range sc {
+		size += s.length
+	}
+	return size
+}
+
+// ReadAt implements io.ReaderAt.
+func (sc segmentedContents) ReadAt(p []byte, off int64) (n int, err error) {
+	for _, s := range sc {
+		if off >= s.length {
+			off -= s.length
+			continue
+		}
+		for ; n < len(p) && off < s.length; n, off = n+1, off+1 {
+			if s.seed < 0 {
+				p[n] = 0
+			} else {
+				p[n] = randomBytes[(s.seed+off)%int64(len(randomBytes))]
+			}
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		off = 0
+	}
+	return n, io.EOF
+}
+
+// assertContents checks that the next n bytes read from reader are those of
+// expected at offset, reporting the offset of the first difference.
+func assertContents(c *check.C, reader io.Reader, expected segmentedContents, offset, n int64) {
+	buf := make([]byte, 1024*1024)
+	expectedBuf := make([]byte, len(buf))
+	for n > 0 {
+		chunk := int64(len(buf))
+		if chunk > n {
+			chunk = n
+		}
+		read, err := io.ReadFull(reader, buf[:chunk])
+		c.Assert(err, check.IsNil, check.Commentf("reading %d bytes at offset %d", chunk, offset))
+		expected.ReadAt(expectedBuf[:read], offset)
+		if !bytes.Equal(buf[:read], expectedBuf[:read]) {
+			for i := range buf[:read] {
+				if buf[i] != expectedBuf[i] {
+					c.Fatalf("unexpected contents at offset %d: got %d, expected %d", offset+int64(i), buf[i], expectedBuf[i])
+				}
+			}
+		}
+		offset += int64(read)
+		n -= int64(read)
+	}
+}
+
+// patternContents returns contents filled with b, so that the writer of any
+// byte can be told apart.
+func patternContents(b byte, length int64) []byte {
+	return bytes.Repeat([]byte{b}, int(length))
+}
+
+var errInterrupted = errors.New("interrupted")
+
+// interruptedReader reads from Reader until remaining bytes have been read,
+// then fails as a client disconnecting would.
+type interruptedReader struct {
+	io.Reader
+	remaining int64
+}
+
+func (ir *interruptedReader) Read(p []byte) (n int, err error) {
+	if ir.remaining <= 0 {
+		return 0, errInterrupted
+	}
+	if int64(len(p)) > ir.remaining {
+		p = p[:ir.remaining]
+	}
+	n, err = ir.Reader.Read(p)
+	ir.remaining -= int64(n)
+	return n, err
+}
+
 func firstPart(filePath string) string {
 	if filePath == "" {
 		return "/"
@@ -0,0 +1,109 @@
+// Package estargz locates the table of contents of eStargz layers, allowing
+// lazy-pulling clients to fetch it without downloading the whole layer.
+//
+// An eStargz layer is a gzip compressed tar stream terminated by a footer,
+// itself a small gzip stream whose extra header field records the offset of
+// the table of contents. Both the current eStargz footer and the legacy
+// stargz footer are supported.
+package estargz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	// FooterSize is the size of an eStargz footer.
+	FooterSize = 51
+
+	// LegacyFooterSize is the size of a legacy stargz footer.
+	LegacyFooterSize = 47
+
+	// tocMagic terminates the offset recorded in the footer.
+	tocMagic = "STARGZ"
+)
+
+// ErrNotEStargz is returned when a blob does not end with a stargz footer.
+var ErrNotEStargz = errors.New("estargz: blob has no stargz footer")
+
+// TOCRange returns the offset and length of the table of contents section
+// of the eStargz blob of the given size read from rs. The section is itself
+// a gzip stream and is returned as stored in the blob.
+func TOCRange(rs io.ReadSeeker, size int64) (offset, length int64, err error) {
+	if size < LegacyFooterSize {
+		return 0, 0, ErrNotEStargz
+	}
+
+	footerSize := int64(FooterSize)
+	if size < footerSize {
+		footerSize = LegacyFooterSize
+	}
+
+	if _, err := rs.Seek(size-footerSize, os.SEEK_SET); err != nil {
+		return 0, 0, err
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := io.ReadFull(rs, footer); err != nil {
+		return 0, 0, err
+	}
+
+	// Try the current footer first, then the legacy footer, which occupies
+	// the tail of the buffer.
+	if len(footer) == FooterSize {
+		if offset, err := parseFooter(footer, false); err == nil {
+			return tocRange(offset, size-FooterSize)
+		}
+	}
+
+	if offset, err := parseFooter(footer[len(footer)-LegacyFooterSize:], true); err == nil {
+		return tocRange(offset, size-LegacyFooterSize)
+	}
+
+	return 0, 0, ErrNotEStargz
+}
+
+// tocRange checks that the table of contents offset lies before the footer,
+// which starts at end.
+func tocRange(offset, end int64) (int64, int64, error) {
+	if offset < 0 || offset > end {
+		return 0, 0, fmt.Errorf("estargz: table of contents offset %d out of range", offset)
+	}
+
+	return offset, end - offset, nil
+}
+
+// parseFooter extracts the table of contents offset from a footer.
+func parseFooter(p []byte, legacy bool) (int64, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	extra := zr.Header.Extra
+	if !legacy {
+		// The eStargz footer wraps the payload in a subfield with the
+		// identifier "SG".
+		if len(extra) < 4 || extra[0] != 'S' || extra[1] != 'G' {
+			return 0, ErrNotEStargz
+		}
+
+		n := int(extra[2]) | int(extra[3])<<8
+		if len(extra) != 4+n {
+			return 0, ErrNotEStargz
+		}
+		extra = extra[4:]
+	}
+
+	if len(extra) != 16+len(tocMagic) || string(extra[16:]) != tocMagic {
+		return 0, ErrNotEStargz
+	}
+
+	return strconv.ParseInt(string(extra[:16]), 16, 64)
+}
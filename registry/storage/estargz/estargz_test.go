@@ -0,0 +1,85 @@
+package estargz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, p []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(p); err != nil {
+		t.Fatalf("unexpected error compressing: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("unexpected error closing gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func footerBytes(offset int64, legacy bool) []byte {
+	payload := []byte(fmt.Sprintf("%016x%s", offset, tocMagic))
+	extra := payload
+	if !legacy {
+		extra = append([]byte{'S', 'G', byte(len(payload)), 0}, payload...)
+	}
+
+	// Assemble the gzip stream by hand, as the footer size depends on the
+	// encoding of the empty deflate block: a gzip header carrying the extra
+	// field, an empty final stored block and a zero checksum and size.
+	footer := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, byte(len(extra)), byte(len(extra) >> 8)}
+	footer = append(footer, extra...)
+	footer = append(footer, 1, 0, 0, 0xff, 0xff)
+	footer = append(footer, make([]byte, 8)...)
+	return footer
+}
+
+func TestTOCRange(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		layer := gzipBytes(t, bytes.Repeat([]byte("layer content "), 128))
+		toc := gzipBytes(t, []byte(`{"version":1,"entries":[]}`))
+		footer := footerBytes(int64(len(layer)), legacy)
+
+		expectedSize := FooterSize
+		if legacy {
+			expectedSize = LegacyFooterSize
+		}
+		if len(footer) != expectedSize {
+			t.Fatalf("unexpected footer size: %d != %d", len(footer), expectedSize)
+		}
+
+		blob := append(append(append([]byte{}, layer...), toc...), footer...)
+		offset, length, err := TOCRange(bytes.NewReader(blob), int64(len(blob)))
+		if err != nil {
+			t.Fatalf("unexpected error locating table of contents (legacy=%v): %v", legacy, err)
+		}
+
+		if offset != int64(len(layer)) || length != int64(len(toc)) {
+			t.Fatalf("unexpected table of contents range (legacy=%v): %d+%d != %d+%d", legacy, offset, length, len(layer), len(toc))
+		}
+
+		if !bytes.Equal(blob[offset:offset+length], toc) {
+			t.Fatalf("table of contents content mismatch (legacy=%v)", legacy)
+		}
+	}
+}
+
+func TestTOCRangeNotEStargz(t *testing.T) {
+	for _, blob := range [][]byte{
+		nil,
+		[]byte("short"),
+		gzipBytes(t, bytes.Repeat([]byte("plain gzip layer "), 64)),
+	} {
+		if _, _, err := TOCRange(bytes.NewReader(blob), int64(len(blob))); err != ErrNotEStargz {
+			t.Fatalf("expected ErrNotEStargz, got %v", err)
+		}
+	}
+
+	// a footer pointing past itself is an error
+	blob := footerBytes(1024, false)
+	if _, _, err := TOCRange(bytes.NewReader(blob), int64(len(blob))); err == nil || err == ErrNotEStargz {
+		t.Fatalf("expected out of range error, got %v", err)
+	}
+}
@@ -0,0 +1,796 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// GCResult describes the outcome of a garbage collection run.
+type GCResult struct {
+	// Marked is the number of blobs referenced by manifests.
+	Marked int `json:"marked"`
+
+	// Deleted lists the unreferenced blobs which were removed from the blob
+	// store or, for a dry run, which would have been removed.
+	Deleted []digest.Digest `json:"deleted"`
+}
+
+// GCOpts contains options for MarkAndSweep.
+type GCOpts struct {
+	// DryRun reports the unreferenced blobs without deleting them.
+	DryRun bool
+
+	// Inventory, if set, lists the blobs considered for deletion instead of
+	// the storage driver. Blobs written after the inventory was generated
+	// are never deleted.
+	Inventory *Inventory
+
+	// Workers is the number of repositories marked, or blobs deleted,
+	// concurrently. It defaults to one, and is capped at MaxGCWorkers.
+	// Negative values are rejected.
+	Workers int
+
+	// RateLimit, if positive, is the maximum number of repositories marked,
+	// or blobs deleted, per second. It keeps garbage collection within the
+	// request rate allowed by the storage provider.
+	RateLimit float64
+
+	// Resume continues an interrupted run from the checkpoint saved during
+	// its mark phase, skipping the repositories it marked. If the manifest
+	// revisions of one of these repositories changed since, the mark phase
+	// starts over.
+	Resume bool
+
+	// Pins protect content from deletion, in addition to the pins stored in
+	// the registry, such as those of the configuration.
+	Pins []Pin
+}
+
+// MaxGCWorkers is the maximum number of workers of a garbage collection run.
+const MaxGCWorkers = 256
+
+// gcProgressInterval is the interval at which the progress of garbage
+// collection is logged.
+const gcProgressInterval = 30 * time.Second
+
+// gcCheckpointInterval is the interval at which the mark phase saves a
+// checkpoint.
+const gcCheckpointInterval = time.Minute
+
+// errGCStopped is returned to producers of work once a worker failed.
+var errGCStopped = errors.New("garbage collection stopped")
+
+// MarkAndSweep performs a mark and sweep of registry data. Every manifest
+// revision of every repository is read and the blobs it references are
+// marked, along with the content protected by pins. Blobs in the blob store
+// that were not marked are then deleted, along with the variants the
+// repositories keep of them.
+//
+// The registry should not accept writes while MarkAndSweep runs: a blob
+// uploaded during the run is not yet referenced by a manifest and would be
+// deleted. A run stops once ctx is canceled; its mark phase can be resumed
+// from the checkpoint saved when stopping.
+func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, opts GCOpts) (GCResult, error) {
+	workers := opts.Workers
+	switch {
+	case workers < 0:
+		return GCResult{}, fmt.Errorf("invalid number of workers %d", workers)
+	case workers == 0:
+		workers = 1
+	case workers > MaxGCWorkers:
+		context.GetLogger(ctx).Warnf("gc: %d workers requested, running %d", workers, MaxGCWorkers)
+		workers = MaxGCWorkers
+	}
+
+	limiter := newGCRateLimiter(opts.RateLimit)
+	defer limiter.stop()
+
+	// mark
+	marks := newMarkState()
+	if opts.Resume {
+		checkpoint, err := loadGCCheckpoint(ctx, storageDriver)
+		switch err.(type) {
+		case nil:
+			changed, err := checkpoint.changed(ctx, storageDriver)
+			if err != nil {
+				return GCResult{}, fmt.Errorf("failed to check checkpoint: %v", err)
+			}
+			if changed != "" {
+				context.GetLogger(ctx).Infof("gc: repository %s changed since the run started at %s, marking from the start", changed, checkpoint.Started)
+				break
+			}
+			marks.restore(checkpoint)
+			context.GetLogger(ctx).Infof("gc: resuming run started at %s, %d repositories already marked", checkpoint.Started, len(checkpoint.Repositories))
+		case driver.PathNotFoundError:
+			context.GetLogger(ctx).Infof("gc: no checkpoint to resume from")
+		default:
+			return GCResult{}, fmt.Errorf("failed to load checkpoint: %v", err)
+		}
+	}
+
+	err := markRepositories(ctx, storageDriver, namespace, marks, workers, limiter)
+	if err != nil {
+		return GCResult{}, fmt.Errorf("failed to mark: %v", err)
+	}
+
+	pins, err := Pins(ctx, storageDriver)
+	if err != nil {
+		return GCResult{}, fmt.Errorf("failed to load pins: %v", err)
+	}
+	if err := markPins(ctx, storageDriver, namespace, append(pins, opts.Pins...), marks); err != nil {
+		return GCResult{}, err
+	}
+
+	markSet := marks.marked
+	result := GCResult{Marked: len(markSet)}
+
+	// sweep
+	enumerate := func(fn func(dgst digest.Digest) error) error {
+		return enumerateBlobs(ctx, storageDriver, fn)
+	}
+	if opts.Inventory != nil {
+		enumerate = func(fn func(dgst digest.Digest) error) error {
+			return opts.Inventory.Enumerate(ctx, fn)
+		}
+	}
+
+	swept := make(map[digest.Digest]struct{})
+	err = enumerate(func(dgst digest.Digest) error {
+		if _, ok := markSet[dgst]; ok {
+			return nil
+		}
+		if _, ok := swept[dgst]; !ok {
+			swept[dgst] = struct{}{}
+			result.Deleted = append(result.Deleted, dgst)
+		}
+		return nil
+	})
+	if err != nil {
+		return GCResult{}, fmt.Errorf("failed to enumerate blobs: %v", err)
+	}
+
+	if !opts.DryRun {
+		result.Deleted, err = sweepBlobs(ctx, storageDriver, namespace, result.Deleted, opts.Inventory != nil, workers, limiter)
+		if err != nil {
+			return result, err
+		}
+		if err := sweepVariants(ctx, storageDriver, namespace, result.Deleted, workers, limiter); err != nil {
+			return result, err
+		}
+	}
+
+	// The run completed, it must not be resumed.
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return result, err
+	}
+	if err := storageDriver.Delete(ctx, checkpointPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			context.GetLogger(ctx).Warnf("gc: failed to delete checkpoint: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// markRepositories marks the blobs referenced by all repositories which are
+// not yet marked in marks, saving a checkpoint periodically and on failure.
+func markRepositories(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, marks *markState, workers int, limiter *gcRateLimiter) error {
+	var repositories int64
+
+	stopProgress := everyInterval(gcProgressInterval, func() {
+		context.GetLogger(ctx).Infof("gc: marked %d repositories, %d blobs", atomic.LoadInt64(&repositories), marks.len())
+	})
+	stopCheckpoints := everyInterval(gcCheckpointInterval, func() {
+		if err := marks.save(ctx, storageDriver); err != nil {
+			context.GetLogger(ctx).Warnf("gc: failed to save checkpoint: %v", err)
+		}
+	})
+
+	err := runGCWorkers(workers, limiter, func(submit func(string) error) error {
+		return enumerateRepositories(ctx, namespace, func(name string) error {
+			if marks.isComplete(name) {
+				return nil
+			}
+			return submit(name)
+		})
+	}, func(name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		context.GetLogger(ctx).Debugf("marking repository %s", name)
+
+		// The revisions are fingerprinted before they are marked, so that
+		// a revision added meanwhile is found by a resumed run.
+		fingerprint, err := revisionsFingerprint(ctx, storageDriver, name)
+		if err != nil {
+			return err
+		}
+		if err := markRepository(ctx, storageDriver, namespace, name, marks); err != nil {
+			return err
+		}
+
+		marks.complete(name, fingerprint)
+		atomic.AddInt64(&repositories, 1)
+		return nil
+	})
+
+	stopProgress()
+	stopCheckpoints()
+
+	if err != nil {
+		if err := marks.save(ctx, storageDriver); err != nil {
+			context.GetLogger(ctx).Warnf("gc: failed to save checkpoint: %v", err)
+		}
+		return err
+	}
+
+	context.GetLogger(ctx).Infof("gc: marked %d repositories, %d blobs", atomic.LoadInt64(&repositories), marks.len())
+	return nil
+}
+
+// sweepBlobs deletes the unreferenced blobs, returning those which were
+// deleted, in their original order.
+func sweepBlobs(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, unreferenced []digest.Digest, fromInventory bool, workers int, limiter *gcRateLimiter) ([]digest.Digest, error) {
+	var (
+		mu      sync.Mutex
+		deleted = make(map[digest.Digest]struct{})
+	)
+
+	stopProgress := everyInterval(gcProgressInterval, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		context.GetLogger(ctx).Infof("gc: deleted %d of %d blobs", len(deleted), len(unreferenced))
+	})
+
+	vacuum := NewVacuum(ctx, storageDriver)
+	err := runGCWorkers(workers, limiter, func(submit func(string) error) error {
+		for _, dgst := range unreferenced {
+			if err := submit(string(dgst)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(item string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dgst := digest.Digest(item)
+		if err := vacuum.RemoveBlob(item); err != nil {
+			// A blob listed by an inventory may have been deleted since
+			// the inventory was generated.
+			if _, ok := err.(driver.PathNotFoundError); !ok || !fromInventory {
+				return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+			}
+		}
+
+		// Deleted blobs must not be served from the descriptor cache.
+		if reg, ok := namespace.(*registry); ok && reg.blobDescriptorCacheProvider != nil {
+			if err := reg.blobDescriptorCacheProvider.Clear(ctx, dgst); err != nil {
+				context.GetLogger(ctx).Debugf("error clearing descriptor cache for %s: %v", dgst, err)
+			}
+		}
+
+		mu.Lock()
+		deleted[dgst] = struct{}{}
+		mu.Unlock()
+		return nil
+	})
+
+	stopProgress()
+
+	var result []digest.Digest
+	for _, dgst := range unreferenced {
+		if _, ok := deleted[dgst]; ok {
+			result = append(result, dgst)
+		}
+	}
+
+	if err == nil {
+		context.GetLogger(ctx).Infof("gc: deleted %d blobs", len(result))
+	}
+	return result, err
+}
+
+// sweepVariants deletes the variants the repositories keep of the deleted
+// blobs, as they are derived from them and only served in their place.
+func sweepVariants(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, deleted []digest.Digest, workers int, limiter *gcRateLimiter) error {
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	sources := make(map[digest.Digest]struct{}, len(deleted))
+	for _, dgst := range deleted {
+		sources[dgst] = struct{}{}
+	}
+
+	var swept int64
+	err := runGCWorkers(workers, limiter, func(submit func(string) error) error {
+		return enumerateRepositories(ctx, namespace, submit)
+	}, func(name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		variantsPath, err := pathFor(variantsPathSpec{name: name})
+		if err != nil {
+			return err
+		}
+		algorithms, err := storageDriver.List(ctx, variantsPath)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				return nil
+			}
+			return err
+		}
+
+		for _, algorithmPath := range algorithms {
+			entries, err := storageDriver.List(ctx, algorithmPath)
+			if err != nil {
+				return err
+			}
+
+			for _, entryPath := range entries {
+				source := digest.NewDigestFromHex(path.Base(algorithmPath), path.Base(entryPath))
+				if _, ok := sources[source]; !ok {
+					continue
+				}
+
+				context.GetLogger(ctx).Debugf("deleting variants of %s in %s", source, name)
+				if err := storageDriver.Delete(ctx, entryPath); err != nil {
+					if _, ok := err.(driver.PathNotFoundError); !ok {
+						return fmt.Errorf("failed to delete variants of %s in %s: %v", source, name, err)
+					}
+				}
+				atomic.AddInt64(&swept, 1)
+			}
+		}
+		return nil
+	})
+
+	if err == nil {
+		context.GetLogger(ctx).Infof("gc: deleted the variants of %d blobs", atomic.LoadInt64(&swept))
+	}
+	return err
+}
+
+// runGCWorkers calls fn, from the given number of goroutines, with each item
+// submitted by produce, waiting for the limiter before each call. Once fn
+// fails, submit returns errGCStopped and the remaining items are skipped. The
+// first error of produce or fn is returned.
+func runGCWorkers(workers int, limiter *gcRateLimiter, produce func(submit func(string) error) error, fn func(string) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	items := make(chan string)
+	stop := make(chan struct{})
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+
+				limiter.wait()
+				if err := fn(item); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	err := produce(func(item string) error {
+		select {
+		case items <- item:
+			return nil
+		case <-stop:
+			return errGCStopped
+		}
+	})
+	close(items)
+	wg.Wait()
+
+	if err != nil && err != errGCStopped {
+		fail(err)
+	}
+	return firstErr
+}
+
+// everyInterval calls fn at each interval until the returned function is
+// called.
+func everyInterval(interval time.Duration, fn func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// gcRateLimiter spaces calls to wait evenly to stay within a rate. A nil
+// limiter does not limit.
+type gcRateLimiter struct {
+	ticker *time.Ticker
+}
+
+func newGCRateLimiter(rate float64) *gcRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval <= 0 {
+		return nil
+	}
+
+	return &gcRateLimiter{ticker: time.NewTicker(interval)}
+}
+
+func (l *gcRateLimiter) wait() {
+	if l != nil {
+		<-l.ticker.C
+	}
+}
+
+func (l *gcRateLimiter) stop() {
+	if l != nil {
+		l.ticker.Stop()
+	}
+}
+
+// gcCheckpoint is the progress of a mark phase, saved to the storage driver so
+// that an interrupted run can be resumed.
+type gcCheckpoint struct {
+	// Started is the time at which the run started.
+	Started time.Time `json:"started"`
+
+	// Repositories lists the repositories which were completely marked.
+	Repositories []string `json:"repositories"`
+
+	// Fingerprints holds the fingerprint of the manifest revisions of each
+	// of these repositories when it was marked.
+	Fingerprints map[string]digest.Digest `json:"fingerprints"`
+
+	// Marked lists the blobs referenced by these repositories.
+	Marked []digest.Digest `json:"marked"`
+}
+
+// changed returns the name of a repository whose manifest revisions changed
+// since it was marked, or which has no fingerprint, if any.
+func (checkpoint gcCheckpoint) changed(ctx context.Context, storageDriver driver.StorageDriver) (string, error) {
+	for _, name := range checkpoint.Repositories {
+		fingerprint, err := revisionsFingerprint(ctx, storageDriver, name)
+		if err != nil {
+			return "", err
+		}
+		if checkpoint.Fingerprints[name] != fingerprint {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// revisionsFingerprint returns a digest of the list of manifest revisions of
+// the named repository.
+func revisionsFingerprint(ctx context.Context, storageDriver driver.StorageDriver, name string) (digest.Digest, error) {
+	revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: name})
+	if err != nil {
+		return "", err
+	}
+
+	var revisions []string
+	algorithms, err := storageDriver.List(ctx, revisionsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return "", err
+		}
+	}
+	for _, algorithmPath := range algorithms {
+		entries, err := storageDriver.List(ctx, algorithmPath)
+		if err != nil {
+			return "", err
+		}
+		for _, entryPath := range entries {
+			revisions = append(revisions, path.Base(algorithmPath)+":"+path.Base(entryPath))
+		}
+	}
+
+	sort.Strings(revisions)
+	return digest.FromBytes([]byte(strings.Join(revisions, "\n"))), nil
+}
+
+func loadGCCheckpoint(ctx context.Context, storageDriver driver.StorageDriver) (gcCheckpoint, error) {
+	var checkpoint gcCheckpoint
+
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return checkpoint, err
+	}
+
+	p, err := storageDriver.GetContent(ctx, checkpointPath)
+	if err != nil {
+		return checkpoint, err
+	}
+
+	if err := json.Unmarshal(p, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return checkpoint, nil
+}
+
+// markState is the set of marked blobs and completed repositories of a mark
+// phase, which may be updated concurrently.
+type markState struct {
+	mu        sync.Mutex
+	started   time.Time
+	marked    map[digest.Digest]struct{}
+	completed map[string]digest.Digest
+}
+
+func newMarkState() *markState {
+	return &markState{
+		started:   time.Now(),
+		marked:    make(map[digest.Digest]struct{}),
+		completed: make(map[string]digest.Digest),
+	}
+}
+
+func (ms *markState) mark(dgst digest.Digest) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.marked[dgst] = struct{}{}
+}
+
+func (ms *markState) len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.marked)
+}
+
+// complete records the named repository as marked, with the fingerprint of
+// its manifest revisions.
+func (ms *markState) complete(name string, fingerprint digest.Digest) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.completed[name] = fingerprint
+}
+
+func (ms *markState) isComplete(name string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	_, ok := ms.completed[name]
+	return ok
+}
+
+// restore adds the progress recorded by a checkpoint.
+func (ms *markState) restore(checkpoint gcCheckpoint) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.started = checkpoint.Started
+	for _, name := range checkpoint.Repositories {
+		ms.completed[name] = checkpoint.Fingerprints[name]
+	}
+	for _, dgst := range checkpoint.Marked {
+		ms.marked[dgst] = struct{}{}
+	}
+}
+
+// save writes a checkpoint of the current progress.
+func (ms *markState) save(ctx context.Context, storageDriver driver.StorageDriver) error {
+	ms.mu.Lock()
+	checkpoint := gcCheckpoint{
+		Started:      ms.started,
+		Repositories: make([]string, 0, len(ms.completed)),
+		Fingerprints: make(map[string]digest.Digest, len(ms.completed)),
+		Marked:       make([]digest.Digest, 0, len(ms.marked)),
+	}
+	for name, fingerprint := range ms.completed {
+		checkpoint.Repositories = append(checkpoint.Repositories, name)
+		checkpoint.Fingerprints[name] = fingerprint
+	}
+	for dgst := range ms.marked {
+		checkpoint.Marked = append(checkpoint.Marked, dgst)
+	}
+	ms.mu.Unlock()
+
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return storageDriver.PutContent(ctx, checkpointPath, p)
+}
+
+// enumerateRepositories calls fn with the name of each repository in the
+// namespace.
+func enumerateRepositories(ctx context.Context, namespace distribution.Namespace, fn func(name string) error) error {
+	repos := make([]string, 100)
+	last := ""
+
+	for {
+		n, err := namespace.Repositories(ctx, repos, last)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		for _, name := range repos[:n] {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || n == 0 {
+			return nil
+		}
+		last = repos[n-1]
+	}
+}
+
+// markRepository marks the blobs referenced by each manifest revision of the
+// named repository.
+func markRepository(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, name string, marks *markState) error {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return fmt.Errorf("failed to parse repository name %s: %v", name, err)
+	}
+
+	repository, err := namespace.Repository(ctx, named)
+	if err != nil {
+		return fmt.Errorf("failed to construct repository %s: %v", name, err)
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to construct manifest service for %s: %v", name, err)
+	}
+
+	return enumerateManifestRevisions(ctx, storageDriver, name, func(revision, linked digest.Digest) error {
+		// The revision may be an alias for content stored under the
+		// canonical digest, which is the blob to keep.
+		marks.mark(linked)
+
+		manifest, err := manifestService.Get(ctx, revision)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest %s@%s: %v", name, revision, err)
+		}
+
+		for _, descriptor := range manifest.References() {
+			marks.mark(descriptor.Digest)
+		}
+
+		if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+			marks.mark(m.Config.Digest)
+		}
+
+		return markSignatures(ctx, storageDriver, name, revision, marks)
+	})
+}
+
+// markSignatures marks the signature blobs linked to a manifest revision.
+func markSignatures(ctx context.Context, storageDriver driver.StorageDriver, name string, revision digest.Digest, marks *markState) error {
+	signaturesPath, err := pathFor(manifestSignaturesPathSpec{
+		name:     name,
+		revision: revision,
+	})
+	if err != nil {
+		return err
+	}
+
+	return enumerateLinks(ctx, storageDriver, signaturesPath, func(_, linked digest.Digest) error {
+		marks.mark(linked)
+		return nil
+	})
+}
+
+// enumerateManifestRevisions calls fn with the digest of each manifest
+// revision of the named repository and the digest of the blob it links to.
+func enumerateManifestRevisions(ctx context.Context, storageDriver driver.StorageDriver, name string, fn func(revision, linked digest.Digest) error) error {
+	revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	return enumerateLinks(ctx, storageDriver, revisionsPath, fn)
+}
+
+// enumerateLinks calls fn for each link stored in the layout
+// <root>/<algorithm>/<hex digest>/link, with the digest of the directory and
+// the digest stored in the link. A missing root is treated as empty.
+func enumerateLinks(ctx context.Context, storageDriver driver.StorageDriver, root string, fn func(dgst, linked digest.Digest) error) error {
+	algorithms, err := storageDriver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, algorithmPath := range algorithms {
+		entries, err := storageDriver.List(ctx, algorithmPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entryPath := range entries {
+			dgst := digest.NewDigestFromHex(path.Base(algorithmPath), path.Base(entryPath))
+			if err := dgst.Validate(); err != nil {
+				context.GetLogger(ctx).Warnf("skipping invalid link directory %s: %v", entryPath, err)
+				continue
+			}
+
+			content, err := storageDriver.GetContent(ctx, path.Join(entryPath, "link"))
+			if err != nil {
+				if _, ok := err.(driver.PathNotFoundError); ok {
+					continue
+				}
+				return err
+			}
+
+			linked, err := digest.ParseDigest(string(content))
+			if err != nil {
+				return fmt.Errorf("invalid link %s: %v", entryPath, err)
+			}
+
+			if err := fn(dgst, linked); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// enumerateBlobs calls fn with the digest of each blob in the blob store, in
+// any layout.
+func enumerateBlobs(ctx context.Context, storageDriver driver.StorageDriver, fn func(dgst digest.Digest) error) error {
+	return walkBlobs(ctx, storageDriver, func(dgst digest.Digest, layout int) error {
+		return fn(dgst)
+	})
+}
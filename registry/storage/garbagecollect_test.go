@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestMarkAndSweep(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+
+	orphan, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("orphan"))
+	if err != nil {
+		t.Fatalf("unexpected error putting orphan: %v", err)
+	}
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifestDigest, err := ms.Put(ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	result, err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error running dry run: %v", err)
+	}
+
+	if result.Marked != 3 {
+		t.Fatalf("unexpected number of marked blobs: %d != 3", result.Marked)
+	}
+
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan.Digest {
+		t.Fatalf("unexpected blobs to delete: %v", result.Deleted)
+	}
+
+	if _, err := blobs.Stat(ctx, orphan.Digest); err != nil {
+		t.Fatalf("dry run must not delete blobs: %v", err)
+	}
+
+	result, err = MarkAndSweep(ctx, d, registry, GCOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan.Digest {
+		t.Fatalf("unexpected deleted blobs: %v", result.Deleted)
+	}
+
+	for _, dgst := range []digest.Digest{config.Digest, layer.Digest} {
+		if _, err := blobs.Get(ctx, dgst); err != nil {
+			t.Fatalf("referenced blob %s was removed: %v", dgst, err)
+		}
+	}
+
+	if _, err := ms.Get(ctx, manifestDigest); err != nil {
+		t.Fatalf("manifest %s was removed: %v", manifestDigest, err)
+	}
+
+	if _, err := blobs.Get(ctx, orphan.Digest); err == nil {
+		t.Fatalf("unreferenced blob %s was not removed", orphan.Digest)
+	}
+}
+
+// TestMarkAndSweepVariants checks that the variants of a layer are kept as
+// long as the layer, and deleted along with it.
+func TestMarkAndSweepVariants(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	variants := NewVariantStore(d, named)
+	var layers []distribution.Descriptor
+	for _, content := range []string{"layer", "orphan"} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(content))
+		gz.Close()
+
+		layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, buf.Bytes())
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		if _, err := variants.Recompress(ctx, layer.Digest, bytes.NewReader(buf.Bytes()), zstd.SpeedDefault); err != nil {
+			t.Fatalf("unexpected error recompressing layer: %v", err)
+		}
+		layers = append(layers, layer)
+	}
+	layer, orphan := layers[0], layers[1]
+
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, m); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	if _, err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true}); err != nil {
+		t.Fatalf("unexpected error running dry run: %v", err)
+	}
+	if _, err := variants.Stat(ctx, orphan.Digest); err != nil {
+		t.Fatalf("dry run must not delete variants: %v", err)
+	}
+
+	result, err := MarkAndSweep(ctx, d, registry, GCOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan.Digest {
+		t.Fatalf("unexpected deleted blobs: %v", result.Deleted)
+	}
+
+	if _, err := variants.Stat(ctx, layer.Digest); err != nil {
+		t.Fatalf("variant of referenced layer was removed: %v", err)
+	}
+	if _, err := variants.Stat(ctx, orphan.Digest); err != ErrVariantUnknown {
+		t.Fatalf("variant of deleted layer was not removed: %v", err)
+	}
+}
+
+// TestMarkAndSweepInventory checks that only the unreferenced blobs listed by
+// an inventory are deleted.
+func TestMarkAndSweepInventory(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	listed, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("listed"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	unlisted, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("unlisted"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	// The inventory may list blobs which were deleted since it was
+	// generated.
+	gone := digest.FromBytes([]byte("gone"))
+
+	var inventory []string
+	for _, dgst := range []digest.Digest{listed.Digest, gone} {
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inventory = append(inventory, fmt.Sprintf(`"bucket","root%s","1"`, blobPath))
+	}
+
+	inv, err := NewInventory(strings.NewReader(strings.Join(inventory, "\n")), InventoryFormatCSV)
+	if err != nil {
+		t.Fatalf("unexpected error creating inventory: %v", err)
+	}
+
+	result, err := MarkAndSweep(ctx, d, registry, GCOpts{Inventory: inv})
+	if err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+
+	if len(result.Deleted) != 2 || result.Deleted[0] != listed.Digest || result.Deleted[1] != gone {
+		t.Fatalf("unexpected deleted blobs: %v", result.Deleted)
+	}
+
+	if _, err := blobs.Get(ctx, listed.Digest); err == nil {
+		t.Fatalf("listed blob %s was not removed", listed.Digest)
+	}
+
+	if _, err := blobs.Get(ctx, unlisted.Digest); err != nil {
+		t.Fatalf("blob %s missing from the inventory was removed: %v", unlisted.Digest, err)
+	}
+}
+
+// TestMarkAndSweepWorkers checks that concurrent, rate limited runs mark every
+// repository and that an interrupted run resumes from its checkpoint.
+func TestMarkAndSweepWorkers(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	layers := make(map[string]digest.Digest)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("foo/repo%d", i)
+		named, _ := reference.ParseNamed(name)
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+
+		blobs := repo.Blobs(ctx)
+		config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte(fmt.Sprintf(`{"repo": %d}`, i)))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+
+		layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte(name))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		layers[name] = layer.Digest
+
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{layer},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+
+		ms, err := repo.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ms.Put(ctx, m); err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+	}
+
+	result, err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Workers: 4, RateLimit: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error running dry run: %v", err)
+	}
+
+	if result.Marked != 24 || len(result.Deleted) != 0 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+
+	// Simulate a run interrupted after marking foo/repo0. Its blobs are not
+	// marked again, so the resumed run finds its layer unreferenced.
+	marks := newMarkState()
+	fingerprint, err := revisionsFingerprint(ctx, d, "foo/repo0")
+	if err != nil {
+		t.Fatalf("unexpected error fingerprinting revisions: %v", err)
+	}
+	marks.complete("foo/repo0", fingerprint)
+	if err := marks.save(ctx, d); err != nil {
+		t.Fatalf("unexpected error saving checkpoint: %v", err)
+	}
+
+	result, err = MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Workers: 4, Resume: true})
+	if err != nil {
+		t.Fatalf("unexpected error resuming: %v", err)
+	}
+
+	if len(result.Deleted) != 3 || !containsDigest(result.Deleted, layers["foo/repo0"]) {
+		t.Fatalf("unexpected result of resumed run: %#v", result)
+	}
+
+	// A completed run removes its checkpoint.
+	if _, err := loadGCCheckpoint(ctx, d); err == nil {
+		t.Fatalf("checkpoint was not removed")
+	}
+
+	result, err = MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Resume: true})
+	if err != nil {
+		t.Fatalf("unexpected error resuming without checkpoint: %v", err)
+	}
+
+	if result.Marked != 24 || len(result.Deleted) != 0 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+
+	// A checkpoint is not resumed from once a repository it marked has a
+	// new manifest revision.
+	if err := marks.save(ctx, d); err != nil {
+		t.Fatalf("unexpected error saving checkpoint: %v", err)
+	}
+	named, _ := reference.ParseNamed("foo/repo0")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	layer, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte("new layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	config, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeConfig, []byte(`{"repo": "new"}`))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, m); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	result, err = MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Resume: true})
+	if err != nil {
+		t.Fatalf("unexpected error resuming changed run: %v", err)
+	}
+	if result.Marked != 27 || len(result.Deleted) != 0 {
+		t.Fatalf("unexpected result of run resumed after a change: %#v", result)
+	}
+
+	if _, err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Workers: -1}); err == nil {
+		t.Fatalf("expected a negative number of workers to be rejected")
+	}
+	if _, err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true, Workers: MaxGCWorkers + 1}); err != nil {
+		t.Fatalf("unexpected error running with too many workers: %v", err)
+	}
+}
+
+func containsDigest(digests []digest.Digest, dgst digest.Digest) bool {
+	for _, d := range digests {
+		if d == dgst {
+			return true
+		}
+	}
+	return false
+}
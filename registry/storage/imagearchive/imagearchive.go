@@ -0,0 +1,569 @@
+// Package imagearchive imports the images of an image archive into a
+// repository, so that registries can be bootstrapped from archives made
+// where no client can push to them.
+//
+// Two archive formats are supported: the archives written by `docker save`,
+// described by their manifest.json, and OCI image layouts, described by
+// their index.json. Archives written by recent versions of docker have both,
+// in which case manifest.json is used. Images are stored as schema2
+// manifests, and image indexes as manifest lists, so the digests of OCI
+// manifests are not preserved.
+package imagearchive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+)
+
+const (
+	// MediaTypeOCIManifest is the media type of OCI image manifests.
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	// MediaTypeOCIIndex is the media type of OCI image indexes.
+	MediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+
+	// MediaTypeOCIConfig is the media type of OCI image configurations.
+	MediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+)
+
+const (
+	// maxMetadataSize is the size of the largest manifest.json or
+	// index.json read from an archive.
+	maxMetadataSize = 4 << 20
+
+	// maxManifestSize is the size of the largest manifest or index of an
+	// OCI image layout read from an archive.
+	maxManifestSize = 4 << 20
+)
+
+// refNameAnnotations are the annotations of the manifests of an OCI index
+// naming the image, in order of preference.
+var refNameAnnotations = []string{
+	"org.opencontainers.image.ref.name",
+	"io.containerd.image.name",
+}
+
+// anchoredTagRegexp matches valid tags.
+var anchoredTagRegexp = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+
+// Image is an image imported from an archive.
+type Image struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Size      int64         `json:"size"`
+
+	// Tags are the tags of the repository pointing at the image.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// InvalidArchiveError is returned when an archive is not a valid docker save
+// archive or OCI image layout.
+type InvalidArchiveError struct {
+	Reason string
+}
+
+func (err InvalidArchiveError) Error() string {
+	return fmt.Sprintf("imagearchive: invalid archive: %s", err.Reason)
+}
+
+// Import stores the images of the archive read from r in repo, returning
+// them in the order of the archive. The images are tagged with the tags the
+// archive names them by, ignoring their repository, or with tag if not empty,
+// in which case the archive must hold a single image.
+//
+// The files of the archive are stored as blobs while it is read, so blobs of
+// an archive failing to import are left for garbage collection.
+func Import(ctx context.Context, repo distribution.Repository, r io.Reader, tag string) ([]Image, error) {
+	if tag != "" && !anchoredTagRegexp.MatchString(tag) {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid tag %q", tag)}
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archive{
+		ctx:       ctx,
+		repo:      repo,
+		blobs:     repo.Blobs(ctx),
+		manifests: manifests,
+		files:     make(map[string]file),
+		digests:   make(map[digest.Digest]file),
+	}
+	if err := a.read(r); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.manifest != nil:
+		return a.importDocker(tag)
+	case a.index != nil:
+		return a.importOCI(tag)
+	}
+	return nil, InvalidArchiveError{Reason: "neither manifest.json nor index.json found"}
+}
+
+// file is a file of an archive, stored as a blob.
+type file struct {
+	desc distribution.Descriptor
+
+	// magic holds the first bytes of the file, from which the compression
+	// of layers is detected.
+	magic []byte
+}
+
+type archive struct {
+	ctx       context.Context
+	repo      distribution.Repository
+	blobs     distribution.BlobStore
+	manifests distribution.ManifestService
+
+	// files are the files of the archive by path, digests by digest.
+	files   map[string]file
+	digests map[digest.Digest]file
+
+	// manifest and index are the content of manifest.json and index.json.
+	manifest []byte
+	index    []byte
+}
+
+// read stores the files of the archive as blobs, and reads its metadata.
+func (a *archive) read(r io.Reader) error {
+	links := make(map[string]string)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return InvalidArchiveError{Reason: err.Error()}
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if hdr.Typeflag == tar.TypeSymlink {
+			// docker save links the files of layers shared by
+			// several images.
+			links[name] = path.Join(path.Dir(name), hdr.Linkname)
+			continue
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		switch name {
+		case "manifest.json":
+			a.manifest, err = readMetadata(tr, name)
+		case "index.json":
+			a.index, err = readMetadata(tr, name)
+		case "oci-layout", "repositories":
+		default:
+			// The json and VERSION files of the layers of the
+			// legacy format are not referred to by manifest.json.
+			if base := path.Base(name); base == "json" || base == "VERSION" {
+				continue
+			}
+			var f file
+			if f, err = a.store(tr); err == nil {
+				a.files[name] = f
+				a.digests[f.desc.Digest] = f
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, target := range links {
+		if f, ok := a.files[target]; ok {
+			a.files[name] = f
+		}
+	}
+	return nil
+}
+
+// readMetadata reads the metadata file name of an archive.
+func readMetadata(r io.Reader, name string) ([]byte, error) {
+	p, err := ioutil.ReadAll(io.LimitReader(r, maxMetadataSize+1))
+	if err != nil {
+		return nil, InvalidArchiveError{Reason: err.Error()}
+	}
+	if len(p) > maxMetadataSize {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("%s exceeds %d bytes", name, maxMetadataSize)}
+	}
+	return p, nil
+}
+
+// store stores a file of the archive as a blob.
+func (a *archive) store(r io.Reader) (file, error) {
+	bw, err := a.blobs.Create(a.ctx)
+	if err != nil {
+		return file{}, err
+	}
+
+	digester := digest.Canonical.New()
+	magic := &magicWriter{}
+	src := &archiveReader{r: r}
+	n, err := io.Copy(io.MultiWriter(bw, digester.Hash(), magic), src)
+	if err != nil {
+		bw.Cancel(a.ctx)
+		if src.err != nil {
+			return file{}, InvalidArchiveError{Reason: src.err.Error()}
+		}
+		return file{}, err
+	}
+
+	desc, err := bw.Commit(a.ctx, distribution.Descriptor{
+		Digest: digester.Digest(),
+		Size:   n,
+	})
+	if err != nil {
+		return file{}, err
+	}
+	return file{desc: desc, magic: magic.p}, nil
+}
+
+// archiveReader keeps the error reading the archive, to tell it from errors
+// storing its files.
+type archiveReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *archiveReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// magicWriter keeps the first bytes written to it.
+type magicWriter struct {
+	p []byte
+}
+
+func (w *magicWriter) Write(p []byte) (int, error) {
+	if n := 4 - len(w.p); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.p = append(w.p, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// layerMediaType returns the media type of a layer of a docker save archive,
+// detecting its compression.
+func layerMediaType(f file) string {
+	switch {
+	case bytes.HasPrefix(f.magic, []byte{0x1f, 0x8b}):
+		return schema2.MediaTypeLayer
+	case bytes.HasPrefix(f.magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return schema2.MediaTypeLayerZstd
+	}
+	return schema2.MediaTypeUncompressedLayer
+}
+
+// dockerImage is an image of the manifest.json of a docker save archive.
+type dockerImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// importDocker imports the images of a docker save archive.
+func (a *archive) importDocker(tag string) ([]Image, error) {
+	var images []dockerImage
+	if err := json.Unmarshal(a.manifest, &images); err != nil {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid manifest.json: %v", err)}
+	}
+	if len(images) == 0 {
+		return nil, InvalidArchiveError{Reason: "no images in manifest.json"}
+	}
+	if tag != "" && len(images) != 1 {
+		return nil, InvalidArchiveError{Reason: "a tag may only be given for archives of a single image"}
+	}
+
+	imported := make([]Image, 0, len(images))
+	for _, image := range images {
+		config, err := a.file(image.Config)
+		if err != nil {
+			return nil, err
+		}
+		m := schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: schema2.MediaTypeConfig,
+				Size:      config.desc.Size,
+				Digest:    config.desc.Digest,
+			},
+		}
+		for _, name := range image.Layers {
+			layer, err := a.file(name)
+			if err != nil {
+				return nil, err
+			}
+			m.Layers = append(m.Layers, distribution.Descriptor{
+				MediaType: layerMediaType(layer),
+				Size:      layer.desc.Size,
+				Digest:    layer.desc.Digest,
+			})
+		}
+
+		manifest, err := schema2.FromStruct(m)
+		if err != nil {
+			return nil, err
+		}
+
+		tags := []string{tag}
+		if tag == "" {
+			tags = tagsOf(image.RepoTags...)
+		}
+		img, err := a.put(manifest, tags)
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, img)
+	}
+	return imported, nil
+}
+
+// file returns the file of the archive at name.
+func (a *archive) file(name string) (file, error) {
+	f, ok := a.files[path.Clean(strings.TrimPrefix(name, "/"))]
+	if !ok {
+		return file{}, InvalidArchiveError{Reason: fmt.Sprintf("%s not found", name)}
+	}
+	return f, nil
+}
+
+// tagsOf returns the distinct tags of the references, ignoring references
+// which are not tagged.
+func tagsOf(refs ...string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, s := range refs {
+		var tag string
+		if anchoredTagRegexp.MatchString(s) {
+			tag = s
+		} else if ref, err := reference.Parse(s); err == nil {
+			if tagged, ok := ref.(reference.Tagged); ok {
+				tag = tagged.Tag()
+			}
+		}
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ociDescriptor is a descriptor of an OCI image layout, with the fields of
+// descriptors not kept by distribution.Descriptor.
+type ociDescriptor struct {
+	MediaType   string                     `json:"mediaType"`
+	Size        int64                      `json:"size"`
+	Digest      digest.Digest              `json:"digest"`
+	Platform    *manifestlist.PlatformSpec `json:"platform,omitempty"`
+	Annotations map[string]string          `json:"annotations,omitempty"`
+}
+
+// ociIndex is an OCI image index, or a manifest list.
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest, or a schema2 manifest.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// importOCI imports the images of the index of an OCI image layout.
+func (a *archive) importOCI(tag string) ([]Image, error) {
+	var index ociIndex
+	if err := json.Unmarshal(a.index, &index); err != nil {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid index.json: %v", err)}
+	}
+	if len(index.Manifests) == 0 {
+		return nil, InvalidArchiveError{Reason: "no images in index.json"}
+	}
+	if tag != "" && len(index.Manifests) != 1 {
+		return nil, InvalidArchiveError{Reason: "a tag may only be given for archives of a single image"}
+	}
+
+	imported := make([]Image, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		manifest, err := a.convert(desc)
+		if err != nil {
+			return nil, err
+		}
+
+		tags := []string{tag}
+		if tag == "" {
+			var refs []string
+			for _, annotation := range refNameAnnotations {
+				if ref, ok := desc.Annotations[annotation]; ok {
+					refs = append(refs, ref)
+				}
+			}
+			tags = tagsOf(refs...)
+		}
+		img, err := a.put(manifest, tags)
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, img)
+	}
+	return imported, nil
+}
+
+// convert converts the manifest or index of an OCI image layout to a schema2
+// manifest or manifest list, storing the manifests of an index.
+func (a *archive) convert(desc ociDescriptor) (distribution.Manifest, error) {
+	content, err := a.content(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		var versioned struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err := json.Unmarshal(content, &versioned); err != nil {
+			return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid manifest %s: %v", desc.Digest, err)}
+		}
+		mediaType = versioned.MediaType
+	}
+
+	switch mediaType {
+	case MediaTypeOCIManifest, schema2.MediaTypeManifest:
+		var m ociManifest
+		if err := json.Unmarshal(content, &m); err != nil {
+			return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid manifest %s: %v", desc.Digest, err)}
+		}
+
+		config := m.Config
+		if config.MediaType == MediaTypeOCIConfig {
+			config.MediaType = schema2.MediaTypeConfig
+		}
+		if _, ok := a.digests[config.Digest]; !ok {
+			return nil, InvalidArchiveError{Reason: fmt.Sprintf("config %s not found", config.Digest)}
+		}
+		converted := schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: config.MediaType,
+				Size:      config.Size,
+				Digest:    config.Digest,
+			},
+		}
+		for _, layer := range m.Layers {
+			if _, ok := a.digests[layer.Digest]; !ok {
+				return nil, InvalidArchiveError{Reason: fmt.Sprintf("layer %s not found", layer.Digest)}
+			}
+			converted.Layers = append(converted.Layers, distribution.Descriptor{
+				MediaType: layer.MediaType,
+				Size:      layer.Size,
+				Digest:    layer.Digest,
+			})
+		}
+		return schema2.FromStruct(converted)
+
+	case MediaTypeOCIIndex, manifestlist.MediaTypeManifestList:
+		var index ociIndex
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, InvalidArchiveError{Reason: fmt.Sprintf("invalid index %s: %v", desc.Digest, err)}
+		}
+
+		var descriptors []manifestlist.ManifestDescriptor
+		for _, child := range index.Manifests {
+			manifest, err := a.convert(child)
+			if err != nil {
+				return nil, err
+			}
+			img, err := a.put(manifest, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			descriptor := manifestlist.ManifestDescriptor{
+				Descriptor: distribution.Descriptor{
+					MediaType: img.MediaType,
+					Size:      img.Size,
+					Digest:    img.Digest,
+				},
+			}
+			if child.Platform != nil {
+				descriptor.Platform = *child.Platform
+			}
+			descriptors = append(descriptors, descriptor)
+		}
+		return manifestlist.FromDescriptors(descriptors)
+	}
+
+	return nil, InvalidArchiveError{Reason: fmt.Sprintf("unsupported manifest media type %q", mediaType)}
+}
+
+// content returns the content of the blob of the archive described by desc.
+func (a *archive) content(desc ociDescriptor) ([]byte, error) {
+	f, ok := a.digests[desc.Digest]
+	if !ok {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("manifest %s not found", desc.Digest)}
+	}
+	if f.desc.Size > maxManifestSize {
+		return nil, InvalidArchiveError{Reason: fmt.Sprintf("manifest %s exceeds %d bytes", desc.Digest, maxManifestSize)}
+	}
+	return a.blobs.Get(a.ctx, desc.Digest)
+}
+
+// put stores the manifest and tags it with tags.
+func (a *archive) put(manifest distribution.Manifest, tags []string) (Image, error) {
+	dgst, err := a.manifests.Put(a.ctx, manifest)
+	if err != nil {
+		return Image{}, err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return Image{}, err
+	}
+
+	img := Image{
+		Digest:    dgst,
+		MediaType: mediaType,
+		Size:      int64(len(payload)),
+		Tags:      tags,
+	}
+	desc := distribution.Descriptor{
+		MediaType: img.MediaType,
+		Size:      img.Size,
+		Digest:    img.Digest,
+	}
+	for _, tag := range tags {
+		if err := a.repo.Tags(a.ctx).Tag(a.ctx, tag, desc); err != nil {
+			return Image{}, err
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,189 @@
+package imagearchive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// archiveFile is a file of a test archive.
+type archiveFile struct {
+	name    string
+	content []byte
+}
+
+func makeArchive(t *testing.T, files ...archiveFile) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func makeRepository(t *testing.T) (context.Context, distribution.Repository) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	name, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	return ctx, repo
+}
+
+func marshal(t *testing.T, v interface{}) []byte {
+	p, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestImportDockerArchive(t *testing.T) {
+	ctx, repo := makeRepository(t)
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := makeArchive(t, archiveFile{name: "etc/hostname", content: []byte("foo")}).Bytes()
+	archive := makeArchive(t,
+		archiveFile{name: "0123/layer.tar", content: layer},
+		archiveFile{name: "0123/json", content: []byte("{}")},
+		archiveFile{name: "0123/VERSION", content: []byte("1.0")},
+		archiveFile{name: "4567.json", content: config},
+		archiveFile{name: "manifest.json", content: marshal(t, []dockerImage{{
+			Config:   "4567.json",
+			RepoTags: []string{"example.com/other:v1", "other:latest"},
+			Layers:   []string{"0123/layer.tar"},
+		}})},
+	)
+
+	images, err := Import(ctx, repo, archive, "")
+	if err != nil {
+		t.Fatalf("unexpected error importing archive: %v", err)
+	}
+	if len(images) != 1 || len(images[0].Tags) != 2 || images[0].Tags[0] != "v1" || images[0].Tags[1] != "latest" {
+		t.Fatalf("unexpected images: %#v", images)
+	}
+
+	desc, err := repo.Tags(ctx).Get(ctx, "v1")
+	if err != nil || desc.Digest != images[0].Digest {
+		t.Fatalf("unexpected tag %v: %v", desc, err)
+	}
+	manifests, _ := repo.Manifests(ctx)
+	manifest, err := manifests.Get(ctx, images[0].Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	m := manifest.(*schema2.DeserializedManifest)
+	if m.Config.Digest != digest.FromBytes(config) {
+		t.Fatalf("unexpected config %v", m.Config)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].Digest != digest.FromBytes(layer) || m.Layers[0].MediaType != schema2.MediaTypeUncompressedLayer {
+		t.Fatalf("unexpected layers %v", m.Layers)
+	}
+}
+
+func TestImportOCIArchive(t *testing.T) {
+	ctx, repo := makeRepository(t)
+
+	config := []byte(`{"architecture":"arm64","os":"linux"}`)
+	layer := makeArchive(t, archiveFile{name: "etc/hostname", content: []byte("bar")}).Bytes()
+	manifest := marshal(t, ociManifest{
+		MediaType: MediaTypeOCIManifest,
+		Config:    ociDescriptor{MediaType: MediaTypeOCIConfig, Size: int64(len(config)), Digest: digest.FromBytes(config)},
+		Layers:    []ociDescriptor{{MediaType: schema2.MediaTypeOCILayer, Size: int64(len(layer)), Digest: digest.FromBytes(layer)}},
+	})
+	index := marshal(t, ociIndex{
+		MediaType: MediaTypeOCIIndex,
+		Manifests: []ociDescriptor{{
+			MediaType: MediaTypeOCIManifest,
+			Size:      int64(len(manifest)),
+			Digest:    digest.FromBytes(manifest),
+			Platform:  &manifestlist.PlatformSpec{Architecture: "arm64", OS: "linux"},
+		}},
+	})
+	blob := func(p []byte) archiveFile {
+		return archiveFile{name: "blobs/sha256/" + digest.FromBytes(p).Hex(), content: p}
+	}
+	archive := makeArchive(t,
+		archiveFile{name: "oci-layout", content: []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		blob(config),
+		blob(layer),
+		blob(manifest),
+		blob(index),
+		archiveFile{name: "index.json", content: marshal(t, ociIndex{
+			Manifests: []ociDescriptor{{
+				MediaType:   MediaTypeOCIIndex,
+				Size:        int64(len(index)),
+				Digest:      digest.FromBytes(index),
+				Annotations: map[string]string{"org.opencontainers.image.ref.name": "latest"},
+			}},
+		})},
+	)
+
+	images, err := Import(ctx, repo, archive, "v2")
+	if err != nil {
+		t.Fatalf("unexpected error importing archive: %v", err)
+	}
+	if len(images) != 1 || images[0].MediaType != manifestlist.MediaTypeManifestList || len(images[0].Tags) != 1 || images[0].Tags[0] != "v2" {
+		t.Fatalf("unexpected images: %#v", images)
+	}
+
+	manifests, _ := repo.Manifests(ctx)
+	list, err := manifests.Get(ctx, images[0].Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest list: %v", err)
+	}
+	ml := list.(*manifestlist.DeserializedManifestList)
+	if len(ml.Manifests) != 1 || ml.Manifests[0].Platform.Architecture != "arm64" || ml.Manifests[0].MediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected manifests %v", ml.Manifests)
+	}
+
+	image, err := manifests.Get(ctx, ml.Manifests[0].Digest)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	m := image.(*schema2.DeserializedManifest)
+	if m.Config.MediaType != schema2.MediaTypeConfig || len(m.Layers) != 1 || m.Layers[0].MediaType != schema2.MediaTypeOCILayer {
+		t.Fatalf("unexpected manifest %v", m.Manifest)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	ctx, repo := makeRepository(t)
+
+	for _, archive := range []*bytes.Buffer{
+		makeArchive(t, archiveFile{name: "foo", content: []byte("bar")}),
+		makeArchive(t, archiveFile{name: "manifest.json", content: marshal(t, []dockerImage{{
+			Config: "missing.json",
+		}})}),
+		bytes.NewBufferString("not an archive"),
+	} {
+		if _, err := Import(ctx, repo, archive, ""); err == nil {
+			t.Fatalf("expected an error importing an invalid archive")
+		} else if _, ok := err.(InvalidArchiveError); !ok {
+			t.Fatalf("unexpected error importing an invalid archive: %v", err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+)
+
+// InventoryFormat identifies the format of a bucket inventory.
+type InventoryFormat string
+
+const (
+	// InventoryFormatCSV is the CSV format of S3 inventory reports, with the
+	// bucket in the first column and the URL encoded key in the second.
+	// Files with a single column of keys are accepted as well.
+	InventoryFormatCSV InventoryFormat = "csv"
+
+	// InventoryFormatJSON is a stream of JSON objects with the key in the
+	// "key" field, one per line, as produced when listing a KODO bucket.
+	InventoryFormatJSON InventoryFormat = "json"
+)
+
+// Inventory enumerates the blobs of the blob store from a listing of the
+// bucket generated by the storage provider. Listing a large blob store
+// through the storage driver can take hours, while an inventory is read in
+// minutes.
+//
+// An inventory is a snapshot: blobs written after it was generated are not
+// listed and blobs deleted since may still be.
+type Inventory struct {
+	r      io.Reader
+	format InventoryFormat
+}
+
+// NewInventory returns an Inventory reading keys in the given format from r.
+// The inventory may be gzip compressed.
+func NewInventory(r io.Reader, format InventoryFormat) (*Inventory, error) {
+	switch format {
+	case InventoryFormatCSV, InventoryFormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q", format)
+	}
+
+	return &Inventory{r: r, format: format}, nil
+}
+
+// Enumerate calls fn with the digest of each blob listed in the inventory.
+// Keys which do not refer to blob data are ignored.
+func (inv *Inventory) Enumerate(ctx context.Context, fn func(dgst digest.Digest) error) error {
+	br := bufio.NewReader(inv.r)
+
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	root, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return err
+	}
+	// Keys are relative to the bucket and include the root directory of the
+	// storage driver, if any, before the blobs root.
+	root = strings.TrimPrefix(root, "/") + "/"
+
+	return inv.keys(r, func(key string) error {
+		i := strings.Index(key, root)
+		if i < 0 {
+			return nil
+		}
+
+		// <algorithm>/<hex bytes 0-1>/.../<hex digest>/data, with a level of
+		// grouping per layout version.
+		parts := strings.Split(key[i+len(root):], "/")
+		layout := len(parts) - 3
+		if layout < 1 || layout > MaxBlobPathLayout || parts[len(parts)-1] != "data" {
+			return nil
+		}
+
+		hex := parts[len(parts)-2]
+		if !strings.HasPrefix(hex, strings.Join(parts[1:1+layout], "")) {
+			return nil
+		}
+
+		dgst := digest.NewDigestFromHex(parts[0], hex)
+		if err := dgst.Validate(); err != nil {
+			context.GetLogger(ctx).Warnf("skipping invalid inventory key %s: %v", key, err)
+			return nil
+		}
+
+		return fn(dgst)
+	})
+}
+
+// keys calls fn with each key read from r.
+func (inv *Inventory) keys(r io.Reader, fn func(key string) error) error {
+	switch inv.format {
+	case InventoryFormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("error reading inventory: %v", err)
+			}
+
+			key := record[0]
+			if len(record) > 1 {
+				key = record[1]
+			}
+
+			if unescaped, err := url.QueryUnescape(key); err == nil {
+				key = unescaped
+			}
+
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+	case InventoryFormatJSON:
+		dec := json.NewDecoder(r)
+
+		for {
+			var entry struct {
+				Key string `json:"key"`
+			}
+			if err := dec.Decode(&entry); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("error reading inventory: %v", err)
+			}
+
+			if err := fn(entry.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fmt.Errorf("unknown inventory format %q", inv.format)
+}
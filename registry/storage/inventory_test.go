@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+)
+
+func TestInventoryEnumerate(t *testing.T) {
+	first := digest.FromBytes([]byte("first"))
+	second := digest.FromBytes([]byte("second"))
+
+	firstPath, err := pathFor(blobDataPathSpec{digest: first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPath, err := pathFor(blobDataPathSpec{digest: second, layout: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(`"bucket","registry` + firstPath + `","3"` + "\n" +
+		`"bucket","registry/docker/registry/v2/repositories/foo/_layers/sha256/ab/link","71"` + "\n" +
+		`"bucket","registry/docker/registry/v2/blobs/sha256/ab/abc/data","1"` + "\n" +
+		`"bucket","registry` + secondPath + `","6"` + "\n"))
+	gz.Close()
+
+	for _, testcase := range []struct {
+		format    InventoryFormat
+		inventory []byte
+	}{
+		{
+			format:    InventoryFormatCSV,
+			inventory: gzipped.Bytes(),
+		},
+		{
+			format:    InventoryFormatCSV,
+			inventory: []byte(firstPath[1:] + "\n" + secondPath[1:] + "\n"),
+		},
+		{
+			format: InventoryFormatJSON,
+			inventory: []byte(`{"key": "` + firstPath[1:] + `", "fsize": 5}` + "\n" +
+				`{"key": "uploads/data"}` + "\n" +
+				`{"key": "` + secondPath[1:] + `", "fsize": 6}` + "\n"),
+		},
+	} {
+		inv, err := NewInventory(bytes.NewReader(testcase.inventory), testcase.format)
+		if err != nil {
+			t.Fatalf("unexpected error creating %s inventory: %v", testcase.format, err)
+		}
+
+		var enumerated []digest.Digest
+		err = inv.Enumerate(context.Background(), func(dgst digest.Digest) error {
+			enumerated = append(enumerated, dgst)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error enumerating %s inventory: %v", testcase.format, err)
+		}
+
+		if expected := []digest.Digest{first, second}; !reflect.DeepEqual(enumerated, expected) {
+			t.Fatalf("unexpected blobs in %s inventory: %v != %v", testcase.format, enumerated, expected)
+		}
+	}
+
+	if _, err := NewInventory(bytes.NewReader(nil), "xml"); err == nil {
+		t.Fatalf("expected error creating inventory of unknown format")
+	}
+}
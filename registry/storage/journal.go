@@ -0,0 +1,366 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+)
+
+// journalSegmentSize is the size after which a journal writer starts a new
+// segment.
+const journalSegmentSize = 1 << 20
+
+// Actions recorded in the journal.
+const (
+	// JournalActionLink records that a link was written to point at a
+	// digest.
+	JournalActionLink = "link"
+
+	// JournalActionDelete records that a path, a link or a directory of
+	// links, was deleted.
+	JournalActionDelete = "delete"
+)
+
+// JournalEntry records a mutation of the repository metadata, written to the
+// journal once the mutation is applied.
+type JournalEntry struct {
+	// ID uniquely identifies the entry.
+	ID string `json:"id"`
+
+	// Time is when the entry was written.
+	Time time.Time `json:"time"`
+
+	// Action is JournalActionLink or JournalActionDelete.
+	Action string `json:"action"`
+
+	// Path is the storage driver path mutated.
+	Path string `json:"path"`
+
+	// Digest is the digest linked, for JournalActionLink.
+	Digest digest.Digest `json:"digest,omitempty"`
+
+	// Repository and Tag are the repository and, for tag links, the tag
+	// the path belongs to.
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+// after returns true if e is ordered after the entry with the given time and
+// id.
+func (e JournalEntry) after(t time.Time, id string) bool {
+	return e.Time.After(t) || e.Time.Equal(t) && e.ID > id
+}
+
+// journal appends entries to a segment of the append-only journal kept in the
+// storage backend. Each journal writes segments of its own, so that registry
+// instances sharing a backend never append to the same object. Segments are
+// named after the time they were started and the id of their journal, and a
+// journal starts a segment once done with the previous one.
+type journal struct {
+	driver driver.StorageDriver
+	id     string
+
+	mu      sync.Mutex
+	segment string
+	size    int64
+}
+
+// EnableJournal is a functional option for NewRegistry. It records tag
+// updates, link creations and deletions in the journal once applied.
+func EnableJournal(registry *registry) error {
+	registry.blobStore.journal = &journal{driver: registry.blobStore.driver, id: uuid.Generate().String()}
+	return nil
+}
+
+// record appends an entry for a mutation of path to the journal, once the
+// mutation succeeded, so that the journal only holds applied mutations. It
+// does nothing if the journal is not enabled.
+func (j *journal) record(ctx context.Context, action, p string, dgst digest.Digest) error {
+	if j == nil {
+		return nil
+	}
+
+	entry := JournalEntry{
+		ID:     uuid.Generate().String(),
+		Time:   time.Now().UTC(),
+		Action: action,
+		Path:   p,
+		Digest: dgst,
+	}
+	entry.Repository, entry.Tag = describeJournalPath(p)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.segment == "" || j.size >= journalSegmentSize {
+		segment, err := pathFor(journalSegmentPathSpec{
+			segment: fmt.Sprintf("%020d-%s", entry.Time.UnixNano(), j.id),
+		})
+		if err != nil {
+			return err
+		}
+		j.segment = segment
+		j.size = 0
+	}
+
+	if _, err := j.driver.WriteStream(ctx, j.segment, j.size, bytes.NewReader(line)); err != nil {
+		// A partial entry may have been written. Start a new segment, so
+		// that it remains the last line of this one.
+		j.segment = ""
+		return fmt.Errorf("unable to write journal entry: %v", err)
+	}
+	j.size += int64(len(line))
+	return nil
+}
+
+// describeJournalPath returns the repository and tag a repository path
+// belongs to.
+func describeJournalPath(p string) (repository, tag string) {
+	repoRoot, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil || !strings.HasPrefix(p, repoRoot+"/") {
+		return "", ""
+	}
+
+	rel := strings.TrimPrefix(p, repoRoot+"/")
+	for _, dir := range []string{"/_manifests/", "/_layers/", "/_uploads/", "/_trust/"} {
+		i := strings.Index(rel, dir)
+		if i < 0 {
+			continue
+		}
+
+		repository = rel[:i]
+		if rest := strings.TrimPrefix(rel[i:], "/_manifests/tags/"); rest != rel[i:] {
+			tag = strings.SplitN(rest, "/", 2)[0]
+		}
+		return repository, tag
+	}
+	return "", ""
+}
+
+// ReadJournal returns the journal entries ordered after the entry with the
+// given time and id, in order, up to limit entries if limit is positive.
+// Passing the time and id of the last entry returned reads the following
+// ones, allowing a consumer to tail the journal. Entries written by
+// instances whose clocks lag behind may be ordered before entries already
+// read.
+//
+// Only the segments which may hold the entries returned are read: of the
+// segments started before since, the last one of each journal, and the
+// segments started since, in order, until the entries to return are known.
+func ReadJournal(ctx context.Context, storageDriver driver.StorageDriver, since time.Time, after string, limit int) ([]JournalEntry, error) {
+	root, err := pathFor(journalPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := storageDriver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(segments)
+
+	var started, following []string
+	last := make(map[string]int)
+	for _, segment := range segments {
+		start, id := parseJournalSegment(segment)
+		if start.After(since) {
+			following = append(following, segment)
+			continue
+		}
+		if i, ok := last[id]; ok {
+			started[i] = segment
+			continue
+		}
+		last[id] = len(started)
+		started = append(started, segment)
+	}
+
+	var entries []JournalEntry
+	read := func(segment string) error {
+		segmentEntries, err := readJournalSegment(ctx, storageDriver, segment)
+		if err != nil {
+			return err
+		}
+		for _, entry := range segmentEntries {
+			if entry.after(since, after) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	}
+
+	// Segments last modified before since hold no entries after it.
+	infos, errs := driver.StatMany(ctx, storageDriver, started)
+	for i, segment := range started {
+		if errs[i] != nil {
+			if _, ok := errs[i].(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, errs[i]
+		}
+		if infos[i].ModTime().Before(since) {
+			continue
+		}
+		if err := read(segment); err != nil {
+			return nil, err
+		}
+	}
+
+	// A segment only holds entries written after it was started, so the
+	// following segments are not read once limit entries written before
+	// are found.
+	for _, segment := range following {
+		if limit > 0 && len(entries) >= limit {
+			sort.Sort(journalEntries(entries))
+			entries = entries[:limit]
+			if start, _ := parseJournalSegment(segment); entries[limit-1].Time.Before(start) {
+				break
+			}
+		}
+		if err := read(segment); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Sort(journalEntries(entries))
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// parseJournalSegment returns the time a journal segment was started and the
+// id of the journal which wrote it. Segments whose name cannot be parsed are
+// considered started at the zero time, by a journal of their own.
+func parseJournalSegment(segment string) (time.Time, string) {
+	name := path.Base(segment)
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) != 2 {
+		return time.Time{}, name
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, name
+	}
+	return time.Unix(0, nanos).UTC(), parts[1]
+}
+
+// readJournalSegment returns the entries of a journal segment, skipping a
+// partially written last entry.
+func readJournalSegment(ctx context.Context, storageDriver driver.StorageDriver, segment string) ([]JournalEntry, error) {
+	rc, err := storageDriver.ReadStream(ctx, segment, 0)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rc.Close()
+
+	var entries []JournalEntry
+	r := bufio.NewReader(rc)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			context.GetLogger(ctx).Warnf("journal: skipping malformed entry in %s: %v", segment, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type journalEntries []JournalEntry
+
+func (e journalEntries) Len() int      { return len(e) }
+func (e journalEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e journalEntries) Less(i, j int) bool {
+	return e[j].after(e[i].Time, e[i].ID)
+}
+
+// RecoverJournal applies the journal entries written since the given time
+// whose mutation is missing from the backend, such as mutations lost when the
+// backend was restored from a backup. Entries are only written once their
+// mutation succeeded, so only mutations which were applied are replayed.
+// Only the last entry for each path is considered. It returns the number of
+// mutations applied.
+func RecoverJournal(ctx context.Context, storageDriver driver.StorageDriver, since time.Time) (int, error) {
+	entries, err := ReadJournal(ctx, storageDriver, since, "", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	last := make(map[string]JournalEntry)
+	for _, entry := range entries {
+		last[entry.Path] = entry
+	}
+
+	paths := make([]string, 0, len(last))
+	for p := range last {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	applied := 0
+	for _, p := range paths {
+		entry := last[p]
+		switch entry.Action {
+		case JournalActionLink:
+			content, err := storageDriver.GetContent(ctx, p)
+			if err == nil && string(content) == string(entry.Digest) {
+				continue
+			}
+			if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+				return applied, err
+			}
+			if err := storageDriver.PutContent(ctx, p, []byte(entry.Digest)); err != nil {
+				return applied, err
+			}
+		case JournalActionDelete:
+			err := storageDriver.Delete(ctx, p)
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			if err != nil {
+				return applied, err
+			}
+		default:
+			context.GetLogger(ctx).Warnf("journal: skipping entry %s with unknown action %q", entry.ID, entry.Action)
+			continue
+		}
+
+		context.GetLogger(ctx).Infof("journal: applied %s of %s from entry %s", entry.Action, p, entry.ID)
+		applied++
+	}
+	return applied, nil
+}
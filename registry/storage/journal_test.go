@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestJournalRecordsTagMutations(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	reg, err := NewRegistry(ctx, d, EnableJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repoRef, _ := reference.ParseNamed("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	dgst := digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadJournal(ctx, d, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag is linked into its index, then its current link is written,
+	// then the tag is deleted.
+	expected := []string{JournalActionLink, JournalActionLink, JournalActionDelete}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected journal entries: %#v", entries)
+	}
+	for i, entry := range entries {
+		if entry.Action != expected[i] {
+			t.Fatalf("entry %d: expected action %q, got %q", i, expected[i], entry.Action)
+		}
+		if entry.Repository != "a/b" || entry.Tag != "latest" {
+			t.Fatalf("entry %d: unexpected repository and tag: %q, %q", i, entry.Repository, entry.Tag)
+		}
+	}
+	if entries[1].Digest != dgst {
+		t.Fatalf("unexpected digest linked: %v", entries[1].Digest)
+	}
+
+	// Reading after an entry returns the following ones.
+	rest, err := ReadJournal(ctx, d, entries[0].Time, entries[0].ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].ID != entries[1].ID {
+		t.Fatalf("unexpected entries after the first: %#v", rest)
+	}
+}
+
+func TestRecoverJournal(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	j := &journal{driver: d, id: "test"}
+
+	linkPath, err := pathFor(manifestTagCurrentPathSpec{name: "a/b", tag: "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletedPath, err := pathFor(manifestTagPathSpec{name: "a/b", tag: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mutations lost when the backend was restored from a backup.
+	dgst := digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	if err := j.record(ctx, JournalActionLink, linkPath, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(ctx, deletedPath+"/current/link", []byte(dgst)); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.record(ctx, JournalActionDelete, deletedPath, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := RecoverJournal(ctx, d, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Fatalf("expected 2 mutations applied, got %d", applied)
+	}
+
+	content, err := d.GetContent(ctx, linkPath)
+	if err != nil || string(content) != string(dgst) {
+		t.Fatalf("expected link to be written: %q, %v", content, err)
+	}
+	if _, err := d.Stat(ctx, deletedPath); err == nil {
+		t.Fatalf("expected tag to be deleted")
+	}
+
+	// Recovering again finds nothing missing.
+	applied, err = RecoverJournal(ctx, d, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 0 {
+		t.Fatalf("expected no mutations applied, got %d", applied)
+	}
+}
+
+// failingDeleteDriver fails every deletion.
+type failingDeleteDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (d *failingDeleteDriver) Delete(ctx context.Context, path string) error {
+	return errors.New("delete failed")
+}
+
+// TestJournalSkipsFailedMutations checks that mutations which failed are not
+// journaled, so that a recovery does not apply them.
+func TestJournalSkipsFailedMutations(t *testing.T) {
+	ctx := context.Background()
+	d := &failingDeleteDriver{StorageDriver: inmemory.New()}
+	reg, err := NewRegistry(ctx, d, EnableJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repoRef, _ := reference.ParseNamed("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	dgst := digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Untag(ctx, "latest"); err == nil {
+		t.Fatalf("expected the deletion of the tag to fail")
+	}
+
+	entries, err := ReadJournal(ctx, d, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Action != JournalActionLink {
+			t.Fatalf("unexpected entry of a failed mutation: %#v", entry)
+		}
+	}
+
+	applied, err := RecoverJournal(ctx, d.StorageDriver, time.Time{})
+	if err != nil || applied != 0 {
+		t.Fatalf("expected no mutations applied, got %d, %v", applied, err)
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != dgst {
+		t.Fatalf("expected the tag to remain: %v, %v", desc, err)
+	}
+}
+
+// readStreamCountingDriver counts the ReadStream calls made to a driver,
+// which read journal segments.
+type readStreamCountingDriver struct {
+	storagedriver.StorageDriver
+	reads int
+}
+
+func (d *readStreamCountingDriver) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	d.reads++
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+// TestReadJournalTail checks that tailing the journal an entry at a time
+// returns every entry in order, reading only the segments which may hold the
+// next one.
+func TestReadJournalTail(t *testing.T) {
+	ctx := context.Background()
+	d := &readStreamCountingDriver{StorageDriver: inmemory.New()}
+	journals := []*journal{{driver: d, id: "a"}, {driver: d, id: "b"}}
+
+	var paths []string
+	for i := 0; i < 8; i++ {
+		p, err := pathFor(manifestTagCurrentPathSpec{name: "a/b", tag: string('a' + rune(i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+
+		// Each entry starts a segment, alternating between journals.
+		j := journals[i%len(journals)]
+		j.segment = ""
+		if err := j.record(ctx, JournalActionDelete, p, ""); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var since time.Time
+	var after string
+	for i := range paths {
+		d.reads = 0
+		entries, err := ReadJournal(ctx, d, since, after, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Path != paths[i] {
+			t.Fatalf("entry %d: unexpected entries: %#v", i, entries)
+		}
+		if d.reads > 2 {
+			t.Fatalf("entry %d: %d segments read", i, d.reads)
+		}
+		since, after = entries[0].Time, entries[0].ID
+	}
+
+	entries, err := ReadJournal(ctx, d, since, after, 1)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected entries after the last: %#v, %v", entries, err)
+	}
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrLayerIndexUnknown is returned when no index of a layer is stored.
+	ErrLayerIndexUnknown = errors.New("layer index unknown")
+
+	// ErrNotLayer is returned when indexing a blob which is not a tar
+	// archive, compressed with gzip or zstd or uncompressed.
+	ErrNotLayer = errors.New("blob is not a layer")
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// LayerIndex lists the files of a layer, so that they can be browsed or
+// searched without downloading the layer.
+type LayerIndex struct {
+	// Digest is the digest of the layer.
+	Digest digest.Digest `json:"digest"`
+
+	// Files lists the entries of the layer, in their order in the archive.
+	Files []LayerFile `json:"files"`
+}
+
+// LayerFile describes an entry of the tar archive of a layer. Whiteout files,
+// marking the deletion of files of lower layers, are listed as stored.
+type LayerFile struct {
+	// Path is the path of the entry, relative to the root of the image
+	// file system.
+	Path string `json:"path"`
+
+	// Type is one of "file", "dir", "symlink", "hardlink", "char", "block",
+	// "fifo" or "other".
+	Type string `json:"type"`
+
+	Size    int64     `json:"size"`
+	Mode    int64     `json:"mode"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	ModTime time.Time `json:"modtime"`
+
+	// Linkname is the target of symbolic links, or the path of the file
+	// hard links refer to.
+	Linkname string `json:"linkname,omitempty"`
+}
+
+// LayerIndexStore keeps the indexes of the files of the layers of a
+// repository, alongside the repository in the storage backend. An index is
+// derived from its layer, so it is computed once and kept until the
+// repository is deleted.
+type LayerIndexStore struct {
+	driver storagedriver.StorageDriver
+	name   string
+}
+
+// NewLayerIndexStore returns a LayerIndexStore for the indexes of the layers
+// of the named repository.
+func NewLayerIndexStore(driver storagedriver.StorageDriver, name reference.Named) *LayerIndexStore {
+	return &LayerIndexStore{
+		driver: driver,
+		name:   name.Name(),
+	}
+}
+
+// Get returns the index of the layer dgst.
+func (ls *LayerIndexStore) Get(ctx context.Context, dgst digest.Digest) (LayerIndex, error) {
+	dataPath, err := pathFor(layerIndexPathSpec{name: ls.name, digest: dgst})
+	if err != nil {
+		return LayerIndex{}, err
+	}
+
+	content, err := ls.driver.GetContent(ctx, dataPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return LayerIndex{}, ErrLayerIndexUnknown
+		}
+		return LayerIndex{}, err
+	}
+
+	var index LayerIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		return LayerIndex{}, err
+	}
+	return index, nil
+}
+
+// Put indexes and stores the files of the layer dgst, whose content is read
+// from source, and returns the index. ErrNotLayer is returned if the content
+// is not a tar archive. The index is written aside and moved in place once
+// complete, so that it is never read partially.
+func (ls *LayerIndexStore) Put(ctx context.Context, dgst digest.Digest, source io.Reader) (LayerIndex, error) {
+	dataPath, err := pathFor(layerIndexPathSpec{name: ls.name, digest: dgst})
+	if err != nil {
+		return LayerIndex{}, err
+	}
+
+	files, err := indexLayer(source)
+	if err != nil {
+		return LayerIndex{}, err
+	}
+	index := LayerIndex{Digest: dgst, Files: files}
+
+	content, err := json.Marshal(index)
+	if err != nil {
+		return LayerIndex{}, err
+	}
+
+	tempPath := dataPath + "." + uuid.Generate().String()
+	err = ls.driver.PutContent(ctx, tempPath, content)
+	if err == nil {
+		err = ls.driver.Move(ctx, tempPath, dataPath)
+	}
+	if err != nil {
+		if err := ls.driver.Delete(ctx, tempPath); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				context.GetLogger(ctx).Errorf("error deleting partial layer index %s: %v", tempPath, err)
+			}
+		}
+		return LayerIndex{}, err
+	}
+	return index, nil
+}
+
+// sourceReader records the errors of the reads of the content of a layer, to
+// tell them from the errors of its decompression and of its archive.
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (sr *sourceReader) Read(p []byte) (int, error) {
+	n, err := sr.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
+
+// indexLayer lists the entries of the tar archive read from source, which may
+// be compressed with gzip or zstd.
+func indexLayer(source io.Reader) ([]LayerFile, error) {
+	sr := &sourceReader{Reader: source}
+	br := bufio.NewReader(sr)
+
+	// Errors are reported by the reads of the archive below.
+	magic, _ := br.Peek(len(zstdMagic))
+
+	var r io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			if sr.err != nil {
+				return nil, sr.err
+			}
+			return nil, ErrNotLayer
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		r = dec
+	}
+
+	files := []LayerFile{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			if sr.err != nil {
+				return nil, sr.err
+			}
+			return nil, ErrNotLayer
+		}
+		name := layerFilePath(hdr.Name)
+		if hdr.Typeflag == tar.TypeXGlobalHeader || name == "" {
+			// Global headers and the root directory are not files.
+			continue
+		}
+
+		linkname := hdr.Linkname
+		if hdr.Typeflag == tar.TypeLink {
+			linkname = layerFilePath(linkname)
+		}
+		files = append(files, LayerFile{
+			Path:     name,
+			Type:     layerFileType(hdr.Typeflag),
+			Size:     hdr.Size,
+			Mode:     hdr.Mode & 07777,
+			UID:      hdr.Uid,
+			GID:      hdr.Gid,
+			ModTime:  hdr.ModTime.UTC(),
+			Linkname: linkname,
+		})
+	}
+}
+
+// layerFilePath returns the path of an entry of the archive of a layer,
+// relative to the root of the image file system.
+func layerFilePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// layerFileType returns the type of an entry of the archive of a layer.
+func layerFileType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	return "other"
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestLayerIndexStore(t *testing.T) {
+	ctx := context.Background()
+	name, _ := reference.ParseNamed("a/b")
+	ls := NewLayerIndexStore(inmemory.New(), name)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, hdr := range []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime},
+		{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime},
+		{Name: "./etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 5, ModTime: modTime},
+		{Name: "./bin/sh", Typeflag: tar.TypeSymlink, Linkname: "/bin/busybox", Mode: 0777, ModTime: modTime},
+		{Name: "./etc/passwd.bak", Typeflag: tar.TypeLink, Linkname: "./etc/passwd", ModTime: modTime},
+		{Name: "./tmp/.wh.old", Typeflag: tar.TypeReg, Uid: 1000, Gid: 1000, ModTime: modTime},
+	} {
+		tw.WriteHeader(hdr)
+		if hdr.Size > 0 {
+			tw.Write([]byte("root\n"))
+		}
+	}
+	tw.Close()
+
+	expected := []LayerFile{
+		{Path: "etc", Type: "dir", Mode: 0755, ModTime: modTime},
+		{Path: "etc/passwd", Type: "file", Size: 5, Mode: 0644, ModTime: modTime},
+		{Path: "bin/sh", Type: "symlink", Mode: 0777, ModTime: modTime, Linkname: "/bin/busybox"},
+		{Path: "etc/passwd.bak", Type: "hardlink", ModTime: modTime, Linkname: "etc/passwd"},
+		{Path: "tmp/.wh.old", Type: "file", UID: 1000, GID: 1000, ModTime: modTime},
+	}
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(archive.Bytes())
+	gz.Close()
+
+	var zstded bytes.Buffer
+	enc, _ := zstd.NewWriter(&zstded)
+	enc.Write(archive.Bytes())
+	enc.Close()
+
+	for _, layer := range [][]byte{archive.Bytes(), gzipped.Bytes(), zstded.Bytes()} {
+		dgst := digest.FromBytes(layer)
+		if _, err := ls.Get(ctx, dgst); err != ErrLayerIndexUnknown {
+			t.Fatalf("expected unknown layer index, got %v", err)
+		}
+
+		index, err := ls.Put(ctx, dgst, bytes.NewReader(layer))
+		if err != nil {
+			t.Fatalf("unexpected error indexing layer: %v", err)
+		}
+		stored, err := ls.Get(ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error getting layer index: %v", err)
+		}
+
+		for _, index := range []LayerIndex{index, stored} {
+			if index.Digest != dgst || len(index.Files) != len(expected) {
+				t.Fatalf("unexpected layer index: %+v", index)
+			}
+			for i, file := range index.Files {
+				if file != expected[i] {
+					t.Fatalf("unexpected file %d: %+v != %+v", i, file, expected[i])
+				}
+			}
+		}
+	}
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	if _, err := ls.Put(ctx, digest.FromBytes(config), bytes.NewReader(config)); err != ErrNotLayer {
+		t.Fatalf("expected an image configuration not to be a layer, got %v", err)
+	}
+	if _, err := ls.Get(ctx, digest.FromBytes(config)); err != ErrLayerIndexUnknown {
+		t.Fatalf("expected no index of a blob which is not a layer, got %v", err)
+	}
+
+	// Errors reading the layer are not mistaken for invalid archives.
+	readErr := errors.New("read error")
+	truncated := io.MultiReader(bytes.NewReader(gzipped.Bytes()[:20]), &errorReader{err: readErr})
+	if _, err := ls.Put(ctx, digest.FromBytes(gzipped.Bytes()), truncated); err != readErr {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+}
+
+type errorReader struct {
+	err error
+}
+
+func (er *errorReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	// DefaultBlobPathLayout is the blob store layout version used unless
+	// another is configured. It groups blobs by the first two hex bytes of
+	// their digest.
+	DefaultBlobPathLayout = 1
+
+	// MaxBlobPathLayout is the highest supported blob store layout version.
+	// Each version above the default groups blobs by two more hex bytes of
+	// their digest, spreading listings over more prefixes.
+	MaxBlobPathLayout = 3
+)
+
+// blobPathLayout describes the layout version blobs are written to, and the
+// layout versions they are also read from while the blob store is migrated
+// from one layout to another.
+type blobPathLayout struct {
+	version    int
+	compatible []int
+}
+
+// path returns the path of the data of the blob identified by dgst in the
+// current layout.
+func (l blobPathLayout) path(dgst digest.Digest) (string, error) {
+	return pathFor(blobDataPathSpec{
+		digest: dgst,
+		layout: l.version,
+	})
+}
+
+// stat returns the path and FileInfo of the data of the blob identified by
+// dgst, in the current layout or, failing that, in the first compatible
+// layout holding it. A PathNotFoundError for the current path is returned if
+// no layout holds the blob.
+func (l blobPathLayout) stat(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) (string, driver.FileInfo, error) {
+	current, err := l.path(dgst)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fi, err := storageDriver.Stat(ctx, current)
+	if _, ok := err.(driver.PathNotFoundError); !ok || len(l.compatible) == 0 {
+		return current, fi, err
+	}
+
+	for _, version := range l.compatible {
+		p, err := pathFor(blobDataPathSpec{digest: dgst, layout: version})
+		if err != nil {
+			return "", nil, err
+		}
+
+		fi, err := storageDriver.Stat(ctx, p)
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			continue
+		}
+		return p, fi, err
+	}
+
+	return current, nil, driver.PathNotFoundError{Path: current}
+}
+
+// BlobPathLayout returns a functional option for NewRegistry. It sets the
+// layout version of the blob store blobs are written to. Blobs not found in
+// that layout are also read from the compatible layout versions, in order,
+// allowing the blob store to be migrated with MigrateBlobPathLayout while the
+// registry is serving.
+func BlobPathLayout(version int, compatible ...int) RegistryOption {
+	return func(registry *registry) error {
+		for _, v := range append([]int{version}, compatible...) {
+			if v < 1 || v > MaxBlobPathLayout {
+				return fmt.Errorf("unknown blob path layout version %d", v)
+			}
+		}
+
+		layout := blobPathLayout{version: version}
+		for _, v := range compatible {
+			if v != version {
+				layout.compatible = append(layout.compatible, v)
+			}
+		}
+
+		registry.blobStore.layout = layout
+		registry.statter.layout = layout
+		return nil
+	}
+}
+
+// walkBlobs calls fn with the digest of each blob in the blob store and the
+// layout version it is stored in. A blob stored in several layouts is
+// reported once per layout.
+func walkBlobs(ctx context.Context, storageDriver driver.StorageDriver, fn func(dgst digest.Digest, layout int) error) error {
+	root, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	algorithms, err := storageDriver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, algorithmPath := range algorithms {
+		if err := walkBlobPrefix(ctx, storageDriver, path.Base(algorithmPath), algorithmPath, 0, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkBlobPrefix walks the blobs below dir, which is depth levels of
+// grouping below the directory of the algorithm. Directories named by two hex
+// bytes group blobs, any other directory is that of a blob.
+func walkBlobPrefix(ctx context.Context, storageDriver driver.StorageDriver, algorithm, dir string, depth int, fn func(dgst digest.Digest, layout int) error) error {
+	children, err := storageDriver.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		name := path.Base(child)
+		if len(name) == 2 && depth < MaxBlobPathLayout {
+			if err := walkBlobPrefix(ctx, storageDriver, algorithm, child, depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dgst := digest.NewDigestFromHex(algorithm, name)
+		if err := dgst.Validate(); err != nil {
+			context.GetLogger(ctx).Warnf("skipping invalid blob directory %s: %v", child, err)
+			continue
+		}
+		if depth == 0 {
+			context.GetLogger(ctx).Warnf("skipping blob directory %s outside of any layout", child)
+			continue
+		}
+
+		if err := fn(dgst, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LayoutMigrationResult reports the blobs moved by MigrateBlobPathLayout.
+type LayoutMigrationResult struct {
+	// Migrated is the number of blobs copied to the target layout.
+	Migrated int
+
+	// Skipped is the number of blobs only removed from their layout
+	// because they were already present in the target layout.
+	Skipped int
+}
+
+// MigrateBlobPathLayout moves every blob of the blob store to the given
+// layout version. Registries serving during the migration must read the
+// layouts being migrated from, see BlobPathLayout. Each blob is copied to the
+// target layout, on the storage provider if the driver supports it, where
+// registries read it from once the copy is complete, and only then removed
+// from its previous layout, so that an interrupted migration loses no blob. A
+// blob already present in the target layout with the size of its source is
+// removed from the others, a partial copy left by an interrupted migration is
+// copied again. A dry run only counts the blobs to migrate. The migration
+// stops once ctx is canceled, and can be run again to move the remaining
+// blobs.
+func MigrateBlobPathLayout(ctx context.Context, storageDriver driver.StorageDriver, version int, dryRun bool) (LayoutMigrationResult, error) {
+	var result LayoutMigrationResult
+
+	if version < 1 || version > MaxBlobPathLayout {
+		return result, fmt.Errorf("unknown blob path layout version %d", version)
+	}
+
+	err := walkBlobs(ctx, storageDriver, func(dgst digest.Digest, layout int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if layout == version {
+			return nil
+		}
+
+		source, err := pathFor(blobDataPathSpec{digest: dgst, layout: layout})
+		if err != nil {
+			return err
+		}
+		dest, err := pathFor(blobDataPathSpec{digest: dgst, layout: version})
+		if err != nil {
+			return err
+		}
+
+		sourceInfo, err := storageDriver.Stat(ctx, source)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// A blob directory without data has nothing to
+				// migrate.
+				return nil
+			}
+			return err
+		}
+
+		destInfo, err := storageDriver.Stat(ctx, dest)
+		switch err.(type) {
+		case nil:
+			if destInfo.Size() == sourceInfo.Size() {
+				result.Skipped++
+				if dryRun {
+					return nil
+				}
+				context.GetLogger(ctx).Infof("layout: removing %s, already present at %s", source, dest)
+				return removeBlobDir(ctx, storageDriver, source)
+			}
+			context.GetLogger(ctx).Warnf("layout: %s is a partial copy of %s, copying again", dest, source)
+		case driver.PathNotFoundError:
+		default:
+			return err
+		}
+
+		result.Migrated++
+		if dryRun {
+			return nil
+		}
+
+		context.GetLogger(ctx).Infof("layout: copying %s to %s", source, dest)
+		if err := driver.Copy(ctx, storageDriver, source, dest); err != nil {
+			return fmt.Errorf("failed to copy blob %s: %v", dgst, err)
+		}
+
+		destInfo, err = storageDriver.Stat(ctx, dest)
+		if err != nil {
+			return fmt.Errorf("failed to verify the copy of blob %s: %v", dgst, err)
+		}
+		if destInfo.Size() != sourceInfo.Size() {
+			return fmt.Errorf("failed to copy blob %s: copied %d bytes of %d", dgst, destInfo.Size(), sourceInfo.Size())
+		}
+
+		return removeBlobDir(ctx, storageDriver, source)
+	})
+
+	return result, err
+}
+
+// removeBlobDir removes the directory of the blob data at dataPath, which
+// object stores may have removed already with the data.
+func removeBlobDir(ctx context.Context, storageDriver driver.StorageDriver, dataPath string) error {
+	err := storageDriver.Delete(ctx, path.Dir(dataPath))
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
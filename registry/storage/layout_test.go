@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestMigrateBlobPathLayout(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	named, _ := reference.ParseNamed("foo/bar")
+
+	registry, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	content := []byte("layer")
+	desc, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	if _, err := NewRegistry(ctx, d, BlobPathLayout(MaxBlobPathLayout+1)); err == nil {
+		t.Fatalf("expected unknown layout version to be rejected")
+	}
+
+	// A registry writing to layout 2 reads blobs not yet migrated from
+	// layout 1.
+	migrating, err := NewRegistry(ctx, d, BlobPathLayout(2, 1))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repo, err = migrating.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	checkBlob := func() {
+		p, err := repo.Blobs(ctx).Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error getting blob: %v", err)
+		}
+		if !bytes.Equal(p, content) {
+			t.Fatalf("unexpected blob content: %q != %q", p, content)
+		}
+	}
+	checkBlob()
+
+	result, err := MigrateBlobPathLayout(ctx, d, 2, true)
+	if err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+	if result.Migrated != 1 {
+		t.Fatalf("expected 1 blob to migrate, got %d", result.Migrated)
+	}
+
+	result, err = MigrateBlobPathLayout(ctx, d, 2, false)
+	if err != nil {
+		t.Fatalf("unexpected error migrating: %v", err)
+	}
+	if result.Migrated != 1 {
+		t.Fatalf("expected 1 blob migrated, got %d", result.Migrated)
+	}
+	checkBlob()
+
+	oldPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 1})
+	if _, err := d.Stat(ctx, oldPath); err == nil {
+		t.Fatalf("expected %s to be removed", oldPath)
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error statting %s: %v", oldPath, err)
+	}
+
+	newPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 2})
+	if _, err := d.Stat(ctx, newPath); err != nil {
+		t.Fatalf("unexpected error statting %s: %v", newPath, err)
+	}
+
+	result, err = MigrateBlobPathLayout(ctx, d, 2, false)
+	if err != nil {
+		t.Fatalf("unexpected error migrating again: %v", err)
+	}
+	if result.Migrated != 0 || result.Skipped != 0 {
+		t.Fatalf("expected nothing left to migrate, got %+v", result)
+	}
+}
+
+// interruptingDriver counts the copies made on the storage provider, failing
+// every copy once limit copies were made.
+type interruptingDriver struct {
+	driver.StorageDriver
+	copies int
+	limit  int
+}
+
+func (d *interruptingDriver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	if d.copies >= d.limit {
+		return errors.New("interrupted")
+	}
+	d.copies++
+	content, err := d.GetContent(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, destPath, content)
+}
+
+// TestMigrateBlobPathLayoutInterrupted checks that a migration interrupted
+// partway loses no blob, and completes when run again, copying again a blob
+// only partially copied.
+func TestMigrateBlobPathLayoutInterrupted(t *testing.T) {
+	ctx := context.Background()
+	d := &interruptingDriver{StorageDriver: inmemory.New(), limit: 1}
+	named, _ := reference.ParseNamed("foo/bar")
+
+	registry, err := NewRegistry(ctx, d, BlobPathLayout(2, 1))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	// The blobs are written to layout 1, then one is partially copied to
+	// layout 2.
+	contents := [][]byte{[]byte("first layer"), []byte("second layer"), []byte("third layer")}
+	var descs []distribution.Descriptor
+	for _, content := range contents {
+		desc, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+		if err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+		descs = append(descs, desc)
+
+		newPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 2})
+		oldPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 1})
+		if err := d.Move(ctx, newPath, oldPath); err != nil {
+			t.Fatalf("unexpected error moving blob to layout 1: %v", err)
+		}
+	}
+	partial, _ := pathFor(blobDataPathSpec{digest: descs[2].Digest, layout: 2})
+	if err := d.PutContent(ctx, partial, contents[2][:5]); err != nil {
+		t.Fatalf("unexpected error writing partial copy: %v", err)
+	}
+
+	if _, err := MigrateBlobPathLayout(ctx, d, 2, false); err == nil {
+		t.Fatalf("expected the interrupted migration to fail")
+	}
+	for i, desc := range descs {
+		oldPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 1})
+		newPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 2})
+		_, oldErr := d.Stat(ctx, oldPath)
+		newInfo, newErr := d.Stat(ctx, newPath)
+		if oldErr != nil && (newErr != nil || newInfo.Size() != int64(len(contents[i]))) {
+			t.Fatalf("blob %d lost by the interrupted migration: %v, %v", i, oldErr, newErr)
+		}
+	}
+
+	d.limit = len(descs)
+	result, err := MigrateBlobPathLayout(ctx, d, 2, false)
+	if err != nil {
+		t.Fatalf("unexpected error resuming the migration: %v", err)
+	}
+	if result.Migrated != 2 || d.copies != len(descs) {
+		t.Fatalf("expected the remaining 2 blobs migrated, got %+v and %d copies", result, d.copies)
+	}
+
+	for i, desc := range descs {
+		p, err := repo.Blobs(ctx).Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error getting blob %d: %v", i, err)
+		}
+		if !bytes.Equal(p, contents[i]) {
+			t.Fatalf("unexpected content of blob %d: %q", i, p)
+		}
+
+		oldPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: 1})
+		if _, err := d.Stat(ctx, oldPath); err == nil {
+			t.Fatalf("expected blob %d to be removed from layout 1", i)
+		}
+	}
+}
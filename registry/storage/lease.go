@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// Lease records which registry instance holds a named lease, such as the one
+// electing the instance running the background maintenance jobs, and until
+// when.
+type Lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// Held reports whether the lease is held by an instance at t.
+func (l Lease) Held(t time.Time) bool {
+	return l.Owner != "" && t.Before(l.Expires)
+}
+
+// AcquireLease acquires the named lease stored in the storage backend for
+// owner for ttl, or renews it if owner already holds it, unless another
+// instance holds it. It returns the lease as stored after the attempt.
+//
+// Storage backends offer no conditional write: instances acquiring an expired
+// lease at once all write it, and the last write wins. Each reads the lease
+// back, but may still not see the winning write on an eventually consistent
+// backend, so an instance should only rely on a lease it acquired on two
+// consecutive attempts.
+func AcquireLease(ctx context.Context, storageDriver driver.StorageDriver, name, owner string, ttl time.Duration) (Lease, error) {
+	leasePath, err := pathFor(leasePathSpec{name: name})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return acquireLease(ctx, storageDriver, leasePath, owner, ttl)
+}
+
+// acquireLease acquires the lease stored at leasePath for owner, as
+// AcquireLease does.
+func acquireLease(ctx context.Context, storageDriver driver.StorageDriver, leasePath, owner string, ttl time.Duration) (Lease, error) {
+	current, err := loadLease(ctx, storageDriver, leasePath)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	now := time.Now()
+	if current.Owner != owner && current.Held(now) {
+		return current, nil
+	}
+
+	p, err := json.Marshal(Lease{Owner: owner, Expires: now.Add(ttl)})
+	if err != nil {
+		return Lease{}, err
+	}
+	if err := storageDriver.PutContent(ctx, leasePath, p); err != nil {
+		return Lease{}, err
+	}
+
+	return loadLease(ctx, storageDriver, leasePath)
+}
+
+// loadLease reads the lease stored at leasePath, returning an empty lease if
+// none was ever acquired.
+func loadLease(ctx context.Context, storageDriver driver.StorageDriver, leasePath string) (Lease, error) {
+	var lease Lease
+
+	p, err := storageDriver.GetContent(ctx, leasePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return lease, nil
+		}
+		return lease, err
+	}
+
+	if err := json.Unmarshal(p, &lease); err != nil {
+		return lease, fmt.Errorf("invalid lease %s: %v", leasePath, err)
+	}
+	return lease, nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// TestAcquireLease checks that a lease is held by a single owner, renewed by
+// it, and acquired by another owner once it expires.
+func TestAcquireLease(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	ttl := 50 * time.Millisecond
+
+	lease, err := AcquireLease(ctx, d, "maintenance", "a", ttl)
+	if err != nil || lease.Owner != "a" || !lease.Held(time.Now()) {
+		t.Fatalf("unexpected lease acquired: %+v, %v", lease, err)
+	}
+
+	lease, err = AcquireLease(ctx, d, "maintenance", "b", ttl)
+	if err != nil || lease.Owner != "a" {
+		t.Fatalf("lease held by another owner was acquired: %+v, %v", lease, err)
+	}
+
+	renewed, err := AcquireLease(ctx, d, "maintenance", "a", ttl)
+	if err != nil || renewed.Owner != "a" || renewed.Expires.Before(lease.Expires) {
+		t.Fatalf("unexpected lease renewed: %+v, %v", renewed, err)
+	}
+
+	time.Sleep(ttl)
+	lease, err = AcquireLease(ctx, d, "maintenance", "b", ttl)
+	if err != nil || lease.Owner != "b" {
+		t.Fatalf("expired lease was not acquired: %+v, %v", lease, err)
+	}
+
+	// Leases are independent of each other.
+	lease, err = AcquireLease(ctx, d, "other", "a", ttl)
+	if err != nil || lease.Owner != "a" {
+		t.Fatalf("unexpected lease acquired: %+v, %v", lease, err)
+	}
+}
@@ -45,6 +45,12 @@ func (lbs *linkedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distr
 	return lbs.blobAccessController.Stat(ctx, dgst)
 }
 
+// StatMany implements BlobBatchStatter.StatMany, describing many blobs of the
+// repository at once.
+func (lbs *linkedBlobStore) StatMany(ctx context.Context, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	return statMany(ctx, lbs.blobAccessController, dgsts)
+}
+
 func (lbs *linkedBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
 	canonical, err := lbs.Stat(ctx, dgst) // access check
 	if err != nil {
@@ -322,11 +328,91 @@ type linkedBlobStatter struct {
 	// removed an the blob links folder should be merged. The first entry is
 	// treated as the "canonical" link location and will be used for writes.
 	linkPathFns []linkPathFunc
+
+	// layerMediaTypes applies the media types manifests of the repository
+	// declare for its layers to their descriptors.
+	layerMediaTypes bool
 }
 
 var _ distribution.BlobDescriptorService = &linkedBlobStatter{}
 
 func (lbs *linkedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	target, err := lbs.resolve(ctx, dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	desc, err := lbs.blobStore.statter.Stat(ctx, target)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	return lbs.applyMediaType(ctx, dgst, desc)
+}
+
+// StatMany implements BlobBatchStatter.StatMany. The links of the repository
+// are still read one at a time, but the blobs they point to are described at
+// once.
+func (lbs *linkedBlobStatter) StatMany(ctx context.Context, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	descs := make([]distribution.Descriptor, len(dgsts))
+	errs := make([]error, len(dgsts))
+
+	// Only resolved targets are described, remembering their index in dgsts.
+	var targets []digest.Digest
+	var indexes []int
+	for i, dgst := range dgsts {
+		target, err := lbs.resolve(ctx, dgst)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		targets = append(targets, target)
+		indexes = append(indexes, i)
+	}
+
+	if len(targets) == 0 {
+		return descs, errs
+	}
+
+	targetDescs, targetErrs := statMany(ctx, lbs.blobStore.statter, targets)
+	for j, i := range indexes {
+		descs[i], errs[i] = targetDescs[j], targetErrs[j]
+		if errs[i] == nil {
+			descs[i], errs[i] = lbs.applyMediaType(ctx, dgsts[i], descs[i])
+		}
+	}
+
+	return descs, errs
+}
+
+// applyMediaType replaces the media type of desc, the descriptor of the blob
+// linked in the repository as dgst, by the one manifests of the repository
+// declare for it, if any was recorded.
+func (lbs *linkedBlobStatter) applyMediaType(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) (distribution.Descriptor, error) {
+	if !lbs.layerMediaTypes {
+		return desc, nil
+	}
+
+	mediaTypePath, err := pathFor(layerMediaTypePathSpec{name: lbs.repository.Named().Name(), digest: dgst})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	content, err := lbs.blobStore.driver.GetContent(ctx, mediaTypePath)
+	switch err.(type) {
+	case nil:
+		desc.MediaType = string(content)
+	case driver.PathNotFoundError:
+	default:
+		return distribution.Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+// resolve returns the canonical digest of the blob linked in the repository
+// as dgst.
+func (lbs *linkedBlobStatter) resolve(ctx context.Context, dgst digest.Digest) (digest.Digest, error) {
 	var (
 		resolveErr error
 		target     digest.Digest
@@ -346,12 +432,12 @@ func (lbs *linkedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (dis
 		case driver.PathNotFoundError:
 			resolveErr = distribution.ErrBlobUnknown // move to the next linkPathFn, saving the error
 		default:
-			return distribution.Descriptor{}, err
+			return "", err
 		}
 	}
 
 	if resolveErr != nil {
-		return distribution.Descriptor{}, resolveErr
+		return "", resolveErr
 	}
 
 	if target != dgst {
@@ -359,10 +445,7 @@ func (lbs *linkedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (dis
 		context.GetLogger(ctx).Warnf("looking up blob with canonical target: %v -> %v", dgst, target)
 	}
 
-	// TODO(stevvooe): Look up repository local mediatype and replace that on
-	// the returned descriptor.
-
-	return lbs.blobStore.statter.Stat(ctx, target)
+	return target, nil
 }
 
 func (lbs *linkedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) (err error) {
@@ -382,6 +465,22 @@ func (lbs *linkedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) (er
 				return err
 			}
 		}
+
+		if err := lbs.blobStore.journal.record(ctx, JournalActionDelete, blobLinkPath, ""); err != nil {
+			return err
+		}
+	}
+
+	if lbs.layerMediaTypes {
+		mediaTypePath, err := pathFor(layerMediaTypePathSpec{name: lbs.repository.Named().Name(), digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := lbs.blobStore.driver.Delete(ctx, mediaTypePath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
 	}
 
 	return nil
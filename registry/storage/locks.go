@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+)
+
+const (
+	// lockRetryInterval is the mean interval between attempts to acquire a
+	// lock held by another attempt.
+	lockRetryInterval = 100 * time.Millisecond
+
+	// lockSettleDelay is how long a lock acquired in the storage backend is
+	// given for writes racing to acquire it to land, before reading it back.
+	lockSettleDelay = 50 * time.Millisecond
+)
+
+// LockBackend keeps the locks of a LockManager, each held by a single token
+// until released or until its ttl expires.
+type LockBackend interface {
+	// TryLock acquires the named lock for token for ttl, unless another
+	// token holds it, and reports whether it was acquired.
+	TryLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+
+	// Unlock releases the named lock, if token holds it.
+	Unlock(ctx context.Context, name, token string) error
+}
+
+// LockTimeoutError is returned when a lock is held by another attempt for
+// longer than the timeout of the LockManager.
+type LockTimeoutError struct {
+	Name string
+}
+
+func (err LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out waiting for lock %s", err.Name)
+}
+
+// LockManager acquires named locks, excluding concurrent mutations of the
+// same metadata, such as a tag, by the registry instances sharing a backend.
+type LockManager struct {
+	backend LockBackend
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewLockManager returns a LockManager keeping its locks in backend. A lock
+// not released, such as by an instance which stopped, expires after ttl.
+// Acquiring a lock fails with a LockTimeoutError after waiting for timeout.
+func NewLockManager(backend LockBackend, ttl, timeout time.Duration) *LockManager {
+	return &LockManager{
+		backend: backend,
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+// Lock blocks until it holds the named lock, and returns a function releasing
+// it. A nil LockManager returns immediately, locking nothing.
+func (lm *LockManager) Lock(ctx context.Context, name string) (func(), error) {
+	if lm == nil {
+		return func() {}, nil
+	}
+
+	token := uuid.Generate().String()
+	deadline := time.Now().Add(lm.timeout)
+	for {
+		acquired, err := lm.backend.TryLock(ctx, name, token, lm.ttl)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() {
+				if err := lm.backend.Unlock(ctx, name, token); err != nil {
+					context.GetLogger(ctx).Errorf("error releasing lock %s: %v", name, err)
+				}
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, LockTimeoutError{Name: name}
+		}
+
+		// Jitter the retries of attempts waiting for the same lock.
+		select {
+		case <-time.After(lockRetryInterval/2 + time.Duration(rand.Int63n(int64(lockRetryInterval)))):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Locks is a functional option for NewRegistry. Tag updates and manifest
+// deletions then hold locks of the lock manager, so that concurrent updates
+// of a tag are applied one after the other and a tag is not moved to a
+// manifest being deleted.
+func Locks(lm *LockManager) RegistryOption {
+	return func(registry *registry) error {
+		registry.locks = lm
+		return nil
+	}
+}
+
+// tagLockName returns the name of the lock of a tag.
+func tagLockName(name, tag string) string {
+	return path.Join("repositories", name, "_tags", tag)
+}
+
+// manifestLockName returns the name of the lock of a manifest revision.
+func manifestLockName(name string, dgst digest.Digest) string {
+	return path.Join("repositories", name, "_manifests", dgst.Algorithm().String(), dgst.Hex())
+}
+
+// storageLockBackend keeps locks as objects with an expiry in the storage
+// backend.
+type storageLockBackend struct {
+	driver driver.StorageDriver
+}
+
+// NewStorageLockBackend returns a LockBackend keeping locks in the storage
+// backend. As the backend offers no conditional write, a lock is only
+// acquired once read back after the writes of racing attempts had time to
+// land, and the clocks of the registry instances must be in sync.
+func NewStorageLockBackend(storageDriver driver.StorageDriver) LockBackend {
+	return &storageLockBackend{driver: storageDriver}
+}
+
+func (b *storageLockBackend) TryLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	lockPath, err := pathFor(lockPathSpec{name: name})
+	if err != nil {
+		return false, err
+	}
+
+	lease, err := acquireLease(ctx, b.driver, lockPath, token, ttl)
+	if err != nil || lease.Owner != token {
+		return false, err
+	}
+
+	time.Sleep(lockSettleDelay)
+	lease, err = loadLease(ctx, b.driver, lockPath)
+	if err != nil {
+		return false, err
+	}
+	return lease.Owner == token, nil
+}
+
+func (b *storageLockBackend) Unlock(ctx context.Context, name, token string) error {
+	lockPath, err := pathFor(lockPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	lease, err := loadLease(ctx, b.driver, lockPath)
+	if err != nil || lease.Owner != token {
+		return err
+	}
+
+	err = b.driver.Delete(ctx, lockPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// RemoveTags removes the tags pointing at the manifest dgst, such as after
+// deleting it, and returns them. With a lock manager, each tag is checked to
+// still point at the manifest while holding its lock, so that a tag moved to
+// another manifest in the meantime is kept.
+func RemoveTags(ctx context.Context, tags distribution.TagService, dgst digest.Digest) ([]string, error) {
+	candidates, err := tags.Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	ts, ok := tags.(*tagStore)
+	if !ok || ts.repository.registry.locks == nil {
+		for _, tag := range candidates {
+			if err := tags.Untag(ctx, tag); err != nil {
+				return nil, err
+			}
+		}
+		return candidates, nil
+	}
+
+	var removed []string
+	for _, tag := range candidates {
+		untagged, err := ts.untagIf(ctx, tag, dgst)
+		if err != nil {
+			return removed, err
+		}
+		if untagged {
+			removed = append(removed, tag)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// TestLockManager checks that a lock is held by a single attempt at once,
+// that waiting for it times out, and that it expires if not released.
+func TestLockManager(t *testing.T) {
+	ctx := context.Background()
+	backend := NewStorageLockBackend(inmemory.New())
+	lm := NewLockManager(backend, 500*time.Millisecond, 200*time.Millisecond)
+
+	unlock, err := lm.Lock(ctx, "repositories/foo/bar/_tags/latest")
+	if err != nil {
+		t.Fatalf("unexpected error acquiring lock: %v", err)
+	}
+
+	if _, err := lm.Lock(ctx, "repositories/foo/bar/_tags/latest"); err != (LockTimeoutError{Name: "repositories/foo/bar/_tags/latest"}) {
+		t.Fatalf("expected a timeout acquiring a held lock, got %v", err)
+	}
+
+	// Other locks are independent.
+	unlockOther, err := lm.Lock(ctx, "repositories/foo/bar/_tags/stable")
+	if err != nil {
+		t.Fatalf("unexpected error acquiring another lock: %v", err)
+	}
+	unlockOther()
+
+	unlock()
+	if _, err := lm.Lock(ctx, "repositories/foo/bar/_tags/latest"); err != nil {
+		t.Fatalf("unexpected error acquiring a released lock: %v", err)
+	}
+
+	// The lock was not released: wait for it to expire.
+	lm.timeout = time.Second
+	if _, err := lm.Lock(ctx, "repositories/foo/bar/_tags/latest"); err != nil {
+		t.Fatalf("unexpected error acquiring an expired lock: %v", err)
+	}
+}
+
+// TestLockManagerExclusion checks that concurrent attempts hold a lock one
+// after the other.
+func TestLockManagerExclusion(t *testing.T) {
+	ctx := context.Background()
+	backend := NewStorageLockBackend(inmemory.New())
+	lm := NewLockManager(backend, 10*time.Second, 10*time.Second)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	holders, maxHolders := 0, 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := lm.Lock(ctx, "lock")
+			if err != nil {
+				t.Errorf("unexpected error acquiring lock: %v", err)
+				return
+			}
+
+			mu.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Fatalf("lock held by %d attempts at once", maxHolders)
+	}
+}
+
+// TestLockedTags checks that, with locks, a tag is not moved to a deleted
+// manifest and tags moved to another manifest are kept when removing the
+// tags of a deleted one.
+func TestLockedTags(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	reg, err := NewRegistry(ctx, d, EnableDelete, Locks(NewLockManager(NewStorageLockBackend(d), time.Minute, time.Second)))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	list, err := manifestlist.FromDescriptors(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, list)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	desc := distribution.Descriptor{Digest: dgst, MediaType: manifestlist.MediaTypeManifestList}
+
+	for _, tag := range []string{"latest", "stable"} {
+		if err := tags.Tag(ctx, tag, desc); err != nil {
+			t.Fatalf("unexpected error tagging manifest: %v", err)
+		}
+	}
+
+	// A tag moved to another manifest meanwhile is not removed.
+	removed, err := tags.(*tagStore).untagIf(ctx, "stable", "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	if err != nil || removed {
+		t.Fatalf("unexpected tag removal: %v, %v", removed, err)
+	}
+
+	if err := ms.Delete(ctx, dgst); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	if err := tags.Tag(ctx, "edge", desc); err == nil {
+		t.Fatalf("expected an error tagging a deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("unexpected error tagging a deleted manifest: %v", err)
+	}
+
+	untagged, err := RemoveTags(ctx, tags, dgst)
+	if err != nil || len(untagged) != 2 {
+		t.Fatalf("unexpected tags removed: %v, %v", untagged, err)
+	}
+	if all, err := tags.All(ctx); err != nil || len(all) != 0 {
+		t.Fatalf("unexpected tags left: %v, %v", all, err)
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// ManifestMetadata is the metadata of a manifest revision indexed when it was
+// put, so that manifests can be selected by their metadata without reading
+// each of them.
+type ManifestMetadata struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+
+	// Annotations are the annotations of the manifest itself.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Labels are the labels of the image configuration referenced by the
+	// manifest.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Image holds the details of the image configuration referenced by the
+	// manifest.
+	Image *ImageMetadata `json:"image,omitempty"`
+
+	// Indexed is the time the manifest was last put.
+	Indexed time.Time `json:"indexed"`
+}
+
+// ImageMetadata are the details of an image read from its configuration, so
+// that clients can display them without fetching the configuration blob.
+type ImageMetadata struct {
+	Created      *time.Time `json:"created,omitempty"`
+	Architecture string     `json:"architecture,omitempty"`
+	OS           string     `json:"os,omitempty"`
+	Entrypoint   []string   `json:"entrypoint,omitempty"`
+	Cmd          []string   `json:"cmd,omitempty"`
+	Env          []string   `json:"env,omitempty"`
+
+	// ExposedPorts lists the ports exposed by the image, as <port>/<proto>.
+	ExposedPorts []string `json:"exposedPorts,omitempty"`
+}
+
+// ErrManifestMetadataUnknown is returned when the metadata of a manifest was
+// not indexed.
+var ErrManifestMetadataUnknown = errors.New("manifest metadata unknown")
+
+// EnableManifestIndex is a functional option for NewRegistry. It indexes the
+// annotations and image configuration of the image manifests put to the
+// registry, so that they can be selected with SelectManifests and described
+// with GetManifestMetadata.
+func EnableManifestIndex(registry *registry) error {
+	registry.manifestIndexEnabled = true
+	return nil
+}
+
+// ManifestSelector selects manifests by the values of their annotations and
+// configuration labels. Each value is a pattern in which '*' matches any
+// sequence of characters. A manifest is selected if it has every annotation
+// and label of the selector, with values matching their patterns.
+type ManifestSelector struct {
+	Annotations map[string]string
+	Labels      map[string]string
+}
+
+// Matches returns true if the manifest with the given metadata is selected.
+func (s ManifestSelector) Matches(metadata ManifestMetadata) bool {
+	return matchAll(s.Annotations, metadata.Annotations) && matchAll(s.Labels, metadata.Labels)
+}
+
+// matchAll returns true if values has a value matching each of patterns.
+func matchAll(patterns, values map[string]string) bool {
+	for key, pattern := range patterns {
+		value, ok := values[key]
+		if !ok || !matchPattern(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern returns true if value matches pattern, in which '*' matches any
+// sequence of characters.
+func matchPattern(pattern, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(value)
+}
+
+// SelectManifests returns the metadata of the manifests of the named
+// repository which are selected by selector, most recently indexed first.
+// Manifests put before the index was enabled, or deleted since, are not
+// returned.
+func SelectManifests(ctx context.Context, storageDriver driver.StorageDriver, name string, selector ManifestSelector) ([]ManifestMetadata, error) {
+	var selected []ManifestMetadata
+	err := enumerateManifestRevisions(ctx, storageDriver, name, func(revision, linked digest.Digest) error {
+		metadata, err := GetManifestMetadata(ctx, storageDriver, name, revision)
+		if err != nil {
+			if err == ErrManifestMetadataUnknown {
+				return nil
+			}
+			return err
+		}
+
+		if selector.Matches(metadata) {
+			selected = append(selected, metadata)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Stable(byIndexed(selected))
+	return selected, nil
+}
+
+// GetManifestMetadata returns the metadata of the manifest revision of the
+// named repository, or ErrManifestMetadataUnknown if it was not indexed.
+func GetManifestMetadata(ctx context.Context, storageDriver driver.StorageDriver, name string, revision digest.Digest) (ManifestMetadata, error) {
+	var metadata ManifestMetadata
+
+	metadataPath, err := pathFor(manifestMetadataPathSpec{name: name, revision: revision})
+	if err != nil {
+		return metadata, err
+	}
+
+	content, err := storageDriver.GetContent(ctx, metadataPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return metadata, ErrManifestMetadataUnknown
+		}
+		return metadata, err
+	}
+
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return metadata, fmt.Errorf("invalid manifest metadata %s: %v", metadataPath, err)
+	}
+	return metadata, nil
+}
+
+// byIndexed sorts manifest metadata, most recently indexed first.
+type byIndexed []ManifestMetadata
+
+func (a byIndexed) Len() int           { return len(a) }
+func (a byIndexed) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byIndexed) Less(i, j int) bool { return a[i].Indexed.After(a[j].Indexed) }
+
+// indexManifest records the metadata of an image manifest put to the
+// repository. Failures are logged rather than returned: the manifest is
+// stored regardless, and only missing from selections.
+func (ms *schema2ManifestHandler) indexManifest(ctx context.Context, revision digest.Digest, mnfst schema2.DeserializedManifest) {
+	if !ms.repository.manifestIndexEnabled {
+		return
+	}
+
+	if err := ms.writeManifestMetadata(ctx, revision, mnfst); err != nil {
+		context.GetLogger(ctx).Errorf("error indexing manifest %s: %v", revision, err)
+	}
+}
+
+func (ms *schema2ManifestHandler) writeManifestMetadata(ctx context.Context, revision digest.Digest, mnfst schema2.DeserializedManifest) error {
+	annotations, err := mnfst.Annotations()
+	if err != nil {
+		return err
+	}
+
+	config, err := ms.repository.Blobs(ctx).Get(ctx, mnfst.Config.Digest)
+	if err != nil {
+		return err
+	}
+
+	var image struct {
+		Created      *time.Time `json:"created"`
+		Architecture string     `json:"architecture"`
+		OS           string     `json:"os"`
+		Config       struct {
+			Entrypoint   []string            `json:"Entrypoint"`
+			Cmd          []string            `json:"Cmd"`
+			Env          []string            `json:"Env"`
+			ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+			Labels       map[string]string   `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(config, &image); err != nil {
+		return fmt.Errorf("invalid image configuration %s: %v", mnfst.Config.Digest, err)
+	}
+
+	var ports []string
+	for port := range image.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+
+	mediaType, _, err := mnfst.Payload()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(ManifestMetadata{
+		Digest:      revision,
+		MediaType:   mediaType,
+		Annotations: annotations,
+		Labels:      image.Config.Labels,
+		Image: &ImageMetadata{
+			Created:      image.Created,
+			Architecture: image.Architecture,
+			OS:           image.OS,
+			Entrypoint:   image.Config.Entrypoint,
+			Cmd:          image.Config.Cmd,
+			Env:          image.Config.Env,
+			ExposedPorts: ports,
+		},
+		Indexed: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	metadataPath, err := pathFor(manifestMetadataPathSpec{name: ms.repository.Named().Name(), revision: revision})
+	if err != nil {
+		return err
+	}
+
+	return ms.blobStore.blobStore.driver.PutContent(ctx, metadataPath, content)
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestSelectManifests(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableManifestIndex, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(annotations, labels map[string]string) digest.Digest {
+		image, err := json.Marshal(map[string]interface{}{
+			"created":      "2016-05-04T10:00:00Z",
+			"architecture": "amd64",
+			"os":           "linux",
+			"config": map[string]interface{}{
+				"Entrypoint":   []string{"/bin/app"},
+				"Env":          []string{"PATH=/bin"},
+				"ExposedPorts": map[string]interface{}{"8080/tcp": struct{}{}, "443/tcp": struct{}{}},
+				"Labels":       labels,
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling image configuration: %v", err)
+		}
+		config, err := blobs.Put(ctx, schema2.MediaTypeConfig, image)
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+
+		content, err := json.Marshal(struct {
+			schema2.Manifest
+			Annotations map[string]string `json:"annotations,omitempty"`
+		}{
+			Manifest: schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config:    config,
+				Layers:    []distribution.Descriptor{layer},
+			},
+			Annotations: annotations,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling manifest: %v", err)
+		}
+
+		var m schema2.DeserializedManifest
+		if err := m.UnmarshalJSON(content); err != nil {
+			t.Fatalf("unexpected error unmarshaling manifest: %v", err)
+		}
+
+		dgst, err := ms.Put(ctx, &m)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		return dgst
+	}
+
+	v120 := put(map[string]string{"org.opencontainers.image.version": "1.2.0"}, map[string]string{"stage": "prod"})
+	v121 := put(map[string]string{"org.opencontainers.image.version": "1.2.1"}, map[string]string{"stage": "dev"})
+	v130 := put(map[string]string{"org.opencontainers.image.version": "1.3.0"}, nil)
+
+	for _, testcase := range []struct {
+		selector ManifestSelector
+		expected []digest.Digest
+	}{
+		{
+			selector: ManifestSelector{},
+			expected: []digest.Digest{v130, v121, v120},
+		},
+		{
+			selector: ManifestSelector{Annotations: map[string]string{"org.opencontainers.image.version": "1.2.*"}},
+			expected: []digest.Digest{v121, v120},
+		},
+		{
+			selector: ManifestSelector{
+				Annotations: map[string]string{"org.opencontainers.image.version": "1.2.*"},
+				Labels:      map[string]string{"stage": "prod"},
+			},
+			expected: []digest.Digest{v120},
+		},
+		{
+			selector: ManifestSelector{Labels: map[string]string{"stage": "*"}},
+			expected: []digest.Digest{v121, v120},
+		},
+		{
+			selector: ManifestSelector{Annotations: map[string]string{"org.opencontainers.image.version": "1.2"}},
+		},
+	} {
+		selected, err := SelectManifests(ctx, d, named.Name(), testcase.selector)
+		if err != nil {
+			t.Fatalf("unexpected error selecting manifests: %v", err)
+		}
+
+		var dgsts []digest.Digest
+		for _, metadata := range selected {
+			dgsts = append(dgsts, metadata.Digest)
+		}
+		if len(dgsts) != len(testcase.expected) {
+			t.Fatalf("selector %+v: expected %v, got %v", testcase.selector, testcase.expected, dgsts)
+		}
+		for i := range dgsts {
+			if dgsts[i] != testcase.expected[i] {
+				t.Fatalf("selector %+v: expected %v, got %v", testcase.selector, testcase.expected, dgsts)
+			}
+		}
+	}
+
+	metadata, err := GetManifestMetadata(ctx, d, named.Name(), v120)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest metadata: %v", err)
+	}
+	image := metadata.Image
+	if image == nil || image.Created == nil || !image.Created.Equal(time.Date(2016, 5, 4, 10, 0, 0, 0, time.UTC)) ||
+		image.Architecture != "amd64" || image.OS != "linux" ||
+		!reflect.DeepEqual(image.Entrypoint, []string{"/bin/app"}) ||
+		!reflect.DeepEqual(image.Env, []string{"PATH=/bin"}) ||
+		!reflect.DeepEqual(image.ExposedPorts, []string{"443/tcp", "8080/tcp"}) {
+		t.Fatalf("unexpected image metadata: %+v", image)
+	}
+
+	if _, err := GetManifestMetadata(ctx, d, named.Name(), layer.Digest); err != ErrManifestMetadataUnknown {
+		t.Fatalf("expected ErrManifestMetadataUnknown, got %v", err)
+	}
+
+	// Deleted manifests are no longer selected.
+	if err := ms.Delete(ctx, v121); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	selected, err := SelectManifests(ctx, d, named.Name(), ManifestSelector{Labels: map[string]string{"stage": "*"}})
+	if err != nil {
+		t.Fatalf("unexpected error selecting manifests: %v", err)
+	}
+	if len(selected) != 1 || selected[0].Digest != v120 || selected[0].Labels["stage"] != "prod" {
+		t.Fatalf("unexpected manifests selected after deletion: %+v", selected)
+	}
+}
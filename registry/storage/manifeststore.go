@@ -38,6 +38,26 @@ func (o skipLayerOption) Apply(m distribution.ManifestService) error {
 	return fmt.Errorf("skip layer verification only valid for manifestStore")
 }
 
+// WithDigestAlias returns a ManifestServiceOption for Put which additionally
+// links the manifest under dgst, a digest of the manifest content calculated
+// with an algorithm other than the canonical one. The alias is verified
+// against the manifest content before it is linked.
+func WithDigestAlias(dgst digest.Digest) distribution.ManifestServiceOption {
+	return digestAliasOption{dgst: dgst}
+}
+
+type digestAliasOption struct {
+	dgst digest.Digest
+}
+
+func (o digestAliasOption) Apply(m distribution.ManifestService) error {
+	if _, ok := m.(*manifestStore); ok {
+		// consumed by Put
+		return nil
+	}
+	return fmt.Errorf("digest alias only valid for manifestStore")
+}
+
 type manifestStore struct {
 	repository *repository
 	blobStore  *linkedBlobStore
@@ -85,6 +105,16 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 		return nil, err
 	}
 
+	if dgst.Algorithm() != digest.Canonical {
+		// Resolve aliases to the canonical revision, under which any
+		// manifest signatures are stored.
+		desc, err := ms.blobStore.Stat(ctx, dgst)
+		if err != nil {
+			return nil, err
+		}
+		dgst = desc.Digest
+	}
+
 	var versioned manifest.Versioned
 	if err = json.Unmarshal(content, &versioned); err != nil {
 		return nil, err
@@ -111,21 +141,134 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	context.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	aliases, err := ms.digestAliases(manifest, options)
+	if err != nil {
+		return "", err
+	}
+
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	}
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return "", err
+	}
+
+	if ms.skipDependencyVerification {
+		ms.warmDescriptorCache(ctx, manifest)
+	}
+
+	if len(aliases) > 0 {
+		if err := ms.blobStore.linkBlob(ctx, distribution.Descriptor{Digest: dgst}, aliases...); err != nil {
+			return "", err
+		}
+	}
+
+	// The manifest is stored regardless of the catalog index, which is
+	// completed by rebuilding it if the repository is missed.
+	if err := ms.repository.registry.catalog.Add(ctx, ms.repository.Named().Name()); err != nil {
+		context.GetLogger(ctx).Errorf("error adding %s to the catalog index: %v", ms.repository.Named().Name(), err)
+	}
+
+	return dgst, nil
+}
+
+// warmDescriptorCache describes the blobs referenced by a manifest put
+// without verifying its dependencies through the descriptor cache of the
+// repository, so that pulls following the push, possibly served by other
+// registry instances sharing the cache, find their descriptors cached instead
+// of stating the storage backend. Verifying dependencies describes the blobs
+// through the cache already. Blobs which are not stored yet, such as those of
+// a pull through cache, are left out.
+func (ms *manifestStore) warmDescriptorCache(ctx context.Context, manifest distribution.Manifest) {
+	if ms.repository.descriptorCache == nil {
+		return
+	}
+
+	var references []distribution.Descriptor
+	switch m := manifest.(type) {
+	case *schema1.SignedManifest:
+		references = m.References()
+	case *schema2.DeserializedManifest:
+		references = append([]distribution.Descriptor{m.Target()}, m.References()...)
+	default:
+		// Manifest lists reference manifests rather than blobs.
+		return
+	}
+
+	dgsts := make([]digest.Digest, len(references))
+	for i, reference := range references {
+		dgsts[i] = reference.Digest
+	}
+	statMany(ctx, ms.repository.Blobs(ctx), dgsts)
+}
+
+// digestAliases collects and verifies the digest aliases requested through
+// WithDigestAlias.
+func (ms *manifestStore) digestAliases(m distribution.Manifest, options []distribution.ManifestServiceOption) ([]digest.Digest, error) {
+	var aliases []digest.Digest
+	for _, option := range options {
+		o, ok := option.(digestAliasOption)
+		if !ok {
+			continue
+		}
+
+		if err := o.dgst.Validate(); err != nil {
+			return nil, distribution.ErrManifestVerification{err}
+		}
+
+		if !ms.repository.acceptsAlgorithm(o.dgst.Algorithm()) {
+			return nil, distribution.ErrManifestVerification{distribution.ErrBlobInvalidDigest{
+				Digest: o.dgst,
+				Reason: fmt.Errorf("digest algorithm %q not accepted", o.dgst.Algorithm()),
+			}}
+		}
+
+		// The content digest of a schema1 manifest is calculated over the
+		// payload without signatures.
+		var content []byte
+		if sm, ok := m.(*schema1.SignedManifest); ok {
+			content = sm.Canonical
+		} else {
+			_, payload, err := m.Payload()
+			if err != nil {
+				return nil, err
+			}
+			content = payload
+		}
+
+		if o.dgst.Algorithm().FromBytes(content) != o.dgst {
+			return nil, distribution.ErrManifestVerification{distribution.ErrBlobInvalidDigest{
+				Digest: o.dgst,
+				Reason: fmt.Errorf("content does not match digest"),
+			}}
+		}
+
+		aliases = append(aliases, o.dgst)
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	return aliases, nil
 }
 
 // Delete removes the revision of the specified manfiest.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	context.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
+
+	unlock, err := ms.repository.registry.locks.Lock(ctx, manifestLockName(ms.repository.Named().Name(), dgst))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	return ms.blobStore.Delete(ctx, dgst)
 }
 
@@ -11,6 +11,7 @@ import (
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/manifest"
 	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache/memory"
 	"github.com/docker/distribution/registry/storage/driver"
@@ -366,6 +367,66 @@ func TestManifestStorage(t *testing.T) {
 	}
 }
 
+// TestManifestDigestAlias ensures that manifests put with a digest alias can
+// be fetched by that alias and that mismatched aliases are rejected.
+func TestManifestDigestAlias(t *testing.T) {
+	repoName, _ := reference.ParseNamed("foo/bar")
+	env := newManifestStoreTestEnv(t, repoName, "thetag")
+	ms, err := env.repository.Manifests(env.ctx, SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: schema2.MediaTypeConfig,
+			Digest:    digest.FromBytes([]byte("config")),
+			Size:      6,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatalf("unexpected error getting payload: %v", err)
+	}
+
+	if _, err := ms.Put(env.ctx, m, WithDigestAlias(digest.SHA512.FromBytes([]byte("other")))); err == nil {
+		t.Fatalf("expected error putting manifest with mismatched alias")
+	} else if verr, ok := err.(distribution.ErrManifestVerification); !ok || len(verr) != 1 {
+		t.Fatalf("unexpected error type: %#v", err)
+	} else if _, ok := verr[0].(distribution.ErrBlobInvalidDigest); !ok {
+		t.Fatalf("unexpected verification error: %#v", verr[0])
+	}
+
+	alias := digest.SHA512.FromBytes(payload)
+	dgst, err := ms.Put(env.ctx, m, WithDigestAlias(alias))
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	if dgst != digest.FromBytes(payload) {
+		t.Fatalf("unexpected canonical digest: %v", dgst)
+	}
+
+	fetched, err := ms.Get(env.ctx, alias)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest by alias: %v", err)
+	}
+
+	_, fetchedPayload, err := fetched.Payload()
+	if err != nil {
+		t.Fatalf("unexpected error getting payload: %v", err)
+	}
+
+	if !bytes.Equal(fetchedPayload, payload) {
+		t.Fatalf("fetched payload does not match")
+	}
+}
+
 // TestLinkPathFuncs ensures that the link path functions behavior are locked
 // down and implemented as expected.
 func TestLinkPathFuncs(t *testing.T) {
@@ -399,3 +460,232 @@ func TestLinkPathFuncs(t *testing.T) {
 	}
 
 }
+
+// TestManifestPutWarmsDescriptorCache checks that putting a manifest without
+// verifying its layers caches the descriptors of its blobs, as they are
+// cached when verifying them, for registry instances other than the one the
+// blobs were pushed to.
+func TestManifestPutWarmsDescriptorCache(t *testing.T) {
+	repoName, _ := reference.ParseNamed("foo/bar")
+	env := newManifestStoreTestEnv(t, repoName, "thetag")
+
+	var references []distribution.Descriptor
+	for _, content := range []string{"config", "layer"} {
+		desc, err := env.repository.Blobs(env.ctx).Put(env.ctx, schema2.MediaTypeLayer, []byte(content))
+		if err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+		references = append(references, desc)
+	}
+	missing := digest.FromBytes([]byte("missing"))
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    references[0],
+		Layers: []distribution.Descriptor{
+			references[1],
+			{MediaType: schema2.MediaTypeLayer, Digest: missing, Size: 7},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+
+	// Another registry instance, with a descriptor cache of its own.
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider()
+	registry, err := NewRegistry(env.ctx, env.driver, BlobDescriptorCacheProvider(cacheProvider))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repo, err := registry.Repository(env.ctx, repoName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	ms, err := repo.Manifests(env.ctx, SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(env.ctx, m); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	cache, err := cacheProvider.RepositoryScoped(repoName.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, reference := range references {
+		desc, err := cache.Stat(env.ctx, reference.Digest)
+		if err != nil {
+			t.Fatalf("descriptor of %s not cached: %v", reference.Digest, err)
+		}
+		if desc.Size != reference.Size {
+			t.Fatalf("unexpected cached descriptor: %#v", desc)
+		}
+	}
+	if _, err := cache.Stat(env.ctx, missing); err != distribution.ErrBlobUnknown {
+		t.Fatalf("unexpected cached descriptor of missing blob: %v", err)
+	}
+}
+
+// TestManifestPutRecordsLayerMediaType checks that the compression media type
+// a manifest declares for a layer is recorded for its repository only, and
+// not in the descriptor cache shared by all repositories.
+func TestManifestPutRecordsLayerMediaType(t *testing.T) {
+	ctx := context.Background()
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider()
+	registry, err := NewRegistry(ctx, inmemory.New(), BlobDescriptorCacheProvider(cacheProvider))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repoName, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, repoName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	// The global cache may have lost the layer, as after a restart of a
+	// shared cache.
+	if err := cacheProvider.Clear(ctx, layer.Digest); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers: []distribution.Descriptor{
+			{MediaType: schema2.MediaTypeLayerZstd, Digest: layer.Digest, Size: layer.Size},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, m); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	desc, err := blobs.Stat(ctx, layer.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error statting layer: %v", err)
+	}
+	if desc.MediaType != schema2.MediaTypeLayerZstd {
+		t.Fatalf("unexpected media type of layer in repository: %v", desc.MediaType)
+	}
+
+	if desc, err := cacheProvider.Stat(ctx, layer.Digest); err == nil && desc.MediaType == schema2.MediaTypeLayerZstd {
+		t.Fatalf("media type of layer recorded in the global cache")
+	}
+}
+
+// TestLayerMediaTypePersisted checks that the media type a manifest declares
+// for a layer is stored with the repository, to be found by other registry
+// instances, and only once the manifest is put.
+func TestLayerMediaTypePersisted(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repoName, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, repoName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layerMediaType := func() string {
+		other, err := NewRegistry(ctx, driver)
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		repo, err := other.Repository(ctx, repoName)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+		desc, err := repo.Blobs(ctx).Stat(ctx, layer.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error statting layer: %v", err)
+		}
+		return desc.MediaType
+	}
+
+	// A manifest failing verification records nothing.
+	missing := distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromBytes([]byte("missing")), Size: 7}
+	invalid, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers: []distribution.Descriptor{
+			{MediaType: schema2.MediaTypeLayerZstd, Digest: layer.Digest, Size: layer.Size},
+			missing,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	if _, err := ms.Put(ctx, invalid); err == nil {
+		t.Fatalf("expected manifest referring to a missing layer to be rejected")
+	}
+	if mediaType := layerMediaType(); mediaType == schema2.MediaTypeLayerZstd {
+		t.Fatalf("media type of layer recorded by a rejected manifest")
+	}
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers: []distribution.Descriptor{
+			{MediaType: schema2.MediaTypeLayerZstd, Digest: layer.Digest, Size: layer.Size},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	if _, err := ms.Put(ctx, m); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	if mediaType := layerMediaType(); mediaType != schema2.MediaTypeLayerZstd {
+		t.Fatalf("unexpected media type of layer in repository: %v", mediaType)
+	}
+
+	// Other repositories linking the layer keep its generic type.
+	otherName, _ := reference.ParseNamed("foo/other")
+	other, err := registry.Repository(ctx, otherName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	if _, err := other.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte("layer")); err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	desc, err := other.Blobs(ctx).Stat(ctx, layer.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error statting layer: %v", err)
+	}
+	if desc.MediaType == schema2.MediaTypeLayerZstd {
+		t.Fatalf("media type of layer recorded for another repository")
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// readCountingDriver counts the GetContent calls made to a driver, which
+// read the links of tags and layers.
+type readCountingDriver struct {
+	storagedriver.StorageDriver
+	reads int
+}
+
+func (d *readCountingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.reads++
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+// TestNegativeCache checks that missing tags and layers are looked up once
+// until added through the registry.
+func TestNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	driver := &readCountingDriver{StorageDriver: inmemory.New()}
+	registry, err := NewRegistry(ctx, driver, NegativeCache(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	imageName, _ := reference.ParseNamed("foo/bar")
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	tags := repository.Tags(ctx)
+	for i := 0; i < 2; i++ {
+		if _, err := tags.Get(ctx, "missing"); err == nil {
+			t.Fatalf("expected the tag to be unknown")
+		} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+			t.Fatalf("unexpected error getting tag: %v", err)
+		}
+		if driver.reads != 1 {
+			t.Fatalf("expected the tag to be read once, got %d reads", driver.reads)
+		}
+	}
+
+	bs := repository.Blobs(ctx)
+	dgst := digest.FromBytes([]byte("layer"))
+	for i := 0; i < 2; i++ {
+		if _, err := bs.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected the blob to be unknown, got %v", err)
+		}
+		if driver.reads != 2 {
+			t.Fatalf("expected the blob link to be read once, got %d reads", driver.reads-1)
+		}
+	}
+
+	// content added through the registry is found immediately, also
+	// through the blob stores of other requests
+	desc, err := bs.Put(ctx, "application/octet-stream", []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if _, err := repository.Blobs(ctx).Stat(ctx, dgst); err != nil {
+		t.Fatalf("unexpected error statting put blob: %v", err)
+	}
+
+	if err := tags.Tag(ctx, "missing", desc); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	if got, err := repository.Tags(ctx).Get(ctx, "missing"); err != nil || got.Digest != desc.Digest {
+		t.Fatalf("unexpected tag %v: %v", got, err)
+	}
+}
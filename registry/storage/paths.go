@@ -30,10 +30,12 @@ const (
 // 						revisions
 //							-> <manifest digest path>
 //								-> link
+//								-> metadata
 //								-> signatures
 // 									<algorithm>/<digest>/link
 // 						tags/<tag>
 //							-> current/link
+//							-> updatedat
 // 							-> index
 //								-> <algorithm>/<hex digest>/link
 // 					-> _layers/
@@ -42,6 +44,16 @@ const (
 // 						data
 // 						startedat
 // 						hashstates/<algorithm>/<offset>
+// 					-> _trust/<role>
+// 						_current/link
+// 						_revisions/<algorithm>/<hex digest>/data
+// 					-> _deltas/<algorithm>/<hex digest>/<algorithm>/<hex digest>
+// 						data
+// 					-> _variants/<algorithm>/<hex digest>/<compression>
+// 						data
+// 						link
+// 					-> _layerindex/<algorithm>/<hex digest>
+// 						data
 //			-> blob/<algorithm>
 //				<split directory content addressable storage>
 //
@@ -74,8 +86,13 @@ const (
 //
 //	Manifests:
 //
+// 	manifestRevisionsPathSpec:     <root>/v2/repositories/<name>/_manifests/revisions/
 // 	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 // 	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
+// 	manifestMetadataPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/metadata
+// 	manifestUntaggedPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/untagged
+// 	referrersPathSpec:             <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/referrers/
+// 	referrerLinkPathSpec:          <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/referrers/<algorithm>/<hex digest>/link
 // 	manifestSignaturesPathSpec:    <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/signatures/
 // 	manifestSignatureLinkPathSpec: <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/signatures/<algorithm>/<hex digest>/link
 //
@@ -84,13 +101,16 @@ const (
 // 	manifestTagsPathSpec:                  <root>/v2/repositories/<name>/_manifests/tags/
 // 	manifestTagPathSpec:                   <root>/v2/repositories/<name>/_manifests/tags/<tag>/
 // 	manifestTagCurrentPathSpec:            <root>/v2/repositories/<name>/_manifests/tags/<tag>/current/link
+// 	manifestTagUpdatedAtPathSpec:          <root>/v2/repositories/<name>/_manifests/tags/<tag>/updatedat
 // 	manifestTagIndexPathSpec:              <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/
 // 	manifestTagIndexEntryPathSpec:         <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/
 // 	manifestTagIndexEntryLinkPathSpec:     <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/link
 //
 // 	Blobs:
 //
+// 	layersPathSpec:               <root>/v2/repositories/<name>/_layers/
 // 	layerLinkPathSpec:            <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/link
+// 	layerMediaTypePathSpec:       <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/mediatype
 //
 //	Uploads:
 //
@@ -98,12 +118,68 @@ const (
 // 	uploadStartedAtPathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/startedat
 // 	uploadHashStatePathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/hashstates/<algorithm>/<offset>
 //
+//	Trust Metadata:
+//
+// 	trustRolePathSpec:              <root>/v2/repositories/<name>/_trust/<role>/
+// 	trustRoleCurrentPathSpec:       <root>/v2/repositories/<name>/_trust/<role>/_current/link
+// 	trustRoleRevisionsPathSpec:     <root>/v2/repositories/<name>/_trust/<role>/_revisions/
+// 	trustRoleRevisionPathSpec:      <root>/v2/repositories/<name>/_trust/<role>/_revisions/<algorithm>/<hex digest>/data
+//
+//	Deltas:
+//
+// 	deltaPathSpec:                  <root>/v2/repositories/<name>/_deltas/<from algorithm>/<from hex digest>/<algorithm>/<hex digest>/data
+//
+//	Variants:
+//
+// 	variantsPathSpec:               <root>/v2/repositories/<name>/_variants/
+// 	variantDataPathSpec:            <root>/v2/repositories/<name>/_variants/<algorithm>/<hex digest>/<compression>/data
+// 	variantLinkPathSpec:            <root>/v2/repositories/<name>/_variants/<algorithm>/<hex digest>/<compression>/link
+//
+//	Layer Indexes:
+//
+// 	layerIndexPathSpec:             <root>/v2/repositories/<name>/_layerindex/<algorithm>/<hex digest>/data
+//
 //	Blob Store:
 //
+// 	blobsPathSpec:                  <root>/v2/blobs/
 // 	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 // 	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+// The blob store paths above are those of layout version 1, the default. Each
+// further layout version shards blobs by two more hex bytes of their digest,
+// for example in version 2:
+//
+// 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<hex bytes 0-1>/<hex bytes 2-3>/<hex digest>/data
+//
+//	Garbage Collection:
+//
+// 	gcCheckpointPathSpec:           <root>/v2/gc/checkpoint
+// 	gcPinsPathSpec:                 <root>/v2/gc/pins
+//
+//	Storage Usage:
+//
+// 	usageReportPathSpec:            <root>/v2/usage/report
+//
+//	Catalog:
+//
+// 	catalogIndexPathSpec:           <root>/v2/catalog/index
+//
+//	Journal:
+//
+// 	journalPathSpec:                <root>/v2/journal/
+// 	journalSegmentPathSpec:         <root>/v2/journal/<segment>
+//
+//	Leases and locks:
+//
+// 	leasePathSpec:                  <root>/v2/leases/<name>
+// 	lockPathSpec:                   <root>/v2/locks/<name>
+//
+//	Tiering:
+//
+// 	blobAccessedAtPathSpec:         <root>/v2/tiering/<algorithm>/<hex digest>/accessedat
+// 	blobColdPathSpec:               <root>/v2/tiering/<algorithm>/<hex digest>/cold
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -125,6 +201,8 @@ func pathFor(spec pathSpec) (string, error) {
 
 	switch v := spec.(type) {
 
+	case manifestRevisionsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "revisions")...), nil
 	case manifestRevisionPathSpec:
 		components, err := digestPathComponents(v.revision, false)
 		if err != nil {
@@ -143,6 +221,55 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestMetadataPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec{
+			name:     v.name,
+			revision: v.revision,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "metadata"), nil
+	case manifestUntaggedPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec{
+			name:     v.name,
+			revision: v.revision,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "untagged"), nil
+	case referrersPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec{
+			name:     v.name,
+			revision: v.subject,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "referrers"), nil
+	case referrerLinkPathSpec:
+		root, err := pathFor(referrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		referrerComponents, err := digestPathComponents(v.referrer, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(append(referrerComponents, "link")...)), nil
 	case manifestSignaturesPathSpec:
 		root, err := pathFor(manifestRevisionPathSpec{
 			name:     v.name,
@@ -193,6 +320,17 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "current", "link"), nil
+	case manifestTagUpdatedAtPathSpec:
+		root, err := pathFor(manifestTagPathSpec{
+			name: v.name,
+			tag:  v.tag,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "updatedat"), nil
 	case manifestTagIndexPathSpec:
 		root, err := pathFor(manifestTagPathSpec{
 			name: v.name,
@@ -232,6 +370,8 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, path.Join(components...)), nil
+	case layersPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_layers")...), nil
 	case layerLinkPathSpec:
 		components, err := digestPathComponents(v.digest, false)
 		if err != nil {
@@ -246,8 +386,17 @@ func pathFor(spec pathSpec) (string, error) {
 		blobLinkPathComponents := append(repoPrefix, v.name, "_layers")
 
 		return path.Join(path.Join(append(blobLinkPathComponents, components...)...), "link"), nil
+	case layerMediaTypePathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(path.Join(append(append(repoPrefix, v.name, "_layers"), components...)...), "mediatype"), nil
+	case blobsPathSpec:
+		return path.Join(append(rootPrefix, "blobs")...), nil
 	case blobDataPathSpec:
-		components, err := digestPathComponents(v.digest, true)
+		components, err := blobPathComponents(v.digest, v.layout)
 		if err != nil {
 			return "", err
 		}
@@ -266,8 +415,113 @@ func pathFor(spec pathSpec) (string, error) {
 			offset = "" // Limit to the prefix for listing offsets.
 		}
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
+	case trustRolePathSpec:
+		return path.Join(append(repoPrefix, v.name, "_trust", v.role)...), nil
+	case trustRoleCurrentPathSpec:
+		root, err := pathFor(trustRolePathSpec{
+			name: v.name,
+			role: v.role,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "_current", "link"), nil
+	case trustRoleRevisionsPathSpec:
+		root, err := pathFor(trustRolePathSpec{
+			name: v.name,
+			role: v.role,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "_revisions"), nil
+	case trustRoleRevisionPathSpec:
+		root, err := pathFor(trustRoleRevisionsPathSpec{
+			name: v.name,
+			role: v.role,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(append(components, "data")...)), nil
+	case deltaPathSpec:
+		fromComponents, err := digestPathComponents(v.from, false)
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(append(repoPrefix, v.name, "_deltas"), fromComponents...), append(components, "data")...)...), nil
+	case variantsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_variants")...), nil
+	case variantDataPathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(append(repoPrefix, v.name, "_variants"), components...), v.compression, "data")...), nil
+	case variantLinkPathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(append(repoPrefix, v.name, "_variants"), components...), v.compression, "link")...), nil
+	case layerIndexPathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(append(repoPrefix, v.name, "_layerindex"), components...), "data")...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case gcCheckpointPathSpec:
+		return path.Join(append(rootPrefix, "gc", "checkpoint")...), nil
+	case gcPinsPathSpec:
+		return path.Join(append(rootPrefix, "gc", "pins")...), nil
+	case usageReportPathSpec:
+		return path.Join(append(rootPrefix, "usage", "report")...), nil
+	case journalPathSpec:
+		return path.Join(append(rootPrefix, "journal")...), nil
+	case journalSegmentPathSpec:
+		return path.Join(append(rootPrefix, "journal", v.segment)...), nil
+	case catalogIndexPathSpec:
+		return path.Join(append(rootPrefix, "catalog", "index")...), nil
+	case leasePathSpec:
+		return path.Join(append(rootPrefix, "leases", v.name)...), nil
+	case lockPathSpec:
+		return path.Join(append(rootPrefix, "locks", v.name)...), nil
+	case blobAccessedAtPathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(rootPrefix, "tiering"), append(components, "accessedat")...)...), nil
+	case blobColdPathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(rootPrefix, "tiering"), append(components, "cold")...)...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -281,6 +535,14 @@ type pathSpec interface {
 	pathSpec()
 }
 
+// manifestRevisionsPathSpec describes the directory path for all manifest
+// revisions of a repository.
+type manifestRevisionsPathSpec struct {
+	name string
+}
+
+func (manifestRevisionsPathSpec) pathSpec() {}
+
 // manifestRevisionPathSpec describes the components of the directory path for
 // a manifest revision.
 type manifestRevisionPathSpec struct {
@@ -301,6 +563,45 @@ type manifestRevisionLinkPathSpec struct {
 
 func (manifestRevisionLinkPathSpec) pathSpec() {}
 
+// manifestMetadataPathSpec describes the path of the metadata of a manifest
+// revision indexed when it was put, such as its annotations and the labels of
+// its image configuration.
+type manifestMetadataPathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestMetadataPathSpec) pathSpec() {}
+
+// manifestUntaggedPathSpec describes the path of the marker written when a
+// tag pointing at a manifest revision is removed, whose modification time is
+// the time the revision was last untagged.
+type manifestUntaggedPathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestUntaggedPathSpec) pathSpec() {}
+
+// referrersPathSpec describes the directory of the links to the manifests
+// referring to a manifest revision as their subject, such as SBOMs.
+type referrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (referrersPathSpec) pathSpec() {}
+
+// referrerLinkPathSpec describes the path of the link to a manifest referring
+// to the subject manifest revision.
+type referrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	referrer digest.Digest
+}
+
+func (referrerLinkPathSpec) pathSpec() {}
+
 // manifestSignaturesPathSpec decribes the path components for the directory
 // containing all the signatures for the target blob. Entries are named with
 // the underlying key id.
@@ -348,6 +649,16 @@ type manifestTagCurrentPathSpec struct {
 
 func (manifestTagCurrentPathSpec) pathSpec() {}
 
+// manifestTagUpdatedAtPathSpec describes the path of the file holding the
+// time the tag was last updated, by which tags are listed most recently
+// updated first.
+type manifestTagUpdatedAtPathSpec struct {
+	name string
+	tag  string
+}
+
+func (manifestTagUpdatedAtPathSpec) pathSpec() {}
+
 // manifestTagCurrentPathSpec describes the link to the index of revisions
 // with the given tag.
 type manifestTagIndexPathSpec struct {
@@ -395,6 +706,24 @@ type layerLinkPathSpec struct {
 
 func (layerLinkPathSpec) pathSpec() {}
 
+// layerMediaTypePathSpec specifies the path of the media type a manifest of
+// the named repository declares for a layer, which overrides the generic
+// media type of the blob within the repository.
+type layerMediaTypePathSpec struct {
+	name   string
+	digest digest.Digest
+}
+
+func (layerMediaTypePathSpec) pathSpec() {}
+
+// layersPathSpec describes the directory of the blob links of the named
+// repository.
+type layersPathSpec struct {
+	name string
+}
+
+func (layersPathSpec) pathSpec() {}
+
 // blobAlgorithmReplacer does some very simple path sanitization for user
 // input. Paths should be "safe" before getting this far due to strict digest
 // requirements but we can add further path conversion here, if needed.
@@ -411,14 +740,90 @@ var blobAlgorithmReplacer = strings.NewReplacer(
 
 // func (blobPathSpec) pathSpec() {}
 
+// blobsPathSpec contains the root path of the registry global blob store.
+type blobsPathSpec struct{}
+
+func (blobsPathSpec) pathSpec() {}
+
 // blobDataPathSpec contains the path for the registry global blob store. For
-// now, this contains layer data, exclusively.
+// now, this contains layer data, exclusively. The layout is the version of
+// the blob store layout, DefaultBlobPathLayout if zero.
 type blobDataPathSpec struct {
 	digest digest.Digest
+	layout int
 }
 
 func (blobDataPathSpec) pathSpec() {}
 
+// gcCheckpointPathSpec describes the path of the checkpoint saved by the mark
+// phase of garbage collection.
+type gcCheckpointPathSpec struct{}
+
+func (gcCheckpointPathSpec) pathSpec() {}
+
+// gcPinsPathSpec describes the path of the pins protecting content from
+// garbage collection.
+type gcPinsPathSpec struct{}
+
+func (gcPinsPathSpec) pathSpec() {}
+
+// usageReportPathSpec describes the path of the last storage usage report.
+type usageReportPathSpec struct{}
+
+func (usageReportPathSpec) pathSpec() {}
+
+// journalPathSpec describes the directory holding the segments of the
+// metadata journal.
+type journalPathSpec struct{}
+
+func (journalPathSpec) pathSpec() {}
+
+// journalSegmentPathSpec describes the path of a segment of the metadata
+// journal, to which a single registry instance appends entries.
+type journalSegmentPathSpec struct {
+	segment string
+}
+
+func (journalSegmentPathSpec) pathSpec() {}
+
+// catalogIndexPathSpec describes the path of the catalog index, listing the
+// repositories of the registry.
+type catalogIndexPathSpec struct{}
+
+func (catalogIndexPathSpec) pathSpec() {}
+
+// leasePathSpec describes the path of a named lease, recording which registry
+// instance holds it.
+type leasePathSpec struct {
+	name string
+}
+
+func (leasePathSpec) pathSpec() {}
+
+// lockPathSpec describes the path of a named lock kept in the storage
+// backend, recording which lock attempt holds it.
+type lockPathSpec struct {
+	name string
+}
+
+func (lockPathSpec) pathSpec() {}
+
+// blobAccessedAtPathSpec describes the path recording when a blob was last
+// read by a client, for the tiering of blobs.
+type blobAccessedAtPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobAccessedAtPathSpec) pathSpec() {}
+
+// blobColdPathSpec describes the path recording that the data of a blob was
+// moved to the cold storage class it holds.
+type blobColdPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobColdPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
@@ -456,6 +861,91 @@ type uploadHashStatePathSpec struct {
 
 func (uploadHashStatePathSpec) pathSpec() {}
 
+// trustRolePathSpec describes the directory holding the trust metadata of a
+// role, such as a TUF role, of a repository. Delegated roles are nested under
+// the role delegating to them; the names of the directories used by a role
+// start with an underscore so they cannot collide with those of a delegation.
+type trustRolePathSpec struct {
+	name string
+	role string
+}
+
+func (trustRolePathSpec) pathSpec() {}
+
+// trustRoleCurrentPathSpec describes the link to the current revision of the
+// trust metadata of a role.
+type trustRoleCurrentPathSpec struct {
+	name string
+	role string
+}
+
+func (trustRoleCurrentPathSpec) pathSpec() {}
+
+// trustRoleRevisionsPathSpec describes the directory of all stored revisions
+// of the trust metadata of a role.
+type trustRoleRevisionsPathSpec struct {
+	name string
+	role string
+}
+
+func (trustRoleRevisionsPathSpec) pathSpec() {}
+
+// trustRoleRevisionPathSpec describes the data of a revision of the trust
+// metadata of a role, addressed by its digest.
+type trustRoleRevisionPathSpec struct {
+	name     string
+	role     string
+	revision digest.Digest
+}
+
+func (trustRoleRevisionPathSpec) pathSpec() {}
+
+// deltaPathSpec describes the delta rebuilding the blob digest from the blob
+// from, both linked in the repository.
+type deltaPathSpec struct {
+	name   string
+	from   digest.Digest
+	digest digest.Digest
+}
+
+func (deltaPathSpec) pathSpec() {}
+
+// variantsPathSpec describes the directory of the variants of the blobs of
+// the named repository.
+type variantsPathSpec struct {
+	name string
+}
+
+func (variantsPathSpec) pathSpec() {}
+
+// variantDataPathSpec describes the data of the variant of the blob digest
+// recompressed with the given compression.
+type variantDataPathSpec struct {
+	name        string
+	digest      digest.Digest
+	compression string
+}
+
+func (variantDataPathSpec) pathSpec() {}
+
+// variantLinkPathSpec describes the link holding the digest of the variant of
+// the blob digest recompressed with the given compression.
+type variantLinkPathSpec struct {
+	name        string
+	digest      digest.Digest
+	compression string
+}
+
+func (variantLinkPathSpec) pathSpec() {}
+
+// layerIndexPathSpec describes the index of the files of the layer digest.
+type layerIndexPathSpec struct {
+	name   string
+	digest digest.Digest
+}
+
+func (layerIndexPathSpec) pathSpec() {}
+
 // repositoriesRootPathSpec returns the root of repositories
 type repositoriesRootPathSpec struct {
 }
@@ -491,3 +981,33 @@ func digestPathComponents(dgst digest.Digest, multilevel bool) ([]string, error)
 
 	return append(prefix, suffix...), nil
 }
+
+// blobPathComponents provides the path breakdown of a blob in the blob store
+// for a given layout version. Version 1 groups blobs by the first two hex
+// bytes of their digest, and each further version adds a level of grouping by
+// the next two hex bytes. For example, in version 2:
+//
+// 	<algorithm>/<hex bytes 0-1>/<hex bytes 2-3>/<full digest>
+//
+func blobPathComponents(dgst digest.Digest, layout int) ([]string, error) {
+	if layout == 0 {
+		layout = DefaultBlobPathLayout
+	}
+	if layout < 1 || layout > MaxBlobPathLayout {
+		return nil, fmt.Errorf("unknown blob path layout version %d", layout)
+	}
+
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	algorithm := blobAlgorithmReplacer.Replace(string(dgst.Algorithm()))
+	hex := dgst.Hex()
+	components := []string{algorithm}
+
+	for i := 0; i < layout; i++ {
+		components = append(components, hex[2*i:2*i+2])
+	}
+
+	return append(components, hex), nil
+}
@@ -10,6 +10,12 @@ func TestPathMapper(t *testing.T) {
 		expected string
 		err      error
 	}{
+		{
+			spec: manifestRevisionsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions",
+		},
 		{
 			spec: manifestRevisionPathSpec{
 				name:     "foo/bar",
@@ -24,6 +30,28 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
+		{
+			spec: manifestMetadataPathSpec{
+				name:     "foo/bar",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/metadata",
+		},
+		{
+			spec: manifestUntaggedPathSpec{
+				name:     "foo/bar",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/untagged",
+		},
+		{
+			spec: referrerLinkPathSpec{
+				name:     "foo/bar",
+				subject:  "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				referrer: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/referrers/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/link",
+		},
 		{
 			spec: manifestSignatureLinkPathSpec{
 				name:      "foo/bar",
@@ -59,6 +87,13 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/current/link",
 		},
+		{
+			spec: manifestTagUpdatedAtPathSpec{
+				name: "foo/bar",
+				tag:  "thetag",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/updatedat",
+		},
 		{
 			spec: manifestTagIndexPathSpec{
 				name: "foo/bar",
@@ -83,6 +118,58 @@ func TestPathMapper(t *testing.T) {
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
 
+		{
+			spec: trustRoleCurrentPathSpec{
+				name: "foo/bar",
+				role: "targets/releases",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_trust/targets/releases/_current/link",
+		},
+		{
+			spec: trustRoleRevisionPathSpec{
+				name:     "foo/bar",
+				role:     "root",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_trust/root/_revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/data",
+		},
+		{
+			spec: deltaPathSpec{
+				name:   "foo/bar",
+				from:   "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				digest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_deltas/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/data",
+		},
+		{
+			spec: variantsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_variants",
+		},
+		{
+			spec: variantDataPathSpec{
+				name:        "foo/bar",
+				digest:      "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				compression: "zstd",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_variants/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/zstd/data",
+		},
+		{
+			spec: variantLinkPathSpec{
+				name:        "foo/bar",
+				digest:      "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				compression: "zstd",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_variants/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/zstd/link",
+		},
+		{
+			spec: layerIndexPathSpec{
+				name:   "foo/bar",
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_layerindex/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/data",
+		},
 		{
 			spec: uploadDataPathSpec{
 				name: "foo/bar",
@@ -97,6 +184,55 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/startedat",
 		},
+		{
+			spec:     blobAccessedAtPathSpec{digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"},
+			expected: "/docker/registry/v2/tiering/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/accessedat",
+		},
+		{
+			spec:     blobColdPathSpec{digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"},
+			expected: "/docker/registry/v2/tiering/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/cold",
+		},
+		{
+			spec:     gcCheckpointPathSpec{},
+			expected: "/docker/registry/v2/gc/checkpoint",
+		},
+		{
+			spec:     gcPinsPathSpec{},
+			expected: "/docker/registry/v2/gc/pins",
+		},
+		{
+			spec:     layersPathSpec{name: "foo/bar"},
+			expected: "/docker/registry/v2/repositories/foo/bar/_layers",
+		},
+		{
+			spec:     usageReportPathSpec{},
+			expected: "/docker/registry/v2/usage/report",
+		},
+		{
+			spec:     catalogIndexPathSpec{},
+			expected: "/docker/registry/v2/catalog/index",
+		},
+		{
+			spec:     leasePathSpec{name: "maintenance"},
+			expected: "/docker/registry/v2/leases/maintenance",
+		},
+		{
+			spec:     lockPathSpec{name: "repositories/foo/bar/_tags/latest"},
+			expected: "/docker/registry/v2/locks/repositories/foo/bar/_tags/latest",
+		},
+		{
+			spec: blobDataPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/blobs/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/data",
+		},
+		{
+			spec: blobDataPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				layout: 3,
+			},
+			expected: "/docker/registry/v2/blobs/sha256/ab/cd/ef/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/data",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// ErrPinUnknown is returned when removing a pin that is not stored.
+var ErrPinUnknown = errors.New("pin unknown")
+
+// maxPinnedManifestSize is the size of the largest pinned blob read as a
+// manifest by the mark phase, to keep the blobs it references.
+const maxPinnedManifestSize = 4 << 20
+
+// Pin protects content from garbage collection. A pin either names a
+// digest, keeping the blob and, if it is a manifest, the blobs and manifests
+// it references even once no repository links it, or a repository pattern,
+// keeping every blob linked by the matching repositories, including layers
+// not referenced by any manifest.
+type Pin struct {
+	Digest digest.Digest `json:"digest,omitempty"`
+
+	// Repository is a repository name, in which * matches any sequence of
+	// characters.
+	Repository string `json:"repository,omitempty"`
+
+	Comment string    `json:"comment,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Validate returns an error unless exactly one of the digest and the
+// repository of the pin is set.
+func (p Pin) Validate() error {
+	switch {
+	case p.Digest != "" && p.Repository != "":
+		return fmt.Errorf("a pin names either a digest or a repository")
+	case p.Digest != "":
+		return p.Digest.Validate()
+	case p.Repository == "":
+		return fmt.Errorf("a pin must name a digest or a repository")
+	}
+	return nil
+}
+
+// matches returns true if both pins protect the same content.
+func (p Pin) matches(other Pin) bool {
+	return p.Digest == other.Digest && p.Repository == other.Repository
+}
+
+// pinsMu serializes the updates of the stored pins by this process.
+var pinsMu sync.Mutex
+
+// Pins returns the pins stored in the registry, in the order they were added.
+func Pins(ctx context.Context, storageDriver driver.StorageDriver) ([]Pin, error) {
+	pinsPath, err := pathFor(gcPinsPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := storageDriver.GetContent(ctx, pinsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pins []Pin
+	if err := json.Unmarshal(p, &pins); err != nil {
+		return nil, fmt.Errorf("invalid pins: %v", err)
+	}
+	return pins, nil
+}
+
+// AddPin stores a pin, replacing any stored pin of the same digest or
+// repository pattern.
+func AddPin(ctx context.Context, storageDriver driver.StorageDriver, pin Pin) error {
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+
+	return updatePins(ctx, storageDriver, func(pins []Pin) ([]Pin, error) {
+		for i := range pins {
+			if pins[i].matches(pin) {
+				pins[i] = pin
+				return pins, nil
+			}
+		}
+		return append(pins, pin), nil
+	})
+}
+
+// RemovePin removes the stored pin of the same digest or repository pattern
+// as pin, returning ErrPinUnknown if there is none.
+func RemovePin(ctx context.Context, storageDriver driver.StorageDriver, pin Pin) error {
+	return updatePins(ctx, storageDriver, func(pins []Pin) ([]Pin, error) {
+		for i := range pins {
+			if pins[i].matches(pin) {
+				return append(pins[:i], pins[i+1:]...), nil
+			}
+		}
+		return nil, ErrPinUnknown
+	})
+}
+
+// updatePins replaces the stored pins with those returned by fn.
+func updatePins(ctx context.Context, storageDriver driver.StorageDriver, fn func([]Pin) ([]Pin, error)) error {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+
+	pins, err := Pins(ctx, storageDriver)
+	if err != nil {
+		return err
+	}
+
+	pins, err = fn(pins)
+	if err != nil {
+		return err
+	}
+
+	pinsPath, err := pathFor(gcPinsPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(pins)
+	if err != nil {
+		return err
+	}
+
+	return storageDriver.PutContent(ctx, pinsPath, p)
+}
+
+// markPins marks the content protected by pins.
+func markPins(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, pins []Pin, marks *markState) error {
+	visited := make(map[digest.Digest]struct{})
+
+	for _, pin := range pins {
+		if pin.Digest != "" {
+			if err := markPinnedDigest(ctx, namespace, pin.Digest, marks, visited); err != nil {
+				return fmt.Errorf("failed to mark pinned digest %s: %v", pin.Digest, err)
+			}
+			continue
+		}
+
+		err := enumerateRepositories(ctx, namespace, func(name string) error {
+			if !matchPattern(pin.Repository, name) {
+				return nil
+			}
+
+			layersPath, err := pathFor(layersPathSpec{name: name})
+			if err != nil {
+				return err
+			}
+
+			return enumerateLinks(ctx, storageDriver, layersPath, func(_, linked digest.Digest) error {
+				marks.mark(linked)
+				return nil
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark pinned repositories %s: %v", pin.Repository, err)
+		}
+	}
+
+	return nil
+}
+
+// markPinnedDigest marks a pinned blob and, if it is a manifest, the blobs
+// and manifests it references. Blobs already visited are skipped.
+func markPinnedDigest(ctx context.Context, namespace distribution.Namespace, dgst digest.Digest, marks *markState, visited map[digest.Digest]struct{}) error {
+	if _, ok := visited[dgst]; ok {
+		return nil
+	}
+	visited[dgst] = struct{}{}
+	marks.mark(dgst)
+
+	reg, ok := namespace.(*registry)
+	if !ok {
+		return nil
+	}
+
+	desc, err := reg.blobStore.statter.Stat(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return nil
+		}
+		return err
+	}
+	if desc.Size > maxPinnedManifestSize {
+		return nil
+	}
+
+	content, err := reg.blobStore.Get(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return nil
+		}
+		return err
+	}
+
+	manifest, ok := unmarshalPinnedManifest(content)
+	if !ok {
+		return nil
+	}
+
+	for _, descriptor := range manifest.References() {
+		if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+			if err := markPinnedDigest(ctx, namespace, descriptor.Digest, marks, visited); err != nil {
+				return err
+			}
+			continue
+		}
+		marks.mark(descriptor.Digest)
+	}
+
+	if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+		marks.mark(m.Config.Digest)
+	}
+
+	return nil
+}
+
+// unmarshalPinnedManifest parses the content of a pinned blob as a manifest,
+// returning false if it is not one.
+func unmarshalPinnedManifest(content []byte) (distribution.Manifest, bool) {
+	var versioned struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		MediaType     string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(content, &versioned); err != nil {
+		return nil, false
+	}
+
+	mediaType := versioned.MediaType
+	if versioned.SchemaVersion == 1 {
+		mediaType = schema1.MediaTypeSignedManifest
+	}
+
+	switch mediaType {
+	case schema1.MediaTypeSignedManifest, schema2.MediaTypeManifest, manifestlist.MediaTypeManifestList:
+	default:
+		return nil, false
+	}
+
+	manifest, _, err := distribution.UnmarshalManifest(mediaType, content)
+	if err != nil {
+		return nil, false
+	}
+	return manifest, true
+}
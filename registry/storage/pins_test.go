@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// TestPins checks that pinned digests and repositories are kept by garbage
+// collection, whether the pins are stored or passed as options.
+func TestPins(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	reg, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	putBlob := func(repo distribution.Repository, content string) distribution.Descriptor {
+		desc, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte(content))
+		if err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+		desc.MediaType = schema2.MediaTypeLayer
+		return desc
+	}
+
+	baseName, _ := reference.ParseNamed("library/base")
+	base, err := reg.Repository(ctx, baseName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	config := putBlob(base, "{}")
+	config.MediaType = schema2.MediaTypeConfig
+	layer := putBlob(base, "base layer")
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ms, err := base.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDigest, err := ms.Put(ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	// Once deleted, the manifest is only kept by its pin.
+	if err := ms.Delete(ctx, manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+
+	releaseName, _ := reference.ParseNamed("releases/v1")
+	release, err := reg.Repository(ctx, releaseName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	retained := putBlob(release, "retained layer")
+
+	otherName, _ := reference.ParseNamed("other/app")
+	other, err := reg.Repository(ctx, otherName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	orphan := putBlob(other, "orphan layer")
+
+	if err := AddPin(ctx, d, Pin{Digest: manifestDigest, Comment: "base image"}); err != nil {
+		t.Fatalf("unexpected error adding pin: %v", err)
+	}
+	if err := AddPin(ctx, d, Pin{Digest: "sha256:invalid"}); err == nil {
+		t.Fatalf("expected an error adding an invalid pin")
+	}
+	if err := AddPin(ctx, d, Pin{Repository: "other/*"}); err != nil {
+		t.Fatalf("unexpected error adding pin: %v", err)
+	}
+	if err := RemovePin(ctx, d, Pin{Repository: "other/*"}); err != nil {
+		t.Fatalf("unexpected error removing pin: %v", err)
+	}
+	if err := RemovePin(ctx, d, Pin{Repository: "other/*"}); err != ErrPinUnknown {
+		t.Fatalf("unexpected error removing unknown pin: %v", err)
+	}
+
+	pins, err := Pins(ctx, d)
+	if err != nil {
+		t.Fatalf("unexpected error listing pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Digest != manifestDigest || pins[0].Comment != "base image" {
+		t.Fatalf("unexpected pins: %+v", pins)
+	}
+
+	result, err := MarkAndSweep(ctx, d, reg, GCOpts{
+		Pins: []Pin{{Repository: "releases/*"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan.Digest {
+		t.Fatalf("unexpected deleted blobs: %v", result.Deleted)
+	}
+
+	for _, dgst := range []digest.Digest{manifestDigest, config.Digest, layer.Digest, retained.Digest} {
+		if _, err := reg.(*registry).blobStore.Get(ctx, dgst); err != nil {
+			t.Fatalf("pinned blob %s was removed: %v", dgst, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// Referrer is a manifest referring to another manifest as its subject, such
+// as the SBOM of an image.
+type Referrer struct {
+	Digest digest.Digest
+
+	// Linked is the time the referrer was last put.
+	Linked time.Time
+}
+
+// Referrers returns the manifests of the named repository referring to the
+// subject manifest revision, most recently put first. Referrers which were
+// deleted since are not returned.
+func Referrers(ctx context.Context, storageDriver driver.StorageDriver, name string, subject digest.Digest) ([]Referrer, error) {
+	referrersPath, err := pathFor(referrersPathSpec{name: name, subject: subject})
+	if err != nil {
+		return nil, err
+	}
+
+	var referrers []Referrer
+	err = enumerateLinks(ctx, storageDriver, referrersPath, func(dgst, linked digest.Digest) error {
+		revisionLinkPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: linked})
+		if err != nil {
+			return err
+		}
+		if _, err := storageDriver.Stat(ctx, revisionLinkPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				return nil
+			}
+			return err
+		}
+
+		linkPath, err := pathFor(referrerLinkPathSpec{name: name, subject: subject, referrer: dgst})
+		if err != nil {
+			return err
+		}
+		fi, err := storageDriver.Stat(ctx, linkPath)
+		if err != nil {
+			return err
+		}
+
+		referrers = append(referrers, Referrer{Digest: linked, Linked: fi.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Stable(byLinked(referrers))
+	return referrers, nil
+}
+
+// byLinked sorts referrers, most recently put first.
+type byLinked []Referrer
+
+func (a byLinked) Len() int           { return len(a) }
+func (a byLinked) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLinked) Less(i, j int) bool { return a[i].Linked.After(a[j].Linked) }
+
+// linkReferrer links a manifest put to the repository under the revision of
+// its subject, if it has one, so that it can be found with Referrers.
+func (ms *schema2ManifestHandler) linkReferrer(ctx context.Context, revision digest.Digest, mnfst schema2.DeserializedManifest) error {
+	subject, err := mnfst.Subject()
+	if err != nil || subject == nil {
+		return err
+	}
+
+	linkPath, err := pathFor(referrerLinkPathSpec{name: ms.repository.Named().Name(), subject: subject.Digest, referrer: revision})
+	if err != nil {
+		return err
+	}
+
+	return ms.blobStore.blobStore.driver.PutContent(ctx, linkPath, []byte(revision))
+}
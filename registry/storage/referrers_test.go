@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(m interface{}) distribution.Descriptor {
+		content, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("unexpected error marshaling manifest: %v", err)
+		}
+
+		var deserialized schema2.DeserializedManifest
+		if err := deserialized.UnmarshalJSON(content); err != nil {
+			t.Fatalf("unexpected error unmarshaling manifest: %v", err)
+		}
+
+		dgst, err := ms.Put(ctx, &deserialized)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		return distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Size: int64(len(content)), Digest: dgst}
+	}
+
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	image := put(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+
+	referrers, err := Referrers(ctx, d, named.Name(), image.Digest)
+	if err != nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers of image without referrers: %v, %v", referrers, err)
+	}
+
+	emptyConfig, err := blobs.Put(ctx, schema2.MediaTypeEmptyConfig, schema2.EmptyConfig)
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	sbom, err := blobs.Put(ctx, "application/spdx+json", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+	if err != nil {
+		t.Fatalf("unexpected error putting sbom: %v", err)
+	}
+	artifact := put(struct {
+		schema2.Manifest
+		ArtifactType string                   `json:"artifactType"`
+		Subject      *distribution.Descriptor `json:"subject"`
+	}{
+		Manifest: schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    emptyConfig,
+			Layers:    []distribution.Descriptor{sbom},
+		},
+		ArtifactType: "application/spdx+json",
+		Subject:      &image,
+	})
+
+	referrers, err = Referrers(ctx, d, named.Name(), image.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != artifact.Digest || referrers[0].Linked.IsZero() {
+		t.Fatalf("unexpected referrers: %v", referrers)
+	}
+
+	// Deleted referrers are no longer returned.
+	if err := ms.Delete(ctx, artifact.Digest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	referrers, err = Referrers(ctx, d, named.Name(), image.Digest)
+	if err != nil || len(referrers) != 0 {
+		t.Fatalf("unexpected referrers after deletion: %v, %v", referrers, err)
+	}
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
@@ -17,6 +21,30 @@ type registry struct {
 	blobDescriptorCacheProvider cache.BlobDescriptorCacheProvider
 	deleteEnabled               bool
 	resumableDigestEnabled      bool
+
+	// digestAlgorithms is the set of digest algorithms accepted for content
+	// addressing. If nil, any available algorithm is accepted.
+	digestAlgorithms map[digest.Algorithm]struct{}
+
+	// storageClass selects the storage class of layers from the annotations
+	// of image manifests. If nil, layers are left in place.
+	storageClass *storageClassPolicy
+
+	// manifestIndexEnabled indexes the metadata of image manifests when
+	// they are put.
+	manifestIndexEnabled bool
+
+	// locks serializes tag updates and manifest deletions across registry
+	// instances. If nil, nothing is locked.
+	locks *LockManager
+
+	// catalog records the repositories of the registry, listing the catalog
+	// once built. If nil, the catalog is listed by walking the repositories.
+	catalog *CatalogIndex
+
+	// negativeCache remembers the tags and layers recently found missing
+	// from the storage driver. If nil, every lookup reaches the driver.
+	negativeCache *cache.NegativeCache
 }
 
 // RegistryOption is the type used for functional options for NewRegistry.
@@ -43,6 +71,29 @@ func DisableDigestResumption(registry *registry) error {
 	return nil
 }
 
+// DigestAlgorithms returns a functional option for NewRegistry. It restricts
+// the digest algorithms that clients may use to address uploaded blobs and
+// manifests to the provided set. The canonical algorithm is always accepted,
+// since it is used to store content. Content committed with a digest using
+// another accepted algorithm is linked under both digests.
+func DigestAlgorithms(algorithms ...digest.Algorithm) RegistryOption {
+	return func(registry *registry) error {
+		accepted := map[digest.Algorithm]struct{}{
+			digest.Canonical: {},
+		}
+
+		for _, algorithm := range algorithms {
+			if !algorithm.Available() {
+				return fmt.Errorf("digest algorithm %q is not available", algorithm)
+			}
+			accepted[algorithm] = struct{}{}
+		}
+
+		registry.digestAlgorithms = accepted
+		return nil
+	}
+}
+
 // BlobDescriptorCacheProvider returns a functional option for
 // NewRegistry. It creates a cached blob statter for use by the
 // registry.
@@ -63,6 +114,20 @@ func BlobDescriptorCacheProvider(blobDescriptorCacheProvider cache.BlobDescripto
 	}
 }
 
+// NegativeCache returns a functional option for NewRegistry. It reports the
+// tags and layers of repositories found missing from the storage driver as
+// unknown for ttl without looking them up again, remembering at most size
+// misses. Tags and layers added through the registry are found immediately,
+// those added through other instances once their miss expires.
+func NegativeCache(ttl time.Duration, size int) RegistryOption {
+	return func(registry *registry) error {
+		if ttl > 0 {
+			registry.negativeCache = cache.NewNegativeCache(ttl, size)
+		}
+		return nil
+	}
+}
+
 // NewRegistry creates a new registry instance from the provided driver. The
 // resulting registry may be shared by multiple goroutines but is cheap to
 // allocate. If the Redirect option is specified, the backend blob server will
@@ -83,7 +148,7 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		blobServer: &blobServer{
 			driver:  driver,
 			statter: statter,
-			pathFn:  bs.path,
+			pathFn:  bs.locate,
 		},
 		statter:                statter,
 		resumableDigestEnabled: true,
@@ -98,12 +163,34 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 	return registry, nil
 }
 
+// acceptsAlgorithm returns true if content may be addressed by digests using
+// the given algorithm.
+func (reg *registry) acceptsAlgorithm(algorithm digest.Algorithm) bool {
+	if reg.digestAlgorithms == nil {
+		return algorithm.Available()
+	}
+
+	_, ok := reg.digestAlgorithms[algorithm]
+	return ok
+}
+
 // Scope returns the namespace scope for a registry. The registry
 // will only serve repositories contained within this scope.
 func (reg *registry) Scope() distribution.Scope {
 	return distribution.GlobalScope
 }
 
+// StatBlob returns the descriptor of a blob stored in the registry, whichever
+// repositories link it. Blobs are stat'ed in the layouts the registry reads
+// from, if known.
+func StatBlob(ctx context.Context, storageDriver storagedriver.StorageDriver, namespace distribution.Namespace, dgst digest.Digest) (distribution.Descriptor, error) {
+	var statter distribution.BlobStatter = &blobStatter{driver: storageDriver}
+	if reg, ok := namespace.(*registry); ok {
+		statter = reg.statter
+	}
+	return statter.Stat(ctx, dgst)
+}
+
 // Repository returns an instance of the repository tied to the registry.
 // Instances should not be shared between goroutines but are cheap to
 // allocate. In general, they should be request scoped.
@@ -159,6 +246,7 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 	}
 
 	blobStore := &linkedBlobStore{
+		registry:      repo.registry,
 		ctx:           ctx,
 		blobStore:     repo.blobStore,
 		repository:    repo,
@@ -216,15 +304,22 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 // to a request local.
 func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 	var statter distribution.BlobDescriptorService = &linkedBlobStatter{
-		blobStore:   repo.blobStore,
-		repository:  repo,
-		linkPathFns: []linkPathFunc{blobLinkPath},
+		blobStore:       repo.blobStore,
+		repository:      repo,
+		linkPathFns:     []linkPathFunc{blobLinkPath},
+		layerMediaTypes: true,
 	}
 
 	if repo.descriptorCache != nil {
 		statter = cache.NewCachedBlobStatter(repo.descriptorCache, statter)
 	}
 
+	// The negative cache wraps the descriptor cache, which does not pass
+	// the descriptors it is set to the statter it wraps.
+	if repo.registry.negativeCache != nil {
+		statter = cache.NewNegativeBlobStatter(repo.registry.negativeCache, repo.Named().Name(), statter)
+	}
+
 	return &linkedBlobStore{
 		registry:             repo.registry,
 		blobStore:            repo.blobStore,
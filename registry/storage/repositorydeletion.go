@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"path"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// RepositoryDeletion counts the tags and manifests removed by
+// DeleteRepository.
+type RepositoryDeletion struct {
+	Tags      int
+	Manifests int
+}
+
+// DeleteRepository removes repo entirely. Its tags are untagged and its
+// manifests deleted through the services of repo, so that the deletions are
+// journaled and notified like those requested by clients, then the directory
+// of the repository is removed along with its layer links and uploads. The
+// blobs the repository referenced are left to garbage collection. If progress
+// is not nil, it is called after each tag and manifest removed. The deletion
+// stops once ctx is canceled, leaving the repository partially deleted.
+//
+// Manifests can only be deleted if deletion is enabled for the registry of
+// repo. Deleting a repository which does not exist returns
+// distribution.ErrRepositoryUnknown.
+func DeleteRepository(ctx context.Context, storageDriver driver.StorageDriver, repo distribution.Repository, progress func(RepositoryDeletion)) (RepositoryDeletion, error) {
+	name := repo.Named().Name()
+	var deletion RepositoryDeletion
+
+	report := func() {
+		if progress != nil {
+			progress(deletion)
+		}
+	}
+
+	exists, err := RepositoryExists(ctx, storageDriver, name)
+	if err != nil {
+		return deletion, err
+	}
+	if !exists {
+		return deletion, distribution.ErrRepositoryUnknown{Name: name}
+	}
+
+	tagService := repo.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); err != nil && !ok {
+		return deletion, err
+	}
+	for _, tag := range tags {
+		if err := ctx.Err(); err != nil {
+			return deletion, err
+		}
+		if err := tagService.Untag(ctx, tag); err != nil {
+			return deletion, err
+		}
+		deletion.Tags++
+		report()
+	}
+
+	// Revisions are collected before any is deleted, since deleting them
+	// while enumerating could skip some.
+	var revisions []digest.Digest
+	err = enumerateManifestRevisions(ctx, storageDriver, name, func(revision, linked digest.Digest) error {
+		revisions = append(revisions, revision)
+		return nil
+	})
+	if err != nil {
+		return deletion, err
+	}
+
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		return deletion, err
+	}
+	for _, revision := range revisions {
+		if err := ctx.Err(); err != nil {
+			return deletion, err
+		}
+		if err := manifestService.Delete(ctx, revision); err != nil && err != distribution.ErrBlobUnknown {
+			return deletion, err
+		}
+		deletion.Manifests++
+		report()
+	}
+
+	repoPath, err := repositoryPath(name)
+	if err != nil {
+		return deletion, err
+	}
+
+	context.GetLogger(ctx).Infof("deleting repository %s: %d tags and %d manifests removed", name, deletion.Tags, deletion.Manifests)
+	if err := storageDriver.Delete(ctx, repoPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return deletion, err
+		}
+	}
+
+	return deletion, nil
+}
+
+// RepositoryExists returns true if the named repository is stored by
+// storageDriver.
+func RepositoryExists(ctx context.Context, storageDriver driver.StorageDriver, name string) (bool, error) {
+	repoPath, err := repositoryPath(name)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := storageDriver.Stat(ctx, repoPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// repositoryPath returns the directory of the named repository.
+func repositoryPath(name string) (string, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return "", err
+	}
+	return path.Join(root, name), nil
+}
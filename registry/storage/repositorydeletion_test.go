@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestDeleteRepository(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	reg, err := NewRegistry(ctx, d, EnableDelete, EnableJournal)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"first", "second"} {
+		layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte(content))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{layer},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+
+		dgst, err := ms.Put(ctx, m)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		if i == 0 {
+			for _, tag := range []string{"latest", "stable"} {
+				if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+					t.Fatalf("unexpected error tagging manifest: %v", err)
+				}
+			}
+		}
+	}
+
+	var reported []RepositoryDeletion
+	deletion, err := DeleteRepository(ctx, d, repo, func(progress RepositoryDeletion) {
+		reported = append(reported, progress)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	if deletion != (RepositoryDeletion{Tags: 2, Manifests: 2}) {
+		t.Fatalf("unexpected deletion: %+v", deletion)
+	}
+	if len(reported) != 4 || reported[3] != deletion {
+		t.Fatalf("unexpected progress: %+v", reported)
+	}
+
+	repos := make([]string, 10)
+	n, err := reg.Repositories(ctx, repos, "")
+	if n != 0 {
+		t.Fatalf("expected no repositories left, got %v (%v)", repos[:n], err)
+	}
+
+	entries, err := ReadJournal(ctx, d, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error reading journal: %v", err)
+	}
+	var untagged, deleted int
+	for _, entry := range entries {
+		if entry.Repository != "foo/bar" || entry.Action != JournalActionDelete {
+			continue
+		}
+		if entry.Tag != "" {
+			untagged++
+		} else {
+			deleted++
+		}
+	}
+	if untagged != 2 || deleted < 2 {
+		t.Fatalf("expected the deletions to be journaled, got %d untagged and %d deleted", untagged, deleted)
+	}
+
+	// Blobs are left to garbage collection.
+	if _, err := reg.(*registry).statter.Stat(ctx, config.Digest); err != nil {
+		t.Fatalf("expected blob to be kept: %v", err)
+	}
+
+	if _, err := DeleteRepository(ctx, d, repo, nil); err == nil {
+		t.Fatalf("expected deleting a missing repository to fail")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error deleting missing repository: %v", err)
+	}
+}
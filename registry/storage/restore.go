@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// RepositorySnapshot is the state of the tags of a repository at a point in
+// time, reconstructed from the journal.
+type RepositorySnapshot struct {
+	// Tags maps each tag which existed at the time to its manifest digest.
+	Tags map[string]digest.Digest
+
+	// Unknown lists the tags mutated since the time whose state at the
+	// time is not recorded in the journal. These are either tags created
+	// since, or tags last mutated before the journal was enabled, which
+	// the journal cannot tell apart.
+	Unknown []string
+}
+
+// SnapshotRepository reconstructs the tags of repo at the given time by
+// rolling the tags mutated since back to their last journaled state.
+func SnapshotRepository(ctx context.Context, storageDriver driver.StorageDriver, repo distribution.Repository, at time.Time) (RepositorySnapshot, error) {
+	name := repo.Named().Name()
+	snapshot := RepositorySnapshot{Tags: make(map[string]digest.Digest)}
+
+	tagService := repo.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); err != nil && !ok {
+		return snapshot, err
+	}
+	for _, tag := range tags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return snapshot, err
+		}
+		snapshot.Tags[tag] = desc.Digest
+	}
+
+	entries, err := ReadJournal(ctx, storageDriver, time.Time{}, "", 0)
+	if err != nil {
+		return snapshot, err
+	}
+
+	type tagHistory struct {
+		before  *JournalEntry
+		changed bool
+	}
+	history := make(map[string]*tagHistory)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Repository != name || entry.Tag == "" || !isTagStateEntry(name, entry) {
+			continue
+		}
+
+		h, ok := history[entry.Tag]
+		if !ok {
+			h = &tagHistory{}
+			history[entry.Tag] = h
+		}
+		if entry.Time.After(at) {
+			h.changed = true
+		} else {
+			h.before = entry
+		}
+	}
+
+	for tag, h := range history {
+		if !h.changed {
+			continue
+		}
+
+		switch {
+		case h.before == nil:
+			delete(snapshot.Tags, tag)
+			snapshot.Unknown = append(snapshot.Unknown, tag)
+		case h.before.Action == JournalActionLink:
+			snapshot.Tags[tag] = h.before.Digest
+		default:
+			delete(snapshot.Tags, tag)
+		}
+	}
+	sort.Strings(snapshot.Unknown)
+
+	return snapshot, nil
+}
+
+// isTagStateEntry returns true if entry changes which manifest a tag points
+// at: a write of its current link, or a deletion of the tag.
+func isTagStateEntry(name string, entry *JournalEntry) bool {
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: entry.Tag})
+	if err != nil {
+		return false
+	}
+	if entry.Path == currentPath {
+		return true
+	}
+
+	tagPath, err := pathFor(manifestTagPathSpec{name: name, tag: entry.Tag})
+	return err == nil && entry.Action == JournalActionDelete && entry.Path == tagPath
+}
+
+// RestoreResult describes the outcome of restoring a repository to a
+// snapshot.
+type RestoreResult struct {
+	// Tagged lists the tags pointed back at their snapshot manifest.
+	Tagged []string
+
+	// Untagged lists the tags removed because they did not exist in the
+	// snapshot.
+	Untagged []string
+
+	// Missing lists the tags whose snapshot manifest is no longer in the
+	// blob store, which were left unchanged.
+	Missing []string
+}
+
+// RestoreRepository points the tags of repo back at the manifests recorded in
+// tags, and removes the tags not recorded, except those listed in keep.
+// Manifests whose revision was deleted since are linked into the repository
+// again, if still in the blob store.
+func RestoreRepository(ctx context.Context, repo distribution.Repository, tags map[string]digest.Digest, keep []string, dryRun bool) (RestoreResult, error) {
+	var result RestoreResult
+
+	tagService := repo.Tags(ctx)
+	current, err := tagService.All(ctx)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); err != nil && !ok {
+		return result, err
+	}
+
+	kept := make(map[string]struct{}, len(keep))
+	for _, tag := range keep {
+		kept[tag] = struct{}{}
+	}
+
+	for _, tag := range current {
+		if _, ok := tags[tag]; ok {
+			continue
+		}
+		if _, ok := kept[tag]; ok {
+			continue
+		}
+		if !dryRun {
+			if err := tagService.Untag(ctx, tag); err != nil {
+				return result, err
+			}
+		}
+		result.Untagged = append(result.Untagged, tag)
+	}
+
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, tag := range names {
+		dgst := tags[tag]
+		desc, err := tagService.Get(ctx, tag)
+		if err == nil && desc.Digest == dgst {
+			continue
+		}
+		if _, ok := err.(distribution.ErrTagUnknown); err != nil && !ok {
+			return result, err
+		}
+
+		available, err := relinkManifest(ctx, manifests, dgst, dryRun)
+		if err != nil {
+			return result, err
+		}
+		if !available {
+			result.Missing = append(result.Missing, tag)
+			continue
+		}
+
+		if !dryRun {
+			if err := tagService.Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+				return result, err
+			}
+		}
+		result.Tagged = append(result.Tagged, tag)
+	}
+
+	return result, nil
+}
+
+// relinkManifest ensures the manifest with the given digest is a revision of
+// the repository, linking it again from the blob store if its revision was
+// deleted. It returns false if the manifest is not available.
+func relinkManifest(ctx context.Context, manifests distribution.ManifestService, dgst digest.Digest, dryRun bool) (bool, error) {
+	exists, err := manifests.Exists(ctx, dgst)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	ms, ok := manifests.(*manifestStore)
+	if !ok {
+		return false, nil
+	}
+
+	desc, err := ms.repository.blobStore.statter.Stat(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if dryRun {
+		return true, nil
+	}
+	return true, ms.blobStore.linkBlob(ctx, desc)
+}
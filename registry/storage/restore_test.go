@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestSnapshotAndRestoreRepository(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	reg, err := NewRegistry(ctx, d, EnableJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repoRef, _ := reference.ParseNamed("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	// The manifests are only in the blob store, so that restoring has to
+	// link the earlier one into the repository.
+	blobs := reg.(*registry).blobStore
+	first, err := blobs.Put(ctx, "", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := blobs.Put(ctx, "", []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tags.Tag(ctx, "latest", first); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	at := time.Now()
+	time.Sleep(time.Millisecond)
+
+	if err := tags.Tag(ctx, "latest", second); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "next", second); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := SnapshotRepository(ctx, d, repo, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Tags) != 1 || snapshot.Tags["latest"] != first.Digest {
+		t.Fatalf("unexpected snapshot tags: %v", snapshot.Tags)
+	}
+	// The journal cannot tell whether next existed before it was enabled.
+	if !reflect.DeepEqual(snapshot.Unknown, []string{"next"}) {
+		t.Fatalf("unexpected unknown tags: %v", snapshot.Unknown)
+	}
+
+	// A dry run changes nothing, and keeps the unknown tags.
+	result, err := RestoreRepository(ctx, repo, snapshot.Tags, snapshot.Unknown, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, RestoreResult{Tagged: []string{"latest"}}) {
+		t.Fatalf("unexpected dry run result: %#v", result)
+	}
+	if desc, err := tags.Get(ctx, "latest"); err != nil || desc.Digest != second.Digest {
+		t.Fatalf("expected dry run to leave latest unchanged: %v, %v", desc.Digest, err)
+	}
+
+	// Tags not in the snapshot and not kept are removed.
+	result, err = RestoreRepository(ctx, repo, snapshot.Tags, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, RestoreResult{Tagged: []string{"latest"}, Untagged: []string{"next"}}) {
+		t.Fatalf("unexpected restore result: %#v", result)
+	}
+
+	desc, err := tags.Get(ctx, "latest")
+	if err != nil || desc.Digest != first.Digest {
+		t.Fatalf("expected latest to be restored: %v, %v", desc.Digest, err)
+	}
+	if _, err := tags.Get(ctx, "next"); err == nil {
+		t.Fatalf("expected next to be removed")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error getting next: %v", err)
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := manifests.Exists(ctx, first.Digest); err != nil || !exists {
+		t.Fatalf("expected restored manifest to be linked: %v, %v", exists, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/cache"
 )
 
 //schema2ManifestHandler is a ManifestHandler that covers schema2 manifests.
@@ -58,6 +59,14 @@ func (ms *schema2ManifestHandler) Put(ctx context.Context, manifest distribution
 		return "", err
 	}
 
+	if err := ms.linkReferrer(ctx, revision.Digest, *m); err != nil {
+		return "", err
+	}
+
+	ms.recordLayerMediaTypes(ctx, *m)
+	ms.applyStorageClass(ctx, *m)
+	ms.indexManifest(ctx, revision.Digest, *m)
+
 	return revision.Digest, nil
 }
 
@@ -67,27 +76,44 @@ func (ms *schema2ManifestHandler) Put(ctx context.Context, manifest distribution
 func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst schema2.DeserializedManifest, skipDependencyVerification bool) error {
 	var errs distribution.ErrManifestVerification
 
-	if !skipDependencyVerification {
-		target := mnfst.Target()
-		_, err := ms.repository.Blobs(ctx).Stat(ctx, target.Digest)
-		if err != nil {
-			if err != distribution.ErrBlobUnknown {
-				errs = append(errs, err)
-			}
+	annotations, err := mnfst.LayerAnnotations()
+	if err != nil {
+		return err
+	}
 
-			// On error here, we always append unknown blob errors.
-			errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: target.Digest})
+	for i, layer := range mnfst.Layers {
+		if err := schema2.ValidateLayer(layer, annotations[i]); err != nil {
+			errs = append(errs, distribution.ErrManifestBlobInvalid{Digest: layer.Digest, Reason: err})
+		}
+	}
+
+	subject, err := mnfst.Subject()
+	if err != nil {
+		return err
+	}
+	if subject != nil {
+		if err := subject.Digest.Validate(); err != nil {
+			errs = append(errs, distribution.ErrBlobInvalidDigest{Digest: subject.Digest, Reason: err})
+		}
+	}
+
+	if !skipDependencyVerification {
+		// The config and all layers are described at once, the config first.
+		references := append([]distribution.Descriptor{mnfst.Target()}, mnfst.References()...)
+		dgsts := make([]digest.Digest, len(references))
+		for i, reference := range references {
+			dgsts[i] = reference.Digest
 		}
 
-		for _, fsLayer := range mnfst.References() {
-			_, err := ms.repository.Blobs(ctx).Stat(ctx, fsLayer.Digest)
-			if err != nil {
+		_, statErrs := statMany(ctx, ms.repository.Blobs(ctx), dgsts)
+		for i, reference := range references {
+			if err := statErrs[i]; err != nil {
 				if err != distribution.ErrBlobUnknown {
 					errs = append(errs, err)
 				}
 
 				// On error here, we always append unknown blob errors.
-				errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: fsLayer.Digest})
+				errs = append(errs, distribution.ErrManifestBlobUnknown{Digest: reference.Digest})
 			}
 		}
 	}
@@ -97,3 +123,48 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 
 	return nil
 }
+
+// recordLayerMediaTypes stores the media types the manifest declares for its
+// layers in the repository, once the manifest is stored, so that blob
+// requests report the layer compression (such as zstd) rather than a generic
+// type. The media types are recorded for the repository only: other
+// repositories may declare the same blobs with other types.
+func (ms *schema2ManifestHandler) recordLayerMediaTypes(ctx context.Context, mnfst schema2.DeserializedManifest) {
+	blobs := ms.repository.Blobs(ctx)
+	setter, _ := ms.repository.descriptorCache.(cache.RepositoryMediaTypeSetter)
+
+	for _, layer := range mnfst.Layers {
+		if _, ok := schema2.LayerCompression(layer.MediaType); !ok {
+			continue
+		}
+
+		// Layers not stored, if dependencies were not verified, or already
+		// of the declared type are left alone.
+		desc, err := blobs.Stat(ctx, layer.Digest)
+		if err != nil || desc.MediaType == layer.MediaType {
+			continue
+		}
+
+		if err := ms.recordLayerMediaType(ctx, layer.Digest, layer.MediaType); err != nil {
+			context.GetLogger(ctx).Errorf("error recording media type of layer %s: %v", layer.Digest, err)
+			continue
+		}
+
+		if setter != nil {
+			if err := setter.SetRepositoryMediaType(ctx, layer.Digest, layer.MediaType); err != nil && err != distribution.ErrBlobUnknown {
+				context.GetLogger(ctx).Errorf("error caching media type of layer %s: %v", layer.Digest, err)
+			}
+		}
+	}
+}
+
+// recordLayerMediaType stores the media type of the layer linked in the
+// repository as dgst.
+func (ms *schema2ManifestHandler) recordLayerMediaType(ctx context.Context, dgst digest.Digest, mediaType string) error {
+	mediaTypePath, err := pathFor(layerMediaTypePathSpec{name: ms.repository.Named().Name(), digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	return ms.blobStore.driver.PutContent(ctx, mediaTypePath, []byte(mediaType))
+}
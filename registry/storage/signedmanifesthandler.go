@@ -130,9 +130,15 @@ func (ms *signedManifestHandler) verifyManifest(ctx context.Context, mnfst schem
 	}
 
 	if !skipDependencyVerification {
-		for _, fsLayer := range mnfst.References() {
-			_, err := ms.repository.Blobs(ctx).Stat(ctx, fsLayer.Digest)
-			if err != nil {
+		references := mnfst.References()
+		dgsts := make([]digest.Digest, len(references))
+		for i, fsLayer := range references {
+			dgsts[i] = fsLayer.Digest
+		}
+
+		_, statErrs := statMany(ctx, ms.repository.Blobs(ctx), dgsts)
+		for i, fsLayer := range references {
+			if err := statErrs[i]; err != nil {
 				if err != distribution.ErrBlobUnknown {
 					errs = append(errs, err)
 				}
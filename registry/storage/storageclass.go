@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// DefaultStorageClassAnnotation is the manifest annotation naming the storage
+// class of the layers of an image unless another is configured.
+const DefaultStorageClassAnnotation = "storage-class"
+
+// storageClassPolicy maps the value of a manifest annotation to the storage
+// class the layers of the manifest are moved to.
+type storageClassPolicy struct {
+	annotation string
+	classes    map[string]string
+}
+
+// StorageClassAnnotation returns a functional option for NewRegistry. When an
+// image manifest carrying the annotation is put, the layers it references are
+// moved to the storage class named by the value of the annotation, mapped
+// through classes if it is not empty. Values missing from a non-empty classes
+// map are ignored. Storage drivers not implementing StorageClasser leave
+// layers in place.
+func StorageClassAnnotation(annotation string, classes map[string]string) RegistryOption {
+	return func(registry *registry) error {
+		if annotation == "" {
+			return fmt.Errorf("storage class annotation must not be empty")
+		}
+
+		registry.storageClass = &storageClassPolicy{
+			annotation: annotation,
+			classes:    classes,
+		}
+		return nil
+	}
+}
+
+// class returns the storage class requested by the annotations of a manifest,
+// and false if none is.
+func (p *storageClassPolicy) class(annotations map[string]string) (string, bool) {
+	value, ok := annotations[p.annotation]
+	if !ok || value == "" {
+		return "", false
+	}
+
+	if len(p.classes) == 0 {
+		return value, true
+	}
+
+	class, ok := p.classes[value]
+	return class, ok
+}
+
+// applyStorageClass moves the layers of the manifest to the storage class
+// requested by its annotations. Failures are logged rather than returned: the
+// manifest is stored regardless of the storage class of its layers.
+func (ms *schema2ManifestHandler) applyStorageClass(ctx context.Context, mnfst schema2.DeserializedManifest) {
+	policy := ms.repository.storageClass
+	if policy == nil {
+		return
+	}
+
+	annotations, err := mnfst.Annotations()
+	if err != nil {
+		context.GetLogger(ctx).Errorf("error reading manifest annotations: %v", err)
+		return
+	}
+
+	class, ok := policy.class(annotations)
+	if !ok {
+		return
+	}
+
+	bs := ms.repository.blobStore
+	for _, layer := range mnfst.Layers {
+		if err := setBlobStorageClass(ctx, bs, layer.Digest, class); err != nil {
+			if _, ok := err.(driver.ErrUnsupportedMethod); ok {
+				context.GetLogger(ctx).Warnf("storage driver does not support storage classes, layers left in place: %v", err)
+				return
+			}
+			context.GetLogger(ctx).Errorf("error moving layer %s to storage class %q: %v", layer.Digest, class, err)
+		}
+	}
+}
+
+// setBlobStorageClass moves the data of the blob identified by dgst to the
+// named storage class.
+func setBlobStorageClass(ctx context.Context, bs *blobStore, dgst digest.Digest, class string) error {
+	p, _, err := bs.layout.stat(ctx, bs.driver, dgst)
+	if err != nil {
+		return err
+	}
+
+	return driver.SetStorageClass(ctx, bs.driver, p, class)
+}
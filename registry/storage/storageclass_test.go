@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// storageClassDriver records the storage classes set on the objects of an
+// inmemory driver.
+type storageClassDriver struct {
+	storagedriver.StorageDriver
+	classes map[string]string
+}
+
+func (d *storageClassDriver) SetStorageClass(ctx context.Context, path string, class string) error {
+	if _, err := d.Stat(ctx, path); err != nil {
+		return err
+	}
+	d.classes[path] = class
+	return nil
+}
+
+func TestStorageClassAnnotation(t *testing.T) {
+	ctx := context.Background()
+	d := &storageClassDriver{StorageDriver: inmemory.New(), classes: make(map[string]string)}
+
+	registry, err := NewRegistry(ctx, d, StorageClassAnnotation(DefaultStorageClassAnnotation, map[string]string{"cold": "archive"}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(annotations map[string]string) {
+		content, err := json.Marshal(struct {
+			schema2.Manifest
+			Annotations map[string]string `json:"annotations,omitempty"`
+		}{
+			Manifest: schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config:    config,
+				Layers:    []distribution.Descriptor{layer},
+			},
+			Annotations: annotations,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling manifest: %v", err)
+		}
+
+		var m schema2.DeserializedManifest
+		if err := m.UnmarshalJSON(content); err != nil {
+			t.Fatalf("unexpected error unmarshaling manifest: %v", err)
+		}
+
+		if _, err := ms.Put(ctx, &m); err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+	}
+
+	layerPath, err := pathFor(blobDataPathSpec{digest: layer.Digest, layout: DefaultBlobPathLayout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values not mapped to a storage class are ignored.
+	put(nil)
+	put(map[string]string{DefaultStorageClassAnnotation: "lukewarm"})
+	if len(d.classes) != 0 {
+		t.Fatalf("unexpected storage classes set: %v", d.classes)
+	}
+
+	put(map[string]string{DefaultStorageClassAnnotation: "cold"})
+	if len(d.classes) != 1 || d.classes[layerPath] != "archive" {
+		t.Fatalf("expected only the layer to be archived, got %v", d.classes)
+	}
+}
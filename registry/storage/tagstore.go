@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"fmt"
 	"path"
+	"sort"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
@@ -72,6 +75,13 @@ func (ts *tagStore) exists(ctx context.Context, tag string) (bool, error) {
 // Tag tags the digest with the given tag, updating the the store to point at
 // the current tag. The digest must point to a manifest.
 func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	return ts.tagIf(ctx, tag, desc, nil)
+}
+
+// tagIf tags the digest with the given tag if match, when not nil, accepts
+// the digest the tag currently points at. With a lock manager, match is
+// called while holding the lock of the tag.
+func (ts *tagStore) tagIf(ctx context.Context, tag string, desc distribution.Descriptor, match func(current digest.Digest) bool) error {
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -81,6 +91,41 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	if locks := ts.repository.registry.locks; locks != nil {
+		// Hold the lock of the manifest, then of the tag, as the deletion
+		// of the manifest does, so that the tag is not moved to a manifest
+		// being deleted.
+		unlockManifest, err := locks.Lock(ctx, manifestLockName(ts.repository.Named().Name(), desc.Digest))
+		if err != nil {
+			return err
+		}
+		defer unlockManifest()
+
+		unlockTag, err := locks.Lock(ctx, tagLockName(ts.repository.Named().Name(), tag))
+		if err != nil {
+			return err
+		}
+		defer unlockTag()
+
+		manifests, err := ts.repository.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+		exists, err := manifests.Exists(ctx, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return distribution.ErrManifestUnknownRevision{Name: ts.repository.Named().Name(), Revision: desc.Digest}
+		}
+	}
+
+	if match != nil {
+		if err := checkTag(ctx, ts.get, tag, match); err != nil {
+			return err
+		}
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -89,11 +134,57 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 	}
 
 	// Overwrite the current link
-	return ts.blobStore.link(ctx, currentPath, desc.Digest)
+	if err := ts.blobStore.link(ctx, currentPath, desc.Digest); err != nil {
+		return err
+	}
+
+	// Record when the tag was updated, so that tags can be listed most
+	// recently pushed first.
+	updatedAtPath, err := pathFor(manifestTagUpdatedAtPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ts.blobStore.driver.PutContent(ctx, updatedAtPath, []byte(time.Now().UTC().Format(time.RFC3339Nano))); err != nil {
+		return err
+	}
+
+	if nc := ts.repository.registry.negativeCache; nc != nil {
+		nc.Remove(ts.negativeKey(tag))
+	}
+	return nil
+}
+
+// negativeKey returns the key of the tag in the negative cache.
+func (ts *tagStore) negativeKey(tag string) string {
+	return ts.repository.Named().Name() + ":" + tag
 }
 
-// resolve the current revision for name and tag.
+// resolve the current revision for name and tag. With a negative cache, tags
+// recently found missing are reported unknown without reading their link.
 func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	nc := ts.repository.registry.negativeCache
+	if nc == nil {
+		return ts.get(ctx, tag)
+	}
+
+	key := ts.negativeKey(tag)
+	if nc.Contains(key) {
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	}
+
+	desc, err := ts.get(ctx, tag)
+	if _, ok := err.(distribution.ErrTagUnknown); ok {
+		nc.Add(key)
+	}
+	return desc, err
+}
+
+// get resolves the current revision for name and tag from its link. Updates
+// of the tag read it with get, so that they never act on a cached miss.
+func (ts *tagStore) get(ctx context.Context, tag string) (distribution.Descriptor, error) {
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -118,6 +209,40 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 
 // Untag removes the tag association
 func (ts *tagStore) Untag(ctx context.Context, tag string) error {
+	unlock, err := ts.repository.registry.locks.Lock(ctx, tagLockName(ts.repository.Named().Name(), tag))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return ts.untag(ctx, tag)
+}
+
+// untagIf removes the tag association if the tag points at dgst, and reports
+// whether it did.
+func (ts *tagStore) untagIf(ctx context.Context, tag string, dgst digest.Digest) (bool, error) {
+	unlock, err := ts.repository.registry.locks.Lock(ctx, tagLockName(ts.repository.Named().Name(), tag))
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	desc, err := ts.get(ctx, tag)
+	if err != nil {
+		if _, ok := err.(distribution.ErrTagUnknown); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	if desc.Digest != dgst {
+		return false, nil
+	}
+
+	return true, ts.untag(ctx, tag)
+}
+
+// untag removes the tag association, while holding the lock of the tag.
+func (ts *tagStore) untag(ctx context.Context, tag string) error {
 	tagPath, err := pathFor(manifestTagPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -132,7 +257,27 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		return err
 	}
 
-	return ts.blobStore.driver.Delete(ctx, tagPath)
+	// Record when the tagged revision was untagged, from which the untagged
+	// manifest cleanup policy measures the age of untagged manifests.
+	if desc, err := ts.get(ctx, tag); err == nil {
+		untaggedPath, err := pathFor(manifestUntaggedPathSpec{
+			name:     ts.repository.Named().Name(),
+			revision: desc.Digest,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := ts.blobStore.driver.PutContent(ctx, untaggedPath, []byte(tag)); err != nil {
+			return err
+		}
+	}
+
+	if err := ts.blobStore.driver.Delete(ctx, tagPath); err != nil {
+		return err
+	}
+
+	return ts.blobStore.journal.record(ctx, JournalActionDelete, tagPath, "")
 }
 
 // linkedBlobStore returns the linkedBlobStore for the named tag, allowing one
@@ -189,3 +334,148 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 
 	return tags, nil
 }
+
+// updatedAt returns the time the tag was last updated. Tags last updated
+// before the time was recorded fall back to the modification time of their
+// current link, which is rewritten on each update.
+func (ts *tagStore) updatedAt(ctx context.Context, tag string) (time.Time, error) {
+	updatedAtPath, err := pathFor(manifestTagUpdatedAtPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	content, err := ts.blobStore.driver.GetContent(ctx, updatedAtPath)
+	switch err.(type) {
+	case nil:
+		return time.Parse(time.RFC3339Nano, string(content))
+	case storagedriver.PathNotFoundError:
+	default:
+		return time.Time{}, err
+	}
+
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fi, err := ts.blobStore.driver.Stat(ctx, currentPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return time.Time{}, distribution.ErrTagUnknown{Tag: tag}
+		}
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// TagsByLastUpdate returns the tags of the tag service, most recently
+// updated first, tags updated at the same time being sorted by name. Tags
+// removed while they are listed are left out. Tag services not backed by the
+// storage of the registry, such as those of a pull through cache, return
+// distribution.ErrUnsupported.
+func TagsByLastUpdate(ctx context.Context, tags distribution.TagService) ([]string, error) {
+	ts, ok := tags.(*tagStore)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+
+	all, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(tagUpdates, 0, len(all))
+	for _, tag := range all {
+		t, err := ts.updatedAt(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, err
+		}
+		updates = append(updates, tagUpdate{tag: tag, updatedAt: t})
+	}
+	sort.Sort(updates)
+
+	ordered := make([]string, len(updates))
+	for i, update := range updates {
+		ordered[i] = update.tag
+	}
+	return ordered, nil
+}
+
+type tagUpdate struct {
+	tag       string
+	updatedAt time.Time
+}
+
+// tagUpdates sorts tags most recently updated first, then by name.
+type tagUpdates []tagUpdate
+
+func (u tagUpdates) Len() int      { return len(u) }
+func (u tagUpdates) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u tagUpdates) Less(i, j int) bool {
+	if !u[i].updatedAt.Equal(u[j].updatedAt) {
+		return u[i].updatedAt.After(u[j].updatedAt)
+	}
+	return u[i].tag < u[j].tag
+}
+
+// TagPreconditionError is returned by TagIf when the tag does not point at
+// an expected manifest.
+type TagPreconditionError struct {
+	Tag string
+
+	// Current is the digest the tag points at, empty if the tag does not
+	// exist.
+	Current digest.Digest
+}
+
+func (err TagPreconditionError) Error() string {
+	if err.Current == "" {
+		return fmt.Sprintf("tag %s does not exist", err.Tag)
+	}
+	return fmt.Sprintf("tag %s points at unexpected manifest %s", err.Tag, err.Current)
+}
+
+// TagIf tags the digest with the given tag, as tags.Tag does, if match
+// accepts the digest the tag currently points at, empty if the tag does not
+// exist. Otherwise the tag is left unchanged and a TagPreconditionError is
+// returned. With a lock manager, the tag cannot be moved by another update
+// between the check and the update; without one, the check is only best
+// effort.
+func TagIf(ctx context.Context, tags distribution.TagService, tag string, desc distribution.Descriptor, match func(current digest.Digest) bool) error {
+	if ts, ok := tags.(*tagStore); ok {
+		return ts.tagIf(ctx, tag, desc, match)
+	}
+
+	if err := checkTag(ctx, tags.Get, tag, match); err != nil {
+		return err
+	}
+	return tags.Tag(ctx, tag, desc)
+}
+
+// checkTag returns a TagPreconditionError if match does not accept the digest
+// the tag points at, as resolved by get.
+func checkTag(ctx context.Context, get func(context.Context, string) (distribution.Descriptor, error), tag string, match func(current digest.Digest) bool) error {
+	var current digest.Digest
+	desc, err := get(ctx, tag)
+	switch err.(type) {
+	case nil:
+		current = desc.Digest
+	case distribution.ErrTagUnknown:
+	default:
+		return err
+	}
+
+	if !match(current) {
+		return TagPreconditionError{Tag: tag, Current: current}
+	}
+	return nil
+}
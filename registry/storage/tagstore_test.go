@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 )
@@ -206,3 +209,100 @@ func TestTagLookup(t *testing.T) {
 	}
 
 }
+
+func TestTagIf(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts
+	ctx := env.ctx
+
+	descA := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	descB := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	matchA := func(current digest.Digest) bool { return current == descA.Digest }
+
+	err := TagIf(ctx, tags, "latest", descB, matchA)
+	if err != (TagPreconditionError{Tag: "latest"}) {
+		t.Fatalf("expected a precondition error tagging a missing tag, got %v", err)
+	}
+
+	if err := tags.Tag(ctx, "latest", descA); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagIf(ctx, tags, "latest", descB, matchA); err != nil {
+		t.Fatalf("unexpected error tagging a matching tag: %v", err)
+	}
+
+	// The tag now points at descB, so that a second update expecting
+	// descA fails.
+	err = TagIf(ctx, tags, "latest", descA, matchA)
+	if err != (TagPreconditionError{Tag: "latest", Current: descB.Digest}) {
+		t.Fatalf("expected a precondition error tagging a moved tag, got %v", err)
+	}
+
+	desc, err := tags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != descB.Digest {
+		t.Errorf("tag moved by a failed update: %s", desc.Digest)
+	}
+}
+
+func TestTagsByLastUpdate(t *testing.T) {
+	env := testTagStore(t)
+	ts := env.ts.(*tagStore)
+	ctx := env.ctx
+
+	d := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	for _, tag := range []string{"old", "new", "same1", "same2", "legacy"} {
+		if err := ts.Tag(ctx, tag, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated, err := ts.updatedAt(ctx, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(updated) > time.Minute {
+		t.Fatalf("unexpected update time of a tag just pushed: %v", updated)
+	}
+
+	base := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	for tag, at := range map[string]time.Time{
+		"old":   base,
+		"new":   base.Add(2 * time.Hour),
+		"same1": base.Add(time.Hour),
+		"same2": base.Add(time.Hour),
+	} {
+		p, err := pathFor(manifestTagUpdatedAtPathSpec{name: "a/b", tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.blobStore.driver.PutContent(ctx, p, []byte(at.Format(time.RFC3339Nano))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tags pushed before update times were recorded fall back to the
+	// modification time of their current link.
+	p, err := pathFor(manifestTagUpdatedAtPathSpec{name: "a/b", tag: "legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.blobStore.driver.Delete(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := TagsByLastUpdate(ctx, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"legacy", "new", "same1", "same2", "old"}; !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("unexpected tags %v, expected %v", tags, expected)
+	}
+
+	wrapped := struct{ distribution.TagService }{ts}
+	if _, err := TagsByLastUpdate(ctx, wrapped); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ordering the tags of another tag service to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// TieringOpts configures TierBlobs.
+type TieringOpts struct {
+	// Age is the time since a blob was last read, or pushed if it was never
+	// read, after which it is moved to the cold storage class.
+	Age time.Duration
+
+	// MinSize is the size of the smallest blob moved, keeping manifests and
+	// image configurations, read by the registry itself, in place.
+	MinSize int64
+
+	// ColdClass is the storage class blobs are moved to.
+	ColdClass string
+
+	// DryRun only reports the blobs which would be moved.
+	DryRun bool
+}
+
+// RecallOpts configures RecallBlob.
+type RecallOpts struct {
+	// HotClass is the storage class recalled blobs are moved back to.
+	HotClass string
+
+	// RestoreDays is the number of days archived blobs are kept readable
+	// while they are moved back to the hot storage class.
+	RestoreDays int
+}
+
+// TieredBlob describes a blob moved to the cold storage class.
+type TieredBlob struct {
+	Digest     digest.Digest
+	Size       int64
+	AccessedAt time.Time
+}
+
+// RecordBlobAccess records that the blob dgst was read by a client at t.
+func RecordBlobAccess(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest, t time.Time) error {
+	accessedAtPath, err := pathFor(blobAccessedAtPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, accessedAtPath, []byte(t.UTC().Format(time.RFC3339)))
+}
+
+// blobAccessedAt returns when the blob dgst was last read by a client, or the
+// zero time if its reads were never recorded.
+func blobAccessedAt(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) (time.Time, error) {
+	accessedAtPath, err := pathFor(blobAccessedAtPathSpec{digest: dgst})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	content, err := storageDriver.GetContent(ctx, accessedAtPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+}
+
+// BlobColdClass returns the cold storage class the blob dgst was moved to, or
+// the empty string if it is hot.
+func BlobColdClass(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) (string, error) {
+	coldPath, err := pathFor(blobColdPathSpec{digest: dgst})
+	if err != nil {
+		return "", err
+	}
+
+	content, err := storageDriver.GetContent(ctx, coldPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// TierBlobs moves the data of the blobs of the blob store not read for
+// opts.Age to the storage class opts.ColdClass, and returns them. The driver
+// must implement driver.StorageClasser. The tiering records of the blobs
+// deleted by garbage collection are left behind: should a blob be pushed
+// again, it is found readable and marked hot by its first recall.
+func TierBlobs(ctx context.Context, storageDriver driver.StorageDriver, opts TieringOpts) ([]TieredBlob, error) {
+	var tiered []TieredBlob
+	now := time.Now()
+	err := walkBlobs(ctx, storageDriver, func(dgst digest.Digest, layout int) error {
+		dataPath, err := pathFor(blobDataPathSpec{digest: dgst, layout: layout})
+		if err != nil {
+			return err
+		}
+		fi, err := storageDriver.Stat(ctx, dataPath)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// Deleted since listed, or not completely written.
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() || fi.Size() < opts.MinSize {
+			return nil
+		}
+
+		class, err := BlobColdClass(ctx, storageDriver, dgst)
+		if err != nil || class != "" {
+			return err
+		}
+
+		accessedAt, err := blobAccessedAt(ctx, storageDriver, dgst)
+		if err != nil {
+			return err
+		}
+		if accessedAt.IsZero() {
+			accessedAt = fi.ModTime()
+		}
+		if now.Sub(accessedAt) < opts.Age {
+			return nil
+		}
+
+		if !opts.DryRun {
+			if err := driver.SetStorageClass(ctx, storageDriver, dataPath, opts.ColdClass); err != nil {
+				return err
+			}
+			coldPath, err := pathFor(blobColdPathSpec{digest: dgst})
+			if err != nil {
+				return err
+			}
+			if err := storageDriver.PutContent(ctx, coldPath, []byte(opts.ColdClass)); err != nil {
+				return err
+			}
+		}
+
+		tiered = append(tiered, TieredBlob{
+			Digest:     dgst,
+			Size:       fi.Size(),
+			AccessedAt: accessedAt,
+		})
+		return nil
+	})
+	return tiered, err
+}
+
+// RecallBlob returns whether the blob dgst can be read. A blob moved to a cold
+// storage class is moved back to opts.HotClass once readable: blobs archived
+// by drivers implementing driver.Restorer must be restored first, in which
+// case their restore is requested and false returned until it completes.
+// Blobs are located in the layouts the registry reads from, if known.
+func RecallBlob(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, dgst digest.Digest, opts RecallOpts) (bool, error) {
+	class, err := BlobColdClass(ctx, storageDriver, dgst)
+	if err != nil || class == "" {
+		return err == nil, err
+	}
+
+	layout := blobPathLayout{version: DefaultBlobPathLayout}
+	if reg, ok := namespace.(*registry); ok {
+		layout = reg.blobStore.layout
+	}
+	dataPath, _, err := layout.stat(ctx, storageDriver, dgst)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, distribution.ErrBlobUnknown
+		}
+		return false, err
+	}
+
+	readable, err := driver.Restore(ctx, storageDriver, dataPath, opts.RestoreDays)
+	if err != nil || !readable {
+		return false, err
+	}
+
+	if err := driver.SetStorageClass(ctx, storageDriver, dataPath, opts.HotClass); err != nil {
+		return false, err
+	}
+	coldPath, err := pathFor(blobColdPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	if err := storageDriver.Delete(ctx, coldPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return false, err
+		}
+	}
+	context.GetLogger(ctx).Infof("tiering: recalled blob %s from storage class %q", dgst, class)
+	return true, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// archivingDriver is an in-memory driver with an archive storage class,
+// whose objects are restored on the second call to Restore.
+type archivingDriver struct {
+	storagedriver.StorageDriver
+
+	mu        sync.Mutex
+	classes   map[string]string
+	restoring map[string]bool
+}
+
+func newArchivingDriver() *archivingDriver {
+	return &archivingDriver{
+		StorageDriver: inmemory.New(),
+		classes:       make(map[string]string),
+		restoring:     make(map[string]bool),
+	}
+}
+
+func (d *archivingDriver) SetStorageClass(ctx context.Context, path string, class string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.classes[path] = class
+	delete(d.restoring, path)
+	return nil
+}
+
+func (d *archivingDriver) Restore(ctx context.Context, path string, days int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.classes[path] != "archive" {
+		return true, nil
+	}
+	if d.restoring[path] {
+		return true, nil
+	}
+	d.restoring[path] = true
+	return false, nil
+}
+
+func TestTierBlobs(t *testing.T) {
+	ctx := context.Background()
+	driver := newArchivingDriver()
+
+	blobs := map[string][]byte{
+		"unread": make([]byte, 2048),
+		"read":   append(make([]byte, 2048), 1),
+		"small":  []byte("config"),
+	}
+	digests := make(map[string]digest.Digest)
+	for name, content := range blobs {
+		dgst := digest.FromBytes(content)
+		dataPath, _ := pathFor(blobDataPathSpec{digest: dgst})
+		if err := driver.PutContent(ctx, dataPath, content); err != nil {
+			t.Fatalf("unexpected error writing blob: %v", err)
+		}
+		digests[name] = dgst
+	}
+	if err := RecordBlobAccess(ctx, driver, digests["read"], time.Now()); err != nil {
+		t.Fatalf("unexpected error recording blob access: %v", err)
+	}
+
+	opts := TieringOpts{Age: time.Hour, MinSize: 1024, ColdClass: "archive"}
+	tiered, err := TierBlobs(ctx, driver, opts)
+	if err != nil || len(tiered) != 0 {
+		t.Fatalf("unexpected blobs tiered: %v, %v", tiered, err)
+	}
+
+	// Without an age, every large blob is tiered, but not by a dry run.
+	opts.Age = 0
+	opts.DryRun = true
+	tiered, err = TierBlobs(ctx, driver, opts)
+	if err != nil || len(tiered) != 2 {
+		t.Fatalf("unexpected blobs to tier: %v, %v", tiered, err)
+	}
+	if class, _ := BlobColdClass(ctx, driver, digests["unread"]); class != "" {
+		t.Fatalf("unexpected blob tiered by a dry run")
+	}
+
+	opts.DryRun = false
+	if err := RecordBlobAccess(ctx, driver, digests["read"], time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error recording blob access: %v", err)
+	}
+	tiered, err = TierBlobs(ctx, driver, opts)
+	if err != nil || len(tiered) != 1 || tiered[0].Digest != digests["unread"] || tiered[0].Size != 2048 {
+		t.Fatalf("unexpected blobs tiered: %v, %v", tiered, err)
+	}
+	dataPath, _ := pathFor(blobDataPathSpec{digest: digests["unread"]})
+	if class, _ := BlobColdClass(ctx, driver, digests["unread"]); class != "archive" || driver.classes[dataPath] != "archive" {
+		t.Fatalf("expected the unread blob to be archived, got %q", class)
+	}
+
+	// The archived blob is restored before it is moved back.
+	recall := RecallOpts{HotClass: "standard", RestoreDays: 1}
+	if readable, err := RecallBlob(ctx, driver, nil, digests["unread"], recall); err != nil || readable {
+		t.Fatalf("expected the blob to be restored: %v, %v", readable, err)
+	}
+	if readable, err := RecallBlob(ctx, driver, nil, digests["unread"], recall); err != nil || !readable {
+		t.Fatalf("expected the blob to be recalled: %v, %v", readable, err)
+	}
+	if class, _ := BlobColdClass(ctx, driver, digests["unread"]); class != "" || driver.classes[dataPath] != "standard" {
+		t.Fatalf("expected the recalled blob to be hot, got %q", class)
+	}
+	if readable, err := RecallBlob(ctx, driver, nil, digests["read"], recall); err != nil || !readable {
+		t.Fatalf("expected a hot blob to be readable: %v, %v", readable, err)
+	}
+
+	// Drivers without storage classes cannot tier blobs.
+	if _, err := TierBlobs(ctx, inmemory.New(), opts); err != nil {
+		t.Fatalf("unexpected error tiering an empty blob store: %v", err)
+	}
+	plain := inmemory.New()
+	plain.PutContent(ctx, dataPath, blobs["unread"])
+	if _, err := TierBlobs(ctx, plain, opts); err == nil {
+		t.Fatalf("expected an error tiering blobs without storage classes")
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// ErrTrustMetadataUnknown is returned when no trust metadata is stored for a
+// role, or no revision with the requested digest.
+var ErrTrustMetadataUnknown = errors.New("trust metadata unknown")
+
+// TrustStore stores the trust metadata of a repository, such as TUF roles,
+// alongside the repository in the storage backend. Every revision of the
+// metadata of a role is kept, addressed by its digest, and a link points to
+// the current revision.
+type TrustStore struct {
+	driver storagedriver.StorageDriver
+	name   string
+}
+
+// NewTrustStore returns a TrustStore for the trust metadata of the named
+// repository.
+func NewTrustStore(driver storagedriver.StorageDriver, name reference.Named) *TrustStore {
+	return &TrustStore{
+		driver: driver,
+		name:   name.Name(),
+	}
+}
+
+// Get returns the current revision of the trust metadata of role, and its
+// digest.
+func (ts *TrustStore) Get(ctx context.Context, role string) ([]byte, digest.Digest, error) {
+	currentPath, err := pathFor(trustRoleCurrentPathSpec{
+		name: ts.name,
+		role: role,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := ts.driver.GetContent(ctx, currentPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, "", ErrTrustMetadataUnknown
+		}
+		return nil, "", err
+	}
+
+	dgst, err := digest.ParseDigest(string(content))
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err = ts.GetRevision(ctx, role, dgst)
+	return content, dgst, err
+}
+
+// GetRevision returns the revision of the trust metadata of role with the
+// given digest.
+func (ts *TrustStore) GetRevision(ctx context.Context, role string, dgst digest.Digest) ([]byte, error) {
+	revisionPath, err := pathFor(trustRoleRevisionPathSpec{
+		name:     ts.name,
+		role:     role,
+		revision: dgst,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ts.driver.GetContent(ctx, revisionPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, ErrTrustMetadataUnknown
+		}
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// Put stores content as a new revision of the trust metadata of role and
+// makes it the current revision. It returns the digest of the revision.
+func (ts *TrustStore) Put(ctx context.Context, role string, content []byte) (digest.Digest, error) {
+	dgst := digest.FromBytes(content)
+
+	revisionPath, err := pathFor(trustRoleRevisionPathSpec{
+		name:     ts.name,
+		role:     role,
+		revision: dgst,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	currentPath, err := pathFor(trustRoleCurrentPathSpec{
+		name: ts.name,
+		role: role,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := ts.driver.PutContent(ctx, revisionPath, content); err != nil {
+		return "", err
+	}
+
+	// The revision is written first, so the link never points to missing
+	// content.
+	if err := ts.driver.PutContent(ctx, currentPath, []byte(dgst)); err != nil {
+		return "", err
+	}
+
+	return dgst, nil
+}
+
+// Delete removes all revisions of the trust metadata of role. The metadata of
+// roles delegated to by role is kept.
+func (ts *TrustStore) Delete(ctx context.Context, role string) error {
+	currentPath, err := pathFor(trustRoleCurrentPathSpec{
+		name: ts.name,
+		role: role,
+	})
+	if err != nil {
+		return err
+	}
+
+	revisionsPath, err := pathFor(trustRoleRevisionsPathSpec{
+		name: ts.name,
+		role: role,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ts.driver.Delete(ctx, currentPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return ErrTrustMetadataUnknown
+		}
+		return err
+	}
+
+	if err := ts.driver.Delete(ctx, revisionsPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestTrustStore(t *testing.T) {
+	ctx := context.Background()
+	name, _ := reference.ParseNamed("a/b")
+	ts := NewTrustStore(inmemory.New(), name)
+
+	if _, _, err := ts.Get(ctx, "root"); err != ErrTrustMetadataUnknown {
+		t.Fatalf("expected unknown trust metadata, got %v", err)
+	}
+
+	first := []byte(`{"signed":{"version":1}}`)
+	firstDigest, err := ts.Put(ctx, "root", first)
+	if err != nil {
+		t.Fatalf("unexpected error storing trust metadata: %v", err)
+	}
+
+	second := []byte(`{"signed":{"version":2}}`)
+	secondDigest, err := ts.Put(ctx, "root", second)
+	if err != nil {
+		t.Fatalf("unexpected error storing trust metadata: %v", err)
+	}
+
+	// A delegated role is stored beneath the role delegating to it.
+	delegated := []byte(`{"signed":{"version":1,"delegated":true}}`)
+	if _, err := ts.Put(ctx, "targets/releases", delegated); err != nil {
+		t.Fatalf("unexpected error storing delegated trust metadata: %v", err)
+	}
+	if _, err := ts.Put(ctx, "targets", first); err != nil {
+		t.Fatalf("unexpected error storing trust metadata: %v", err)
+	}
+
+	content, dgst, err := ts.Get(ctx, "root")
+	if err != nil {
+		t.Fatalf("unexpected error reading trust metadata: %v", err)
+	}
+	if dgst != secondDigest || !bytes.Equal(content, second) {
+		t.Fatalf("unexpected current revision %s: %q", dgst, content)
+	}
+
+	content, err = ts.GetRevision(ctx, "root", firstDigest)
+	if err != nil {
+		t.Fatalf("unexpected error reading trust metadata revision: %v", err)
+	}
+	if !bytes.Equal(content, first) {
+		t.Fatalf("unexpected revision content: %q != %q", content, first)
+	}
+
+	if err := ts.Delete(ctx, "targets"); err != nil {
+		t.Fatalf("unexpected error deleting trust metadata: %v", err)
+	}
+	if _, _, err := ts.Get(ctx, "targets"); err != ErrTrustMetadataUnknown {
+		t.Fatalf("expected deleted trust metadata to be unknown, got %v", err)
+	}
+	if _, err := ts.GetRevision(ctx, "targets", firstDigest); err != ErrTrustMetadataUnknown {
+		t.Fatalf("expected deleted revision to be unknown, got %v", err)
+	}
+	if content, _, err := ts.Get(ctx, "targets/releases"); err != nil || !bytes.Equal(content, delegated) {
+		t.Fatalf("expected delegated trust metadata to be kept, got %q, %v", content, err)
+	}
+	if err := ts.Delete(ctx, "targets"); err != ErrTrustMetadataUnknown {
+		t.Fatalf("expected deleting unknown trust metadata to fail, got %v", err)
+	}
+}
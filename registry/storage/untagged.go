@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"path"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// UntaggedManifestOpts contains options for DeleteUntaggedManifests.
+type UntaggedManifestOpts struct {
+	// Age is how long a manifest must have had no tag to be deleted.
+	Age time.Duration
+
+	// DryRun reports the manifests which would be deleted without deleting
+	// them.
+	DryRun bool
+
+	// Pins protect manifests from deletion. A repository pin matching the
+	// repository keeps all its manifests.
+	Pins []Pin
+}
+
+// UntaggedManifest is a manifest deleted by DeleteUntaggedManifests.
+type UntaggedManifest struct {
+	Digest digest.Digest
+
+	// Untagged is the time since which the manifest had no tag. A referrer
+	// deleted along with its subject may have been untagged for less than
+	// the age of the policy.
+	Untagged time.Time
+
+	Manifest distribution.Manifest
+}
+
+// untaggedRevision is the state of a manifest revision considered by
+// DeleteUntaggedManifests.
+type untaggedRevision struct {
+	untagged time.Time
+	manifest distribution.Manifest
+	subject  digest.Digest
+}
+
+// DeleteUntaggedManifests deletes the manifests of the repository which have
+// had no tag for longer than opts.Age, returning those deleted. Manifests
+// listed by a manifest list which is kept are kept as well. Manifests
+// referring to a subject, such as SBOMs, are kept as long as their subject,
+// and deleted along with it. The links to the referrers of deleted manifests
+// are removed.
+//
+// A manifest is untagged since the latest of the time it was put, the time a
+// tag pointing at it was removed and the time a tag which pointed at it was
+// moved to another manifest.
+func DeleteUntaggedManifests(ctx context.Context, storageDriver driver.StorageDriver, repository distribution.Repository, opts UntaggedManifestOpts) ([]UntaggedManifest, error) {
+	name := repository.Named().Name()
+	pinned := make(map[digest.Digest]struct{})
+	for _, pin := range opts.Pins {
+		if pin.Repository != "" && matchPattern(pin.Repository, name) {
+			return nil, nil
+		}
+		if pin.Digest != "" {
+			pinned[pin.Digest] = struct{}{}
+		}
+	}
+
+	tagged, retagged, err := manifestTagTimes(ctx, storageDriver, name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []digest.Digest
+	revisions := make(map[digest.Digest]*untaggedRevision)
+	err = enumerateManifestRevisions(ctx, storageDriver, name, func(revision, linked digest.Digest) error {
+		untagged, err := revisionUntaggedTime(ctx, storageDriver, name, revision)
+		if err != nil {
+			return err
+		}
+		if t, ok := retagged[revision]; ok && t.After(untagged) {
+			untagged = t
+		}
+
+		manifest, err := manifests.Get(ctx, revision)
+		if err != nil {
+			return err
+		}
+
+		r := &untaggedRevision{
+			untagged: untagged,
+			manifest: manifest,
+		}
+		if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+			subject, err := m.Subject()
+			if err != nil {
+				return err
+			}
+			if subject != nil {
+				r.subject = subject.Digest
+			}
+		}
+		revisions[revision] = r
+		order = append(order, revision)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the tagged, pinned and recently untagged manifests, then the
+	// manifests listed by, or referring to, those kept.
+	cutoff := time.Now().Add(-opts.Age)
+	kept := make(map[digest.Digest]struct{})
+	for dgst, r := range revisions {
+		_, isTagged := tagged[dgst]
+		_, isPinned := pinned[dgst]
+		_, hasSubject := revisions[r.subject]
+		if isTagged || isPinned || (!hasSubject && r.untagged.After(cutoff)) {
+			kept[dgst] = struct{}{}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for dgst, r := range revisions {
+			if _, ok := kept[dgst]; ok {
+				if _, ok := r.manifest.(*manifestlist.DeserializedManifestList); ok {
+					for _, desc := range r.manifest.References() {
+						if _, ok := kept[desc.Digest]; !ok {
+							kept[desc.Digest] = struct{}{}
+							changed = true
+						}
+					}
+				}
+				continue
+			}
+			if _, ok := kept[r.subject]; ok && r.subject != "" {
+				kept[dgst] = struct{}{}
+				changed = true
+			}
+		}
+	}
+
+	var deleted []UntaggedManifest
+	for _, dgst := range order {
+		if _, ok := kept[dgst]; ok {
+			continue
+		}
+		r := revisions[dgst]
+
+		if !opts.DryRun {
+			if err := deleteUntaggedRevision(ctx, storageDriver, manifests, name, dgst, r); err != nil {
+				return deleted, err
+			}
+		}
+		deleted = append(deleted, UntaggedManifest{
+			Digest:   dgst,
+			Untagged: r.untagged,
+			Manifest: r.manifest,
+		})
+	}
+
+	return deleted, nil
+}
+
+// deleteUntaggedRevision deletes a manifest revision along with the links to
+// its referrers and its own link as a referrer of its subject.
+func deleteUntaggedRevision(ctx context.Context, storageDriver driver.StorageDriver, manifests distribution.ManifestService, name string, dgst digest.Digest, r *untaggedRevision) error {
+	if err := manifests.Delete(ctx, dgst); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, 3)
+	referrersPath, err := pathFor(referrersPathSpec{name: name, subject: dgst})
+	if err != nil {
+		return err
+	}
+	untaggedPath, err := pathFor(manifestUntaggedPathSpec{name: name, revision: dgst})
+	if err != nil {
+		return err
+	}
+	paths = append(paths, referrersPath, untaggedPath)
+
+	if r.subject != "" {
+		linkPath, err := pathFor(referrerLinkPathSpec{name: name, subject: r.subject, referrer: dgst})
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path.Dir(linkPath))
+	}
+
+	for _, p := range paths {
+		if err := storageDriver.Delete(ctx, p); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// manifestTagTimes returns the manifest revisions the tags of the named
+// repository point at and, for the revisions tags pointed at before, the
+// latest time one of those tags was moved.
+func manifestTagTimes(ctx context.Context, storageDriver driver.StorageDriver, name string) (map[digest.Digest]struct{}, map[digest.Digest]time.Time, error) {
+	tagged := make(map[digest.Digest]struct{})
+	retagged := make(map[digest.Digest]time.Time)
+
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: name})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags, err := storageDriver.List(ctx, tagsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return tagged, retagged, nil
+		}
+		return nil, nil, err
+	}
+
+	for _, tagPath := range tags {
+		tag := path.Base(tagPath)
+
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: tag})
+		if err != nil {
+			return nil, nil, err
+		}
+		fi, err := storageDriver.Stat(ctx, currentPath)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, nil, err
+		}
+		content, err := storageDriver.GetContent(ctx, currentPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		current, err := digest.ParseDigest(string(content))
+		if err != nil {
+			return nil, nil, err
+		}
+		tagged[current] = struct{}{}
+
+		indexPath, err := pathFor(manifestTagIndexPathSpec{name: name, tag: tag})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = enumerateLinks(ctx, storageDriver, indexPath, func(_, linked digest.Digest) error {
+			if linked != current && fi.ModTime().After(retagged[linked]) {
+				retagged[linked] = fi.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return tagged, retagged, nil
+}
+
+// revisionUntaggedTime returns the latest of the time a manifest revision was
+// put and the time a tag pointing at it was last removed.
+func revisionUntaggedTime(ctx context.Context, storageDriver driver.StorageDriver, name string, revision digest.Digest) (time.Time, error) {
+	linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: revision})
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := storageDriver.Stat(ctx, linkPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	untagged := fi.ModTime()
+
+	untaggedPath, err := pathFor(manifestUntaggedPathSpec{name: name, revision: revision})
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err = storageDriver.Stat(ctx, untaggedPath)
+	switch err.(type) {
+	case nil:
+		if fi.ModTime().After(untagged) {
+			untagged = fi.ModTime()
+		}
+	case driver.PathNotFoundError:
+	default:
+		return time.Time{}, err
+	}
+
+	return untagged, nil
+}
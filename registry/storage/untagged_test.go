@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// TestDeleteUntaggedManifests checks that manifests without tags are deleted
+// once old enough, unless they are pinned or listed by a kept manifest list,
+// and that their referrers are deleted along with them.
+func TestDeleteUntaggedManifests(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	reg, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.ParseNamed("foo/bar")
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	blobs := repo.Blobs(ctx)
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	putManifest := func(m distribution.Manifest) distribution.Descriptor {
+		dgst, err := ms.Put(ctx, m)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		mediaType, payload, _ := m.Payload()
+		return distribution.Descriptor{MediaType: mediaType, Size: int64(len(payload)), Digest: dgst}
+	}
+	putImage := func(content string, subject *distribution.Descriptor) distribution.Descriptor {
+		layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte(content))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+
+		p, err := json.Marshal(struct {
+			schema2.Manifest
+			Subject *distribution.Descriptor `json:"subject,omitempty"`
+		}{
+			Manifest: schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config:    config,
+				Layers:    []distribution.Descriptor{layer},
+			},
+			Subject: subject,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling manifest: %v", err)
+		}
+		var m schema2.DeserializedManifest
+		if err := m.UnmarshalJSON(p); err != nil {
+			t.Fatalf("unexpected error unmarshaling manifest: %v", err)
+		}
+		return putManifest(&m)
+	}
+	tag := func(tag string, desc distribution.Descriptor) {
+		if err := tags.Tag(ctx, tag, desc); err != nil {
+			t.Fatalf("unexpected error tagging %s: %v", tag, err)
+		}
+	}
+
+	previous := putImage("previous", nil)
+	tag("latest", previous)
+	previousSBOM := putImage("previous sbom", &previous)
+	current := putImage("current", nil)
+	currentSBOM := putImage("current sbom", &current)
+	retagged := time.Now()
+	tag("latest", current)
+
+	removed := putImage("removed", nil)
+	tag("removed", removed)
+	untagged := time.Now()
+	if err := tags.Untag(ctx, "removed"); err != nil {
+		t.Fatalf("unexpected error removing tag: %v", err)
+	}
+
+	platform := putImage("platform", nil)
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{Descriptor: platform}})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest list: %v", err)
+	}
+	tag("multi", putManifest(list))
+
+	pinned := putImage("pinned", nil)
+
+	// Nothing was untagged for an hour.
+	deleted, err := DeleteUntaggedManifests(ctx, d, repo, UntaggedManifestOpts{Age: time.Hour, DryRun: true})
+	if err != nil || len(deleted) != 0 {
+		t.Fatalf("unexpected manifests to delete: %v, %v", deleted, err)
+	}
+
+	// A repository pin keeps every manifest.
+	deleted, err = DeleteUntaggedManifests(ctx, d, repo, UntaggedManifestOpts{Pins: []Pin{{Repository: "foo/*"}}})
+	if err != nil || len(deleted) != 0 {
+		t.Fatalf("unexpected manifests deleted from pinned repository: %v, %v", deleted, err)
+	}
+
+	deleted, err = DeleteUntaggedManifests(ctx, d, repo, UntaggedManifestOpts{Pins: []Pin{{Digest: pinned.Digest}}})
+	if err != nil {
+		t.Fatalf("unexpected error deleting untagged manifests: %v", err)
+	}
+
+	expected := map[digest.Digest]time.Time{
+		previous.Digest:     retagged,
+		previousSBOM.Digest: time.Time{},
+		removed.Digest:      untagged,
+	}
+	if len(deleted) != len(expected) {
+		t.Fatalf("unexpected deleted manifests: %v", deleted)
+	}
+	for _, m := range deleted {
+		since, ok := expected[m.Digest]
+		if !ok || m.Untagged.Before(since) || m.Manifest == nil {
+			t.Fatalf("unexpected deleted manifest %s untagged since %s", m.Digest, m.Untagged)
+		}
+		if exists, err := ms.Exists(ctx, m.Digest); err != nil || exists {
+			t.Fatalf("manifest %s was not deleted: %v", m.Digest, err)
+		}
+	}
+
+	for _, desc := range []distribution.Descriptor{current, currentSBOM, platform, pinned} {
+		if exists, err := ms.Exists(ctx, desc.Digest); err != nil || !exists {
+			t.Fatalf("manifest %s was deleted: %v", desc.Digest, err)
+		}
+	}
+
+	referrers, err := Referrers(ctx, d, named.Name(), current.Digest)
+	if err != nil || len(referrers) != 1 || referrers[0].Digest != currentSBOM.Digest {
+		t.Fatalf("unexpected referrers of kept manifest: %v, %v", referrers, err)
+	}
+	referrersPath, _ := pathFor(referrersPathSpec{name: named.Name(), subject: previous.Digest})
+	if _, err := d.List(ctx, referrersPath); err == nil {
+		t.Fatalf("referrers of deleted manifest were not removed")
+	}
+}
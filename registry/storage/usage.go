@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// RepositoryUsage is the storage consumed by the blobs a repository
+// references.
+type RepositoryUsage struct {
+	Name string `json:"name"`
+
+	// Blobs is the number of blobs referenced by the repository.
+	Blobs int `json:"blobs"`
+
+	// Bytes is the size of all the blobs referenced by the repository.
+	Bytes int64 `json:"bytes"`
+
+	// UniqueBytes is the size of the blobs referenced by no other
+	// repository, which deleting the repository would reclaim.
+	UniqueBytes int64 `json:"uniqueBytes"`
+
+	// SharedBytes is the size of the blobs also referenced by other
+	// repositories.
+	SharedBytes int64 `json:"sharedBytes"`
+}
+
+// UsageReport describes the storage consumed by the registry.
+type UsageReport struct {
+	// Computed is the time at which the computation of the report started.
+	Computed time.Time `json:"computed"`
+
+	// Duration is the time the computation took.
+	Duration time.Duration `json:"duration"`
+
+	// Blobs is the number of distinct blobs referenced by manifests.
+	Blobs int `json:"blobs"`
+
+	// Bytes is the size of the distinct blobs referenced by manifests.
+	// Unreferenced blobs, removed by garbage collection, are not counted.
+	Bytes int64 `json:"bytes"`
+
+	// SharedBytes is the size of the blobs referenced by more than one
+	// repository.
+	SharedBytes int64 `json:"sharedBytes"`
+
+	// Repositories lists the usage of each repository, by name.
+	Repositories []RepositoryUsage `json:"repositories"`
+}
+
+// UsageOpts contains options for ComputeUsage.
+type UsageOpts struct {
+	// Workers is the number of repositories read, or blobs sized,
+	// concurrently. It defaults to one.
+	Workers int
+
+	// RateLimit, if positive, is the maximum number of repositories read,
+	// or blobs sized, per second.
+	RateLimit float64
+}
+
+// ComputeUsage reads every manifest revision of every repository, as the
+// mark phase of garbage collection does, and sizes the blobs they reference.
+// Unlike garbage collection, it may run while the registry accepts writes:
+// the report then reflects the content at some point during the run.
+func ComputeUsage(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, opts UsageOpts) (UsageReport, error) {
+	report := UsageReport{Computed: time.Now()}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	limiter := newGCRateLimiter(opts.RateLimit)
+	defer limiter.stop()
+
+	var (
+		mu         sync.Mutex
+		references = make(map[string][]digest.Digest)
+		refcounts  = make(map[digest.Digest]int)
+	)
+
+	err := runGCWorkers(workers, limiter, func(submit func(string) error) error {
+		return enumerateRepositories(ctx, namespace, submit)
+	}, func(name string) error {
+		marks := newMarkState()
+		if err := markRepository(ctx, storageDriver, namespace, name, marks); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for dgst := range marks.marked {
+			references[name] = append(references[name], dgst)
+			refcounts[dgst]++
+		}
+		return nil
+	})
+	if err != nil {
+		return UsageReport{}, fmt.Errorf("failed to read repositories: %v", err)
+	}
+
+	// Blobs are stat'ed in the layouts the registry reads from, if known.
+	var statter distribution.BlobStatter = &blobStatter{driver: storageDriver}
+	if reg, ok := namespace.(*registry); ok {
+		statter = reg.statter
+	}
+
+	sizes := make(map[digest.Digest]int64, len(refcounts))
+	err = runGCWorkers(workers, limiter, func(submit func(string) error) error {
+		for dgst := range refcounts {
+			if err := submit(string(dgst)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(item string) error {
+		dgst := digest.Digest(item)
+		desc, err := statter.Stat(ctx, dgst)
+		switch err {
+		case nil:
+		case distribution.ErrBlobUnknown:
+			// A manifest may reference a blob which was never pushed,
+			// such as a foreign layer.
+			context.GetLogger(ctx).Debugf("usage: blob %s referenced but unknown", dgst)
+		default:
+			return fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		sizes[dgst] = desc.Size
+		return nil
+	})
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	for dgst, count := range refcounts {
+		report.Blobs++
+		report.Bytes += sizes[dgst]
+		if count > 1 {
+			report.SharedBytes += sizes[dgst]
+		}
+	}
+
+	for name, digests := range references {
+		usage := RepositoryUsage{Name: name, Blobs: len(digests)}
+		for _, dgst := range digests {
+			usage.Bytes += sizes[dgst]
+			if refcounts[dgst] > 1 {
+				usage.SharedBytes += sizes[dgst]
+			} else {
+				usage.UniqueBytes += sizes[dgst]
+			}
+		}
+		report.Repositories = append(report.Repositories, usage)
+	}
+	sort.Sort(repositoryUsageByName(report.Repositories))
+
+	report.Duration = time.Since(report.Computed)
+	return report, nil
+}
+
+type repositoryUsageByName []RepositoryUsage
+
+func (r repositoryUsageByName) Len() int           { return len(r) }
+func (r repositoryUsageByName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+func (r repositoryUsageByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// SaveUsageReport stores the report, replacing the last one, so that every
+// registry instance serving the storage can return it.
+func SaveUsageReport(ctx context.Context, storageDriver driver.StorageDriver, report UsageReport) error {
+	usagePath, err := pathFor(usageReportPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	return storageDriver.PutContent(ctx, usagePath, p)
+}
+
+// LoadUsageReport returns the last stored report. A PathNotFoundError is
+// returned if no report was stored yet.
+func LoadUsageReport(ctx context.Context, storageDriver driver.StorageDriver) (UsageReport, error) {
+	var report UsageReport
+
+	usagePath, err := pathFor(usageReportPathSpec{})
+	if err != nil {
+		return report, err
+	}
+
+	p, err := storageDriver.GetContent(ctx, usagePath)
+	if err != nil {
+		return report, err
+	}
+
+	if err := json.Unmarshal(p, &report); err != nil {
+		return report, fmt.Errorf("invalid usage report: %v", err)
+	}
+	return report, nil
+}
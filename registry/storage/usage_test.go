@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestComputeUsage(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	shared := []byte("shared layer")
+	sizes := make(map[string]int64)
+
+	// Both repositories reference the shared layer, and each its own
+	// config, layer and manifest.
+	for _, name := range []string{"foo/bar", "foo/baz"} {
+		named, _ := reference.ParseNamed(name)
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+
+		blobs := repo.Blobs(ctx)
+		config, err := blobs.Put(ctx, schema2.MediaTypeConfig, []byte(`{"repository":"`+name+`"}`))
+		if err != nil {
+			t.Fatalf("unexpected error putting config: %v", err)
+		}
+		layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer of "+name))
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+		sharedLayer, err := blobs.Put(ctx, schema2.MediaTypeLayer, shared)
+		if err != nil {
+			t.Fatalf("unexpected error putting layer: %v", err)
+		}
+
+		m, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    config,
+			Layers:    []distribution.Descriptor{layer, sharedLayer},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		_, payload, _ := m.Payload()
+
+		ms, err := repo.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ms.Put(ctx, m); err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+
+		sizes[name] = config.Size + layer.Size + int64(len(payload))
+	}
+
+	if _, err := LoadUsageReport(ctx, d); err == nil {
+		t.Fatalf("expected an error loading a report before one is saved")
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error loading report: %v", err)
+	}
+
+	report, err := ComputeUsage(ctx, d, registry, UsageOpts{Workers: 2})
+	if err != nil {
+		t.Fatalf("unexpected error computing usage: %v", err)
+	}
+
+	if report.Blobs != 7 {
+		t.Fatalf("unexpected number of blobs: %d != 7", report.Blobs)
+	}
+	if report.SharedBytes != int64(len(shared)) {
+		t.Fatalf("unexpected shared bytes: %d != %d", report.SharedBytes, len(shared))
+	}
+	if expected := sizes["foo/bar"] + sizes["foo/baz"] + int64(len(shared)); report.Bytes != expected {
+		t.Fatalf("unexpected bytes: %d != %d", report.Bytes, expected)
+	}
+
+	if len(report.Repositories) != 2 {
+		t.Fatalf("unexpected repositories: %v", report.Repositories)
+	}
+	for i, name := range []string{"foo/bar", "foo/baz"} {
+		usage := report.Repositories[i]
+		if usage.Name != name || usage.Blobs != 4 || usage.UniqueBytes != sizes[name] || usage.SharedBytes != int64(len(shared)) || usage.Bytes != usage.UniqueBytes+usage.SharedBytes {
+			t.Fatalf("unexpected usage of %s: %#v", name, usage)
+		}
+	}
+
+	if err := SaveUsageReport(ctx, d, report); err != nil {
+		t.Fatalf("unexpected error saving report: %v", err)
+	}
+	saved, err := LoadUsageReport(ctx, d)
+	if err != nil {
+		t.Fatalf("unexpected error loading report: %v", err)
+	}
+	if saved.Bytes != report.Bytes || len(saved.Repositories) != 2 {
+		t.Fatalf("unexpected saved report: %#v", saved)
+	}
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/registry/storage/driver"
 )
 
@@ -19,3 +21,19 @@ func exists(ctx context.Context, drv driver.StorageDriver, path string) (bool, e
 
 	return true, nil
 }
+
+// statMany describes each of the blobs identified by dgsts, at once if the
+// statter implements BlobBatchStatter and with a Stat call per blob
+// otherwise.
+func statMany(ctx context.Context, statter distribution.BlobStatter, dgsts []digest.Digest) ([]distribution.Descriptor, []error) {
+	if bs, ok := statter.(distribution.BlobBatchStatter); ok {
+		return bs.StatMany(ctx, dgsts)
+	}
+
+	descs := make([]distribution.Descriptor, len(dgsts))
+	errs := make([]error, len(dgsts))
+	for i, dgst := range dgsts {
+		descs[i], errs[i] = statter.Stat(ctx, dgst)
+	}
+	return descs, errs
+}
@@ -27,23 +27,39 @@ type Vacuum struct {
 	ctx    context.Context
 }
 
-// RemoveBlob removes a blob from the filesystem
+// RemoveBlob removes a blob from the filesystem, in every blob store layout.
+// A PathNotFoundError is returned if no layout holds the blob.
 func (v Vacuum) RemoveBlob(dgst string) error {
 	d, err := digest.ParseDigest(dgst)
 	if err != nil {
 		return err
 	}
 
-	blobPath, err := pathFor(blobDataPathSpec{digest: d})
-	if err != nil {
-		return err
-	}
-	context.GetLogger(v.ctx).Infof("Deleting blob: %s", blobPath)
-	err = v.driver.Delete(v.ctx, blobPath)
-	if err != nil {
-		return err
+	var notFound error
+	found := false
+	for layout := 1; layout <= MaxBlobPathLayout; layout++ {
+		blobPath, err := pathFor(blobDataPathSpec{digest: d, layout: layout})
+		if err != nil {
+			return err
+		}
+
+		err = v.driver.Delete(v.ctx, blobPath)
+		switch err.(type) {
+		case nil:
+			context.GetLogger(v.ctx).Infof("Deleting blob: %s", blobPath)
+			found = true
+		case driver.PathNotFoundError:
+			if notFound == nil {
+				notFound = err
+			}
+		default:
+			return err
+		}
 	}
 
+	if !found {
+		return notFound
+	}
 	return nil
 }
 
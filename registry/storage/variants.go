@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrVariantUnknown is returned when no variant of a blob is stored.
+	ErrVariantUnknown = errors.New("variant unknown")
+
+	// ErrNotGzip is returned when recompressing a blob which is not gzip
+	// compressed.
+	ErrNotGzip = errors.New("blob is not gzip compressed")
+)
+
+// VariantStore keeps the variants of the gzip compressed blobs of a
+// repository recompressed with zstd, alongside the repository in the storage
+// backend. A variant is derived from its blob, so it is computed once and kept
+// until the repository is deleted or its blob garbage collected. Variants are
+// not blobs of the repository: they are addressed by their own digest and
+// never served in place of their blob.
+type VariantStore struct {
+	driver storagedriver.StorageDriver
+	name   string
+}
+
+// NewVariantStore returns a VariantStore for the variants of the blobs of the
+// named repository.
+func NewVariantStore(driver storagedriver.StorageDriver, name reference.Named) *VariantStore {
+	return &VariantStore{
+		driver: driver,
+		name:   name.Name(),
+	}
+}
+
+// Stat returns the descriptor of the zstd variant of the blob dgst.
+func (vs *VariantStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	linkPath, err := pathFor(variantLinkPathSpec{name: vs.name, digest: dgst, compression: schema2.CompressionZstd})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	content, err := vs.driver.GetContent(ctx, linkPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return distribution.Descriptor{}, ErrVariantUnknown
+		}
+		return distribution.Descriptor{}, err
+	}
+	variant, err := digest.ParseDigest(strings.TrimSpace(string(content)))
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	dataPath, err := pathFor(variantDataPathSpec{name: vs.name, digest: dgst, compression: schema2.CompressionZstd})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	fi, err := vs.driver.Stat(ctx, dataPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return distribution.Descriptor{}, ErrVariantUnknown
+		}
+		return distribution.Descriptor{}, err
+	}
+
+	return distribution.Descriptor{
+		MediaType: schema2.MediaTypeOCILayerZstd,
+		Digest:    variant,
+		Size:      fi.Size(),
+	}, nil
+}
+
+// ServeVariant serves the zstd variant of the blob dgst, described by desc.
+func (vs *VariantStore) ServeVariant(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest, desc distribution.Descriptor) error {
+	dataPath, err := pathFor(variantDataPathSpec{name: vs.name, digest: dgst, compression: schema2.CompressionZstd})
+	if err != nil {
+		return err
+	}
+
+	fr, err := newFileReader(ctx, vs.driver, dataPath, desc.Size)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.f", blobCacheControlMaxAge.Seconds()))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", desc.MediaType)
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
+
+	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, fr)
+	return nil
+}
+
+// Recompress stores the zstd variant of the blob dgst, whose gzip compressed
+// content is read from source, and returns its descriptor. ErrNotGzip is
+// returned if the content is not gzip compressed. The variant is written
+// aside and moved in place once complete, and its link written last, so that
+// it is never read partially.
+func (vs *VariantStore) Recompress(ctx context.Context, dgst digest.Digest, source io.Reader, level zstd.EncoderLevel) (distribution.Descriptor, error) {
+	dataPath, err := pathFor(variantDataPathSpec{name: vs.name, digest: dgst, compression: schema2.CompressionZstd})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	linkPath, err := pathFor(variantLinkPathSpec{name: vs.name, digest: dgst, compression: schema2.CompressionZstd})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	gz, err := gzip.NewReader(source)
+	if err != nil {
+		if err == gzip.ErrHeader || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return distribution.Descriptor{}, ErrNotGzip
+		}
+		return distribution.Descriptor{}, err
+	}
+	defer gz.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		enc, err := zstd.NewWriter(pw, zstd.WithEncoderLevel(level))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(enc, gz); err != nil {
+			enc.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(enc.Close())
+	}()
+
+	tempPath := dataPath + "." + uuid.Generate().String()
+	digester := digest.Canonical.New()
+	size, err := vs.driver.WriteStream(ctx, tempPath, 0, io.TeeReader(pr, digester.Hash()))
+	pr.CloseWithError(err)
+	if err == nil {
+		err = vs.driver.Move(ctx, tempPath, dataPath)
+	}
+	if err == nil {
+		err = vs.driver.PutContent(ctx, linkPath, []byte(digester.Digest()))
+	}
+	if err != nil {
+		if err := vs.driver.Delete(ctx, tempPath); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				context.GetLogger(ctx).Errorf("error deleting partial variant %s: %v", tempPath, err)
+			}
+		}
+		return distribution.Descriptor{}, err
+	}
+
+	return distribution.Descriptor{
+		MediaType: schema2.MediaTypeOCILayerZstd,
+		Digest:    digester.Digest(),
+		Size:      size,
+	}, nil
+}
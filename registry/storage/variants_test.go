@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestVariantStore(t *testing.T) {
+	ctx := context.Background()
+	name, _ := reference.ParseNamed("a/b")
+	driver := inmemory.New()
+	vs := NewVariantStore(driver, name)
+
+	content := bytes.Repeat([]byte("layer content "), 4096)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(content)
+	gz.Close()
+	dgst := digest.FromBytes(buf.Bytes())
+
+	if _, err := vs.Stat(ctx, dgst); err != ErrVariantUnknown {
+		t.Fatalf("expected unknown variant, got %v", err)
+	}
+
+	desc, err := vs.Recompress(ctx, dgst, bytes.NewReader(buf.Bytes()), zstd.SpeedDefault)
+	if err != nil {
+		t.Fatalf("unexpected error recompressing blob: %v", err)
+	}
+	if stat, err := vs.Stat(ctx, dgst); err != nil || stat != desc {
+		t.Fatalf("unexpected variant: %+v, %v", stat, err)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	if err := vs.ServeVariant(ctx, w, r, dgst, desc); err != nil {
+		t.Fatalf("unexpected error serving variant: %v", err)
+	}
+	if w.Header().Get("Docker-Content-Digest") != desc.Digest.String() || w.Header().Get("Content-Type") != desc.MediaType {
+		t.Fatalf("unexpected variant headers: %v", w.Header())
+	}
+	if digest.FromBytes(w.Body.Bytes()) != desc.Digest {
+		t.Fatalf("served variant does not match its digest")
+	}
+
+	dec, err := zstd.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected error reading variant: %v", err)
+	}
+	defer dec.Close()
+	p, err := ioutil.ReadAll(dec)
+	if err != nil || !bytes.Equal(p, content) {
+		t.Fatalf("variant content differs from the blob: %v", err)
+	}
+
+	plain := []byte("not compressed")
+	if _, err := vs.Recompress(ctx, digest.FromBytes(plain), bytes.NewReader(plain), zstd.SpeedDefault); err != ErrNotGzip {
+		t.Fatalf("expected an error recompressing an uncompressed blob, got %v", err)
+	}
+}